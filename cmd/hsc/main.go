@@ -24,8 +24,14 @@ var (
 	renterDownloadAsync    bool   // Downloads files asynchronously
 	renterListVerbose      bool   // Show additional info about uploaded files.
 	renterShowHistory      bool   // Show download history in addition to download queue.
+	renterUploadDedup      bool   // Deduplicate the chunks of uploaded files.
 	siaDir                 string // Path to sia data dir
+	walletBatchDryRun      bool   // Only validate a batch payout and estimate its fees.
 	walletRawTxn           bool   // Encode/decode transactions in base64-encoded binary.
+	walletTxnCategory      string // Only show transactions of this category.
+	walletTxnDescending    bool   // Show the newest transactions first.
+	walletTxnLabel         string // Only show transactions involving addresses with this label.
+	walletTxnLimit         int    // Maximum number of transactions to show.
 
 	allowanceFunds              string // amount of money to be used within a period
 	allowancePeriod             string // length of period
@@ -37,6 +43,50 @@ var (
 	allowanceExpectedRedundancy string // expected redundancy of most uploaded files
 )
 
+var (
+	// Host policy parameters.
+	policyWhitelist        []string // public keys of the only hosts allowed
+	policyBlacklist        []string // public keys of hosts that are never allowed
+	policySubnets          []string // CIDR subnets the hosts must be in
+	policyCountries        []string // countries the hosts must be in
+	policyMinScore         string   // minimum score of the hosts
+	policyMaxContractPrice string   // maximum contract price of the hosts
+	policyMaxStoragePrice  string   // maximum storage price of the hosts per TB per month
+	policyMaxUploadPrice   string   // maximum upload price of the hosts per TB
+	policyMaxDownloadPrice string   // maximum download price of the hosts per TB
+)
+
+var (
+	// Sync job parameters.
+	renterSyncIgnore []string // patterns of the local files that aren't synced
+	renterSyncMirror bool     // delete the files that are deleted locally
+)
+
+var (
+	// Version policy parameters.
+	versionMaxVersions uint64 // number of versions to keep
+	versionMaxDays     uint64 // number of days to keep versions
+)
+
+var (
+	// File metadata parameters.
+	renterContentType string   // content type of the uploaded files
+	renterMetadata    []string // key=value tags of the uploaded files
+
+	// File query parameters.
+	queryPrefix         string   // prefix of the hyperspace paths of the files
+	queryContentType    string   // content type of the files
+	queryTags           []string // key=value tags of the files
+	queryMinSize        string   // minimum size of the files
+	queryMaxSize        string   // maximum size of the files
+	queryMinHealth      string   // minimum health of the files
+	queryMaxHealth      string   // maximum health of the files
+	queryCreatedAfter   string   // time after which the files were created
+	queryCreatedBefore  string   // time before which the files were created
+	queryModifiedAfter  string   // time after which the files were modified
+	queryModifiedBefore string   // time before which the files were modified
+)
+
 var (
 	// Globals.
 	rootCmd    *cobra.Command // Root command cobra object, used by bash completion cmd.
@@ -127,24 +177,52 @@ func main() {
 	root.AddCommand(walletCmd)
 	walletCmd.AddCommand(walletAddressesCmd, walletChangepasswordCmd, walletGetAddressCmd, walletInitCmd, walletInitSeedCmd,
 		walletLoadCmd, walletLockCmd, walletNewAddressCmd, walletSeedsCmd, walletSendCmd, walletSweepCmd, walletSignCmd,
-		walletBalanceCmd, walletBroadcastCmd, walletTransactionsCmd, walletUnlockCmd)
+		walletBalanceCmd, walletBatchSendCmd, walletBroadcastCmd, walletConsolidateCmd, walletTransactionsCmd, walletUnlockCmd)
 	walletInitCmd.Flags().BoolVarP(&initPassword, "password", "p", false, "Prompt for a custom password")
 	walletInitCmd.Flags().BoolVarP(&initForce, "force", "", false, "destroy the existing wallet and re-encrypt")
 	walletInitSeedCmd.Flags().BoolVarP(&initForce, "force", "", false, "destroy the existing wallet")
 	walletLoadCmd.AddCommand(walletLoadSeedCmd, walletLoadSiagCmd)
 	walletSendCmd.AddCommand(walletSendSiacoinsCmd)
 	walletUnlockCmd.Flags().BoolVarP(&initPassword, "password", "p", false, "Display interactive password prompt even if HYPERSPACE_WALLET_PASSWORD is set")
+	walletBatchSendCmd.Flags().BoolVarP(&walletBatchDryRun, "dry-run", "", false, "Validate the payments and estimate fees without sending anything")
+	walletCmd.PersistentFlags().StringVarP(&httpClient.Wallet, "wallet", "", "", "named wallet to operate on instead of the default wallet")
 	walletBroadcastCmd.Flags().BoolVarP(&walletRawTxn, "raw", "", false, "Decode transaction as base64 instead of JSON")
 	walletSignCmd.Flags().BoolVarP(&walletRawTxn, "raw", "", false, "Encode signed transaction as base64 instead of JSON")
+	walletTransactionsCmd.Flags().StringVarP(&walletTxnCategory, "category", "", "", "Only show transactions of a category: miner, contract, send, receive or watch")
+	walletTransactionsCmd.Flags().BoolVarP(&walletTxnDescending, "descending", "", false, "Show the newest transactions first")
+	walletTransactionsCmd.Flags().StringVarP(&walletTxnLabel, "label", "", "", "Only show transactions involving addresses with this label")
+	walletTransactionsCmd.Flags().IntVarP(&walletTxnLimit, "limit", "", 0, "Maximum number of confirmed transactions to show, 0 for all")
+
+	root.AddCommand(walletsCmd)
+	walletsCmd.AddCommand(walletsCreateCmd, walletsLoadCmd, walletsUnloadCmd)
 
 	root.AddCommand(renterCmd)
 	renterCmd.AddCommand(renterFilesDeleteCmd, renterFilesDownloadCmd,
 		renterDownloadsCmd, renterAllowanceCmd, renterSetAllowanceCmd,
 		renterContractsCmd, renterFilesListCmd, renterFilesRenameCmd,
 		renterFilesUploadCmd, renterUploadsCmd, renterExportCmd,
-		renterPricesCmd)
+		renterPricesCmd, renterDirCmd, renterStuckCmd, renterShareCmd,
+		renterLoadCmd, renterMountCmd, renterMountsCmd, renterUnmountCmd,
+		renterBackupCmd, renterBackupsCmd, renterRestoreCmd, renterVerifyCmd,
+		renterSetRedundancyCmd, renterPolicyCmd, renterVersionsCmd,
+		renterSyncCmd, renterSyncsCmd, renterUnsyncCmd, renterSetMetadataCmd,
+		renterQueryCmd, renterMigrationsCmd)
 
 	renterContractsCmd.AddCommand(renterContractsViewCmd)
+	renterDirCmd.AddCommand(renterDirCreateCmd, renterDirDeleteCmd, renterDirRenameCmd, renterDirSetPolicyCmd, renterDirSetVersioningCmd)
+	renterDirSetVersioningCmd.Flags().Uint64Var(&versionMaxVersions, "max-versions", 0, "number of versions to keep of every file")
+	renterDirSetVersioningCmd.Flags().Uint64Var(&versionMaxDays, "max-days", 0, "number of days to keep the versions of every file")
+	renterVersionsCmd.AddCommand(renterVersionsDownloadCmd, renterVersionsRestoreCmd)
+	renterPolicyCmd.AddCommand(renterPolicySetCmd, renterPolicyDeleteCmd)
+	renterPolicySetCmd.Flags().StringSliceVar(&policyWhitelist, "whitelist", nil, "public keys of the only hosts that satisfy the policy")
+	renterPolicySetCmd.Flags().StringSliceVar(&policyBlacklist, "blacklist", nil, "public keys of hosts that never satisfy the policy")
+	renterPolicySetCmd.Flags().StringSliceVar(&policySubnets, "subnets", nil, "CIDR subnets that the IP addresses of the hosts must be in")
+	renterPolicySetCmd.Flags().StringSliceVar(&policyCountries, "countries", nil, "two-letter codes of the countries that the hosts must be in")
+	renterPolicySetCmd.Flags().StringVar(&policyMinScore, "min-score", "", "minimum score of the hosts")
+	renterPolicySetCmd.Flags().StringVar(&policyMaxContractPrice, "max-contract-price", "", "maximum contract price of the hosts, specified in currency units")
+	renterPolicySetCmd.Flags().StringVar(&policyMaxStoragePrice, "max-storage-price", "", "maximum storage price of the hosts per TB per month, specified in currency units")
+	renterPolicySetCmd.Flags().StringVar(&policyMaxUploadPrice, "max-upload-price", "", "maximum upload price of the hosts per TB, specified in currency units")
+	renterPolicySetCmd.Flags().StringVar(&policyMaxDownloadPrice, "max-download-price", "", "maximum download price of the hosts per TB, specified in currency units")
 	renterAllowanceCmd.AddCommand(renterAllowanceCancelCmd)
 
 	renterCmd.Flags().BoolVarP(&renterListVerbose, "verbose", "v", false, "Show additional file info such as redundancy")
@@ -152,6 +230,24 @@ func main() {
 	renterDownloadsCmd.Flags().BoolVarP(&renterShowHistory, "history", "H", false, "Show download history in addition to the download queue")
 	renterFilesDownloadCmd.Flags().BoolVarP(&renterDownloadAsync, "async", "A", false, "Download file asynchronously")
 	renterFilesListCmd.Flags().BoolVarP(&renterListVerbose, "verbose", "v", false, "Show additional file info such as redundancy")
+	renterSyncCmd.Flags().StringSliceVar(&renterSyncIgnore, "ignore", nil, "patterns of the names or paths of local files and directories that aren't synced")
+	renterSyncCmd.Flags().BoolVarP(&renterSyncMirror, "mirror-deletions", "", false, "Delete files from the renter when they are deleted locally")
+	renterFilesUploadCmd.Flags().BoolVarP(&renterUploadDedup, "dedup", "", false, "Don't upload chunks again that were already uploaded as part of other deduplicated files")
+	renterFilesUploadCmd.Flags().StringVar(&renterContentType, "content-type", "", "content type of the uploaded files")
+	renterFilesUploadCmd.Flags().StringSliceVar(&renterMetadata, "metadata", nil, "key=value tags of the uploaded files")
+	renterSetMetadataCmd.Flags().StringVar(&renterContentType, "content-type", "", "content type of the file")
+	renterSetMetadataCmd.Flags().StringSliceVar(&renterMetadata, "metadata", nil, "key=value tags of the file, replacing its current tags")
+	renterQueryCmd.Flags().StringVar(&queryPrefix, "prefix", "", "only show files whose path starts with the prefix")
+	renterQueryCmd.Flags().StringVar(&queryContentType, "content-type", "", "only show files with the content type")
+	renterQueryCmd.Flags().StringSliceVar(&queryTags, "tag", nil, "only show files with the key=value tag, or with the key if no value is given")
+	renterQueryCmd.Flags().StringVar(&queryMinSize, "min-size", "", "only show files of at least this size in bytes (B), kilobytes (KB), megabytes (MB) etc.")
+	renterQueryCmd.Flags().StringVar(&queryMaxSize, "max-size", "", "only show files of at most this size in bytes (B), kilobytes (KB), megabytes (MB) etc.")
+	renterQueryCmd.Flags().StringVar(&queryMinHealth, "min-health", "", "only show files with at least this health, 0 being fully redundant")
+	renterQueryCmd.Flags().StringVar(&queryMaxHealth, "max-health", "", "only show files with at most this health, 0 being fully redundant")
+	renterQueryCmd.Flags().StringVar(&queryCreatedAfter, "created-after", "", "only show files created after the date (YYYY-MM-DD) or RFC 3339 time")
+	renterQueryCmd.Flags().StringVar(&queryCreatedBefore, "created-before", "", "only show files created before the date (YYYY-MM-DD) or RFC 3339 time")
+	renterQueryCmd.Flags().StringVar(&queryModifiedAfter, "modified-after", "", "only show files modified after the date (YYYY-MM-DD) or RFC 3339 time")
+	renterQueryCmd.Flags().StringVar(&queryModifiedBefore, "modified-before", "", "only show files modified before the date (YYYY-MM-DD) or RFC 3339 time")
 	renterExportCmd.AddCommand(renterExportContractTxnsCmd)
 
 	renterSetAllowanceCmd.Flags().StringVar(&allowanceFunds, "amount", "", "amount of money in allowance, specified in currency units")
@@ -10,6 +10,7 @@ import (
 	"math/big"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/HyperspaceApp/Hyperspace/encoding"
 	"github.com/HyperspaceApp/Hyperspace/types"
@@ -137,31 +138,49 @@ func currencyUnits(c types.Currency) string {
 
 // parseCurrency converts a SPACE amount to base units.
 func parseCurrency(amount string) (string, error) {
-	units := []string{"pS", "nS", "uS", "mS", "S", "KS", "MS", "GS", "TS"}
-	for i, unit := range units {
-		if strings.HasSuffix(amount, unit) {
-			// scan into big.Rat
-			r, ok := new(big.Rat).SetString(strings.TrimSuffix(amount, unit))
-			if !ok {
-				return "", errors.New("malformed amount")
-			}
-			// convert units
-			exp := 24 + 3*(int64(i)-4)
-			mag := new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil)
-			r.Mul(r, new(big.Rat).SetInt(mag))
-			// r must be an integer at this point
-			if !r.IsInt() {
-				return "", errors.New("non-integer number of hastings")
-			}
-			return r.RatString(), nil
-		}
+	c, err := types.ParseCurrency(amount)
+	if err == types.ErrMissingCurrencyUnits {
+		return "", errors.New("amount is missing units; run 'wallet --help' for a list of units")
+	} else if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// parseTags converts key=value strings to a map of tags. A string without "="
+// is a key with an empty value.
+func parseTags(strs []string) (map[string]string, error) {
+	if len(strs) == 0 {
+		return nil, nil
 	}
-	// check for hastings separately
-	if strings.HasSuffix(amount, "H") {
-		return strings.TrimSuffix(amount, "H"), nil
+	tags := make(map[string]string)
+	for _, s := range strs {
+		if s == "" {
+			continue
+		}
+		kv := strings.SplitN(s, "=", 2)
+		if kv[0] == "" {
+			return nil, errors.New("tag '" + s + "' has no key")
+		}
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		tags[kv[0]] = kv[1]
 	}
+	return tags, nil
+}
 
-	return "", errors.New("amount is missing units; run 'wallet --help' for a list of units")
+// parseTime converts a date of the form 2006-01-02 or an RFC 3339 time to a
+// time. Dates are interpreted in the local time zone.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.New("time must be a date (YYYY-MM-DD) or an RFC 3339 time")
+	}
+	return t, nil
 }
 
 // yesNo returns "Yes" if b is true, and "No" if b is false.
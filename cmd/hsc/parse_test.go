@@ -2,6 +2,7 @@ package main
 
 import (
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/HyperspaceApp/Hyperspace/types"
@@ -122,3 +123,26 @@ func TestCurrencyUnits(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		in    []string
+		out   map[string]string
+		valid bool
+	}{
+		{nil, nil, true},
+		{[]string{"a=b"}, map[string]string{"a": "b"}, true},
+		{[]string{"a=b", "c"}, map[string]string{"a": "b", "c": ""}, true},
+		{[]string{"a=b=c", "d="}, map[string]string{"a": "b=c", "d": ""}, true},
+		{[]string{""}, map[string]string{}, true},
+		{[]string{"=b"}, nil, false},
+	}
+	for _, test := range tests {
+		out, err := parseTags(test.in)
+		if (err == nil) != test.valid {
+			t.Errorf("parseTags(%v): expected valid %v, got error %v", test.in, test.valid, err)
+		} else if test.valid && !reflect.DeepEqual(out, test.out) {
+			t.Errorf("parseTags(%v): expected %v, got %v", test.in, test.out, out)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -36,6 +37,23 @@ var (
 		Run:   wrap(renterallowancecmd),
 	}
 
+	renterBackupCmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Back up the renter's metadata to its hosts",
+		Long: `Upload an encrypted backup of the renter's files, contracts and allowance to
+its hosts. Backups are also made periodically while the wallet is unlocked.
+The backup keys are derived from the wallet seed, so the wallet must be
+unlocked.`,
+		Run: wrap(renterbackupcmd),
+	}
+
+	renterBackupsCmd = &cobra.Command{
+		Use:   "backups",
+		Short: "List the backups stored on the renter's hosts",
+		Long:  "List the backups of the renter's metadata that were made with the wallet seed.",
+		Run:   wrap(renterbackupscmd),
+	}
+
 	renterCmd = &cobra.Command{
 		Use:   "renter",
 		Short: "Perform renter actions",
@@ -57,6 +75,60 @@ var (
 		Run:   wrap(rentercontractsviewcmd),
 	}
 
+	renterDirCmd = &cobra.Command{
+		Use:   "dir [path]",
+		Short: "List a directory",
+		Long: `List the subdirectories and files of a directory. Sizes, file counts,
+redundancies and health of subdirectories include every file below them. A
+health of 0 means full redundancy; files with a health above 1 can't be
+recovered. Lists the root directory if no path is given.`,
+		Run: renterdircmd,
+	}
+
+	renterDirCreateCmd = &cobra.Command{
+		Use:   "create [path]",
+		Short: "Create a directory",
+		Long:  "Create a directory and any missing parent directories.",
+		Run:   wrap(renterdircreatecmd),
+	}
+
+	renterDirDeleteCmd = &cobra.Command{
+		Use:     "delete [path]",
+		Aliases: []string{"rm"},
+		Short:   "Delete a directory",
+		Long:    "Delete a directory and every file and directory below it. Does not delete files on disk.",
+		Run:     wrap(renterdirdeletecmd),
+	}
+
+	renterDirRenameCmd = &cobra.Command{
+		Use:     "rename [path] [newpath]",
+		Aliases: []string{"mv"},
+		Short:   "Rename a directory",
+		Long:    "Move a directory and everything below it to a new path.",
+		Run:     wrap(renterdirrenamecmd),
+	}
+
+	renterDirSetPolicyCmd = &cobra.Command{
+		Use:   "setpolicy [path] [policy]",
+		Short: "Attach a host policy to a directory",
+		Long: `Attach the host policy [policy] to the directory at [path]. The files below the
+directory are only uploaded to hosts that satisfy the policy, unless a
+subdirectory has a policy of its own. Detaches the policy of the directory if
+[policy] is omitted.`,
+		Run: renterdirsetpolicycmd,
+	}
+
+	renterDirSetVersioningCmd = &cobra.Command{
+		Use:   "setversioning [path]",
+		Short: "Attach a version policy to a directory",
+		Long: `Keep the old versions of the files below the directory at [path] when they are
+overwritten or deleted, unless a subdirectory has a policy of its own. A version
+expires once there are --max-versions newer versions of its file, or once it is
+older than --max-days days. Detaches the policy of the directory if neither
+flag is set.`,
+		Run: wrap(renterdirsetversioningcmd),
+	}
+
 	renterDownloadsCmd = &cobra.Command{
 		Use:   "downloads",
 		Short: "View the download queue",
@@ -98,8 +170,67 @@ var (
 	renterFilesUploadCmd = &cobra.Command{
 		Use:   "upload [source] [path]",
 		Short: "Upload a file or folder",
-		Long:  "Upload a file or folder to [path] on the Sia network.",
-		Run:   wrap(renterfilesuploadcmd),
+		Long: `Upload a file or folder to [path] on the Sia network. If [source] is "-" the
+file is read from stdin and uploaded as it is read.`,
+		Run: wrap(renterfilesuploadcmd),
+	}
+
+	renterLoadCmd = &cobra.Command{
+		Use:   "load [source]",
+		Short: "Load shared files",
+		Long: `Load the files of a .sia file that was shared by another renter. If [source]
+is "-" an ASCII-encoded .sia file is read from stdin. The files are downloaded
+from the hosts they are stored on, which requires contracts with enough of
+those hosts. The key the .sia file was signed with is printed but not checked,
+compare it to the sharing key of the renter you expect the files from.`,
+		Run: wrap(renterloadcmd),
+	}
+
+	renterMountCmd = &cobra.Command{
+		Use:   "mount [mountpoint] [path]",
+		Short: "Mount the renter's files as a read-only filesystem",
+		Long: `Mount the renter's directory at [path] as a read-only FUSE filesystem at
+[mountpoint]. If [path] is omitted the whole renter is mounted. The filesystem
+is served by hsd, so [mountpoint] must be accessible to hsd, and it stays
+mounted until it is unmounted or hsd shuts down. FUSE is supported on Linux
+and macOS.`,
+		Run: rentermountcmd,
+	}
+
+	renterMountsCmd = &cobra.Command{
+		Use:   "mounts",
+		Short: "List the mounted filesystems",
+		Long:  "List the FUSE filesystems mounted by the renter.",
+		Run:   wrap(rentermountscmd),
+	}
+
+	renterPolicyCmd = &cobra.Command{
+		Use:   "policy [name]",
+		Short: "List the host policies or show a host policy",
+		Long: `List the host policies of the renter, or show the policy [name] and the
+contracts in its contract set. Host policies restrict the hosts that the files
+below the directories they are attached to are uploaded to.`,
+		Run: renterpolicycmd,
+	}
+
+	renterPolicyDeleteCmd = &cobra.Command{
+		Use:   "delete [name]",
+		Short: "Delete a host policy",
+		Long: `Delete the host policy [name]. The contracts in its contract set are kept.
+Uploads below directories that the policy is still attached to stall until the
+directories get a new policy.`,
+		Run: wrap(renterpolicydeletecmd),
+	}
+
+	renterPolicySetCmd = &cobra.Command{
+		Use:   "set [name] [hosts]",
+		Short: "Add or replace a host policy",
+		Long: `Add the host policy [name], or replace it if it exists. The renter forms
+contracts with hosts that satisfy the policy until its contract set contains
+[hosts] contracts. The flags restrict the hosts that satisfy the policy.
+Country constraints require a GeoIP database at geoip.csv in the renter
+directory, with lines of the form "first IP,last IP,country code".`,
+		Run: wrap(renterpolicysetcmd),
 	}
 
 	renterPricesCmd = &cobra.Command{
@@ -112,6 +243,58 @@ and if no allowance is set an allowance of 500SC, 12w period, 50 hosts, and 4w r
 		Run: renterpricescmd,
 	}
 
+	renterQueryCmd = &cobra.Command{
+		Use:   "query",
+		Short: "Find files by their properties",
+		Long: `List the files that match all of the given flags. The files are found using
+the renter's file index, which holds the size, times, health, content type and
+tags of every file. The health of a file is the health as of its last health
+check.`,
+		Run: wrap(renterquerycmd),
+	}
+
+	renterRestoreCmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Restore the renter's metadata from a backup",
+		Long: `Find the most recent backup made with a wallet seed on the hosts known to the
+renter, and restore the renter's contracts and files from it. Files that
+already exist are left untouched, and the backed-up allowance is restored if
+no allowance is set. You are prompted for the seed; leave it empty to use the
+seed of the unlocked wallet.`,
+		Run: wrap(renterrestorecmd),
+	}
+
+	renterShareCmd = &cobra.Command{
+		Use:   "share [path]... [destination]",
+		Short: "Share files and directories",
+		Long: `Save the files and directories at [path] to a .sia file at [destination] that
+can be loaded by other renters. The .sia file contains the keys of the files
+and the hosts storing them, but none of the renter's contracts, and is signed
+with the renter's sharing key. Anyone who gets hold of the .sia file can
+decrypt the shared files. If [destination] is "-" the .sia file is printed
+ASCII-encoded.`,
+		Run: rentersharecmd,
+	}
+
+	renterMigrationsCmd = &cobra.Command{
+		Use:   "migrations",
+		Short: "List the migrations away from dropped hosts",
+		Long: `List the hosts that are being dropped because they were filtered, are no
+longer good for renewing or their contract expires without being renewed,
+together with the progress of copying their pieces to other hosts. The
+contract of a host is canceled once all of its pieces were copied.`,
+		Run: wrap(rentermigrationscmd),
+	}
+
+	renterStuckCmd = &cobra.Command{
+		Use:   "stuck",
+		Short: "List the files with stuck chunks",
+		Long: `List the files that have chunks which could not be repaired to full
+redundancy, together with the reason why and the time of the last attempt.
+Stuck chunks are retried periodically.`,
+		Run: wrap(renterstuckcmd),
+	}
+
 	renterSetAllowanceCmd = &cobra.Command{
 		Use:   "setallowance [amount] [period] [hosts] [renew window]",
 		Short: "Set the allowance",
@@ -127,12 +310,96 @@ have a reasonable number (>30) of hosts in your hostdb.`,
 		Run: rentersetallowancecmd,
 	}
 
+	renterSetMetadataCmd = &cobra.Command{
+		Use:   "setmetadata [path]",
+		Short: "Change the content type and tags of a file",
+		Long: `Change the content type or the key=value tags of the file at [path]. Only
+the given flags are changed, and --metadata replaces all tags of the file. An
+empty --metadata "" removes the tags.`,
+		Run: wrap(rentersetmetadatacmd),
+	}
+
+	renterSetRedundancyCmd = &cobra.Command{
+		Use:   "setredundancy [path] [datapieces] [paritypieces]",
+		Short: "Change the redundancy of a file",
+		Long: `Re-encode the file at [path] with the given number of data and parity pieces.
+The file is re-encoded in the background, using the local copy of the file if
+it is unchanged and downloading it otherwise. The file keeps its old redundancy
+until the new version is fully uploaded.`,
+		Run: wrap(rentersetredundancycmd),
+	}
+
+	renterSyncCmd = &cobra.Command{
+		Use:   "sync [localdir] [path]",
+		Short: "Continuously upload a local directory",
+		Long: `Start a job in hsd that continuously uploads the files of the local directory
+[localdir] to the renter's directory at [path]. New and changed files are
+uploaded when hsd notices the change, and files deleted locally are deleted
+from the renter if --mirror-deletions is set. Changes are noticed immediately
+on Linux and by periodic rescans on every system. The job keeps running until
+it is removed with 'hsc renter unsync', also after hsd restarts.`,
+		Run: wrap(rentersynccmd),
+	}
+
+	renterSyncsCmd = &cobra.Command{
+		Use:   "syncs",
+		Short: "List the sync jobs",
+		Long:  "List the jobs that continuously upload local directories.",
+		Run:   wrap(rentersyncscmd),
+	}
+
+	renterUnmountCmd = &cobra.Command{
+		Use:   "unmount [mountpoint]",
+		Short: "Unmount a filesystem",
+		Long:  "Unmount the FUSE filesystem that the renter mounted at [mountpoint].",
+		Run:   wrap(renterunmountcmd),
+	}
+
+	renterUnsyncCmd = &cobra.Command{
+		Use:   "unsync [path]",
+		Short: "Stop a sync job",
+		Long: `Stop the sync job that uploads to the renter's directory at [path]. The files
+that were already uploaded are kept.`,
+		Run: wrap(renterunsynccmd),
+	}
+
 	renterUploadsCmd = &cobra.Command{
 		Use:   "uploads",
 		Short: "View the upload queue",
 		Long:  "View the list of files currently uploading.",
 		Run:   wrap(renteruploadscmd),
 	}
+
+	renterVersionsCmd = &cobra.Command{
+		Use:   "versions [path]",
+		Short: "List the old versions of a file",
+		Long:  "List the old versions of the file at [path], newest first.",
+		Run:   wrap(renterversionscmd),
+	}
+
+	renterVersionsDownloadCmd = &cobra.Command{
+		Use:   "download [path] [version] [destination]",
+		Short: "Download an old version of a file",
+		Long:  "Download the version [version] of the file at [path] to [destination].",
+		Run:   wrap(renterversionsdownloadcmd),
+	}
+
+	renterVersionsRestoreCmd = &cobra.Command{
+		Use:   "restore [path] [version]",
+		Short: "Restore an old version of a file",
+		Long: `Replace the file at [path] with its version [version]. The replaced file
+becomes a version itself if the file is versioned, and is deleted otherwise.`,
+		Run: wrap(renterversionsrestorecmd),
+	}
+
+	renterVerifyCmd = &cobra.Command{
+		Use:   "verify [path]",
+		Short: "Verify the content of a file",
+		Long: `Download the file at [path] and check that its content matches the checksum
+that was computed when it was uploaded. The downloaded data is discarded.
+Files uploaded before checksums were introduced can't be verified.`,
+		Run: wrap(renterverifycmd),
+	}
 )
 
 // abs returns the absolute representation of a path.
@@ -690,6 +957,613 @@ Contract %v
 	fmt.Println("Contract not found")
 }
 
+// renterdircmd is the handler for the command `hsc renter dir [path]`. It
+// lists the subdirectories and files of a directory.
+func renterdircmd(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		cmd.UsageFunc()(cmd)
+		os.Exit(exitCodeUsage)
+	}
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+	}
+	rd, err := httpClient.RenterGetDir(path)
+	if err != nil {
+		die("Could not get directory:", err)
+	}
+	dir := rd.Directories[0]
+	fmt.Printf("%v files, %s in /%v\n", dir.NumFiles, filesizeUnits(int64(dir.AggregateSize)), dir.HyperspacePath)
+	if dir.LastHealthCheckTime.IsZero() {
+		fmt.Println("Health: not checked yet")
+	} else {
+		fmt.Printf("Health: %.2f (worst below: %.2f, checked %v)\n", dir.Health, dir.AggregateHealth,
+			dir.LastHealthCheckTime.Format("2006-01-02 15:04"))
+	}
+	if dir.HostPolicy != "" {
+		fmt.Println("Host policy:", dir.HostPolicy)
+	}
+	if dir.VersionPolicy != (modules.VersionPolicy{}) {
+		fmt.Println("Version policy:", versionPolicyString(dir.VersionPolicy))
+	}
+	if dir.NumStuckChunks > 0 {
+		fmt.Printf("%v stuck chunks, see 'hsc renter stuck'\n", dir.NumStuckChunks)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  Size\tFiles\tRedundancy\tHealth\tModified\tSia path")
+	for _, sd := range rd.Directories[1:] {
+		redundancyStr := fmt.Sprintf("%.2f", sd.MinRedundancy)
+		if sd.MinRedundancy == -1 {
+			redundancyStr = "-"
+		}
+		healthStr := fmt.Sprintf("%.2f", sd.AggregateHealth)
+		if sd.LastHealthCheckTime.IsZero() {
+			healthStr = "-"
+		}
+		fmt.Fprintf(w, "  %9s\t%v\t%s\t%s\t%s\t%s/\n", filesizeUnits(int64(sd.AggregateSize)), sd.NumFiles, redundancyStr,
+			healthStr, sd.LastModified.Format("2006-01-02 15:04"), sd.HyperspacePath)
+	}
+	for _, file := range rd.Files {
+		redundancyStr := fmt.Sprintf("%.2f", file.Redundancy)
+		if file.Redundancy == -1 {
+			redundancyStr = "-"
+		}
+		fmt.Fprintf(w, "  %9s\t\t%s\t\t%s\t%s\n", filesizeUnits(int64(file.Filesize)), redundancyStr,
+			file.ModTime.Format("2006-01-02 15:04"), file.HyperspacePath)
+	}
+	w.Flush()
+}
+
+// renterloadcmd is the handler for the command `hsc renter load [source]`.
+// It loads shared files into the renter.
+func renterloadcmd(source string) {
+	var rl api.RenterLoad
+	var err error
+	if source == "-" {
+		ascii, readErr := ioutil.ReadAll(os.Stdin)
+		if readErr != nil {
+			die("Could not read shared files:", readErr)
+		}
+		rl, err = httpClient.RenterLoadASCIIPost(strings.TrimSpace(string(ascii)))
+	} else {
+		rl, err = httpClient.RenterLoadPost(abs(source))
+	}
+	if err != nil {
+		die("Could not load shared files:", err)
+	}
+	if rl.Signer.Key != nil {
+		fmt.Println("Signed by", rl.Signer)
+		fmt.Println("Make sure that this is the sharing key of the renter you expect the files from.")
+	}
+	fmt.Printf("Loaded %v files:\n", len(rl.FilesAdded))
+	for _, name := range rl.FilesAdded {
+		fmt.Println(" ", name)
+	}
+}
+
+// rentersharecmd is the handler for the command `hsc renter share [path]...
+// [destination]`. It shares files and directories with other renters.
+func rentersharecmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		cmd.UsageFunc()(cmd)
+		os.Exit(exitCodeUsage)
+	}
+	paths, destination := args[:len(args)-1], args[len(args)-1]
+	if destination == "-" {
+		rs, err := httpClient.RenterShareASCIIGet(paths)
+		if err != nil {
+			die("Could not share files:", err)
+		}
+		fmt.Println(rs.ASCIIsia)
+		return
+	}
+	err := httpClient.RenterShareGet(paths, abs(destination))
+	if err != nil {
+		die("Could not share files:", err)
+	}
+	rg, err := httpClient.RenterGet()
+	if err != nil {
+		die("Could not get sharing key:", err)
+	}
+	fmt.Printf("Shared %v to %v, signed by %v\n", strings.Join(paths, ", "), abs(destination), rg.SharingKey)
+}
+
+// renterstuckcmd is the handler for the command `hsc renter stuck`. It lists
+// the files with stuck chunks.
+func renterstuckcmd() {
+	rs, err := httpClient.RenterStuckGet()
+	if err != nil {
+		die("Could not get stuck files:", err)
+	}
+	if len(rs.Files) == 0 {
+		fmt.Println("No files have stuck chunks.")
+		return
+	}
+	for _, file := range rs.Files {
+		fmt.Printf("%v: %v stuck chunks, redundancy %.2f\n", file.HyperspacePath, len(file.Chunks), file.Redundancy)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  Chunk\tLast Attempt\tReason")
+		for _, chunk := range file.Chunks {
+			fmt.Fprintf(w, "  %v\t%s\t%s\n", chunk.Index, chunk.LastAttempt.Format("2006-01-02 15:04"), chunk.Reason)
+		}
+		w.Flush()
+	}
+}
+
+// rentermigrationscmd is the handler for the command `hsc renter migrations`.
+// It lists the migrations of pieces away from hosts that are being dropped.
+func rentermigrationscmd() {
+	rm, err := httpClient.RenterMigrationsGet()
+	if err != nil {
+		die("Could not get migrations:", err)
+	}
+	if len(rm.Migrations) == 0 {
+		fmt.Println("No hosts are being dropped.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Host\tReason\tOnline\tMigrated\tRemaining\tFailed\tSize\tLast Error")
+	for _, m := range rm.Migrations {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", m.NetAddress, m.Reason, yesNo(!m.Offline),
+			m.PiecesMigrated, m.PiecesRemaining, m.PiecesFailed, filesizeUnits(int64(m.BytesMigrated)), m.LastError)
+	}
+	w.Flush()
+}
+
+// renterbackupcmd is the handler for the command `hsc renter backup`.
+func renterbackupcmd() {
+	if err := httpClient.RenterBackupPost(); err != nil {
+		die("Could not create backup:", err)
+	}
+	fmt.Println("Backup uploaded.")
+}
+
+// renterbackupscmd is the handler for the command `hsc renter backups`.
+func renterbackupscmd() {
+	rb, err := httpClient.RenterBackupsGet()
+	if err != nil {
+		die("Could not get backups:", err)
+	}
+	if len(rb.Backups) == 0 {
+		fmt.Println("No backups were found.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Created\tSize\tHosts")
+	for _, backup := range rb.Backups {
+		created := time.Unix(int64(backup.CreationDate), 0)
+		fmt.Fprintf(w, "%v\t%v\t%v\n", created.Format("2006-01-02 15:04"), filesizeUnits(int64(backup.Size)), len(backup.Hosts))
+	}
+	w.Flush()
+}
+
+// renterrestorecmd is the handler for the command `hsc renter restore`.
+func renterrestorecmd() {
+	seed, err := passwordPrompt("Seed (leave empty to use the wallet seed): ")
+	if err != nil {
+		die("Reading seed failed:", err)
+	}
+	fmt.Println("Searching the hosts for backups. This may take a while.")
+	if err := httpClient.RenterRestorePost(seed); err != nil {
+		die("Could not restore backup:", err)
+	}
+	fmt.Println("Backup restored.")
+}
+
+// rentermountcmd is the handler for the command `hsc renter mount
+// [mountpoint] [path]`.
+func rentermountcmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 && len(args) != 2 {
+		cmd.UsageFunc()(cmd)
+		os.Exit(exitCodeUsage)
+	}
+	mountPoint := abs(args[0])
+	var path string
+	if len(args) == 2 {
+		path = args[1]
+	}
+	if err := httpClient.RenterFuseMountPost(mountPoint, path); err != nil {
+		die("Could not mount filesystem:", err)
+	}
+	fmt.Printf("Mounted /%v at %v\n", strings.Trim(path, "/"), mountPoint)
+}
+
+// rentermountscmd is the handler for the command `hsc renter mounts`.
+func rentermountscmd() {
+	rf, err := httpClient.RenterFuseGet()
+	if err != nil {
+		die("Could not get mounted filesystems:", err)
+	}
+	if len(rf.MountPoints) == 0 {
+		fmt.Println("No filesystems are mounted.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Mount Point\tPath")
+	for _, mount := range rf.MountPoints {
+		fmt.Fprintf(w, "%v\t/%v\n", mount.MountPoint, mount.HyperspacePath)
+	}
+	w.Flush()
+}
+
+// renterunmountcmd is the handler for the command `hsc renter unmount
+// [mountpoint]`.
+func renterunmountcmd(mountPoint string) {
+	mountPoint = abs(mountPoint)
+	if err := httpClient.RenterFuseUnmountPost(mountPoint); err != nil {
+		die("Could not unmount filesystem:", err)
+	}
+	fmt.Println("Unmounted", mountPoint)
+}
+
+// rentersetredundancycmd is the handler for the command `hsc renter
+// setredundancy [path] [datapieces] [paritypieces]`.
+func rentersetredundancycmd(path, dataPieces, parityPieces string) {
+	var data, parity uint64
+	if _, err := fmt.Sscan(dataPieces, &data); err != nil {
+		die("Could not parse data pieces:", err)
+	}
+	if _, err := fmt.Sscan(parityPieces, &parity); err != nil {
+		die("Could not parse parity pieces:", err)
+	}
+	if err := httpClient.RenterSetRedundancyPost(path, data, parity); err != nil {
+		die("Could not change the redundancy of the file:", err)
+	}
+	fmt.Printf("Re-encoding %v with %v data pieces and %v parity pieces\n", path, data, parity)
+}
+
+// rentersetmetadatacmd is the handler for the command `hsc renter setmetadata
+// [path]`.
+func rentersetmetadatacmd(path string) {
+	setContentType := renterSetMetadataCmd.Flags().Changed("content-type")
+	setMetadata := renterSetMetadataCmd.Flags().Changed("metadata")
+	if !setContentType && !setMetadata {
+		die("Nothing to change, use --content-type or --metadata")
+	}
+	file, err := httpClient.RenterFileGet(path)
+	if err != nil {
+		die("Could not get file:", err)
+	}
+	contentType, metadata := file.File.ContentType, file.File.Metadata
+	if setContentType {
+		contentType = renterContentType
+	}
+	if setMetadata {
+		metadata, err = parseTags(renterMetadata)
+		if err != nil {
+			die("Could not parse metadata:", err)
+		}
+	}
+	if err := httpClient.RenterSetFileMetadataPost(path, contentType, metadata); err != nil {
+		die("Could not change the metadata of the file:", err)
+	}
+	fmt.Println("Changed the metadata of", path)
+}
+
+// renterverifycmd is the handler for the command `hsc renter verify [path]`.
+func renterverifycmd(path string) {
+	if err := httpClient.RenterVerifyPost(path); err != nil {
+		die("Could not verify file:", err)
+	}
+	fmt.Println("Verified", path)
+}
+
+// renterdirsetpolicycmd is the handler for the command `hsc renter dir
+// setpolicy [path] [policy]`.
+func renterdirsetpolicycmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		cmd.UsageFunc()(cmd)
+		os.Exit(exitCodeUsage)
+	}
+	policy := ""
+	if len(args) == 2 {
+		policy = args[1]
+	}
+	if err := httpClient.RenterDirSetHostPolicyPost(args[0], policy); err != nil {
+		die("Could not set the host policy of the directory:", err)
+	}
+	if policy == "" {
+		fmt.Println("Detached the host policy of", args[0])
+		return
+	}
+	fmt.Printf("Attached host policy %v to %v\n", policy, args[0])
+}
+
+// renterpolicycmd is the handler for the command `hsc renter policy [name]`.
+func renterpolicycmd(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		cmd.UsageFunc()(cmd)
+		os.Exit(exitCodeUsage)
+	}
+	if len(args) == 0 {
+		rhpg, err := httpClient.RenterHostPoliciesGet()
+		if err != nil {
+			die("Could not get host policies:", err)
+		}
+		if len(rhpg.Policies) == 0 {
+			fmt.Println("No host policies.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Name\tContracts")
+		for _, p := range rhpg.Policies {
+			contracts := "-"
+			if policy, err := httpClient.RenterHostPolicyGet(p.Name); err == nil {
+				contracts = fmt.Sprint(len(policy.Contracts))
+			}
+			fmt.Fprintf(w, "%v\t%v/%v\n", p.Name, contracts, p.Hosts)
+		}
+		w.Flush()
+		return
+	}
+
+	rhpg, err := httpClient.RenterHostPolicyGet(args[0])
+	if err != nil {
+		die("Could not get host policy:", err)
+	}
+	p := rhpg.Policy
+	listOrAny := func(list []string) string {
+		if len(list) == 0 {
+			return "any"
+		}
+		return strings.Join(list, ", ")
+	}
+	keys := func(pks []types.SiaPublicKey) []string {
+		var strs []string
+		for _, pk := range pks {
+			strs = append(strs, pk.String())
+		}
+		return strs
+	}
+	priceOrAny := func(price, unit types.Currency) string {
+		if price.IsZero() {
+			return "any"
+		}
+		return currencyUnits(price.Mul(unit))
+	}
+	fmt.Printf(`Host policy %v:
+  Hosts:              %v
+  Whitelist:          %v
+  Blacklist:          %v
+  Subnets:            %v
+  Countries:          %v
+  Min Score:          %v
+  Max Contract Price: %v
+  Max Storage Price:  %v / TB / Month
+  Max Upload Price:   %v / TB
+  Max Download Price: %v / TB
+`, p.Name, p.Hosts, listOrAny(keys(p.Whitelist)), listOrAny(keys(p.Blacklist)), listOrAny(p.Subnets),
+		listOrAny(p.Countries), p.MinScore, priceOrAny(p.MaxContractPrice, types.NewCurrency64(1)),
+		priceOrAny(p.MaxStoragePrice, modules.BlockBytesPerMonthTerabyte),
+		priceOrAny(p.MaxUploadBandwidthPrice, modules.BytesPerTerabyte),
+		priceOrAny(p.MaxDownloadBandwidthPrice, modules.BytesPerTerabyte))
+
+	fmt.Printf("\n%v contracts in the contract set:\n", len(rhpg.Contracts))
+	if len(rhpg.Contracts) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  Host\tEnd Height\tGood For Upload\tGood For Renew")
+	for _, c := range rhpg.Contracts {
+		fmt.Fprintf(w, "  %v\t%v\t%v\t%v\n", c.NetAddress, c.EndHeight, c.GoodForUpload, c.GoodForRenew)
+	}
+	w.Flush()
+}
+
+// renterpolicysetcmd is the handler for the command `hsc renter policy set
+// [name] [hosts]`.
+func renterpolicysetcmd(name, hosts string) {
+	policy := modules.HostPolicy{
+		Name:      name,
+		Subnets:   policySubnets,
+		Countries: policyCountries,
+	}
+	if _, err := fmt.Sscan(hosts, &policy.Hosts); err != nil {
+		die("Could not parse hosts:", err)
+	}
+	parseKeys := func(strs []string) []types.SiaPublicKey {
+		var pks []types.SiaPublicKey
+		for _, str := range strs {
+			var pk types.SiaPublicKey
+			pk.LoadString(str)
+			if len(pk.Key) == 0 {
+				die("Could not parse public key:", str)
+			}
+			pks = append(pks, pk)
+		}
+		return pks
+	}
+	policy.Whitelist = parseKeys(policyWhitelist)
+	policy.Blacklist = parseKeys(policyBlacklist)
+	if policyMinScore != "" {
+		if _, err := fmt.Sscan(policyMinScore, &policy.MinScore); err != nil {
+			die("Could not parse min score:", err)
+		}
+	}
+	parsePrice := func(amount string, unit types.Currency) types.Currency {
+		if amount == "" {
+			return types.ZeroCurrency
+		}
+		hastings, err := parseCurrency(amount)
+		if err != nil {
+			die("Could not parse price:", err)
+		}
+		var price types.Currency
+		if _, err := fmt.Sscan(hastings, &price); err != nil {
+			die("Could not parse price:", err)
+		}
+		return price.Div(unit)
+	}
+	policy.MaxContractPrice = parsePrice(policyMaxContractPrice, types.NewCurrency64(1))
+	policy.MaxStoragePrice = parsePrice(policyMaxStoragePrice, modules.BlockBytesPerMonthTerabyte)
+	policy.MaxUploadBandwidthPrice = parsePrice(policyMaxUploadPrice, modules.BytesPerTerabyte)
+	policy.MaxDownloadBandwidthPrice = parsePrice(policyMaxDownloadPrice, modules.BytesPerTerabyte)
+	if err := httpClient.RenterHostPolicyPost(policy); err != nil {
+		die("Could not set host policy:", err)
+	}
+	fmt.Println("Set host policy", name)
+}
+
+// renterpolicydeletecmd is the handler for the command `hsc renter policy
+// delete [name]`.
+func renterpolicydeletecmd(name string) {
+	if err := httpClient.RenterHostPolicyDeletePost(name); err != nil {
+		die("Could not delete host policy:", err)
+	}
+	fmt.Println("Deleted host policy", name)
+}
+
+// rentersynccmd is the handler for the command `hsc renter sync [localdir]
+// [path]`.
+func rentersynccmd(localDir, path string) {
+	job := modules.SyncJob{
+		HyperspacePath:  path,
+		Ignore:          renterSyncIgnore,
+		LocalPath:       abs(localDir),
+		MirrorDeletions: renterSyncMirror,
+	}
+	if err := httpClient.RenterSyncAddPost(job); err != nil {
+		die("Could not start sync job:", err)
+	}
+	fmt.Printf("Syncing %v to /%v\n", job.LocalPath, strings.Trim(path, "/"))
+}
+
+// rentersyncscmd is the handler for the command `hsc renter syncs`.
+func rentersyncscmd() {
+	rs, err := httpClient.RenterSyncGet()
+	if err != nil {
+		die("Could not get sync jobs:", err)
+	}
+	if len(rs.Jobs) == 0 {
+		fmt.Println("No sync jobs.")
+		return
+	}
+	for _, job := range rs.Jobs {
+		fmt.Printf("%v -> /%v\n", job.LocalPath, job.HyperspacePath)
+		lastScan := "never"
+		if !job.LastScan.IsZero() {
+			lastScan = job.LastScan.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("  Files:     %v (%v uploaded, %v deleted)\n", job.NumFiles, job.NumUploaded, job.NumDeleted)
+		fmt.Printf("  Last scan: %v\n", lastScan)
+		fmt.Printf("  Watching:  %v\n", yesNo(job.Watching))
+		fmt.Printf("  Mirror:    %v\n", yesNo(job.MirrorDeletions))
+		if len(job.Ignore) > 0 {
+			fmt.Printf("  Ignore:    %v\n", strings.Join(job.Ignore, ", "))
+		}
+		if job.Error != "" {
+			fmt.Printf("  Error:     %v\n", job.Error)
+		}
+	}
+}
+
+// renterunsynccmd is the handler for the command `hsc renter unsync [path]`.
+func renterunsynccmd(path string) {
+	if err := httpClient.RenterSyncRemovePost(path); err != nil {
+		die("Could not stop sync job:", err)
+	}
+	fmt.Printf("Stopped syncing to /%v\n", strings.Trim(path, "/"))
+}
+
+// renterdirsetversioningcmd is the handler for the command `hsc renter dir
+// setversioning [path]`.
+func renterdirsetversioningcmd(path string) {
+	policy := modules.VersionPolicy{
+		MaxVersions: versionMaxVersions,
+		MaxDays:     versionMaxDays,
+	}
+	if err := httpClient.RenterDirSetVersionPolicyPost(path, policy); err != nil {
+		die("Could not set the version policy of the directory:", err)
+	}
+	if policy == (modules.VersionPolicy{}) {
+		fmt.Println("Detached the version policy of", path)
+		return
+	}
+	fmt.Printf("Versioning the files below %v (%v)\n", path, versionPolicyString(policy))
+}
+
+// versionPolicyString returns a human-readable description of a version
+// policy.
+func versionPolicyString(policy modules.VersionPolicy) string {
+	var limits []string
+	if policy.MaxVersions > 0 {
+		limits = append(limits, fmt.Sprintf("keep %v versions", policy.MaxVersions))
+	}
+	if policy.MaxDays > 0 {
+		limits = append(limits, fmt.Sprintf("keep for %v days", policy.MaxDays))
+	}
+	return strings.Join(limits, ", ")
+}
+
+// renterversionscmd is the handler for the command `hsc renter versions
+// [path]`.
+func renterversionscmd(path string) {
+	rfv, err := httpClient.RenterVersionsGet(path)
+	if err != nil {
+		die("Could not get the versions of the file:", err)
+	}
+	if len(rfv.Versions) == 0 {
+		fmt.Println("No versions of", path)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Version\tArchived\tSize\tRedundancy")
+	for _, v := range rfv.Versions {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%.2f\n", v.ID, v.ArchiveTime.Format("2006-01-02 15:04:05"),
+			filesizeUnits(int64(v.File.Filesize)), v.File.Redundancy)
+	}
+	w.Flush()
+}
+
+// renterversionsdownloadcmd is the handler for the command `hsc renter
+// versions download [path] [version] [destination]`.
+func renterversionsdownloadcmd(path, version, destination string) {
+	destination = abs(destination)
+	if err := httpClient.RenterVersionDownloadGet(path, version, destination); err != nil {
+		die("Could not download the version:", err)
+	}
+	fmt.Printf("Downloaded version %v of '%s' to '%s'.\n", version, path, destination)
+}
+
+// renterversionsrestorecmd is the handler for the command `hsc renter
+// versions restore [path] [version]`.
+func renterversionsrestorecmd(path, version string) {
+	if err := httpClient.RenterRestoreVersionPost(path, version); err != nil {
+		die("Could not restore the version:", err)
+	}
+	fmt.Printf("Restored version %v of %v\n", version, path)
+}
+
+// renterdircreatecmd is the handler for the command `hsc renter dir create
+// [path]`.
+func renterdircreatecmd(path string) {
+	err := httpClient.RenterDirCreatePost(path)
+	if err != nil {
+		die("Could not create directory:", err)
+	}
+	fmt.Println("Created", path)
+}
+
+// renterdirdeletecmd is the handler for the command `hsc renter dir delete
+// [path]`.
+func renterdirdeletecmd(path string) {
+	err := httpClient.RenterDirDeletePost(path)
+	if err != nil {
+		die("Could not delete directory:", err)
+	}
+	fmt.Println("Deleted", path)
+}
+
+// renterdirrenamecmd is the handler for the command `hsc renter dir rename
+// [path] [newpath]`.
+func renterdirrenamecmd(path, newpath string) {
+	err := httpClient.RenterDirRenamePost(path, newpath)
+	if err != nil {
+		die("Could not rename directory:", err)
+	}
+	fmt.Printf("Renamed %s to %s\n", path, newpath)
+}
+
 // renterfilesdeletecmd is the handler for the command `hsc renter delete [path]`.
 // Removes the specified path from the Sia network.
 func renterfilesdeletecmd(path string) {
@@ -879,11 +1753,102 @@ func renterfileslistcmd() {
 		if !renterListVerbose && !file.Available {
 			fmt.Fprintf(w, " (uploading, %0.2f%%)", file.UploadProgress)
 		}
+		if file.Stuck {
+			fmt.Fprintf(w, " (stuck: %s)", file.StuckReason)
+		}
 		fmt.Fprintln(w, "")
 	}
 	w.Flush()
 }
 
+// renterquerycmd is the handler for the command `hsc renter query`, which
+// lists the files that match the flags.
+func renterquerycmd() {
+	var q modules.FileQuery
+	var err error
+	q.Prefix = queryPrefix
+	q.ContentType = queryContentType
+	if q.Tags, err = parseTags(queryTags); err != nil {
+		die("Could not parse tags:", err)
+	}
+	for _, size := range []struct {
+		flag  string
+		value *uint64
+	}{
+		{queryMinSize, &q.MinSize},
+		{queryMaxSize, &q.MaxSize},
+	} {
+		if size.flag == "" {
+			continue
+		}
+		bytes, err := parseFilesize(size.flag)
+		if err != nil {
+			die("Could not parse size:", err)
+		}
+		if _, err := fmt.Sscan(bytes, size.value); err != nil {
+			die("Could not parse size:", err)
+		}
+	}
+	for _, health := range []struct {
+		flag  string
+		value **float64
+	}{
+		{queryMinHealth, &q.MinHealth},
+		{queryMaxHealth, &q.MaxHealth},
+	} {
+		if health.flag == "" {
+			continue
+		}
+		h, err := strconv.ParseFloat(health.flag, 64)
+		if err != nil {
+			die("Could not parse health:", err)
+		}
+		*health.value = &h
+	}
+	for _, t := range []struct {
+		flag  string
+		value *time.Time
+	}{
+		{queryCreatedAfter, &q.CreatedAfter},
+		{queryCreatedBefore, &q.CreatedBefore},
+		{queryModifiedAfter, &q.ModifiedAfter},
+		{queryModifiedBefore, &q.ModifiedBefore},
+	} {
+		if t.flag == "" {
+			continue
+		}
+		if *t.value, err = parseTime(t.flag); err != nil {
+			die("Could not parse time:", err)
+		}
+	}
+
+	rf, err := httpClient.RenterQueryGet(q)
+	if err != nil {
+		die("Could not query files:", err)
+	}
+	if len(rf.Files) == 0 {
+		fmt.Println("No files match the query.")
+		return
+	}
+	fmt.Printf("%v files match the query:\n", len(rf.Files))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  File size\tHealth\tModified\tContent type\tTags\tSia path")
+	for _, file := range rf.Files {
+		var tags []string
+		for k, v := range file.Metadata {
+			tags = append(tags, k+"="+v)
+		}
+		sort.Strings(tags)
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "-"
+		}
+		fmt.Fprintf(w, "  %9s\t%.2f\t%s\t%s\t%s\t%s\n", filesizeUnits(int64(file.Filesize)), file.Health,
+			file.ModTime.Format("2006-01-02 15:04"), contentType, strings.Join(tags, ","), file.HyperspacePath)
+	}
+	w.Flush()
+}
+
 // renterfilesrenamecmd is the handler for the command `hsc renter rename [path] [newpath]`.
 // Renames a file on the Sia network.
 func renterfilesrenamecmd(path, newpath string) {
@@ -899,6 +1864,35 @@ func renterfilesrenamecmd(path, newpath string) {
 // If [source] is a directory, all files inside it will be uploaded and named
 // relative to [path].
 func renterfilesuploadcmd(source, path string) {
+	upload := httpClient.RenterUploadDefaultPost
+	if renterUploadDedup {
+		upload = httpClient.RenterUploadDedupPost
+	}
+	withMetadata := renterContentType != "" || len(renterMetadata) > 0
+	metadata, err := parseTags(renterMetadata)
+	if err != nil {
+		die("Could not parse metadata:", err)
+	}
+	if withMetadata {
+		upload = func(path, siaPath string) error {
+			return httpClient.RenterUploadMetadataPost(path, siaPath, renterContentType, metadata, renterUploadDedup)
+		}
+	}
+	if source == "-" {
+		if withMetadata {
+			err = httpClient.RenterUploadStreamMetadataPost(os.Stdin, path, renterContentType, metadata, renterUploadDedup)
+		} else if renterUploadDedup {
+			err = httpClient.RenterUploadStreamDedupPost(os.Stdin, path)
+		} else {
+			err = httpClient.RenterUploadStreamPost(os.Stdin, path, 0, 0, false)
+		}
+		if err != nil {
+			die("Could not upload stdin:", err)
+		}
+		fmt.Printf("Uploaded stdin as '%s'.\n", path)
+		return
+	}
+
 	stat, err := os.Stat(source)
 	if err != nil {
 		die("Could not stat file or folder:", err)
@@ -928,7 +1922,7 @@ func renterfilesuploadcmd(source, path string) {
 			fpath, _ := filepath.Rel(source, file)
 			fpath = filepath.Join(path, fpath)
 			fpath = filepath.ToSlash(fpath)
-			err = httpClient.RenterUploadDefaultPost(abs(file), fpath)
+			err = upload(abs(file), fpath)
 			if err != nil {
 				failed++
 				fmt.Printf("Could not upload file %s :%v\n", file, err)
@@ -937,7 +1931,7 @@ func renterfilesuploadcmd(source, path string) {
 		fmt.Printf("\nUploaded %d of %d files into '%s'.\n", len(files)-failed, len(files), path)
 	} else {
 		// single file
-		err = httpClient.RenterUploadDefaultPost(abs(source), path)
+		err = upload(abs(source), path)
 		if err != nil {
 			die("Could not upload file:", err)
 		}
@@ -5,12 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"strconv"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -39,6 +40,23 @@ var (
 		Run:   wrap(walletbalancecmd),
 	}
 
+	walletBatchSendCmd = &cobra.Command{
+		Use:   "batch-send [file]",
+		Short: "Send space cash to many addresses",
+		Long: `Send space cash to every address listed in a CSV or JSON file.
+
+A CSV file has one address,amount[,label] row per line, optionally preceded by
+a header row. A JSON file contains a list of objects with "address", "amount"
+and "label" fields. Amounts can be specified in units, e.g. 1.23KS. If no unit
+is supplied, hastings will be assumed. The file is validated by the node, and
+errors name the offending row.
+
+The payments are split into as many transactions as needed to stay under the
+standard transaction size limit. Use --dry-run to validate the file and see
+the estimated fees without sending anything.`,
+		Run: wrap(walletbatchsendcmd),
+	}
+
 	walletBroadcastCmd = &cobra.Command{
 		Use:   "broadcast [txn]",
 		Short: "Broadcast a transaction",
@@ -54,6 +72,17 @@ be valid. txn may be either JSON, base64, or a file containing either.`,
 		Run:   wrap(walletchangepasswordcmd),
 	}
 
+	walletConsolidateCmd = &cobra.Command{
+		Use:   "consolidate",
+		Short: "Merge the wallet's smallest outputs",
+		Long: `Merge the wallet's smallest outputs into larger ones until the wallet holds
+the target number of outputs of its consolidation policy. Outputs sent to
+addresses with an excluded label are left alone. Unlike background
+consolidation, this runs even if the policy is disabled or fees are above its
+maximum fee rate.`,
+		Run: wrap(walletconsolidatecmd),
+	}
+
 	walletCmd = &cobra.Command{
 		Use:   "wallet",
 		Short: "Perform wallet actions",
@@ -409,6 +438,65 @@ func walletsendsiacoinscmd(amount, dest string) {
 	fmt.Printf("Sent %s hastings to %s\n", hastings, dest)
 }
 
+// walletbatchsendcmd sends space cash to every address in a batch payout
+// file and prints a per-row report.
+func walletbatchsendcmd(path string) {
+	payments, err := ioutil.ReadFile(path)
+	if err != nil {
+		die("Could not read batch file:", err)
+	}
+	wbsp, err := httpClient.WalletBatchSendPost(string(payments), walletBatchDryRun)
+	if err != nil {
+		die("Could not send batch:", err)
+	}
+
+	if wbsp.DryRun {
+		fmt.Println("Dry run - nothing has been sent.")
+	}
+	fmt.Printf("Payments:       %v\n", len(wbsp.Results))
+	fmt.Printf("Transactions:   %v\n", wbsp.Transactions)
+	fmt.Printf("Total Amount:   %v\n", currencyUnits(wbsp.TotalAmount))
+	fmt.Printf("Estimated Fees: %v\n", currencyUnits(wbsp.EstimatedFees))
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Row\tAddress\tAmount\tLabel\tTransaction\tResult")
+	failed := 0
+	for i, r := range wbsp.Results {
+		result := "ok"
+		txid := "-"
+		if r.Error != "" {
+			result = r.Error
+			failed++
+		} else if !wbsp.DryRun {
+			txid = r.TransactionID.String()
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", i+1, r.Address, currencyUnits(r.Amount), r.Label, txid, result)
+	}
+	w.Flush()
+	if failed > 0 {
+		die(fmt.Sprintf("%v of %v payments were not sent", failed, len(wbsp.Results)))
+	}
+}
+
+// walletconsolidatecmd merges the wallet's smallest outputs and prints a
+// report.
+func walletconsolidatecmd() {
+	wcp, err := httpClient.WalletConsolidatePost()
+	if err != nil {
+		die("Could not consolidate outputs:", err)
+	}
+	if len(wcp.TransactionIDs) == 0 {
+		fmt.Printf("Nothing to consolidate: the wallet has %v spendable outputs.\n", wcp.OutputsBefore)
+		return
+	}
+	fmt.Printf("Merged %v of %v outputs in %v transactions, paying %v in fees.\n",
+		wcp.OutputsMerged, wcp.OutputsBefore, len(wcp.TransactionIDs), currencyUnits(wcp.Fees))
+	for _, txid := range wcp.TransactionIDs {
+		fmt.Println(txid)
+	}
+}
+
 // walletbalancecmd retrieves and displays information about the wallet.
 func walletbalancecmd() {
 	status, err := httpClient.WalletGet()
@@ -555,15 +643,58 @@ func walletsigncmdoffline(txn *types.Transaction, toSign []crypto.Hash) {
 	close(done)
 }
 
-// wallettransactionscmd lists all of the transactions related to the wallet,
-// providing a net flow of space cash for each.
+// wallettransactionscmd lists the transactions related to the wallet,
+// providing a net flow of space cash for each. Confirmed transactions are
+// fetched one page at a time.
 func wallettransactionscmd() {
-	wtg, err := httpClient.WalletTransactionsGet(0, math.MaxInt64)
+	status, err := httpClient.WalletGet()
+	if err != nil {
+		die("Could not get wallet status:", err)
+	}
+	// Transactions confirmed at the current height are also returned by the
+	// history, so only the unconfirmed ones are used.
+	wtg, err := httpClient.WalletTransactionsGet(status.Height, status.Height)
 	if err != nil {
-		die("Could not fetch transaction history:", err)
+		die("Could not fetch unconfirmed transactions:", err)
 	}
+	unconfirmed := wtg.UnconfirmedTransactions
+	if walletTxnCategory != "" || walletTxnLabel != "" {
+		unconfirmed = nil
+	}
+
 	fmt.Println("             [timestamp]    [height]                                                   [transaction id]    [net space cash]")
-	txns := append(wtg.ConfirmedTransactions, wtg.UnconfirmedTransactions...)
+	if walletTxnDescending {
+		printWalletTransactions(unconfirmed)
+	}
+	q := modules.TransactionHistoryQuery{
+		Category:   walletTxnCategory,
+		Label:      walletTxnLabel,
+		Descending: walletTxnDescending,
+		Limit:      modules.MaxTransactionHistoryLimit,
+	}
+	for shown := 0; walletTxnLimit == 0 || shown < walletTxnLimit; {
+		if walletTxnLimit != 0 && walletTxnLimit-shown < q.Limit {
+			q.Limit = walletTxnLimit - shown
+		}
+		whg, err := httpClient.WalletHistoryGet(q)
+		if err != nil {
+			die("Could not fetch transaction history:", err)
+		}
+		printWalletTransactions(whg.Transactions)
+		shown += len(whg.Transactions)
+		if whg.NextCursor == "" {
+			break
+		}
+		q.Cursor = whg.NextCursor
+	}
+	if !walletTxnDescending {
+		printWalletTransactions(unconfirmed)
+	}
+}
+
+// printWalletTransactions prints one line per transaction with the net flow
+// of space cash into the wallet.
+func printWalletTransactions(txns []modules.ProcessedTransaction) {
 	for _, txn := range txns {
 		// Determine the number of outgoing space cash.
 		var outgoingSiacoins types.Currency
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	walletsCmd = &cobra.Command{
+		Use:   "wallets",
+		Short: "Manage named wallets",
+		Long: `List the named wallets of the daemon. Named wallets have their own seed,
+addresses and password. Use the --wallet flag of the wallet commands to
+operate on a named wallet instead of the default wallet.`,
+		Run: wrap(walletslistcmd),
+	}
+
+	walletsCreateCmd = &cobra.Command{
+		Use:   "create [name]",
+		Short: "Create a named wallet",
+		Long: `Create a new named wallet and load it. The wallet still has to be initialized,
+e.g. with 'hsc wallet --wallet [name] init'.`,
+		Run: wrap(walletscreatecmd),
+	}
+
+	walletsLoadCmd = &cobra.Command{
+		Use:   "load [name]",
+		Short: "Load a named wallet",
+		Long:  "Load a named wallet that has been unloaded. Loaded wallets are loaded again when the daemon restarts.",
+		Run:   wrap(walletsloadcmd),
+	}
+
+	walletsUnloadCmd = &cobra.Command{
+		Use:   "unload [name]",
+		Short: "Unload a named wallet",
+		Long: `Unload a named wallet. The wallet stays on disk and can be loaded again.
+Wallets that fund the host or renter can't be unloaded.`,
+		Run: wrap(walletsunloadcmd),
+	}
+)
+
+// walletslistcmd lists the named wallets.
+func walletslistcmd() {
+	wg, err := httpClient.WalletsGet()
+	if err != nil {
+		die("Could not get wallets:", err)
+	}
+	if len(wg.Wallets) == 0 {
+		fmt.Println("No named wallets.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tLoaded\tUnlocked\tIn Use")
+	for _, info := range wg.Wallets {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", info.Name, yesNo(info.Loaded), yesNo(info.Unlocked), yesNo(info.InUse))
+	}
+	w.Flush()
+}
+
+// walletscreatecmd creates a named wallet.
+func walletscreatecmd(name string) {
+	if err := httpClient.WalletsCreatePost(name); err != nil {
+		die("Could not create wallet:", err)
+	}
+	fmt.Printf("Created wallet %v.\n", name)
+}
+
+// walletsloadcmd loads a named wallet.
+func walletsloadcmd(name string) {
+	if err := httpClient.WalletsLoadPost(name); err != nil {
+		die("Could not load wallet:", err)
+	}
+	fmt.Printf("Loaded wallet %v.\n", name)
+}
+
+// walletsunloadcmd unloads a named wallet.
+func walletsunloadcmd(name string) {
+	if err := httpClient.WalletsUnloadPost(name); err != nil {
+		die("Could not unload wallet:", err)
+	}
+	fmt.Printf("Unloaded wallet %v.\n", name)
+}
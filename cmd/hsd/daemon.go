@@ -106,6 +106,8 @@ func processConfig(config Config) (Config, error) {
 	config.Siad.APIaddr = processNetAddr(config.Siad.APIaddr)
 	config.Siad.RPCaddr = processNetAddr(config.Siad.RPCaddr)
 	config.Siad.HostAddr = processNetAddr(config.Siad.HostAddr)
+	config.Siad.S3Addr = processNetAddr(config.Siad.S3Addr)
+	config.Siad.WebDAVAddr = processNetAddr(config.Siad.WebDAVAddr)
 	config.Siad.Modules, err1 = processModules(config.Siad.Modules)
 	config.Siad.Profile, err2 = processProfileFlags(config.Siad.Profile)
 	err3 := verifyAPISecurity(config)
@@ -216,6 +218,58 @@ func readFileConfig(config Config) error {
 			PoolDBConnection: dbConnection,
 		}
 	}
+	if config.Siad.S3Addr != "" {
+		err := viper.ReadInConfig() // Find and read the config file
+		if err != nil {             // Handle errors reading the config file
+			return err
+		}
+		s3Viper := viper.Sub("s3")
+		if s3Viper == nil {
+			return errors.New("Must specify an s3 section")
+		}
+		// The access keys are a list since viper lowercases the keys of maps.
+		var accessKeys []struct {
+			ID     string `mapstructure:"id"`
+			Secret string `mapstructure:"secret"`
+		}
+		if err := s3Viper.UnmarshalKey("accesskeys", &accessKeys); err != nil {
+			return err
+		}
+		if len(accessKeys) == 0 {
+			return errors.New("Must specify at least one s3 access key")
+		}
+		s3Config := fileConfig.S3Config{
+			AccessKeys: make(map[string]string),
+			Region:     s3Viper.GetString("region"),
+		}
+		for _, key := range accessKeys {
+			if key.ID == "" || key.Secret == "" {
+				return errors.New("Must specify the id and secret of every s3 access key")
+			}
+			s3Config.AccessKeys[key.ID] = key.Secret
+		}
+		globalConfig.S3Config = s3Config
+	}
+	if config.Siad.WebDAVAddr != "" {
+		err := viper.ReadInConfig() // Find and read the config file
+		if err != nil {             // Handle errors reading the config file
+			return err
+		}
+		webdavViper := viper.Sub("webdav")
+		if webdavViper == nil {
+			return errors.New("Must specify a webdav section")
+		}
+		if !webdavViper.IsSet("username") {
+			return errors.New("Must specify a webdav username")
+		}
+		if !webdavViper.IsSet("password") {
+			return errors.New("Must specify a webdav password")
+		}
+		globalConfig.WebDAVConfig = fileConfig.WebDAVConfig{
+			Username: webdavViper.GetString("username"),
+			Password: webdavViper.GetString("password"),
+		}
+	}
 	return nil
 }
 
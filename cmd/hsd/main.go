@@ -37,6 +37,8 @@ type Config struct {
 		APIaddr      string
 		RPCaddr      string
 		HostAddr     string
+		S3Addr       string
+		WebDAVAddr   string
 		AllowAPIBind bool
 
 		Modules           string
@@ -45,6 +47,8 @@ type Config struct {
 		AuthenticateAPI   bool
 		AddressGapLimit   int
 		ScanAirdrop       bool
+		HostWallet        string
+		RenterWallet      string
 		TempPassword      bool
 
 		Profile    string
@@ -55,6 +59,8 @@ type Config struct {
 
 	MiningPoolConfig config.MiningPoolConfig
 	IndexConfig      config.IndexConfig
+	S3Config         config.S3Config
+	WebDAVConfig     config.WebDAVConfig
 }
 
 // die prints its arguments to stderr, then exits the program with the default
@@ -184,6 +190,8 @@ func main() {
 	// Set default values, which have the lowest priority.
 	root.Flags().StringVarP(&globalConfig.Siad.RequiredUserAgent, "agent", "", "Hyperspace-Agent", "required substring for the user agent")
 	root.Flags().StringVarP(&globalConfig.Siad.HostAddr, "host-addr", "", ":5582", "which port the host listens on")
+	root.Flags().StringVarP(&globalConfig.Siad.S3Addr, "s3-addr", "", "", "which host:port the S3 gateway listens on, the gateway is disabled if empty")
+	root.Flags().StringVarP(&globalConfig.Siad.WebDAVAddr, "webdav-addr", "", "", "which host:port the WebDAV server listens on, the server is disabled if empty")
 	root.Flags().StringVarP(&globalConfig.Siad.ProfileDir, "profile-directory", "", "profiles", "location of the profiling directory")
 	root.Flags().StringVarP(&globalConfig.Siad.APIaddr, "api-addr", "", "localhost:5580", "which host:port the API server listens on")
 	root.Flags().StringVarP(&globalConfig.Siad.SiaDir, "hyperspace-directory", "d", "", "location of the hyperspace directory")
@@ -193,6 +201,8 @@ func main() {
 	root.Flags().StringVarP(&globalConfig.Siad.Modules, "modules", "M", "cghrtw", "enabled modules, see 'hsd modules' for more info")
 	root.Flags().IntVarP(&globalConfig.Siad.AddressGapLimit, "address-gap-limit", "", modules.DefaultAddressGapLimit, "address gap limit for wallet scanning")
 	root.Flags().BoolVarP(&globalConfig.Siad.ScanAirdrop, "scan-airdrop", "", false, "scan the airdrop blocks")
+	root.Flags().StringVarP(&globalConfig.Siad.HostWallet, "host-wallet", "", "", "named wallet the host is funded from, instead of the default wallet")
+	root.Flags().StringVarP(&globalConfig.Siad.RenterWallet, "renter-wallet", "", "", "named wallet the renter is funded from, instead of the default wallet")
 	root.Flags().BoolVarP(&globalConfig.Siad.AuthenticateAPI, "authenticate-api", "", true, "enable API password protection")
 	root.Flags().BoolVarP(&globalConfig.Siad.TempPassword, "temp-password", "", false, "enter a temporary API password during startup")
 	root.Flags().BoolVarP(&globalConfig.Siad.AllowAPIBind, "disable-api-security", "", false, "allow hsd to listen on a non-localhost address (DANGEROUS)")
@@ -35,6 +35,8 @@ import (
 	"github.com/HyperspaceApp/Hyperspace/modules/transactionpool"
 	"github.com/HyperspaceApp/Hyperspace/modules/wallet"
 	"github.com/HyperspaceApp/Hyperspace/node/api"
+	"github.com/HyperspaceApp/Hyperspace/node/s3"
+	"github.com/HyperspaceApp/Hyperspace/node/webdav"
 	"github.com/HyperspaceApp/Hyperspace/types"
 
 	"github.com/inconshreveable/go-update"
@@ -534,14 +536,30 @@ func (srv *Server) loadModules() error {
 		srv.moduleClosers = append(srv.moduleClosers, moduleCloser{name: "explorer", Closer: e})
 	}
 	var w modules.Wallet
+	var wm *wallet.Manager
+	var wallets modules.WalletManager
 	if strings.Contains(srv.config.Siad.Modules, "w") {
 		i++
 		fmt.Printf("(%d/%d) Loading wallet...\n", i, len(srv.config.Siad.Modules))
-		w, err = wallet.New(cs, tpool, filepath.Join(srv.config.Siad.SiaDir, modules.WalletDir), srv.config.Siad.AddressGapLimit, srv.config.Siad.ScanAirdrop)
+		dw, err := wallet.New(cs, tpool, filepath.Join(srv.config.Siad.SiaDir, modules.WalletDir), srv.config.Siad.AddressGapLimit, srv.config.Siad.ScanAirdrop)
 		if err != nil {
 			return err
 		}
+		w = dw
 		srv.moduleClosers = append(srv.moduleClosers, moduleCloser{name: "wallet", Closer: w})
+		wm, err = wallet.NewManager(dw)
+		if err != nil {
+			return err
+		}
+		wallets = wm
+		srv.moduleClosers = append(srv.moduleClosers, moduleCloser{name: "named wallets", Closer: wm})
+	}
+	// fundingWallet returns the wallet a module funds itself from.
+	fundingWallet := func(name string) (modules.Wallet, error) {
+		if name == "" || wm == nil {
+			return w, nil
+		}
+		return wm.UseWallet(name)
 	}
 	var m modules.Miner
 	if strings.Contains(srv.config.Siad.Modules, "m") {
@@ -563,7 +581,11 @@ func (srv *Server) loadModules() error {
 		if cs.SpvMode() {
 			return errors.New("host module not supported in spv mode")
 		}
-		h, err = host.New(cs, g, tpool, w, srv.config.Siad.HostAddr, filepath.Join(srv.config.Siad.SiaDir, modules.HostDir))
+		hw, err := fundingWallet(srv.config.Siad.HostWallet)
+		if err != nil {
+			return err
+		}
+		h, err = host.New(cs, g, tpool, hw, srv.config.Siad.HostAddr, filepath.Join(srv.config.Siad.SiaDir, modules.HostDir))
 		if err != nil {
 			return err
 		}
@@ -573,12 +595,50 @@ func (srv *Server) loadModules() error {
 	if strings.Contains(srv.config.Siad.Modules, "r") {
 		i++
 		fmt.Printf("(%d/%d) Loading renter...\n", i, len(srv.config.Siad.Modules))
-		r, err = renter.New(g, cs, w, tpool, filepath.Join(srv.config.Siad.SiaDir, modules.RenterDir))
+		rw, err := fundingWallet(srv.config.Siad.RenterWallet)
+		if err != nil {
+			return err
+		}
+		r, err = renter.New(g, cs, rw, tpool, filepath.Join(srv.config.Siad.SiaDir, modules.RenterDir))
 		if err != nil {
 			return err
 		}
 		srv.moduleClosers = append(srv.moduleClosers, moduleCloser{name: "renter", Closer: r})
 	}
+	if srv.config.Siad.S3Addr != "" {
+		if r == nil {
+			return errors.New("the S3 gateway requires the renter module")
+		}
+		fmt.Println("Starting S3 gateway...")
+		gw, err := s3.New(r, srv.config.S3Config, filepath.Join(srv.config.Siad.SiaDir, s3.Dir))
+		if err != nil {
+			return err
+		}
+		l, err := net.Listen("tcp", srv.config.Siad.S3Addr)
+		if err != nil {
+			return err
+		}
+		s3Server := &http.Server{Handler: gw}
+		go s3Server.Serve(l)
+		srv.moduleClosers = append(srv.moduleClosers, moduleCloser{name: "S3 gateway", Closer: s3Server})
+	}
+	if srv.config.Siad.WebDAVAddr != "" {
+		if r == nil {
+			return errors.New("the WebDAV server requires the renter module")
+		}
+		fmt.Println("Starting WebDAV server...")
+		dav, err := webdav.New(r, srv.config.WebDAVConfig)
+		if err != nil {
+			return err
+		}
+		l, err := net.Listen("tcp", srv.config.Siad.WebDAVAddr)
+		if err != nil {
+			return err
+		}
+		webdavServer := &http.Server{Handler: dav}
+		go webdavServer.Serve(l)
+		srv.moduleClosers = append(srv.moduleClosers, moduleCloser{name: "WebDAV server", Closer: webdavServer})
+	}
 	var p modules.Pool
 	if strings.Contains(srv.config.Siad.Modules, "p") {
 		i++
@@ -629,6 +689,7 @@ func (srv *Server) loadModules() error {
 		r,
 		tpool,
 		w,
+		wallets,
 		p,
 		sm,
 		idx,
@@ -15,3 +15,15 @@ type MiningPoolConfig struct {
 type IndexConfig struct {
 	PoolDBConnection string
 }
+
+// S3Config is config for the S3 gateway
+type S3Config struct {
+	AccessKeys map[string]string
+	Region     string
+}
+
+// WebDAVConfig is config for the WebDAV server
+type WebDAVConfig struct {
+	Username string
+	Password string
+}
@@ -0,0 +1,176 @@
+package host
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/encoding"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// errBackupIndexNotFound is returned when a renter requests a backup
+	// index that the host does not have.
+	errBackupIndexNotFound = ErrorCommunication("no backup index is stored under that key")
+
+	// errBackupIndexContract is returned when a renter tries to store a
+	// backup index with a contract that already pays for a different index.
+	errBackupIndexContract = ErrorCommunication("the contract already stores a different backup index")
+
+	// errBackupIndexNoContract is returned when a renter tries to store a
+	// backup index without holding a contract with the host.
+	errBackupIndexNoContract = ErrorCommunication("storing a backup index requires a contract")
+
+	// errBackupIndexRevision is returned when a renter tries to replace a
+	// backup index with an older or equal revision.
+	errBackupIndexRevision = ErrorCommunication("backup index revision is not newer than the stored revision")
+
+	// errLargeBackupIndex is returned when a renter tries to store a backup
+	// index that exceeds modules.MaxBackupIndexSize.
+	errLargeBackupIndex = ErrorCommunication("backup index exceeds the maximum size")
+)
+
+// storedBackupIndex is a backup index stored by the host. Every index is paid
+// for by the storage obligation of the contract it was last stored with, and
+// it is removed together with the obligation.
+type storedBackupIndex struct {
+	modules.LoopBackupIndexResponse
+	ContractID types.FileContractID
+}
+
+// getBackupIndex returns the backup index stored under pk.
+func getBackupIndex(tx *bolt.Tx, pk crypto.PublicKey) (index storedBackupIndex, err error) {
+	b := tx.Bucket(bucketBackupIndices).Get(pk[:])
+	if b == nil {
+		return storedBackupIndex{}, errBackupIndexNotFound
+	}
+	err = encoding.Unmarshal(b, &index)
+	return index, err
+}
+
+// putBackupIndex stores a backup index under pk and binds it to the contract
+// of the index. A contract can only store a single index. An index that was
+// stored with another contract, e.g. the contract that the index's contract
+// renewed, is moved to the new contract.
+func putBackupIndex(tx *bolt.Tx, pk crypto.PublicKey, index storedBackupIndex) error {
+	contracts := tx.Bucket(bucketBackupIndexContracts)
+	if b := contracts.Get(index.ContractID[:]); b != nil && !bytes.Equal(b, pk[:]) {
+		return errBackupIndexContract
+	}
+	old, err := getBackupIndex(tx, pk)
+	if err == nil && old.ContractID != index.ContractID {
+		if err := contracts.Delete(old.ContractID[:]); err != nil {
+			return err
+		}
+	} else if err != nil && err != errBackupIndexNotFound {
+		return err
+	}
+	if err := contracts.Put(index.ContractID[:], pk[:]); err != nil {
+		return err
+	}
+	return tx.Bucket(bucketBackupIndices).Put(pk[:], encoding.Marshal(index))
+}
+
+// removeBackupIndex removes the backup index stored with the contract id, if
+// there is one.
+func removeBackupIndex(tx *bolt.Tx, id types.FileContractID) error {
+	contracts := tx.Bucket(bucketBackupIndexContracts)
+	pk := contracts.Get(id[:])
+	if pk == nil {
+		return nil
+	}
+	if err := tx.Bucket(bucketBackupIndices).Delete(pk); err != nil {
+		return err
+	}
+	return contracts.Delete(id[:])
+}
+
+// managedRPCLoopBackupIndex writes an RPC response containing the backup
+// index stored under the requested public key. The index is encrypted by the
+// renter, so no contract is required to read it; this is what allows a
+// renter that only knows its seed to find its backups again.
+func (h *Host) managedRPCLoopBackupIndex(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(modules.NegotiateSettingsTime))
+
+	// Read the request.
+	var req modules.LoopBackupIndexRequest
+	if err := encoding.NewDecoder(conn).Decode(&req); err != nil {
+		modules.WriteRPCResponse(conn, nil, err)
+		return err
+	}
+
+	// Look up the index.
+	var index storedBackupIndex
+	h.mu.RLock()
+	err := h.db.View(func(tx *bolt.Tx) (err error) {
+		index, err = getBackupIndex(tx, req.PublicKey)
+		return err
+	})
+	h.mu.RUnlock()
+	if err != nil {
+		modules.WriteRPCResponse(conn, nil, err)
+		return err
+	}
+	return modules.WriteRPCResponse(conn, index.LoopBackupIndexResponse, nil)
+}
+
+// managedRPCLoopSetBackupIndex reads a signed backup index from the renter
+// and stores it, replacing any older revision. Only renters that hold a
+// contract with the host may store an index, and each contract pays for a
+// single index, which is stored until the contract's storage obligation is
+// removed.
+func (h *Host) managedRPCLoopSetBackupIndex(conn net.Conn, so *storageObligation) error {
+	conn.SetDeadline(time.Now().Add(modules.NegotiateSettingsTime))
+
+	// Read the request.
+	var req modules.LoopSetBackupIndexRequest
+	if err := encoding.NewDecoder(conn).Decode(&req); err != nil {
+		modules.WriteRPCResponse(conn, nil, err)
+		return err
+	}
+
+	// Validate the request.
+	var err error
+	var sig crypto.Signature
+	copy(sig[:], req.Signature)
+	if len(so.OriginTransactionSet) == 0 {
+		err = errBackupIndexNoContract
+	} else if len(req.Index) > modules.MaxBackupIndexSize {
+		err = errLargeBackupIndex
+	} else if crypto.VerifyHash(modules.BackupIndexHash(req.PublicKey, req.Index, req.Revision), req.PublicKey, sig) != nil {
+		err = errors.New("backup index signature is invalid")
+	}
+	if err != nil {
+		modules.WriteRPCResponse(conn, nil, err)
+		return err
+	}
+
+	// Store the index if it is newer than the one we have.
+	h.mu.Lock()
+	err = h.db.Update(func(tx *bolt.Tx) error {
+		old, err := getBackupIndex(tx, req.PublicKey)
+		if err == nil && old.Revision >= req.Revision {
+			return errBackupIndexRevision
+		} else if err != nil && err != errBackupIndexNotFound {
+			return err
+		}
+		return putBackupIndex(tx, req.PublicKey, storedBackupIndex{
+			LoopBackupIndexResponse: modules.LoopBackupIndexResponse{
+				Index:    req.Index,
+				Revision: req.Revision,
+			},
+			ContractID: so.id(),
+		})
+	})
+	h.mu.Unlock()
+	if err != nil {
+		modules.WriteRPCResponse(conn, nil, err)
+		return err
+	}
+	return modules.WriteRPCResponse(conn, struct{}{}, nil)
+}
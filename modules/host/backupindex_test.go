@@ -0,0 +1,179 @@
+package host
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/encoding"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+)
+
+// setBackupIndex stores a backup index signed by sk with the contract of so
+// through the host's RPC.
+func (ht *hostTester) setBackupIndex(so storageObligation, sk crypto.SecretKey, pk crypto.PublicKey, index []byte, revision uint64) error {
+	renterConn, hostConn := net.Pipe()
+	defer renterConn.Close()
+	go func() {
+		ht.host.managedRPCLoopSetBackupIndex(hostConn, &so)
+		hostConn.Close()
+	}()
+	sig := crypto.SignHash(modules.BackupIndexHash(pk, index, revision), sk)
+	req := modules.LoopSetBackupIndexRequest{
+		PublicKey: pk,
+		Index:     index,
+		Revision:  revision,
+		Signature: sig[:],
+	}
+	if err := encoding.NewEncoder(renterConn).Encode(req); err != nil {
+		return err
+	}
+	var resp struct{}
+	return modules.ReadRPCResponse(renterConn, &resp)
+}
+
+// backupIndex fetches the backup index stored under pk through the host's RPC.
+func (ht *hostTester) backupIndex(pk crypto.PublicKey) (modules.LoopBackupIndexResponse, error) {
+	renterConn, hostConn := net.Pipe()
+	defer renterConn.Close()
+	go func() {
+		ht.host.managedRPCLoopBackupIndex(hostConn)
+		hostConn.Close()
+	}()
+	req := modules.LoopBackupIndexRequest{PublicKey: pk}
+	if err := encoding.NewEncoder(renterConn).Encode(req); err != nil {
+		return modules.LoopBackupIndexResponse{}, err
+	}
+	var resp modules.LoopBackupIndexResponse
+	err := modules.ReadRPCResponse(renterConn, &resp)
+	return resp, err
+}
+
+// expectRPCError checks that err is the RPC error that the host returned for
+// expected.
+func expectRPCError(t *testing.T, err, expected error) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), expected.Error()) {
+		t.Fatalf("expected %v, got %v", expected, err)
+	}
+}
+
+// TestBackupIndex tests storing and fetching backup indices.
+func TestBackupIndex(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+	so, err := ht.newTesterStorageObligation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, pk := crypto.GenerateKeyPair()
+
+	// An index can't be stored without a contract.
+	err = ht.setBackupIndex(storageObligation{}, sk, pk, []byte("index"), 1)
+	expectRPCError(t, err, errBackupIndexNoContract)
+	_, err = ht.backupIndex(pk)
+	expectRPCError(t, err, errBackupIndexNotFound)
+
+	// Store an index and fetch it.
+	if err := ht.setBackupIndex(so, sk, pk, []byte("index"), 1); err != nil {
+		t.Fatal(err)
+	}
+	index, err := ht.backupIndex(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(index.Index, []byte("index")) || index.Revision != 1 {
+		t.Fatalf("unexpected index %+v", index)
+	}
+
+	// Only newer revisions replace the index.
+	for _, revision := range []uint64{0, 1} {
+		err = ht.setBackupIndex(so, sk, pk, []byte("old"), revision)
+		expectRPCError(t, err, errBackupIndexRevision)
+	}
+	if err := ht.setBackupIndex(so, sk, pk, []byte("new"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if index, err := ht.backupIndex(pk); err != nil || !bytes.Equal(index.Index, []byte("new")) || index.Revision != 2 {
+		t.Fatal("the index wasn't replaced", index, err)
+	}
+
+	// The index must be signed by its key and can't be too large.
+	otherSK, otherPK := crypto.GenerateKeyPair()
+	if err := ht.setBackupIndex(so, otherSK, pk, []byte("forged"), 3); err == nil {
+		t.Fatal("an index with an invalid signature was stored")
+	}
+	err = ht.setBackupIndex(so, sk, pk, make([]byte, modules.MaxBackupIndexSize+1), 3)
+	expectRPCError(t, err, errLargeBackupIndex)
+	if index, err := ht.backupIndex(pk); err != nil || index.Revision != 2 {
+		t.Fatal("the index was replaced", index, err)
+	}
+
+	// The contract can't be used to store a second index.
+	err = ht.setBackupIndex(so, otherSK, otherPK, []byte("other"), 1)
+	expectRPCError(t, err, errBackupIndexContract)
+}
+
+// TestBackupIndexContracts tests that a backup index is moved to the contract
+// it was last stored with, and that it is removed with the storage obligation
+// of that contract.
+func TestBackupIndexContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+	old, err := ht.newTesterStorageObligation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := ht.newTesterStorageObligation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, pk := crypto.GenerateKeyPair()
+	otherSK, otherPK := crypto.GenerateKeyPair()
+
+	// Storing the index with the renewed contract frees the old contract.
+	if err := ht.setBackupIndex(old, sk, pk, []byte("index"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ht.setBackupIndex(renewed, sk, pk, []byte("index"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ht.setBackupIndex(old, otherSK, otherPK, []byte("other"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the obligation of the renewed contract removes the index.
+	ht.host.managedLockStorageObligation(renewed.id())
+	err = ht.host.managedAddStorageObligation(renewed)
+	ht.host.managedUnlockStorageObligation(renewed.id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host.mu.Lock()
+	err = ht.host.removeStorageObligation(renewed, obligationSucceeded)
+	ht.host.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ht.backupIndex(pk)
+	expectRPCError(t, err, errBackupIndexNotFound)
+	if _, err := ht.backupIndex(otherPK); err != nil {
+		t.Fatal(err)
+	}
+}
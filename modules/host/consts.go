@@ -243,6 +243,14 @@ var (
 	// bucketStorageObligations contains a set of serialized
 	// 'storageObligations' sorted by their file contract id.
 	bucketStorageObligations = []byte("BucketStorageObligations")
+
+	// bucketBackupIndexContracts maps the id of a contract to the public key
+	// of the backup index that the contract pays for.
+	bucketBackupIndexContracts = []byte("BucketBackupIndexContracts")
+
+	// bucketBackupIndices maps the public key of a renter's backup index to
+	// the most recent revision of that index.
+	bucketBackupIndices = []byte("BucketBackupIndices")
 )
 
 // init runs a series of sanity checks to verify that the constants have sane
@@ -32,7 +32,7 @@ var (
 	errMaxVirtualSectors = errors.New("sector collides with a physical sector that already has the maximum allowed number of virtual sectors")
 
 	// ErrSectorNotFound is returned when a lookup for a sector fails.
-	ErrSectorNotFound = errors.New("could not find the desired sector")
+	ErrSectorNotFound = modules.ErrSectorNotFound
 )
 
 // sectorLocation indicates the location of a sector on disk.
@@ -129,6 +129,8 @@ func (h *Host) initDB() (err error) {
 		// database needs to be initialized. Create the database buckets.
 		buckets := [][]byte{
 			bucketActionItems,
+			bucketBackupIndexContracts,
+			bucketBackupIndices,
 			bucketStorageObligations,
 		}
 		for _, bucket := range buckets {
@@ -131,6 +131,10 @@ func (h *Host) managedRPCLoop(conn net.Conn) error {
 			err = extendErr("incoming RPCLoopDownload failed: ", h.managedRPCLoopDownload(conn, &so))
 		case modules.RPCLoopSectorRoots:
 			err = extendErr("incoming RPCLoopSectorRoots failed: ", h.managedRPCLoopSectorRoots(conn, &so))
+		case modules.RPCLoopBackupIndex:
+			err = extendErr("incoming RPCLoopBackupIndex failed: ", h.managedRPCLoopBackupIndex(conn))
+		case modules.RPCLoopSetBackupIndex:
+			err = extendErr("incoming RPCLoopSetBackupIndex failed: ", h.managedRPCLoopSetBackupIndex(conn, &so))
 		case modules.RPCLoopExit:
 			return nil
 		default:
@@ -620,6 +620,10 @@ func (h *Host) removeStorageObligation(so storageObligation, sos storageObligati
 	so.ObligationStatus = sos
 	so.SectorRoots = nil
 	return h.db.Update(func(tx *bolt.Tx) error {
+		// The backup index paid for by the obligation is removed as well.
+		if err := removeBackupIndex(tx, so.id()); err != nil {
+			return err
+		}
 		return putStorageObligation(tx, so)
 	})
 }
@@ -293,8 +293,14 @@ var (
 	RPCLoopRenewContract  = types.Specifier{'L', 'o', 'o', 'p', 'R', 'e', 'n', 'e', 'w'}
 	RPCLoopSectorRoots    = types.Specifier{'L', 'o', 'o', 'p', 'S', 'e', 'c', 't', 'o', 'r', 'R', 'o', 'o', 't', 's'}
 	RPCLoopUpload         = types.Specifier{'L', 'o', 'o', 'p', 'U', 'p', 'l', 'o', 'a', 'd'}
+	RPCLoopBackupIndex    = types.Specifier{'L', 'o', 'o', 'p', 'B', 'a', 'c', 'k', 'u', 'p', 'I', 'd', 'x'}
+	RPCLoopSetBackupIndex = types.Specifier{'L', 'o', 'o', 'p', 'S', 'e', 't', 'B', 'a', 'c', 'k', 'u', 'p', 'I', 'd', 'x'}
 )
 
+// MaxBackupIndexSize is the largest backup index that a host will store on
+// behalf of a renter.
+const MaxBackupIndexSize = 1 << 16
+
 // RPC ciphers
 var (
 	CipherPlaintext = types.Specifier{'p', 'l', 'a', 'i', 'n', 't', 'e', 'x', 't'}
@@ -445,8 +451,40 @@ type (
 	LoopUploadResponse struct {
 		Signature []byte
 	}
+
+	// LoopBackupIndexRequest contains the request parameters for
+	// RPCLoopBackupIndex. The PublicKey identifies the index; it is derived
+	// from the renter's seed, so that the index can be found again without
+	// any other renter state.
+	LoopBackupIndexRequest struct {
+		PublicKey crypto.PublicKey
+	}
+
+	// LoopBackupIndexResponse contains the response data for
+	// RPCLoopBackupIndex.
+	LoopBackupIndexResponse struct {
+		Index    []byte
+		Revision uint64
+	}
+
+	// LoopSetBackupIndexRequest contains the request parameters for
+	// RPCLoopSetBackupIndex. The Signature must be made by the key matching
+	// PublicKey over BackupIndexHash(PublicKey, Index, Revision), and the
+	// Revision must be greater than that of the index currently stored.
+	LoopSetBackupIndexRequest struct {
+		PublicKey crypto.PublicKey
+		Index     []byte
+		Revision  uint64
+		Signature []byte
+	}
 )
 
+// BackupIndexHash returns the hash that is signed by the owner of a backup
+// index when storing it on a host.
+func BackupIndexHash(pk crypto.PublicKey, index []byte, revision uint64) crypto.Hash {
+	return crypto.HashAll(RPCLoopSetBackupIndex, pk, index, revision)
+}
+
 // Error implements the error interface.
 func (e *RPCError) Error() string {
 	return e.Description
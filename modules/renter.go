@@ -103,6 +103,14 @@ const (
 	// renter's siafiles.
 	SiapathRoot = "siafiles"
 
+	// S3UploadDir is the hidden directory of the renter that the S3 gateway
+	// uploads objects to before they replace the existing objects.
+	S3UploadDir = ".s3/tmp"
+
+	// WebDAVUploadDir is the hidden directory of the renter that the WebDAV
+	// server uploads files to before they replace the existing files.
+	WebDAVUploadDir = ".webdav"
+
 	// EstimatedFileContractTransactionSetSize is the estimated blockchain size
 	// of a transaction set between a renter and a host that contains a file
 	// contract. This transaction set will contain a setup transaction from each
@@ -164,6 +172,14 @@ type Allowance struct {
 	ExpectedRedundancy float64 `json:"expectedredundancy"`
 }
 
+// BackupInfo describes a backup of the renter's metadata that is stored on
+// its hosts.
+type BackupInfo struct {
+	CreationDate types.Timestamp      `json:"creationdate"`
+	Size         uint64               `json:"size"`
+	Hosts        []types.SiaPublicKey `json:"hosts"`
+}
+
 // ContractUtility contains metrics internal to the contractor that reflect the
 // utility of a given contract.
 type ContractUtility struct {
@@ -197,6 +213,16 @@ type FileUploadParams struct {
 	HyperspacePath string
 	ErasureCode    ErasureCoder
 	Force          bool
+
+	// Dedup enables the deduplication of the file's chunks. Chunks that the
+	// renter already uploaded as part of another deduplicated file are not
+	// uploaded again.
+	Dedup bool
+
+	// ContentType is the MIME type of the file's content and Metadata holds
+	// key/value tags that are attached to the file.
+	ContentType string
+	Metadata    map[string]string
 }
 
 // FileInfo provides information about a file.
@@ -205,20 +231,293 @@ type FileInfo struct {
 	Available      bool              `json:"available"`
 	ChangeTime     time.Time         `json:"changetime"`
 	CipherType     string            `json:"ciphertype"`
+	ContentType    string            `json:"contenttype"`
 	CreateTime     time.Time         `json:"createtime"`
 	Expiration     types.BlockHeight `json:"expiration"`
 	Filesize       uint64            `json:"filesize"`
+	Health         float64           `json:"health"`
 	LocalPath      string            `json:"localpath"`
+	Metadata       map[string]string `json:"metadata"`
 	ModTime        time.Time         `json:"modtime"`
+	NumStuckChunks uint64            `json:"numstuckchunks"`
 	OnDisk         bool              `json:"ondisk"`
 	Recoverable    bool              `json:"recoverable"`
 	Redundancy     float64           `json:"redundancy"`
 	Renewing       bool              `json:"renewing"`
 	HyperspacePath string            `json:"hyperspacepath"`
+	Stuck          bool              `json:"stuck"`
+	StuckReason    string            `json:"stuckreason"`
 	UploadedBytes  uint64            `json:"uploadedbytes"`
 	UploadProgress float64           `json:"uploadprogress"`
 }
 
+// FileQuery selects files of the renter. A file matches the query if it
+// matches every criterion that is set. Prefix matches the start of the
+// hyperspace path, Tags match if the file has every tag with the given value,
+// or any value if the given value is empty. Zero sizes and times leave the
+// respective range open, and so do nil healths. Health is the health of the
+// file as of its last health check.
+type FileQuery struct {
+	ContentType    string
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	MaxHealth      *float64
+	MaxSize        uint64
+	MinHealth      *float64
+	MinSize        uint64
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	Prefix         string
+	Tags           map[string]string
+}
+
+// MountInfo describes a FUSE filesystem that exposes a directory of the
+// renter.
+type MountInfo struct {
+	MountPoint     string `json:"mountpoint"`
+	HyperspacePath string `json:"hyperspacepath"`
+}
+
+// SyncJob continuously uploads the files of a local directory to a renter
+// directory. New and changed files are uploaded, and files that are deleted
+// locally are deleted from the renter if MirrorDeletions is set. Files and
+// directories matching one of the Ignore patterns are skipped. Patterns use
+// the syntax of filepath.Match and are matched against the name and the path
+// relative to LocalPath of every file and directory.
+type SyncJob struct {
+	HyperspacePath  string   `json:"hyperspacepath"`
+	Ignore          []string `json:"ignore"`
+	LocalPath       string   `json:"localpath"`
+	MirrorDeletions bool     `json:"mirrordeletions"`
+}
+
+// SyncJobInfo describes the state of a sync job. Watching is true if changes
+// to the local directory are detected immediately instead of only by the
+// periodic rescans.
+type SyncJobInfo struct {
+	SyncJob
+	Error       string    `json:"error"`
+	LastScan    time.Time `json:"lastscan"`
+	NumDeleted  uint64    `json:"numdeleted"`
+	NumFiles    uint64    `json:"numfiles"`
+	NumUploaded uint64    `json:"numuploaded"`
+	Watching    bool      `json:"watching"`
+}
+
+// RenterEventType identifies the kind of a RenterEvent.
+type RenterEventType string
+
+const (
+	// RenterEventChunkUploaded is sent when the upload of a chunk finished.
+	// Pieces is the number of pieces of the chunk that were uploaded.
+	RenterEventChunkUploaded RenterEventType = "chunkuploaded"
+
+	// RenterEventFileRedundant is sent when an upload or repair brought a
+	// file to full redundancy.
+	RenterEventFileRedundant RenterEventType = "fileredundant"
+
+	// RenterEventFileHealthDegraded is sent when a health check finds a
+	// file in worse health than the previous check.
+	RenterEventFileHealthDegraded RenterEventType = "filehealthdegraded"
+
+	// RenterEventDownloadStarted is sent when a download was queued.
+	RenterEventDownloadStarted RenterEventType = "downloadstarted"
+
+	// RenterEventDownloadProgress is sent periodically while a download is
+	// running.
+	RenterEventDownloadProgress RenterEventType = "downloadprogress"
+
+	// RenterEventDownloadCompleted is sent when a download finished
+	// successfully.
+	RenterEventDownloadCompleted RenterEventType = "downloadcompleted"
+
+	// RenterEventDownloadFailed is sent when a download failed. Error
+	// contains the reason.
+	RenterEventDownloadFailed RenterEventType = "downloadfailed"
+
+	// RenterEventContractFormed is sent when a new contract was formed.
+	RenterEventContractFormed RenterEventType = "contractformed"
+
+	// RenterEventContractRenewed is sent when a contract was renewed.
+	// ContractID is the id of the new contract and RenewedFrom the id of the
+	// old one.
+	RenterEventContractRenewed RenterEventType = "contractrenewed"
+
+	// RenterEventContractExpired is sent when a contract reached its end
+	// height without being renewed.
+	RenterEventContractExpired RenterEventType = "contractexpired"
+)
+
+// RenterEvent reports progress of the renter's uploads, downloads and
+// contracts. Only the fields that are relevant to the Type of the event are
+// set. Contract events don't belong to a file and have an empty
+// HyperspacePath.
+type RenterEvent struct {
+	Type      RenterEventType `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+
+	// File events.
+	HyperspacePath string  `json:"hyperspacepath"`
+	ChunkIndex     uint64  `json:"chunkindex"`
+	Pieces         int     `json:"pieces"`
+	Health         float64 `json:"health"`
+	PreviousHealth float64 `json:"previoushealth"`
+
+	// Download events.
+	Destination string `json:"destination"`
+	Length      uint64 `json:"length"`
+	Received    uint64 `json:"received"`
+	Error       string `json:"error"`
+
+	// Contract events.
+	ContractID  types.FileContractID `json:"contractid"`
+	EndHeight   types.BlockHeight    `json:"endheight"`
+	NetAddress  NetAddress           `json:"netaddress"`
+	RenewedFrom types.FileContractID `json:"renewedfrom"`
+}
+
+// A RenterEventSubscriber receives the events of the renter.
+// ReceiveRenterEvent is called from the renter's upload, download and
+// contract maintenance threads, so it must not block.
+type RenterEventSubscriber interface {
+	ReceiveRenterEvent(RenterEvent)
+}
+
+// MigrationReason identifies why the pieces stored on a host are migrated to
+// other hosts.
+type MigrationReason string
+
+const (
+	// MigrationReasonFiltered is the reason for hosts that are blacklisted,
+	// or not whitelisted, by the hostdb's filter mode.
+	MigrationReasonFiltered MigrationReason = "filtered"
+
+	// MigrationReasonNotGoodForRenew is the reason for hosts whose contracts
+	// won't be renewed, e.g. because of a poor score, too many failed
+	// renewals or because the contract was canceled.
+	MigrationReasonNotGoodForRenew MigrationReason = "notgoodforrenew"
+
+	// MigrationReasonExpiring is the reason for hosts whose contracts reached
+	// the second half of the renew window without being renewed.
+	MigrationReasonExpiring MigrationReason = "expiring"
+
+	// MigrationReasonHostPolicy is the reason for hosts that store pieces of
+	// files whose host policy doesn't include the host. Only those pieces are
+	// migrated, and the contract is kept.
+	MigrationReasonHostPolicy MigrationReason = "hostpolicy"
+)
+
+// HostMigration describes the migration of the pieces stored on a host that
+// is being dropped to other hosts. PiecesRemaining is the number of pieces
+// that were left on the host at the start of the current migration round.
+// The contract with the host is canceled once no pieces are left, unless the
+// reason is MigrationReasonHostPolicy.
+type HostMigration struct {
+	BytesMigrated   uint64               `json:"bytesmigrated"`
+	ContractID      types.FileContractID `json:"contractid"`
+	HostPublicKey   types.SiaPublicKey   `json:"hostpublickey"`
+	LastError       string               `json:"lasterror"`
+	NetAddress      NetAddress           `json:"netaddress"`
+	Offline         bool                 `json:"offline"`
+	PiecesFailed    uint64               `json:"piecesfailed"`
+	PiecesMigrated  uint64               `json:"piecesmigrated"`
+	PiecesRemaining uint64               `json:"piecesremaining"`
+	Reason          MigrationReason      `json:"reason"`
+	StartTime       time.Time            `json:"starttime"`
+}
+
+// StuckChunkInfo describes a chunk that the renter could not repair to full
+// redundancy.
+type StuckChunkInfo struct {
+	Index       uint64    `json:"index"`
+	LastAttempt time.Time `json:"lastattempt"`
+	Reason      string    `json:"reason"`
+}
+
+// StuckFileInfo lists the stuck chunks of a file.
+type StuckFileInfo struct {
+	Chunks         []StuckChunkInfo `json:"chunks"`
+	HyperspacePath string           `json:"hyperspacepath"`
+	Redundancy     float64          `json:"redundancy"`
+}
+
+// DirectoryInfo provides information about a renter directory. The size,
+// file count, minimum redundancy and last modification time are aggregated
+// over every file below the directory, not just its immediate children. The
+// minimum redundancy is -1 if there are no files below the directory. The
+// health values are the ones last stored by the renter's health checks: Health
+// is the worst health of the files directly inside the directory and
+// AggregateHealth the worst health of any file below it. A health of 0 means
+// full redundancy and values above 1 mean that a file can't be recovered.
+type DirectoryInfo struct {
+	AggregateHealth     float64       `json:"aggregatehealth"`
+	AggregateSize       uint64        `json:"aggregatesize"`
+	Health              float64       `json:"health"`
+	HostPolicy          string        `json:"hostpolicy"`
+	LastHealthCheckTime time.Time     `json:"lasthealthchecktime"`
+	LastModified        time.Time     `json:"lastmodified"`
+	MinRedundancy       float64       `json:"minredundancy"`
+	NumFiles            uint64        `json:"numfiles"`
+	NumStuckChunks      uint64        `json:"numstuckchunks"`
+	NumSubDirs          uint64        `json:"numsubdirs"`
+	HyperspacePath      string        `json:"hyperspacepath"`
+	VersionPolicy       VersionPolicy `json:"versionpolicy"`
+}
+
+// VersionPolicy is the retention policy of the old versions of the files
+// below the directories it is attached to. Overwriting or deleting a file
+// below such a directory keeps the previous version of the file, together
+// with its data on the hosts, until it is expired by the policy. A version
+// expires once there are MaxVersions newer versions of the file, or once it
+// is older than MaxDays days. Zero fields don't expire versions, and files
+// aren't versioned at all if both fields are zero.
+type VersionPolicy struct {
+	MaxVersions uint64 `json:"maxversions"`
+	MaxDays     uint64 `json:"maxdays"`
+}
+
+// FileVersion is an old version of a file. ArchiveTime is the time at which
+// the version was overwritten or deleted.
+type FileVersion struct {
+	ID          string    `json:"id"`
+	ArchiveTime time.Time `json:"archivetime"`
+	File        FileInfo  `json:"file"`
+}
+
+// HostPolicy restricts the hosts that the files below the directories it is
+// attached to are uploaded to. The contracts with hosts that satisfy a policy
+// form the contract set of the policy, and the renter forms enough contracts
+// for the set to contain Hosts contracts. Empty fields don't restrict the
+// hosts.
+type HostPolicy struct {
+	// Name identifies the policy.
+	Name string `json:"name"`
+
+	// Hosts is the number of contracts that the contract set of the policy
+	// should contain.
+	Hosts uint64 `json:"hosts"`
+
+	// Whitelist contains the only hosts that satisfy the policy and Blacklist
+	// contains hosts that never satisfy it.
+	Whitelist []types.SiaPublicKey `json:"whitelist"`
+	Blacklist []types.SiaPublicKey `json:"blacklist"`
+
+	// Subnets contains the CIDR subnets and Countries the ISO 3166-1 alpha-2
+	// country codes that the IP addresses of the hosts must be in. Countries
+	// are looked up in the offline GeoIP database of the renter.
+	Subnets   []string `json:"subnets"`
+	Countries []string `json:"countries"`
+
+	// MinScore is the minimum score of the hosts in the hostdb.
+	MinScore types.Currency `json:"minscore"`
+
+	// The maximum prices of the hosts.
+	MaxContractPrice          types.Currency `json:"maxcontractprice"`
+	MaxDownloadBandwidthPrice types.Currency `json:"maxdownloadbandwidthprice"`
+	MaxStoragePrice           types.Currency `json:"maxstorageprice"`
+	MaxUploadBandwidthPrice   types.Currency `json:"maxuploadbandwidthprice"`
+}
+
 // A HostDBEntry represents one host entry in the Renter's host DB. It
 // aggregates the host's external settings and metrics with its public key.
 type HostDBEntry struct {
@@ -305,6 +604,7 @@ type RenterSettings struct {
 	IPViolationsCheck bool      `json:"ipviolationcheck"`
 	MaxUploadSpeed    int64     `json:"maxuploadspeed"`
 	MaxDownloadSpeed  int64     `json:"maxdownloadspeed"`
+	MaxMigrationSpeed int64     `json:"maxmigrationspeed"`
 	StreamCacheSize   uint64    `json:"streamcachesize"`
 }
 
@@ -436,6 +736,10 @@ type Renter interface {
 	// AllHosts returns the full list of hosts known to the renter.
 	AllHosts() []HostDBEntry
 
+	// Backups returns the metadata backups stored on the renter's hosts,
+	// oldest first.
+	Backups() ([]BackupInfo, error)
+
 	// Close closes the Renter.
 	Close() error
 
@@ -451,6 +755,10 @@ type Renter interface {
 	// ContractUtility provides the contract utility for a given host key.
 	ContractUtility(pk types.SiaPublicKey) (ContractUtility, bool)
 
+	// CreateBackup uploads an encrypted backup of the renter's metadata to
+	// its hosts.
+	CreateBackup() error
+
 	// CurrentPeriod returns the height at which the current allowance period
 	// began.
 	CurrentPeriod() types.BlockHeight
@@ -462,6 +770,11 @@ type Renter interface {
 	// DeleteFile deletes a file entry from the renter.
 	DeleteFile(path string) error
 
+	// PurgeFile deletes a file entry from the renter without keeping a
+	// version of it, even if the file is versioned. It is meant for
+	// temporary files.
+	PurgeFile(path string) error
+
 	// Download performs a download according to the parameters passed, including
 	// downloads of `offset` and `length` type.
 	Download(params RenterDownloadParameters) error
@@ -489,17 +802,54 @@ type Renter interface {
 	// Host provides the DB entry and score breakdown for the requested host.
 	Host(pk types.SiaPublicKey) (HostDBEntry, bool)
 
+	// HostPolicies returns the host policies of the renter.
+	HostPolicies() []HostPolicy
+
+	// SetHostPolicy adds a host policy or replaces the policy with the same
+	// name.
+	SetHostPolicy(policy HostPolicy) error
+
+	// DeleteHostPolicy removes a host policy.
+	DeleteHostPolicy(name string) error
+
+	// PolicyContracts returns the contract set of a host policy.
+	PolicyContracts(name string) ([]RenterContract, error)
+
+	// SetFileMetadata replaces the content type and the key/value tags of a
+	// file.
+	SetFileMetadata(siaPath, contentType string, metadata map[string]string) error
+
+	// QueryFiles returns the files that match the query, sorted by their
+	// hyperspace path.
+	QueryFiles(query FileQuery) ([]FileInfo, error)
+
+	// FileVersions returns the old versions of a file, newest first.
+	FileVersions(siaPath string) ([]FileVersion, error)
+
+	// RestoreFileVersion replaces a file with one of its old versions. The
+	// replaced file becomes a version itself if the file is versioned.
+	RestoreFileVersion(siaPath, id string) error
+
 	// InitialScanComplete returns a boolean indicating if the initial scan of the
 	// hostdb is completed.
 	InitialScanComplete() (bool, error)
 
 	// LoadSharedFiles loads a '.sia' file into the renter. A .sia file may
-	// contain multiple files. The paths of the added files are returned.
-	LoadSharedFiles(source string) ([]string, error)
+	// contain multiple files. The paths of the added files are returned,
+	// together with the key the files were signed with. The key isn't
+	// checked against any trusted key, the caller has to do that.
+	LoadSharedFiles(source string) ([]string, types.SiaPublicKey, error)
 
 	// LoadSharedFilesASCII loads an ASCII-encoded '.sia' file into the
 	// renter.
-	LoadSharedFilesASCII(asciiSia string) ([]string, error)
+	LoadSharedFilesASCII(asciiSia string) ([]string, types.SiaPublicKey, error)
+
+	// Mount mounts the directory at siaPath as a read-only FUSE filesystem
+	// at mountPoint.
+	Mount(mountPoint, siaPath string) error
+
+	// MountInfo returns the FUSE filesystems mounted by the renter.
+	MountInfo() []MountInfo
 
 	// PriceEstimation estimates the cost in siacoins of performing various
 	// storage and data operations.
@@ -508,6 +858,41 @@ type Renter interface {
 	// RenameFile changes the path of a file.
 	RenameFile(path, newPath string) error
 
+	// ReplaceFile moves the file at path to newPath, atomically replacing the
+	// file at newPath if it exists. The replaced file is kept as a version if
+	// its directory has a version policy.
+	ReplaceFile(path, newPath string) error
+
+	// RestoreBackup finds the most recent metadata backup made with the
+	// given seed and restores the renter's contracts and files from it.
+	RestoreBackup(seed Seed) error
+
+	// Unmount unmounts a FUSE filesystem mounted by the renter.
+	Unmount(mountPoint string) error
+
+	// AddSyncJob starts a job that continuously uploads the files of a local
+	// directory to a renter directory.
+	AddSyncJob(job SyncJob) error
+
+	// RemoveSyncJob stops the sync job that uploads to the directory at
+	// siaPath. The files it uploaded are kept.
+	RemoveSyncJob(siaPath string) error
+
+	// SyncJobs returns the sync jobs of the renter.
+	SyncJobs() []SyncJobInfo
+
+	// Migrations returns the ongoing migrations of pieces away from hosts
+	// that are being dropped.
+	Migrations() []HostMigration
+
+	// EventSubscribe adds a subscriber that will be notified of the events
+	// of the renter.
+	EventSubscribe(RenterEventSubscriber)
+
+	// EventUnsubscribe removes a subscriber that was added with
+	// EventSubscribe.
+	EventUnsubscribe(RenterEventSubscriber)
+
 	// EstimateHostScore will return the score for a host with the provided
 	// settings, assuming perfect age and uptime adjustments
 	EstimateHostScore(entry HostDBEntry, allowance Allowance) HostScoreBreakdown
@@ -522,15 +907,25 @@ type Renter interface {
 	// SetSettings sets the Renter's settings.
 	SetSettings(RenterSettings) error
 
+	// SetFileRedundancy changes the erasure code of a file. The file is
+	// re-encoded in the background.
+	SetFileRedundancy(siaPath string, ec ErasureCoder) error
+
 	// SetFileTrackingPath sets the on-disk location of an uploaded file to a
 	// new value. Useful if files need to be moved on disk.
 	SetFileTrackingPath(siaPath, newPath string) error
 
-	// ShareFiles creates a '.sia' file that can be shared with others.
-	//ShareFiles(paths []string, shareDest string) error
+	// ShareFiles creates a '.sia' file that can be shared with others. The
+	// paths can be files or directories. The .sia file contains the master
+	// keys of the files, so anyone who has it can decrypt them. Packed files
+	// are shared with the key of their pack.
+	ShareFiles(paths []string, shareDest string) error
+
+	// ShareFilesASCII creates an ASCII-encoded '.sia' file.
+	ShareFilesASCII(paths []string) (asciiSia string, err error)
 
-	// ShareFilesAscii creates an ASCII-encoded '.sia' file.
-	//ShareFilesASCII(paths []string) (asciiSia string, err error)
+	// SharingKey returns the public key that shared files are signed with.
+	SharingKey() types.SiaPublicKey
 
 	// Streamer creates a io.ReadSeeker that can be used to stream downloads
 	// from the Sia network and also returns the fileName of the streamed
@@ -540,8 +935,40 @@ type Renter interface {
 	// Upload uploads a file using the input parameters.
 	Upload(FileUploadParams) error
 
+	// UploadStreamFromReader uploads the data read from the reader using the
+	// input parameters. The Source of the parameters is ignored.
+	UploadStreamFromReader(up FileUploadParams, reader io.Reader) error
+
+	// VerifyFile downloads a file and checks that its content matches the
+	// checksum that was computed when it was uploaded.
+	VerifyFile(siaPath string) error
+
 	// CreateDir creates a directory for the renter
 	CreateDir(siaPath string) error
+
+	// DeleteDir deletes a directory and everything below it from the
+	// renter.
+	DeleteDir(siaPath string) error
+
+	// DirList returns the directory at siaPath followed by its immediate
+	// subdirectories, and the files directly inside it.
+	DirList(siaPath string) ([]DirectoryInfo, []FileInfo, error)
+
+	// RenameDir moves a directory and everything below it to a new path.
+	RenameDir(siaPath, newSiaPath string) error
+
+	// SetDirHostPolicy attaches a host policy to a directory. The files below
+	// the directory are only uploaded to the hosts in the contract set of the
+	// policy. An empty policy name detaches the policy.
+	SetDirHostPolicy(siaPath, policy string) error
+
+	// SetDirVersionPolicy attaches a version policy to a directory. A zero
+	// policy detaches the directory's policy.
+	SetDirVersionPolicy(siaPath string, policy VersionPolicy) error
+
+	// StuckFiles returns the files that have chunks which the renter could
+	// not repair to full redundancy, together with the reason why.
+	StuckFiles() ([]StuckFileInfo, error)
 }
 
 // Streamer is the interface implemented by the Renter's streamer type which
@@ -560,4 +987,8 @@ type RenterDownloadParameters struct {
 	Offset         uint64
 	HyperspacePath string
 	Destination    string
+
+	// Version is the id of the old version of the file that is downloaded.
+	// The current version is downloaded if it is empty.
+	Version string
 }
@@ -0,0 +1,327 @@
+package renter
+
+// Retrievability audits check that hosts still store the renter's data before
+// it is needed. Every auditInterval, the renter samples random pieces of its
+// files and downloads a random segment of each piece from the host storing it.
+// The Downloader verifies the segment against the piece's Merkle root and
+// records the outcome as an interaction with the host in the hostdb, so hosts
+// failing audits lose their score and eventually their contracts.
+//
+// Only audits where the host reported that it doesn't store the sector, or sent
+// data that doesn't match the piece's Merkle root, count as failed. Audits that
+// fail for other reasons, e.g. network errors and timeouts, are skipped, since
+// they don't show that the host lost the piece. A piece is only considered lost
+// once auditMaxFailures consecutive audits of it failed, and pieces that failed
+// an audit are audited again in the next round. Lost pieces are removed from
+// their siafile and the health of the file's directory is updated, which makes
+// the repair loop upload the piece again.
+//
+// Audits are paid for from the renter's contracts. The amount spent on audits
+// during a period is capped at the allowance divided by auditBudgetDivisor.
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/proto"
+	"github.com/HyperspaceApp/Hyperspace/persist"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+const (
+	// auditFile is the name of the file that persists the audit spending.
+	auditFile = "audit.json"
+)
+
+var (
+	// auditMetadata is the header of the audit file.
+	auditMetadata = persist.Metadata{
+		Header:  "Renter Audits",
+		Version: persistVersion,
+	}
+
+	// errAuditBudgetExhausted is returned if the audit budget of the current
+	// period is exhausted.
+	errAuditBudgetExhausted = errors.New("audit budget exhausted")
+
+	// errAuditSkipped is returned if a piece couldn't be audited for reasons
+	// that don't indicate that the host lost it.
+	errAuditSkipped = errors.New("audit skipped")
+)
+
+type (
+	// auditor tracks the state of the renter's retrievability audits.
+	auditor struct {
+		// failures maps the ids of pieces whose last audits failed to the
+		// pieces.
+		failures map[string]*auditedPiece
+
+		persist auditPersist
+		path    string
+		mu      sync.Mutex
+	}
+
+	// auditPersist is the persisted state of the auditor.
+	auditPersist struct {
+		Period   types.BlockHeight // start of the period of Spending
+		Spending types.Currency    // amount spent on audits during Period
+	}
+
+	// auditedPiece is a piece of a siafile that is audited.
+	auditedPiece struct {
+		siaPath    string
+		chunkIndex uint64
+		pieceIndex uint64
+		host       types.SiaPublicKey
+		root       crypto.Hash
+		failures   int
+	}
+)
+
+// loadAuditor loads the auditor persisted at path. A new auditor is returned
+// if it wasn't persisted yet.
+func loadAuditor(path string) (*auditor, error) {
+	a := &auditor{
+		failures: make(map[string]*auditedPiece),
+		path:     path,
+	}
+	err := persist.LoadJSON(auditMetadata, &a.persist, path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	return a, err
+}
+
+// save persists the auditor. The caller must hold the lock.
+func (a *auditor) save() error {
+	return persist.SaveJSON(auditMetadata, a.persist, a.path)
+}
+
+// id returns the id of the piece. A piece is identified by the host storing it
+// and its Merkle root, since the same sector can't be stored twice on a host.
+func (ap auditedPiece) id() string {
+	return ap.host.String() + ap.root.String()
+}
+
+// isAuditFailure returns whether err, the error of an audit, shows that the
+// host lost the audited piece. Hosts send their errors as strings, so a
+// missing sector is detected by the message of the error.
+func isAuditFailure(err error) bool {
+	return errors.Contains(err, proto.ErrBadSectorData) || strings.Contains(err.Error(), modules.ErrSectorNotFound.Error())
+}
+
+// auditCost returns the amount that auditing a piece stored on host costs.
+func auditCost(host modules.HostDBEntry) types.Currency {
+	// Hosts that don't support the new renter-host protocol always send
+	// entire sectors.
+	length := uint64(crypto.SegmentSize)
+	if build.VersionCmp(host.Version, "1.4.0") < 0 {
+		length = modules.SectorSize
+	}
+	return host.DownloadBandwidthPrice.Mul64(length)
+}
+
+// managedReserveAuditFunds adds cost to the amount spent on audits during the
+// current period. It returns false if that would exceed the audit budget.
+func (r *Renter) managedReserveAuditFunds(cost types.Currency) bool {
+	budget := r.hostContractor.Allowance().Funds.Div64(auditBudgetDivisor)
+	period := r.hostContractor.CurrentPeriod()
+
+	a := r.staticAuditor
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.persist.Period != period {
+		a.persist.Period = period
+		a.persist.Spending = types.ZeroCurrency
+	}
+	if a.persist.Spending.Add(cost).Cmp(budget) > 0 {
+		return false
+	}
+	a.persist.Spending = a.persist.Spending.Add(cost)
+	if err := a.save(); err != nil {
+		r.log.Println("WARN: could not save the audit spending:", err)
+	}
+	return true
+}
+
+// managedSampleAuditPieces returns up to n random pieces of the renter's files
+// that are stored on hosts the renter has contracts with.
+func (r *Renter) managedSampleAuditPieces(n int) ([]auditedPiece, error) {
+	siaPaths, err := r.managedFilesBelow("")
+	if err != nil {
+		return nil, err
+	}
+	if len(siaPaths) == 0 {
+		return nil, nil
+	}
+	var samples []auditedPiece
+	for i := 0; i < n; i++ {
+		siaPath := siaPaths[fastrand.Intn(len(siaPaths))]
+		entry, err := r.staticFileSet.Open(siaPath)
+		if err != nil {
+			continue
+		}
+		// Packed files don't have chunks of their own, their pieces are
+		// audited as part of their pack.
+		if entry.NumChunks() == 0 {
+			entry.Close()
+			continue
+		}
+		chunkIndex := fastrand.Uint64n(entry.NumChunks())
+		pieces, err := entry.Pieces(chunkIndex)
+		entry.Close()
+		if err != nil {
+			continue
+		}
+		var candidates []auditedPiece
+		for pieceIndex, pieceSet := range pieces {
+			for _, piece := range pieceSet {
+				if _, exists := r.hostContractor.ContractUtility(piece.HostPubKey); !exists {
+					continue
+				}
+				candidates = append(candidates, auditedPiece{
+					siaPath:    siaPath,
+					chunkIndex: chunkIndex,
+					pieceIndex: uint64(pieceIndex),
+					host:       piece.HostPubKey,
+					root:       piece.MerkleRoot,
+				})
+			}
+		}
+		if len(candidates) > 0 {
+			samples = append(samples, candidates[fastrand.Intn(len(candidates))])
+		}
+	}
+	return samples, nil
+}
+
+// managedDownloadAuditSegment downloads a random segment of the sector with
+// the given root from host. The Downloader verifies the segment against the
+// root. errAuditSkipped is returned if no connection to the host could be
+// established, and the error of the download if it failed.
+func (r *Renter) managedDownloadAuditSegment(host types.SiaPublicKey, root crypto.Hash) error {
+	entry, exists := r.hostDB.Host(host)
+	if !exists {
+		return errAuditSkipped
+	}
+	d, err := r.hostContractor.Downloader(host, r.tg.StopChan())
+	if err != nil {
+		return errors.Compose(errAuditSkipped, err)
+	}
+	defer d.Close()
+	if !r.managedReserveAuditFunds(auditCost(entry)) {
+		return errAuditBudgetExhausted
+	}
+	segment := fastrand.Uint64n(modules.SectorSize / crypto.SegmentSize)
+	_, err = d.Download(root, uint32(segment*crypto.SegmentSize), crypto.SegmentSize)
+	return err
+}
+
+// managedAuditPiece audits a piece and removes it from its siafile if it is
+// considered lost. It returns false if no further audits should be performed
+// in this round.
+func (r *Renter) managedAuditPiece(ap auditedPiece) bool {
+	err := r.managedDownloadAuditSegment(ap.host, ap.root)
+	select {
+	case <-r.tg.StopChan():
+		return false
+	default:
+	}
+	if err == errAuditBudgetExhausted {
+		return false
+	} else if err != nil && (errors.Contains(err, errAuditSkipped) || !isAuditFailure(err)) {
+		r.log.Debugln("Skipped audit of piece:", err)
+		return true
+	}
+
+	a := r.staticAuditor
+	a.mu.Lock()
+	if err == nil {
+		delete(a.failures, ap.id())
+		a.mu.Unlock()
+		return true
+	}
+	failed, exists := a.failures[ap.id()]
+	if !exists {
+		failed = &ap
+		a.failures[ap.id()] = failed
+	}
+	failed.failures++
+	lost := failed.failures >= auditMaxFailures
+	if lost {
+		delete(a.failures, ap.id())
+	}
+	a.mu.Unlock()
+	r.log.Debugf("Audit of piece %v of chunk %v of %v on host %v failed: %v", ap.pieceIndex, ap.chunkIndex, ap.siaPath, ap.host, err)
+	if !lost {
+		return true
+	}
+
+	// Remove the lost piece so that the chunk is repaired.
+	r.log.Printf("Host %v lost piece %v of chunk %v of %v", ap.host, ap.pieceIndex, ap.chunkIndex, ap.siaPath)
+	entry, err := r.staticFileSet.Open(ap.siaPath)
+	if err != nil {
+		// The file might have been deleted or renamed in the meantime.
+		return true
+	}
+	defer entry.Close()
+	if err := entry.RemovePiece(ap.host, ap.chunkIndex, ap.pieceIndex, ap.root); err != nil {
+		r.log.Debugln("WARN: could not remove lost piece:", err)
+		return true
+	}
+	if err := r.managedBubbleFileHealth(entry); err != nil {
+		r.log.Println("WARN: Could not update the health of the directory of", ap.siaPath, err)
+	}
+	return true
+}
+
+// managedAudit audits the pieces that failed their last audit and a random
+// sample of other pieces.
+func (r *Renter) managedAudit() {
+	a := r.staticAuditor
+	a.mu.Lock()
+	pieces := make([]auditedPiece, 0, len(a.failures)+auditSamples)
+	for _, ap := range a.failures {
+		pieces = append(pieces, *ap)
+	}
+	a.mu.Unlock()
+	samples, err := r.managedSampleAuditPieces(auditSamples)
+	if err != nil {
+		r.log.Println("WARN: Could not sample pieces to audit:", err)
+	}
+	for _, ap := range append(pieces, samples...) {
+		if !r.managedAuditPiece(ap) {
+			return
+		}
+	}
+}
+
+// threadedAuditLoop periodically audits random pieces of the renter's files.
+func (r *Renter) threadedAuditLoop() {
+	err := r.tg.Add()
+	if err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	for {
+		select {
+		case <-time.After(auditInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+
+		// Audits are paid for from the renter's contracts.
+		if len(r.hostContractor.Contracts()) == 0 {
+			continue
+		}
+		r.managedAudit()
+	}
+}
@@ -0,0 +1,161 @@
+package renter
+
+import (
+	"io"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/contractor"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/proto"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/errors"
+)
+
+// TestAuditCost tests that audits of hosts that don't support the new
+// renter-host protocol are charged for entire sectors.
+func TestAuditCost(t *testing.T) {
+	host := modules.HostDBEntry{}
+	host.DownloadBandwidthPrice = types.NewCurrency64(3)
+	host.Version = "1.4.0"
+	if cost := auditCost(host); !cost.Equals(types.NewCurrency64(3 * crypto.SegmentSize)) {
+		t.Fatal("unexpected cost for new host", cost)
+	}
+	host.Version = "1.3.7"
+	if cost := auditCost(host); !cost.Equals(types.NewCurrency64(3 * modules.SectorSize)) {
+		t.Fatal("unexpected cost for old host", cost)
+	}
+}
+
+// auditContractor is a hostContractor whose downloaders fail with err.
+type auditContractor struct {
+	hostContractor
+	err error
+}
+
+// auditDownloader is the contractor.Downloader of an auditContractor.
+type auditDownloader struct {
+	ac *auditContractor
+}
+
+// Download returns the error of the contractor.
+func (d *auditDownloader) Download(crypto.Hash, uint32, uint32) ([]byte, error) {
+	return make([]byte, crypto.SegmentSize), d.ac.err
+}
+
+// Close implements contractor.Downloader.
+func (d *auditDownloader) Close() error { return nil }
+
+// Downloader returns an auditDownloader.
+func (ac *auditContractor) Downloader(types.SiaPublicKey, <-chan struct{}) (contractor.Downloader, error) {
+	return &auditDownloader{ac: ac}, nil
+}
+
+// TestIsAuditFailure tests that only missing sectors and bad sector data count
+// as failed audits.
+func TestIsAuditFailure(t *testing.T) {
+	tests := []struct {
+		err     error
+		failure bool
+	}{
+		{proto.ErrBadSectorData, true},
+		{errors.Extend(errors.AddContext(proto.ErrBadSectorData, "invalid Merkle proof"), modules.ErrHostFault), true},
+		{&modules.RPCError{Description: modules.ErrSectorNotFound.Error()}, true},
+		{errors.New("download request rejected: failed to load sector: " + modules.ErrSectorNotFound.Error()), true},
+		{errors.New("i/o timeout"), false},
+		{io.ErrUnexpectedEOF, false},
+		{errors.New("connection reset by peer"), false},
+	}
+	for i, test := range tests {
+		if isAuditFailure(test.err) != test.failure {
+			t.Errorf("test %v: expected %v to be a failure: %v", i, test.err, test.failure)
+		}
+	}
+}
+
+// TestAuditPiece tests that failed audits of a piece are counted, that audits
+// failing for other reasons are skipped, and that the piece is removed from its
+// file once it is considered lost.
+func TestAuditPiece(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Store a piece of a file on a host.
+	_, pk := crypto.GenerateKeyPair()
+	var host modules.HostDBEntry
+	host.PublicKey = types.Ed25519PublicKey(pk)
+	ac := &auditContractor{hostContractor: r.hostContractor}
+	id := r.mu.Lock()
+	r.hostContractor = ac
+	r.hostDB = &backupHostDB{hostDB: r.hostDB, hosts: []modules.HostDBEntry{host}}
+	r.mu.Unlock(id)
+	if err := r.newSizedTestFile("foo", 1000); err != nil {
+		t.Fatal(err)
+	}
+	ap := auditedPiece{siaPath: "foo", host: host.PublicKey, root: crypto.Hash{1}}
+	entry, err := r.staticFileSet.Open("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	if err := entry.AddPiece(ap.host, ap.chunkIndex, ap.pieceIndex, ap.root); err != nil {
+		t.Fatal(err)
+	}
+	failures := func() int {
+		r.staticAuditor.mu.Lock()
+		defer r.staticAuditor.mu.Unlock()
+		if failed, exists := r.staticAuditor.failures[ap.id()]; exists {
+			return failed.failures
+		}
+		return 0
+	}
+	numPieces := func() int {
+		pieces, err := entry.Pieces(ap.chunkIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(pieces[ap.pieceIndex])
+	}
+	audit := func(err error, n int) {
+		ac.err = err
+		for i := 0; i < n; i++ {
+			if !r.managedAuditPiece(ap) {
+				t.Fatal("audits were stopped")
+			}
+		}
+	}
+
+	// Audits failing for other reasons aren't counted.
+	audit(errors.New("i/o timeout"), auditMaxFailures)
+	if failures() != 0 || numPieces() != 1 {
+		t.Fatal("skipped audits were counted", failures(), numPieces())
+	}
+
+	// Failed audits are counted until an audit succeeds.
+	audit(&modules.RPCError{Description: modules.ErrSectorNotFound.Error()}, auditMaxFailures-1)
+	if failures() != auditMaxFailures-1 || numPieces() != 1 {
+		t.Fatal("failed audits weren't counted", failures(), numPieces())
+	}
+	audit(nil, 1)
+	if failures() != 0 {
+		t.Fatal("failures weren't reset", failures())
+	}
+
+	// The piece is removed once enough consecutive audits failed.
+	audit(proto.ErrBadSectorData, auditMaxFailures-1)
+	audit(errors.New("i/o timeout"), 1)
+	if numPieces() != 1 {
+		t.Fatal("piece was removed too early")
+	}
+	audit(proto.ErrBadSectorData, 1)
+	if failures() != 0 || numPieces() != 0 {
+		t.Fatal("lost piece wasn't removed", failures(), numPieces())
+	}
+}
@@ -0,0 +1,772 @@
+package renter
+
+// Metadata backups let a renter that has lost its disk recover everything it
+// needs from its wallet seed alone. Periodically, the renter archives its
+// siafile tree together with its contracts and allowance, encrypts the
+// archive sector by sector with a key derived from the seed, and uploads the
+// sectors to a few of its hosts. An index listing the most recent backups,
+// and the contracts needed to download them, is encrypted with the same key
+// and stored on every host the renter has a contract with, under a public
+// key that is also derived from the seed.
+//
+// To restore, the renter derives the index key from the seed, asks the hosts
+// in its hostdb for the index, recovers the contracts holding the latest
+// backup, downloads and decrypts it, and then recovers the backed-up
+// contracts and writes back the siafile tree.
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/encoding"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/proto"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+const (
+	// backupAllowanceName is the name of the archive entry holding the
+	// renter's allowance.
+	backupAllowanceName = "allowance"
+
+	// backupContractsDir is the archive directory holding one entry per
+	// contract.
+	backupContractsDir = "contracts/"
+
+	// backupFilesDir is the archive directory holding the siafile tree.
+	backupFilesDir = "files/"
+
+	// backupIndexFetchThreads is the number of hosts that are queried for
+	// the backup index in parallel.
+	backupIndexFetchThreads = 10
+)
+
+var (
+	// backupKeySpecifier is used to derive the key that encrypts backups and
+	// the backup index from the wallet seed.
+	backupKeySpecifier = types.Specifier{'b', 'a', 'c', 'k', 'u', 'p', 'K', 'e', 'y'}
+
+	// backupIndexSpecifier is used to derive the key pair that identifies
+	// and signs the backup index from the wallet seed.
+	backupIndexSpecifier = types.Specifier{'b', 'a', 'c', 'k', 'u', 'p', 'I', 'n', 'd', 'e', 'x'}
+)
+
+var (
+	// errNoBackups is returned when none of the hosts store a backup index
+	// for the seed.
+	errNoBackups = errors.New("no backups were found on any host")
+
+	// errNoBackupHosts is returned when a backup cannot be uploaded because
+	// there are no usable contracts.
+	errNoBackupHosts = errors.New("no hosts are available to store the backup")
+)
+
+type (
+	// backupIndex lists the most recent metadata backups, oldest first.
+	backupIndex struct {
+		Backups []backupIndexEntry
+	}
+
+	// backupIndexEntry describes a single backup: the size of the archive,
+	// the Merkle roots of the sectors holding the encrypted archive, and the
+	// contracts that the sectors were uploaded under. The contracts are
+	// stored without their roots; they are only needed to pay for
+	// downloading the backup.
+	backupIndexEntry struct {
+		CreationDate types.Timestamp
+		Size         uint64
+		Roots        []crypto.Hash
+		Contracts    []proto.ContractBackup
+	}
+
+	// backupWriter encrypts the archive written to it into sectors. Every
+	// sector holds the ciphertext of the same amount of plaintext, padded
+	// with zeros, so that the sectors can be uploaded and decrypted one by
+	// one.
+	backupWriter struct {
+		key     crypto.CipherKey
+		w       io.Writer
+		buf     []byte
+		size    uint64
+		sectors uint64
+	}
+
+	// backupKeys are the keys derived from the wallet seed.
+	backupKeys struct {
+		cipherKey crypto.CipherKey
+		indexSK   crypto.SecretKey
+		indexPK   crypto.PublicKey
+	}
+)
+
+// deriveBackupKeys derives the backup keys from a wallet seed.
+func deriveBackupKeys(seed modules.Seed) backupKeys {
+	entropy := crypto.HashAll(seed, backupKeySpecifier)
+	cipherKey, err := crypto.NewSiaKey(crypto.TypeTwofish, entropy[:])
+	if err != nil {
+		build.Critical("unable to derive backup key:", err)
+	}
+	sk, pk := crypto.GenerateKeyPairDeterministic(crypto.HashAll(seed, backupIndexSpecifier))
+	return backupKeys{
+		cipherKey: cipherKey,
+		indexSK:   sk,
+		indexPK:   pk,
+	}
+}
+
+// info returns the BackupInfo describing the entry.
+func (e backupIndexEntry) info() modules.BackupInfo {
+	bi := modules.BackupInfo{
+		CreationDate: e.CreationDate,
+		Size:         e.Size,
+	}
+	for _, cb := range e.Contracts {
+		bi.Hosts = append(bi.Hosts, cb.HostPublicKey())
+	}
+	return bi
+}
+
+// newBackupWriter returns a backupWriter that writes the encrypted sectors
+// to w.
+func newBackupWriter(key crypto.CipherKey, w io.Writer) *backupWriter {
+	return &backupWriter{
+		key: key,
+		w:   w,
+		buf: make([]byte, 0, backupSectorPlaintext(key)),
+	}
+}
+
+// backupSectorPlaintext returns the amount of plaintext that is encrypted into
+// a single backup sector.
+func backupSectorPlaintext(key crypto.CipherKey) uint64 {
+	return modules.SectorSize - key.Type().Overhead()
+}
+
+// Write implements io.Writer.
+func (bw *backupWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		copied := copy(bw.buf[len(bw.buf):cap(bw.buf)], p)
+		bw.buf = bw.buf[:len(bw.buf)+copied]
+		p = p[copied:]
+		if len(bw.buf) == cap(bw.buf) {
+			if err := bw.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	bw.size += uint64(n)
+	return n, nil
+}
+
+// flush encrypts the buffered plaintext into a sector.
+func (bw *backupWriter) flush() error {
+	plaintext := bw.buf[:cap(bw.buf)]
+	for i := len(bw.buf); i < len(plaintext); i++ {
+		plaintext[i] = 0
+	}
+	bw.buf = bw.buf[:0]
+	bw.sectors++
+	_, err := bw.w.Write(bw.key.EncryptBytes(plaintext))
+	return err
+}
+
+// Close encrypts the remaining plaintext into the last sector.
+func (bw *backupWriter) Close() error {
+	if len(bw.buf) == 0 {
+		return nil
+	}
+	return bw.flush()
+}
+
+// managedSeed returns the primary seed of the renter's wallet.
+func (r *Renter) managedSeed() (modules.Seed, error) {
+	if r.wallet == nil {
+		return modules.Seed{}, errors.New("renter has no wallet")
+	}
+	seed, _, err := r.wallet.PrimarySeed()
+	if err != nil {
+		return modules.Seed{}, errors.AddContext(err, "unable to get the wallet seed")
+	}
+	return seed, nil
+}
+
+// managedFetchBackupIndex asks each of the hosts for the backup index stored
+// under the keys' index public key, and returns the most recent revision that
+// decrypts correctly.
+func (r *Renter) managedFetchBackupIndex(keys backupKeys, hosts []modules.HostDBEntry) (backupIndex, uint64, error) {
+	var index backupIndex
+	var revision uint64
+	var found bool
+	var mu sync.Mutex
+
+	hostChan := make(chan modules.HostDBEntry)
+	var wg sync.WaitGroup
+	for i := 0; i < backupIndexFetchThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range hostChan {
+				resp, err := r.hostContractor.FetchBackupIndex(host, keys.indexPK, r.tg.StopChan())
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				newer := !found || resp.Revision > revision
+				mu.Unlock()
+				if !newer {
+					continue
+				}
+				plaintext, err := keys.cipherKey.DecryptBytes(resp.Index)
+				if err != nil {
+					r.log.Debugln("WARN: host", host.PublicKey, "returned a backup index that cannot be decrypted:", err)
+					continue
+				}
+				var hostIndex backupIndex
+				if err := encoding.Unmarshal(plaintext, &hostIndex); err != nil {
+					r.log.Debugln("WARN: host", host.PublicKey, "returned an invalid backup index:", err)
+					continue
+				}
+				mu.Lock()
+				if !found || resp.Revision > revision {
+					index, revision, found = hostIndex, resp.Revision, true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, host := range hosts {
+		select {
+		case hostChan <- host:
+		case <-r.tg.StopChan():
+		}
+	}
+	close(hostChan)
+	wg.Wait()
+
+	if !found {
+		return backupIndex{}, 0, errNoBackups
+	}
+	return index, revision, nil
+}
+
+// managedContractHosts returns the hostdb entries of the hosts that the
+// renter has contracts with.
+func (r *Renter) managedContractHosts() []modules.HostDBEntry {
+	var hosts []modules.HostDBEntry
+	for _, c := range r.hostContractor.Contracts() {
+		host, ok := r.hostDB.Host(c.HostPublicKey)
+		if ok {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// managedArchiveMetadata writes a gzipped tar archive of the renter's
+// allowance, contracts and siafile tree to w. The siafiles are read through
+// the file set while their locks are held, so that each of them is archived
+// in a consistent state.
+func (r *Renter) managedArchiveMetadata(w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	writeEntry := func(name string, data []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+
+	// Archive the allowance and the contracts.
+	if err := writeEntry(backupAllowanceName, encoding.Marshal(r.hostContractor.Allowance())); err != nil {
+		return err
+	}
+	contracts, err := r.hostContractor.ContractBackups()
+	if err != nil {
+		return errors.AddContext(err, "unable to back up contracts")
+	}
+	for _, cb := range contracts {
+		if err := writeEntry(backupContractsDir+cb.ID().String(), encoding.Marshal(cb)); err != nil {
+			return err
+		}
+	}
+
+	// Archive the siafile tree. Files that are deleted while walking the
+	// tree are skipped.
+	err = filepath.Walk(r.filesDir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(r.filesDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		var data []byte
+		switch {
+		case filepath.Ext(path) == siafile.ShareExtension:
+			entry, err := r.staticFileSet.Open(strings.TrimSuffix(rel, siafile.ShareExtension))
+			if err == siafile.ErrUnknownPath {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			data, err = entry.Bytes()
+			if err := errors.Compose(err, entry.Close()); err != nil {
+				return err
+			}
+		case info.Name() == SiaDirMetadata:
+			r.siaDirMu.Lock()
+			data, err = ioutil.ReadFile(path)
+			r.siaDirMu.Unlock()
+		default:
+			data, err = ioutil.ReadFile(path)
+		}
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return writeEntry(backupFilesDir+rel, data)
+	})
+	if err != nil {
+		return errors.AddContext(err, "unable to back up the siafile tree")
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// managedUploadBackup uploads the sectors of a backup, which are read from f
+// one at a time, to the host and returns their Merkle roots.
+func (r *Renter) managedUploadBackup(pk types.SiaPublicKey, f io.ReaderAt, numSectors uint64) ([]crypto.Hash, error) {
+	e, err := r.hostContractor.Editor(pk, r.tg.StopChan())
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+	roots := make([]crypto.Hash, 0, numSectors)
+	sector := make([]byte, modules.SectorSize)
+	for i := uint64(0); i < numSectors; i++ {
+		if _, err := f.ReadAt(sector, int64(i*modules.SectorSize)); err != nil {
+			return nil, err
+		}
+		root, err := e.Upload(sector)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+// managedDownloadBackup downloads the sectors of a backup from the host,
+// decrypts them and writes the archive to w.
+func (r *Renter) managedDownloadBackup(pk types.SiaPublicKey, key crypto.CipherKey, entry backupIndexEntry, w io.Writer) error {
+	d, err := r.hostContractor.Downloader(pk, r.tg.StopChan())
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	remaining := entry.Size
+	for _, root := range entry.Roots {
+		sector, err := d.Download(root, 0, uint32(modules.SectorSize))
+		if err != nil {
+			return err
+		}
+		plaintext, err := key.DecryptBytes(sector)
+		if err != nil {
+			return errors.AddContext(err, "unable to decrypt backup")
+		}
+		if uint64(len(plaintext)) > remaining {
+			plaintext = plaintext[:remaining]
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			return err
+		}
+		remaining -= uint64(len(plaintext))
+	}
+	if remaining > 0 {
+		return errors.New("backup is shorter than expected")
+	}
+	return nil
+}
+
+// CreateBackup uploads an encrypted backup of the renter's siafile tree,
+// contracts and allowance to its hosts, and updates the backup index stored
+// on each host. The keys are derived from the wallet's primary seed, so the
+// wallet must be unlocked.
+func (r *Renter) CreateBackup() error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	r.backupMu.Lock()
+	defer r.backupMu.Unlock()
+
+	seed, err := r.managedSeed()
+	if err != nil {
+		return err
+	}
+	keys := deriveBackupKeys(seed)
+
+	// Fetch the current index so that the new backup can be appended to it.
+	hosts := r.managedContractHosts()
+	index, _, err := r.managedFetchBackupIndex(keys, hosts)
+	if err != nil && err != errNoBackups {
+		return err
+	}
+
+	// Archive the metadata and encrypt it into sectors, which are kept in a
+	// temporary file until they are uploaded.
+	f, err := ioutil.TempFile(r.persistDir, "backup")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	bw := newBackupWriter(keys.cipherKey, f)
+	if err := r.managedArchiveMetadata(bw); err != nil {
+		return err
+	}
+	if err := bw.Close(); err != nil {
+		return err
+	}
+	entry := backupIndexEntry{
+		CreationDate: types.CurrentTimestamp(),
+		Size:         bw.size,
+	}
+
+	// Upload the sectors to a random selection of hosts that are good for
+	// upload.
+	var candidates []modules.RenterContract
+	for _, c := range r.hostContractor.Contracts() {
+		if c.Utility.GoodForUpload {
+			candidates = append(candidates, c)
+		}
+	}
+	var holders []types.FileContractID
+	for _, i := range fastrand.Perm(len(candidates)) {
+		if len(holders) >= backupHosts {
+			break
+		}
+		c := candidates[i]
+		roots, err := r.managedUploadBackup(c.HostPublicKey, f, bw.sectors)
+		if err != nil {
+			r.log.Println("WARN: unable to upload backup to host", c.HostPublicKey, err)
+			continue
+		}
+		if entry.Roots == nil {
+			entry.Roots = roots
+		} else if !reflect.DeepEqual(entry.Roots, roots) {
+			build.Critical("backup sectors have different roots on different hosts")
+			continue
+		}
+		// The upload may have renewed or replaced the contract, so look it up
+		// again.
+		if c, ok := r.hostContractor.ContractByPublicKey(c.HostPublicKey); ok {
+			holders = append(holders, c.ID)
+		}
+	}
+	if len(holders) == 0 {
+		return errNoBackupHosts
+	}
+	contracts, err := r.hostContractor.ContractBackups()
+	if err != nil {
+		return err
+	}
+	for _, cb := range contracts {
+		for _, id := range holders {
+			if cb.ID() == id {
+				entry.Contracts = append(entry.Contracts, cb.WithoutRoots())
+			}
+		}
+	}
+
+	// Append the entry to the index, dropping the oldest backups if there
+	// are too many of them or the index would grow too large.
+	index.Backups = append(index.Backups, entry)
+	if len(index.Backups) > backupsKept {
+		index.Backups = index.Backups[len(index.Backups)-backupsKept:]
+	}
+	indexCiphertext := keys.cipherKey.EncryptBytes(encoding.Marshal(index))
+	for len(indexCiphertext) > modules.MaxBackupIndexSize && len(index.Backups) > 1 {
+		index.Backups = index.Backups[1:]
+		indexCiphertext = keys.cipherKey.EncryptBytes(encoding.Marshal(index))
+	}
+	if len(indexCiphertext) > modules.MaxBackupIndexSize {
+		return errors.New("backup index is too large")
+	}
+
+	// Store the index on every host we have a contract with. The revision
+	// only needs to increase, so the current time is used.
+	revision := uint64(time.Now().UnixNano())
+	req := modules.LoopSetBackupIndexRequest{
+		PublicKey: keys.indexPK,
+		Index:     indexCiphertext,
+		Revision:  revision,
+	}
+	sig := crypto.SignHash(modules.BackupIndexHash(req.PublicKey, req.Index, req.Revision), keys.indexSK)
+	req.Signature = sig[:]
+	var stored int
+	for _, c := range r.hostContractor.Contracts() {
+		if err := r.hostContractor.SetBackupIndex(c.HostPublicKey, req, r.tg.StopChan()); err != nil {
+			r.log.Debugln("WARN: unable to store backup index on host", c.HostPublicKey, err)
+			continue
+		}
+		stored++
+	}
+	if stored == 0 {
+		return errors.New("unable to store the backup index on any host")
+	}
+	r.log.Printf("Uploaded a %v byte backup to %v hosts and stored the index on %v hosts", entry.Size, len(holders), stored)
+	return nil
+}
+
+// Backups returns the backups listed in the backup index of the wallet's
+// primary seed, oldest first.
+func (r *Renter) Backups() ([]modules.BackupInfo, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+
+	seed, err := r.managedSeed()
+	if err != nil {
+		return nil, err
+	}
+	hosts := r.managedContractHosts()
+	if len(hosts) == 0 {
+		hosts = r.hostDB.ActiveHosts()
+	}
+	index, _, err := r.managedFetchBackupIndex(deriveBackupKeys(seed), hosts)
+	if err == errNoBackups {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	infos := make([]modules.BackupInfo, 0, len(index.Backups))
+	for _, e := range index.Backups {
+		infos = append(infos, e.info())
+	}
+	return infos, nil
+}
+
+// RestoreBackup finds the most recent backup made with the given seed,
+// downloads it and restores it. The backed-up contracts are recovered, the
+// allowance is restored if none is set, and siafiles that do not exist
+// locally are written back to the siafile tree.
+func (r *Renter) RestoreBackup(seed modules.Seed) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	r.backupMu.Lock()
+	defer r.backupMu.Unlock()
+
+	keys := deriveBackupKeys(seed)
+	index, _, err := r.managedFetchBackupIndex(keys, r.hostDB.ActiveHosts())
+	if err != nil {
+		return err
+	}
+	if len(index.Backups) == 0 {
+		return errNoBackups
+	}
+	entry := index.Backups[len(index.Backups)-1]
+
+	// Download the backup from one of the hosts holding it, recovering the
+	// contract with the host if necessary. Contracts recovered here are
+	// recovered without their roots, so they are replaced by the backed-up
+	// copies below.
+	// The archive is kept in a temporary file until it is restored.
+	f, err := ioutil.TempFile(r.persistDir, "restore")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	recovered := make(map[types.FileContractID]bool)
+	downloaded := false
+	for _, cb := range entry.Contracts {
+		if _, ok := r.hostContractor.ContractByPublicKey(cb.HostPublicKey()); !ok {
+			if _, err := r.hostContractor.RecoverContract(cb, r.tg.StopChan()); err != nil {
+				r.log.Println("WARN: unable to recover backup contract with host", cb.HostPublicKey(), err)
+				continue
+			}
+			recovered[cb.ID()] = true
+		}
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		err = r.managedDownloadBackup(cb.HostPublicKey(), keys.cipherKey, entry, f)
+		if err == nil {
+			downloaded = true
+			break
+		}
+		r.log.Println("WARN: unable to download backup from host", cb.HostPublicKey(), err)
+	}
+	if !downloaded {
+		return errors.New("unable to download the backup from any host")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return r.managedRestoreArchive(f, recovered)
+}
+
+// managedRestoreArchive restores the contents of a backup archive. Contracts
+// are only recovered if the renter has no contract with the host yet, or if
+// the contract was recovered without its roots while restoring.
+func (r *Renter) managedRestoreArchive(archive io.Reader, recovered map[types.FileContractID]bool) error {
+	gr, err := gzip.NewReader(archive)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gr)
+	var allowance modules.Allowance
+	var contracts, files int
+	dirs := make(map[string]struct{})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case hdr.Name == backupAllowanceName:
+			if err := encoding.Unmarshal(data, &allowance); err != nil {
+				return errors.AddContext(err, "unable to decode allowance")
+			}
+
+		case strings.HasPrefix(hdr.Name, backupContractsDir):
+			var cb proto.ContractBackup
+			if err := encoding.Unmarshal(data, &cb); err != nil {
+				return errors.AddContext(err, "unable to decode contract")
+			}
+			if c, ok := r.hostContractor.ContractByPublicKey(cb.HostPublicKey()); ok && (c.ID != cb.ID() || !recovered[c.ID]) {
+				continue
+			}
+			if _, err := r.hostContractor.RecoverContract(cb, r.tg.StopChan()); err != nil {
+				r.log.Println("WARN: unable to recover contract", cb.ID(), err)
+				continue
+			}
+			contracts++
+
+		case strings.HasPrefix(hdr.Name, backupFilesDir):
+			rel := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(hdr.Name, backupFilesDir)))
+			if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return errors.New("backup contains an invalid path: " + hdr.Name)
+			}
+			path := filepath.Join(r.filesDir, rel)
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if os.IsExist(err) {
+				// Never overwrite local metadata.
+				continue
+			} else if err != nil {
+				return err
+			}
+			_, err = f.Write(data)
+			if err = errors.Compose(err, f.Sync(), f.Close()); err != nil {
+				return err
+			}
+			files++
+			if filepath.Ext(rel) == siafile.ShareExtension {
+				dirs[dirSiaPath(filepath.ToSlash(rel))] = struct{}{}
+			}
+		}
+	}
+
+	// Update the metadata of the directories of the restored files.
+	for dir := range dirs {
+		if err := r.managedUpdateDirHealth(dir); err != nil {
+			r.log.Println("WARN: unable to update the directory", dir, err)
+		}
+	}
+
+	// Restore the allowance if none is set, which allows the contractor to
+	// form new contracts to replace the ones that could not be recovered.
+	if reflect.DeepEqual(r.hostContractor.Allowance(), modules.Allowance{}) && !reflect.DeepEqual(allowance, modules.Allowance{}) {
+		if err := r.hostContractor.SetAllowance(allowance); err != nil {
+			r.log.Println("WARN: unable to restore allowance:", err)
+		}
+	}
+	r.managedUpdateWorkerPool()
+	r.log.Printf("Restored %v contracts and %v metadata files from backup", contracts, files)
+	return nil
+}
+
+// threadedBackupLoop periodically uploads a backup of the renter's metadata
+// to its hosts.
+func (r *Renter) threadedBackupLoop() {
+	err := r.tg.Add()
+	if err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	for {
+		select {
+		case <-time.After(backupInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+
+		// Backups need the wallet seed and at least one contract.
+		if r.wallet == nil {
+			continue
+		} else if unlocked, err := r.wallet.Unlocked(); err != nil || !unlocked {
+			continue
+		} else if len(r.hostContractor.Contracts()) == 0 {
+			continue
+		}
+		if err := r.CreateBackup(); err != nil {
+			r.log.Println("WARN: unable to back up renter metadata:", err)
+		}
+	}
+}
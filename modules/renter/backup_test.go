@@ -0,0 +1,404 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/contractor"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/proto"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// dependencyDisableBackgroundLoops keeps the renter from starting the repair
+// loops and the backup loop.
+type dependencyDisableBackgroundLoops struct {
+	modules.ProductionDependencies
+}
+
+// Disrupt returns true if the correct string is provided.
+func (*dependencyDisableBackgroundLoops) Disrupt(s string) bool {
+	return s == "DisableRepairLoops" || s == "DisableBackupLoop" || s == "DisablePackLoop"
+}
+
+// backupHostDB is a hostDB that only knows the hosts of a backupContractor.
+type backupHostDB struct {
+	hostDB
+	hosts []modules.HostDBEntry
+}
+
+// ActiveHosts returns the hosts of the hostdb.
+func (hdb *backupHostDB) ActiveHosts() []modules.HostDBEntry {
+	return hdb.hosts
+}
+
+// Host returns the host with the public key.
+func (hdb *backupHostDB) Host(pk types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	for _, host := range hdb.hosts {
+		if host.PublicKey.String() == pk.String() {
+			return host, true
+		}
+	}
+	return modules.HostDBEntry{}, false
+}
+
+// backupContractor is a hostContractor whose contracts are kept in a contract
+// set of the test and whose hosts store the uploaded sectors and the backup
+// indices in memory.
+type backupContractor struct {
+	hostContractor
+	allowance modules.Allowance
+	cs        *proto.ContractSet
+	indices   map[crypto.PublicKey]modules.LoopBackupIndexResponse
+	recovered []proto.ContractBackup
+	sectors   map[crypto.Hash][]byte
+	mu        sync.Mutex
+}
+
+// backupEditor uploads sectors to the hosts of a backupContractor.
+type backupEditor struct {
+	contractor.Editor
+	bc *backupContractor
+}
+
+// Upload stores the sector.
+func (e *backupEditor) Upload(data []byte) (crypto.Hash, error) {
+	e.bc.mu.Lock()
+	defer e.bc.mu.Unlock()
+	root := crypto.MerkleRoot(data)
+	e.bc.sectors[root] = append([]byte(nil), data...)
+	return root, nil
+}
+
+// Close implements contractor.Editor.
+func (e *backupEditor) Close() error { return nil }
+
+// backupDownloader downloads sectors from the hosts of a backupContractor.
+type backupDownloader struct {
+	bc *backupContractor
+}
+
+// Download returns the requested part of the sector.
+func (d *backupDownloader) Download(root crypto.Hash, offset, length uint32) ([]byte, error) {
+	d.bc.mu.Lock()
+	defer d.bc.mu.Unlock()
+	sector, ok := d.bc.sectors[root]
+	if !ok {
+		return nil, errors.New("unknown sector")
+	}
+	return append([]byte(nil), sector[offset:offset+length]...), nil
+}
+
+// Close implements contractor.Downloader.
+func (d *backupDownloader) Close() error { return nil }
+
+// The methods below implement the parts of the hostContractor interface that
+// are used by backups.
+func (bc *backupContractor) Allowance() modules.Allowance {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.allowance
+}
+
+func (bc *backupContractor) SetAllowance(a modules.Allowance) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.allowance = a
+	return nil
+}
+
+func (bc *backupContractor) Contracts() []modules.RenterContract {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	contracts := bc.cs.ViewAll()
+	for i := range contracts {
+		contracts[i].Utility.GoodForUpload = true
+	}
+	return contracts
+}
+
+func (bc *backupContractor) ContractByPublicKey(pk types.SiaPublicKey) (modules.RenterContract, bool) {
+	for _, c := range bc.Contracts() {
+		if c.HostPublicKey.String() == pk.String() {
+			return c, true
+		}
+	}
+	return modules.RenterContract{}, false
+}
+
+func (bc *backupContractor) ContractBackups() ([]proto.ContractBackup, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.cs.Backup()
+}
+
+func (bc *backupContractor) Editor(types.SiaPublicKey, <-chan struct{}) (contractor.Editor, error) {
+	return &backupEditor{bc: bc}, nil
+}
+
+func (bc *backupContractor) Downloader(types.SiaPublicKey, <-chan struct{}) (contractor.Downloader, error) {
+	return &backupDownloader{bc: bc}, nil
+}
+
+func (bc *backupContractor) FetchBackupIndex(_ modules.HostDBEntry, pk crypto.PublicKey, _ <-chan struct{}) (modules.LoopBackupIndexResponse, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	index, ok := bc.indices[pk]
+	if !ok {
+		return modules.LoopBackupIndexResponse{}, errors.New("no backup index")
+	}
+	return index, nil
+}
+
+func (bc *backupContractor) SetBackupIndex(_ types.SiaPublicKey, req modules.LoopSetBackupIndexRequest, _ <-chan struct{}) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.indices[req.PublicKey] = modules.LoopBackupIndexResponse{
+		Index:    req.Index,
+		Revision: req.Revision,
+	}
+	return nil
+}
+
+func (bc *backupContractor) RecoverContract(cb proto.ContractBackup, _ <-chan struct{}) (modules.RenterContract, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.recovered = append(bc.recovered, cb)
+	return modules.RenterContract{ID: cb.ID(), HostPublicKey: cb.HostPublicKey()}, nil
+}
+
+// addContract adds a contract with a new host to the contract set of the
+// contractor and returns the host.
+func (bc *backupContractor) addContract(roots []crypto.Hash) (modules.HostDBEntry, error) {
+	_, pk := crypto.GenerateKeyPair()
+	var host modules.HostDBEntry
+	host.PublicKey = types.Ed25519PublicKey(pk)
+	var id types.FileContractID
+	fastrand.Read(id[:])
+	err := bc.cs.ConvertV130Contract(proto.V130Contract{
+		LastRevisionTxn: types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{{
+				ParentID:             id,
+				UnlockConditions:     types.UnlockConditions{PublicKeys: []types.SiaPublicKey{{}, host.PublicKey}},
+				NewValidProofOutputs: []types.SiacoinOutput{{}, {}},
+			}},
+		},
+		MerkleRoots: roots,
+	}, proto.V130CachedRevision{})
+	return host, err
+}
+
+// newBackupTester creates a renter tester whose renter uses a backupContractor
+// with two contracts.
+func newBackupTester(name string) (*renterTester, *backupContractor, error) {
+	rt, err := newRenterTesterWithDependency(name, &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		return nil, nil, err
+	}
+	cs, err := proto.NewContractSet(filepath.Join(rt.dir, "contracts"), modules.ProdDependencies)
+	if err != nil {
+		return nil, nil, err
+	}
+	bc := &backupContractor{
+		hostContractor: rt.renter.hostContractor,
+		allowance:      modules.Allowance{Hosts: 2, Period: 100},
+		cs:             cs,
+		indices:        make(map[crypto.PublicKey]modules.LoopBackupIndexResponse),
+		sectors:        make(map[crypto.Hash][]byte),
+	}
+	hdb := &backupHostDB{hostDB: rt.renter.hostDB}
+	for i := 0; i < 2; i++ {
+		host, err := bc.addContract([]crypto.Hash{{byte(i)}})
+		if err != nil {
+			return nil, nil, err
+		}
+		hdb.hosts = append(hdb.hosts, host)
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.hostContractor = bc
+	rt.renter.hostDB = hdb
+	rt.renter.mu.Unlock(id)
+	return rt, bc, nil
+}
+
+// TestDeriveBackupKeys checks that the backup keys are derived
+// deterministically from the seed, and that different seeds yield different
+// keys.
+func TestDeriveBackupKeys(t *testing.T) {
+	var seed, otherSeed modules.Seed
+	fastrand.Read(seed[:])
+	fastrand.Read(otherSeed[:])
+
+	keys := deriveBackupKeys(seed)
+	again := deriveBackupKeys(seed)
+	other := deriveBackupKeys(otherSeed)
+	if keys.indexPK != again.indexPK || keys.indexSK != again.indexSK {
+		t.Fatal("index keys are not deterministic")
+	}
+	if keys.indexPK == other.indexPK {
+		t.Fatal("different seeds yield the same index key")
+	}
+
+	// A backup encrypted with one seed can only be decrypted with the same
+	// seed.
+	data := fastrand.Bytes(1000)
+	ciphertext := keys.cipherKey.EncryptBytes(data)
+	plaintext, err := again.cipherKey.DecryptBytes(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, data) {
+		t.Fatal("decrypted backup does not match")
+	}
+	if _, err := other.cipherKey.DecryptBytes(ciphertext); err == nil {
+		t.Fatal("backup was decrypted with the wrong seed")
+	}
+}
+
+// TestBackupWriter checks that the backupWriter encrypts archives into
+// sectors that can be decrypted one by one.
+func TestBackupWriter(t *testing.T) {
+	var seed modules.Seed
+	fastrand.Read(seed[:])
+	key := deriveBackupKeys(seed).cipherKey
+	plaintextSize := backupSectorPlaintext(key)
+	tests := []struct {
+		size    uint64
+		sectors uint64
+	}{
+		{0, 0},
+		{1, 1},
+		{plaintextSize, 1},
+		{plaintextSize + 1, 2},
+	}
+	for _, test := range tests {
+		data := fastrand.Bytes(int(test.size))
+		var buf bytes.Buffer
+		bw := newBackupWriter(key, &buf)
+		// Write the data in two parts to cover buffering.
+		if _, err := bw.Write(data[:test.size/2]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bw.Write(data[test.size/2:]); err != nil {
+			t.Fatal(err)
+		}
+		if err := bw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if bw.size != test.size || bw.sectors != test.sectors || uint64(buf.Len()) != test.sectors*modules.SectorSize {
+			t.Fatalf("size %v: expected %v sectors, got %v sectors and %v bytes", test.size, test.sectors, bw.sectors, buf.Len())
+		}
+		var archive []byte
+		for buf.Len() > 0 {
+			plaintext, err := key.DecryptBytes(buf.Next(int(modules.SectorSize)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			archive = append(archive, plaintext...)
+		}
+		if !bytes.Equal(archive[:test.size], data) {
+			t.Fatalf("size %v: decrypted archive does not match", test.size)
+		}
+	}
+}
+
+// TestBackupRoundTrip checks that a backup is uploaded to the hosts together
+// with its index, and that restoring it recovers the files and contracts of
+// the renter.
+func TestBackupRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, bc, err := newBackupTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+	if err := r.CreateDir("docs"); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]uint64{"docs/file": 1000, "file": 2000}
+	for siaPath, size := range files {
+		if err := r.newSizedTestFile(siaPath, size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	contracts, err := bc.ContractBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a backup.
+	if err := r.CreateBackup(); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.indices) != 1 || len(bc.sectors) == 0 {
+		t.Fatalf("expected an index and the backup sectors, got %v indices and %v sectors", len(bc.indices), len(bc.sectors))
+	}
+	backups, err := r.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatal("expected one backup, got", len(backups))
+	}
+
+	// Lose the files, the contracts and the allowance.
+	for siaPath := range files {
+		if err := r.DeleteFile(siaPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bc.mu.Lock()
+	bc.cs, err = proto.NewContractSet(filepath.Join(rt.dir, "lostcontracts"), modules.ProdDependencies)
+	bc.allowance = modules.Allowance{}
+	bc.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restore the backup.
+	seed, _, err := rt.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RestoreBackup(seed); err != nil {
+		t.Fatal(err)
+	}
+	for siaPath, size := range files {
+		entry, err := r.staticFileSet.Open(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Size() != size {
+			t.Errorf("%v: expected size %v, got %v", siaPath, size, entry.Size())
+		}
+		entry.Close()
+	}
+	dirs, _, err := r.DirList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirs[0].NumFiles != 2 {
+		t.Fatal("the restored files are not listed", dirs[0].NumFiles)
+	}
+	for _, cb := range contracts {
+		restored := false
+		for _, recovered := range bc.recovered {
+			restored = restored || (recovered.ID() == cb.ID() && reflect.DeepEqual(recovered.Roots, cb.Roots))
+		}
+		if !restored {
+			t.Error("contract wasn't recovered with its roots", cb.ID())
+		}
+	}
+	if !reflect.DeepEqual(bc.Allowance(), modules.Allowance{Hosts: 2, Period: 100}) {
+		t.Fatal("the allowance wasn't restored", bc.Allowance())
+	}
+}
@@ -0,0 +1,282 @@
+package renter
+
+// The checksum of a file's content is stored in its siafile. Every chunk gets
+// a checksum when its logical data is fetched for the first upload, and the
+// file's checksum is computed from them once every chunk has one. Downloads of
+// entire files are verified against the checksum, and VerifyFile downloads a
+// file only to verify it.
+//
+// Chunk checksums are computed from the chunk's data padded with zeros to the
+// chunk size. This matches the logical data of the last chunk of a file during
+// the upload, and allows computing the checksums of downloaded chunks
+// independently of each other.
+
+import (
+	"fmt"
+	"hash"
+	"sync"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/errors"
+)
+
+var (
+	// errChecksumMismatch is returned if the downloaded content of a file
+	// doesn't match its checksum.
+	errChecksumMismatch = errors.New("downloaded data doesn't match the checksum of the file")
+
+	// errNoChecksum is returned when verifying a file whose checksum is
+	// unknown, e.g. because it was uploaded before checksums were introduced.
+	errNoChecksum = errors.New("file doesn't have a checksum")
+)
+
+type (
+	// checksumWriter computes the checksum of a file that is written to it
+	// sequentially.
+	checksumWriter struct {
+		chunkSize      uint64
+		h              hash.Hash
+		n              uint64 // bytes written to the current chunk
+		size           uint64 // bytes written in total
+		chunkChecksums []crypto.Hash
+	}
+
+	// checksumDestination is a downloadDestination that computes the
+	// checksums of the chunks written to it before passing them on to the
+	// underlying destination. It expects every chunk to be written at once.
+	checksumDestination struct {
+		downloadDestination
+		chunkSize uint64
+
+		chunkChecksums map[uint64]crypto.Hash
+		misaligned     bool
+		mu             sync.Mutex
+	}
+
+	// discardDestination is a downloadDestination that discards all the data
+	// written to it.
+	discardDestination struct{}
+)
+
+// newChecksumWriter creates a checksumWriter for a file with the given chunk
+// size.
+func newChecksumWriter(chunkSize uint64) *checksumWriter {
+	return &checksumWriter{
+		chunkSize: chunkSize,
+		h:         crypto.NewHash(),
+	}
+}
+
+// Write implements the io.Writer interface.
+func (cw *checksumWriter) Write(b []byte) (int, error) {
+	written := len(b)
+	for len(b) > 0 {
+		n := cw.chunkSize - cw.n
+		if uint64(len(b)) < n {
+			n = uint64(len(b))
+		}
+		cw.h.Write(b[:n])
+		cw.n += n
+		cw.size += n
+		b = b[n:]
+		if cw.n == cw.chunkSize {
+			cw.finishChunk()
+		}
+	}
+	return written, nil
+}
+
+// finishChunk pads the current chunk with zeros and adds its checksum.
+func (cw *checksumWriter) finishChunk() {
+	writeZeros(cw.h, cw.chunkSize-cw.n)
+	var checksum crypto.Hash
+	cw.h.Sum(checksum[:0])
+	cw.chunkChecksums = append(cw.chunkChecksums, checksum)
+	cw.h.Reset()
+	cw.n = 0
+}
+
+// Checksums returns the checksum of the file that was written and the
+// checksums of its chunks. It must only be called once all the data was
+// written.
+func (cw *checksumWriter) Checksums() (crypto.Hash, []crypto.Hash) {
+	// Empty files still consist of a single chunk.
+	if cw.n > 0 || len(cw.chunkChecksums) == 0 {
+		cw.finishChunk()
+	}
+	return siafile.FileChecksum(cw.size, cw.chunkChecksums), cw.chunkChecksums
+}
+
+// writeZeros writes n zeros to h.
+func writeZeros(h hash.Hash, n uint64) {
+	var zeros [4096]byte
+	for n > 0 {
+		l := uint64(len(zeros))
+		if n < l {
+			l = n
+		}
+		h.Write(zeros[:l])
+		n -= l
+	}
+}
+
+// chunkChecksum computes the checksum of a chunk from its logical data.
+func chunkChecksum(logicalChunkData [][]byte) crypto.Hash {
+	h := crypto.NewHash()
+	for _, data := range logicalChunkData {
+		h.Write(data)
+	}
+	var checksum crypto.Hash
+	h.Sum(checksum[:0])
+	return checksum
+}
+
+// managedChecksumChunk sets the checksum of a chunk that is uploaded for the
+// first time. The chunk's logical data needs to be fetched already. Chunks
+// that already have pieces are skipped, since the local file they are read
+// from might have changed since they were uploaded.
+func (r *Renter) managedChecksumChunk(chunk *unfinishedUploadChunk) {
+	entry := chunk.fileEntry
+	if _, ok := entry.ChunkChecksum(chunk.index); ok {
+		return
+	}
+	pieces, err := entry.Pieces(chunk.index)
+	if err != nil {
+		return
+	}
+	for _, pieceSet := range pieces {
+		if len(pieceSet) > 0 {
+			return
+		}
+	}
+	if err := entry.SetChunkChecksum(chunk.index, chunkChecksum(chunk.logicalChunkData)); err != nil {
+		r.log.Debugln("WARN: could not set the checksum of a chunk:", err)
+	}
+}
+
+// newChecksumDestination wraps a downloadDestination in a checksumDestination.
+func newChecksumDestination(dst downloadDestination, chunkSize uint64) *checksumDestination {
+	return &checksumDestination{
+		downloadDestination: dst,
+		chunkSize:           chunkSize,
+		chunkChecksums:      make(map[uint64]crypto.Hash),
+	}
+}
+
+// WriteAt computes the checksum of the chunk that is written before writing
+// it to the underlying destination.
+func (cd *checksumDestination) WriteAt(data []byte, offset int64) (int, error) {
+	h := crypto.NewHash()
+	h.Write(data)
+	if uint64(len(data)) < cd.chunkSize {
+		writeZeros(h, cd.chunkSize-uint64(len(data)))
+	}
+	var checksum crypto.Hash
+	h.Sum(checksum[:0])
+
+	cd.mu.Lock()
+	if uint64(offset)%cd.chunkSize != 0 || uint64(len(data)) > cd.chunkSize {
+		cd.misaligned = true
+	}
+	cd.chunkChecksums[uint64(offset)/cd.chunkSize] = checksum
+	cd.mu.Unlock()
+	return cd.downloadDestination.WriteAt(data, offset)
+}
+
+// verify checks that the data written to the destination matches the
+// checksum of file.
+func (cd *checksumDestination) verify(file *siafile.Snapshot) error {
+	checksum, ok := file.Checksum()
+	if !ok {
+		return errNoChecksum
+	}
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	if cd.misaligned {
+		return errors.New("can't verify download since its chunks weren't written at once")
+	}
+
+	// Empty files still consist of a single chunk.
+	numChunks := (file.Size() + cd.chunkSize - 1) / cd.chunkSize
+	if numChunks == 0 {
+		numChunks = 1
+	}
+	chunkChecksums := make([]crypto.Hash, numChunks)
+	var corrupt []uint64
+	for i := range chunkChecksums {
+		downloaded, ok := cd.chunkChecksums[uint64(i)]
+		if !ok {
+			return fmt.Errorf("can't verify download since chunk %v wasn't written", i)
+		}
+		chunkChecksums[i] = downloaded
+		// The chunks of packed files are those of their pack.
+		if file.PackPath() != "" {
+			continue
+		}
+		if expected, ok := file.ChunkChecksum(uint64(i)); ok && expected != downloaded {
+			corrupt = append(corrupt, uint64(i))
+		}
+	}
+	if siafile.FileChecksum(file.Size(), chunkChecksums) == checksum {
+		return nil
+	}
+	if len(corrupt) > 0 {
+		return errors.AddContext(errChecksumMismatch, fmt.Sprintf("corrupt chunks %v", corrupt))
+	}
+	return errChecksumMismatch
+}
+
+// WriteAt implements the downloadDestination interface.
+func (discardDestination) WriteAt(data []byte, _ int64) (int, error) {
+	return len(data), nil
+}
+
+// VerifyFile downloads the file at siaPath and checks that its content matches
+// the checksum stored in its siafile. The downloaded data is discarded.
+func (r *Renter) VerifyFile(siaPath string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+
+	entry, err := r.staticFileSet.Open(siaPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	snap, err := r.managedSnapshot(entry)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Checksum(); !ok {
+		return errNoChecksum
+	}
+
+	dst := newChecksumDestination(discardDestination{}, snap.ChunkSize())
+	d, err := r.managedNewDownload(downloadParams{
+		destination:     dst,
+		destinationType: "verification",
+		file:            snap,
+
+		latencyTarget: 25e3 * time.Millisecond, // TODO: high default until full latency support is added.
+		length:        snap.Size(),
+		needsMemory:   true,
+		offset:        0,
+		overdrive:     3, // TODO: moderate default until full overdrive support is added.
+		priority:      5, // TODO: moderate default until full priority support is added.
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case <-d.completeChan:
+	case <-r.tg.StopChan():
+		return errors.New("verification interrupted by shutdown")
+	}
+	if err := d.Err(); err != nil {
+		return errors.AddContext(err, "failed to download file")
+	}
+	return dst.verify(snap)
+}
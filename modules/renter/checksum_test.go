@@ -0,0 +1,75 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// TestChecksumWriter tests that the checksumWriter and the
+// checksumDestination compute the same chunk checksums as the upload.
+func TestChecksumWriter(t *testing.T) {
+	pieceSize := uint64(64)
+	chunkSize := 2 * pieceSize
+	data := fastrand.Bytes(int(2*chunkSize + pieceSize/2))
+
+	// Compute the chunk checksums like the upload does, from the logical data
+	// padded with zeros.
+	var expected []crypto.Hash
+	for off := uint64(0); off < uint64(len(data)); off += chunkSize {
+		buf := NewDownloadDestinationBuffer(chunkSize, pieceSize)
+		end := off + chunkSize
+		if end > uint64(len(data)) {
+			end = uint64(len(data))
+		}
+		if _, err := buf.WriteAt(data[off:end], 0); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, chunkChecksum(buf.buf))
+	}
+
+	// Write the data in uneven slices.
+	cw := newChecksumWriter(chunkSize)
+	for b := data; len(b) > 0; {
+		n := fastrand.Intn(len(b)) + 1
+		cw.Write(b[:n])
+		b = b[n:]
+	}
+	_, chunkChecksums := cw.Checksums()
+	if len(chunkChecksums) != len(expected) {
+		t.Fatalf("expected %v chunk checksums but got %v", len(expected), len(chunkChecksums))
+	}
+	for i := range expected {
+		if chunkChecksums[i] != expected[i] {
+			t.Fatal("chunk checksum doesn't match", i)
+		}
+	}
+
+	// Write the chunks to a checksumDestination out of order.
+	cd := newChecksumDestination(discardDestination{}, chunkSize)
+	for i := len(expected) - 1; i >= 0; i-- {
+		off := uint64(i) * chunkSize
+		end := off + chunkSize
+		if end > uint64(len(data)) {
+			end = uint64(len(data))
+		}
+		if _, err := cd.WriteAt(data[off:end], int64(off)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range expected {
+		if cd.chunkChecksums[uint64(i)] != expected[i] {
+			t.Fatal("chunk checksum of destination doesn't match", i)
+		}
+	}
+	if cd.misaligned {
+		t.Fatal("chunks were written at chunk boundaries")
+	}
+
+	// Empty files consist of a single chunk of zeros.
+	_, chunkChecksums = newChecksumWriter(chunkSize).Checksums()
+	if len(chunkChecksums) != 1 || chunkChecksums[0] != chunkChecksum([][]byte{make([]byte, chunkSize)}) {
+		t.Fatal("unexpected checksum of empty file")
+	}
+}
@@ -48,6 +48,19 @@ var (
 )
 
 const (
+	// auditBudgetDivisor limits the amount that is spent on retrievability
+	// audits during a period to the allowance divided by auditBudgetDivisor.
+	auditBudgetDivisor = 100
+
+	// auditMaxFailures is the number of consecutive audits of a piece that
+	// need to fail before the piece is considered lost.
+	auditMaxFailures = 3
+
+	// backupsKept is the number of metadata backups that are listed in the
+	// backup index. Older backups are dropped from the index when a new one
+	// is created.
+	backupsKept = 3
+
 	// persistVersion defines the Sia version that the persistence was
 	// last updated
 	persistVersion = "1.3.3"
@@ -60,6 +73,28 @@ const (
 	// worker has experienced a download failure.
 	downloadFailureCooldown = time.Second * 3
 
+	// packCompactionThreshold is the fraction of a pack's data that needs to
+	// belong to files which still exist for the pack to be kept as is. Packs
+	// with less live data are compacted by moving their files into the open
+	// pack.
+	packCompactionThreshold = 0.5
+
+	// packDataDir is the directory within the renter's persist dir that holds
+	// the local data of packs until they are fully uploaded.
+	packDataDir = "packs"
+
+	// uploadDirs are the hidden directories that the S3 gateway and the
+	// WebDAV server upload files to before they replace the existing files.
+	uploadDirs = []string{modules.S3UploadDir, modules.WebDAVUploadDir}
+
+	// packDir is the hidden directory of the renter's file tree that holds
+	// the siafiles of packs.
+	packDir = ".packs"
+
+	// versionDir is the hidden directory of the renter's file tree that holds
+	// the old versions of versioned files.
+	versionDir = ".versions"
+
 	// memoryPriorityLow is used to request low priority memory
 	memoryPriorityLow = false
 
@@ -82,12 +117,55 @@ const (
 	// can set a custom MaxUploadSpeed through the API
 	DefaultMaxUploadSpeed = 0
 
+	// DefaultMaxMigrationSpeed is the default limit of the rate at which
+	// pieces are migrated away from hosts that are being dropped, in bytes
+	// per second. The user can set a custom MaxMigrationSpeed through the
+	// API, zero means no limit.
+	DefaultMaxMigrationSpeed = 1 << 20
+
+	// migrationMaxFailures is the number of consecutive failed piece
+	// migrations after which the migration from a host is paused until the
+	// next migration round.
+	migrationMaxFailures = 3
+
 	// PriceEstimationSafetyFactor is the factor of safety used in the price
 	// estimation to account for any missed costs
 	PriceEstimationSafetyFactor = 1.2
 )
 
 var (
+	// auditInterval defines how often the renter audits random pieces of its
+	// files.
+	auditInterval = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: 30 * time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	// auditSamples is the number of random pieces that are audited every
+	// auditInterval.
+	auditSamples = build.Select(build.Var{
+		Dev:      10,
+		Standard: 20,
+		Testing:  5,
+	}).(int)
+
+	// backupHosts is the number of hosts that each metadata backup is
+	// uploaded to.
+	backupHosts = build.Select(build.Var{
+		Dev:      1,
+		Standard: 3,
+		Testing:  1,
+	}).(int)
+
+	// backupInterval defines how often the renter uploads a backup of its
+	// metadata to its hosts.
+	backupInterval = build.Select(build.Var{
+		Dev:      10 * time.Minute,
+		Standard: 24 * time.Hour,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+
 	// chunkDownloadTimeout defines the maximum amount of time to wait for a
 	// chunk download to finish before returning in the download-to-upload repair
 	// loop
@@ -97,6 +175,30 @@ var (
 		Testing:  1 * time.Minute,
 	}).(time.Duration)
 
+	// dirHealthErrorCooldown is how long the renter waits before checking the
+	// health of a directory again after the check failed.
+	dirHealthErrorCooldown = build.Select(build.Var{
+		Dev:      10 * time.Second,
+		Standard: time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	// fileIndexSaveInterval defines how often the renter saves the changes to
+	// its file index.
+	fileIndexSaveInterval = build.Select(build.Var{
+		Dev:      30 * time.Second,
+		Standard: 2 * time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	// healthCheckInterval defines how often the renter checks the health of
+	// the files in each directory.
+	healthCheckInterval = build.Select(build.Var{
+		Dev:      5 * time.Minute,
+		Standard: time.Hour,
+		Testing:  5 * time.Second,
+	}).(time.Duration)
+
 	// maxConsecutivePenalty determines how many times the timeout/cooldown for
 	// being a bad host can be doubled before a maximum cooldown is reached.
 	maxConsecutivePenalty = build.Select(build.Var{
@@ -105,6 +207,23 @@ var (
 		Testing:  3,
 	}).(int)
 
+	// maxUploadHeapChunks is the number of chunks after which the renter stops
+	// adding chunks that need to be repaired to the upload heap. The remaining
+	// chunks are added the next time the heap is rebuilt.
+	maxUploadHeapChunks = build.Select(build.Var{
+		Dev:      1000,
+		Standard: 5000,
+		Testing:  100,
+	}).(int)
+
+	// maxPackedFileSize is the size up to which uploaded files are packed
+	// into shared chunks instead of getting chunks of their own.
+	maxPackedFileSize = build.Select(build.Var{
+		Dev:      uint64(1 << 14), // 16 KiB
+		Standard: uint64(1 << 20), // 1 MiB
+		Testing:  uint64(1 << 10), // 1 KiB
+	}).(uint64)
+
 	// maxScheduledDownloads specifies the number of chunks that can be downloaded
 	// for auto repair at once. If the limit is reached new ones will only be scheduled
 	// once old ones are scheduled for upload
@@ -122,6 +241,22 @@ var (
 		Testing:  250 * time.Millisecond,
 	}).(time.Duration)
 
+	// packMaintenanceInterval defines how often the renter seals stale packs,
+	// removes the local data of uploaded packs and compacts packs.
+	packMaintenanceInterval = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: 10 * time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	// packSealTimeout is the amount of time after which a pack that isn't
+	// full yet is sealed and uploaded anyway.
+	packSealTimeout = build.Select(build.Var{
+		Dev:      30 * time.Second,
+		Standard: 5 * time.Minute,
+		Testing:  2 * time.Second,
+	}).(time.Duration)
+
 	// rebuildChunkHeapInterval defines how long the renter sleeps between
 	// checking on the filesystem health.
 	rebuildChunkHeapInterval = build.Select(build.Var{
@@ -130,6 +265,70 @@ var (
 		Testing:  3 * time.Second,
 	}).(time.Duration)
 
+	// reencodeInterval defines how often the renter checks whether the new
+	// versions of re-encoded files are fully redundant.
+	reencodeInterval = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: 10 * time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	// syncRescanInterval defines how often sync jobs scan their local
+	// directory for changes that weren't reported by their watcher.
+	syncRescanInterval = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: 10 * time.Minute,
+		Testing:  3 * time.Second,
+	}).(time.Duration)
+
+	// syncSettleTime defines how long a local file needs to stay unmodified
+	// before a sync job uploads it.
+	syncSettleTime = build.Select(build.Var{
+		Dev:      2 * time.Second,
+		Standard: 5 * time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
+	// downloadEventInterval defines how often the renter reports the progress
+	// of a running download to its event subscribers.
+	downloadEventInterval = build.Select(build.Var{
+		Dev:      time.Second,
+		Standard: time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
+	// versionPruneInterval defines how often the renter expires the file
+	// versions according to their version policies.
+	versionPruneInterval = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: time.Hour,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	// migrationInterval defines how often the renter looks for pieces that
+	// need to be migrated away from hosts that are being dropped.
+	migrationInterval = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: 10 * time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	// stuckChunkMaxFailures is the number of repair attempts of a chunk that
+	// have to fail in a row before the chunk is marked as stuck.
+	stuckChunkMaxFailures = build.Select(build.Var{
+		Dev:      uint8(3),
+		Standard: uint8(3),
+		Testing:  uint8(2),
+	}).(uint8)
+
+	// stuckChunkRetryInterval defines how long the renter waits between
+	// attempts to repair the chunks that are stuck.
+	stuckChunkRetryInterval = build.Select(build.Var{
+		Dev:      5 * time.Minute,
+		Standard: time.Hour,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+
 	// RemoteRepairDownloadThreshold defines the threshold in percent under
 	// which the renter starts repairing a file that is not available on disk.
 	RemoteRepairDownloadThreshold = build.Select(build.Var{
@@ -0,0 +1,72 @@
+package contractor
+
+import (
+	"errors"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/proto"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+var (
+	// errContractEnded is returned when trying to recover a contract whose
+	// end height has already passed.
+	errContractEnded = errors.New("contract has already ended")
+
+	// errContractExists is returned when trying to recover a contract with a
+	// host that the contractor already has a different contract with.
+	errContractExists = errors.New("already have a contract with that host")
+)
+
+// ContractBackups returns a backup of every contract in the contract set.
+func (c *Contractor) ContractBackups() ([]proto.ContractBackup, error) {
+	return c.staticContracts.Backup()
+}
+
+// FetchBackupIndex retrieves the backup index stored under pk from a host. No
+// contract with the host is required.
+func (c *Contractor) FetchBackupIndex(host modules.HostDBEntry, pk crypto.PublicKey, cancel <-chan struct{}) (modules.LoopBackupIndexResponse, error) {
+	return c.staticContracts.FetchBackupIndex(host, pk, cancel)
+}
+
+// RecoverContract restores a backed-up contract into the contract set. A
+// contract with the same ID is replaced; recovering a contract with a host
+// that the contractor already has a different contract with is an error.
+func (c *Contractor) RecoverContract(cb proto.ContractBackup, cancel <-chan struct{}) (modules.RenterContract, error) {
+	c.mu.RLock()
+	id, exists := c.pubKeysToContractID[string(cb.HostPublicKey().Key)]
+	height := c.blockHeight
+	c.mu.RUnlock()
+	if exists && id != cb.ID() {
+		return modules.RenterContract{}, errContractExists
+	} else if height > cb.Header.EndHeight() {
+		return modules.RenterContract{}, errContractEnded
+	}
+	host, ok := c.hdb.Host(cb.HostPublicKey())
+	if !ok {
+		return modules.RenterContract{}, errors.New("no record of that host")
+	}
+
+	contract, err := c.staticContracts.RecoverContract(cb, host, c.hdb, cancel)
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	c.mu.Lock()
+	c.contractIDToPubKey[contract.ID] = contract.HostPublicKey
+	c.pubKeysToContractID[string(contract.HostPublicKey.Key)] = contract.ID
+	c.mu.Unlock()
+	c.log.Println("Recovered contract", contract.ID, "with host", contract.HostPublicKey)
+	return contract, nil
+}
+
+// SetBackupIndex stores a signed backup index on the host with the specified
+// public key, using the contract we have with that host.
+func (c *Contractor) SetBackupIndex(pk types.SiaPublicKey, req modules.LoopSetBackupIndexRequest, cancel <-chan struct{}) error {
+	s, err := c.Session(pk, cancel)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.SetBackupIndex(req)
+}
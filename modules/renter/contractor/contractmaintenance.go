@@ -371,6 +371,7 @@ func (c *Contractor) managedNewContract(host modules.HostDBEntry, contractFundin
 
 	contractValue := contract.RenterFunds
 	c.log.Printf("Formed contract %v with %v for %v", contract.ID, host.NetAddress, contractValue.HumanString())
+	c.managedNotifyContractEvent(modules.RenterEventContractFormed, contract, types.FileContractID{})
 	return contractFunding, contract, nil
 }
 
@@ -597,6 +598,7 @@ func (c *Contractor) managedRenewContract(renewInstructions fileContractRenewal,
 		return types.ZeroCurrency, errors.AddContext(errRenew, "contract renewal with host was unsuccessful")
 	}
 	c.log.Printf("Renewed contract %v\n", id)
+	c.managedNotifyContractEvent(modules.RenterEventContractRenewed, newContract, id)
 
 	// Update the utility values for the new contract, and for the old
 	// contract.
@@ -857,6 +859,13 @@ func (c *Contractor) threadedContractMaintenance() {
 		}
 	}
 
+	// Form the contracts that the contract sets of the host policies are
+	// missing. They count towards the contracts of the allowance.
+	fundsRemaining, interrupted := c.managedFormPolicyContracts(fundsRemaining, endHeight)
+	if interrupted {
+		return
+	}
+
 	// Count the number of contracts which are good for uploading, and then make
 	// more as needed to fill the gap.
 	uploadContracts := 0
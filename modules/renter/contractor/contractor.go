@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/HyperspaceApp/Hyperspace/modules"
 	"github.com/HyperspaceApp/Hyperspace/modules/renter/proto"
@@ -43,6 +44,18 @@ type Contractor struct {
 	currentPeriod types.BlockHeight
 	lastChange    modules.ConsensusChangeID
 
+	// hostPolicies maps the names of the host policies to the policies and
+	// policySets maps them to the host keys of the contracts in their
+	// contract sets. geoIP is the offline GeoIP database, it is nil if the
+	// renter doesn't have one.
+	hostPolicies map[string]modules.HostPolicy
+	policySets   map[string]map[string]struct{}
+	geoIP        *geoIPDatabase
+
+	// eventSubscribers are notified when contracts are formed, renewed or
+	// expire.
+	eventSubscribers []modules.RenterEventSubscriber
+
 	downloaders         map[types.FileContractID]*hostDownloader
 	editors             map[types.FileContractID]*hostEditor
 	sessions            map[types.FileContractID]*hostSession
@@ -150,6 +163,35 @@ func (c *Contractor) SetRateLimits(readBPS int64, writeBPS int64, packetSize uin
 	c.staticContracts.SetRateLimits(readBPS, writeBPS, packetSize)
 }
 
+// EventSubscribe adds a subscriber that will be notified when contracts are
+// formed, renewed or expire.
+func (c *Contractor) EventSubscribe(subscriber modules.RenterEventSubscriber) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.eventSubscribers = append(c.eventSubscribers, subscriber)
+}
+
+// managedNotifyContractEvent sends an event about contract to the event
+// subscribers.
+func (c *Contractor) managedNotifyContractEvent(eventType modules.RenterEventType, contract modules.RenterContract, renewedFrom types.FileContractID) {
+	event := modules.RenterEvent{
+		Type:        eventType,
+		Timestamp:   time.Now(),
+		ContractID:  contract.ID,
+		EndHeight:   contract.EndHeight,
+		RenewedFrom: renewedFrom,
+	}
+	if host, ok := c.hdb.Host(contract.HostPublicKey); ok {
+		event.NetAddress = host.NetAddress
+	}
+	c.mu.RLock()
+	subscribers := append([]modules.RenterEventSubscriber(nil), c.eventSubscribers...)
+	c.mu.RUnlock()
+	for _, subscriber := range subscribers {
+		subscriber.ReceiveRenterEvent(event)
+	}
+}
+
 // Close closes the Contractor.
 func (c *Contractor) Close() error {
 	return c.tg.Stop()
@@ -190,8 +232,21 @@ func New(cs consensusSet, wallet walletShim, tpool transactionPool, hdb hostDB,
 		return nil, err
 	}
 
+	// Load the GeoIP database used by host policies.
+	geoIP, err := loadGeoIPDatabase(filepath.Join(persistDir, geoIPFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the GeoIP database: %v", err)
+	}
+
 	// Create Contractor using production dependencies.
-	return NewCustomContractor(cs, &WalletBridge{W: wallet}, tpool, hdb, contractSet, NewPersist(persistDir), logger, modules.ProdDependencies)
+	c, err := NewCustomContractor(cs, &WalletBridge{W: wallet}, tpool, hdb, contractSet, NewPersist(persistDir), logger, modules.ProdDependencies)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.geoIP = geoIP
+	c.mu.Unlock()
+	return c, nil
 }
 
 // NewCustomContractor creates a Contractor using the provided dependencies.
@@ -218,6 +273,8 @@ func NewCustomContractor(cs consensusSet, w wallet, tp transactionPool, hdb host
 		renewing:            make(map[types.FileContractID]bool),
 		renewedFrom:         make(map[types.FileContractID]types.FileContractID),
 		renewedTo:           make(map[types.FileContractID]types.FileContractID),
+		hostPolicies:        make(map[string]modules.HostPolicy),
+		policySets:          make(map[string]map[string]struct{}),
 	}
 
 	// Close the contract set and logger upon shutdown.
@@ -0,0 +1,96 @@
+package contractor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// geoIPFile is the name of the offline GeoIP database in the persist
+	// directory. Every line of the database is an IP range and the country
+	// code of the range, e.g. "1.0.0.0,1.0.0.255,AU", which is the format of
+	// the freely available country databases.
+	geoIPFile = "geoip.csv"
+)
+
+type (
+	// geoIPDatabase maps IP addresses to countries.
+	geoIPDatabase struct {
+		// ranges are sorted by their first address and don't overlap.
+		ranges []geoIPRange
+	}
+
+	// geoIPRange is a range of IP addresses located in a single country.
+	geoIPRange struct {
+		first   net.IP
+		last    net.IP
+		country string
+	}
+)
+
+// loadGeoIPDatabase loads the GeoIP database at path. A nil database is
+// returned if the file doesn't exist.
+func loadGeoIPDatabase(path string) (*geoIPDatabase, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readGeoIPDatabase(f)
+}
+
+// readGeoIPDatabase reads a GeoIP database from r.
+func readGeoIPDatabase(r io.Reader) (*geoIPDatabase, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	db := new(geoIPDatabase)
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %v of GeoIP database has %v fields, expected 3", line, len(record))
+		}
+		first, last := net.ParseIP(strings.TrimSpace(record[0])), net.ParseIP(strings.TrimSpace(record[1]))
+		if first == nil || last == nil || bytes.Compare(first.To16(), last.To16()) > 0 {
+			return nil, fmt.Errorf("line %v of GeoIP database has an invalid IP range", line)
+		}
+		db.ranges = append(db.ranges, geoIPRange{
+			first:   first.To16(),
+			last:    last.To16(),
+			country: strings.ToUpper(strings.TrimSpace(record[2])),
+		})
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].first, db.ranges[j].first) < 0
+	})
+	return db, nil
+}
+
+// Country returns the country code of ip. An empty string is returned if the
+// country of ip is unknown.
+func (db *geoIPDatabase) Country(ip net.IP) string {
+	ip = ip.To16()
+	if db == nil || ip == nil {
+		return ""
+	}
+	// Find the last range starting at or before ip.
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].first, ip) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(ip, db.ranges[i].last) > 0 {
+		return ""
+	}
+	return db.ranges[i].country
+}
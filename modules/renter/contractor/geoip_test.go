@@ -0,0 +1,48 @@
+package contractor
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// TestGeoIPDatabase tests reading a GeoIP database and looking up the
+// countries of addresses.
+func TestGeoIPDatabase(t *testing.T) {
+	db, err := readGeoIPDatabase(strings.NewReader(`2.0.0.0,2.0.0.255,fr
+1.0.0.0,1.0.0.255,AU
+2001:db8::,2001:db8::ffff,DE
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip      string
+		country string
+	}{
+		{"1.0.0.0", "AU"},
+		{"1.0.0.128", "AU"},
+		{"1.0.1.0", ""},
+		{"2.0.0.255", "FR"},
+		{"0.255.255.255", ""},
+		{"2001:db8::1", "DE"},
+		{"2001:db8::1:0", ""},
+	}
+	for _, test := range tests {
+		if country := db.Country(net.ParseIP(test.ip)); country != test.country {
+			t.Errorf("expected %v to be in %q, got %q", test.ip, test.country, country)
+		}
+	}
+
+	// A nil database doesn't know any countries.
+	if country := (*geoIPDatabase)(nil).Country(net.ParseIP("1.0.0.0")); country != "" {
+		t.Error("expected nil database to return an empty country, got", country)
+	}
+
+	// Invalid databases are rejected.
+	for _, invalid := range []string{"1.0.0.0,AU\n", "1.0.0.255,1.0.0.0,AU\n", "foo,1.0.0.0,AU\n"} {
+		if _, err := readGeoIPDatabase(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
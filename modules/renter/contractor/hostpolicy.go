@@ -0,0 +1,399 @@
+package contractor
+
+// Host policies restrict the hosts that the files of certain directories are
+// uploaded to. The contract set of a policy consists of the contracts with
+// hosts that satisfy the policy. The contractor keeps track of the contract
+// sets of all policies and forms new contracts with hosts satisfying a policy
+// until its contract set contains the number of contracts that the policy
+// asks for.
+//
+// Subnet and country constraints are checked against the IP addresses that
+// the net address of a host resolves to, and every one of the addresses needs
+// to satisfy them. Countries are looked up in the offline GeoIP database in
+// the persist directory.
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+var (
+	errHostPolicyNoHosts = errors.New("host policy must ask for a non-zero number of hosts")
+	errHostPolicyNoName  = errors.New("host policy must have a name")
+	errNoGeoIPDatabase   = errors.New("country constraints require a GeoIP database at " + geoIPFile + " in the renter directory")
+
+	// errUnknownHostPolicy is returned if a host policy doesn't exist.
+	errUnknownHostPolicy = errors.New("unknown host policy")
+)
+
+// validateHostPolicy checks that p is a valid host policy.
+func validateHostPolicy(p modules.HostPolicy, geoIP *geoIPDatabase) error {
+	if p.Name == "" {
+		return errHostPolicyNoName
+	}
+	if p.Hosts == 0 {
+		return errHostPolicyNoHosts
+	}
+	for _, subnet := range p.Subnets {
+		if _, _, err := net.ParseCIDR(subnet); err != nil {
+			return fmt.Errorf("invalid subnet %v: %v", subnet, err)
+		}
+	}
+	if len(p.Countries) > 0 && geoIP == nil {
+		return errNoGeoIPDatabase
+	}
+	for _, country := range p.Countries {
+		if len(country) != 2 {
+			return fmt.Errorf("invalid country code %v", country)
+		}
+	}
+	return nil
+}
+
+// satisfiesIPConstraints returns whether every one of the IP addresses of a
+// host satisfies the subnet and country constraints of p.
+func satisfiesIPConstraints(p modules.HostPolicy, ips []net.IP, geoIP *geoIPDatabase) bool {
+	if len(p.Subnets) == 0 && len(p.Countries) == 0 {
+		return true
+	}
+	if len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if len(p.Subnets) > 0 {
+			inSubnet := false
+			for _, subnet := range p.Subnets {
+				_, ipNet, err := net.ParseCIDR(subnet)
+				if err == nil && ipNet.Contains(ip) {
+					inSubnet = true
+					break
+				}
+			}
+			if !inSubnet {
+				return false
+			}
+		}
+		if len(p.Countries) > 0 {
+			country := geoIP.Country(ip)
+			inCountry := false
+			for _, c := range p.Countries {
+				if country != "" && strings.EqualFold(c, country) {
+					inCountry = true
+					break
+				}
+			}
+			if !inCountry {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// managedSatisfiesHostConstraints returns whether host satisfies the
+// constraints of p that don't require its IP addresses.
+func (c *Contractor) managedSatisfiesHostConstraints(p modules.HostPolicy, host modules.HostDBEntry) bool {
+	if len(p.Whitelist) > 0 {
+		whitelisted := false
+		for _, pk := range p.Whitelist {
+			if pk.String() == host.PublicKey.String() {
+				whitelisted = true
+				break
+			}
+		}
+		if !whitelisted {
+			return false
+		}
+	}
+	for _, pk := range p.Blacklist {
+		if pk.String() == host.PublicKey.String() {
+			return false
+		}
+	}
+	exceeds := func(price, max types.Currency) bool {
+		return !max.IsZero() && price.Cmp(max) > 0
+	}
+	if exceeds(host.ContractPrice, p.MaxContractPrice) ||
+		exceeds(host.DownloadBandwidthPrice, p.MaxDownloadBandwidthPrice) ||
+		exceeds(host.StoragePrice, p.MaxStoragePrice) ||
+		exceeds(host.UploadBandwidthPrice, p.MaxUploadBandwidthPrice) {
+		return false
+	}
+	if !p.MinScore.IsZero() && c.hdb.ScoreBreakdown(host).Score.Cmp(p.MinScore) < 0 {
+		return false
+	}
+	return true
+}
+
+// managedHostIPs resolves the net address of a host to its IP addresses.
+func (c *Contractor) managedHostIPs(host modules.HostDBEntry) []net.IP {
+	hostname := host.NetAddress.Host()
+	if ip := net.ParseIP(hostname); ip != nil {
+		return []net.IP{ip}
+	}
+	ips, err := c.staticDeps.Resolver().LookupIP(hostname)
+	if err != nil {
+		return nil
+	}
+	return ips
+}
+
+// HostPolicies returns the host policies of the contractor, sorted by name.
+func (c *Contractor) HostPolicies() []modules.HostPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	policies := make([]modules.HostPolicy, 0, len(c.hostPolicies))
+	for _, p := range c.hostPolicies {
+		policies = append(policies, p)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+	return policies
+}
+
+// SetHostPolicy adds a host policy or replaces the policy with the same name.
+// The contractor starts forming the contracts that the policy asks for right
+// away.
+func (c *Contractor) SetHostPolicy(p modules.HostPolicy) error {
+	c.mu.Lock()
+	if err := validateHostPolicy(p, c.geoIP); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	p.Countries = append([]string(nil), p.Countries...)
+	for i := range p.Countries {
+		p.Countries[i] = strings.ToUpper(p.Countries[i])
+	}
+	c.hostPolicies[p.Name] = p
+	err := c.saveSync()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Interrupt any existing maintenance and launch a new round of
+	// maintenance, which updates the contract sets and forms the missing
+	// contracts.
+	if err := c.tg.Add(); err != nil {
+		return err
+	}
+	go func() {
+		defer c.tg.Done()
+		c.managedInterruptContractMaintenance()
+		c.threadedContractMaintenance()
+	}()
+	return nil
+}
+
+// DeleteHostPolicy removes a host policy. The contracts in its contract set
+// are kept.
+func (c *Contractor) DeleteHostPolicy(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.hostPolicies[name]; !exists {
+		return errUnknownHostPolicy
+	}
+	delete(c.hostPolicies, name)
+	delete(c.policySets, name)
+	return c.saveSync()
+}
+
+// PolicyContracts returns the contracts in the contract set of the host policy
+// with the given name.
+func (c *Contractor) PolicyContracts(name string) ([]modules.RenterContract, error) {
+	c.mu.RLock()
+	_, exists := c.hostPolicies[name]
+	set := c.policySets[name]
+	c.mu.RUnlock()
+	if !exists {
+		return nil, errUnknownHostPolicy
+	}
+	var contracts []modules.RenterContract
+	for _, contract := range c.staticContracts.ViewAll() {
+		if _, ok := set[contract.HostPublicKey.String()]; ok {
+			contracts = append(contracts, contract)
+		}
+	}
+	return contracts, nil
+}
+
+// managedUpdatePolicySets recomputes the contract sets of the host policies.
+func (c *Contractor) managedUpdatePolicySets() {
+	c.mu.RLock()
+	policies := make([]modules.HostPolicy, 0, len(c.hostPolicies))
+	for _, p := range c.hostPolicies {
+		policies = append(policies, p)
+	}
+	geoIP := c.geoIP
+	c.mu.RUnlock()
+
+	sets := make(map[string]map[string]struct{})
+	for _, p := range policies {
+		sets[p.Name] = make(map[string]struct{})
+	}
+	for _, contract := range c.staticContracts.ViewAll() {
+		host, exists := c.hdb.Host(contract.HostPublicKey)
+		if !exists || host.Filtered {
+			continue
+		}
+		// Only resolve the host once all other constraints are satisfied.
+		var ips []net.IP
+		resolved := false
+		for _, p := range policies {
+			if !c.managedSatisfiesHostConstraints(p, host) {
+				continue
+			}
+			if !resolved && (len(p.Subnets) > 0 || len(p.Countries) > 0) {
+				ips = c.managedHostIPs(host)
+				resolved = true
+			}
+			if satisfiesIPConstraints(p, ips, geoIP) {
+				sets[p.Name][contract.HostPublicKey.String()] = struct{}{}
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.policySets = sets
+	c.mu.Unlock()
+}
+
+// managedPolicyCandidates returns up to n hosts that satisfy p and that the
+// contractor doesn't have contracts with, best scoring hosts first. Hosts
+// sharing a subnet with the hosts of active contracts are skipped, since the
+// contractor would cancel one of the contracts.
+func (c *Contractor) managedPolicyCandidates(p modules.HostPolicy, n int) []modules.HostDBEntry {
+	c.mu.RLock()
+	geoIP := c.geoIP
+	c.mu.RUnlock()
+	contracted := make(map[string]struct{})
+	usedNets := make(map[string]struct{})
+	for _, contract := range c.staticContracts.ViewAll() {
+		contracted[contract.HostPublicKey.String()] = struct{}{}
+		if !contract.Utility.Locked || contract.Utility.GoodForRenew || contract.Utility.GoodForUpload {
+			if host, exists := c.hdb.Host(contract.HostPublicKey); exists {
+				for _, ipNet := range host.IPNets {
+					usedNets[ipNet] = struct{}{}
+				}
+			}
+		}
+	}
+
+	var hosts []modules.HostDBEntry
+	scores := make(map[string]types.Currency)
+	for _, host := range c.hdb.ActiveHosts() {
+		if _, exists := contracted[host.PublicKey.String()]; exists || host.Filtered || !host.AcceptingContracts {
+			continue
+		}
+		if !c.managedSatisfiesHostConstraints(p, host) {
+			continue
+		}
+		hosts = append(hosts, host)
+		scores[host.PublicKey.String()] = c.hdb.ScoreBreakdown(host).Score
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return scores[hosts[i].PublicKey.String()].Cmp(scores[hosts[j].PublicKey.String()]) > 0
+	})
+
+	var candidates []modules.HostDBEntry
+	for _, host := range hosts {
+		if len(candidates) >= n {
+			break
+		}
+		usesNet := false
+		for _, ipNet := range host.IPNets {
+			if _, used := usedNets[ipNet]; used {
+				usesNet = true
+				break
+			}
+		}
+		if usesNet || !satisfiesIPConstraints(p, c.managedHostIPs(host), geoIP) {
+			continue
+		}
+		for _, ipNet := range host.IPNets {
+			usedNets[ipNet] = struct{}{}
+		}
+		candidates = append(candidates, host)
+	}
+	return candidates
+}
+
+// managedFormPolicyContracts forms the contracts that the contract sets of the
+// host policies are missing. It returns the remaining funds and whether
+// maintenance was interrupted.
+func (c *Contractor) managedFormPolicyContracts(fundsRemaining types.Currency, endHeight types.BlockHeight) (types.Currency, bool) {
+	c.managedUpdatePolicySets()
+	policies := c.HostPolicies()
+	c.mu.RLock()
+	initialContractFunds := c.allowance.Funds.Div64(c.allowance.Hosts).Div64(3)
+	c.mu.RUnlock()
+
+	for _, p := range policies {
+		contracts, err := c.PolicyContracts(p.Name)
+		if err != nil {
+			continue
+		}
+		neededContracts := int(p.Hosts)
+		for _, contract := range contracts {
+			if contract.Utility.GoodForUpload {
+				neededContracts--
+			}
+		}
+		if neededContracts <= 0 {
+			continue
+		}
+
+		for _, host := range c.managedPolicyCandidates(p, neededContracts*2) {
+			if fundsRemaining.Cmp(initialContractFunds) < 0 {
+				c.log.Println("WARN: need to form contracts for host policy", p.Name, "but unable to because of a low allowance")
+				return fundsRemaining, false
+			}
+			fundsSpent, newContract, err := c.managedNewContract(host, initialContractFunds, endHeight)
+			if err != nil {
+				c.log.Printf("Attempted to form a contract with %v(%s) for host policy %v, but negotiation failed: %v\n", host.NetAddress, host.Version, p.Name, err)
+				continue
+			}
+			fundsRemaining = fundsRemaining.Sub(fundsSpent)
+			err = c.managedUpdateContractUtility(newContract.ID, modules.ContractUtility{
+				GoodForUpload: true,
+				GoodForRenew:  true,
+			})
+			if err != nil {
+				c.log.Println("Failed to update the contract utilities", err)
+				return fundsRemaining, true
+			}
+			c.mu.Lock()
+			if set, exists := c.policySets[p.Name]; exists {
+				set[host.PublicKey.String()] = struct{}{}
+			}
+			err = c.saveSync()
+			c.mu.Unlock()
+			if err != nil {
+				c.log.Println("Unable to save the contractor:", err)
+			}
+
+			neededContracts--
+			if neededContracts <= 0 {
+				break
+			}
+			select {
+			case <-c.tg.StopChan():
+				return fundsRemaining, true
+			case <-c.interruptMaintenance:
+				return fundsRemaining, true
+			default:
+			}
+		}
+		if neededContracts > 0 {
+			c.log.Printf("WARN: host policy %v is missing %v contracts, not enough hosts satisfy it", p.Name, neededContracts)
+		}
+	}
+	return fundsRemaining, false
+}
@@ -0,0 +1,250 @@
+package contractor
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/proto"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// policyHostDB is a hostDB with a fixed set of hosts, whose scores are their
+// storage prices.
+type policyHostDB struct {
+	stubHostDB
+	hosts []modules.HostDBEntry
+}
+
+func (hdb *policyHostDB) ActiveHosts() []modules.HostDBEntry { return hdb.hosts }
+func (hdb *policyHostDB) Host(pk types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	for _, host := range hdb.hosts {
+		if host.PublicKey.String() == pk.String() {
+			return host, true
+		}
+	}
+	return modules.HostDBEntry{}, false
+}
+func (hdb *policyHostDB) ScoreBreakdown(host modules.HostDBEntry) modules.HostScoreBreakdown {
+	return modules.HostScoreBreakdown{Score: host.StoragePrice}
+}
+
+// newPolicyTestHost returns a host that accepts contracts at the IP address,
+// with price as both its storage price and its score.
+func newPolicyTestHost(ip string, price uint64) modules.HostDBEntry {
+	_, pk := crypto.GenerateKeyPair()
+	_, ipNet, _ := net.ParseCIDR(ip + "/24")
+	var host modules.HostDBEntry
+	host.PublicKey = types.Ed25519PublicKey(pk)
+	host.NetAddress = modules.NetAddress(ip + ":9982")
+	host.IPNets = []string{ipNet.String()}
+	host.AcceptingContracts = true
+	host.StoragePrice = types.NewCurrency64(price)
+	return host
+}
+
+// newPolicyTestContractor returns a contractor with contracts with the hosts.
+func newPolicyTestContractor(name string, hosts []modules.HostDBEntry, contracted []modules.HostDBEntry) (*Contractor, error) {
+	cs, err := proto.NewContractSet(build.TempDir("contractor", name), modules.ProdDependencies)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range contracted {
+		var id types.FileContractID
+		fastrand.Read(id[:])
+		err := cs.ConvertV130Contract(proto.V130Contract{
+			LastRevisionTxn: types.Transaction{
+				FileContractRevisions: []types.FileContractRevision{{
+					ParentID:             id,
+					UnlockConditions:     types.UnlockConditions{PublicKeys: []types.SiaPublicKey{{}, host.PublicKey}},
+					NewValidProofOutputs: []types.SiacoinOutput{{}, {}},
+				}},
+			},
+		}, proto.V130CachedRevision{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Contractor{
+		allowance:       modules.Allowance{Funds: types.NewCurrency64(1000), Hosts: 3},
+		hdb:             &policyHostDB{hosts: hosts},
+		hostPolicies:    make(map[string]modules.HostPolicy),
+		policySets:      make(map[string]map[string]struct{}),
+		staticContracts: cs,
+		staticDeps:      modules.ProdDependencies,
+	}, nil
+}
+
+// TestSatisfiesHostConstraints tests matching hosts against the whitelist,
+// blacklist, score and price constraints of host policies.
+func TestSatisfiesHostConstraints(t *testing.T) {
+	cheap := newPolicyTestHost("10.0.0.1", 10)
+	expensive := newPolicyTestHost("10.0.1.1", 100)
+	c := &Contractor{hdb: &policyHostDB{}}
+	tests := []struct {
+		policy    modules.HostPolicy
+		cheap     bool
+		expensive bool
+	}{
+		{modules.HostPolicy{}, true, true},
+		{modules.HostPolicy{Whitelist: []types.SiaPublicKey{cheap.PublicKey}}, true, false},
+		{modules.HostPolicy{Blacklist: []types.SiaPublicKey{cheap.PublicKey}}, false, true},
+		{modules.HostPolicy{Whitelist: []types.SiaPublicKey{cheap.PublicKey}, Blacklist: []types.SiaPublicKey{cheap.PublicKey}}, false, false},
+		{modules.HostPolicy{MaxStoragePrice: types.NewCurrency64(10)}, true, false},
+		{modules.HostPolicy{MaxStoragePrice: types.NewCurrency64(9)}, false, false},
+		{modules.HostPolicy{MaxContractPrice: types.NewCurrency64(1)}, true, true},
+		{modules.HostPolicy{MinScore: types.NewCurrency64(50)}, false, true},
+	}
+	for i, test := range tests {
+		if c.managedSatisfiesHostConstraints(test.policy, cheap) != test.cheap {
+			t.Errorf("test %v: expected the cheap host to satisfy the policy: %v", i, test.cheap)
+		}
+		if c.managedSatisfiesHostConstraints(test.policy, expensive) != test.expensive {
+			t.Errorf("test %v: expected the expensive host to satisfy the policy: %v", i, test.expensive)
+		}
+	}
+}
+
+// TestSatisfiesIPConstraints tests matching the IP addresses of hosts against
+// the subnet and country constraints of host policies.
+func TestSatisfiesIPConstraints(t *testing.T) {
+	geoIP, err := readGeoIPDatabase(strings.NewReader("1.0.0.0,1.0.0.255,AU\n2.0.0.0,2.0.0.255,FR\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips := func(addrs ...string) []net.IP {
+		var ips []net.IP
+		for _, addr := range addrs {
+			ips = append(ips, net.ParseIP(addr))
+		}
+		return ips
+	}
+	subnet := modules.HostPolicy{Subnets: []string{"1.0.0.0/24", "3.0.0.0/8"}}
+	country := modules.HostPolicy{Countries: []string{"AU"}}
+	both := modules.HostPolicy{Subnets: []string{"1.0.0.0/25"}, Countries: []string{"AU"}}
+	tests := []struct {
+		policy    modules.HostPolicy
+		ips       []net.IP
+		satisfies bool
+	}{
+		{modules.HostPolicy{}, nil, true},
+		{subnet, nil, false},
+		{subnet, ips("1.0.0.1"), true},
+		{subnet, ips("3.1.2.3"), true},
+		{subnet, ips("1.0.0.1", "2.0.0.1"), false},
+		{country, ips("1.0.0.1"), true},
+		{country, ips("2.0.0.1"), false},
+		{country, ips("4.0.0.1"), false},
+		{both, ips("1.0.0.1"), true},
+		{both, ips("1.0.0.200"), false},
+	}
+	for i, test := range tests {
+		if satisfiesIPConstraints(test.policy, test.ips, geoIP) != test.satisfies {
+			t.Errorf("test %v: expected %v", i, test.satisfies)
+		}
+	}
+}
+
+// TestPolicyContractSets tests that the contract sets of the host policies
+// contain the contracts with the hosts that satisfy them, and that only the
+// missing contracts are formed.
+func TestPolicyContractSets(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	a := newPolicyTestHost("10.0.0.1", 10)
+	b := newPolicyTestHost("10.0.1.1", 20)
+	filtered := newPolicyTestHost("10.0.2.1", 10)
+	filtered.Filtered = true
+	c, err := newPolicyTestContractor(t.Name(), []modules.HostDBEntry{a, b, filtered}, []modules.HostDBEntry{a, b, filtered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.hostPolicies["cheap"] = modules.HostPolicy{Name: "cheap", Hosts: 1, MaxStoragePrice: types.NewCurrency64(10)}
+	c.hostPolicies["subnet"] = modules.HostPolicy{Name: "subnet", Hosts: 2, Subnets: []string{"10.0.0.0/16"}}
+
+	c.managedUpdatePolicySets()
+	expected := map[string][]string{
+		"cheap":  {a.PublicKey.String()},
+		"subnet": {a.PublicKey.String(), b.PublicKey.String()},
+	}
+	for name, hosts := range expected {
+		contracts, err := c.PolicyContracts(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, contract := range contracts {
+			keys = append(keys, contract.HostPublicKey.String())
+		}
+		sort.Strings(keys)
+		sort.Strings(hosts)
+		if !reflect.DeepEqual(keys, hosts) {
+			t.Errorf("unexpected contract set of %v: %v", name, keys)
+		}
+	}
+	if _, err := c.PolicyContracts("unknown"); err != errUnknownHostPolicy {
+		t.Fatal("expected errUnknownHostPolicy, got", err)
+	}
+
+	// The contract set of the cheap policy is complete once its contract is
+	// good for upload, so no contracts are formed for it.
+	for _, id := range c.staticContracts.IDs() {
+		sc, _ := c.staticContracts.Acquire(id)
+		err := sc.UpdateUtility(modules.ContractUtility{GoodForUpload: true})
+		c.staticContracts.Return(sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	delete(c.hostPolicies, "subnet")
+	funds := types.NewCurrency64(1000)
+	if remaining, interrupted := c.managedFormPolicyContracts(funds, 100); interrupted || !remaining.Equals(funds) {
+		t.Fatal("no contracts should be formed", remaining, interrupted)
+	}
+}
+
+// TestPolicyCandidates tests that the candidates for the contracts of a host
+// policy are the best scoring hosts that satisfy it, without the hosts the
+// contractor has contracts with or that share a subnet with them.
+func TestPolicyCandidates(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	contracted := newPolicyTestHost("10.0.0.1", 50)
+	sameSubnet := newPolicyTestHost("10.0.0.2", 40)
+	best := newPolicyTestHost("10.0.1.1", 30)
+	second := newPolicyTestHost("10.0.2.1", 20)
+	third := newPolicyTestHost("10.0.3.1", 10)
+	notAccepting := newPolicyTestHost("10.0.4.1", 60)
+	notAccepting.AcceptingContracts = false
+	blacklisted := newPolicyTestHost("10.0.5.1", 70)
+	hosts := []modules.HostDBEntry{third, contracted, sameSubnet, best, notAccepting, second, blacklisted}
+	c, err := newPolicyTestContractor(t.Name(), hosts, []modules.HostDBEntry{contracted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := modules.HostPolicy{Name: "p", Hosts: 2, Blacklist: []types.SiaPublicKey{blacklisted.PublicKey}}
+
+	keys := func(hosts []modules.HostDBEntry) []string {
+		var keys []string
+		for _, host := range hosts {
+			keys = append(keys, host.PublicKey.String())
+		}
+		return keys
+	}
+	candidates := c.managedPolicyCandidates(p, 2)
+	if !reflect.DeepEqual(keys(candidates), keys([]modules.HostDBEntry{best, second})) {
+		t.Fatal("unexpected candidates", keys(candidates))
+	}
+	candidates = c.managedPolicyCandidates(p, 10)
+	if !reflect.DeepEqual(keys(candidates), keys([]modules.HostDBEntry{best, second, third})) {
+		t.Fatal("unexpected candidates", keys(candidates))
+	}
+}
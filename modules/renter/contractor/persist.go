@@ -18,6 +18,7 @@ type contractorPersist struct {
 	Allowance     modules.Allowance               `json:"allowance"`
 	BlockHeight   types.BlockHeight               `json:"blockheight"`
 	CurrentPeriod types.BlockHeight               `json:"currentperiod"`
+	HostPolicies  []modules.HostPolicy            `json:"hostpolicies"`
 	LastChange    modules.ConsensusChangeID       `json:"lastchange"`
 	OldContracts  []modules.RenterContract        `json:"oldcontracts"`
 	RenewedFrom   map[string]types.FileContractID `json:"renewedfrom"`
@@ -43,6 +44,9 @@ func (c *Contractor) persistData() contractorPersist {
 	for _, contract := range c.oldContracts {
 		data.OldContracts = append(data.OldContracts, contract)
 	}
+	for _, p := range c.hostPolicies {
+		data.HostPolicies = append(data.HostPolicies, p)
+	}
 	return data
 }
 
@@ -87,6 +91,9 @@ func (c *Contractor) load() error {
 	for _, contract := range data.OldContracts {
 		c.oldContracts[contract.ID] = contract
 	}
+	for _, p := range data.HostPolicies {
+		c.hostPolicies[p.Name] = p
+	}
 
 	return nil
 }
@@ -32,6 +32,9 @@ type Session interface {
 	// EndHeight returns the height at which the contract ends.
 	EndHeight() types.BlockHeight
 
+	// SetBackupIndex stores a signed backup index on the host.
+	SetBackupIndex(req modules.LoopSetBackupIndexRequest) error
+
 	// Upload revises the underlying contract to store the new data. It
 	// returns the Merkle root of the data.
 	Upload(data []byte) (crypto.Hash, error)
@@ -115,6 +118,16 @@ func (hs *hostSession) Download(root crypto.Hash, offset, length uint32) ([]byte
 // store the file.
 func (hs *hostSession) EndHeight() types.BlockHeight { return hs.endHeight }
 
+// SetBackupIndex stores a signed backup index on the host.
+func (hs *hostSession) SetBackupIndex(req modules.LoopSetBackupIndexRequest) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.invalid {
+		return errInvalidSession
+	}
+	return hs.session.SetBackupIndex(req)
+}
+
 // Upload negotiates a revision that adds a sector to a file contract.
 func (hs *hostSession) Upload(data []byte) (crypto.Hash, error) {
 	hs.mu.Lock()
@@ -16,6 +16,7 @@ func (c *Contractor) managedArchiveContracts() {
 	// Loop through the current set of contracts and migrate any expired ones to
 	// the set of old contracts.
 	var expired []types.FileContractID
+	var ended []modules.RenterContract
 	for _, contract := range c.staticContracts.ViewAll() {
 		// Check map of renewedTo in case renew code was interrupted before
 		// archiving old contract
@@ -28,6 +29,9 @@ func (c *Contractor) managedArchiveContracts() {
 			c.oldContracts[id] = contract
 			c.mu.Unlock()
 			expired = append(expired, id)
+			if !renewed {
+				ended = append(ended, contract)
+			}
 			c.log.Println("INFO: archived expired contract", id)
 		}
 	}
@@ -43,6 +47,9 @@ func (c *Contractor) managedArchiveContracts() {
 			c.staticContracts.Delete(sc)
 		}
 	}
+	for _, contract := range ended {
+		c.managedNotifyContractEvent(modules.RenterEventContractExpired, contract, types.FileContractID{})
+	}
 }
 
 // ProcessConsensusChange will be called by the consensus set every time there
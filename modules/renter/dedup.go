@@ -0,0 +1,262 @@
+package renter
+
+// Deduplicated files share the pieces of chunks with identical content. Every
+// chunk of a deduplicated file is identified by its dedup id, a hash of the
+// chunk's content that is keyed with a key derived from the wallet seed. The
+// pieces of the chunk are encrypted with a key derived from the dedup id, so
+// that every file containing the chunk can decrypt them, while hosts can't
+// tell which chunks they store without knowing the seed.
+//
+// The dedup index maps the dedup ids of the renter's deduplicated chunks to
+// the pieces storing them, and counts how many chunks of siafiles reference
+// each of them. When a chunk is uploaded that is already in the index, its
+// pieces are added to the siafile instead of uploading the chunk again. The
+// entry of a chunk is removed from the index once the last siafile
+// referencing it is deleted.
+
+import (
+	"os"
+	"sync"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/encoding"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/persist"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/errors"
+)
+
+const (
+	// dedupFile is the name of the file that persists the dedup index.
+	dedupFile = "dedup.json"
+)
+
+var (
+	// dedupKeySpecifier is used to derive the key that the dedup ids of
+	// chunks are hashed with from the wallet seed.
+	dedupKeySpecifier = types.Specifier{'d', 'e', 'd', 'u', 'p', 'K', 'e', 'y'}
+
+	// dedupMetadata is the header of the dedup index.
+	dedupMetadata = persist.Metadata{
+		Header:  "Renter Dedup Index",
+		Version: persistVersion,
+	}
+)
+
+type (
+	// dedupIndex tracks the deduplicated chunks of the renter.
+	dedupIndex struct {
+		// chunks maps the hex encoded dedup ids to the chunks.
+		chunks map[string]*dedupChunk
+
+		// key is the key derived from the wallet seed that dedup ids are
+		// hashed with. It is only set once the wallet was unlocked.
+		key    crypto.Hash
+		keySet bool
+
+		path string
+		mu   sync.Mutex
+	}
+
+	// dedupChunk is a deduplicated chunk in the dedup index.
+	dedupChunk struct {
+		Refs   uint64            // number of siafile chunks referencing the chunk
+		Pieces [][]siafile.Piece // pieces storing the chunk, indexed by piece index
+	}
+)
+
+// loadDedupIndex loads the dedup index persisted at path. An empty index is
+// returned if it wasn't persisted yet.
+func loadDedupIndex(path string) (*dedupIndex, error) {
+	di := &dedupIndex{
+		chunks: make(map[string]*dedupChunk),
+		path:   path,
+	}
+	err := persist.LoadJSON(dedupMetadata, &di.chunks, path)
+	if os.IsNotExist(err) {
+		return di, nil
+	}
+	return di, err
+}
+
+// save persists the dedup index. The caller must hold the lock.
+func (di *dedupIndex) save() error {
+	return persist.SaveJSON(dedupMetadata, di.chunks, di.path)
+}
+
+// managedAcquire adds a reference to the chunk with the dedup id. If the
+// chunk is already known, the pieces storing it are returned.
+func (di *dedupIndex) managedAcquire(id crypto.Hash) ([][]siafile.Piece, error) {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	chunk, exists := di.chunks[id.String()]
+	if !exists {
+		chunk = new(dedupChunk)
+		di.chunks[id.String()] = chunk
+	}
+	chunk.Refs++
+	return chunk.Pieces, di.save()
+}
+
+// managedRelease removes a reference from each of the chunks with the dedup
+// ids. Chunks without references are removed from the index.
+func (di *dedupIndex) managedRelease(ids []crypto.Hash) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	for _, id := range ids {
+		chunk, exists := di.chunks[id.String()]
+		if !exists {
+			continue
+		}
+		chunk.Refs--
+		if chunk.Refs == 0 {
+			delete(di.chunks, id.String())
+		}
+	}
+	return di.save()
+}
+
+// managedSetPieces updates the pieces that store the chunk with the dedup id.
+// Chunks that are not in the index are ignored.
+func (di *dedupIndex) managedSetPieces(id crypto.Hash, pieces [][]siafile.Piece) error {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	chunk, exists := di.chunks[id.String()]
+	if !exists {
+		return nil
+	}
+	chunk.Pieces = pieces
+	return di.save()
+}
+
+// dedupChunkID computes the dedup id of a chunk of entry from the chunk's
+// logical data. The erasure coding and encryption settings of the file are
+// part of the id since they determine the pieces of the chunk.
+func dedupChunkID(key crypto.Hash, entry *siafile.SiaFileSetEntry, logicalChunkData [][]byte) crypto.Hash {
+	h := crypto.NewHash()
+	h.Write(key[:])
+	encoding.NewEncoder(h).EncodeAll(entry.MasterKey().Type(), entry.ErasureCode().MinPieces(), entry.ErasureCode().NumPieces(), entry.PieceSize())
+	for _, data := range logicalChunkData {
+		h.Write(data)
+	}
+	var id crypto.Hash
+	h.Sum(id[:0])
+	return id
+}
+
+// managedDedupKey returns the key that dedup ids are hashed with. It fails if
+// the wallet is locked and the key wasn't derived before.
+func (r *Renter) managedDedupKey() (crypto.Hash, error) {
+	di := r.staticDedupIndex
+	di.mu.Lock()
+	key, keySet := di.key, di.keySet
+	di.mu.Unlock()
+	if keySet {
+		return key, nil
+	}
+	seed, err := r.managedSeed()
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	key = crypto.HashAll(seed, dedupKeySpecifier)
+	di.mu.Lock()
+	di.key, di.keySet = key, true
+	di.mu.Unlock()
+	return key, nil
+}
+
+// managedDeduplicateChunk assigns a dedup id to a chunk of a deduplicated file
+// that doesn't have any pieces yet. The chunk's logical data needs to be
+// fetched already. If the chunk is already in the dedup index, the pieces of
+// the known chunk are added to the file and marked as completed, as long as
+// they are stored on hosts that the chunk could be uploaded to. The number of
+// pieces that were added is returned.
+func (r *Renter) managedDeduplicateChunk(chunk *unfinishedUploadChunk) int {
+	entry := chunk.fileEntry
+	if !entry.Dedup() {
+		return 0
+	}
+	if _, deduplicated := entry.DedupID(chunk.index); deduplicated {
+		return 0
+	}
+	pieces, err := entry.Pieces(chunk.index)
+	if err != nil {
+		return 0
+	}
+	for _, pieceSet := range pieces {
+		if len(pieceSet) > 0 {
+			return 0
+		}
+	}
+
+	// Chunks are uploaded without deduplication while the wallet is locked.
+	key, err := r.managedDedupKey()
+	if err != nil {
+		r.log.Debugln("WARN: could not deduplicate chunk:", err)
+		return 0
+	}
+	id := dedupChunkID(key, entry, chunk.logicalChunkData)
+	if err := entry.SetDedupID(chunk.index, id); err != nil {
+		r.log.Debugln("WARN: could not deduplicate chunk:", err)
+		return 0
+	}
+	known, err := r.staticDedupIndex.managedAcquire(id)
+	if err != nil {
+		r.log.Println("WARN: could not save the dedup index:", err)
+	}
+
+	// Reuse the known pieces.
+	added := 0
+	for pieceIndex, pieceSet := range known {
+		if pieceIndex >= len(chunk.pieceUsage) {
+			break
+		}
+		for _, piece := range pieceSet {
+			if chunk.pieceUsage[pieceIndex] {
+				break
+			}
+			utility, exists := r.hostContractor.ContractUtility(piece.HostPubKey)
+			if !exists || !utility.GoodForRenew {
+				continue
+			}
+			host := piece.HostPubKey.String()
+			if _, unused := chunk.unusedHosts[host]; !unused {
+				continue
+			}
+			if err := entry.AddPiece(piece.HostPubKey, chunk.index, uint64(pieceIndex), piece.MerkleRoot); err != nil {
+				r.log.Debugln("WARN: could not add deduplicated piece:", err)
+				continue
+			}
+			chunk.pieceUsage[pieceIndex] = true
+			chunk.piecesCompleted++
+			delete(chunk.unusedHosts, host)
+			added++
+		}
+	}
+	return added
+}
+
+// managedDirDedupIDs returns the dedup ids of the chunks of all the files
+// below the directory at siaPath.
+func (r *Renter) managedDirDedupIDs(siaPath string) ([]crypto.Hash, error) {
+	siaPaths, err := r.managedFilesBelow(siaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []crypto.Hash
+	for _, siaPath := range siaPaths {
+		entry, err := r.staticFileSet.Open(siaPath)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, entry.DedupIDs()...)
+		if err := entry.Close(); err != nil {
+			return nil, errors.AddContext(err, "failed to close siafile")
+		}
+	}
+	return ids, nil
+}
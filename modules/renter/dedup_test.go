@@ -0,0 +1,73 @@
+package renter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// TestDedupIndex tests that the dedup index counts the references to its
+// chunks and persists them.
+func TestDedupIndex(t *testing.T) {
+	dir := build.TempDir("renter", t.Name())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, dedupFile)
+	di, err := loadDedupIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first reference to a chunk doesn't return any pieces.
+	var id crypto.Hash
+	fastrand.Read(id[:])
+	pieces, err := di.managedAcquire(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pieces) != 0 {
+		t.Fatal("unknown chunk shouldn't have pieces")
+	}
+	known := [][]siafile.Piece{{{MerkleRoot: crypto.Hash{1}}}}
+	if err := di.managedSetPieces(id, known); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second reference returns the pieces of the chunk.
+	pieces, err = di.managedAcquire(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pieces) != 1 || pieces[0][0].MerkleRoot != known[0][0].MerkleRoot {
+		t.Fatal("known chunk should have pieces", pieces)
+	}
+
+	// The references should survive reloading the index.
+	di, err = loadDedupIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk, exists := di.chunks[id.String()]; !exists || chunk.Refs != 2 {
+		t.Fatal("references weren't persisted", chunk)
+	}
+
+	// The chunk is removed once the last reference is released.
+	if err := di.managedRelease([]crypto.Hash{id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := di.chunks[id.String()]; !exists {
+		t.Fatal("chunk was removed while still referenced")
+	}
+	if err := di.managedRelease([]crypto.Hash{id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := di.chunks[id.String()]; exists {
+		t.Fatal("chunk wasn't removed after releasing all references")
+	}
+}
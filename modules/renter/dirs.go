@@ -1,5 +1,17 @@
 package renter
 
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
 // CreateDir creates a directory for the renter
 func (r *Renter) CreateDir(siaPath string) error {
 	err := r.tg.Add()
@@ -14,24 +26,197 @@ func (r *Renter) CreateDir(siaPath string) error {
 
 // DeleteDir removes a directory from the renter and deletes all its sub
 // directories and files from the hosts it is stored on.
-//
-// TODO: Implement
-// func (r *Renter) DeleteDir(nickname string) error {
-// 	return nil
-// }
-
-// DirList returns directories and files stored in the directory located at `path`
-//
-// TODO: Implement
-// func (r *Renter) DirList(path string) {
-// 	return
-// }
+func (r *Renter) DeleteDir(siaPath string) error {
+	err := r.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := validateSiapath(siaPath); err != nil {
+		return err
+	}
+	// Keep the versioned files below the directory as versions.
+	if err := r.managedArchiveDir(siaPath); err != nil {
+		return err
+	}
+	r.siaDirMu.Lock()
+	dedupIDs, err := r.managedDirDedupIDs(siaPath)
+	if err == nil {
+		err = r.staticFileSet.DeleteDir(siaPath)
+	}
+	r.siaDirMu.Unlock()
+	if err != nil {
+		return err
+	}
+	// Release the deduplicated chunks of the deleted files.
+	if err := r.staticDedupIndex.managedRelease(dedupIDs); err != nil {
+		r.log.Println("WARN: Could not update the dedup index:", err)
+	}
+	r.staticFileIndex.managedRemoveDir(siaPath)
+	// The parent directory might be healthier without the deleted directory.
+	if err := r.managedBubbleDirHealth(dirSiaPath(siaPath)); err != nil {
+		r.log.Println("WARN: Could not update the health of the parent of", siaPath, err)
+	}
+	return nil
+}
+
+// managedNewDirectoryInfo returns the DirectoryInfo of a directory. The
+// aggregate values of the files below the directory are read from its
+// metadata.
+func (r *Renter) managedNewDirectoryInfo(siaPath, dir string) (modules.DirectoryInfo, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return modules.DirectoryInfo{}, siafile.ErrUnknownDir
+	} else if err != nil {
+		return modules.DirectoryInfo{}, err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return modules.DirectoryInfo{}, err
+	}
+	r.siaDirMu.Lock()
+	md, err := loadSiaDirMetadata(dir)
+	r.siaDirMu.Unlock()
+	if err != nil {
+		return modules.DirectoryInfo{}, err
+	}
+	di := modules.DirectoryInfo{
+		AggregateHealth:     md.AggregateHealth,
+		AggregateSize:       md.AggregateSize,
+		Health:              md.Health,
+		HostPolicy:          md.HostPolicy,
+		HyperspacePath:      siaPath,
+		LastHealthCheckTime: md.LastHealthCheckTime,
+		LastModified:        fi.ModTime(),
+		MinRedundancy:       -1,
+		NumFiles:            md.AggregateNumFiles,
+		NumStuckChunks:      md.AggregateNumStuckChunks,
+		VersionPolicy:       md.VersionPolicy,
+	}
+	if md.AggregateNumFiles > 0 {
+		di.MinRedundancy = md.AggregateMinRedundancy
+	}
+	if md.AggregateModTime.After(di.LastModified) {
+		di.LastModified = md.AggregateModTime
+	}
+	for _, fi := range fis {
+		if fi.IsDir() && !isHiddenPath(filepath.ToSlash(filepath.Join(siaPath, fi.Name()))) {
+			di.NumSubDirs++
+		}
+	}
+	return di, nil
+}
+
+// DirList returns the directory at siaPath followed by its immediate
+// subdirectories, and the files directly inside the directory. The empty
+// siaPath refers to the renter's root directory.
+func (r *Renter) DirList(siaPath string) ([]modules.DirectoryInfo, []modules.FileInfo, error) {
+	err := r.tg.Add()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.tg.Done()
+	siaPath = strings.Trim(siaPath, "/")
+	if siaPath != "" {
+		if err := validateSiapath(siaPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Collect the directory and its immediate subdirectories.
+	dir := filepath.Join(r.filesDir, siaPath)
+	di, err := r.managedNewDirectoryInfo(siaPath, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	dirs := []modules.DirectoryInfo{di}
+	subDirs, siaPaths, err := r.managedDirContents(siaPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, subDir := range subDirs {
+		if isHiddenPath(subDir) {
+			continue
+		}
+		di, err := r.managedNewDirectoryInfo(subDir, filepath.Join(r.filesDir, subDir))
+		if err != nil {
+			return nil, nil, err
+		}
+		dirs = append(dirs, di)
+	}
+
+	// Open the files directly inside the directory. Errors are not
+	// considered fatal and are ignored.
+	var entrys []*siafile.SiaFileSetEntry
+	for _, siaPath := range siaPaths {
+		entry, err := r.staticFileSet.Open(siaPath)
+		if err != nil {
+			continue
+		}
+		entrys = append(entrys, entry)
+	}
+	packs := r.managedOpenPacks(entrys)
+	defer r.closePacks(packs)
+	pks := make(map[string]types.SiaPublicKey)
+	for _, entry := range entrys {
+		for _, pk := range entry.HostPublicKeys() {
+			pks[string(pk.Key)] = pk
+		}
+	}
+	for _, pack := range packs {
+		for _, pk := range pack.HostPublicKeys() {
+			pks[string(pk.Key)] = pk
+		}
+	}
+	offline, goodForRenew, contracts := r.managedContractStatus(pks)
+	files := []modules.FileInfo{}
+	for _, entry := range entrys {
+		files = append(files, fileInfo(entry, packs[entry.PackPath()], offline, goodForRenew, contracts))
+		if err := entry.Close(); err != nil {
+			r.log.Debugln("WARN: Could not close thread:", err)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].HyperspacePath < files[j].HyperspacePath
+	})
+	return dirs, files, nil
+}
 
 // RenameDir takes an existing directory and changes the path. The original
 // directory must exist, and there must not be any directory that already has
-// the replacement path.  All sia files within directory will also be renamed
-//
-// TODO: implement, need to rename directory and walk through and rename all sia
-// files within func (r *Renter) RenameDir(currentPath, newPath string) error {
-//  return nil
-// }
+// the replacement path. All sia files within the directory are renamed in a
+// single atomic operation.
+func (r *Renter) RenameDir(currentPath, newPath string) error {
+	err := r.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := validateSiapath(currentPath); err != nil {
+		return err
+	}
+	if err := validateSiapath(newPath); err != nil {
+		return err
+	}
+	r.siaDirMu.Lock()
+	err = r.staticFileSet.RenameDir(currentPath, newPath)
+	r.siaDirMu.Unlock()
+	if err != nil {
+		return err
+	}
+	r.staticFileIndex.managedRenameDir(currentPath, newPath)
+	// Make sure the new parent directories have metadata files.
+	lockID := r.mu.Lock()
+	err = r.createDir(newPath)
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return err
+	}
+	// Move the health of the directory from its old parents to its new ones.
+	for _, siaPath := range []string{dirSiaPath(currentPath), newPath} {
+		if err := r.managedBubbleDirHealth(siaPath); err != nil {
+			r.log.Println("WARN: Could not update the health of", siaPath, err)
+		}
+	}
+	return nil
+}
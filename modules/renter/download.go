@@ -323,9 +323,22 @@ func (r *Renter) DownloadAsync(p modules.RenterDownloadParameters) error {
 // returns the download object and an error that indicates if the download
 // setup was successful.
 func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (*download, error) {
-	// Lookup the file associated with the nickname.
-	entry, err := r.staticFileSet.Open(p.HyperspacePath)
-	if err != nil {
+	// Lookup the file associated with the nickname, or the requested version
+	// of the file.
+	siaPath := p.HyperspacePath
+	if p.Version != "" {
+		if err := validateSiapath(siaPath); err != nil {
+			return nil, err
+		}
+		if _, err := parseVersionID(p.Version); err != nil {
+			return nil, err
+		}
+		siaPath = versionSiaPath(siaPath, p.Version)
+	}
+	entry, err := r.staticFileSet.Open(siaPath)
+	if p.Version != "" && err == siafile.ErrUnknownPath {
+		return nil, errUnknownVersion
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -383,11 +396,26 @@ func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (*download,
 	}
 
 	// Create the download object.
+	snap, err := r.managedSnapshot(entry)
+	if err != nil {
+		if closer, ok := dw.(io.Closer); ok {
+			err = errors.Compose(err, closer.Close())
+		}
+		return nil, err
+	}
+	// Downloads of entire files are verified if the checksum of the file is
+	// known.
+	dst := dw
+	var verifier *checksumDestination
+	if _, ok := snap.Checksum(); ok && p.Offset == 0 && p.Length == snap.Size() {
+		verifier = newChecksumDestination(dw, snap.ChunkSize())
+		dst = verifier
+	}
 	d, err := r.managedNewDownload(downloadParams{
-		destination:       dw,
+		destination:       dst,
 		destinationType:   destinationType,
 		destinationString: p.Destination,
-		file:              entry.SiaFile.Snapshot(),
+		file:              snap,
 
 		latencyTarget: 25e3 * time.Millisecond, // TODO: high default until full latency support is added.
 		length:        p.Length,
@@ -403,6 +431,19 @@ func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (*download,
 		return nil, err
 	}
 
+	// Verify the downloaded data before cleaning up. The complete funcs are
+	// called while the download's lock is held, which allows failing the
+	// download if the data doesn't match the checksum.
+	if verifier != nil {
+		d.OnComplete(func(err error) error {
+			if err != nil {
+				return nil
+			}
+			d.err = verifier.verify(snap)
+			return d.err
+		})
+	}
+
 	// Register some cleanup for when the download is done.
 	d.OnComplete(func(_ error) error {
 		// Update the access time.
@@ -416,6 +457,9 @@ func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (*download,
 		return err
 	})
 
+	// Report the progress of the download to the event subscribers.
+	r.managedTrackDownload(d, p.HyperspacePath)
+
 	// Add the download object to the download queue.
 	r.downloadHistoryMu.Lock()
 	r.downloadHistory = append(r.downloadHistory, d)
@@ -510,6 +554,13 @@ func (r *Renter) managedNewDownload(params downloadParams) (*download, error) {
 		}
 	}
 
+	// The chunks of packed files are cached by the path of their pack, since
+	// they are shared with other files.
+	cacheName := d.staticHyperspacePath
+	if packPath := params.file.PackPath(); packPath != "" {
+		cacheName = packPath
+	}
+
 	// Queue the downloads for each chunk.
 	writeOffset := int64(0) // where to write a chunk within the download destination.
 	d.chunksRemaining += maxChunk - minChunk + 1
@@ -520,9 +571,10 @@ func (r *Renter) managedNewDownload(params downloadParams) (*download, error) {
 			masterKey:   params.file.MasterKey(),
 
 			staticChunkIndex: i,
-			staticCacheID:    fmt.Sprintf("%v:%v", d.staticHyperspacePath, i),
+			staticCacheID:    fmt.Sprintf("%v:%v", cacheName, i),
 			staticChunkMap:   chunkMaps[i-minChunk],
 			staticChunkSize:  params.file.ChunkSize(),
+			staticLocalPath:  params.file.LocalPath(),
 			staticPieceSize:  params.file.PieceSize(),
 
 			// TODO: 25ms is just a guess for a good default. Really, we want to
@@ -561,6 +613,16 @@ func (r *Renter) managedNewDownload(params downloadParams) (*download, error) {
 		} else {
 			udc.staticFetchLength = params.file.ChunkSize() - udc.staticFetchOffset
 		}
+		// Set the range within the pieces that needs to be fetched. Only
+		// ciphers without overhead allow for decrypting a range of a piece
+		// and streamed chunks are fetched in full so that they can be cached,
+		// unless the whole file fits within a single piece.
+		udc.staticPieceOffset, udc.staticPieceLength = 0, udc.staticPieceSize
+		partial := udc.masterKey.Type().Overhead() == 0 &&
+			(params.destinationType != destinationTypeSeekStream || params.file.Size() <= udc.staticPieceSize)
+		if partial {
+			udc.staticPieceOffset, udc.staticPieceLength = pieceRange(udc.staticFetchOffset, udc.staticFetchLength, udc.staticPieceSize)
+		}
 		// Set the writeOffset within the destination for where the data should
 		// be written.
 		udc.staticWriteOffset = writeOffset
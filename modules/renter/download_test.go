@@ -300,3 +300,30 @@ func checkDownloadHistory(downloads []*download, check []int64) bool {
 	}
 	return true
 }
+
+// TestPieceRange tests that pieceRange only fetches a range of the pieces if
+// the requested data lies within a single data piece.
+func TestPieceRange(t *testing.T) {
+	pieceSize := uint64(4096)
+	tests := []struct {
+		fetchOffset, fetchLength uint64
+		pieceOffset, pieceLength uint64
+	}{
+		{0, 4096, 0, 4096},      // whole piece
+		{0, 8192, 0, 4096},      // multiple pieces
+		{4000, 200, 0, 4096},    // spans two pieces
+		{0, 100, 0, 128},        // start of piece
+		{100, 100, 64, 192},     // rounded to segments
+		{4096 + 64, 64, 64, 64}, // second piece, aligned
+		{8191, 1, 4032, 64},     // last byte of the second piece
+		{4000, 96, 3968, 128},   // end of piece
+		{0, 0, 0, 4096},         // nothing to fetch
+	}
+	for _, test := range tests {
+		off, length := pieceRange(test.fetchOffset, test.fetchLength, pieceSize)
+		if off != test.pieceOffset || length != test.pieceLength {
+			t.Errorf("pieceRange(%v, %v): expected (%v, %v), got (%v, %v)",
+				test.fetchOffset, test.fetchLength, test.pieceOffset, test.pieceLength, off, length)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package renter
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/HyperspaceApp/Hyperspace/build"
@@ -48,6 +50,9 @@ type unfinishedDownloadChunk struct {
 	staticChunkSize   uint64
 	staticFetchLength uint64 // Length within the logical chunk to fetch.
 	staticFetchOffset uint64 // Offset within the logical chunk that is being downloaded.
+	staticLocalPath   string // Local copy of the chunk's data, only set for packed files.
+	staticPieceLength uint64 // Length within each piece to fetch.
+	staticPieceOffset uint64 // Offset within each piece to start fetching from.
 	staticPieceSize   uint64
 	staticWriteOffset int64 // Offset within the writer to write the completed data.
 
@@ -82,6 +87,29 @@ type unfinishedDownloadChunk struct {
 	staticStreamCache *streamCache
 }
 
+// pieceRange returns the range within each piece of a chunk that needs to be
+// fetched to recover fetchLength bytes of the chunk starting at fetchOffset.
+// Since the data pieces of a chunk hold consecutive ranges of the chunk's data
+// and the erasure code works bytewise, a range that lies within a single data
+// piece can be recovered from the same range of any MinPieces pieces. The
+// range is rounded to whole segments, since hosts only serve those. Ranges
+// that span multiple data pieces require the whole pieces.
+func pieceRange(fetchOffset, fetchLength, pieceSize uint64) (pieceOffset, pieceLength uint64) {
+	if fetchLength == 0 || fetchOffset/pieceSize != (fetchOffset+fetchLength-1)/pieceSize {
+		return 0, pieceSize
+	}
+	start := fetchOffset % pieceSize
+	end := start + fetchLength
+	start -= start % crypto.SegmentSize
+	if end%crypto.SegmentSize != 0 {
+		end += crypto.SegmentSize - end%crypto.SegmentSize
+	}
+	if end > pieceSize {
+		end = pieceSize
+	}
+	return start, end - start
+}
+
 // fail will set the chunk status to failed. The physical chunk memory will be
 // wiped and any memory allocation will be returned to the renter. The download
 // as a whole will be failed as well.
@@ -174,19 +202,19 @@ func (udc *unfinishedDownloadChunk) markPieceCompleted(pieceIndex uint64) {
 func (udc *unfinishedDownloadChunk) returnMemory() {
 	// The maximum amount of memory is the pieces completed plus the number of
 	// workers remaining.
-	maxMemory := uint64(udc.workersRemaining+udc.piecesCompleted) * udc.staticPieceSize
+	maxMemory := uint64(udc.workersRemaining+udc.piecesCompleted) * udc.staticPieceLength
 	// If enough pieces have completed, max memory is the number of registered
 	// pieces plus the number of completed pieces.
 	if udc.piecesCompleted >= udc.erasureCode.MinPieces() {
 		// udc.piecesRegistered is guaranteed to be at most equal to the number
 		// of overdrive pieces, meaning it will be equal to or less than
 		// initialMemory.
-		maxMemory = uint64(udc.piecesCompleted+udc.piecesRegistered) * udc.staticPieceSize
+		maxMemory = uint64(udc.piecesCompleted+udc.piecesRegistered) * udc.staticPieceLength
 	}
 	// If the chunk recovery has completed, the maximum number of pieces is the
 	// number of registered.
 	if udc.recoveryComplete {
-		maxMemory = uint64(udc.piecesRegistered) * udc.staticPieceSize
+		maxMemory = uint64(udc.piecesRegistered) * udc.staticPieceLength
 	}
 	// Return any memory we don't need.
 	if uint64(udc.memoryAllocated) > maxMemory {
@@ -208,7 +236,8 @@ func (udc *unfinishedDownloadChunk) threadedRecoverLogicalData() error {
 	// TODO: Might be some way to recover into the downloadDestination instead
 	// of creating a buffer and then writing that.
 	recoverWriter := new(bytes.Buffer)
-	err := udc.erasureCode.Recover(udc.physicalChunkData, udc.staticChunkSize, recoverWriter)
+	recoverLength := udc.staticPieceLength * uint64(udc.erasureCode.MinPieces())
+	err := udc.erasureCode.Recover(udc.physicalChunkData, recoverLength, recoverWriter)
 	if err != nil {
 		udc.mu.Lock()
 		udc.fail(err)
@@ -223,17 +252,24 @@ func (udc *unfinishedDownloadChunk) threadedRecoverLogicalData() error {
 	// Get recovered data
 	recoveredData := recoverWriter.Bytes()
 
-	// Add the chunk to the cache.
-	if udc.download.staticDestinationType == destinationTypeSeekStream {
+	// Add the chunk to the cache. Only whole chunks can be cached.
+	fullChunk := udc.staticPieceLength == udc.staticPieceSize
+	if fullChunk && udc.download.staticDestinationType == destinationTypeSeekStream {
 		// We only cache streaming chunks since browsers and media players tend
 		// to only request a few kib at once when streaming data. That way we can
 		// prevent scheduling the same chunk for download over and over.
 		udc.staticStreamCache.Add(udc.staticCacheID, recoveredData)
 	}
 
-	// Write the bytes to the requested output.
+	// Write the bytes to the requested output. If only a range of the pieces
+	// was fetched, the recovered data consists of that range of every data
+	// piece.
 	start := udc.staticFetchOffset
-	end := udc.staticFetchOffset + udc.staticFetchLength
+	if !fullChunk {
+		dataPiece := udc.staticFetchOffset / udc.staticPieceSize
+		start = dataPiece*udc.staticPieceLength + udc.staticFetchOffset%udc.staticPieceSize - udc.staticPieceOffset
+	}
+	end := start + udc.staticFetchLength
 	_, err = udc.destination.WriteAt(recoveredData[start:end], udc.staticWriteOffset)
 	if err != nil {
 		udc.mu.Lock()
@@ -262,3 +298,41 @@ func (udc *unfinishedDownloadChunk) threadedRecoverLogicalData() error {
 	}
 	return nil
 }
+
+// managedReadLocal tries to read the chunk's data from its local copy instead
+// of downloading it. This is required for packed files whose pack hasn't been
+// uploaded yet. If the local copy is not available, false is returned and the
+// chunk needs to be downloaded from the hosts.
+func (udc *unfinishedDownloadChunk) managedReadLocal() bool {
+	if udc.staticLocalPath == "" {
+		return false
+	}
+	f, err := os.Open(udc.staticLocalPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	data := make([]byte, udc.staticFetchLength)
+	off := int64(udc.staticChunkIndex*udc.staticChunkSize + udc.staticFetchOffset)
+	if _, err := f.ReadAt(data, off); err != nil {
+		return false
+	}
+
+	udc.mu.Lock()
+	defer udc.mu.Unlock()
+	_, err = udc.destination.WriteAt(data, udc.staticWriteOffset)
+	if err != nil {
+		udc.fail(errors.AddContext(err, "failed to write local chunk to destination"))
+		return true
+	}
+	atomic.AddUint64(&udc.download.atomicDataReceived, udc.staticFetchLength)
+
+	// Check if the download is complete now.
+	udc.download.mu.Lock()
+	defer udc.download.mu.Unlock()
+	udc.download.chunksRemaining--
+	if udc.download.chunksRemaining == 0 {
+		udc.download.markComplete()
+	}
+	return true
+}
@@ -69,7 +69,7 @@ func (r *Renter) managedAcquireMemoryForDownloadChunk(udc *unfinishedDownloadChu
 	// need extra memory to decode a bunch of pieces, though I do not believe
 	// our erasure coding has been optimized around this yet, so we may actually
 	// go over the memory limits when we decode pieces.
-	memoryRequired := uint64(udc.staticOverdrive+udc.erasureCode.MinPieces()) * udc.staticPieceSize
+	memoryRequired := uint64(udc.staticOverdrive+udc.erasureCode.MinPieces()) * udc.staticPieceLength
 	udc.memoryAllocated = memoryRequired
 	return r.memoryManager.Request(memoryRequired, memoryPriorityHigh)
 }
@@ -199,6 +199,11 @@ LOOP:
 			if r.staticStreamCache.Retrieve(nextChunk) {
 				continue
 			}
+			// Check if the chunk belongs to a pack that is still available
+			// locally.
+			if nextChunk.managedReadLocal() {
+				continue
+			}
 
 			// Get the required memory to download this chunk.
 			if !r.managedAcquireMemoryForDownloadChunk(nextChunk) {
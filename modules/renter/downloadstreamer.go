@@ -41,9 +41,13 @@ func (r *Renter) Streamer(siaPath string) (string, modules.Streamer, error) {
 	if err != nil {
 		return "", nil, err
 	}
+	snap, err := r.managedSnapshot(entry)
+	if err != nil {
+		return "", nil, errors.Compose(err, entry.Close())
+	}
 	// Create the streamer
 	s := &streamer{
-		staticFile:      entry.Snapshot(),
+		staticFile:      snap,
 		staticFileEntry: entry,
 		r:               r,
 	}
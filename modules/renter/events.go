@@ -0,0 +1,202 @@
+package renter
+
+// events.go sends the events of the renter to the subscribers added with
+// EventSubscribe. Chunk uploads are reported by the upload code once a chunk is
+// released, downloads are reported for the downloads started by the user, and
+// the contract events are forwarded from the contractor.
+//
+// A file is reported as fully redundant when the upload of one of its chunks
+// brings its health to 0, and as degraded when a health check finds it less
+// healthy than before. This requires remembering the last known health of
+// every file, which is only done while there are subscribers. Events about the
+// hidden directories are never sent.
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+// eventBroadcaster sends the events of the renter to its subscribers.
+type eventBroadcaster struct {
+	// fileHealth maps the siapaths of the files to their last known health.
+	fileHealth  map[string]float64
+	subscribers []modules.RenterEventSubscriber
+	mu          sync.Mutex
+}
+
+// newEventBroadcaster returns an eventBroadcaster without subscribers.
+func newEventBroadcaster() *eventBroadcaster {
+	return &eventBroadcaster{
+		fileHealth: make(map[string]float64),
+	}
+}
+
+// ReceiveRenterEvent implements modules.RenterEventSubscriber, which allows
+// the broadcaster to forward the events of the contractor.
+func (eb *eventBroadcaster) ReceiveRenterEvent(event modules.RenterEvent) {
+	eb.managedNotify(event)
+}
+
+// managedActive returns whether the broadcaster has subscribers.
+func (eb *eventBroadcaster) managedActive() bool {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	return len(eb.subscribers) > 0
+}
+
+// managedNotify sends event to the subscribers.
+func (eb *eventBroadcaster) managedNotify(event modules.RenterEvent) {
+	if isHiddenPath(event.HyperspacePath) {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	for _, subscriber := range eb.subscribers {
+		subscriber.ReceiveRenterEvent(event)
+	}
+}
+
+// managedUpdateFileHealth records the health of the file at siaPath. It
+// reports the file as degraded if it is less healthy than before, and as fully
+// redundant if uploaded is true and the file just reached full redundancy.
+func (eb *eventBroadcaster) managedUpdateFileHealth(siaPath string, health float64, uploaded bool) {
+	if isHiddenPath(siaPath) {
+		return
+	}
+	eb.mu.Lock()
+	if len(eb.subscribers) == 0 {
+		eb.mu.Unlock()
+		return
+	}
+	prevHealth, known := eb.fileHealth[siaPath]
+	eb.fileHealth[siaPath] = health
+	eb.mu.Unlock()
+
+	event := modules.RenterEvent{
+		HyperspacePath: siaPath,
+		Health:         health,
+		PreviousHealth: prevHealth,
+	}
+	if known && health > prevHealth {
+		event.Type = modules.RenterEventFileHealthDegraded
+		eb.managedNotify(event)
+	} else if uploaded && health == 0 && (!known || prevHealth > 0) {
+		event.Type = modules.RenterEventFileRedundant
+		eb.managedNotify(event)
+	}
+}
+
+// managedForgetFile removes the file at siaPath from the known file healths.
+func (eb *eventBroadcaster) managedForgetFile(siaPath string) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	delete(eb.fileHealth, siaPath)
+}
+
+// EventSubscribe adds a subscriber that will be notified of the events of the
+// renter.
+func (r *Renter) EventSubscribe(subscriber modules.RenterEventSubscriber) {
+	r.staticEvents.mu.Lock()
+	defer r.staticEvents.mu.Unlock()
+	r.staticEvents.subscribers = append(r.staticEvents.subscribers, subscriber)
+}
+
+// EventUnsubscribe removes a subscriber that was added with EventSubscribe.
+func (r *Renter) EventUnsubscribe(subscriber modules.RenterEventSubscriber) {
+	eb := r.staticEvents
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	for i := range eb.subscribers {
+		if eb.subscribers[i] == subscriber {
+			eb.subscribers = append(eb.subscribers[:i], eb.subscribers[i+1:]...)
+			break
+		}
+	}
+	// The known file healths are outdated by the time the next subscriber
+	// arrives.
+	if len(eb.subscribers) == 0 {
+		eb.fileHealth = make(map[string]float64)
+	}
+}
+
+// managedNotifyChunkUploaded sends the events for a chunk of entry that has
+// been uploaded to pieces hosts.
+func (r *Renter) managedNotifyChunkUploaded(entry *siafile.SiaFileSetEntry, index uint64, pieces int) {
+	siaPath := entry.HyperspacePath()
+	if isHiddenPath(siaPath) || !r.staticEvents.managedActive() {
+		return
+	}
+	r.staticEvents.managedNotify(modules.RenterEvent{
+		Type:           modules.RenterEventChunkUploaded,
+		HyperspacePath: siaPath,
+		ChunkIndex:     index,
+		Pieces:         pieces,
+	})
+
+	pks := make(map[string]types.SiaPublicKey)
+	for _, pk := range entry.HostPublicKeys() {
+		pks[string(pk.Key)] = pk
+	}
+	offline, goodForRenew, _ := r.managedContractStatus(pks)
+	r.staticEvents.managedUpdateFileHealth(siaPath, entry.Health(offline, goodForRenew), true)
+}
+
+// managedTrackDownload sends the events of d, a download of the file at
+// siaPath that was started by the user. It must be called before d can
+// complete.
+func (r *Renter) managedTrackDownload(d *download, siaPath string) {
+	newEvent := func(eventType modules.RenterEventType) modules.RenterEvent {
+		return modules.RenterEvent{
+			Type:           eventType,
+			HyperspacePath: siaPath,
+			Destination:    d.destinationString,
+			Length:         d.staticLength,
+			Received:       atomic.LoadUint64(&d.atomicDataReceived),
+		}
+	}
+	d.OnComplete(func(err error) error {
+		event := newEvent(modules.RenterEventDownloadCompleted)
+		if err != nil {
+			event.Type = modules.RenterEventDownloadFailed
+			event.Error = err.Error()
+		}
+		r.staticEvents.managedNotify(event)
+		return nil
+	})
+	r.staticEvents.managedNotify(newEvent(modules.RenterEventDownloadStarted))
+	go r.threadedDownloadProgress(d, newEvent)
+}
+
+// threadedDownloadProgress periodically reports the progress of d until the
+// download completes.
+func (r *Renter) threadedDownloadProgress(d *download, newEvent func(modules.RenterEventType) modules.RenterEvent) {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	var lastReceived uint64
+	for {
+		select {
+		case <-time.After(downloadEventInterval):
+		case <-d.completeChan:
+			return
+		case <-r.tg.StopChan():
+			return
+		}
+		event := newEvent(modules.RenterEventDownloadProgress)
+		if event.Received == lastReceived {
+			continue
+		}
+		lastReceived = event.Received
+		r.staticEvents.managedNotify(event)
+	}
+}
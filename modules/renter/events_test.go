@@ -0,0 +1,84 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+)
+
+// eventRecorder is a RenterEventSubscriber that records every event it
+// receives.
+type eventRecorder struct {
+	events []modules.RenterEvent
+}
+
+// ReceiveRenterEvent implements modules.RenterEventSubscriber.
+func (er *eventRecorder) ReceiveRenterEvent(event modules.RenterEvent) {
+	er.events = append(er.events, event)
+}
+
+// TestEventBroadcasterFileHealth tests that the broadcaster reports files
+// that reach full redundancy or degrade.
+func TestEventBroadcasterFileHealth(t *testing.T) {
+	eb := newEventBroadcaster()
+	r := &Renter{staticEvents: eb}
+
+	// Without subscribers the healths aren't tracked.
+	eb.managedUpdateFileHealth("foo", 0.5, false)
+	if len(eb.fileHealth) != 0 {
+		t.Fatal("health was tracked without subscribers")
+	}
+
+	er := new(eventRecorder)
+	r.EventSubscribe(er)
+	expect := func(types ...modules.RenterEventType) {
+		t.Helper()
+		if len(er.events) != len(types) {
+			t.Fatalf("expected %v events, got %v", len(types), len(er.events))
+		}
+		for i, event := range er.events {
+			if event.Type != types[i] {
+				t.Errorf("expected event %v to be %v, got %v", i, types[i], event.Type)
+			}
+			if event.Timestamp.IsZero() {
+				t.Errorf("event %v has no timestamp", i)
+			}
+		}
+		er.events = nil
+	}
+
+	// The first health check of a file doesn't send events.
+	eb.managedUpdateFileHealth("foo", 0.5, false)
+	expect()
+	// Uploads that don't complete the file don't either.
+	eb.managedUpdateFileHealth("foo", 0.25, true)
+	expect()
+	eb.managedUpdateFileHealth("foo", 0, true)
+	expect(modules.RenterEventFileRedundant)
+	eb.managedUpdateFileHealth("foo", 0, true)
+	expect()
+	eb.managedUpdateFileHealth("foo", 0.1, false)
+	expect(modules.RenterEventFileHealthDegraded)
+	eb.managedUpdateFileHealth("foo", 0.2, false)
+	expect(modules.RenterEventFileHealthDegraded)
+
+	// Files in hidden directories are ignored.
+	eb.managedUpdateFileHealth(versionSiaPath("foo", "1"), 0, true)
+	eb.managedNotify(modules.RenterEvent{
+		Type:           modules.RenterEventChunkUploaded,
+		HyperspacePath: packDir + "/1",
+	})
+	expect()
+
+	// Contract events are forwarded.
+	eb.ReceiveRenterEvent(modules.RenterEvent{Type: modules.RenterEventContractFormed})
+	expect(modules.RenterEventContractFormed)
+
+	// Removing the last subscriber forgets the healths.
+	r.EventUnsubscribe(er)
+	if len(eb.fileHealth) != 0 {
+		t.Fatal("healths weren't forgotten")
+	}
+	eb.managedNotify(modules.RenterEvent{Type: modules.RenterEventContractFormed})
+	expect()
+}
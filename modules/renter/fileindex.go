@@ -0,0 +1,398 @@
+package renter
+
+// fileindex.go implements the file index, which stores the properties of the
+// renter's files that queries filter by: the size, creation and modification
+// time, health and user metadata of every file. It is persisted in the
+// renter's persist directory, so QueryFiles only needs to open the siafiles
+// that match a query.
+//
+// The index is updated whenever the renter bubbles the health of a new,
+// renamed or restored file, and when files and directories are deleted or
+// renamed. The health of a file in the index is the health as of its last
+// health check. Every health check of a directory also replaces the entries of
+// the files in that directory, so the index catches up with changes it missed,
+// e.g. because of a crash. If the index doesn't exist yet it is built from the
+// siafiles on startup. Files in the hidden directories are not indexed.
+//
+// Updates only change the index in memory. The index is saved every
+// fileIndexSaveInterval if it changed, and on shutdown, so bubbling the health
+// of many files doesn't rewrite the index for every file. Changes that weren't
+// saved before a crash are recovered by the health checks of the directories,
+// and QueryFiles skips files that no longer exist.
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/persist"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/errors"
+)
+
+const (
+	// fileIndexFile is the name of the file that persists the file index.
+	fileIndexFile = "fileindex.json"
+
+	// maxFileMetadataSize is the maximum combined size of the content type,
+	// keys and values of the user metadata of a file.
+	maxFileMetadataSize = 4096
+
+	// maxFileMetadataTags is the maximum number of tags of a file.
+	maxFileMetadataTags = 64
+)
+
+var (
+	// errFileMetadataTooLarge is returned if the user metadata of a file
+	// exceeds the limits.
+	errFileMetadataTooLarge = errors.New("file metadata is too large")
+
+	// errEmptyMetadataKey is returned if a tag of a file has an empty key.
+	errEmptyMetadataKey = errors.New("file metadata keys can't be empty")
+
+	// fileIndexMetadata is the header of the file index.
+	fileIndexMetadata = persist.Metadata{
+		Header:  "Renter File Index",
+		Version: persistVersion,
+	}
+)
+
+type (
+	// fileIndex maps the siapaths of the renter's files to their index
+	// entries.
+	fileIndex struct {
+		files map[string]fileIndexEntry
+		path  string
+
+		// dirty is set if the index changed since it was last saved.
+		dirty bool
+		mu    sync.Mutex
+	}
+
+	// fileIndexEntry holds the properties of a file that queries filter by.
+	fileIndexEntry struct {
+		ContentType string            `json:"contenttype"`
+		CreateTime  time.Time         `json:"createtime"`
+		Filesize    uint64            `json:"filesize"`
+		Health      float64           `json:"health"`
+		Metadata    map[string]string `json:"metadata"`
+		ModTime     time.Time         `json:"modtime"`
+	}
+)
+
+// validateFileMetadata checks that the user metadata of a file is within the
+// limits.
+func validateFileMetadata(contentType string, metadata map[string]string) error {
+	if len(metadata) > maxFileMetadataTags {
+		return errFileMetadataTooLarge
+	}
+	size := len(contentType)
+	for k, v := range metadata {
+		if k == "" {
+			return errEmptyMetadataKey
+		}
+		size += len(k) + len(v)
+	}
+	if size > maxFileMetadataSize {
+		return errFileMetadataTooLarge
+	}
+	return nil
+}
+
+// loadFileIndex loads the file index persisted at path. An empty index is
+// returned if it wasn't persisted yet, together with false.
+func loadFileIndex(path string) (*fileIndex, bool, error) {
+	fi := &fileIndex{
+		files: make(map[string]fileIndexEntry),
+		path:  path,
+	}
+	err := persist.LoadJSON(fileIndexMetadata, &fi.files, path)
+	if os.IsNotExist(err) {
+		return fi, false, nil
+	}
+	return fi, true, err
+}
+
+// newFileIndexEntry returns the index entry of a file with the given health.
+func newFileIndexEntry(entry *siafile.SiaFileSetEntry, health float64) fileIndexEntry {
+	return fileIndexEntry{
+		ContentType: entry.ContentType(),
+		CreateTime:  entry.CreateTime(),
+		Filesize:    entry.Size(),
+		Health:      health,
+		Metadata:    entry.UserMetadata(),
+		ModTime:     entry.ModTime(),
+	}
+}
+
+// equal returns whether two index entries are equal.
+func (e fileIndexEntry) equal(e2 fileIndexEntry) bool {
+	if e.ContentType != e2.ContentType || !e.CreateTime.Equal(e2.CreateTime) || e.Filesize != e2.Filesize ||
+		e.Health != e2.Health || !e.ModTime.Equal(e2.ModTime) || len(e.Metadata) != len(e2.Metadata) {
+		return false
+	}
+	for k, v := range e.Metadata {
+		if v2, ok := e2.Metadata[k]; !ok || v != v2 {
+			return false
+		}
+	}
+	return true
+}
+
+// matches returns whether the file at siaPath with the index entry matches
+// the query.
+func (e fileIndexEntry) matches(siaPath string, q modules.FileQuery) bool {
+	switch {
+	case !strings.HasPrefix(siaPath, q.Prefix):
+		return false
+	case q.ContentType != "" && e.ContentType != q.ContentType:
+		return false
+	case e.Filesize < q.MinSize || (q.MaxSize > 0 && e.Filesize > q.MaxSize):
+		return false
+	case q.MinHealth != nil && e.Health < *q.MinHealth:
+		return false
+	case q.MaxHealth != nil && e.Health > *q.MaxHealth:
+		return false
+	case !q.CreatedAfter.IsZero() && !e.CreateTime.After(q.CreatedAfter):
+		return false
+	case !q.CreatedBefore.IsZero() && !e.CreateTime.Before(q.CreatedBefore):
+		return false
+	case !q.ModifiedAfter.IsZero() && !e.ModTime.After(q.ModifiedAfter):
+		return false
+	case !q.ModifiedBefore.IsZero() && !e.ModTime.Before(q.ModifiedBefore):
+		return false
+	}
+	for k, v := range q.Tags {
+		if value, ok := e.Metadata[k]; !ok || (v != "" && value != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// save persists the file index. The caller must hold the lock.
+func (fi *fileIndex) save() error {
+	if err := persist.SaveJSON(fileIndexMetadata, fi.files, fi.path); err != nil {
+		return err
+	}
+	fi.dirty = false
+	return nil
+}
+
+// managedSave persists the file index if it changed since it was last saved.
+func (fi *fileIndex) managedSave() error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if !fi.dirty {
+		return nil
+	}
+	return fi.save()
+}
+
+// managedUpdate replaces the index entry of the file at siaPath.
+func (fi *fileIndex) managedUpdate(siaPath string, entry fileIndexEntry) {
+	if isHiddenPath(siaPath) {
+		return
+	}
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if old, exists := fi.files[siaPath]; exists && old.equal(entry) {
+		return
+	}
+	fi.files[siaPath] = entry
+	fi.dirty = true
+}
+
+// managedUpdateDir replaces the index entries of the files directly inside the
+// directory at dir with entries.
+func (fi *fileIndex) managedUpdateDir(dir string, entries map[string]fileIndexEntry) {
+	if isHiddenPath(dir) {
+		return
+	}
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	for siaPath := range fi.files {
+		if _, exists := entries[siaPath]; !exists && dirSiaPath(siaPath) == dir {
+			delete(fi.files, siaPath)
+			fi.dirty = true
+		}
+	}
+	for siaPath, entry := range entries {
+		if old, exists := fi.files[siaPath]; !exists || !old.equal(entry) {
+			fi.files[siaPath] = entry
+			fi.dirty = true
+		}
+	}
+}
+
+// managedRemove removes the file at siaPath from the index.
+func (fi *fileIndex) managedRemove(siaPath string) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if _, exists := fi.files[siaPath]; !exists {
+		return
+	}
+	delete(fi.files, siaPath)
+	fi.dirty = true
+}
+
+// managedRemoveDir removes the files below the directory at dir from the
+// index.
+func (fi *fileIndex) managedRemoveDir(dir string) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	for siaPath := range fi.files {
+		if strings.HasPrefix(siaPath, dir+"/") {
+			delete(fi.files, siaPath)
+			fi.dirty = true
+		}
+	}
+}
+
+// managedRenameDir moves the index entries of the files below the directory
+// at oldDir to the directory at newDir.
+func (fi *fileIndex) managedRenameDir(oldDir, newDir string) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	moved := make(map[string]fileIndexEntry)
+	for siaPath, entry := range fi.files {
+		if strings.HasPrefix(siaPath, oldDir+"/") {
+			moved[newDir+strings.TrimPrefix(siaPath, oldDir)] = entry
+			delete(fi.files, siaPath)
+		}
+	}
+	for siaPath, entry := range moved {
+		fi.files[siaPath] = entry
+		fi.dirty = true
+	}
+}
+
+// managedQuery returns the sorted siapaths of the files that match the query.
+func (fi *fileIndex) managedQuery(q modules.FileQuery) []string {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	var siaPaths []string
+	for siaPath, entry := range fi.files {
+		if entry.matches(siaPath, q) {
+			siaPaths = append(siaPaths, siaPath)
+		}
+	}
+	sort.Strings(siaPaths)
+	return siaPaths
+}
+
+// managedIndexFile updates the index entry of entry, a file with the given
+// health.
+func (r *Renter) managedIndexFile(entry *siafile.SiaFileSetEntry, health float64) {
+	r.staticFileIndex.managedUpdate(entry.HyperspacePath(), newFileIndexEntry(entry, health))
+}
+
+// threadedSaveFileIndex periodically saves the changes to the file index.
+func (r *Renter) threadedSaveFileIndex() {
+	err := r.tg.Add()
+	if err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	for {
+		select {
+		case <-time.After(fileIndexSaveInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+		if err := r.staticFileIndex.managedSave(); err != nil {
+			r.log.Println("WARN: Could not save the file index:", err)
+		}
+	}
+}
+
+// managedRebuildFileIndex builds the file index from the siafiles.
+func (r *Renter) managedRebuildFileIndex() error {
+	siaPaths, err := r.managedFilesBelow("")
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]fileIndexEntry)
+	for _, siaPath := range siaPaths {
+		if isHiddenPath(siaPath) {
+			continue
+		}
+		entry, err := r.staticFileSet.Open(siaPath)
+		if err != nil {
+			r.log.Println("WARN: Could not open file to index it:", err)
+			continue
+		}
+		pks := make(map[string]types.SiaPublicKey)
+		for _, pk := range entry.HostPublicKeys() {
+			pks[string(pk.Key)] = pk
+		}
+		offline, goodForRenew, _ := r.managedContractStatus(pks)
+		entries[siaPath] = newFileIndexEntry(entry, entry.Health(offline, goodForRenew))
+		if err := entry.Close(); err != nil {
+			r.log.Debugln("WARN: Could not close thread:", err)
+		}
+	}
+	fi := r.staticFileIndex
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.files = entries
+	return fi.save()
+}
+
+// SetFileMetadata replaces the content type and the key/value tags of the file
+// at siaPath.
+func (r *Renter) SetFileMetadata(siaPath, contentType string, metadata map[string]string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := validateSiapath(siaPath); err != nil {
+		return err
+	}
+	if err := validateFileMetadata(contentType, metadata); err != nil {
+		return err
+	}
+	entry, err := r.staticFileSet.Open(siaPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	if err := entry.SetUserMetadata(contentType, metadata); err != nil {
+		return err
+	}
+
+	// Keep the health of the file's index entry, it is updated by the next
+	// health check.
+	r.staticFileIndex.mu.Lock()
+	health := r.staticFileIndex.files[siaPath].Health
+	r.staticFileIndex.mu.Unlock()
+	r.managedIndexFile(entry, health)
+	return nil
+}
+
+// QueryFiles returns the files that match the query, sorted by their
+// hyperspace path.
+func (r *Renter) QueryFiles(q modules.FileQuery) ([]modules.FileInfo, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	q.Prefix = strings.TrimPrefix(q.Prefix, "/")
+	files := []modules.FileInfo{}
+	for _, siaPath := range r.staticFileIndex.managedQuery(q) {
+		fi, err := r.managedFileInfo(siaPath)
+		if err == siafile.ErrUnknownPath {
+			// The file was deleted in the meantime.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		files = append(files, fi)
+	}
+	return files, nil
+}
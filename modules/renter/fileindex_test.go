@@ -0,0 +1,158 @@
+package renter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+)
+
+// TestValidateFileMetadata tests the limits of the user metadata of a file.
+func TestValidateFileMetadata(t *testing.T) {
+	if err := validateFileMetadata("text/plain", map[string]string{"foo": "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateFileMetadata("", map[string]string{"": "bar"}); err != errEmptyMetadataKey {
+		t.Fatal("expected errEmptyMetadataKey, got", err)
+	}
+	large := map[string]string{"foo": strings.Repeat("a", maxFileMetadataSize)}
+	if err := validateFileMetadata("", large); err != errFileMetadataTooLarge {
+		t.Fatal("expected errFileMetadataTooLarge, got", err)
+	}
+	many := make(map[string]string)
+	for i := 0; i <= maxFileMetadataTags; i++ {
+		many[string(rune('a'+i))] = ""
+	}
+	if err := validateFileMetadata("", many); err != errFileMetadataTooLarge {
+		t.Fatal("expected errFileMetadataTooLarge, got", err)
+	}
+}
+
+// TestFileIndexEntryMatches tests matching index entries against queries.
+func TestFileIndexEntryMatches(t *testing.T) {
+	now := time.Now()
+	entry := fileIndexEntry{
+		ContentType: "image/png",
+		CreateTime:  now.Add(-time.Hour),
+		Filesize:    1000,
+		Health:      0.5,
+		Metadata:    map[string]string{"project": "foo", "draft": ""},
+		ModTime:     now,
+	}
+	zero, half := 0.0, 0.5
+	tests := []struct {
+		q       modules.FileQuery
+		matches bool
+	}{
+		{modules.FileQuery{}, true},
+		{modules.FileQuery{Prefix: "photos/"}, true},
+		{modules.FileQuery{Prefix: "docs/"}, false},
+		{modules.FileQuery{ContentType: "image/png"}, true},
+		{modules.FileQuery{ContentType: "text/plain"}, false},
+		{modules.FileQuery{MinSize: 1000, MaxSize: 1000}, true},
+		{modules.FileQuery{MinSize: 1001}, false},
+		{modules.FileQuery{MaxSize: 999}, false},
+		{modules.FileQuery{MinHealth: &half, MaxHealth: &half}, true},
+		{modules.FileQuery{MaxHealth: &zero}, false},
+		{modules.FileQuery{CreatedAfter: now.Add(-2 * time.Hour), CreatedBefore: now}, true},
+		{modules.FileQuery{CreatedAfter: now.Add(-time.Hour)}, false},
+		{modules.FileQuery{ModifiedBefore: now}, false},
+		{modules.FileQuery{ModifiedAfter: now.Add(-time.Minute)}, true},
+		{modules.FileQuery{Tags: map[string]string{"project": "foo"}}, true},
+		{modules.FileQuery{Tags: map[string]string{"project": ""}}, true},
+		{modules.FileQuery{Tags: map[string]string{"project": "bar"}}, false},
+		{modules.FileQuery{Tags: map[string]string{"project": "foo", "owner": ""}}, false},
+	}
+	for i, test := range tests {
+		if entry.matches("photos/a.png", test.q) != test.matches {
+			t.Errorf("test %v: expected matches to be %v", i, test.matches)
+		}
+	}
+}
+
+// TestFileIndex tests updating, querying and saving the file index.
+func TestFileIndex(t *testing.T) {
+	dir := build.TempDir("renter", t.Name())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, fileIndexFile)
+	fi, exists, err := loadFileIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if exists {
+		t.Fatal("index shouldn't exist yet")
+	}
+
+	tagged := fileIndexEntry{Metadata: map[string]string{"project": "foo"}}
+	for _, siaPath := range []string{"a", "dir/b", "dir/c", "dir/sub/d", versionSiaPath("a", "1")} {
+		fi.managedUpdate(siaPath, tagged)
+	}
+	query := modules.FileQuery{Tags: tagged.Metadata}
+	if files := fi.managedQuery(query); !reflect.DeepEqual(files, []string{"a", "dir/b", "dir/c", "dir/sub/d"}) {
+		t.Fatal("unexpected query result", files)
+	}
+
+	// Updates are only persisted once the index is saved.
+	if _, exists, err := loadFileIndex(path); err != nil || exists {
+		t.Fatal("index was saved before managedSave", exists, err)
+	}
+	if err := fi.managedSave(); err != nil {
+		t.Fatal(err)
+	}
+	fi2, exists, err := loadFileIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if !exists {
+		t.Fatal("index wasn't persisted")
+	}
+	if !reflect.DeepEqual(fi2.files, fi.files) {
+		t.Fatal("persisted index doesn't match", fi2.files)
+	}
+
+	// Updates that don't change the index don't mark it as changed.
+	fi.managedUpdate("a", tagged)
+	fi.managedRemove("missing")
+	fi.managedUpdate(versionSiaPath("dir/b", "1"), tagged)
+	if fi.dirty {
+		t.Fatal("index was marked as changed")
+	}
+
+	// A health check of dir replaces the files directly inside it.
+	fi.managedUpdateDir("dir", map[string]fileIndexEntry{
+		"dir/c": {},
+		"dir/e": tagged,
+	})
+	if files := fi.managedQuery(query); !reflect.DeepEqual(files, []string{"a", "dir/e", "dir/sub/d"}) {
+		t.Fatal("unexpected query result", files)
+	}
+
+	fi.managedRenameDir("dir", "moved")
+	if files := fi.managedQuery(query); !reflect.DeepEqual(files, []string{"a", "moved/e", "moved/sub/d"}) {
+		t.Fatal("unexpected query result", files)
+	}
+	fi.managedRemoveDir("moved")
+	fi.managedRemove("a")
+	if !fi.dirty {
+		t.Fatal("index wasn't marked as changed")
+	}
+	if err := fi.managedSave(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The index is persisted.
+	fi2, exists, err = loadFileIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if !exists {
+		t.Fatal("index wasn't persisted")
+	}
+	if !reflect.DeepEqual(fi2.files, fi.files) || len(fi2.files) != 0 {
+		t.Fatal("persisted index doesn't match", fi2.files)
+	}
+}
@@ -3,7 +3,9 @@ package renter
 import (
 	"os"
 	"regexp"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/HyperspaceApp/Hyperspace/crypto"
 	"github.com/HyperspaceApp/Hyperspace/modules"
@@ -60,9 +62,63 @@ type pieceData struct {
 }
 
 // DeleteFile removes a file entry from the renter and deletes its data from
-// the hosts it is stored on.
+// the hosts it is stored on. Versioned files are kept as a version instead.
 func (r *Renter) DeleteFile(nickname string) error {
-	return r.staticFileSet.Delete(nickname)
+	if isPackPath(nickname) {
+		return errPackPath
+	}
+	if isVersionPath(nickname) {
+		return errVersionPath
+	}
+	if r.managedVersionPolicy(nickname) != (modules.VersionPolicy{}) {
+		if err := r.managedArchiveFile(nickname); err != nil {
+			return err
+		}
+		if err := r.managedPruneVersions(nickname); err != nil {
+			r.log.Println("WARN: Could not expire the versions of", nickname, err)
+		}
+		return nil
+	}
+	return r.managedDeleteFile(nickname)
+}
+
+// PurgeFile removes a file entry from the renter and deletes its data from the
+// hosts it is stored on, without keeping a version of it.
+func (r *Renter) PurgeFile(nickname string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if isPackPath(nickname) {
+		return errPackPath
+	}
+	if isVersionPath(nickname) {
+		return errVersionPath
+	}
+	return r.managedDeleteFile(nickname)
+}
+
+// managedDeleteFile removes a file entry from the renter and releases its
+// deduplicated chunks.
+func (r *Renter) managedDeleteFile(nickname string) error {
+	// Remember the deduplicated chunks of the file to release them once the
+	// file is deleted.
+	var dedupIDs []crypto.Hash
+	if entry, err := r.staticFileSet.Open(nickname); err == nil {
+		dedupIDs = entry.DedupIDs()
+		if err := entry.Close(); err != nil {
+			return err
+		}
+	}
+	if err := r.staticFileSet.Delete(nickname); err != nil {
+		return err
+	}
+	r.staticEvents.managedForgetFile(nickname)
+	r.staticFileIndex.managedRemove(nickname)
+	if err := r.managedUpdateDirHealth(dirSiaPath(nickname)); err != nil {
+		r.log.Println("WARN: Could not update the directory of", nickname, err)
+	}
+	return r.staticDedupIndex.managedRelease(dedupIDs)
 }
 
 // FileList returns all of the files that the renter has or a filtered list
@@ -82,6 +138,19 @@ func (r *Renter) FileList(filter ...*regexp.Regexp) []modules.FileInfo {
 		return []modules.FileInfo{}
 	}
 
+	// Hide the packs of packed files and the file versions.
+	var files []*siafile.SiaFileSetEntry
+	for _, entry := range entrys {
+		if !isHiddenPath(entry.HyperspacePath()) {
+			files = append(files, entry)
+		} else if err := entry.Close(); err != nil {
+			r.log.Debugln("WARN: Could not close thread:", err)
+		}
+	}
+	entrys = files
+	packs := r.managedOpenPacks(entrys)
+	defer r.closePacks(packs)
+
 	// Save host keys in map. We can't do that under the same lock since we
 	// need to call a public method on the file.
 	pks := make(map[string]types.SiaPublicKey)
@@ -90,47 +159,17 @@ func (r *Renter) FileList(filter ...*regexp.Regexp) []modules.FileInfo {
 			pks[string(pk.Key)] = pk
 		}
 	}
-
-	// Build 2 maps that map every pubkey to its offline and goodForRenew
-	// status.
-	goodForRenew := make(map[string]bool)
-	offline := make(map[string]bool)
-	contracts := make(map[string]modules.RenterContract)
-	for _, pk := range pks {
-		contract, ok := r.hostContractor.ContractByPublicKey(pk)
-		if !ok {
-			continue
+	for _, pack := range packs {
+		for _, pk := range pack.HostPublicKeys() {
+			pks[string(pk.Key)] = pk
 		}
-		goodForRenew[string(pk.Key)] = ok && contract.Utility.GoodForRenew
-		offline[string(pk.Key)] = r.hostContractor.IsOffline(pk)
-		contracts[string(pk.Key)] = contract
 	}
+	offline, goodForRenew, contracts := r.managedContractStatus(pks)
 
 	// Build the list of FileInfos.
 	fileList := []modules.FileInfo{}
 	for _, entry := range entrys {
-		localPath := entry.LocalPath()
-		_, err := os.Stat(localPath)
-		onDisk := !os.IsNotExist(err)
-		redundancy := entry.Redundancy(offline, goodForRenew)
-		fileList = append(fileList, modules.FileInfo{
-			AccessTime:     entry.AccessTime(),
-			Available:      entry.Available(offline),
-			ChangeTime:     entry.ChangeTime(),
-			CipherType:     entry.MasterKey().Type().String(),
-			CreateTime:     entry.CreateTime(),
-			Expiration:     entry.Expiration(contracts),
-			Filesize:       entry.Size(),
-			LocalPath:      localPath,
-			ModTime:        entry.ModTime(),
-			OnDisk:         onDisk,
-			Recoverable:    onDisk || redundancy >= 1,
-			Redundancy:     redundancy,
-			Renewing:       true,
-			HyperspacePath: entry.HyperspacePath(),
-			UploadedBytes:  entry.UploadedBytes(),
-			UploadProgress: entry.UploadProgress(),
-		})
+		fileList = append(fileList, fileInfo(entry, packs[entry.PackPath()], offline, goodForRenew, contracts))
 		err = entry.Close()
 		if err != nil {
 			r.log.Debugln("WARN: Could not close thread:", err)
@@ -139,22 +178,12 @@ func (r *Renter) FileList(filter ...*regexp.Regexp) []modules.FileInfo {
 	return fileList
 }
 
-// File returns file from siaPath queried by user.
-// Update based on FileList
-func (r *Renter) File(siaPath string) (modules.FileInfo, error) {
-	// Get the file and its contracts
-	entry, err := r.staticFileSet.Open(siaPath)
-	if err != nil {
-		return modules.FileInfo{}, err
-	}
-	defer entry.Close()
-	pks := entry.HostPublicKeys()
-
-	// Build 2 maps that map every contract id to its offline and goodForRenew
-	// status.
-	goodForRenew := make(map[string]bool)
-	offline := make(map[string]bool)
-	contracts := make(map[string]modules.RenterContract)
+// managedContractStatus builds 3 maps that map every pubkey in pks to its
+// offline and goodForRenew status and to the contract with the host.
+func (r *Renter) managedContractStatus(pks map[string]types.SiaPublicKey) (offline, goodForRenew map[string]bool, contracts map[string]modules.RenterContract) {
+	goodForRenew = make(map[string]bool)
+	offline = make(map[string]bool)
+	contracts = make(map[string]modules.RenterContract)
 	for _, pk := range pks {
 		contract, ok := r.hostContractor.ContractByPublicKey(pk)
 		if !ok {
@@ -164,36 +193,86 @@ func (r *Renter) File(siaPath string) (modules.FileInfo, error) {
 		offline[string(pk.Key)] = r.hostContractor.IsOffline(pk)
 		contracts[string(pk.Key)] = contract
 	}
+	return offline, goodForRenew, contracts
+}
 
-	// Build the FileInfo
-	renewing := true
+// fileInfo builds the FileInfo of a siafile from the status of the hosts it
+// is stored on. Packed files are stored in the chunks of their pack, which
+// needs to be passed in.
+func fileInfo(entry, pack *siafile.SiaFileSetEntry, offline, goodForRenew map[string]bool, contracts map[string]modules.RenterContract) modules.FileInfo {
 	localPath := entry.LocalPath()
-	_, err = os.Stat(localPath)
-	if err != nil && !os.IsNotExist(err) {
-		return modules.FileInfo{}, err
-	}
+	_, err := os.Stat(localPath)
 	onDisk := !os.IsNotExist(err)
-	redundancy := entry.Redundancy(offline, goodForRenew)
-	fileInfo := modules.FileInfo{
+	chunks := entry
+	uploadedBytes := entry.UploadedBytes()
+	if pack != nil {
+		chunks = pack
+		if pack.Size() > 0 {
+			uploadedBytes = pack.UploadedBytes() * entry.Size() / pack.Size()
+		}
+	}
+	redundancy := chunks.Redundancy(offline, goodForRenew)
+	numStuckChunks, stuckReason := stuckStatus(chunks)
+	return modules.FileInfo{
 		AccessTime:     entry.AccessTime(),
-		Available:      entry.Available(offline),
+		Available:      chunks.Available(offline),
 		ChangeTime:     entry.ChangeTime(),
 		CipherType:     entry.MasterKey().Type().String(),
+		ContentType:    entry.ContentType(),
 		CreateTime:     entry.CreateTime(),
-		Expiration:     entry.Expiration(contracts),
+		Expiration:     chunks.Expiration(contracts),
 		Filesize:       entry.Size(),
+		Health:         chunks.Health(offline, goodForRenew),
 		LocalPath:      localPath,
+		Metadata:       entry.UserMetadata(),
 		ModTime:        entry.ModTime(),
+		NumStuckChunks: numStuckChunks,
 		OnDisk:         onDisk,
 		Recoverable:    onDisk || redundancy >= 1,
 		Redundancy:     redundancy,
-		Renewing:       renewing,
+		Renewing:       true,
 		HyperspacePath: entry.HyperspacePath(),
-		UploadedBytes:  entry.UploadedBytes(),
-		UploadProgress: entry.UploadProgress(),
+		Stuck:          numStuckChunks > 0,
+		StuckReason:    stuckReason,
+		UploadedBytes:  uploadedBytes,
+		UploadProgress: chunks.UploadProgress(),
 	}
+}
 
-	return fileInfo, nil
+// File returns file from siaPath queried by user.
+// Update based on FileList
+func (r *Renter) File(siaPath string) (modules.FileInfo, error) {
+	if isHiddenPath(siaPath) {
+		return modules.FileInfo{}, siafile.ErrUnknownPath
+	}
+	return r.managedFileInfo(siaPath)
+}
+
+// managedFileInfo returns the file info of the file at siaPath.
+func (r *Renter) managedFileInfo(siaPath string) (modules.FileInfo, error) {
+	// Get the file and its contracts
+	entry, err := r.staticFileSet.Open(siaPath)
+	if err != nil {
+		return modules.FileInfo{}, err
+	}
+	defer entry.Close()
+	_, err = os.Stat(entry.LocalPath())
+	if err != nil && !os.IsNotExist(err) {
+		return modules.FileInfo{}, err
+	}
+	packs := r.managedOpenPacks([]*siafile.SiaFileSetEntry{entry})
+	defer r.closePacks(packs)
+	pks := make(map[string]types.SiaPublicKey)
+	for _, pk := range entry.HostPublicKeys() {
+		pks[string(pk.Key)] = pk
+	}
+	for _, pack := range packs {
+		for _, pk := range pack.HostPublicKeys() {
+			pks[string(pk.Key)] = pk
+		}
+	}
+	offline, goodForRenew, contracts := r.managedContractStatus(pks)
+	return fileInfo(entry, packs[entry.PackPath()], offline, goodForRenew, contracts), nil
 }
 
 // RenameFile takes an existing file and changes the nickname. The original
@@ -204,7 +283,135 @@ func (r *Renter) RenameFile(currentName, newName string) error {
 	if err != nil {
 		return err
 	}
-	return r.staticFileSet.Rename(currentName, newName)
+	if isPackPath(currentName) {
+		return errPackPath
+	}
+	if isVersionPath(currentName) {
+		return errVersionPath
+	}
+	err = r.staticFileSet.Rename(currentName, newName)
+	if err != nil {
+		return err
+	}
+	r.staticFileIndex.managedRemove(currentName)
+	// Carry the health of the file over to its new directory.
+	entry, err := r.staticFileSet.Open(newName)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	if err := r.managedBubbleFileHealth(entry); err != nil {
+		r.log.Println("WARN: Could not update the health of the directory of", newName, err)
+	}
+	if err := r.managedUpdateDirHealth(dirSiaPath(currentName)); err != nil {
+		r.log.Println("WARN: Could not update the directory of", currentName, err)
+	}
+	return nil
+}
+
+// ReplaceFile moves the file at currentName to newName. If there already is a
+// file at newName, it is replaced atomically, so readers of newName never find
+// it missing. The replaced file is kept as a version if the version policy of
+// newName requires it, and deleted otherwise.
+func (r *Renter) ReplaceFile(currentName, newName string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := validateSiapath(newName); err != nil {
+		return err
+	}
+	if isPackPath(currentName) {
+		return errPackPath
+	}
+	if isVersionPath(currentName) {
+		return errVersionPath
+	}
+	lockID := r.mu.Lock()
+	err := r.createDirUnchecked(dirSiaPath(newName))
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return err
+	}
+	if exists, _ := r.staticFileSet.Exists(newName); !exists {
+		return r.RenameFile(currentName, newName)
+	}
+
+	versioned := r.managedVersionPolicy(newName) != (modules.VersionPolicy{})
+	if versioned {
+		versionPath := versionSiaPath(newName, strconv.FormatInt(time.Now().UnixNano(), 10))
+		lockID := r.mu.Lock()
+		err := r.createDirUnchecked(dirSiaPath(versionPath))
+		r.mu.Unlock(lockID)
+		if err != nil {
+			return err
+		}
+		if err := r.staticFileSet.Archive(newName, currentName, versionPath); err != nil {
+			return err
+		}
+		entry, err := r.staticFileSet.Open(versionPath)
+		if err != nil {
+			return err
+		}
+		err = entry.SetLocalPath("")
+		if err == nil {
+			err = r.managedBubbleFileHealth(entry)
+		}
+		entry.Close()
+		if err != nil {
+			r.log.Println("WARN: Could not update the version", versionPath, err)
+		}
+	} else {
+		var dedupIDs []crypto.Hash
+		if entry, err := r.staticFileSet.Open(newName); err == nil {
+			dedupIDs = entry.DedupIDs()
+			entry.Close()
+		}
+		if err := r.staticFileSet.Replace(newName, currentName); err != nil {
+			return err
+		}
+		if err := r.staticDedupIndex.managedRelease(dedupIDs); err != nil {
+			r.log.Println("WARN: Could not update the dedup index:", err)
+		}
+	}
+	r.staticFileIndex.managedRemove(currentName)
+
+	// Update the health of both directories, like RenameFile does.
+	entry, err := r.staticFileSet.Open(newName)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	if err := r.managedBubbleFileHealth(entry); err != nil {
+		r.log.Println("WARN: Could not update the health of the directory of", newName, err)
+	}
+	if err := r.managedUpdateDirHealth(dirSiaPath(currentName)); err != nil {
+		r.log.Println("WARN: Could not update the directory of", currentName, err)
+	}
+	if versioned {
+		if err := r.managedPruneVersions(newName); err != nil {
+			r.log.Println("WARN: Could not expire the versions of", newName, err)
+		}
+	}
+	return nil
+}
+
+// managedRemoveUploadFiles deletes the files that the S3 gateway and the
+// WebDAV server were uploading when the renter stopped. They never replaced
+// their destination files, so nothing refers to them anymore.
+func (r *Renter) managedRemoveUploadFiles() {
+	for _, dir := range uploadDirs {
+		siaPaths, err := r.managedFilesBelow(dir)
+		if err != nil {
+			r.log.Println("WARN: Could not list the files in", dir, err)
+			continue
+		}
+		for _, siaPath := range siaPaths {
+			if err := r.managedDeleteFile(siaPath); err != nil {
+				r.log.Println("WARN: Could not delete the upload", siaPath, err)
+			}
+		}
+	}
 }
 
 // fileToSiaFile converts a legacy file to a SiaFile. Fields that can't be
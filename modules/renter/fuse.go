@@ -0,0 +1,347 @@
+// +build linux darwin
+
+package renter
+
+// fuse.go implements a read-only FUSE filesystem on top of the renter's
+// siafile tree. Directories map to the directories of the renter and files to
+// its siafiles. File data is downloaded through the streamer one readahead
+// window at a time, and the window after the one being read is fetched in the
+// background so that sequential reads don't wait for the network.
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/errors"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+const (
+	// fuseReadaheadSize is the size of the windows that files are downloaded
+	// in when they are read through the FUSE filesystem.
+	fuseReadaheadSize = 1 << 22 // 4 MiB
+
+	// fuseDirMode is the mode reported for directories.
+	fuseDirMode = 0555
+
+	// fuseDefaultFileMode is the mode reported for files that have no mode
+	// stored in their metadata.
+	fuseDefaultFileMode = 0444
+)
+
+type (
+	// fuseDirNode is a directory of the renter.
+	fuseDirNode struct {
+		fs.Inode
+		r       *Renter
+		siaPath string
+	}
+
+	// fuseFileNode is a file of the renter.
+	fuseFileNode struct {
+		fs.Inode
+		r       *Renter
+		siaPath string
+	}
+
+	// fuseFileHandle is an open file of the FUSE filesystem. It caches the
+	// readahead windows around the last read.
+	fuseFileHandle struct {
+		staticEntry *siafile.SiaFileSetEntry
+		staticFile  *siafile.Snapshot
+		r           *Renter
+
+		windows map[int64]*fuseReadahead
+		mu      sync.Mutex
+	}
+
+	// fuseReadahead is a window of file data that is being downloaded. data
+	// and err may only be accessed once done is closed.
+	fuseReadahead struct {
+		data []byte
+		err  error
+		done chan struct{}
+	}
+)
+
+// Compile time checks that the nodes implement the interfaces of a read-only
+// filesystem.
+var (
+	_ = (fs.NodeGetattrer)((*fuseDirNode)(nil))
+	_ = (fs.NodeLookuper)((*fuseDirNode)(nil))
+	_ = (fs.NodeReaddirer)((*fuseDirNode)(nil))
+	_ = (fs.NodeGetattrer)((*fuseFileNode)(nil))
+	_ = (fs.NodeOpener)((*fuseFileNode)(nil))
+	_ = (fs.FileReader)((*fuseFileHandle)(nil))
+	_ = (fs.FileReleaser)((*fuseFileHandle)(nil))
+)
+
+// mountFuse mounts the directory at siaPath as a read-only FUSE filesystem at
+// mountPoint.
+func (r *Renter) mountFuse(mountPoint, siaPath string) (fuseServer, error) {
+	root := &fuseDirNode{
+		r:       r,
+		siaPath: siaPath,
+	}
+	return fs.Mount(mountPoint, root, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:  "hyperspace",
+			Name:    "hyperspace",
+			Options: []string{"ro"},
+		},
+	})
+}
+
+// fuseErrno converts an error of the renter into the errno returned to the
+// kernel.
+func fuseErrno(err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return fs.OK
+	case errors.Contains(err, siafile.ErrUnknownPath), errors.Contains(err, siafile.ErrUnknownDir), os.IsNotExist(err):
+		return syscall.ENOENT
+	default:
+		return syscall.EIO
+	}
+}
+
+// fuseFileAttr sets the attributes of a file from the metadata of its
+// siafile.
+func fuseFileAttr(entry *siafile.SiaFileSetEntry, attr *fuse.Attr) {
+	mode := entry.Mode().Perm() &^ 0222
+	if mode == 0 {
+		mode = fuseDefaultFileMode
+	}
+	size := entry.Size()
+	atime, mtime, ctime := entry.AccessTime(), entry.ModTime(), entry.ChangeTime()
+	attr.Mode = syscall.S_IFREG | uint32(mode)
+	attr.Size = size
+	attr.Blocks = (size + 511) / 512
+	attr.Nlink = 1
+	attr.Owner = fuse.Owner{
+		Uid: uint32(entry.UserID()),
+		Gid: uint32(entry.GroupID()),
+	}
+	attr.SetTimes(&atime, &mtime, &ctime)
+}
+
+// fuseDirAttr sets the attributes of a directory from the directory on disk.
+func fuseDirAttr(fi os.FileInfo, attr *fuse.Attr) {
+	mtime := fi.ModTime()
+	attr.Mode = syscall.S_IFDIR | fuseDirMode
+	attr.Nlink = 2
+	attr.SetTimes(&mtime, &mtime, &mtime)
+}
+
+// childPath returns the siapath of a child of the directory.
+func (n *fuseDirNode) childPath(name string) string {
+	if n.siaPath == "" {
+		return name
+	}
+	return path.Join(n.siaPath, name)
+}
+
+// Getattr implements fs.NodeGetattrer.
+func (n *fuseDirNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	fi, err := os.Stat(filepath.Join(n.r.filesDir, n.siaPath))
+	if err != nil {
+		return fuseErrno(err)
+	}
+	fuseDirAttr(fi, &out.Attr)
+	return fs.OK
+}
+
+// Lookup implements fs.NodeLookuper. Directories take precedence over files
+// with the same name.
+func (n *fuseDirNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	childPath := n.childPath(name)
+	if isHiddenPath(childPath) {
+		return nil, syscall.ENOENT
+	}
+	if fi, err := os.Stat(filepath.Join(n.r.filesDir, childPath)); err == nil && fi.IsDir() {
+		fuseDirAttr(fi, &out.Attr)
+		child := &fuseDirNode{
+			r:       n.r,
+			siaPath: childPath,
+		}
+		return n.NewInode(ctx, child, fs.StableAttr{Mode: syscall.S_IFDIR}), fs.OK
+	}
+	entry, err := n.r.staticFileSet.Open(childPath)
+	if err != nil {
+		return nil, fuseErrno(err)
+	}
+	defer entry.Close()
+	fuseFileAttr(entry, &out.Attr)
+	child := &fuseFileNode{
+		r:       n.r,
+		siaPath: childPath,
+	}
+	return n.NewInode(ctx, child, fs.StableAttr{Mode: syscall.S_IFREG}), fs.OK
+}
+
+// Readdir implements fs.NodeReaddirer.
+func (n *fuseDirNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	fis, err := ioutil.ReadDir(filepath.Join(n.r.filesDir, n.siaPath))
+	if err != nil {
+		return nil, fuseErrno(err)
+	}
+	var entries []fuse.DirEntry
+	for _, fi := range fis {
+		if isHiddenPath(n.childPath(fi.Name())) {
+			continue
+		}
+		if fi.IsDir() {
+			entries = append(entries, fuse.DirEntry{
+				Name: fi.Name(),
+				Mode: syscall.S_IFDIR,
+			})
+		} else if filepath.Ext(fi.Name()) == siafile.ShareExtension {
+			entries = append(entries, fuse.DirEntry{
+				Name: strings.TrimSuffix(fi.Name(), siafile.ShareExtension),
+				Mode: syscall.S_IFREG,
+			})
+		}
+	}
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Getattr implements fs.NodeGetattrer.
+func (n *fuseFileNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	entry, err := n.r.staticFileSet.Open(n.siaPath)
+	if err != nil {
+		return fuseErrno(err)
+	}
+	defer entry.Close()
+	fuseFileAttr(entry, &out.Attr)
+	return fs.OK
+}
+
+// Open implements fs.NodeOpener. Files can only be opened for reading.
+func (n *fuseFileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_APPEND|syscall.O_TRUNC) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	entry, err := n.r.staticFileSet.Open(n.siaPath)
+	if err != nil {
+		return nil, 0, fuseErrno(err)
+	}
+	snap, err := n.r.managedSnapshot(entry)
+	if err != nil {
+		entry.Close()
+		return nil, 0, fuseErrno(err)
+	}
+	fh := &fuseFileHandle{
+		staticEntry: entry,
+		staticFile:  snap,
+		r:           n.r,
+		windows:     make(map[int64]*fuseReadahead),
+	}
+	return fh, fuse.FOPEN_KEEP_CACHE, fs.OK
+}
+
+// Read implements fs.FileReader. It blocks until the windows that contain the
+// requested data are downloaded.
+func (fh *fuseFileHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	fileSize := int64(fh.staticFile.Size())
+	var n int
+	for n < len(dest) && off+int64(n) < fileSize {
+		pos := off + int64(n)
+		windowOffset := pos - pos%fuseReadaheadSize
+		w := fh.managedWindow(windowOffset)
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			return nil, syscall.EINTR
+		}
+		if w.err != nil {
+			fh.r.log.Debugln("WARN: Could not read from", fh.staticFile.HyperspacePath(), "through FUSE:", w.err)
+			fh.managedDropWindow(windowOffset)
+			return nil, syscall.EIO
+		}
+		n += copy(dest[n:], w.data[pos-windowOffset:])
+	}
+	return fuse.ReadResultData(dest[:n]), fs.OK
+}
+
+// Release implements fs.FileReleaser.
+func (fh *fuseFileHandle) Release(ctx context.Context) syscall.Errno {
+	if err := fh.staticEntry.Close(); err != nil {
+		fh.r.log.Debugln("WARN: Could not close thread:", err)
+	}
+	return fs.OK
+}
+
+// managedWindow returns the readahead window that starts at offset and
+// starts downloading the window after it. Windows that are not adjacent to
+// offset are dropped from the cache.
+func (fh *fuseFileHandle) managedWindow(offset int64) *fuseReadahead {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	for windowOffset := range fh.windows {
+		if windowOffset < offset-fuseReadaheadSize || windowOffset > offset+fuseReadaheadSize {
+			delete(fh.windows, windowOffset)
+		}
+	}
+	w, exists := fh.windows[offset]
+	if !exists {
+		w = fh.fetchWindow(offset)
+	}
+	next := offset + fuseReadaheadSize
+	if _, exists := fh.windows[next]; !exists && next < int64(fh.staticFile.Size()) {
+		fh.fetchWindow(next)
+	}
+	return w
+}
+
+// managedDropWindow removes a window from the cache so that it is downloaded
+// again by the next read.
+func (fh *fuseFileHandle) managedDropWindow(offset int64) {
+	fh.mu.Lock()
+	delete(fh.windows, offset)
+	fh.mu.Unlock()
+}
+
+// fetchWindow adds the window at offset to the cache and starts downloading
+// it. The caller must hold the lock.
+func (fh *fuseFileHandle) fetchWindow(offset int64) *fuseReadahead {
+	w := &fuseReadahead{
+		done: make(chan struct{}),
+	}
+	fh.windows[offset] = w
+	go fh.threadedFetchWindow(offset, w)
+	return w
+}
+
+// threadedFetchWindow downloads the data of a readahead window.
+func (fh *fuseFileHandle) threadedFetchWindow(offset int64, w *fuseReadahead) {
+	defer close(w.done)
+	if err := fh.r.tg.Add(); err != nil {
+		w.err = err
+		return
+	}
+	defer fh.r.tg.Done()
+
+	// The streamer only downloads a single chunk per call to Read, so the
+	// window is read in a loop. It shares the snapshot of the open file.
+	s := &streamer{
+		staticFile: fh.staticFile,
+		offset:     offset,
+		r:          fh.r,
+	}
+	length := min(fuseReadaheadSize, fh.staticFile.Size()-uint64(offset))
+	w.data = make([]byte, length)
+	start := time.Now()
+	_, w.err = io.ReadFull(s, w.data)
+	fh.r.log.Debugf("Fetched %v bytes of %v through FUSE in %v", length, fh.staticFile.HyperspacePath(), time.Since(start))
+}
@@ -0,0 +1,14 @@
+// +build !linux,!darwin
+
+package renter
+
+import "github.com/HyperspaceApp/errors"
+
+// errFuseUnsupported is returned when mounting a filesystem on an operating
+// system that doesn't support FUSE.
+var errFuseUnsupported = errors.New("FUSE is not supported on this operating system")
+
+// mountFuse always fails since FUSE is not supported on this operating system.
+func (r *Renter) mountFuse(mountPoint, siaPath string) (fuseServer, error) {
+	return nil, errFuseUnsupported
+}
@@ -0,0 +1,144 @@
+package renter
+
+// fusemanager.go keeps track of the read-only FUSE filesystems that expose the
+// renter's files. The filesystems themselves are implemented in fuse.go on the
+// operating systems that support FUSE.
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/errors"
+)
+
+var (
+	// errFuseMountPointInUse is returned when a filesystem is already mounted
+	// at a mount point.
+	errFuseMountPointInUse = errors.New("a filesystem is already mounted at that mount point")
+
+	// errFuseNotMounted is returned when unmounting a mount point that has no
+	// filesystem mounted by the renter.
+	errFuseNotMounted = errors.New("no filesystem is mounted at that mount point")
+
+	// errFuseRelativeMountPoint is returned when a mount point is not an
+	// absolute path.
+	errFuseRelativeMountPoint = errors.New("mount point must be an absolute path")
+)
+
+type (
+	// fuseServer is a mounted FUSE filesystem.
+	fuseServer interface {
+		Unmount() error
+	}
+
+	// fuseMount is a FUSE filesystem that exposes a directory of the renter.
+	fuseMount struct {
+		siaPath string
+		server  fuseServer
+	}
+
+	// fuseManager tracks the FUSE filesystems mounted by the renter, indexed
+	// by their mount point.
+	fuseManager struct {
+		mounts map[string]fuseMount
+		mu     sync.Mutex
+	}
+)
+
+// Mount mounts the directory at siaPath as a read-only FUSE filesystem at
+// mountPoint. The empty siaPath refers to the renter's root directory.
+func (r *Renter) Mount(mountPoint, siaPath string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if !filepath.IsAbs(mountPoint) {
+		return errFuseRelativeMountPoint
+	}
+	mountPoint = filepath.Clean(mountPoint)
+	siaPath = strings.Trim(siaPath, "/")
+	if siaPath != "" {
+		if err := validateSiapath(siaPath); err != nil {
+			return err
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(r.filesDir, siaPath)); os.IsNotExist(err) || (err == nil && !fi.IsDir()) {
+		return siafile.ErrUnknownDir
+	} else if err != nil {
+		return err
+	}
+
+	r.fuseManager.mu.Lock()
+	defer r.fuseManager.mu.Unlock()
+	if _, exists := r.fuseManager.mounts[mountPoint]; exists {
+		return errFuseMountPointInUse
+	}
+	server, err := r.mountFuse(mountPoint, siaPath)
+	if err != nil {
+		return errors.AddContext(err, "failed to mount filesystem")
+	}
+	r.fuseManager.mounts[mountPoint] = fuseMount{
+		siaPath: siaPath,
+		server:  server,
+	}
+	return nil
+}
+
+// MountInfo returns the FUSE filesystems mounted by the renter, sorted by
+// their mount point.
+func (r *Renter) MountInfo() []modules.MountInfo {
+	r.fuseManager.mu.Lock()
+	defer r.fuseManager.mu.Unlock()
+	infos := make([]modules.MountInfo, 0, len(r.fuseManager.mounts))
+	for mountPoint, mount := range r.fuseManager.mounts {
+		infos = append(infos, modules.MountInfo{
+			MountPoint:     mountPoint,
+			HyperspacePath: mount.siaPath,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].MountPoint < infos[j].MountPoint
+	})
+	return infos
+}
+
+// Unmount unmounts the FUSE filesystem that the renter mounted at mountPoint.
+func (r *Renter) Unmount(mountPoint string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	mountPoint = filepath.Clean(mountPoint)
+
+	r.fuseManager.mu.Lock()
+	defer r.fuseManager.mu.Unlock()
+	mount, exists := r.fuseManager.mounts[mountPoint]
+	if !exists {
+		return errFuseNotMounted
+	}
+	if err := mount.server.Unmount(); err != nil {
+		return errors.AddContext(err, "failed to unmount filesystem")
+	}
+	delete(r.fuseManager.mounts, mountPoint)
+	return nil
+}
+
+// managedUnmountAll unmounts every FUSE filesystem mounted by the renter.
+func (fm *fuseManager) managedUnmountAll() error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	var errs []error
+	for mountPoint, mount := range fm.mounts {
+		if err := mount.server.Unmount(); err != nil {
+			errs = append(errs, errors.AddContext(err, "failed to unmount "+mountPoint))
+			continue
+		}
+		delete(fm.mounts, mountPoint)
+	}
+	return errors.Compose(errs...)
+}
@@ -0,0 +1,493 @@
+package renter
+
+import (
+	"container/heap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/persist"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+// siaDirMetadata is the metadata stored in the .siadir file of every directory
+// of the renter. It allows the repair loop to find the directories that need
+// to be repaired without loading every siafile.
+type siaDirMetadata struct {
+	// AggregateHealth is the worst health of any file below the directory,
+	// including the files in its subdirectories.
+	AggregateHealth float64
+
+	// The aggregate fields are the values of the fields without the prefix
+	// over every file below the directory, excluding the files in hidden
+	// directories. They are reported by DirList.
+	AggregateMinRedundancy  float64
+	AggregateModTime        time.Time
+	AggregateNumFiles       uint64
+	AggregateNumStuckChunks uint64
+	AggregateSize           uint64
+
+	// Health is the worst health of the files directly inside the directory.
+	// See SiaFile.Health for the meaning of the value.
+	Health float64
+
+	// HostPolicy is the name of the host policy attached to the directory.
+	HostPolicy string
+
+	// LastHealthCheckTime is the last time the health of the files directly
+	// inside the directory was checked.
+	LastHealthCheckTime time.Time
+
+	// LastUpdate is the time the metadata was last written, in nanoseconds
+	// since the unix epoch.
+	LastUpdate int64
+
+	// MinRedundancy is the lowest redundancy of the files directly inside the
+	// directory, or -1 if none of them has a redundancy. ModTime is the
+	// latest modification time of those files, NumFiles their number,
+	// NumStuckChunks the number of their stuck chunks and Size their total
+	// size. Like the health, these fields are updated whenever the health of
+	// the directory is checked.
+	MinRedundancy  float64
+	ModTime        time.Time
+	NumFiles       uint64
+	NumStuckChunks uint64
+	Size           uint64
+
+	// VersionPolicy is the version policy attached to the directory.
+	VersionPolicy modules.VersionPolicy
+}
+
+// loadSiaDirMetadata loads the metadata of the directory at path. Directories
+// without a metadata file have never been checked and are reported as
+// healthy. The caller must hold siaDirMu.
+func loadSiaDirMetadata(path string) (siaDirMetadata, error) {
+	var md siaDirMetadata
+	err := persist.LoadJSON(siaDirMetadataHeader, &md, filepath.Join(path, SiaDirMetadata))
+	if os.IsNotExist(err) {
+		return siaDirMetadata{}, nil
+	}
+	return md, err
+}
+
+// saveSiaDirMetadata saves the metadata of the directory at path. The caller
+// must hold siaDirMu.
+func saveSiaDirMetadata(path string, md siaDirMetadata) error {
+	md.LastUpdate = time.Now().UnixNano()
+	return persist.SaveJSON(siaDirMetadataHeader, md, filepath.Join(path, SiaDirMetadata))
+}
+
+// dirSiaPath returns the siapath of the directory a file or directory is in.
+// The root directory is the empty siapath.
+func dirSiaPath(siaPath string) string {
+	dir := filepath.ToSlash(filepath.Dir(strings.Trim(siaPath, "/")))
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// managedDirContents returns the siapaths of the immediate subdirectories of
+// the directory at siaPath and the siapaths of the files directly inside it.
+func (r *Renter) managedDirContents(siaPath string) (dirs, files []string, err error) {
+	fis, err := ioutil.ReadDir(filepath.Join(r.filesDir, siaPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, fi := range fis {
+		path := filepath.ToSlash(filepath.Join(siaPath, fi.Name()))
+		if fi.IsDir() {
+			dirs = append(dirs, path)
+		} else if filepath.Ext(path) == siafile.ShareExtension {
+			files = append(files, strings.TrimSuffix(path, siafile.ShareExtension))
+		}
+	}
+	return dirs, files, nil
+}
+
+// managedFilesBelow returns the siapaths of all the files below the directory
+// at siaPath.
+func (r *Renter) managedFilesBelow(siaPath string) ([]string, error) {
+	var siaPaths []string
+	err := filepath.Walk(filepath.Join(r.filesDir, siaPath), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != siafile.ShareExtension {
+			return nil
+		}
+		rel, err := filepath.Rel(r.filesDir, path)
+		if err != nil {
+			return err
+		}
+		siaPaths = append(siaPaths, strings.TrimSuffix(filepath.ToSlash(rel), siafile.ShareExtension))
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return siaPaths, nil
+}
+
+// managedBubbleDirHealth recomputes the aggregate health and the other
+// aggregate values of the directory at siaPath from its own values and the
+// aggregate values of its subdirectories, and then does the same for every
+// parent directory up to the root.
+func (r *Renter) managedBubbleDirHealth(siaPath string) error {
+	r.siaDirMu.Lock()
+	defer r.siaDirMu.Unlock()
+	for {
+		// Skip directories that were deleted in the meantime, but continue
+		// with their parents.
+		dirs, _, err := r.managedDirContents(siaPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		} else if err == nil {
+			path := filepath.Join(r.filesDir, siaPath)
+			md, err := loadSiaDirMetadata(path)
+			if err != nil {
+				return err
+			}
+			md.AggregateHealth = md.Health
+			md.AggregateMinRedundancy = -1
+			if md.NumFiles > 0 {
+				md.AggregateMinRedundancy = md.MinRedundancy
+			}
+			md.AggregateModTime = md.ModTime
+			md.AggregateNumFiles = md.NumFiles
+			md.AggregateNumStuckChunks = md.NumStuckChunks
+			md.AggregateSize = md.Size
+			for _, dir := range dirs {
+				subMD, err := loadSiaDirMetadata(filepath.Join(r.filesDir, dir))
+				if err != nil {
+					return err
+				}
+				if subMD.AggregateHealth > md.AggregateHealth {
+					md.AggregateHealth = subMD.AggregateHealth
+				}
+				// The files in hidden directories are only repaired, they
+				// are not listed.
+				if isHiddenPath(dir) || subMD.AggregateNumFiles == 0 {
+					continue
+				}
+				if subMD.AggregateMinRedundancy != -1 && (md.AggregateMinRedundancy == -1 || subMD.AggregateMinRedundancy < md.AggregateMinRedundancy) {
+					md.AggregateMinRedundancy = subMD.AggregateMinRedundancy
+				}
+				if subMD.AggregateModTime.After(md.AggregateModTime) {
+					md.AggregateModTime = subMD.AggregateModTime
+				}
+				md.AggregateNumFiles += subMD.AggregateNumFiles
+				md.AggregateNumStuckChunks += subMD.AggregateNumStuckChunks
+				md.AggregateSize += subMD.AggregateSize
+			}
+			if err := saveSiaDirMetadata(path, md); err != nil {
+				return err
+			}
+		}
+		if siaPath == "" {
+			return nil
+		}
+		siaPath = dirSiaPath(siaPath)
+	}
+}
+
+// managedUpdateDirHealth checks the health of every file directly inside the
+// directory at siaPath, stores it in the directory's metadata together with
+// the values that DirList reports for the files, and bubbles the new values up
+// to the root directory.
+func (r *Renter) managedUpdateDirHealth(siaPath string) error {
+	_, files, err := r.managedDirContents(siaPath)
+	if err != nil {
+		return err
+	}
+	var entrys []*siafile.SiaFileSetEntry
+	for _, file := range files {
+		entry, err := r.staticFileSet.Open(file)
+		if err != nil {
+			r.log.Debugln("WARN: Could not open file to check its health:", err)
+			continue
+		}
+		entrys = append(entrys, entry)
+	}
+	packs := r.managedOpenPacks(entrys)
+	defer r.closePacks(packs)
+	pks := make(map[string]types.SiaPublicKey)
+	for _, entry := range entrys {
+		for _, pk := range entry.HostPublicKeys() {
+			pks[string(pk.Key)] = pk
+		}
+	}
+	for _, pack := range packs {
+		for _, pk := range pack.HostPublicKeys() {
+			pks[string(pk.Key)] = pk
+		}
+	}
+	offline, goodForRenew, contracts := r.managedContractStatus(pks)
+	var health float64
+	stats := siaDirMetadata{MinRedundancy: -1}
+	indexEntries := make(map[string]fileIndexEntry)
+	for _, entry := range entrys {
+		h := entry.Health(offline, goodForRenew)
+		if h > health {
+			health = h
+		}
+		fi := fileInfo(entry, packs[entry.PackPath()], offline, goodForRenew, contracts)
+		if fi.Redundancy != -1 && (stats.MinRedundancy == -1 || fi.Redundancy < stats.MinRedundancy) {
+			stats.MinRedundancy = fi.Redundancy
+		}
+		if fi.ModTime.After(stats.ModTime) {
+			stats.ModTime = fi.ModTime
+		}
+		stats.NumFiles++
+		stats.NumStuckChunks += fi.NumStuckChunks
+		stats.Size += fi.Filesize
+		r.staticEvents.managedUpdateFileHealth(entry.HyperspacePath(), h, false)
+		indexEntries[entry.HyperspacePath()] = newFileIndexEntry(entry, h)
+		if err := entry.Close(); err != nil {
+			r.log.Debugln("WARN: Could not close thread:", err)
+		}
+	}
+
+	err = func() error {
+		r.siaDirMu.Lock()
+		defer r.siaDirMu.Unlock()
+		path := filepath.Join(r.filesDir, siaPath)
+		md, err := loadSiaDirMetadata(path)
+		if err != nil {
+			return err
+		}
+		md.Health = health
+		md.LastHealthCheckTime = time.Now()
+		md.MinRedundancy = stats.MinRedundancy
+		md.ModTime = stats.ModTime
+		md.NumFiles = stats.NumFiles
+		md.NumStuckChunks = stats.NumStuckChunks
+		md.Size = stats.Size
+		return saveSiaDirMetadata(path, md)
+	}()
+	if err != nil {
+		return err
+	}
+	r.staticFileIndex.managedUpdateDir(siaPath, indexEntries)
+	return r.managedBubbleDirHealth(siaPath)
+}
+
+// managedBubbleFileHealth updates the metadata of the directory of a file that
+// was just added or changed. The whole directory is checked again, since the
+// file might have replaced another file whose size and redundancy are part of
+// the directory's values.
+func (r *Renter) managedBubbleFileHealth(entry *siafile.SiaFileSetEntry) error {
+	return r.managedUpdateDirHealth(dirSiaPath(entry.HyperspacePath()))
+}
+
+// queuedDir is a directory in the healthQueue.
+type queuedDir struct {
+	siaPath   string
+	lastCheck time.Time
+}
+
+// healthQueue is a heap of directories sorted by the time their health was
+// last checked, with the stalest directory on top.
+type healthQueue []queuedDir
+
+// Implementation of heap.Interface for healthQueue.
+func (hq healthQueue) Len() int            { return len(hq) }
+func (hq healthQueue) Less(i, j int) bool  { return hq[i].lastCheck.Before(hq[j].lastCheck) }
+func (hq healthQueue) Swap(i, j int)       { hq[i], hq[j] = hq[j], hq[i] }
+func (hq *healthQueue) Push(x interface{}) { *hq = append(*hq, x.(queuedDir)) }
+func (hq *healthQueue) Pop() interface{} {
+	old := *hq
+	n := len(old)
+	x := old[n-1]
+	*hq = old[0 : n-1]
+	return x
+}
+
+// managedHealthQueue returns a healthQueue of all the renter's directories.
+func (r *Renter) managedHealthQueue() (*healthQueue, error) {
+	r.siaDirMu.Lock()
+	defer r.siaDirMu.Unlock()
+	hq := new(healthQueue)
+	err := filepath.Walk(r.filesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		md, err := loadSiaDirMetadata(path)
+		if err != nil {
+			return err
+		}
+		*hq = append(*hq, queuedDir{
+			siaPath:   filepath.ToSlash(strings.TrimPrefix(strings.TrimPrefix(path, r.filesDir), string(filepath.Separator))),
+			lastCheck: md.LastHealthCheckTime,
+		})
+		return nil
+	})
+	heap.Init(hq)
+	return hq, err
+}
+
+// managedCheckContractUtilities signals threadedUpdateDirHealth to check the
+// health of all directories if the utilities of the renter's contracts changed
+// since the last call. This way files that lost redundancy are found without
+// waiting for the next regular health check of their directory.
+func (r *Renter) managedCheckContractUtilities(contracts []modules.RenterContract) {
+	utilities := make(map[string]modules.ContractUtility, len(contracts))
+	for _, contract := range contracts {
+		utilities[contract.HostPublicKey.String()] = contract.Utility
+	}
+	id := r.mu.Lock()
+	changed := len(utilities) != len(r.contractUtilities)
+	for pk, utility := range utilities {
+		if old, exists := r.contractUtilities[pk]; !exists || old != utility {
+			changed = true
+		}
+	}
+	r.contractUtilities = utilities
+	r.mu.Unlock(id)
+	if !changed {
+		return
+	}
+	select {
+	case r.dirHealthRecheck <- struct{}{}:
+	default:
+	}
+}
+
+// threadedUpdateDirHealth is a background thread that keeps the health stored
+// in the metadata of the renter's directories up to date. It checks one
+// directory at a time, always the one that was checked the longest time ago,
+// and waits until that directory is due to be checked again. The queue of
+// directories is rebuilt once per healthCheckInterval to pick up new
+// directories. All directories are checked right away if the utilities of the
+// renter's contracts change.
+func (r *Renter) threadedUpdateDirHealth() {
+	err := r.tg.Add()
+	if err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	var queue *healthQueue
+	var queueBuilt time.Time
+	for {
+		wait := time.Duration(0)
+		if queue == nil || time.Since(queueBuilt) >= healthCheckInterval {
+			queue, err = r.managedHealthQueue()
+			if err != nil {
+				r.log.Println("WARN: Could not list the directories to check the health of:", err)
+				queue = nil
+				wait = dirHealthErrorCooldown
+			}
+			queueBuilt = time.Now()
+		}
+		if queue != nil && queue.Len() == 0 {
+			wait = healthCheckInterval
+		} else if queue != nil {
+			dir := (*queue)[0]
+			if wait = healthCheckInterval - time.Since(dir.lastCheck); wait <= 0 {
+				heap.Pop(queue)
+				err := r.managedUpdateDirHealth(dir.siaPath)
+				if err != nil && !os.IsNotExist(err) {
+					r.log.Println("WARN: Could not update the health of directory", dir.siaPath, err)
+					wait = dirHealthErrorCooldown
+				}
+				// Deleted directories are dropped from the queue.
+				if !os.IsNotExist(err) {
+					dir.lastCheck = time.Now()
+					heap.Push(queue, dir)
+				}
+			}
+		}
+		if rebuild := healthCheckInterval - time.Since(queueBuilt); wait > rebuild {
+			wait = rebuild
+		}
+		if wait <= 0 {
+			select {
+			case <-r.tg.StopChan():
+				return
+			default:
+			}
+			continue
+		}
+		select {
+		case <-time.After(wait):
+		case <-r.dirHealthRecheck:
+			// Every directory is due now. Resetting all the check times
+			// keeps the heap valid.
+			if queue != nil {
+				for i := range *queue {
+					(*queue)[i].lastCheck = time.Time{}
+				}
+			}
+		case <-r.tg.StopChan():
+			return
+		}
+	}
+}
+
+// healthDir is a directory in the dirHeap.
+type healthDir struct {
+	siaPath string
+	siaDirMetadata
+}
+
+// dirHeap is a heap of directories sorted by aggregate health, with the least
+// healthy directory on top.
+type dirHeap []healthDir
+
+// Implementation of heap.Interface for dirHeap.
+func (dh dirHeap) Len() int            { return len(dh) }
+func (dh dirHeap) Less(i, j int) bool  { return dh[i].AggregateHealth > dh[j].AggregateHealth }
+func (dh dirHeap) Swap(i, j int)       { dh[i], dh[j] = dh[j], dh[i] }
+func (dh *dirHeap) Push(x interface{}) { *dh = append(*dh, x.(healthDir)) }
+func (dh *dirHeap) Pop() interface{} {
+	old := *dh
+	n := len(old)
+	x := old[n-1]
+	*dh = old[0 : n-1]
+	return x
+}
+
+// managedDirsToRepair returns the siapaths of the directories that contain
+// files which need to be repaired, least healthy directory first. It descends
+// from the root directory into the subdirectory with the worst aggregate
+// health first and skips healthy subtrees entirely. Directories that have
+// never been checked are included since their health is unknown.
+func (r *Renter) managedDirsToRepair() ([]string, error) {
+	r.siaDirMu.Lock()
+	defer r.siaDirMu.Unlock()
+	md, err := loadSiaDirMetadata(r.filesDir)
+	if err != nil {
+		return nil, err
+	}
+	dh := &dirHeap{{siaPath: "", siaDirMetadata: md}}
+	var repairDirs []string
+	for dh.Len() > 0 {
+		dir := heap.Pop(dh).(healthDir)
+		unchecked := dir.LastHealthCheckTime.IsZero()
+		if dir.AggregateHealth <= 0 && !unchecked {
+			continue
+		}
+		if dir.Health > 0 || unchecked {
+			repairDirs = append(repairDirs, dir.siaPath)
+		}
+		subDirs, _, err := r.managedDirContents(dir.siaPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, subDir := range subDirs {
+			md, err := loadSiaDirMetadata(filepath.Join(r.filesDir, subDir))
+			if err != nil {
+				return nil, err
+			}
+			heap.Push(dh, healthDir{siaPath: subDir, siaDirMetadata: md})
+		}
+	}
+	return repairDirs, nil
+}
@@ -0,0 +1,235 @@
+package renter
+
+import (
+	"container/heap"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+// dependencyDisableRepairLoops keeps the renter from starting the loops that
+// check the health of its directories and repair its files.
+type dependencyDisableRepairLoops struct {
+	modules.ProductionDependencies
+}
+
+// Disrupt returns true if the correct string is provided.
+func (*dependencyDisableRepairLoops) Disrupt(s string) bool {
+	return s == "DisableRepairLoops"
+}
+
+// setDirHealth overwrites the health stored in the metadata of the directory
+// at siaPath and bubbles it up to the root. A zero lastCheck marks the
+// directory as never checked.
+func (r *Renter) setDirHealth(siaPath string, health float64, lastCheck time.Time) error {
+	err := func() error {
+		r.siaDirMu.Lock()
+		defer r.siaDirMu.Unlock()
+		path := filepath.Join(r.filesDir, siaPath)
+		md, err := loadSiaDirMetadata(path)
+		if err != nil {
+			return err
+		}
+		md.Health = health
+		md.LastHealthCheckTime = lastCheck
+		return saveSiaDirMetadata(path, md)
+	}()
+	if err != nil {
+		return err
+	}
+	return r.managedBubbleDirHealth(siaPath)
+}
+
+// newHealthTester creates a renter tester with the following directories:
+//   - sick, which contains a file that needs to be repaired
+//   - healthy, which only contains healthy files
+//   - healthy/stale, whose stored health is bad although its parent is
+//     healthy
+//   - unchecked, whose health was never checked
+func newHealthTester(name string) (*renterTester, error) {
+	rt, err := newRenterTesterWithDependency(name, &dependencyDisableRepairLoops{})
+	if err != nil {
+		return nil, err
+	}
+	r := rt.renter
+	for _, dir := range []string{"sick", "healthy", "unchecked"} {
+		if err := r.CreateDir(dir); err != nil {
+			return nil, err
+		}
+		if err := r.newSizedTestFile(dir+"/file", 1000); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.CreateDir("healthy/stale"); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := r.setDirHealth("", 0, now); err != nil {
+		return nil, err
+	}
+	if err := r.setDirHealth("sick", 1, now); err != nil {
+		return nil, err
+	}
+	if err := r.setDirHealth("healthy/stale", 1, now); err != nil {
+		return nil, err
+	}
+	// Overwrite the aggregate health that the stale directory bubbled up.
+	err = func() error {
+		r.siaDirMu.Lock()
+		defer r.siaDirMu.Unlock()
+		path := filepath.Join(r.filesDir, "healthy")
+		md, err := loadSiaDirMetadata(path)
+		if err != nil {
+			return err
+		}
+		md.AggregateHealth = 0
+		md.LastHealthCheckTime = now
+		return saveSiaDirMetadata(path, md)
+	}()
+	if err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// TestDirsToRepair tests that only the unhealthy and unchecked directories
+// are repaired, and that healthy subtrees are skipped.
+func TestDirsToRepair(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newHealthTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	dirs, err := rt.renter.managedDirsToRepair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dirs, []string{"sick", "unchecked"}) {
+		t.Fatal("unexpected directories to repair", dirs)
+	}
+}
+
+// TestBuildChunkHeap tests that only the chunks of the files in the
+// directories that need to be repaired are added to the upload heap.
+func TestBuildChunkHeap(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newHealthTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// The test files need a single worker.
+	id := rt.renter.mu.Lock()
+	rt.renter.workerPool[types.FileContractID{1}] = &worker{}
+	rt.renter.mu.Unlock(id)
+
+	rt.renter.managedBuildChunkHeap(make(map[string]struct{}))
+	rt.renter.uploadHeap.mu.Lock()
+	defer rt.renter.uploadHeap.mu.Unlock()
+	files := make(map[string]struct{})
+	for _, uuc := range rt.renter.uploadHeap.heap {
+		files[uuc.fileEntry.HyperspacePath()] = struct{}{}
+	}
+	expected := map[string]struct{}{"sick/file": {}, "unchecked/file": {}}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatal("unexpected files in the upload heap", files)
+	}
+}
+
+// TestHealthQueue tests that the health queue returns the directory checked
+// the longest time ago first.
+func TestHealthQueue(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newHealthTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	if err := rt.renter.setDirHealth("sick", 1, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	hq, err := rt.renter.managedHealthQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hq.Len() != 5 {
+		t.Fatal("expected 5 directories, got", hq.Len())
+	}
+	if dir := heap.Pop(hq).(queuedDir); dir.siaPath != "unchecked" {
+		t.Fatal("expected the unchecked directory first, got", dir.siaPath)
+	}
+	if dir := heap.Pop(hq).(queuedDir); dir.siaPath != "sick" {
+		t.Fatal("expected the stalest directory second, got", dir.siaPath)
+	}
+}
+
+// TestDirListAggregates tests that DirList reports the aggregate values stored
+// in the metadata of the directories, and that deleting a file updates them.
+func TestDirListAggregates(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableRepairLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+	if err := r.CreateDir("a/b"); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]uint64{"file": 500, "a/file": 1000, "a/b/file": 2000}
+	for siaPath, size := range files {
+		if err := r.newSizedTestFile(siaPath, size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{"a/b", "a", ""} {
+		if err := r.managedUpdateDirHealth(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dirs, fis, err := r.DirList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 2 || len(fis) != 1 || fis[0].HyperspacePath != "file" {
+		t.Fatal("unexpected listing", dirs, fis)
+	}
+	if dirs[0].NumFiles != 3 || dirs[0].AggregateSize != 3500 || dirs[0].NumSubDirs != 1 || dirs[0].MinRedundancy != 0 {
+		t.Fatalf("unexpected root directory %+v", dirs[0])
+	}
+	if dirs[1].HyperspacePath != "a" || dirs[1].NumFiles != 2 || dirs[1].AggregateSize != 3000 {
+		t.Fatalf("unexpected subdirectory %+v", dirs[1])
+	}
+
+	// Deleting a file updates the directory of the file and its parents.
+	if err := r.DeleteFile("a/b/file"); err != nil {
+		t.Fatal(err)
+	}
+	dirs, _, err = r.DirList("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirs[0].NumFiles != 1 || dirs[0].AggregateSize != 1000 {
+		t.Fatalf("unexpected directory %+v", dirs[0])
+	}
+	if dirs[1].NumFiles != 0 || dirs[1].AggregateSize != 0 || dirs[1].MinRedundancy != -1 {
+		t.Fatalf("unexpected empty directory %+v", dirs[1])
+	}
+}
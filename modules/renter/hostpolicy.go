@@ -0,0 +1,126 @@
+package renter
+
+// Host policies are attached to directories through the directories' siadir
+// metadata and apply to every file below the directory, unless a subdirectory
+// has a policy of its own. The chunks of a file with a host policy are only
+// uploaded to the hosts in the contract set of the policy. When such a chunk
+// is repaired, its pieces stored on other hosts are uploaded again to hosts
+// satisfying the policy. The contract sets are maintained by the contractor.
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+)
+
+// HostPolicies returns the host policies of the renter.
+func (r *Renter) HostPolicies() []modules.HostPolicy {
+	return r.hostContractor.HostPolicies()
+}
+
+// SetHostPolicy adds a host policy or replaces the policy with the same name.
+func (r *Renter) SetHostPolicy(policy modules.HostPolicy) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	return r.hostContractor.SetHostPolicy(policy)
+}
+
+// DeleteHostPolicy removes a host policy. Uploads below directories that the
+// policy is still attached to stall until the directories get a new policy.
+func (r *Renter) DeleteHostPolicy(name string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	return r.hostContractor.DeleteHostPolicy(name)
+}
+
+// PolicyContracts returns the contract set of a host policy.
+func (r *Renter) PolicyContracts(name string) ([]modules.RenterContract, error) {
+	return r.hostContractor.PolicyContracts(name)
+}
+
+// SetDirHostPolicy attaches a host policy to the directory at siaPath. An empty
+// policy name detaches the directory's policy.
+func (r *Renter) SetDirHostPolicy(siaPath, policy string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	siaPath = strings.Trim(siaPath, "/")
+	if siaPath != "" {
+		if err := validateSiapath(siaPath); err != nil {
+			return err
+		}
+	}
+	if isPackPath(siaPath) {
+		return errPackPath
+	}
+	if policy != "" {
+		if _, err := r.hostContractor.PolicyContracts(policy); err != nil {
+			return err
+		}
+	}
+
+	r.siaDirMu.Lock()
+	defer r.siaDirMu.Unlock()
+	path := filepath.Join(r.filesDir, siaPath)
+	if fi, err := os.Stat(path); os.IsNotExist(err) || (err == nil && !fi.IsDir()) {
+		return siafile.ErrUnknownDir
+	} else if err != nil {
+		return err
+	}
+	md, err := loadSiaDirMetadata(path)
+	if err != nil {
+		return err
+	}
+	md.HostPolicy = policy
+	return saveSiaDirMetadata(path, md)
+}
+
+// managedHostPolicy returns the name of the host policy that applies to the
+// file at siaPath. An empty string is returned if no policy applies. Versions
+// of a file use the host policy of the file.
+func (r *Renter) managedHostPolicy(siaPath string) string {
+	if isVersionPath(siaPath) {
+		siaPath = versionFileSiaPath(siaPath)
+	}
+	r.siaDirMu.Lock()
+	defer r.siaDirMu.Unlock()
+	for dir := dirSiaPath(siaPath); ; dir = dirSiaPath(dir) {
+		md, err := loadSiaDirMetadata(filepath.Join(r.filesDir, dir))
+		if err == nil && md.HostPolicy != "" {
+			return md.HostPolicy
+		}
+		if dir == "" {
+			return ""
+		}
+	}
+}
+
+// managedPolicyHosts restricts hosts to the hosts that the file at siaPath
+// may be uploaded to according to its host policy.
+func (r *Renter) managedPolicyHosts(siaPath string, hosts map[string]struct{}) map[string]struct{} {
+	policy := r.managedHostPolicy(siaPath)
+	if policy == "" {
+		return hosts
+	}
+	allowed := make(map[string]struct{})
+	contracts, err := r.hostContractor.PolicyContracts(policy)
+	if err != nil {
+		r.log.Debugf("WARN: host policy %v of %v is unavailable: %v", policy, siaPath, err)
+		return allowed
+	}
+	for _, contract := range contracts {
+		host := contract.HostPublicKey.String()
+		if _, exists := hosts[host]; exists {
+			allowed[host] = struct{}{}
+		}
+	}
+	return allowed
+}
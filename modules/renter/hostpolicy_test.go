@@ -0,0 +1,55 @@
+package renter
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestVersionHostPolicy tests that the versions of a file use the host policy
+// of the directory of the file.
+func TestVersionHostPolicy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+	if err := r.CreateDir("docs"); err != nil {
+		t.Fatal(err)
+	}
+	// Attach the policy directly, SetDirHostPolicy requires the contractor
+	// to know the policy.
+	r.siaDirMu.Lock()
+	path := filepath.Join(r.filesDir, "docs")
+	md, err := loadSiaDirMetadata(path)
+	if err == nil {
+		md.HostPolicy = "eu"
+		err = saveSiaDirMetadata(path, md)
+	}
+	r.siaDirMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versionPath := versionSiaPath("docs/file", "1537675200000000000")
+	lockID := r.mu.Lock()
+	err = r.createDirUnchecked(dirSiaPath(versionPath))
+	r.mu.Unlock(lockID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"docs/file": "eu",
+		versionPath: "eu",
+		"file":      "",
+		versionSiaPath("file", "1537675200000000000"): "",
+	}
+	for siaPath, policy := range tests {
+		if p := r.managedHostPolicy(siaPath); p != policy {
+			t.Errorf("%v: expected policy %q, got %q", siaPath, policy, p)
+		}
+	}
+}
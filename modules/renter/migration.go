@@ -0,0 +1,571 @@
+package renter
+
+// migration.go moves the pieces stored on hosts that are being dropped to
+// other hosts while the dropped hosts are still online. A host is being
+// dropped if the hostdb's filter mode filters it out, if its contract is no
+// longer good for renewal, or if its contract reached the second half of the
+// renew window without being renewed. Without migrations, the pieces on such
+// hosts are only replaced once they stop counting towards the redundancy of
+// their files, by repairs that read the chunks from disk or download them
+// from the other hosts. Pieces of files with a host policy that are stored on
+// hosts outside the policy's contract set are migrated as well, so switching
+// policies doesn't lower the redundancy of the files.
+//
+// Every migrationInterval the renter walks its files and counts the pieces
+// that need to be migrated. A piece is migrated by downloading its sector from
+// the dropped host and uploading it unchanged to a host that is good for
+// upload and doesn't store a piece of the chunk yet. Copies of a piece on
+// dropped hosts are then removed from the siafile. Pieces of offline hosts and
+// of chunks that are being repaired are skipped, and the migration from a
+// host is paused for the rest of the round after migrationMaxFailures
+// consecutive failures.
+//
+// The downloaded sectors are limited to MaxMigrationSpeed bytes per second.
+// Once no file stores pieces on a dropped host anymore, its contract is
+// canceled. The progress of the migrations is only kept in memory, after a
+// restart it is counted again from the files.
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+var (
+	// errMigrationRootMismatch is returned if the new host stores a migrated
+	// sector under a different Merkle root.
+	errMigrationRootMismatch = errors.New("migrated sector has a different Merkle root")
+)
+
+type (
+	// migrationPlanner tracks the migrations of pieces away from hosts.
+	migrationPlanner struct {
+		// migrations maps the hosts whose pieces are migrated to the state
+		// of their migration.
+		migrations map[string]*modules.HostMigration
+
+		// failures counts the consecutive failed piece migrations of the
+		// hosts during the current round.
+		failures map[string]int
+
+		maxSpeed int64
+		mu       sync.Mutex
+	}
+
+	// migrationHosts classifies the hosts of the renter's contracts for a
+	// migration round. The maps are keyed by the hosts' public keys.
+	migrationHosts struct {
+		addresses map[string]modules.NetAddress
+		contracts map[string]modules.RenterContract
+
+		// dropped maps the hosts that are being dropped to the reason.
+		dropped map[string]modules.MigrationReason
+
+		// offline contains the hosts that are considered offline.
+		offline map[string]struct{}
+
+		// targets contains the hosts that pieces can be migrated to.
+		targets map[string]struct{}
+	}
+
+	// pieceMigration describes the migration of a piece of a chunk.
+	pieceMigration struct {
+		pieceIndex uint64
+
+		// covered is true if the piece is also stored on a host that isn't
+		// migrated from, so it doesn't need to be copied.
+		covered bool
+
+		// source is the piece that is copied to a new host, nil if the piece
+		// is covered or only stored on offline hosts.
+		source *siafile.Piece
+
+		// pieces are the copies of the piece that are migrated away from,
+		// and stale are those of them that are removed from the siafile.
+		pieces []siafile.Piece
+		stale  []siafile.Piece
+	}
+)
+
+// newMigrationPlanner returns a migrationPlanner that limits the migrations to
+// maxSpeed bytes per second.
+func newMigrationPlanner(maxSpeed int64) *migrationPlanner {
+	return &migrationPlanner{
+		migrations: make(map[string]*modules.HostMigration),
+		failures:   make(map[string]int),
+		maxSpeed:   maxSpeed,
+	}
+}
+
+// planChunkMigration returns the migrations of the pieces of a chunk. Pieces
+// are migrated away from dropped hosts and from hosts that aren't allowed by
+// the file's host policy. Pieces on hosts without a contract are ignored.
+func planChunkMigration(pieces [][]siafile.Piece, mh migrationHosts, allowed map[string]struct{}) []pieceMigration {
+	var pms []pieceMigration
+	for pieceIndex, pieceSet := range pieces {
+		var moving []siafile.Piece
+		covered := false
+		for _, piece := range pieceSet {
+			host := piece.HostPubKey.String()
+			if _, exists := mh.contracts[host]; !exists {
+				continue
+			}
+			_, dropped := mh.dropped[host]
+			_, ok := allowed[host]
+			if dropped || !ok {
+				moving = append(moving, piece)
+			} else {
+				covered = true
+			}
+		}
+
+		pm := pieceMigration{
+			pieceIndex: uint64(pieceIndex),
+			covered:    covered,
+		}
+		for i, piece := range moving {
+			host := piece.HostPubKey.String()
+			_, dropped := mh.dropped[host]
+			_, offline := mh.offline[host]
+			if dropped {
+				pm.stale = append(pm.stale, piece)
+			}
+			// Copies on hosts that are only disallowed by the host policy
+			// are kept, they just don't count towards the redundancy.
+			if dropped || !covered {
+				pm.pieces = append(pm.pieces, piece)
+			}
+			if !covered && !offline && pm.source == nil {
+				pm.source = &moving[i]
+			}
+		}
+		if len(pm.pieces) > 0 {
+			pms = append(pms, pm)
+		}
+	}
+	return pms
+}
+
+// migrationTarget returns a random host that a piece of the chunk with the
+// given pieces can be migrated to. False is returned if there is no such host.
+func migrationTarget(pieces [][]siafile.Piece, mh migrationHosts, allowed map[string]struct{}) (types.SiaPublicKey, bool) {
+	used := make(map[string]struct{})
+	for _, pieceSet := range pieces {
+		for _, piece := range pieceSet {
+			used[piece.HostPubKey.String()] = struct{}{}
+		}
+	}
+	var candidates []string
+	for host := range mh.targets {
+		_, isUsed := used[host]
+		_, ok := allowed[host]
+		if ok && !isUsed {
+			candidates = append(candidates, host)
+		}
+	}
+	if len(candidates) == 0 {
+		return types.SiaPublicKey{}, false
+	}
+	sort.Strings(candidates)
+	return mh.contracts[candidates[fastrand.Intn(len(candidates))]].HostPublicKey, true
+}
+
+// managedMaxSpeed returns the maximum migration speed in bytes per second.
+func (mp *migrationPlanner) managedMaxSpeed() int64 {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.maxSpeed
+}
+
+// managedSetMaxSpeed sets the maximum migration speed in bytes per second.
+func (mp *migrationPlanner) managedSetMaxSpeed(maxSpeed int64) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.maxSpeed = maxSpeed
+}
+
+// managedStartRound updates the migrations with the hosts of a new round and
+// the number of pieces remaining on them. It returns the contracts of the
+// dropped hosts that no pieces are left on. Those are only returned if the
+// hosts were already being dropped in the previous round and are online, so a
+// contract isn't canceled because its host was briefly offline.
+func (mp *migrationPlanner) managedStartRound(mh migrationHosts, remaining map[string]uint64) []modules.RenterContract {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.failures = make(map[string]int)
+	var drop []modules.RenterContract
+	migrations := make(map[string]*modules.HostMigration)
+	for host, contract := range mh.contracts {
+		reason, dropped := mh.dropped[host]
+		if !dropped && remaining[host] == 0 {
+			continue
+		} else if !dropped {
+			reason = modules.MigrationReasonHostPolicy
+		}
+		m, exists := mp.migrations[host]
+		if !exists {
+			m = &modules.HostMigration{
+				HostPublicKey: contract.HostPublicKey,
+				StartTime:     time.Now(),
+			}
+		}
+		m.ContractID = contract.ID
+		m.NetAddress = mh.addresses[host]
+		m.PiecesRemaining = remaining[host]
+		m.Reason = reason
+		_, m.Offline = mh.offline[host]
+
+		if dropped && remaining[host] == 0 {
+			u := contract.Utility
+			canceled := u.Locked && !u.GoodForRenew && !u.GoodForUpload
+			if canceled {
+				continue
+			} else if exists && !m.Offline {
+				drop = append(drop, contract)
+				continue
+			}
+		}
+		migrations[host] = m
+	}
+	mp.migrations = migrations
+	return drop
+}
+
+// managedPaused returns whether the migration from host is paused for the
+// rest of the round.
+func (mp *migrationPlanner) managedPaused(host string) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.failures[host] >= migrationMaxFailures
+}
+
+// managedMigrated records that a piece was migrated away from host, and that
+// n bytes were downloaded from it.
+func (mp *migrationPlanner) managedMigrated(host string, n uint64) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.failures[host] = 0
+	m, exists := mp.migrations[host]
+	if !exists {
+		return
+	}
+	m.BytesMigrated += n
+	m.PiecesMigrated++
+	if m.PiecesRemaining > 0 {
+		m.PiecesRemaining--
+	}
+}
+
+// managedFailed records that migrating a piece away from host failed.
+func (mp *migrationPlanner) managedFailed(host string, err error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.failures[host]++
+	m, exists := mp.migrations[host]
+	if !exists {
+		return
+	}
+	m.PiecesFailed++
+	m.LastError = err.Error()
+}
+
+// managedMigrationHosts classifies the hosts of the renter's contracts.
+func (r *Renter) managedMigrationHosts() migrationHosts {
+	mh := migrationHosts{
+		addresses: make(map[string]modules.NetAddress),
+		contracts: make(map[string]modules.RenterContract),
+		dropped:   make(map[string]modules.MigrationReason),
+		offline:   make(map[string]struct{}),
+		targets:   make(map[string]struct{}),
+	}
+	renewWindow := r.hostContractor.Allowance().RenewWindow
+	height := r.cs.Height()
+	for _, contract := range r.hostContractor.Contracts() {
+		host := contract.HostPublicKey.String()
+		mh.contracts[host] = contract
+		entry, exists := r.hostDB.Host(contract.HostPublicKey)
+		if exists {
+			mh.addresses[host] = entry.NetAddress
+		}
+		offline := r.hostContractor.IsOffline(contract.HostPublicKey)
+		if offline {
+			mh.offline[host] = struct{}{}
+		}
+		switch {
+		case exists && entry.Filtered:
+			mh.dropped[host] = modules.MigrationReasonFiltered
+		case !contract.Utility.GoodForRenew:
+			mh.dropped[host] = modules.MigrationReasonNotGoodForRenew
+		case renewWindow > 0 && height+renewWindow/2 >= contract.EndHeight:
+			mh.dropped[host] = modules.MigrationReasonExpiring
+		case contract.Utility.GoodForUpload && !offline:
+			mh.targets[host] = struct{}{}
+		}
+	}
+	return mh
+}
+
+// managedAllowedHosts returns the hosts that the host policy of the file at
+// siaPath allows.
+func (r *Renter) managedAllowedHosts(siaPath string, mh migrationHosts) map[string]struct{} {
+	hosts := make(map[string]struct{}, len(mh.contracts))
+	for host := range mh.contracts {
+		hosts[host] = struct{}{}
+	}
+	return r.managedPolicyHosts(siaPath, hosts)
+}
+
+// managedCountMigrations adds the number of pieces of the file at siaPath
+// that need to be migrated away from each host to remaining. It returns
+// whether the file has pieces to migrate.
+func (r *Renter) managedCountMigrations(siaPath string, mh migrationHosts, remaining map[string]uint64) bool {
+	entry, err := r.staticFileSet.Open(siaPath)
+	if err != nil {
+		return false
+	}
+	defer entry.Close()
+	allowed := r.managedAllowedHosts(siaPath, mh)
+	found := false
+	for chunkIndex := uint64(0); chunkIndex < entry.NumChunks(); chunkIndex++ {
+		pieces, err := entry.Pieces(chunkIndex)
+		if err != nil {
+			return found
+		}
+		for _, pm := range planChunkMigration(pieces, mh, allowed) {
+			for _, piece := range pm.pieces {
+				remaining[piece.HostPubKey.String()]++
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// managedThrottleMigration blocks until migrating n bytes, which started at
+// start, doesn't exceed the maximum migration speed. It returns false if the
+// renter was stopped in the meantime.
+func (r *Renter) managedThrottleMigration(start time.Time, n uint64) bool {
+	var wait time.Duration
+	if speed := r.staticMigrations.managedMaxSpeed(); speed > 0 {
+		wait = time.Duration(n)*time.Second/time.Duration(speed) - time.Since(start)
+	}
+	if wait <= 0 {
+		select {
+		case <-r.tg.StopChan():
+			return false
+		default:
+			return true
+		}
+	}
+	select {
+	case <-time.After(wait):
+		return true
+	case <-r.tg.StopChan():
+		return false
+	}
+}
+
+// managedCopyPiece downloads the sector of the piece pm.source and uploads it
+// to target, adding the new piece to entry. It returns the number of bytes
+// downloaded.
+func (r *Renter) managedCopyPiece(entry *siafile.SiaFileSetEntry, chunkIndex uint64, pm pieceMigration, target types.SiaPublicKey) (uint64, error) {
+	d, err := r.hostContractor.Downloader(pm.source.HostPubKey, r.tg.StopChan())
+	if err != nil {
+		return 0, errors.AddContext(err, "unable to connect to the old host")
+	}
+	data, err := d.Download(pm.source.MerkleRoot, 0, uint32(modules.SectorSize))
+	d.Close()
+	if err != nil {
+		return 0, errors.AddContext(err, "unable to download the piece from the old host")
+	}
+	n := uint64(len(data))
+
+	e, err := r.hostContractor.Editor(target, r.tg.StopChan())
+	if err != nil {
+		return n, errors.AddContext(err, "unable to connect to the new host")
+	}
+	root, err := e.Upload(data)
+	e.Close()
+	if err != nil {
+		return n, errors.AddContext(err, "unable to upload the piece to the new host")
+	} else if root != pm.source.MerkleRoot {
+		return n, errMigrationRootMismatch
+	}
+	return n, entry.AddPiece(target, chunkIndex, pm.pieceIndex, root)
+}
+
+// managedMigrateFile migrates the pieces of the file at siaPath. It returns
+// false if the renter was stopped.
+func (r *Renter) managedMigrateFile(siaPath string, mh migrationHosts) bool {
+	entry, err := r.staticFileSet.Open(siaPath)
+	if err != nil {
+		// The file might have been deleted or renamed in the meantime.
+		return true
+	}
+	defer entry.Close()
+	// The chunks of streaming uploads and of the open pack are still being
+	// written.
+	if r.uploadHeap.managedIsStreaming(entry.UID()) || r.managedIsOpenPack(entry.UID()) {
+		return true
+	}
+	allowed := r.managedAllowedHosts(siaPath, mh)
+	changed := false
+	for chunkIndex := uint64(0); chunkIndex < entry.NumChunks(); chunkIndex++ {
+		// Chunks that are being repaired are left to the repair.
+		r.uploadHeap.mu.Lock()
+		_, repairing := r.uploadHeap.activeChunks[uploadChunkID{fileUID: entry.UID(), index: chunkIndex}]
+		r.uploadHeap.mu.Unlock()
+		if repairing {
+			continue
+		}
+		pieces, err := entry.Pieces(chunkIndex)
+		if err != nil {
+			r.log.Debugln("WARN: could not get the pieces of a chunk to migrate:", err)
+			break
+		}
+		chunkChanged := false
+		for _, pm := range planChunkMigration(pieces, mh, allowed) {
+			var n uint64
+			if !pm.covered {
+				if pm.source == nil || r.staticMigrations.managedPaused(pm.source.HostPubKey.String()) {
+					continue
+				}
+				target, ok := migrationTarget(pieces, mh, allowed)
+				if !ok {
+					continue
+				}
+				start := time.Now()
+				n, err = r.managedCopyPiece(entry, chunkIndex, pm, target)
+				if err != nil {
+					r.log.Debugf("Could not migrate piece %v of chunk %v of %v away from %v: %v", pm.pieceIndex, chunkIndex, siaPath, pm.source.HostPubKey, err)
+					r.staticMigrations.managedFailed(pm.source.HostPubKey.String(), err)
+				}
+				if !r.managedThrottleMigration(start, n) {
+					return false
+				} else if err != nil {
+					continue
+				}
+				// The new host stores a piece of the chunk now.
+				if pieces, err = entry.Pieces(chunkIndex); err != nil {
+					r.log.Debugln("WARN: could not get the pieces of a chunk to migrate:", err)
+					break
+				}
+			}
+			for _, piece := range pm.stale {
+				if err := entry.RemovePiece(piece.HostPubKey, chunkIndex, pm.pieceIndex, piece.MerkleRoot); err != nil {
+					r.log.Debugln("WARN: could not remove a migrated piece:", err)
+				}
+			}
+			for _, piece := range pm.pieces {
+				host := piece.HostPubKey.String()
+				if pm.source != nil && host == pm.source.HostPubKey.String() {
+					r.staticMigrations.managedMigrated(host, n)
+				} else {
+					r.staticMigrations.managedMigrated(host, 0)
+				}
+			}
+			chunkChanged = true
+		}
+		if !chunkChanged {
+			continue
+		}
+		changed = true
+		// Other files can reuse the pieces of a deduplicated chunk.
+		if id, deduplicated := entry.DedupID(chunkIndex); deduplicated {
+			pieces, err := entry.Pieces(chunkIndex)
+			if err == nil {
+				err = r.staticDedupIndex.managedSetPieces(id, pieces)
+			}
+			if err != nil {
+				r.log.Debugln("WARN: could not update the pieces of a deduplicated chunk:", err)
+			}
+		}
+	}
+	if changed {
+		if err := r.managedBubbleFileHealth(entry); err != nil {
+			r.log.Println("WARN: Could not update the health of the directory of", siaPath, err)
+		}
+	}
+	return true
+}
+
+// managedMigrate performs a migration round. The contracts of dropped hosts
+// that no pieces are left on are canceled.
+func (r *Renter) managedMigrate() {
+	mh := r.managedMigrationHosts()
+	siaPaths, err := r.managedFilesBelow("")
+	if err != nil {
+		r.log.Println("WARN: Could not find the files to migrate:", err)
+		return
+	}
+	remaining := make(map[string]uint64)
+	var migrate []string
+	for _, siaPath := range siaPaths {
+		if r.managedCountMigrations(siaPath, mh, remaining) {
+			migrate = append(migrate, siaPath)
+		}
+	}
+
+	for _, contract := range r.staticMigrations.managedStartRound(mh, remaining) {
+		if err := r.hostContractor.CancelContract(contract.ID); err != nil {
+			r.log.Println("WARN: Could not cancel the contract with a host that all pieces were migrated away from:", err)
+			continue
+		}
+		r.log.Printf("Migrated all pieces away from %v, canceled contract %v", contract.HostPublicKey, contract.ID)
+	}
+
+	if len(mh.targets) == 0 {
+		return
+	}
+	for _, siaPath := range migrate {
+		if !r.managedMigrateFile(siaPath, mh) {
+			return
+		}
+	}
+}
+
+// threadedMigrationLoop periodically migrates the pieces stored on hosts that
+// are being dropped.
+func (r *Renter) threadedMigrationLoop() {
+	err := r.tg.Add()
+	if err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	for {
+		select {
+		case <-time.After(migrationInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+
+		// Migrations need to reach the hosts.
+		if !r.g.Online() || len(r.hostContractor.Contracts()) == 0 {
+			continue
+		}
+		r.managedMigrate()
+	}
+}
+
+// Migrations returns the ongoing migrations of pieces away from hosts that are
+// being dropped, sorted by the hosts' public keys.
+func (r *Renter) Migrations() []modules.HostMigration {
+	mp := r.staticMigrations
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	migrations := make([]modules.HostMigration, 0, len(mp.migrations))
+	for _, m := range mp.migrations {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].HostPublicKey.String() < migrations[j].HostPublicKey.String()
+	})
+	return migrations
+}
@@ -0,0 +1,140 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+// newMigrationTestHosts returns the migration hosts used by the tests. Host a
+// is dropped, b and e are targets, c is dropped and offline and d is a good
+// host.
+func newMigrationTestHosts() (migrationHosts, map[string]types.SiaPublicKey) {
+	pks := make(map[string]types.SiaPublicKey)
+	mh := migrationHosts{
+		addresses: make(map[string]modules.NetAddress),
+		contracts: make(map[string]modules.RenterContract),
+		dropped:   make(map[string]modules.MigrationReason),
+		offline:   make(map[string]struct{}),
+		targets:   make(map[string]struct{}),
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		pk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte(name)}
+		pks[name] = pk
+		mh.contracts[pk.String()] = modules.RenterContract{HostPublicKey: pk}
+	}
+	mh.dropped[pks["a"].String()] = modules.MigrationReasonFiltered
+	mh.dropped[pks["c"].String()] = modules.MigrationReasonNotGoodForRenew
+	mh.offline[pks["c"].String()] = struct{}{}
+	mh.targets[pks["b"].String()] = struct{}{}
+	mh.targets[pks["e"].String()] = struct{}{}
+	return mh, pks
+}
+
+// TestPlanChunkMigration tests which pieces of a chunk are migrated.
+func TestPlanChunkMigration(t *testing.T) {
+	mh, pks := newMigrationTestHosts()
+	piece := func(name string) siafile.Piece {
+		return siafile.Piece{HostPubKey: pks[name]}
+	}
+	unknown := siafile.Piece{HostPubKey: types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte("x")}}
+	pieces := [][]siafile.Piece{
+		{piece("a")},
+		{piece("a"), piece("b")},
+		{piece("c")},
+		{piece("d")},
+		{unknown},
+	}
+	// The host policy of the file doesn't allow d.
+	allowed := make(map[string]struct{})
+	for _, name := range []string{"a", "b", "c", "e"} {
+		allowed[pks[name].String()] = struct{}{}
+	}
+
+	pms := planChunkMigration(pieces, mh, allowed)
+	if len(pms) != 4 {
+		t.Fatal("expected 4 piece migrations, got", len(pms))
+	}
+	tests := []struct {
+		covered bool
+		source  string
+		pieces  int
+		stale   int
+	}{
+		// The only copy is on a dropped host.
+		{false, "a", 1, 1},
+		// The dropped copy is removed without copying it.
+		{true, "", 1, 1},
+		// The dropped host is offline, so the piece can't be copied.
+		{false, "", 1, 1},
+		// The copy outside the host policy is copied but kept.
+		{false, "d", 1, 0},
+	}
+	for i, test := range tests {
+		pm := pms[i]
+		if pm.pieceIndex != uint64(i) || pm.covered != test.covered || len(pm.pieces) != test.pieces || len(pm.stale) != test.stale {
+			t.Errorf("unexpected migration of piece %v: %+v", i, pm)
+		}
+		if test.source == "" && pm.source != nil {
+			t.Errorf("piece %v shouldn't have a source", i)
+		} else if test.source != "" && (pm.source == nil || pm.source.HostPubKey.String() != pks[test.source].String()) {
+			t.Errorf("piece %v should be copied from %v", i, test.source)
+		}
+	}
+
+	// The only allowed target that doesn't store a piece of the chunk is e.
+	target, ok := migrationTarget(pieces, mh, allowed)
+	if !ok || target.String() != pks["e"].String() {
+		t.Fatal("expected e to be the target")
+	}
+	delete(allowed, pks["e"].String())
+	if _, ok := migrationTarget(pieces, mh, allowed); ok {
+		t.Fatal("expected no target")
+	}
+}
+
+// TestMigrationPlannerRounds tests that the planner only cancels the contracts
+// of hosts that were already being dropped and are online.
+func TestMigrationPlannerRounds(t *testing.T) {
+	mh, pks := newMigrationTestHosts()
+	a, c, d := pks["a"].String(), pks["c"].String(), pks["d"].String()
+	mp := newMigrationPlanner(0)
+
+	// The first round only tracks the migrations.
+	drop := mp.managedStartRound(mh, map[string]uint64{a: 2, d: 1})
+	if len(drop) != 0 {
+		t.Fatal("no contracts should be dropped yet")
+	}
+	if len(mp.migrations) != 3 {
+		t.Fatal("expected 3 migrations, got", len(mp.migrations))
+	}
+	if mp.migrations[d].Reason != modules.MigrationReasonHostPolicy {
+		t.Fatal("wrong reason", mp.migrations[d].Reason)
+	}
+	mp.managedMigrated(a, modules.SectorSize)
+	mp.managedMigrated(a, modules.SectorSize)
+	if m := mp.migrations[a]; m.PiecesMigrated != 2 || m.PiecesRemaining != 0 || m.BytesMigrated != 2*modules.SectorSize {
+		t.Fatalf("unexpected progress %+v", m)
+	}
+	for i := 0; i < migrationMaxFailures; i++ {
+		mp.managedFailed(d, errMigrationRootMismatch)
+	}
+	if !mp.managedPaused(d) || mp.migrations[d].LastError != errMigrationRootMismatch.Error() {
+		t.Fatal("migration from d should be paused")
+	}
+
+	// Once no pieces are left, the contract of a is dropped. c is offline, so
+	// its contract is kept, and d isn't dropped, it only left the policy.
+	drop = mp.managedStartRound(mh, nil)
+	if len(drop) != 1 || drop[0].HostPublicKey.String() != a {
+		t.Fatal("expected the contract of a to be dropped", drop)
+	}
+	if _, exists := mp.migrations[c]; !exists || len(mp.migrations) != 1 {
+		t.Fatal("only the migration from c should be left")
+	}
+	if mp.managedPaused(d) {
+		t.Fatal("failures should be reset by a new round")
+	}
+}
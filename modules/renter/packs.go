@@ -0,0 +1,500 @@
+package renter
+
+// packs.go packs small files into shared chunks. Every chunk of a file uses
+// full sectors on the hosts, which makes storing small files very expensive.
+// Instead of getting chunks of their own, small files are appended to the
+// open pack. A pack is a regular siafile in the hidden packDir of the renter's
+// file tree that consists of a single chunk. Its local data is kept in the
+// packDataDir of the renter until the pack is fully uploaded. Once the open
+// pack is full, or it has been open for packSealTimeout, it is sealed and
+// uploaded like any other file. Repairs, health checks and backups of packs
+// don't need any special handling.
+//
+// A packed file records the path of its pack and the offset of its data
+// within the pack. Downloads of packed files use a snapshot of the pack and
+// only fetch the range of the pack's pieces that contains the file. Packed
+// files are shared together with their pack, and the recipient loads the pack
+// into its own packDir.
+//
+// Deleting a packed file doesn't delete its data from the pack. Instead,
+// threadedPackLoop periodically deletes packs that aren't used by any file
+// anymore and compacts packs whose data mostly belongs to deleted files by
+// moving the remaining files into the open pack.
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+var (
+	// errPackPath is returned if the user tries to access the hidden
+	// directory that contains the packs.
+	errPackPath = errors.New("hyperspacepath is reserved for packed files")
+)
+
+type (
+	// openPack is the pack that small files are currently appended to.
+	openPack struct {
+		entry    *siafile.SiaFileSetEntry
+		dataPath string    // path of the pack's local data
+		opened   time.Time // time at which the pack was created
+	}
+
+	// packRef is a reference to the data of a packed file within its pack.
+	packRef struct {
+		siaPath string
+		offset  uint64
+		size    uint64
+	}
+)
+
+// isPackPath returns whether siaPath is the directory that contains the packs
+// or a path within that directory.
+func isPackPath(siaPath string) bool {
+	return siaPath == packDir || strings.HasPrefix(siaPath, packDir+"/")
+}
+
+// closePacks closes the packs returned by managedOpenPacks.
+func (r *Renter) closePacks(packs map[string]*siafile.SiaFileSetEntry) {
+	for _, pack := range packs {
+		if err := pack.Close(); err != nil {
+			r.log.Debugln("WARN: Could not close thread:", err)
+		}
+	}
+}
+
+// managedIsOpenPack returns whether the file with the provided UID is the
+// open pack. The open pack is uploaded once it is sealed, so it is skipped by
+// the repair loops until then.
+func (r *Renter) managedIsOpenPack(fileUID string) bool {
+	r.packMu.Lock()
+	defer r.packMu.Unlock()
+	return r.openPack != nil && r.openPack.entry.UID() == fileUID
+}
+
+// managedOpenPacks opens the packs of the packed files among entrys and
+// returns them by their path. Packs that can't be opened are left out. The
+// packs need to be closed using closePacks.
+func (r *Renter) managedOpenPacks(entrys []*siafile.SiaFileSetEntry) map[string]*siafile.SiaFileSetEntry {
+	packs := make(map[string]*siafile.SiaFileSetEntry)
+	for _, entry := range entrys {
+		packPath := entry.PackPath()
+		if _, exists := packs[packPath]; packPath == "" || exists {
+			continue
+		}
+		pack, err := r.staticFileSet.Open(packPath)
+		if err != nil {
+			r.log.Debugln("WARN: Could not open pack", packPath, err)
+			continue
+		}
+		packs[packPath] = pack
+	}
+	return packs
+}
+
+// managedSnapshot returns the snapshot that is used to download the file of
+// entry. The snapshot of a packed file contains the chunks of its pack.
+func (r *Renter) managedSnapshot(entry *siafile.SiaFileSetEntry) (*siafile.Snapshot, error) {
+	packPath := entry.PackPath()
+	if packPath == "" {
+		return entry.Snapshot(), nil
+	}
+	pack, err := r.staticFileSet.Open(packPath)
+	if err != nil {
+		return nil, errors.AddContext(err, "unable to open the pack of the file")
+	}
+	defer pack.Close()
+	return entry.PackedSnapshot(pack.SiaFile), nil
+}
+
+// appendToPack appends data to the open pack and returns the path of the pack
+// and the offset of the data within the pack. A new pack is opened if the
+// data doesn't fit into the open pack. The caller must hold packMu.
+func (r *Renter) appendToPack(data []byte) (string, uint64, error) {
+	size := uint64(len(data))
+	if r.openPack != nil && r.openPack.entry.Size()+size > r.openPack.entry.ChunkSize() {
+		r.sealPack()
+	}
+	if r.openPack == nil {
+		if err := r.newPack(); err != nil {
+			return "", 0, errors.AddContext(err, "unable to create pack")
+		}
+	}
+	pack := r.openPack
+
+	// Append the data to the pack's local data before growing the pack.
+	offset := pack.entry.Size()
+	f, err := os.OpenFile(pack.dataPath, os.O_WRONLY, 0600)
+	if err != nil {
+		return "", 0, err
+	}
+	_, err = f.WriteAt(data, int64(offset))
+	if err = errors.Compose(err, f.Sync(), f.Close()); err != nil {
+		return "", 0, errors.AddContext(err, "unable to write to pack")
+	}
+	if err := pack.entry.SetFileSize(offset + size); err != nil {
+		return "", 0, err
+	}
+	return pack.entry.HyperspacePath(), offset, nil
+}
+
+// newPack creates a new empty pack and makes it the open pack. The caller
+// must hold packMu.
+func (r *Renter) newPack() error {
+	if err := r.createDirUnchecked(packDir); err != nil {
+		return err
+	}
+	dataDir := filepath.Join(r.persistDir, packDataDir)
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(fastrand.Bytes(16))
+	dataPath := filepath.Join(dataDir, id)
+	f, err := os.OpenFile(dataPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	up := modules.FileUploadParams{
+		Source:         dataPath,
+		HyperspacePath: packDir + "/" + id,
+	}
+	up.ErasureCode, _ = siafile.NewRSCode(defaultDataPieces, defaultParityPieces)
+	entry, err := r.staticFileSet.NewSiaFile(up, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 0, defaultFilePerm)
+	if err != nil {
+		return errors.Compose(err, os.Remove(dataPath))
+	}
+	r.openPack = &openPack{
+		entry:    entry,
+		dataPath: dataPath,
+		opened:   time.Now(),
+	}
+	return nil
+}
+
+// sealPack seals the open pack and sends it to the upload heap. The caller
+// must hold packMu.
+func (r *Renter) sealPack() {
+	pack := r.openPack
+	r.openPack = nil
+	defer func() {
+		if err := pack.entry.Close(); err != nil {
+			r.log.Debugln("WARN: Could not close thread:", err)
+		}
+	}()
+
+	// Mark the directory of the pack as unhealthy.
+	if err := r.managedBubbleFileHealth(pack.entry); err != nil {
+		r.log.Println("WARN: Could not update the health of the directory of", pack.entry.HyperspacePath(), err)
+	}
+
+	// Send the pack to the repair loop.
+	hosts := r.managedRefreshHostsAndWorkers()
+	id := r.mu.Lock()
+	unfinishedChunks := r.buildUnfinishedChunks(pack.entry.ChunkEntrys(), hosts, false)
+	r.mu.Unlock(id)
+	for i := 0; i < len(unfinishedChunks); i++ {
+		r.uploadHeap.managedPush(unfinishedChunks[i])
+	}
+	select {
+	case r.uploadHeap.newUploads <- struct{}{}:
+	default:
+	}
+}
+
+// managedPackFile appends the data of a small file to the open pack and
+// creates the siafile of the packed file.
+func (r *Renter) managedPackFile(up modules.FileUploadParams, fileInfo os.FileInfo) error {
+	data, err := ioutil.ReadFile(up.Source)
+	if err != nil {
+		return errors.AddContext(err, "unable to read the source file")
+	}
+	if uint64(len(data)) > maxPackedFileSize {
+		return errors.New("file grew too large to be packed while reading it")
+	}
+
+	r.packMu.Lock()
+	packPath, packOffset, err := r.appendToPack(data)
+	if err != nil {
+		r.packMu.Unlock()
+		return err
+	}
+	entry, err := r.staticFileSet.NewPackedSiaFile(up, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), uint64(len(data)), fileInfo.Mode(), packPath, packOffset)
+	r.packMu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+
+	// Packed files don't have chunks of their own, so their checksum is
+	// computed right away.
+	cw := newChecksumWriter(entry.ChunkSize())
+	cw.Write(data)
+	checksum, _ := cw.Checksums()
+	if err := entry.SetChecksum(checksum); err != nil {
+		r.log.Println("WARN: Could not set the checksum of", up.HyperspacePath, err)
+	}
+
+	// Mark the directory of the file as unhealthy.
+	if err := r.managedBubbleFileHealth(entry); err != nil {
+		r.log.Println("WARN: Could not update the health of the directory of", up.HyperspacePath, err)
+	}
+	return nil
+}
+
+// managedPackRefs returns the references to the packs of all packed files.
+func (r *Renter) managedPackRefs() (map[string][]packRef, error) {
+	refs := make(map[string][]packRef)
+	err := filepath.Walk(r.filesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path == filepath.Join(r.filesDir, packDir) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || filepath.Ext(path) != siafile.ShareExtension {
+			return nil
+		}
+		rel, err := filepath.Rel(r.filesDir, path)
+		if err != nil {
+			return err
+		}
+		siaPath := strings.TrimSuffix(filepath.ToSlash(rel), siafile.ShareExtension)
+		entry, err := r.staticFileSet.Open(siaPath)
+		if err != nil {
+			// The file might have been deleted in the meantime.
+			return nil
+		}
+		if packPath := entry.PackPath(); packPath != "" {
+			refs[packPath] = append(refs[packPath], packRef{
+				siaPath: siaPath,
+				offset:  entry.PackOffset(),
+				size:    entry.Size(),
+			})
+		}
+		return entry.Close()
+	})
+	return refs, err
+}
+
+// managedPackData returns the data of a pack. The data is read from disk if
+// it is still available locally and downloaded otherwise.
+func (r *Renter) managedPackData(pack *siafile.SiaFileSetEntry) ([]byte, error) {
+	if localPath := pack.LocalPath(); localPath != "" {
+		data, err := ioutil.ReadFile(localPath)
+		if err == nil && uint64(len(data)) >= pack.Size() {
+			return data[:pack.Size()], nil
+		}
+	}
+	buf := NewDownloadDestinationBuffer(pack.Size(), pack.PieceSize())
+	d, err := r.managedNewDownload(downloadParams{
+		destination:     buf,
+		destinationType: "buffer",
+		file:            pack.Snapshot(),
+
+		latencyTarget: 200e3, // No need to rush latency on compaction downloads.
+		length:        pack.Size(),
+		needsMemory:   true,
+		offset:        0,
+		overdrive:     0, // No need to rush the latency on compaction downloads.
+		priority:      0, // Compaction downloads are completely de-prioritized.
+	})
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-d.completeChan:
+	case <-r.tg.StopChan():
+		return nil, errors.New("pack download interrupted by stop call")
+	}
+	if d.Err() != nil {
+		return nil, d.Err()
+	}
+	return bytes.Join(buf.buf, nil)[:pack.Size()], nil
+}
+
+// managedCompactPack moves the files that still use a pack into the open
+// pack. The pack itself is deleted by a later maintenance pass once no file
+// uses it anymore.
+func (r *Renter) managedCompactPack(pack *siafile.SiaFileSetEntry, refs []packRef) error {
+	data, err := r.managedPackData(pack)
+	if err != nil {
+		return errors.AddContext(err, "unable to fetch the data of the pack")
+	}
+	packPath := pack.HyperspacePath()
+
+	r.packMu.Lock()
+	defer r.packMu.Unlock()
+	for _, ref := range refs {
+		if ref.offset+ref.size > uint64(len(data)) {
+			r.log.Println("WARN: packed file", ref.siaPath, "exceeds the data of its pack")
+			continue
+		}
+		entry, err := r.staticFileSet.Open(ref.siaPath)
+		if err != nil {
+			continue
+		}
+		// The file might have been replaced in the meantime.
+		if entry.PackPath() != packPath || entry.PackOffset() != ref.offset || entry.Size() != ref.size {
+			entry.Close()
+			continue
+		}
+		newPath, newOffset, err := r.appendToPack(data[ref.offset : ref.offset+ref.size])
+		if err == nil {
+			err = entry.SetPack(newPath, newOffset)
+		}
+		if err = errors.Compose(err, entry.Close()); err != nil {
+			return errors.AddContext(err, "unable to move "+ref.siaPath)
+		}
+	}
+	return nil
+}
+
+// managedMaintainPacks deletes the packs that are no longer used, removes the
+// local data of packs that are fully uploaded and compacts packs which mostly
+// contain data of deleted files. Since files might be renamed while the
+// packed files are collected, a pack is only deleted once it was found unused
+// by two consecutive calls. unused contains the packs that were found unused
+// by the previous call and is updated by managedMaintainPacks.
+func (r *Renter) managedMaintainPacks(unused map[string]bool) error {
+	// Restoring a backup might add packed files.
+	r.backupMu.Lock()
+	defer r.backupMu.Unlock()
+
+	// Only the packs that were sealed before the packed files are collected
+	// are maintained, since only the open pack receives new files.
+	fis, err := ioutil.ReadDir(filepath.Join(r.filesDir, packDir))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	r.packMu.Lock()
+	var openPath string
+	if r.openPack != nil {
+		openPath = r.openPack.entry.HyperspacePath()
+	}
+	r.packMu.Unlock()
+	refs, err := r.managedPackRefs()
+	if err != nil {
+		return errors.AddContext(err, "unable to collect the packed files")
+	}
+
+	for _, fi := range fis {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != siafile.ShareExtension {
+			continue
+		}
+		packPath := packDir + "/" + strings.TrimSuffix(fi.Name(), siafile.ShareExtension)
+		if packPath == openPath {
+			continue
+		}
+		pack, err := r.staticFileSet.Open(packPath)
+		if err != nil {
+			continue
+		}
+		localPath := pack.LocalPath()
+
+		// Delete packs that aren't used anymore.
+		if len(refs[packPath]) == 0 && !unused[packPath] {
+			unused[packPath] = true
+			if err := pack.Close(); err != nil {
+				r.log.Debugln("WARN: Could not close thread:", err)
+			}
+			continue
+		} else if len(refs[packPath]) == 0 {
+			delete(unused, packPath)
+			err := pack.Close()
+			err = errors.Compose(err, r.staticFileSet.Delete(packPath))
+			if localPath != "" {
+				if rmErr := os.Remove(localPath); !os.IsNotExist(rmErr) {
+					err = errors.Compose(err, rmErr)
+				}
+			}
+			if err != nil {
+				r.log.Println("WARN: Could not delete unused pack", packPath, err)
+			}
+			continue
+		}
+		delete(unused, packPath)
+
+		// Remove the local data of packs that are fully uploaded.
+		pks := make(map[string]types.SiaPublicKey)
+		for _, pk := range pack.HostPublicKeys() {
+			pks[string(pk.Key)] = pk
+		}
+		offline, goodForRenew, _ := r.managedContractStatus(pks)
+		if localPath != "" && pack.Health(offline, goodForRenew) == 0 {
+			err := pack.SetLocalPath("")
+			if err == nil {
+				err = os.Remove(localPath)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				r.log.Println("WARN: Could not remove the local data of pack", packPath, err)
+			}
+		}
+
+		// Compact packs that mostly contain data of deleted files.
+		var live uint64
+		for _, ref := range refs[packPath] {
+			live += ref.size
+		}
+		if pack.Size() > 0 && float64(live)/float64(pack.Size()) < packCompactionThreshold {
+			if err := r.managedCompactPack(pack, refs[packPath]); err != nil {
+				r.log.Println("WARN: Could not compact pack", packPath, err)
+			}
+		}
+		if err := pack.Close(); err != nil {
+			r.log.Debugln("WARN: Could not close thread:", err)
+		}
+	}
+	return nil
+}
+
+// managedSealStalePack seals the open pack if it has been open for longer
+// than packSealTimeout.
+func (r *Renter) managedSealStalePack() {
+	r.packMu.Lock()
+	defer r.packMu.Unlock()
+	if r.openPack != nil && time.Since(r.openPack.opened) > packSealTimeout {
+		r.sealPack()
+	}
+}
+
+// threadedPackLoop periodically seals the open pack and maintains the sealed
+// packs.
+func (r *Renter) threadedPackLoop() {
+	err := r.tg.Add()
+	if err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	unused := make(map[string]bool)
+	for {
+		select {
+		case <-time.After(packMaintenanceInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+
+		r.managedSealStalePack()
+		if err := r.managedMaintainPacks(unused); err != nil {
+			r.log.Println("WARN: Could not maintain packs:", err)
+		}
+	}
+}
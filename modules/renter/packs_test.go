@@ -0,0 +1,270 @@
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// newPackedTestFile packs a file with the provided data at siaPath.
+func (r *Renter) newPackedTestFile(siaPath string, data []byte) error {
+	source := filepath.Join(r.persistDir, "source")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		return err
+	}
+	fi, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	up := modules.FileUploadParams{
+		Source:         source,
+		HyperspacePath: siaPath,
+		ErasureCode:    rsc,
+	}
+	return r.managedPackFile(up, fi)
+}
+
+// packOf returns the path of the pack and the offset within the pack of the
+// packed file at siaPath.
+func (r *Renter) packOf(siaPath string) (string, uint64, error) {
+	entry, err := r.staticFileSet.Open(siaPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer entry.Close()
+	return entry.PackPath(), entry.PackOffset(), nil
+}
+
+// managedSealTestPack seals the open pack and returns the path of its local
+// data.
+func (r *Renter) managedSealTestPack() string {
+	r.packMu.Lock()
+	defer r.packMu.Unlock()
+	dataPath := r.openPack.dataPath
+	r.sealPack()
+	return dataPath
+}
+
+// TestAppendToPack tests that data is appended to the open pack until it is
+// full, and that full packs are sealed and sent to the upload heap.
+func TestAppendToPack(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+	r.packMu.Lock()
+	defer r.packMu.Unlock()
+
+	a, b := fastrand.Bytes(1000), fastrand.Bytes(2000)
+	pathA, offsetA, err := r.appendToPack(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pathB, offsetB, err := r.appendToPack(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isPackPath(pathA) || pathB != pathA || offsetA != 0 || offsetB != 1000 {
+		t.Fatal("unexpected pack offsets", pathA, offsetA, pathB, offsetB)
+	}
+	data, err := ioutil.ReadFile(r.openPack.dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, append(a, b...)) || r.openPack.entry.Size() != 3000 {
+		t.Fatal("the local data of the pack doesn't contain the appended data")
+	}
+
+	// Data that exactly fills the pack is still appended to it.
+	chunkSize := r.openPack.entry.ChunkSize()
+	if path, _, err := r.appendToPack(fastrand.Bytes(int(chunkSize - 3000))); err != nil || path != pathA {
+		t.Fatal("data wasn't appended to the open pack", path, err)
+	}
+	if uuc := r.uploadHeap.managedPop(); uuc != nil {
+		t.Fatal("open pack was sent to the upload heap")
+	}
+
+	// Data that doesn't fit anymore seals the pack and opens a new one.
+	pathC, offsetC, err := r.appendToPack(fastrand.Bytes(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pathC == pathA || offsetC != 0 {
+		t.Fatal("data was appended to the full pack", pathC, offsetC)
+	}
+	uuc := r.uploadHeap.managedPop()
+	if uuc == nil {
+		t.Fatal("sealed pack wasn't sent to the upload heap")
+	}
+	if uuc.fileEntry.HyperspacePath() != pathA || uuc.fileEntry.Size() != chunkSize {
+		t.Error("unexpected chunk on the upload heap", uuc.fileEntry.HyperspacePath(), uuc.fileEntry.Size())
+	}
+	uuc.fileEntry.Close()
+}
+
+// TestMaintainPacksDelete tests that packs are only deleted once they were
+// found unused twice, and that the open pack is never deleted.
+func TestMaintainPacksDelete(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	for _, siaPath := range []string{"a", "b"} {
+		if err := r.newPackedTestFile(siaPath, fastrand.Bytes(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	packPath, _, err := r.packOf("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, siaPath := range []string{"a", "b"} {
+		if err := r.DeleteFile(siaPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The open pack is kept even though it is unused.
+	unused := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		if err := r.managedMaintainPacks(unused); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if exists, _ := r.staticFileSet.Exists(packPath); !exists || unused[packPath] {
+		t.Fatal("open pack was deleted")
+	}
+
+	// Once it is sealed, it is deleted by the second pass.
+	dataPath := r.managedSealTestPack()
+	if err := r.managedMaintainPacks(unused); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := r.staticFileSet.Exists(packPath); !exists || !unused[packPath] {
+		t.Fatal("unused pack was deleted by the first pass")
+	}
+	if err := r.managedMaintainPacks(unused); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := r.staticFileSet.Exists(packPath); exists || unused[packPath] {
+		t.Fatal("unused pack wasn't deleted by the second pass")
+	}
+	if _, err := os.Stat(dataPath); !os.IsNotExist(err) {
+		t.Fatal("local data of the unused pack wasn't deleted", err)
+	}
+
+	// A pack that is used again by the second pass is kept, e.g. because its
+	// file was renamed while the first pass collected the packed files.
+	if err := r.newPackedTestFile("c", fastrand.Bytes(100)); err != nil {
+		t.Fatal(err)
+	}
+	packPath, _, err = r.packOf("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.managedSealTestPack()
+	unused[packPath] = true
+	if err := r.managedMaintainPacks(unused); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := r.staticFileSet.Exists(packPath); !exists || unused[packPath] {
+		t.Fatal("used pack was deleted")
+	}
+}
+
+// TestCompactPack tests that the files of packs which mostly contain data of
+// deleted files are moved into the open pack, and that files which were
+// replaced in the meantime are left alone.
+func TestCompactPack(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	a := fastrand.Bytes(100)
+	if err := r.newPackedTestFile("a", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.newPackedTestFile("b", fastrand.Bytes(1000)); err != nil {
+		t.Fatal(err)
+	}
+	oldPack, oldOffset, err := r.packOf("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.managedSealTestPack()
+	if err := r.DeleteFile("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stale reference to the file doesn't move it.
+	pack, err := r.staticFileSet.Open(oldPack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.managedCompactPack(pack, []packRef{{siaPath: "a", offset: oldOffset, size: 99}})
+	pack.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packPath, _, err := r.packOf("a"); err != nil || packPath != oldPack {
+		t.Fatal("file with a stale reference was moved", packPath, err)
+	}
+
+	// Only a fraction of the pack is used, so its files are moved into the
+	// open pack.
+	unused := make(map[string]bool)
+	if err := r.managedMaintainPacks(unused); err != nil {
+		t.Fatal(err)
+	}
+	newPack, newOffset, err := r.packOf("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.packMu.Lock()
+	openPath, dataPath := r.openPack.entry.HyperspacePath(), r.openPack.dataPath
+	r.packMu.Unlock()
+	if newPack != openPath {
+		t.Fatal("file wasn't moved into the open pack", newPack)
+	}
+	data, err := ioutil.ReadFile(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(data)) < newOffset+uint64(len(a)) || !bytes.Equal(data[newOffset:newOffset+uint64(len(a))], a) {
+		t.Fatal("the open pack doesn't contain the data of the moved file")
+	}
+
+	// The compacted pack is deleted once it was found unused twice.
+	for i := 0; i < 2; i++ {
+		if err := r.managedMaintainPacks(unused); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if exists, _ := r.staticFileSet.Exists(oldPack); exists {
+		t.Fatal("compacted pack wasn't deleted")
+	}
+}
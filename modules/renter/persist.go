@@ -8,9 +8,9 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
-	"time"
 
 	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/crypto"
 	"github.com/HyperspaceApp/Hyperspace/encoding"
 	"github.com/HyperspaceApp/Hyperspace/modules"
 	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
@@ -46,6 +46,11 @@ var (
 		Version: persistVersion,
 	}
 
+	siaDirMetadataHeader = persist.Metadata{
+		Header:  "Sia Directory Metadata",
+		Version: persistVersion,
+	}
+
 	shareHeader  = [15]byte{'S', 'i', 'a', ' ', 'S', 'h', 'a', 'r', 'e', 'd', ' ', 'F', 'i', 'l', 'e'}
 	shareVersion = "0.4"
 
@@ -57,9 +62,13 @@ var (
 type (
 	// persist contains all of the persistent renter data.
 	persistence struct {
-		MaxDownloadSpeed int64
-		MaxUploadSpeed   int64
-		StreamCacheSize  uint64
+		MaxDownloadSpeed  int64
+		MaxMigrationSpeed int64
+		MaxUploadSpeed    int64
+		StreamCacheSize   uint64
+
+		// SharingKey signs the files shared by the renter.
+		SharingKey crypto.SecretKey
 	}
 )
 
@@ -184,7 +193,13 @@ func (r *Renter) createDir(hyperspacepath string) error {
 	if err := validateSiapath(hyperspacepath); err != nil {
 		return err
 	}
+	return r.createDirUnchecked(hyperspacepath)
+}
 
+// createDirUnchecked creates a directory in the renter directory without
+// enforcing the nickname rules. It is used for the reserved directories of
+// the renter.
+func (r *Renter) createDirUnchecked(hyperspacepath string) error {
 	// Create direcotry
 	path := filepath.Join(r.filesDir, hyperspacepath)
 	if err := os.MkdirAll(path, 0700); err != nil {
@@ -192,6 +207,8 @@ func (r *Renter) createDir(hyperspacepath string) error {
 	}
 
 	// Make sure all parent directories have metadata files
+	r.siaDirMu.Lock()
+	defer r.siaDirMu.Unlock()
 	for path != filepath.Dir(r.filesDir) {
 		if err := createDirMetadata(path); err != nil {
 			return err
@@ -202,27 +219,14 @@ func (r *Renter) createDir(hyperspacepath string) error {
 }
 
 // createDirMetadata makes sure there is a metadata file in the directory and
-// updates or creates one as needed
+// creates one if needed. The caller must hold siaDirMu.
 func createDirMetadata(path string) error {
 	fullPath := filepath.Join(path, SiaDirMetadata)
 	// Check if metadata file exists
 	if _, err := os.Stat(fullPath); err == nil {
-		// TODO: update metadata file
 		return nil
 	}
-
-	// TODO: update to get actual min redundancy
-	data := struct {
-		LastUpdate    int64
-		MinRedundancy float64
-	}{time.Now().UnixNano(), float64(0)}
-
-	metadataHeader := persist.Metadata{
-		Header:  "Sia Directory Metadata",
-		Version: persistVersion,
-	}
-
-	return persist.SaveJSON(metadataHeader, data, fullPath)
+	return saveSiaDirMetadata(path, siaDirMetadata{})
 }
 
 // saveSync stores the current renter data to disk and then syncs to disk.
@@ -232,7 +236,11 @@ func (r *Renter) saveSync() error {
 
 // load fetches the saved renter data from disk.
 func (r *Renter) loadSettings() error {
-	r.persist = persistence{}
+	// Settings that were added later keep their defaults if they weren't
+	// persisted yet.
+	r.persist = persistence{
+		MaxMigrationSpeed: DefaultMaxMigrationSpeed,
+	}
 	err := persist.LoadJSON(settingsMetadata, &r.persist, filepath.Join(r.persistDir, PersistFilename))
 	if os.IsNotExist(err) {
 		// No persistence yet, set the defaults and continue.
@@ -256,6 +264,14 @@ func (r *Renter) loadSettings() error {
 		return err
 	}
 
+	// Renters that never shared files don't have a sharing key yet.
+	if r.persist.SharingKey == (crypto.SecretKey{}) {
+		r.persist.SharingKey, _ = crypto.GenerateKeyPair()
+		if err := r.saveSync(); err != nil {
+			return err
+		}
+	}
+
 	// Set the bandwidth limits on the contractor, which was already initialized
 	// without bandwidth limits.
 	return r.setBandwidthLimits(r.persist.MaxDownloadSpeed, r.persist.MaxUploadSpeed)
@@ -289,89 +305,14 @@ func shareFiles(files []*file, w io.Writer) error {
 	return zip.Close()
 }
 
-/*
-// ShareFiles saves the specified files to shareDest.
-func (r *Renter) ShareFiles(nicknames []string, shareDest string) error {
-	lockID := r.mu.RLock()
-	defer r.mu.RUnlock(lockID)
-
-	// TODO: consider just appending the proper extension.
-	if filepath.Ext(shareDest) != siafile.ShareExtension {
-		return ErrNonShareSuffix
-	}
-
-	handle, err := os.Create(shareDest)
-	if err != nil {
-		return err
-	}
-	defer handle.Close()
-	sfs, err := r.staticFileSet.All()
-	if err != nil {
-		return err
-	}
-
-	// Load files from renter.
-	files := make([]*file, len(nicknames))
-	for i, name := range nicknames {
-		exists := r.files[name]
-		if !exists {
-			return siafile.ErrUnknownPath
-		}
-		files[i] = f
-	}
-
-	err = shareFiles(files, handle)
-	if err != nil {
-		os.Remove(shareDest)
-		return err
-	}
-
-	return nil
-}
-
-// ShareFilesASCII returns the specified files in ASCII format.
-func (r *Renter) ShareFilesASCII(nicknames []string) (string, error) {
-	lockID := r.mu.RLock()
-	defer r.mu.RUnlock(lockID)
-
-	// Load files from renter.
-	files := make([]*file, len(nicknames))
-	for i, name := range nicknames {
-		f, exists := r.files[name]
-		if !exists {
-			return "", siafile.ErrUnknownPath
-		}
-		files[i] = f
-	}
-
-	buf := new(bytes.Buffer)
-	err := shareFiles(files, base64.NewEncoder(base64.URLEncoding, buf))
-	if err != nil {
-		return "", err
-	}
-
-	return buf.String(), nil
-}
-*/
-
-// loadSharedFiles reads .sia data from reader and registers the contained
-// files in the renter. It returns the nicknames of the loaded files.
+// loadSharedFiles reads legacy .sia data, following the header and version,
+// from reader and registers the contained files in the renter. It returns the
+// nicknames of the loaded files.
 func (r *Renter) loadSharedFiles(reader io.Reader, repairPath string) ([]string, error) {
-	// read header
-	var header [15]byte
-	var version string
 	var numFiles uint64
-	err := encoding.NewDecoder(reader).DecodeAll(
-		&header,
-		&version,
-		&numFiles,
-	)
+	err := encoding.NewDecoder(reader).Decode(&numFiles)
 	if err != nil {
 		return nil, err
-	} else if header != shareHeader {
-		return nil, ErrBadFile
-	} else if version != shareVersion {
-		return nil, ErrIncompatible
 	}
 
 	// Create decompressor.
@@ -449,6 +390,37 @@ func (r *Renter) initPersist() error {
 	r.wal = wal
 	r.staticFileSet = siafile.NewSiaFileSet(r.filesDir, wal)
 
+	// Load the dedup index.
+	r.staticDedupIndex, err = loadDedupIndex(filepath.Join(r.persistDir, dedupFile))
+	if err != nil {
+		return errors.AddContext(err, "failed to load the dedup index")
+	}
+
+	// Load the auditor.
+	r.staticAuditor, err = loadAuditor(filepath.Join(r.persistDir, auditFile))
+	if err != nil {
+		return errors.AddContext(err, "failed to load the audit state")
+	}
+
+	// Load the re-encode jobs.
+	r.staticReencodes, err = loadReencodeSet(filepath.Join(r.persistDir, reencodeFile))
+	if err != nil {
+		return errors.AddContext(err, "failed to load the re-encode jobs")
+	}
+
+	// Load the sync jobs.
+	r.staticSyncs, err = loadSyncManager(filepath.Join(r.persistDir, syncFile))
+	if err != nil {
+		return errors.AddContext(err, "failed to load the sync jobs")
+	}
+
+	// Load the file index.
+	var indexExists bool
+	r.staticFileIndex, indexExists, err = loadFileIndex(filepath.Join(r.persistDir, fileIndexFile))
+	if err != nil {
+		return errors.AddContext(err, "failed to load the file index")
+	}
+
 	// Apply unapplied wal txns.
 	for _, txn := range txns {
 		applyTxn := true
@@ -471,31 +443,33 @@ func (r *Renter) initPersist() error {
 		}
 	}
 
+	// Build the file index if it wasn't persisted yet.
+	if !indexExists {
+		if err := r.managedRebuildFileIndex(); err != nil {
+			return errors.AddContext(err, "failed to build the file index")
+		}
+	}
 	return nil
 }
 
 // LoadSharedFiles loads a .sia file into the renter. It returns the nicknames
-// of the loaded files.
-func (r *Renter) LoadSharedFiles(filename string) ([]string, error) {
-	lockID := r.mu.Lock()
-	defer r.mu.Unlock(lockID)
-
+// of the loaded files and the key the files were signed with. Legacy .sia
+// files are not signed.
+func (r *Renter) LoadSharedFiles(filename string) ([]string, types.SiaPublicKey, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return nil, err
+		return nil, types.SiaPublicKey{}, err
 	}
 	defer file.Close()
-	return r.loadSharedFiles(file, filename)
+	return r.managedLoadSharedFiles(file, filename)
 }
 
 // LoadSharedFilesASCII loads an ASCII-encoded .sia file into the renter. It
-// returns the nicknames of the loaded files.
-func (r *Renter) LoadSharedFilesASCII(asciiSia string) ([]string, error) {
-	lockID := r.mu.Lock()
-	defer r.mu.Unlock(lockID)
-
+// returns the nicknames of the loaded files and the key the files were signed
+// with.
+func (r *Renter) LoadSharedFilesASCII(asciiSia string) ([]string, types.SiaPublicKey, error) {
 	dec := base64.NewDecoder(base64.URLEncoding, bytes.NewBufferString(asciiSia))
-	return r.loadSharedFiles(dec, "")
+	return r.managedLoadSharedFiles(dec, "")
 }
 
 // convertPersistVersionFrom040to133 upgrades a legacy persist file to the next
@@ -513,6 +487,7 @@ func convertPersistVersionFrom040To133(path string) error {
 	}
 	metadata.Version = persistVersion133
 	p.MaxDownloadSpeed = DefaultMaxDownloadSpeed
+	p.MaxMigrationSpeed = DefaultMaxMigrationSpeed
 	p.MaxUploadSpeed = DefaultMaxUploadSpeed
 	p.StreamCacheSize = DefaultStreamCacheSize
 	return persist.SaveJSON(metadata, p, path)
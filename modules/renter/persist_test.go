@@ -72,6 +72,9 @@ func TestRenterSaveLoad(t *testing.T) {
 	if settings.MaxUploadSpeed != DefaultMaxUploadSpeed {
 		t.Error("default max upload speed not set at init")
 	}
+	if settings.MaxMigrationSpeed != DefaultMaxMigrationSpeed {
+		t.Error("default max migration speed not set at init")
+	}
 	if settings.StreamCacheSize != DefaultStreamCacheSize {
 		t.Error("default stream cache size not set at init")
 	}
@@ -80,8 +83,10 @@ func TestRenterSaveLoad(t *testing.T) {
 	// download speed.
 	newDownSpeed := int64(300e3)
 	newUpSpeed := int64(500e3)
+	newMigrationSpeed := int64(200e3)
 	newCacheSize := uint64(3)
 	settings.MaxDownloadSpeed = newDownSpeed
+	settings.MaxMigrationSpeed = newMigrationSpeed
 	settings.MaxUploadSpeed = newUpSpeed
 	settings.StreamCacheSize = newCacheSize
 	rt.renter.SetSettings(settings)
@@ -129,6 +134,9 @@ func TestRenterSaveLoad(t *testing.T) {
 	if newSettings.MaxUploadSpeed != newUpSpeed {
 		t.Error("upload settings not being persisted correctly")
 	}
+	if newSettings.MaxMigrationSpeed != newMigrationSpeed {
+		t.Error("migration settings not being persisted correctly")
+	}
 	if newSettings.StreamCacheSize != newCacheSize {
 		t.Error("cache settings not being persisted correctly")
 	}
@@ -277,7 +285,7 @@ func TestSiafileCompatibility(t *testing.T) {
 
 	// Load the compatibility file into the renter.
 	path := filepath.Join("..", "..", "compatibility", "siafile_v0.4.8.sia")
-	names, err := rt.renter.LoadSharedFiles(path)
+	names, _, err := rt.renter.LoadSharedFiles(path)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,137 @@
+package proto
+
+import (
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/errors"
+)
+
+// A ContractBackup contains everything needed to restore a contract into a
+// ContractSet: the contract header, which includes the renter's secret key,
+// and the Merkle roots of the sectors stored under the contract.
+type ContractBackup struct {
+	Header contractHeader
+	Roots  []crypto.Hash
+}
+
+// ID returns the ID of the backed-up contract.
+func (cb ContractBackup) ID() types.FileContractID { return cb.Header.ID() }
+
+// HostPublicKey returns the public key of the host that the backed-up
+// contract was formed with.
+func (cb ContractBackup) HostPublicKey() types.SiaPublicKey { return cb.Header.HostPublicKey() }
+
+// WithoutRoots returns a copy of the backup without its Merkle roots. This is
+// enough to recover the contract for downloading.
+func (cb ContractBackup) WithoutRoots() ContractBackup {
+	return ContractBackup{Header: cb.Header}
+}
+
+// Backup returns a ContractBackup for every contract in the set.
+func (cs *ContractSet) Backup() ([]ContractBackup, error) {
+	var backups []ContractBackup
+	for _, id := range cs.IDs() {
+		sc, ok := cs.Acquire(id)
+		if !ok {
+			continue
+		}
+		header := sc.header
+		roots, err := sc.merkleRoots.merkleRoots()
+		cs.Return(sc)
+		if err != nil {
+			return nil, errors.AddContext(err, "unable to read the roots of contract "+id.String())
+		}
+		backups = append(backups, ContractBackup{
+			Header: header,
+			Roots:  roots,
+		})
+	}
+	return backups, nil
+}
+
+// FetchBackupIndex retrieves the backup index stored on a host under pk. No
+// contract is required to read an index.
+func (cs *ContractSet) FetchBackupIndex(host modules.HostDBEntry, pk crypto.PublicKey, cancel <-chan struct{}) (modules.LoopBackupIndexResponse, error) {
+	conn, closeChan, err := dialLoop(host, types.FileContractID{}, crypto.SecretKey{}, cs.rl, cancel)
+	if err != nil {
+		return modules.LoopBackupIndexResponse{}, err
+	}
+	s := &Session{
+		closeChan:   closeChan,
+		conn:        conn,
+		contractSet: cs,
+		deps:        cs.deps,
+		host:        host,
+	}
+	defer s.Close()
+
+	extendDeadline(conn, modules.NegotiateSettingsTime)
+	if err := s.writeRequest(modules.RPCLoopBackupIndex, modules.LoopBackupIndexRequest{PublicKey: pk}); err != nil {
+		return modules.LoopBackupIndexResponse{}, err
+	}
+	var resp modules.LoopBackupIndexResponse
+	if err := modules.ReadRPCResponse(conn, &resp); err != nil {
+		return modules.LoopBackupIndexResponse{}, err
+	}
+	return resp, nil
+}
+
+// RecoverContract restores a backed-up contract into the set, replacing any
+// contract with the same ID. The host is asked for the most recent revision
+// of the contract, which replaces the backed-up one. If that revision no
+// longer matches the backed-up Merkle roots, the contract is recovered
+// without its roots and its utility is locked to not good for upload or
+// renew, so that it is only used to download existing data until it expires.
+func (cs *ContractSet) RecoverContract(cb ContractBackup, host modules.HostDBEntry, hdb hostDB, cancel <-chan struct{}) (modules.RenterContract, error) {
+	header := cb.Header
+	if err := header.validate(); err != nil {
+		return modules.RenterContract{}, err
+	}
+
+	// Fetch the most recent revision from the host.
+	conn, closeChan, err := dialLoop(host, header.ID(), header.SecretKey, cs.rl, cancel)
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+	s := &Session{
+		closeChan:   closeChan,
+		conn:        conn,
+		contractID:  header.ID(),
+		contractSet: cs,
+		deps:        cs.deps,
+		hdb:         hdb,
+		host:        host,
+	}
+	resp, err := s.recentRevision()
+	s.Close()
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
+
+	ourRev := header.LastRevision()
+	if resp.Revision.UnlockConditions.UnlockHash() != ourRev.UnlockConditions.UnlockHash() {
+		return modules.RenterContract{}, errors.New("unlock conditions do not match")
+	} else if resp.Revision.NewRevisionNumber < ourRev.NewRevisionNumber {
+		return modules.RenterContract{}, &recentRevisionError{ourRev.NewRevisionNumber, resp.Revision.NewRevisionNumber}
+	}
+	header.Transaction = types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{resp.Revision},
+		TransactionSignatures: resp.Signatures,
+	}
+	roots := cb.Roots
+	if resp.Revision.NewFileMerkleRoot != cachedMerkleRoot(roots) {
+		roots = nil
+		header.Utility = modules.ContractUtility{
+			GoodForUpload: false,
+			GoodForRenew:  false,
+			Locked:        true,
+		}
+	}
+
+	// Replace any existing copy of the contract.
+	if sc, ok := cs.Acquire(header.ID()); ok {
+		cs.Delete(sc)
+	}
+	return cs.managedInsertContract(header, roots)
+}
@@ -13,6 +13,10 @@ import (
 	"github.com/HyperspaceApp/errors"
 )
 
+// ErrBadSectorData is returned by downloads if the host sent data that doesn't
+// match the Merkle root of the requested sector.
+var ErrBadSectorData = errors.New("host provided incorrect sector data")
+
 // A Downloader retrieves sectors by calling the download RPC on a host.
 // Downloaders are NOT thread- safe; calls to Sector must be serialized.
 type Downloader struct {
@@ -126,9 +130,9 @@ func (hd *Downloader) Download(root crypto.Hash, offset, length uint32) (_ modul
 	}
 	sector := sectors[0]
 	if uint64(len(sector)) != modules.SectorSize {
-		return modules.RenterContract{}, nil, errors.New("host did not send enough sector data")
+		return modules.RenterContract{}, nil, errors.AddContext(ErrBadSectorData, "host did not send enough sector data")
 	} else if crypto.MerkleRoot(sector) != root {
-		return modules.RenterContract{}, nil, errors.New("host sent bad sector data")
+		return modules.RenterContract{}, nil, ErrBadSectorData
 	}
 
 	// update contract and metrics
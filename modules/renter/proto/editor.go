@@ -15,6 +15,10 @@ import (
 	"gitlab.com/NebulousLabs/ratelimit"
 )
 
+// ErrInsufficientUploadFunds is returned by Upload if the contract can't pay
+// for another sector.
+var ErrInsufficientUploadFunds = errors.New("contract has insufficient funds to support upload")
+
 // cachedMerkleRoot calculates the root of a set of existing Merkle roots.
 func cachedMerkleRoot(roots []crypto.Hash) crypto.Hash {
 	tree := crypto.NewCachedTree(sectorHeight) // NOTE: height is not strictly necessary here
@@ -85,7 +89,7 @@ func (he *Editor) Upload(data []byte) (_ modules.RenterContract, _ crypto.Hash,
 
 	sectorPrice := sectorStoragePrice.Add(sectorBandwidthPrice)
 	if contract.RenterFunds().Cmp(sectorPrice) < 0 {
-		return modules.RenterContract{}, crypto.Hash{}, errors.New("contract has insufficient funds to support upload")
+		return modules.RenterContract{}, crypto.Hash{}, ErrInsufficientUploadFunds
 	}
 	if contract.LastRevision().NewMissedProofOutputs[1].Value.Cmp(sectorCollateral) < 0 {
 		sectorCollateral = contract.LastRevision().NewMissedProofOutputs[1].Value
@@ -84,15 +84,8 @@ func (s *Session) RecentRevision() (types.FileContractRevision, []types.Transact
 	}
 	defer s.contractSet.Return(sc)
 
-	// send RecentRevision RPC request
-	extendDeadline(s.conn, modules.NegotiateRecentRevisionTime)
-	if err := s.writeRequest(modules.RPCLoopRecentRevision, nil); err != nil {
-		return types.FileContractRevision{}, nil, err
-	}
-
-	// read the response
-	var resp modules.LoopRecentRevisionResponse
-	if err := modules.ReadRPCResponse(s.conn, &resp); err != nil {
+	resp, err := s.recentRevision()
+	if err != nil {
 		return types.FileContractRevision{}, nil, err
 	}
 
@@ -116,6 +109,34 @@ func (s *Session) RecentRevision() (types.FileContractRevision, []types.Transact
 	return resp.Revision, resp.Signatures, nil
 }
 
+// recentRevision sends the RecentRevision RPC request and reads the host's
+// response without comparing it to our copy of the contract.
+func (s *Session) recentRevision() (modules.LoopRecentRevisionResponse, error) {
+	// send RecentRevision RPC request
+	extendDeadline(s.conn, modules.NegotiateRecentRevisionTime)
+	if err := s.writeRequest(modules.RPCLoopRecentRevision, nil); err != nil {
+		return modules.LoopRecentRevisionResponse{}, err
+	}
+
+	// read the response
+	var resp modules.LoopRecentRevisionResponse
+	if err := modules.ReadRPCResponse(s.conn, &resp); err != nil {
+		return modules.LoopRecentRevisionResponse{}, err
+	}
+	return resp, nil
+}
+
+// SetBackupIndex calls the SetBackupIndex RPC, storing a signed backup index
+// on the host. The host only accepts the index if the session was opened with
+// a contract.
+func (s *Session) SetBackupIndex(req modules.LoopSetBackupIndexRequest) error {
+	extendDeadline(s.conn, modules.NegotiateSettingsTime)
+	if err := s.writeRequest(modules.RPCLoopSetBackupIndex, req); err != nil {
+		return err
+	}
+	return modules.ReadRPCResponse(s.conn, &struct{}{})
+}
+
 // Upload calls the Upload RPC and transfers the supplied data, returning the
 // updated contract and the Merkle root of the sector.
 func (s *Session) Upload(data []byte) (_ modules.RenterContract, _ crypto.Hash, err error) {
@@ -143,7 +164,7 @@ func (s *Session) Upload(data []byte) (_ modules.RenterContract, _ crypto.Hash,
 	// check that enough funds are available
 	sectorPrice := sectorStoragePrice.Add(sectorBandwidthPrice)
 	if contract.RenterFunds().Cmp(sectorPrice) < 0 {
-		return modules.RenterContract{}, crypto.Hash{}, errors.New("contract has insufficient funds to support upload")
+		return modules.RenterContract{}, crypto.Hash{}, ErrInsufficientUploadFunds
 	}
 	if contract.LastRevision().NewMissedProofOutputs[1].Value.Cmp(sectorCollateral) < 0 {
 		return modules.RenterContract{}, crypto.Hash{}, errors.New("contract has insufficient collateral to support upload")
@@ -351,15 +372,15 @@ func (s *Session) Download(root crypto.Hash, offset, length uint32) (_ modules.R
 	}
 
 	if len(resp.Data) != int(req.Length) {
-		return modules.RenterContract{}, nil, errors.New("host did not send enough sector data")
+		return modules.RenterContract{}, nil, errors.AddContext(ErrBadSectorData, "host did not send enough sector data")
 	} else if req.MerkleProof {
 		proofStart := int(req.Offset) / crypto.SegmentSize
 		proofEnd := int(req.Offset+req.Length) / crypto.SegmentSize
 		if !crypto.VerifyRangeProof(resp.Data, resp.MerkleProof, proofStart, proofEnd, req.MerkleRoot) {
-			return modules.RenterContract{}, nil, errors.New("host provided incorrect sector data or Merkle proof")
+			return modules.RenterContract{}, nil, errors.AddContext(ErrBadSectorData, "host provided an invalid Merkle proof")
 		}
 	} else if crypto.MerkleRoot(resp.Data) != req.MerkleRoot {
-		return modules.RenterContract{}, nil, errors.New("host provided incorrect sector data")
+		return modules.RenterContract{}, nil, ErrBadSectorData
 	}
 
 	// Disrupt after sending the signed revision to the host.
@@ -520,14 +541,36 @@ func (cs *ContractSet) NewSession(host modules.HostDBEntry, id types.FileContrac
 		}
 	}()
 
+	conn, closeChan, err := dialLoop(host, id, contract.SecretKey, cs.rl, cancel)
+	if err != nil {
+		return nil, err
+	}
+
+	// the host is now ready to accept revisions
+	return &Session{
+		closeChan:   closeChan,
+		conn:        conn,
+		contractID:  id,
+		contractSet: cs,
+		deps:        cs.deps,
+		hdb:         hdb,
+		height:      currentHeight,
+		host:        host,
+	}, nil
+}
+
+// dialLoop connects to a host and performs the RPC loop handshake. If id is
+// not blank, sk is used to prove ownership of the contract, which the host
+// will lock for the duration of the loop.
+func dialLoop(host modules.HostDBEntry, id types.FileContractID, sk crypto.SecretKey, rl *ratelimit.RateLimit, cancel <-chan struct{}) (_ net.Conn, _ chan struct{}, err error) {
 	c, err := (&net.Dialer{
 		Cancel:  cancel,
 		Timeout: 45 * time.Second, // TODO: Constant
 	}).Dial("tcp", string(host.NetAddress))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	conn := ratelimit.NewRLConn(c, cs.rl, cancel)
+	conn := ratelimit.NewRLConn(c, rl, cancel)
 
 	closeChan := make(chan struct{})
 	go func() {
@@ -537,10 +580,16 @@ func (cs *ContractSet) NewSession(host modules.HostDBEntry, id types.FileContrac
 		case <-closeChan:
 		}
 	}()
+	defer func() {
+		if err != nil {
+			close(closeChan)
+			conn.Close()
+		}
+	}()
 
 	extendDeadline(conn, modules.NegotiateSettingsTime)
 	if err := encoding.WriteObject(conn, modules.RPCLoopEnter); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// perform initial handshake
@@ -551,34 +600,24 @@ func (cs *ContractSet) NewSession(host modules.HostDBEntry, id types.FileContrac
 		ContractID: id,
 	}
 	if err := encoding.NewEncoder(conn).Encode(req); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	var resp modules.LoopHandshakeResponse
 	if err := modules.ReadRPCResponse(conn, &resp); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if resp.Cipher != modules.CipherPlaintext {
-		return nil, errors.New("host selected unsupported cipher")
+		return nil, nil, errors.New("host selected unsupported cipher")
 	}
 	// respond to challenge
-	hash := crypto.HashAll(modules.RPCChallengePrefix, resp.Challenge)
-	sig := crypto.SignHash(hash, contract.SecretKey)
-	cresp := modules.LoopChallengeResponse{
-		Signature: sig[:],
+	var cresp modules.LoopChallengeResponse
+	if id != (types.FileContractID{}) {
+		hash := crypto.HashAll(modules.RPCChallengePrefix, resp.Challenge)
+		sig := crypto.SignHash(hash, sk)
+		cresp.Signature = sig[:]
 	}
 	if err := encoding.NewEncoder(conn).Encode(cresp); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	// the host is now ready to accept revisions
-	return &Session{
-		closeChan:   closeChan,
-		conn:        conn,
-		contractID:  id,
-		contractSet: cs,
-		deps:        cs.deps,
-		hdb:         hdb,
-		height:      currentHeight,
-		host:        host,
-	}, nil
+	return conn, closeChan, nil
 }
@@ -0,0 +1,415 @@
+package renter
+
+// Changing the redundancy of a file requires re-encoding it, since the pieces
+// of its chunks depend on the erasure code. A re-encode job creates a new
+// version of the file next to the old one, at the file's siapath with the
+// reencodeSuffix, and fills it with the file's data. The data is read from the
+// local copy of the file if it is unchanged and downloaded from the network
+// otherwise. The new version is uploaded and repaired like any other file, and
+// once it is fully redundant it atomically replaces the old version.
+//
+// Jobs are persisted, so re-encoding continues after a restart. The new
+// version of a file that wasn't filled completely when the renter stopped is
+// deleted and filled again.
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/persist"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/errors"
+)
+
+const (
+	// reencodeFile is the name of the file that persists the re-encode jobs.
+	reencodeFile = "reencode.json"
+
+	// reencodeSuffix is appended to the siapath of a file to get the siapath
+	// of its new version while it is re-encoded.
+	reencodeSuffix = ".reencode"
+)
+
+var (
+	// reencodeMetadata is the header of the re-encode file.
+	reencodeMetadata = persist.Metadata{
+		Header:  "Renter Reencode Jobs",
+		Version: persistVersion,
+	}
+
+	// errReencodeInProgress is returned if the redundancy of a file is changed
+	// while it is still re-encoded.
+	errReencodeInProgress = errors.New("file is already being re-encoded")
+
+	// errSameRedundancy is returned if the redundancy of a file is changed to
+	// its current redundancy.
+	errSameRedundancy = errors.New("file already uses the requested redundancy")
+)
+
+type (
+	// reencodeSet tracks the re-encode jobs of the renter.
+	reencodeSet struct {
+		// jobs maps the siapaths of the files that are re-encoded to their
+		// jobs.
+		jobs map[string]*reencodeJob
+
+		path string
+		mu   sync.Mutex
+	}
+
+	// reencodeJob is the re-encoding of a file with a new erasure code.
+	reencodeJob struct {
+		HyperspacePath string    `json:"hyperspacepath"`
+		CreateTime     time.Time `json:"createtime"` // identifies the version of the file that is re-encoded
+		DataPieces     int       `json:"datapieces"`
+		ParityPieces   int       `json:"paritypieces"`
+		Filled         bool      `json:"filled"` // whether the new version contains all the data
+	}
+)
+
+// loadReencodeSet loads the re-encode jobs persisted at path. An empty set is
+// returned if they weren't persisted yet.
+func loadReencodeSet(path string) (*reencodeSet, error) {
+	rs := &reencodeSet{
+		jobs: make(map[string]*reencodeJob),
+		path: path,
+	}
+	err := persist.LoadJSON(reencodeMetadata, &rs.jobs, path)
+	if os.IsNotExist(err) {
+		return rs, nil
+	}
+	return rs, err
+}
+
+// save persists the re-encode jobs. The caller must hold the lock.
+func (rs *reencodeSet) save() error {
+	return persist.SaveJSON(reencodeMetadata, rs.jobs, rs.path)
+}
+
+// managedJobs returns copies of the re-encode jobs.
+func (rs *reencodeSet) managedJobs() []reencodeJob {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	jobs := make([]reencodeJob, 0, len(rs.jobs))
+	for _, job := range rs.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// managedAdd adds a job to the set. It fails if the file is already
+// re-encoded.
+func (rs *reencodeSet) managedAdd(job reencodeJob) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if _, exists := rs.jobs[job.HyperspacePath]; exists {
+		return errReencodeInProgress
+	}
+	rs.jobs[job.HyperspacePath] = &job
+	return rs.save()
+}
+
+// managedSetFilled marks the new version of the file at siaPath as filled.
+func (rs *reencodeSet) managedSetFilled(siaPath string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	job, exists := rs.jobs[siaPath]
+	if !exists {
+		return nil
+	}
+	job.Filled = true
+	return rs.save()
+}
+
+// managedRemove removes the job of the file at siaPath.
+func (rs *reencodeSet) managedRemove(siaPath string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	delete(rs.jobs, siaPath)
+	return rs.save()
+}
+
+// managedInProgress returns whether the file at siaPath is re-encoded.
+func (rs *reencodeSet) managedInProgress(siaPath string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	_, exists := rs.jobs[siaPath]
+	return exists
+}
+
+// SetFileRedundancy changes the erasure code of the file at siaPath. The file
+// is re-encoded in the background and keeps its old redundancy until the new
+// version is fully uploaded.
+func (r *Renter) SetFileRedundancy(siaPath string, ec modules.ErasureCoder) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+
+	if err := validateSiapath(siaPath); err != nil {
+		return err
+	}
+	if isPackPath(siaPath) {
+		return errPackPath
+	}
+	if strings.HasSuffix(siaPath, reencodeSuffix) && r.staticReencodes.managedInProgress(strings.TrimSuffix(siaPath, reencodeSuffix)) {
+		return errReencodeInProgress
+	}
+	if ec == nil || ec.MinPieces() < 1 || ec.NumPieces() <= ec.MinPieces() {
+		return errors.New("invalid erasure code")
+	}
+	entry, err := r.staticFileSet.Open(siaPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	if r.uploadHeap.managedIsStreaming(entry.UID()) {
+		return errors.New("can't change the redundancy of a file that is still being uploaded")
+	}
+	// Packed files are stored in the chunks of their pack, they become regular
+	// files when they are re-encoded.
+	if entry.PackPath() == "" && entry.ErasureCode().MinPieces() == ec.MinPieces() && entry.ErasureCode().NumPieces() == ec.NumPieces() {
+		return errSameRedundancy
+	}
+	if exists, _ := r.staticFileSet.Exists(siaPath + reencodeSuffix); exists {
+		return siafile.ErrPathOverload
+	}
+	err = r.staticReencodes.managedAdd(reencodeJob{
+		HyperspacePath: siaPath,
+		CreateTime:     entry.CreateTime(),
+		DataPieces:     ec.MinPieces(),
+		ParityPieces:   ec.NumPieces() - ec.MinPieces(),
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case r.reencodeChan <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// localCopyMatches returns whether the local copy of a file still
+// contains the file's data.
+func localCopyMatches(entry *siafile.SiaFileSetEntry) bool {
+	localPath := entry.LocalPath()
+	if localPath == "" {
+		return false
+	}
+	fi, err := os.Stat(localPath)
+	if err != nil || fi.IsDir() || uint64(fi.Size()) != entry.Size() {
+		return false
+	}
+	checksum, ok := entry.Checksum()
+	if !ok {
+		return true
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	cw := newChecksumWriter(entry.ChunkSize())
+	if _, err := io.Copy(cw, f); err != nil {
+		return false
+	}
+	localChecksum, _ := cw.Checksums()
+	return localChecksum == checksum
+}
+
+// managedFillReencode creates the new version of the file of a job and fills
+// it with the file's data.
+func (r *Renter) managedFillReencode(entry *siafile.SiaFileSetEntry, job reencodeJob) error {
+	ec, err := siafile.NewRSCode(job.DataPieces, job.ParityPieces)
+	if err != nil {
+		return err
+	}
+	up := modules.FileUploadParams{
+		HyperspacePath: job.HyperspacePath + reencodeSuffix,
+		ErasureCode:    ec,
+		Dedup:          entry.Dedup(),
+		ContentType:    entry.ContentType(),
+		Metadata:       entry.UserMetadata(),
+	}
+
+	// Prefer the local copy of the file.
+	if localCopyMatches(entry) {
+		up.Source = entry.LocalPath()
+		if err := r.Upload(up); err != nil {
+			return err
+		}
+		return r.managedSetReencodeMode(up.HyperspacePath, entry.Mode())
+	}
+
+	// Download the file and stream it into the new version.
+	snap, err := r.managedSnapshot(entry)
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	ddw := newDownloadDestinationWriter(pw)
+	dst := ddw
+	var verifier *checksumDestination
+	if _, ok := snap.Checksum(); ok {
+		verifier = newChecksumDestination(ddw, snap.ChunkSize())
+		dst = verifier
+	}
+	d, err := r.managedNewDownload(downloadParams{
+		destination:     dst,
+		destinationType: "reencode",
+		file:            snap,
+
+		latencyTarget: 25e3 * time.Millisecond, // TODO: high default until full latency support is added.
+		length:        snap.Size(),
+		needsMemory:   true,
+		offset:        0,
+		overdrive:     3, // TODO: moderate default until full overdrive support is added.
+		priority:      5, // TODO: moderate default until full priority support is added.
+	})
+	if err != nil {
+		return err
+	}
+	d.OnComplete(func(err error) error {
+		if err == nil && verifier != nil {
+			err = verifier.verify(snap)
+		}
+		ddw.(io.Closer).Close()
+		pw.CloseWithError(err)
+		return nil
+	})
+	err = r.UploadStreamFromReader(up, pr)
+	pr.CloseWithError(errors.New("upload stream closed"))
+	if err != nil {
+		return err
+	}
+	return r.managedSetReencodeMode(up.HyperspacePath, entry.Mode())
+}
+
+// managedSetReencodeMode sets the mode of the new version of a file to the
+// mode of the old version.
+func (r *Renter) managedSetReencodeMode(siaPath string, mode os.FileMode) error {
+	entry, err := r.staticFileSet.Open(siaPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	return entry.SetMode(mode)
+}
+
+// managedDropReencode removes the new version of the file of a job and the
+// job itself.
+func (r *Renter) managedDropReencode(job reencodeJob) {
+	err := r.managedDeleteFile(job.HyperspacePath + reencodeSuffix)
+	if err != nil && err != siafile.ErrUnknownPath {
+		r.log.Println("WARN: Could not remove the new version of", job.HyperspacePath, err)
+	}
+	if err := r.staticReencodes.managedRemove(job.HyperspacePath); err != nil {
+		r.log.Println("WARN: Could not save the re-encode jobs:", err)
+	}
+}
+
+// managedReplaceReencoded replaces the file of a job with its new version if
+// the new version is fully redundant.
+func (r *Renter) managedReplaceReencoded(entry *siafile.SiaFileSetEntry, job reencodeJob) error {
+	newSiaPath := job.HyperspacePath + reencodeSuffix
+	newEntry, err := r.staticFileSet.Open(newSiaPath)
+	if err != nil {
+		return err
+	}
+	pks := make(map[string]types.SiaPublicKey)
+	for _, pk := range newEntry.HostPublicKeys() {
+		pks[string(pk.Key)] = pk
+	}
+	offline, goodForRenew, _ := r.managedContractStatus(pks)
+	health := newEntry.Health(offline, goodForRenew)
+	healthy := health <= 0 && !r.uploadHeap.managedIsStreaming(newEntry.UID())
+	indexEntry := newFileIndexEntry(newEntry, health)
+	newEntry.Close()
+	if !healthy {
+		return nil
+	}
+
+	dedupIDs := entry.DedupIDs()
+	if err := r.staticFileSet.Replace(job.HyperspacePath, newSiaPath); err != nil {
+		return err
+	}
+	r.staticFileIndex.managedRemove(newSiaPath)
+	r.staticFileIndex.managedUpdate(job.HyperspacePath, indexEntry)
+	if err := r.staticDedupIndex.managedRelease(dedupIDs); err != nil {
+		r.log.Println("WARN: could not save the dedup index:", err)
+	}
+	if err := r.staticReencodes.managedRemove(job.HyperspacePath); err != nil {
+		r.log.Println("WARN: Could not save the re-encode jobs:", err)
+	}
+	r.log.Printf("Re-encoded %v with %v data pieces and %v parity pieces", job.HyperspacePath, job.DataPieces, job.ParityPieces)
+	return nil
+}
+
+// managedReencode advances a re-encode job.
+func (r *Renter) managedReencode(job reencodeJob) {
+	// Drop the job if the file was deleted or replaced in the meantime.
+	entry, err := r.staticFileSet.Open(job.HyperspacePath)
+	if err != nil {
+		r.managedDropReencode(job)
+		return
+	}
+	defer entry.Close()
+	if !entry.CreateTime().Equal(job.CreateTime) {
+		r.managedDropReencode(job)
+		return
+	}
+
+	if !job.Filled {
+		// Remove what was filled before the renter stopped.
+		err := r.managedDeleteFile(job.HyperspacePath + reencodeSuffix)
+		if err != nil && err != siafile.ErrUnknownPath {
+			r.log.Println("WARN: Could not remove the new version of", job.HyperspacePath, err)
+			return
+		}
+		if err := r.managedFillReencode(entry, job); err != nil {
+			r.log.Println("WARN: Could not re-encode", job.HyperspacePath, err)
+			r.managedDropReencode(job)
+			return
+		}
+		if err := r.staticReencodes.managedSetFilled(job.HyperspacePath); err != nil {
+			r.log.Println("WARN: Could not save the re-encode jobs:", err)
+		}
+		return
+	}
+	if err := r.managedReplaceReencoded(entry, job); err != nil {
+		r.log.Println("WARN: Could not replace", job.HyperspacePath, "with its new version:", err)
+	}
+}
+
+// threadedReencodeLoop advances the re-encode jobs of the renter.
+func (r *Renter) threadedReencodeLoop() {
+	err := r.tg.Add()
+	if err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	for {
+		for _, job := range r.staticReencodes.managedJobs() {
+			select {
+			case <-r.tg.StopChan():
+				return
+			default:
+			}
+			r.managedReencode(job)
+		}
+
+		select {
+		case <-time.After(reencodeInterval):
+		case <-r.reencodeChan:
+		case <-r.tg.StopChan():
+			return
+		}
+	}
+}
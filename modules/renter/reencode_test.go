@@ -0,0 +1,312 @@
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// reencodeContractor is a backupContractor whose hosts are online and whose
+// contracts are good for renew, so that the pieces stored on them count
+// towards the health of files.
+type reencodeContractor struct {
+	*backupContractor
+}
+
+// ContractByPublicKey returns the contract with the host, which is good for
+// renew.
+func (rc *reencodeContractor) ContractByPublicKey(pk types.SiaPublicKey) (modules.RenterContract, bool) {
+	contract, ok := rc.backupContractor.ContractByPublicKey(pk)
+	contract.Utility.GoodForRenew = true
+	return contract, ok
+}
+
+// IsOffline returns false since the hosts are always online.
+func (rc *reencodeContractor) IsOffline(types.SiaPublicKey) bool { return false }
+
+// newReencodeTester creates a renter tester with two hosts that store sectors
+// in memory, and returns the tester and the hosts.
+func newReencodeTester(name string) (*renterTester, *backupContractor, []modules.HostDBEntry, error) {
+	rt, bc, err := newBackupTester(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r := rt.renter
+	id := r.mu.Lock()
+	r.hostContractor = &reencodeContractor{bc}
+	hosts := r.hostDB.(*backupHostDB).hosts
+	r.mu.Unlock(id)
+	r.managedUpdateWorkerPool()
+	return rt, bc, hosts, nil
+}
+
+// storeTestChunk stores the first chunk of the file of entry with the provided
+// data on the hosts, one piece per host.
+func storeTestChunk(entry *siafile.SiaFileSetEntry, bc *backupContractor, hosts []modules.HostDBEntry, data []byte) error {
+	chunk := make([]byte, entry.ChunkSize())
+	copy(chunk, data)
+	pieces, err := entry.ErasureCode().Encode(chunk)
+	if err != nil {
+		return err
+	}
+	for i, piece := range pieces {
+		sector := entry.PieceKey(0, uint64(i)).EncryptBytes(piece)
+		root := crypto.MerkleRoot(sector)
+		bc.mu.Lock()
+		bc.sectors[root] = sector
+		bc.mu.Unlock()
+		if err := entry.AddPiece(hosts[i].PublicKey, 0, uint64(i), root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestLocalCopyMatches tests that the local copy of a file is only used if it
+// has the size and checksum of the file.
+func TestLocalCopyMatches(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	data := fastrand.Bytes(1000)
+	localPath := filepath.Join(rt.dir, "local")
+	if err := ioutil.WriteFile(localPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.newSizedTestFile("a", uint64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := r.staticFileSet.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	if localCopyMatches(entry) {
+		t.Fatal("file without a local copy has a matching local copy")
+	}
+	if err := entry.SetLocalPath(localPath); err != nil {
+		t.Fatal(err)
+	}
+	if !localCopyMatches(entry) {
+		t.Fatal("local copy of the file without a checksum doesn't match")
+	}
+
+	// Once the checksum is known, the data of the local copy needs to match
+	// as well.
+	cw := newChecksumWriter(entry.ChunkSize())
+	cw.Write(data)
+	checksum, _ := cw.Checksums()
+	if err := entry.SetChecksum(checksum); err != nil {
+		t.Fatal(err)
+	}
+	if !localCopyMatches(entry) {
+		t.Fatal("unchanged local copy doesn't match")
+	}
+	data[0]++
+	if err := ioutil.WriteFile(localPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if localCopyMatches(entry) {
+		t.Fatal("modified local copy matches")
+	}
+	if err := ioutil.WriteFile(localPath, data[:999], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if localCopyMatches(entry) {
+		t.Fatal("truncated local copy matches")
+	}
+}
+
+// TestFillReencodeLocal tests that the new version of a file is uploaded from
+// the local copy of the file with the new erasure code.
+func TestFillReencodeLocal(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	localPath := filepath.Join(rt.dir, "local")
+	if err := ioutil.WriteFile(localPath, fastrand.Bytes(5000), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.newSizedTestFile("a", 5000); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := r.staticFileSet.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	if err := entry.SetLocalPath(localPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := entry.SetMode(0640); err != nil {
+		t.Fatal(err)
+	}
+
+	job := reencodeJob{HyperspacePath: "a", CreateTime: entry.CreateTime(), DataPieces: 2, ParityPieces: 4}
+	if err := r.managedFillReencode(entry, job); err != nil {
+		t.Fatal(err)
+	}
+	newEntry, err := r.staticFileSet.Open("a" + reencodeSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newEntry.Close()
+	if newEntry.ErasureCode().MinPieces() != 2 || newEntry.ErasureCode().NumPieces() != 6 {
+		t.Error("new version doesn't use the new erasure code")
+	}
+	if newEntry.LocalPath() != localPath || newEntry.Size() != 5000 || newEntry.Mode() != 0640 {
+		t.Error("new version wasn't created from the local copy", newEntry.LocalPath(), newEntry.Size(), newEntry.Mode())
+	}
+}
+
+// TestFillReencodeNetwork tests that the new version of a file is filled with
+// the data downloaded from the hosts if the file has no local copy.
+func TestFillReencodeNetwork(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, bc, hosts, err := newReencodeTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	data := fastrand.Bytes(3000)
+	if err := r.newSizedTestFile("a", uint64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := r.staticFileSet.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	if err := storeTestChunk(entry, bc, hosts, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the new version in the background and upload its chunk in place of
+	// the upload loop.
+	done := make(chan error, 1)
+	go func() {
+		done <- r.managedFillReencode(entry, reencodeJob{HyperspacePath: "a", CreateTime: entry.CreateTime(), DataPieces: 1, ParityPieces: 2})
+	}()
+	var uuc *unfinishedUploadChunk
+	for start := time.Now(); uuc == nil && time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		uuc = r.uploadHeap.managedPop()
+	}
+	if uuc == nil {
+		t.Fatal("the chunk of the new version wasn't pushed")
+	}
+	filled, err := ioutil.ReadAll(uuc.sourceReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(filled, data) {
+		t.Fatal("new version wasn't filled with the downloaded data")
+	}
+	uploadChunk(uuc, uuc.minimumPieces)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("fill didn't finish")
+	}
+
+	newEntry, err := r.staticFileSet.Open("a" + reencodeSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newEntry.Close()
+	if newEntry.ErasureCode().NumPieces() != 3 || newEntry.Size() != uint64(len(data)) || newEntry.LocalPath() != "" {
+		t.Error("unexpected new version", newEntry.ErasureCode().NumPieces(), newEntry.Size(), newEntry.LocalPath())
+	}
+}
+
+// TestReplaceReencoded tests that a file is only replaced by its new version
+// once the new version is fully redundant, and that the swap removes the new
+// version and the job.
+func TestReplaceReencoded(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, bc, hosts, err := newReencodeTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	for _, siaPath := range []string{"a", "a" + reencodeSuffix} {
+		if err := r.newSizedTestFile(siaPath, 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry, err := r.staticFileSet.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	job := reencodeJob{HyperspacePath: "a", CreateTime: entry.CreateTime(), DataPieces: 1, ParityPieces: 1, Filled: true}
+	if err := r.staticReencodes.managedAdd(job); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new version isn't uploaded yet, so the file is kept.
+	if err := r.managedReplaceReencoded(entry, job); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := r.staticFileSet.Exists("a" + reencodeSuffix); !exists || !r.staticReencodes.managedInProgress("a") {
+		t.Fatal("file was replaced by an unhealthy new version")
+	}
+
+	// Once it is fully uploaded, it replaces the file.
+	newEntry, err := r.staticFileSet.Open("a" + reencodeSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newUID := newEntry.UID()
+	err = storeTestChunk(newEntry, bc, hosts, fastrand.Bytes(1000))
+	newEntry.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.managedReplaceReencoded(entry, job); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := r.staticFileSet.Exists("a" + reencodeSuffix); exists || r.staticReencodes.managedInProgress("a") {
+		t.Fatal("new version or job wasn't removed")
+	}
+	replaced, err := r.staticFileSet.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replaced.Close()
+	if replaced.UID() != newUID {
+		t.Fatal("file wasn't replaced by its new version")
+	}
+}
@@ -29,9 +29,11 @@ import (
 	"sync"
 
 	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/crypto"
 	"github.com/HyperspaceApp/Hyperspace/modules"
 	"github.com/HyperspaceApp/Hyperspace/modules/renter/contractor"
 	"github.com/HyperspaceApp/Hyperspace/modules/renter/hostdb"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/proto"
 	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
 	"github.com/HyperspaceApp/Hyperspace/persist"
 	siasync "github.com/HyperspaceApp/Hyperspace/sync"
@@ -131,6 +133,9 @@ type hostContractor interface {
 	// ContractByPublicKey returns the contract associated with the host key.
 	ContractByPublicKey(types.SiaPublicKey) (modules.RenterContract, bool)
 
+	// ContractBackups returns a backup of every contract in the contract set.
+	ContractBackups() ([]proto.ContractBackup, error)
+
 	// ContractUtility returns the utility field for a given contract, along
 	// with a bool indicating if it exists.
 	ContractUtility(types.SiaPublicKey) (modules.ContractUtility, bool)
@@ -154,6 +159,13 @@ type hostContractor interface {
 	// allowing the retrieval of sectors.
 	Downloader(types.SiaPublicKey, <-chan struct{}) (contractor.Downloader, error)
 
+	// FetchBackupIndex retrieves the backup index stored under a public key
+	// from a host.
+	FetchBackupIndex(modules.HostDBEntry, crypto.PublicKey, <-chan struct{}) (modules.LoopBackupIndexResponse, error)
+
+	// RecoverContract restores a backed-up contract into the contract set.
+	RecoverContract(proto.ContractBackup, <-chan struct{}) (modules.RenterContract, error)
+
 	// ResolveIDToPubKey returns the public key of a host given a contract id.
 	ResolveIDToPubKey(types.FileContractID) types.SiaPublicKey
 
@@ -164,6 +176,27 @@ type hostContractor interface {
 	// SetRateLimits sets the bandwidth limits for connections created by the
 	// contractor and its submodules.
 	SetRateLimits(int64, int64, uint64)
+
+	// SetBackupIndex stores a signed backup index on the host with the
+	// specified public key.
+	SetBackupIndex(types.SiaPublicKey, modules.LoopSetBackupIndexRequest, <-chan struct{}) error
+
+	// HostPolicies returns the host policies of the contractor.
+	HostPolicies() []modules.HostPolicy
+
+	// SetHostPolicy adds a host policy or replaces the policy with the same
+	// name.
+	SetHostPolicy(modules.HostPolicy) error
+
+	// DeleteHostPolicy removes a host policy.
+	DeleteHostPolicy(name string) error
+
+	// PolicyContracts returns the contract set of a host policy.
+	PolicyContracts(name string) ([]modules.RenterContract, error)
+
+	// EventSubscribe adds a subscriber that will be notified when contracts
+	// are formed, renewed or expire.
+	EventSubscribe(modules.RenterEventSubscriber)
 }
 
 // A Renter is responsible for tracking all of the files that a user has
@@ -180,6 +213,28 @@ type Renter struct {
 	//
 	staticFileSet *siafile.SiaFileSet
 
+	// The dedup index tracks the chunks shared by deduplicated files.
+	staticDedupIndex *dedupIndex
+
+	// The auditor tracks the retrievability audits of the renter's pieces.
+	staticAuditor *auditor
+
+	// The re-encode jobs of files whose redundancy is changed.
+	staticReencodes *reencodeSet
+	reencodeChan    chan struct{}
+
+	// The sync jobs that upload local directories.
+	staticSyncs *syncManager
+
+	// The subscribers to the renter's events.
+	staticEvents *eventBroadcaster
+
+	// The file index that file queries are answered from.
+	staticFileIndex *fileIndex
+
+	// The migrations of pieces away from hosts that are being dropped.
+	staticMigrations *migrationPlanner
+
 	// Download management. The heap has a separate mutex because it is always
 	// accessed in isolation.
 	downloadHeapMu sync.Mutex         // Used to protect the downloadHeap.
@@ -197,6 +252,26 @@ type Renter struct {
 	// Upload management.
 	uploadHeap uploadHeap
 
+	// FUSE filesystems that expose the renter's files.
+	fuseManager fuseManager
+
+	// siaDirMu serializes reads and writes of the .siadir metadata files.
+	siaDirMu sync.Mutex
+
+	// contractUtilities holds the utilities of the renter's contracts when the
+	// workers were last refreshed. If they change, dirHealthRecheck signals
+	// threadedUpdateDirHealth to check the health of all directories.
+	contractUtilities map[string]modules.ContractUtility
+	dirHealthRecheck  chan struct{}
+
+	// backupMu serializes the creation and restoration of metadata backups.
+	backupMu sync.Mutex
+
+	// Small files are packed into the chunk of the open pack until it is
+	// full. packMu protects the open pack.
+	openPack *openPack
+	packMu   sync.Mutex
+
 	// List of workers that can be used for uploading and/or downloading.
 	memoryManager *memoryManager
 	workerPool    map[types.FileContractID]*worker
@@ -219,6 +294,7 @@ type Renter struct {
 	tg                threadgroup.ThreadGroup
 	tpool             modules.TransactionPool
 	wal               *writeaheadlog.WAL
+	wallet            modules.Wallet
 }
 
 // Close closes the Renter and its dependencies
@@ -430,7 +506,7 @@ func (r *Renter) setBandwidthLimits(downloadSpeed int64, uploadSpeed int64) erro
 // are bad, then the allowance will update but the bandwidth will not update.
 func (r *Renter) SetSettings(s modules.RenterSettings) error {
 	// Early input validation.
-	if s.MaxDownloadSpeed < 0 || s.MaxUploadSpeed < 0 {
+	if s.MaxDownloadSpeed < 0 || s.MaxUploadSpeed < 0 || s.MaxMigrationSpeed < 0 {
 		return errors.New("bandwidth limits cannot be negative")
 	}
 	if s.StreamCacheSize <= 0 {
@@ -451,6 +527,10 @@ func (r *Renter) SetSettings(s modules.RenterSettings) error {
 	r.persist.MaxDownloadSpeed = s.MaxDownloadSpeed
 	r.persist.MaxUploadSpeed = s.MaxUploadSpeed
 
+	// Set the migration speed limit.
+	r.staticMigrations.managedSetMaxSpeed(s.MaxMigrationSpeed)
+	r.persist.MaxMigrationSpeed = s.MaxMigrationSpeed
+
 	// Set StreamingCacheSize
 	err = r.staticStreamCache.SetStreamingCacheSize(s.StreamCacheSize)
 	if err != nil {
@@ -578,6 +658,7 @@ func (r *Renter) Settings() modules.RenterSettings {
 		Allowance:         r.hostContractor.Allowance(),
 		IPViolationsCheck: r.hostDB.IPViolationsCheck(),
 		MaxDownloadSpeed:  download,
+		MaxMigrationSpeed: r.staticMigrations.managedMaxSpeed(),
 		MaxUploadSpeed:    upload,
 		StreamCacheSize:   r.staticStreamCache.cacheSize,
 	}
@@ -636,6 +717,12 @@ func validateSiapath(hyperspacepath string) error {
 		}
 		prevElem = pathElem
 	}
+	if isPackPath(hyperspacepath) {
+		return errPackPath
+	}
+	if isVersionPath(hyperspacepath) {
+		return errVersionPath
+	}
 	return nil
 }
 
@@ -643,7 +730,7 @@ func validateSiapath(hyperspacepath string) error {
 var _ modules.Renter = (*Renter)(nil)
 
 // NewCustomRenter initializes a renter and returns it.
-func NewCustomRenter(g modules.Gateway, cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostDB, hc hostContractor, persistDir string, deps modules.Dependencies) (*Renter, error) {
+func NewCustomRenter(g modules.Gateway, cs modules.ConsensusSet, tpool modules.TransactionPool, w modules.Wallet, hdb hostDB, hc hostContractor, persistDir string, deps modules.Dependencies) (*Renter, error) {
 	if g == nil {
 		return nil, errNilGateway
 	}
@@ -669,11 +756,21 @@ func NewCustomRenter(g modules.Gateway, cs modules.ConsensusSet, tpool modules.T
 		newDownloads: make(chan struct{}, 1),
 		downloadHeap: new(downloadChunkHeap),
 
+		dirHealthRecheck: make(chan struct{}, 1),
+
 		uploadHeap: uploadHeap{
-			activeChunks: make(map[uploadChunkID]struct{}),
-			newUploads:   make(chan struct{}, 1),
+			activeChunks:   make(map[uploadChunkID]struct{}),
+			newUploads:     make(chan struct{}, 1),
+			streamingFiles: make(map[string]struct{}),
+		},
+		fuseManager: fuseManager{
+			mounts: make(map[string]fuseMount),
 		},
 
+		reencodeChan: make(chan struct{}, 1),
+
+		staticEvents: newEventBroadcaster(),
+
 		workerPool: make(map[types.FileContractID]*worker),
 
 		cs:             cs,
@@ -685,6 +782,7 @@ func NewCustomRenter(g modules.Gateway, cs modules.ConsensusSet, tpool modules.T
 		filesDir:       filepath.Join(persistDir, modules.SiapathRoot),
 		mu:             siasync.New(modules.SafeMutexDelay, 1),
 		tpool:          tpool,
+		wallet:         w,
 	}
 	r.memoryManager = newMemoryManager(defaultMemory, r.tg.StopChan())
 
@@ -705,6 +803,7 @@ func NewCustomRenter(g modules.Gateway, cs modules.ConsensusSet, tpool modules.T
 
 	// Initialize the streaming cache.
 	r.staticStreamCache = newStreamCache(r.persist.StreamCacheSize)
+	r.staticMigrations = newMigrationPlanner(r.persist.MaxMigrationSpeed)
 
 	if cs.SpvMode() {
 		// Subscribe to the consensus set.
@@ -720,10 +819,35 @@ func NewCustomRenter(g modules.Gateway, cs modules.ConsensusSet, tpool modules.T
 		}
 	}
 
+	// Forward the contract events of the contractor.
+	hc.EventSubscribe(r.staticEvents)
+
+	// Remove the uploads of the S3 gateway and the WebDAV server that were
+	// interrupted by a shutdown.
+	r.managedRemoveUploadFiles()
+
 	// Spin up the workers for the work pool.
 	r.managedUpdateWorkerPool()
 	go r.threadedDownloadLoop()
-	go r.threadedUploadLoop()
+	if !r.deps.Disrupt("DisableRepairLoops") {
+		go r.threadedUploadLoop()
+		go r.threadedUpdateDirHealth()
+		go r.threadedStuckLoop()
+	}
+	if !r.deps.Disrupt("DisableBackupLoop") {
+		go r.threadedBackupLoop()
+	}
+	if !r.deps.Disrupt("DisablePackLoop") {
+		go r.threadedPackLoop()
+	}
+	go r.threadedAuditLoop()
+	go r.threadedReencodeLoop()
+	go r.threadedVersionLoop()
+	go r.threadedMigrationLoop()
+	go r.threadedSaveFileIndex()
+	for _, job := range r.staticSyncs.managedJobs() {
+		go r.threadedSyncJob(job)
+	}
 
 	// Kill workers on shutdown.
 	r.tg.OnStop(func() error {
@@ -734,6 +858,14 @@ func NewCustomRenter(g modules.Gateway, cs modules.ConsensusSet, tpool modules.T
 		r.mu.RUnlock(id)
 		return nil
 	})
+	// Save the changes to the file index on shutdown.
+	r.tg.OnStop(func() error {
+		return r.staticFileIndex.managedSave()
+	})
+	// Unmount the FUSE filesystems on shutdown.
+	r.tg.OnStop(func() error {
+		return r.fuseManager.managedUnmountAll()
+	})
 
 	return r, nil
 }
@@ -748,5 +880,5 @@ func New(g modules.Gateway, cs modules.ConsensusSet, wallet modules.Wallet, tpoo
 	if err != nil {
 		return nil, err
 	}
-	return NewCustomRenter(g, cs, tpool, hdb, hc, persistDir, modules.ProdDependencies)
+	return NewCustomRenter(g, cs, tpool, wallet, hdb, hc, persistDir, modules.ProdDependencies)
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/HyperspaceApp/Hyperspace/modules/gateway"
 	"github.com/HyperspaceApp/Hyperspace/modules/miner"
 	"github.com/HyperspaceApp/Hyperspace/modules/renter/contractor"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/hostdb"
 	"github.com/HyperspaceApp/Hyperspace/modules/transactionpool"
 	"github.com/HyperspaceApp/Hyperspace/modules/wallet"
 	"github.com/HyperspaceApp/Hyperspace/types"
@@ -42,6 +43,12 @@ func (rt *renterTester) Close() error {
 // newRenterTester creates a ready-to-use renter tester with money in the
 // wallet.
 func newRenterTester(name string) (*renterTester, error) {
+	return newRenterTesterWithDependency(name, modules.ProdDependencies)
+}
+
+// newRenterTesterWithDependency creates a ready-to-use renter tester with
+// money in the wallet, whose renter uses the provided dependencies.
+func newRenterTesterWithDependency(name string, deps modules.Dependencies) (*renterTester, error) {
 	// Create the modules.
 	testdir := build.TempDir("renter", name)
 	g, err := gateway.New("localhost:0", false, filepath.Join(testdir, modules.GatewayDir), false)
@@ -69,7 +76,16 @@ func newRenterTester(name string) (*renterTester, error) {
 	if err != nil {
 		return nil, err
 	}
-	r, err := New(g, cs, w, tp, filepath.Join(testdir, modules.RenterDir))
+	renterDir := filepath.Join(testdir, modules.RenterDir)
+	hdb, err := hostdb.New(g, cs, tp, renterDir)
+	if err != nil {
+		return nil, err
+	}
+	hc, err := contractor.New(cs, w, tp, hdb, renterDir)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewCustomRenter(g, cs, tp, w, hdb, hc, renterDir, deps)
 	if err != nil {
 		return nil, err
 	}
@@ -292,6 +308,10 @@ func TestRenterSiapathValidate(t *testing.T) {
 		{"foo/./bar", false},
 		{"", false},
 		{"blank/end/", false},
+		{".packs", false},
+		{".packs/pack", false},
+		{".packsfoo/bar", true},
+		{"foo/.packs", true},
 	}
 	for _, pathtest := range pathtests {
 		err := validateSiapath(pathtest.in)
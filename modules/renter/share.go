@@ -0,0 +1,355 @@
+package renter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/encoding"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// signedShareVersion is the version of .sia files that contain signed
+// siafiles. Such a file starts with the shareHeader and the version, followed
+// by the public key of the signer, the signature and the gzipped files. The
+// version changes whenever the encoding of the shared files does, and files
+// of other versions are rejected as incompatible.
+const signedShareVersion = "1.2"
+
+var (
+	// ErrBadShareSignature is returned when the signature of a .sia file
+	// doesn't match its contents.
+	ErrBadShareSignature = errors.New("signature of the shared files is invalid")
+)
+
+// managedShareEntry returns the SharedFile of the file of entry, stored at
+// siaPath. Packed files are shared with the chunks of their pack.
+func (r *Renter) managedShareEntry(entry *siafile.SiaFileSetEntry, siaPath string) (siafile.SharedFile, error) {
+	packPath := entry.PackPath()
+	if packPath == "" {
+		return entry.Share(siaPath), nil
+	}
+	pack, err := r.staticFileSet.Open(packPath)
+	if err != nil {
+		return siafile.SharedFile{}, errors.AddContext(err, "unable to open the pack of "+entry.HyperspacePath())
+	}
+	defer pack.Close()
+	return entry.SharePacked(siaPath, pack.SiaFile), nil
+}
+
+// loadSharedPackedFile creates a packed file from a shared packed file. The
+// pack is loaded into packDir, unless a pack with the same key was already
+// loaded into packs before. The caller must hold the lock.
+func (r *Renter) loadSharedPackedFile(f siafile.SharedFile, packs map[string]*siafile.SiaFileSetEntry) (*siafile.SiaFileSetEntry, error) {
+	pack, loaded := packs[string(f.SharingKey)]
+	if !loaded {
+		if err := r.createDirUnchecked(packDir); err != nil {
+			return nil, err
+		}
+		var err error
+		pack, err = r.staticFileSet.NewFromSharedFile(f.Pack(packDir + "/" + hex.EncodeToString(fastrand.Bytes(16))))
+		if err != nil {
+			return nil, errors.AddContext(err, "unable to load the pack of "+f.HyperspacePath)
+		}
+		packs[string(f.SharingKey)] = pack
+	}
+	up := modules.FileUploadParams{
+		HyperspacePath: f.HyperspacePath,
+		ErasureCode:    pack.ErasureCode(),
+	}
+	return r.staticFileSet.NewPackedSiaFile(up, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), f.FileSize, f.Mode, pack.HyperspacePath(), f.PackOffset)
+}
+
+// managedSharedFiles returns the shared files of the files and directories at
+// siaPaths. A shared file is stored at its name, and the files below a shared
+// directory at their path relative to the parent of the directory.
+func (r *Renter) managedSharedFiles(siaPaths []string) ([]siafile.SharedFile, error) {
+	if len(siaPaths) == 0 {
+		return nil, ErrNoNicknames
+	}
+	var shared []siafile.SharedFile
+	for _, siaPath := range siaPaths {
+		siaPath = strings.Trim(siaPath, "/")
+		if exists, _ := r.staticFileSet.Exists(siaPath); exists && siaPath != "" {
+			entry, err := r.staticFileSet.Open(siaPath)
+			if err != nil {
+				return nil, err
+			}
+			f, err := r.managedShareEntry(entry, filepath.Base(siaPath))
+			if err = errors.Compose(err, entry.Close()); err != nil {
+				return nil, err
+			}
+			shared = append(shared, f)
+			continue
+		}
+
+		// Share every file below the directory.
+		dir := filepath.Join(r.filesDir, siaPath)
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return nil, siafile.ErrUnknownPath
+		}
+		parent := dirSiaPath(siaPath)
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() && (path == filepath.Join(r.filesDir, packDir) || path == filepath.Join(r.filesDir, versionDir)) {
+				return filepath.SkipDir
+			}
+			if err != nil || info.IsDir() || filepath.Ext(path) != siafile.ShareExtension {
+				return err
+			}
+			rel, err := filepath.Rel(r.filesDir, path)
+			if err != nil {
+				return err
+			}
+			file := strings.TrimSuffix(filepath.ToSlash(rel), siafile.ShareExtension)
+			entry, err := r.staticFileSet.Open(file)
+			if err != nil {
+				return err
+			}
+			f, err := r.managedShareEntry(entry, strings.TrimPrefix(strings.TrimPrefix(file, parent), "/"))
+			if err = errors.Compose(err, entry.Close()); err != nil {
+				return err
+			}
+			shared = append(shared, f)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(shared) == 0 {
+		return nil, errors.New("no files to share")
+	}
+	return shared, nil
+}
+
+// writeSharedFiles writes the signed files to w.
+func writeSharedFiles(w io.Writer, files []siafile.SharedFile, sk crypto.SecretKey) error {
+	// Compress the files.
+	payload := new(bytes.Buffer)
+	zip, _ := gzip.NewWriterLevel(payload, gzip.BestCompression)
+	enc := encoding.NewEncoder(zip)
+	if err := enc.Encode(uint64(len(files))); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := enc.Encode(f); err != nil {
+			return err
+		}
+	}
+	if err := zip.Close(); err != nil {
+		return err
+	}
+
+	// Write the header and the signature, followed by the files.
+	sig := crypto.SignHash(crypto.HashBytes(payload.Bytes()), sk)
+	err := encoding.NewEncoder(w).EncodeAll(shareHeader, signedShareVersion, sk.PublicKey(), sig)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(payload.Bytes())
+	return err
+}
+
+// ShareFiles saves the files and directories at siaPaths to shareDest, which
+// must have the .sia extension. The .sia file contains the master keys of the
+// files, so everyone who gets hold of it can download and decrypt them.
+func (r *Renter) ShareFiles(siaPaths []string, shareDest string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if filepath.Ext(shareDest) != siafile.ShareExtension {
+		return ErrNonShareSuffix
+	}
+	files, err := r.managedSharedFiles(siaPaths)
+	if err != nil {
+		return err
+	}
+	id := r.mu.RLock()
+	sk := r.persist.SharingKey
+	r.mu.RUnlock(id)
+
+	handle, err := os.Create(shareDest)
+	if err != nil {
+		return err
+	}
+	err = writeSharedFiles(handle, files, sk)
+	err = errors.Compose(err, handle.Close())
+	if err != nil {
+		os.Remove(shareDest)
+	}
+	return err
+}
+
+// ShareFilesASCII returns the files and directories at siaPaths as an
+// ASCII-encoded .sia file.
+func (r *Renter) ShareFilesASCII(siaPaths []string) (string, error) {
+	if err := r.tg.Add(); err != nil {
+		return "", err
+	}
+	defer r.tg.Done()
+	files, err := r.managedSharedFiles(siaPaths)
+	if err != nil {
+		return "", err
+	}
+	id := r.mu.RLock()
+	sk := r.persist.SharingKey
+	r.mu.RUnlock(id)
+
+	buf := new(bytes.Buffer)
+	enc := base64.NewEncoder(base64.URLEncoding, buf)
+	if err := writeSharedFiles(enc, files, sk); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// SharingKey returns the public key that the files shared by the renter are
+// signed with.
+func (r *Renter) SharingKey() types.SiaPublicKey {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	return types.Ed25519PublicKey(r.persist.SharingKey.PublicKey())
+}
+
+// managedLoadSharedFiles reads .sia data from reader and registers the
+// contained files in the renter. It returns the nicknames of the loaded files
+// and the key the files were signed with.
+func (r *Renter) managedLoadSharedFiles(reader io.Reader, repairPath string) ([]string, types.SiaPublicKey, error) {
+	var header [15]byte
+	var version string
+	err := encoding.NewDecoder(reader).DecodeAll(&header, &version)
+	if err != nil {
+		return nil, types.SiaPublicKey{}, err
+	} else if header != shareHeader {
+		return nil, types.SiaPublicKey{}, ErrBadFile
+	}
+	switch version {
+	case shareVersion:
+		lockID := r.mu.Lock()
+		defer r.mu.Unlock(lockID)
+		names, err := r.loadSharedFiles(reader, repairPath)
+		return names, types.SiaPublicKey{}, err
+	case signedShareVersion:
+		return r.managedLoadSignedSharedFiles(reader)
+	default:
+		return nil, types.SiaPublicKey{}, ErrIncompatible
+	}
+}
+
+// managedLoadSignedSharedFiles reads signed .sia data, following the header
+// and version, from reader and registers the contained files in the renter.
+// The signature only proves that the files weren't modified since they were
+// signed with the returned key. The key itself isn't checked against anything,
+// since the renter doesn't know whom to trust, so callers have to compare it to
+// the sharing key of the renter they expect the files from.
+func (r *Renter) managedLoadSignedSharedFiles(reader io.Reader) ([]string, types.SiaPublicKey, error) {
+	// Check the signature.
+	var signer crypto.PublicKey
+	var sig crypto.Signature
+	if err := encoding.NewDecoder(reader).DecodeAll(&signer, &sig); err != nil {
+		return nil, types.SiaPublicKey{}, err
+	}
+	payload, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, types.SiaPublicKey{}, err
+	}
+	if err := crypto.VerifyHash(crypto.HashBytes(payload), signer, sig); err != nil {
+		return nil, types.SiaPublicKey{}, ErrBadShareSignature
+	}
+
+	// Read the files.
+	unzip, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, types.SiaPublicKey{}, err
+	}
+	dec := encoding.NewDecoder(unzip)
+	var numFiles uint64
+	if err := dec.Decode(&numFiles); err != nil {
+		return nil, types.SiaPublicKey{}, err
+	}
+	var files []siafile.SharedFile
+	for i := uint64(0); i < numFiles; i++ {
+		var f siafile.SharedFile
+		if err := dec.Decode(&f); err != nil {
+			return nil, types.SiaPublicKey{}, err
+		}
+		if err := validateSiapath(f.HyperspacePath); err != nil {
+			return nil, types.SiaPublicKey{}, err
+		}
+		if f.PackSize != 0 && (f.FileSize > f.PackSize || f.PackOffset > f.PackSize-f.FileSize) {
+			return nil, types.SiaPublicKey{}, errors.New("packed file " + f.HyperspacePath + " exceeds its pack")
+		}
+		files = append(files, f)
+	}
+
+	// Add the files to the renter. Files whose path is taken get a numbered
+	// suffix.
+	var names []string
+	var entrys []*siafile.SiaFileSetEntry
+	packs := make(map[string]*siafile.SiaFileSetEntry)
+	err = func() error {
+		lockID := r.mu.Lock()
+		defer r.mu.Unlock(lockID)
+		for _, f := range files {
+			origName := f.HyperspacePath
+			for dupCount := 1; ; dupCount++ {
+				if exists, _ := r.staticFileSet.Exists(f.HyperspacePath); !exists {
+					break
+				}
+				f.HyperspacePath = origName + "_" + strconv.Itoa(dupCount)
+			}
+			if dir := dirSiaPath(f.HyperspacePath); dir != "" {
+				if err := r.createDir(dir); err != nil {
+					return err
+				}
+			}
+			var entry *siafile.SiaFileSetEntry
+			var err error
+			if f.PackSize != 0 {
+				entry, err = r.loadSharedPackedFile(f, packs)
+			} else {
+				entry, err = r.staticFileSet.NewFromSharedFile(f)
+			}
+			if err != nil {
+				return err
+			}
+			names = append(names, f.HyperspacePath)
+			entrys = append(entrys, entry)
+		}
+		return nil
+	}()
+	r.closePacks(packs)
+	for _, entry := range entrys {
+		// The dedup ids of the file are released when it is deleted, so they
+		// need to be referenced by the dedup index.
+		for _, id := range entry.DedupIDs() {
+			if _, err := r.staticDedupIndex.managedAcquire(id); err != nil {
+				r.log.Println("WARN: could not save the dedup index:", err)
+			}
+		}
+		if err := r.managedBubbleFileHealth(entry); err != nil {
+			r.log.Println("WARN: Could not update the health of the directory of", entry.HyperspacePath(), err)
+		}
+		err = errors.Compose(err, entry.Close())
+	}
+	if err != nil {
+		return nil, types.SiaPublicKey{}, err
+	}
+	return names, types.Ed25519PublicKey(signer), nil
+}
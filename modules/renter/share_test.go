@@ -0,0 +1,83 @@
+package renter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// TestSharePackedDir tests that a directory containing a packed file can be
+// shared, and that the packed file is loaded together with its pack.
+func TestSharePackedDir(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	if err := r.CreateDir("dir"); err != nil {
+		t.Fatal(err)
+	}
+	for _, siaPath := range []string{"dir/a", "dir/b"} {
+		if err := r.newPackedTestFile(siaPath, fastrand.Bytes(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.newSizedTestFile("dir/c", 1000); err != nil {
+		t.Fatal(err)
+	}
+	packPath, offset, err := r.packOf("dir/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Share the directory and load it again, which stores the files at
+	// numbered paths.
+	ascii, err := r.ShareFilesASCII([]string{"dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, _, err := r.LoadSharedFilesASCII(ascii)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 {
+		t.Fatal("expected 3 loaded files, got", names)
+	}
+	if fi, err := r.File("dir/c_1"); err != nil || fi.Filesize != 1000 {
+		t.Fatal("regular file wasn't loaded", fi.Filesize, err)
+	}
+
+	// The packed files are loaded into a single copy of their pack.
+	loadedPath, loadedOffset, err := r.packOf("dir/b_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isPackPath(loadedPath) || loadedPath == packPath || loadedOffset != offset {
+		t.Fatal("packed file wasn't loaded into a copy of its pack", loadedPath, loadedOffset)
+	}
+	if otherPath, _, err := r.packOf("dir/a_1"); err != nil || otherPath != loadedPath {
+		t.Fatal("packed files of the same pack were loaded into different packs", otherPath, err)
+	}
+	if fi, err := r.File("dir/b_1"); err != nil || fi.Filesize != 100 {
+		t.Fatal("unexpected size of the loaded packed file", fi.Filesize, err)
+	}
+	pack, err := r.staticFileSet.Open(packPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pack.Close()
+	loaded, err := r.staticFileSet.Open(loadedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+	if loaded.Size() != pack.Size() || !bytes.Equal(loaded.MasterKey().Key(), pack.MasterKey().Key()) {
+		t.Fatal("loaded pack doesn't match the shared pack")
+	}
+}
@@ -69,7 +69,7 @@ OUTER:
 			// 80% chance to add a piece.
 			if fastrand.Intn(100) < 80 {
 				spk := hostkeys[fastrand.Intn(len(hostkeys))]
-				offset := uint64(fastrand.Intn(int(sf.staticMetadata.StaticFileSize)))
+				offset := uint64(fastrand.Intn(int(sf.staticMetadata.FileSize)))
 				chunkIndex, _ := sf.Snapshot().ChunkIndexByOffset(offset)
 				pieceIndex := uint64(fastrand.Intn(sf.staticMetadata.staticErasureCode.NumPieces()))
 				if err := sf.AddPiece(spk, chunkIndex, pieceIndex, crypto.Hash{}); err != nil {
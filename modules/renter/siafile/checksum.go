@@ -0,0 +1,112 @@
+package siafile
+
+import (
+	"fmt"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/errors"
+)
+
+// The checksum of a file is computed from the checksums of its chunks, which
+// allows computing it while the chunks are uploaded in any order. It can
+// still be verified by streaming the file, since the chunk size is known.
+
+// FileChecksum computes the checksum of a file of size fileSize from the
+// checksums of its chunks.
+func FileChecksum(fileSize uint64, chunkChecksums []crypto.Hash) crypto.Hash {
+	return crypto.HashAll(fileSize, chunkChecksums)
+}
+
+// Checksum returns the checksum of the file's content and whether it is
+// known. It is unknown until every chunk of the file has a checksum.
+func (sf *SiaFile) Checksum() (crypto.Hash, bool) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.Checksum, sf.staticMetadata.Checksum != crypto.Hash{}
+}
+
+// ChunkChecksum returns the checksum of the chunk at chunkIndex and whether
+// it is known.
+func (sf *SiaFile) ChunkChecksum(chunkIndex uint64) (crypto.Hash, bool) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	checksum, ok := sf.staticMetadata.ChunkChecksums[chunkIndex]
+	return checksum, ok
+}
+
+// SetChecksum sets the checksum of a packed file. The checksum of other files
+// is computed from the checksums of their chunks.
+func (sf *SiaFile) SetChecksum(checksum crypto.Hash) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if sf.staticMetadata.PackPath == "" {
+		return errors.New("only the checksum of packed files can be set")
+	}
+	sf.staticMetadata.Checksum = checksum
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdate()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// SetChunkChecksum sets the checksum of the chunk at chunkIndex. Once every
+// chunk has a checksum, the checksum of the file is computed as well.
+func (sf *SiaFile) SetChunkChecksum(chunkIndex uint64, checksum crypto.Hash) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	// If the file was deleted we can't change its metadata since it would
+	// write the file to disk again.
+	if sf.deleted {
+		return errors.New("can't set the checksum of a chunk of a deleted file")
+	}
+	if chunkIndex >= uint64(len(sf.staticChunks)) {
+		return fmt.Errorf("chunkIndex %v out of bounds (%v)", chunkIndex, len(sf.staticChunks))
+	}
+	if sf.staticMetadata.ChunkChecksums == nil {
+		sf.staticMetadata.ChunkChecksums = make(map[uint64]crypto.Hash)
+	}
+	sf.staticMetadata.ChunkChecksums[chunkIndex] = checksum
+	sf.updateChecksum()
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdate()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// updateChecksum recomputes the checksum of the file from the checksums of
+// its chunks. The checksum is reset if any chunk doesn't have a checksum. The
+// caller must hold the lock.
+func (sf *SiaFile) updateChecksum() {
+	if sf.staticMetadata.PackPath != "" {
+		return
+	}
+	chunkChecksums := make([]crypto.Hash, len(sf.staticChunks))
+	for i := range chunkChecksums {
+		checksum, ok := sf.staticMetadata.ChunkChecksums[uint64(i)]
+		if !ok {
+			sf.staticMetadata.Checksum = crypto.Hash{}
+			return
+		}
+		chunkChecksums[i] = checksum
+	}
+	sf.staticMetadata.Checksum = FileChecksum(uint64(sf.staticMetadata.FileSize), chunkChecksums)
+}
+
+// Checksum returns the checksum of the file's content and whether it is
+// known.
+func (s *Snapshot) Checksum() (crypto.Hash, bool) {
+	return s.staticChecksum, s.staticChecksum != crypto.Hash{}
+}
+
+// ChunkChecksum returns the checksum of the chunk at chunkIndex and whether
+// it is known.
+func (s *Snapshot) ChunkChecksum(chunkIndex uint64) (crypto.Hash, bool) {
+	checksum, ok := s.staticChunkChecksums[chunkIndex]
+	return checksum, ok
+}
@@ -0,0 +1,70 @@
+package siafile
+
+import (
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// TestChecksum tests that the checksum of a file is computed from the
+// checksums of its chunks and persisted.
+func TestChecksum(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	sf := newBlankTestFile()
+
+	// The checksum is unknown until every chunk has a checksum.
+	chunkChecksums := make([]crypto.Hash, sf.NumChunks())
+	for i := range chunkChecksums {
+		if _, ok := sf.Checksum(); ok {
+			t.Fatal("checksum shouldn't be known before every chunk has a checksum")
+		}
+		fastrand.Read(chunkChecksums[i][:])
+		if err := sf.SetChunkChecksum(uint64(i), chunkChecksums[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checksum, ok := sf.Checksum()
+	if !ok || checksum != FileChecksum(sf.Size(), chunkChecksums) {
+		t.Fatal("unexpected checksum", checksum, ok)
+	}
+	if snapChecksum, _ := sf.Snapshot().Checksum(); snapChecksum != checksum {
+		t.Fatal("snapshot should have the same checksum as the file")
+	}
+	if err := sf.SetChunkChecksum(sf.NumChunks(), crypto.Hash{}); err == nil {
+		t.Fatal("chunk index should be out of bounds")
+	}
+	if err := sf.SetChecksum(crypto.Hash{}); err == nil {
+		t.Fatal("checksum of a regular file shouldn't be set directly")
+	}
+
+	// The checksum should survive reloading the file.
+	loaded, err := LoadSiaFile(sf.siaFilePath, sf.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadedChecksum, ok := loaded.Checksum(); !ok || loadedChecksum != checksum {
+		t.Fatal("checksum wasn't persisted")
+	}
+	if loadedChecksum, ok := loaded.ChunkChecksum(0); !ok || loadedChecksum != chunkChecksums[0] {
+		t.Fatal("chunk checksum wasn't persisted")
+	}
+
+	// Changing the size of the file changes its checksum.
+	if err := sf.SetFileSize(sf.Size() - 1); err != nil {
+		t.Fatal(err)
+	}
+	if newChecksum, ok := sf.Checksum(); !ok || newChecksum != FileChecksum(sf.Size(), chunkChecksums) {
+		t.Fatal("checksum wasn't updated after changing the file size")
+	}
+
+	// Adding a chunk resets the checksum.
+	if err := sf.GrowNumChunks(sf.NumChunks() + 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sf.Checksum(); ok {
+		t.Fatal("checksum should be unknown after adding a chunk")
+	}
+}
@@ -47,7 +47,7 @@ func NewFromFileData(fd FileData) (*SiaFile, error) {
 			ChunkOffset:             defaultReservedMDPages * pageSize,
 			ChangeTime:              currentTime,
 			CreateTime:              currentTime,
-			StaticFileSize:          int64(fd.FileSize),
+			FileSize:                int64(fd.FileSize),
 			LocalPath:               fd.RepairPath,
 			StaticMasterKey:         mk.Key(),
 			StaticMasterKeyType:     mk.Type(),
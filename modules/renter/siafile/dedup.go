@@ -0,0 +1,131 @@
+package siafile
+
+import (
+	"fmt"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/errors"
+)
+
+// The pieces of a deduplicated chunk are encrypted with a key derived from
+// the chunk's dedup id instead of the file's master key. The dedup id is a
+// hash of the chunk's content, which means that every file containing the
+// same chunk can decrypt the same pieces and they only need to be uploaded
+// once.
+
+// dedupKey derives the key of a deduplicated chunk from its dedup id. The
+// key has the type of the file's master key mk.
+func dedupKey(mk crypto.CipherKey, id crypto.Hash) crypto.CipherKey {
+	h0, h1 := crypto.HashAll(id, 0), crypto.HashAll(id, 1)
+	entropy := append(h0[:], h1[:]...)
+	key, err := crypto.NewSiaKey(mk.Type(), entropy[:len(mk.Key())])
+	if err != nil {
+		// This should never happen since the entropy has the size of a valid
+		// key of the same type.
+		panic(errors.AddContext(err, "failed to derive the key of a deduplicated chunk"))
+	}
+	return key
+}
+
+// pieceKey returns the key of the piece at pieceIndex of the chunk at
+// chunkIndex. Pieces of deduplicated chunks use the same key in every file.
+func pieceKey(mk crypto.CipherKey, dedupIDs map[uint64]crypto.Hash, chunkIndex, pieceIndex uint64) crypto.CipherKey {
+	id, ok := dedupIDs[chunkIndex]
+	if !ok {
+		return mk.Derive(chunkIndex, pieceIndex)
+	}
+	return dedupKey(mk, id).Derive(0, pieceIndex)
+}
+
+// Dedup returns whether the chunks of the file are deduplicated.
+func (sf *SiaFile) Dedup() bool {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.Dedup
+}
+
+// DedupID returns the dedup id of the chunk at chunkIndex and whether the
+// chunk is deduplicated.
+func (sf *SiaFile) DedupID(chunkIndex uint64) (crypto.Hash, bool) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	id, ok := sf.staticMetadata.DedupIDs[chunkIndex]
+	return id, ok
+}
+
+// DedupIDs returns the dedup ids of all the deduplicated chunks of the file.
+func (sf *SiaFile) DedupIDs() []crypto.Hash {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	ids := make([]crypto.Hash, 0, len(sf.staticMetadata.DedupIDs))
+	for _, id := range sf.staticMetadata.DedupIDs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// PieceKey returns the key that the piece at pieceIndex of the chunk at
+// chunkIndex is encrypted with.
+func (sf *SiaFile) PieceKey(chunkIndex, pieceIndex uint64) crypto.CipherKey {
+	mk := sf.MasterKey()
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return pieceKey(mk, sf.staticMetadata.DedupIDs, chunkIndex, pieceIndex)
+}
+
+// SetDedup marks the file's chunks as deduplicated. It needs to be called
+// before any of the chunks are uploaded.
+func (sf *SiaFile) SetDedup() error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.Dedup = true
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdate()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// SetDedupID deduplicates the chunk at chunkIndex using the dedup id. The
+// chunk must not have any pieces yet, since they would be encrypted with the
+// wrong key.
+func (sf *SiaFile) SetDedupID(chunkIndex uint64, id crypto.Hash) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	// If the file was deleted we can't change its metadata since it would
+	// write the file to disk again.
+	if sf.deleted {
+		return errors.New("can't deduplicate a chunk of a deleted file")
+	}
+	if !sf.staticMetadata.Dedup {
+		return errors.New("file is not deduplicated")
+	}
+	if chunkIndex >= uint64(len(sf.staticChunks)) {
+		return fmt.Errorf("chunkIndex %v out of bounds (%v)", chunkIndex, len(sf.staticChunks))
+	}
+	if _, exists := sf.staticMetadata.DedupIDs[chunkIndex]; exists {
+		return errors.New("chunk is already deduplicated")
+	}
+	if sf.staticChunks[chunkIndex].numPieces() > 0 {
+		return errors.New("can't deduplicate a chunk that already has pieces")
+	}
+	if sf.staticMetadata.DedupIDs == nil {
+		sf.staticMetadata.DedupIDs = make(map[uint64]crypto.Hash)
+	}
+	sf.staticMetadata.DedupIDs[chunkIndex] = id
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdate()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// PieceKey returns the key that the piece at pieceIndex of the chunk at
+// chunkIndex is encrypted with.
+func (s *Snapshot) PieceKey(chunkIndex, pieceIndex uint64) crypto.CipherKey {
+	return pieceKey(s.staticMasterKey, s.staticDedupIDs, chunkIndex, pieceIndex)
+}
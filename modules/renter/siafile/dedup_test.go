@@ -0,0 +1,84 @@
+package siafile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// TestDedupPieceKeys tests that deduplicated chunks use the same piece keys in
+// every file and that the dedup ids are persisted.
+func TestDedupPieceKeys(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	sf1 := newBlankTestFile()
+	sf2 := newBlankTestFile()
+	if sf1.NumChunks() < 2 || sf2.NumChunks() < 2 {
+		t.Fatal("test requires files with at least 2 chunks")
+	}
+
+	// Chunks of regular files use keys derived from the master key.
+	if !bytes.Equal(sf1.PieceKey(1, 2).Key(), sf1.MasterKey().Derive(1, 2).Key()) {
+		t.Fatal("regular chunk should use the master key")
+	}
+	var id crypto.Hash
+	fastrand.Read(id[:])
+	if err := sf1.SetDedupID(0, id); err == nil {
+		t.Fatal("chunks of regular files can't be deduplicated")
+	}
+
+	// Deduplicate the same chunk at different indices of both files.
+	if err := sf1.SetDedup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf2.SetDedup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf1.SetDedupID(0, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf1.SetDedupID(0, id); err == nil {
+		t.Fatal("chunk shouldn't be deduplicated twice")
+	}
+	if err := sf2.SetDedupID(1, id); err != nil {
+		t.Fatal(err)
+	}
+	for pieceIndex := uint64(0); pieceIndex < uint64(sf1.ErasureCode().NumPieces()); pieceIndex++ {
+		if !bytes.Equal(sf1.PieceKey(0, pieceIndex).Key(), sf2.PieceKey(1, pieceIndex).Key()) {
+			t.Fatal("deduplicated chunks should use the same piece keys")
+		}
+	}
+	if bytes.Equal(sf1.PieceKey(0, 0).Key(), sf1.PieceKey(0, 1).Key()) {
+		t.Fatal("pieces of a deduplicated chunk should use different keys")
+	}
+	if !bytes.Equal(sf1.Snapshot().PieceKey(0, 1).Key(), sf1.PieceKey(0, 1).Key()) {
+		t.Fatal("snapshot should use the same piece keys as the file")
+	}
+
+	// Chunks with pieces can't be deduplicated.
+	if err := sf1.AddPiece(types.SiaPublicKey{Key: fastrand.Bytes(crypto.EntropySize)}, 1, 0, crypto.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf1.SetDedupID(1, id); err == nil {
+		t.Fatal("chunk with pieces shouldn't be deduplicated")
+	}
+
+	// The dedup ids should survive reloading the file.
+	sf, err := LoadSiaFile(sf1.siaFilePath, sf1.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sf.Dedup() {
+		t.Fatal("dedup flag wasn't persisted")
+	}
+	if loadedID, ok := sf.DedupID(0); !ok || loadedID != id {
+		t.Fatal("dedup id wasn't persisted")
+	}
+	if ids := sf.DedupIDs(); len(ids) != 1 || ids[0] != id {
+		t.Fatal("unexpected dedup ids", ids)
+	}
+}
@@ -16,11 +16,31 @@ type (
 	metadata struct {
 		StaticPagesPerChunk uint8    `json:"pagesperchunk"`  // number of pages reserved for storing a chunk.
 		StaticVersion       [16]byte `json:"version"`        // version of the sia file format used
-		StaticFileSize      int64    `json:"filesize"`       // total size of the file
+		FileSize            int64    `json:"filesize"`       // total size of the file
 		StaticPieceSize     uint64   `json:"piecesize"`      // size of a single piece of the file
 		LocalPath           string   `json:"localpath"`      // file to the local copy of the file used for repairing
 		HyperspacePath      string   `json:"hyperspacepath"` // the path of the file on the Hyperspace network
 
+		// The following fields are only set for small files that are packed
+		// into the chunk of a pack instead of having chunks of their own. The
+		// data of a packed file is the FileSize bytes of the pack starting at
+		// PackOffset.
+		PackPath   string `json:"packpath"`   // the hyperspace path of the pack
+		PackOffset uint64 `json:"packoffset"` // offset of the file's data within the pack
+
+		// Checksum is the checksum of the file's content, computed from
+		// ChunkChecksums once every chunk has a checksum. ChunkChecksums
+		// maps the index of a chunk to the hash of its content, padded with
+		// zeros to the chunk size. Packed files only have a Checksum.
+		Checksum       crypto.Hash            `json:"checksum"`
+		ChunkChecksums map[uint64]crypto.Hash `json:"chunkchecksums,omitempty"`
+
+		// Dedup is set for files whose chunks are deduplicated. DedupIDs maps
+		// the index of every deduplicated chunk to the content hash that its
+		// pieces are encrypted with.
+		Dedup    bool                   `json:"dedup"`
+		DedupIDs map[uint64]crypto.Hash `json:"dedupids,omitempty"`
+
 		// fields for encryption
 		StaticMasterKey      []byte            `json:"masterkey"` // masterkey used to encrypt pieces
 		StaticMasterKeyType  crypto.CipherType `json:"masterkeytype"`
@@ -38,6 +58,11 @@ type (
 		UserID  int         `json:"userid"`  // id of the user who owns the file
 		GroupID int         `json:"groupid"` // id of the group that owns the file
 
+		// ContentType is the MIME type of the file's content. UserMetadata
+		// holds the key/value tags that the user attached to the file.
+		ContentType  string            `json:"contenttype"`
+		UserMetadata map[string]string `json:"usermetadata,omitempty"`
+
 		// staticChunkMetadataSize is the amount of space allocated within the
 		// siafile for the metadata of a single chunk. It allows us to do
 		// random access operations on the file in constant time.
@@ -88,6 +113,13 @@ func (sf *SiaFile) ChangeTime() time.Time {
 	return sf.staticMetadata.ChangeTime
 }
 
+// ContentType returns the MIME type of the file's content.
+func (sf *SiaFile) ContentType() string {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.ContentType
+}
+
 // CreateTime returns the CreateTime timestamp of the file.
 func (sf *SiaFile) CreateTime() time.Time {
 	sf.mu.RLock()
@@ -100,6 +132,13 @@ func (sf *SiaFile) ChunkSize() uint64 {
 	return sf.staticChunkSize()
 }
 
+// GroupID returns the id of the group that owns the file.
+func (sf *SiaFile) GroupID() int {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.GroupID
+}
+
 // LocalPath returns the path of the local data of the file.
 func (sf *SiaFile) LocalPath() string {
 	sf.mu.RLock()
@@ -133,6 +172,21 @@ func (sf *SiaFile) ModTime() time.Time {
 	return sf.staticMetadata.ModTime
 }
 
+// PackOffset returns the offset of a packed file's data within its pack.
+func (sf *SiaFile) PackOffset() uint64 {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.PackOffset
+}
+
+// PackPath returns the hyperspace path of the pack that the file is packed
+// into, or the empty string if the file isn't packed.
+func (sf *SiaFile) PackPath() string {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.PackPath
+}
+
 // PieceSize returns the size of a single piece of the file.
 func (sf *SiaFile) PieceSize() uint64 {
 	return sf.staticMetadata.StaticPieceSize
@@ -150,6 +204,18 @@ func (sf *SiaFile) Rename(newHyperspacePath, newSiaFilePath string) error {
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return err
 	}
+	updates, err := sf.renameUpdates(newHyperspacePath, newSiaFilePath)
+	if err != nil {
+		return err
+	}
+	// Apply updates.
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// renameUpdates changes the name of the file in memory and returns the
+// updates that move it to its new location on disk. The caller must hold the
+// lock.
+func (sf *SiaFile) renameUpdates(newHyperspacePath, newSiaFilePath string) ([]writeaheadlog.Update, error) {
 	// Create the delete update before changing the path to the new one.
 	updates := []writeaheadlog.Update{sf.createDeleteUpdate()}
 	// Rename file in memory.
@@ -160,17 +226,15 @@ func (sf *SiaFile) Rename(newHyperspacePath, newSiaFilePath string) error {
 	// Write the header to the new location.
 	headerUpdate, err := sf.saveHeaderUpdates()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	updates = append(updates, headerUpdate...)
 	// Write the chunks to the new location.
 	chunksUpdates, err := sf.saveChunksUpdates()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	updates = append(updates, chunksUpdates...)
-	// Apply updates.
-	return sf.createAndApplyTransaction(updates...)
+	return append(updates, chunksUpdates...), nil
 }
 
 // SetMode sets the filemode of the sia file.
@@ -188,6 +252,49 @@ func (sf *SiaFile) SetMode(mode os.FileMode) error {
 	return sf.createAndApplyTransaction(updates...)
 }
 
+// SetUserMetadata replaces the content type and the key/value tags of the
+// file.
+func (sf *SiaFile) SetUserMetadata(contentType string, userMetadata map[string]string) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.ContentType = contentType
+	sf.staticMetadata.UserMetadata = nil
+	if len(userMetadata) > 0 {
+		sf.staticMetadata.UserMetadata = make(map[string]string, len(userMetadata))
+		for k, v := range userMetadata {
+			sf.staticMetadata.UserMetadata[k] = v
+		}
+	}
+	sf.staticMetadata.ChangeTime = time.Now()
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdate()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// SetPack moves a packed file to the pack at packPath, where its data starts
+// at packOffset. It is used when packs are compacted.
+func (sf *SiaFile) SetPack(packPath string, packOffset uint64) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if sf.staticMetadata.PackPath == "" {
+		return errors.New("file is not packed")
+	}
+	sf.staticMetadata.PackPath = packPath
+	sf.staticMetadata.PackOffset = packOffset
+	sf.staticMetadata.ChangeTime = time.Now()
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdate()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
 // SetLocalPath changes the local path of the file which is used to repair
 // the file from disk.
 func (sf *SiaFile) SetLocalPath(path string) error {
@@ -203,6 +310,27 @@ func (sf *SiaFile) SetLocalPath(path string) error {
 	return sf.createAndApplyTransaction(updates...)
 }
 
+// SetFileSize changes the size of the file. The number of chunks of the file
+// needs to be large enough to hold the new size.
+func (sf *SiaFile) SetFileSize(fileSize uint64) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if fileSize > uint64(len(sf.staticChunks))*sf.staticChunkSize() {
+		return errors.New("file size exceeds the capacity of the file's chunks")
+	}
+	sf.staticMetadata.FileSize = int64(fileSize)
+	sf.staticMetadata.ModTime = time.Now()
+	sf.staticMetadata.ChangeTime = sf.staticMetadata.ModTime
+	sf.updateChecksum()
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdate()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
 // HyperspacePath returns the file's sia path.
 func (sf *SiaFile) HyperspacePath() string {
 	sf.mu.RLock()
@@ -212,7 +340,27 @@ func (sf *SiaFile) HyperspacePath() string {
 
 // Size returns the file's size.
 func (sf *SiaFile) Size() uint64 {
-	return uint64(sf.staticMetadata.StaticFileSize)
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return uint64(sf.staticMetadata.FileSize)
+}
+
+// UserID returns the id of the user who owns the file.
+func (sf *SiaFile) UserID() int {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.UserID
+}
+
+// UserMetadata returns a copy of the key/value tags of the file.
+func (sf *SiaFile) UserMetadata() map[string]string {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	md := make(map[string]string, len(sf.staticMetadata.UserMetadata))
+	for k, v := range sf.staticMetadata.UserMetadata {
+		md[k] = v
+	}
+	return md
 }
 
 // UpdateAccessTime updates the AccessTime timestamp to the current time.
@@ -42,6 +42,7 @@ func applyUpdates(deps modules.Dependencies, updates ...writeaheadlog.Update) er
 				} else if err != nil {
 					return err
 				}
+				return nil
 			}
 
 			// Decode update.
@@ -307,6 +308,18 @@ func (sf *SiaFile) createInsertUpdate(index int64, data []byte) writeaheadlog.Up
 	}
 }
 
+// Bytes returns the contents of the SiaFile on disk. Updates are applied to
+// the file while its lock is held, so the contents always reflect a complete
+// state of the SiaFile, even while other threads are modifying it.
+func (sf *SiaFile) Bytes() ([]byte, error) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	if sf.deleted {
+		return nil, errors.New("can't read deleted file")
+	}
+	return ioutil.ReadFile(sf.siaFilePath)
+}
+
 // saveFile saves the whole SiaFile atomically.
 func (sf *SiaFile) saveFile() error {
 	headerUpdates, err := sf.saveHeaderUpdates()
@@ -409,6 +409,31 @@ func TestApplyUpdates(t *testing.T) {
 	})
 }
 
+// TestApplyDeleteUpdate tests that applying a delete update removes the file
+// and isn't treated as an insert update.
+func TestApplyDeleteUpdate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	sf := newTestFile()
+	if _, err := os.Stat(sf.siaFilePath); err != nil {
+		t.Fatal("test file wasn't saved", err)
+	}
+	update := sf.createDeleteUpdate()
+	if err := ApplyUpdates(update); err != nil {
+		t.Fatal("failed to apply delete update", err)
+	}
+	if _, err := os.Stat(sf.siaFilePath); !os.IsNotExist(err) {
+		t.Fatal("Expected a file doesn't exist error but got", err)
+	}
+	// Applying the update again is a no-op.
+	if err := ApplyUpdates(update); err != nil {
+		t.Fatal("failed to apply delete update twice", err)
+	}
+}
+
 // TestSaveSmallHeader tests the saveHeader method for a header that is not big
 // enough to need more than a single page on disk.
 func TestSaveSmallHeader(t *testing.T) {
@@ -701,3 +726,44 @@ func TestSaveChunk(t *testing.T) {
 		t.Fatal("marshaled chunk doesn't equal chunk on disk")
 	}
 }
+
+// TestSetUserMetadata tests that the user metadata of a SiaFile is persisted
+// and can be cleared again.
+func TestSetUserMetadata(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	sf, wal, _ := newBlankTestFileAndWAL()
+	md := map[string]string{"album": "holidays", "year": "2018"}
+	if err := sf.SetUserMetadata("image/jpeg", md); err != nil {
+		t.Fatal(err)
+	}
+	// Changing the map afterwards doesn't change the file.
+	md["year"] = "2019"
+
+	sf2, err := LoadSiaFile(sf.siaFilePath, wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf2.ContentType() != "image/jpeg" {
+		t.Fatal("wrong content type", sf2.ContentType())
+	}
+	expected := map[string]string{"album": "holidays", "year": "2018"}
+	if !reflect.DeepEqual(sf2.UserMetadata(), expected) {
+		t.Fatal("wrong user metadata", sf2.UserMetadata())
+	}
+
+	// Clear the metadata.
+	if err := sf.SetUserMetadata("", nil); err != nil {
+		t.Fatal(err)
+	}
+	sf2, err = LoadSiaFile(sf.siaFilePath, wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf2.ContentType() != "" || len(sf2.UserMetadata()) != 0 {
+		t.Fatal("metadata wasn't cleared", sf2.ContentType(), sf2.UserMetadata())
+	}
+}
@@ -0,0 +1,250 @@
+package siafile
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// SharedFile is the part of a SiaFile that is shared with other renters. It
+// contains everything that is needed to download the file from its hosts, but
+// none of the renter's contract state. Since that includes the key that the
+// pieces are encrypted with, anyone who gets hold of a SharedFile can decrypt
+// the file. The pieces of deduplicated chunks are encrypted with keys derived
+// from their dedup ids, so the dedup ids are shared as well.
+//
+// A packed file is shared with the chunks and the key of its pack. Its data
+// is the FileSize bytes of the pack starting at PackOffset, and PackSize is
+// the size of the pack. PackSize is zero for files that aren't packed. Since
+// the key of the pack is handed out, the recipient can decrypt the other
+// files packed into the same pack as well.
+type SharedFile struct {
+	HyperspacePath    string
+	FileSize          uint64
+	Mode              os.FileMode
+	PieceSize         uint64
+	SharingKeyType    crypto.CipherType
+	SharingKey        []byte
+	ErasureCodeType   [4]byte
+	ErasureCodeParams [8]byte
+	Chunks            []FileChunk
+	DedupIDs          []SharedDedupID
+	PackOffset        uint64
+	PackSize          uint64
+}
+
+// SharedDedupID is the dedup id of a deduplicated chunk of a SharedFile.
+type SharedDedupID struct {
+	ChunkIndex uint64
+	ID         crypto.Hash
+}
+
+// sharingKey returns the key that is handed out when the file is shared. The
+// pieces of a file are encrypted with keys derived from its master key, so
+// sharing a file gives away its master key. Only files that were loaded from
+// a shared file have a dedicated sharing key, which is the master key of the
+// file that was shared. Master keys are generated for every file, so sharing
+// a file doesn't expose the other files of the renter, but access to a shared
+// file can't be revoked.
+func (sf *SiaFile) sharingKey() (crypto.CipherType, []byte) {
+	if len(sf.staticMetadata.StaticSharingKey) > 0 {
+		return sf.staticMetadata.StaticSharingKeyType, sf.staticMetadata.StaticSharingKey
+	}
+	return sf.staticMetadata.StaticMasterKeyType, sf.staticMetadata.StaticMasterKey
+}
+
+// Share returns the SharedFile of the file, stored at siaPath.
+func (sf *SiaFile) Share(siaPath string) SharedFile {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	keyType, key := sf.sharingKey()
+	shared := SharedFile{
+		HyperspacePath:    siaPath,
+		FileSize:          uint64(sf.staticMetadata.FileSize),
+		Mode:              sf.staticMetadata.Mode,
+		PieceSize:         sf.staticMetadata.StaticPieceSize,
+		SharingKeyType:    keyType,
+		SharingKey:        append([]byte(nil), key...),
+		ErasureCodeType:   sf.staticMetadata.StaticErasureCodeType,
+		ErasureCodeParams: sf.staticMetadata.StaticErasureCodeParams,
+		Chunks:            make([]FileChunk, len(sf.staticChunks)),
+	}
+	for chunkIndex, chunk := range sf.staticChunks {
+		shared.Chunks[chunkIndex].Pieces = make([][]Piece, len(chunk.Pieces))
+		for pieceIndex, pieceSet := range chunk.Pieces {
+			for _, p := range pieceSet {
+				shared.Chunks[chunkIndex].Pieces[pieceIndex] = append(shared.Chunks[chunkIndex].Pieces[pieceIndex], Piece{
+					HostPubKey: sf.pubKeyTable[p.HostTableOffset].PublicKey,
+					MerkleRoot: p.MerkleRoot,
+				})
+			}
+		}
+	}
+	for chunkIndex, id := range sf.staticMetadata.DedupIDs {
+		shared.DedupIDs = append(shared.DedupIDs, SharedDedupID{ChunkIndex: chunkIndex, ID: id})
+	}
+	sort.Slice(shared.DedupIDs, func(i, j int) bool {
+		return shared.DedupIDs[i].ChunkIndex < shared.DedupIDs[j].ChunkIndex
+	})
+	return shared
+}
+
+// SharePacked returns the SharedFile of a packed file, stored at siaPath. pack
+// must be the pack of the file.
+func (sf *SiaFile) SharePacked(siaPath string, pack *SiaFile) SharedFile {
+	shared := pack.Share(siaPath)
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	shared.PackSize = shared.FileSize
+	shared.PackOffset = sf.staticMetadata.PackOffset
+	shared.FileSize = uint64(sf.staticMetadata.FileSize)
+	shared.Mode = sf.staticMetadata.Mode
+	return shared
+}
+
+// Pack returns the SharedFile of the pack of a shared packed file, stored at
+// packPath.
+func (shared SharedFile) Pack(packPath string) SharedFile {
+	pack := shared
+	pack.HyperspacePath = packPath
+	pack.FileSize = shared.PackSize
+	pack.PackOffset = 0
+	pack.PackSize = 0
+	return pack
+}
+
+// NewFromSharedFile creates a new SiaFile at the path of a file that was shared
+// by another renter. The parent directory of the file must already exist.
+func (sfs *SiaFileSet) NewFromSharedFile(shared SharedFile) (*SiaFileSetEntry, error) {
+	sfs.mu.Lock()
+	defer sfs.mu.Unlock()
+	siaPath := strings.TrimPrefix(shared.HyperspacePath, "/")
+	exists, err := sfs.exists(siaPath)
+	if exists {
+		return nil, ErrPathOverload
+	}
+	if !os.IsNotExist(err) && err != nil {
+		return nil, err
+	}
+
+	// Validate the shared file. Packed files need to be split into the pack
+	// and the packed file first.
+	if shared.PackSize != 0 {
+		return nil, errors.New("shared file is packed")
+	}
+	key, err := crypto.NewSiaKey(shared.SharingKeyType, shared.SharingKey)
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid sharing key")
+	}
+	ec, err := unmarshalErasureCoder(shared.ErasureCodeType, shared.ErasureCodeParams)
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid erasure code")
+	}
+	chunkSize := shared.PieceSize * uint64(ec.MinPieces())
+	if chunkSize == 0 {
+		return nil, errors.New("invalid piece size")
+	}
+	numChunks := shared.FileSize / chunkSize
+	if shared.FileSize%chunkSize != 0 || numChunks == 0 {
+		numChunks++
+	}
+	if uint64(len(shared.Chunks)) != numChunks {
+		return nil, fmt.Errorf("shared file has %v chunks, expected %v", len(shared.Chunks), numChunks)
+	}
+	var dedupIDs map[uint64]crypto.Hash
+	for _, id := range shared.DedupIDs {
+		if id.ChunkIndex >= numChunks {
+			return nil, fmt.Errorf("dedup id of chunk %v out of bounds (%v)", id.ChunkIndex, numChunks)
+		}
+		if dedupIDs == nil {
+			dedupIDs = make(map[uint64]crypto.Hash)
+		}
+		if _, exists := dedupIDs[id.ChunkIndex]; exists {
+			return nil, fmt.Errorf("chunk %v has more than one dedup id", id.ChunkIndex)
+		}
+		dedupIDs[id.ChunkIndex] = id.ID
+	}
+
+	currentTime := time.Now()
+	file := &SiaFile{
+		staticMetadata: metadata{
+			AccessTime:              currentTime,
+			ChunkOffset:             defaultReservedMDPages * pageSize,
+			ChangeTime:              currentTime,
+			CreateTime:              currentTime,
+			FileSize:                int64(shared.FileSize),
+			StaticMasterKey:         key.Key(),
+			StaticMasterKeyType:     key.Type(),
+			StaticSharingKey:        key.Key(),
+			StaticSharingKeyType:    key.Type(),
+			Mode:                    shared.Mode,
+			Dedup:                   len(dedupIDs) > 0,
+			DedupIDs:                dedupIDs,
+			ModTime:                 currentTime,
+			staticErasureCode:       ec,
+			StaticErasureCodeType:   shared.ErasureCodeType,
+			StaticErasureCodeParams: shared.ErasureCodeParams,
+			StaticPagesPerChunk:     numChunkPagesRequired(ec.NumPieces()),
+			StaticPieceSize:         shared.PieceSize,
+			HyperspacePath:          siaPath,
+		},
+		deps:           modules.ProdDependencies,
+		siaFilePath:    filepath.Join(sfs.siaFileDir, siaPath+ShareExtension),
+		staticUniqueID: hex.EncodeToString(fastrand.Bytes(20)),
+		wal:            sfs.wal,
+	}
+	file.staticChunks = make([]chunk, numChunks)
+	for chunkIndex, sharedChunk := range shared.Chunks {
+		if len(sharedChunk.Pieces) != ec.NumPieces() {
+			return nil, fmt.Errorf("chunk %v has %v pieces, expected %v", chunkIndex, len(sharedChunk.Pieces), ec.NumPieces())
+		}
+		file.staticChunks[chunkIndex].Pieces = make([][]piece, ec.NumPieces())
+	}
+	// Save the file without pieces first. The pubKeyTable might not fit into
+	// the reserved space, and growing the header requires the file on disk.
+	if err := file.saveFile(); err != nil {
+		return nil, err
+	}
+
+	// Populate the pubKeyTable of the file and add the pieces.
+	pubKeyMap := make(map[string]uint32)
+	for chunkIndex, sharedChunk := range shared.Chunks {
+		for pieceIndex, pieceSet := range sharedChunk.Pieces {
+			for _, p := range pieceSet {
+				tableOffset, exists := pubKeyMap[string(p.HostPubKey.Key)]
+				if !exists {
+					tableOffset = uint32(len(file.pubKeyTable))
+					pubKeyMap[string(p.HostPubKey.Key)] = tableOffset
+					file.pubKeyTable = append(file.pubKeyTable, HostPublicKey{
+						PublicKey: p.HostPubKey,
+						Used:      true,
+					})
+				}
+				file.staticChunks[chunkIndex].Pieces[pieceIndex] = append(file.staticChunks[chunkIndex].Pieces[pieceIndex], piece{
+					HostTableOffset: tableOffset,
+					MerkleRoot:      p.MerkleRoot,
+				})
+			}
+		}
+	}
+	if err := file.saveFile(); err != nil {
+		return nil, err
+	}
+	entry := sfs.newSiaFileSetEntry(file)
+	threadUID := randomThreadUID()
+	entry.threadMap[threadUID] = newThreadType()
+	sfs.siaFileMap[siaPath] = entry
+	return &SiaFileSetEntry{
+		siaFileSetEntry: entry,
+		threadUID:       threadUID,
+	}, nil
+}
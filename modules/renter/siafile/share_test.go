@@ -0,0 +1,141 @@
+package siafile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/encoding"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// TestShareSiaFile tests sharing a SiaFile and creating a new SiaFile from the
+// shared file.
+func TestShareSiaFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	sf := newTestFile()
+	dir := filepath.Join(os.TempDir(), "siafiles", t.Name())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	wal, _ := newTestWAL()
+	sfs := NewSiaFileSet(dir, wal)
+
+	// Share the file and send it through the encoding.
+	siaPath := hex.EncodeToString(fastrand.Bytes(8))
+	var shared SharedFile
+	if err := encoding.Unmarshal(encoding.Marshal(sf.Share(siaPath)), &shared); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := sfs.NewFromSharedFile(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+
+	// The new file should have the same size, key and pieces.
+	if entry.Size() != sf.Size() || entry.NumChunks() != sf.NumChunks() {
+		t.Fatal("size of the shared file doesn't match")
+	}
+	if !bytes.Equal(entry.MasterKey().Key(), sf.MasterKey().Key()) {
+		t.Fatal("key of the shared file doesn't match")
+	}
+	for chunkIndex := uint64(0); chunkIndex < sf.NumChunks(); chunkIndex++ {
+		pieces, err := sf.Pieces(chunkIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sharedPieces, err := entry.Pieces(chunkIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoding.Marshal(pieces), encoding.Marshal(sharedPieces)) {
+			t.Fatalf("pieces of chunk %v don't match", chunkIndex)
+		}
+	}
+
+	// The file should have been saved to disk.
+	loaded, err := LoadSiaFile(filepath.Join(dir, siaPath+ShareExtension), wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.HyperspacePath() != siaPath || loaded.Size() != sf.Size() {
+		t.Fatal("shared file wasn't saved correctly")
+	}
+
+	// Sharing to an existing path should fail.
+	if _, err := sfs.NewFromSharedFile(shared); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+
+	// A shared file with the wrong number of chunks should be rejected.
+	shared.HyperspacePath += "2"
+	shared.Chunks = shared.Chunks[1:]
+	if _, err := sfs.NewFromSharedFile(shared); err == nil {
+		t.Fatal("expected error for missing chunks")
+	}
+}
+
+// TestShareDedupSiaFile tests that the dedup ids of a shared file are
+// restored, so that the pieces of its deduplicated chunks use the same keys.
+func TestShareDedupSiaFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	sf := newBlankTestFile()
+	if sf.NumChunks() < 2 {
+		t.Fatal("test requires a file with at least 2 chunks")
+	}
+	dir := filepath.Join(os.TempDir(), "siafiles", t.Name())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	wal, _ := newTestWAL()
+	sfs := NewSiaFileSet(dir, wal)
+
+	if err := sf.SetDedup(); err != nil {
+		t.Fatal(err)
+	}
+	var id crypto.Hash
+	fastrand.Read(id[:])
+	if err := sf.SetDedupID(1, id); err != nil {
+		t.Fatal(err)
+	}
+	var shared SharedFile
+	if err := encoding.Unmarshal(encoding.Marshal(sf.Share(hex.EncodeToString(fastrand.Bytes(8)))), &shared); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := sfs.NewFromSharedFile(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	if !entry.Dedup() {
+		t.Fatal("shared file isn't deduplicated")
+	}
+	if sharedID, ok := entry.DedupID(1); !ok || sharedID != id {
+		t.Fatal("dedup id of the chunk wasn't restored")
+	}
+	if _, ok := entry.DedupID(0); ok {
+		t.Fatal("chunk without a dedup id was deduplicated")
+	}
+	for chunkIndex := uint64(0); chunkIndex < 2; chunkIndex++ {
+		for pieceIndex := uint64(0); pieceIndex < uint64(sf.ErasureCode().NumPieces()); pieceIndex++ {
+			if !bytes.Equal(entry.PieceKey(chunkIndex, pieceIndex).Key(), sf.PieceKey(chunkIndex, pieceIndex).Key()) {
+				t.Fatalf("key of piece %v of chunk %v doesn't match", pieceIndex, chunkIndex)
+			}
+		}
+	}
+
+	// Dedup ids of chunks that don't exist are rejected.
+	shared.HyperspacePath += "2"
+	shared.DedupIDs = append(shared.DedupIDs, SharedDedupID{ChunkIndex: uint64(len(shared.Chunks)), ID: id})
+	if _, err := sfs.NewFromSharedFile(shared); err == nil {
+		t.Fatal("expected error for an out of bounds dedup id")
+	}
+}
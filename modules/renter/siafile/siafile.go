@@ -25,6 +25,12 @@ var (
 	ErrPathOverload = errors.New("a file already exists at that location")
 	// ErrUnknownPath is an error when a file cannot be found with the given path
 	ErrUnknownPath = errors.New("no file known with that path")
+	// ErrUnknownDir is an error when a directory cannot be found with the
+	// given path
+	ErrUnknownDir = errors.New("no directory known with that path")
+	// ErrMoveIntoItself is an error when a directory would be moved into one
+	// of its own subdirectories
+	ErrMoveIntoItself = errors.New("a directory can't be moved into itself")
 	// ErrUnknownThread is an error when a SiaFile is trying to be closed by a
 	// thread that is not in the threadMap
 	ErrUnknownThread = errors.New("thread should not be calling Close(), does not have control of the siafile")
@@ -127,15 +133,45 @@ func (c *chunk) numPieces() (numPieces int) {
 
 // New create a new SiaFile.
 func New(siaFilePath, siaPath, source string, wal *writeaheadlog.WAL, erasureCode modules.ErasureCoder, masterKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode) (*SiaFile, error) {
+	file := newSiaFile(siaFilePath, siaPath, source, wal, erasureCode, masterKey, fileSize, fileMode)
+	// Init chunks.
+	numChunks := fileSize / file.staticChunkSize()
+	if fileSize%file.staticChunkSize() != 0 || numChunks == 0 {
+		numChunks++
+	}
+	file.staticChunks = make([]chunk, numChunks)
+	for i := range file.staticChunks {
+		file.staticChunks[i].Pieces = make([][]piece, erasureCode.NumPieces())
+	}
+	// Save file.
+	return file, file.saveFile()
+}
+
+// NewPacked creates a new SiaFile for a small file that is packed into the
+// pack at packPath, starting at packOffset. Packed files don't have chunks of
+// their own, their data is stored in the chunks of the pack.
+func NewPacked(siaFilePath, siaPath, source string, wal *writeaheadlog.WAL, erasureCode modules.ErasureCoder, masterKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode, packPath string, packOffset uint64) (*SiaFile, error) {
+	if packPath == "" {
+		return nil, errors.New("packed files need a pack")
+	}
+	file := newSiaFile(siaFilePath, siaPath, source, wal, erasureCode, masterKey, fileSize, fileMode)
+	file.staticMetadata.PackPath = packPath
+	file.staticMetadata.PackOffset = packOffset
+	return file, file.saveFile()
+}
+
+// newSiaFile creates the in-memory representation of a new SiaFile without
+// any chunks.
+func newSiaFile(siaFilePath, siaPath, source string, wal *writeaheadlog.WAL, erasureCode modules.ErasureCoder, masterKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode) *SiaFile {
 	currentTime := time.Now()
 	ecType, ecParams := marshalErasureCoder(erasureCode)
-	file := &SiaFile{
+	return &SiaFile{
 		staticMetadata: metadata{
 			AccessTime:              currentTime,
 			ChunkOffset:             defaultReservedMDPages * pageSize,
 			ChangeTime:              currentTime,
 			CreateTime:              currentTime,
-			StaticFileSize:          int64(fileSize),
+			FileSize:                int64(fileSize),
 			LocalPath:               source,
 			StaticMasterKey:         masterKey.Key(),
 			StaticMasterKeyType:     masterKey.Type(),
@@ -153,17 +189,6 @@ func New(siaFilePath, siaPath, source string, wal *writeaheadlog.WAL, erasureCod
 		staticUniqueID: hex.EncodeToString(fastrand.Bytes(20)),
 		wal:            wal,
 	}
-	// Init chunks.
-	numChunks := fileSize / file.staticChunkSize()
-	if fileSize%file.staticChunkSize() != 0 || numChunks == 0 {
-		numChunks++
-	}
-	file.staticChunks = make([]chunk, numChunks)
-	for i := range file.staticChunks {
-		file.staticChunks[i].Pieces = make([][]piece, erasureCode.NumPieces())
-	}
-	// Save file.
-	return file, file.saveFile()
 }
 
 // AddPiece adds an uploaded piece to the file. It also updates the host table
@@ -250,10 +275,62 @@ func (sf *SiaFile) AddPiece(pk types.SiaPublicKey, chunkIndex, pieceIndex uint64
 	return sf.createAndApplyTransaction(append(updates, chunkUpdate)...)
 }
 
+// RemovePiece removes the piece with the given Merkle root that is stored on
+// the host with the given public key from a chunk. It is used for pieces that
+// the host lost, which lowers the health of the chunk so that it is repaired.
+func (sf *SiaFile) RemovePiece(pk types.SiaPublicKey, chunkIndex, pieceIndex uint64, merkleRoot crypto.Hash) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	// If the file was deleted we can't remove a piece since it would write
+	// the file to disk again.
+	if sf.deleted {
+		return errors.New("can't remove piece from deleted file")
+	}
+	// Check if the chunkIndex and pieceIndex are valid.
+	if chunkIndex >= uint64(len(sf.staticChunks)) {
+		return fmt.Errorf("chunkIndex %v out of bounds (%v)", chunkIndex, len(sf.staticChunks))
+	}
+	if pieceIndex >= uint64(len(sf.staticChunks[chunkIndex].Pieces)) {
+		return fmt.Errorf("pieceIndex %v out of bounds (%v)", pieceIndex, len(sf.staticChunks[chunkIndex].Pieces))
+	}
+	// Find the piece.
+	pieces := sf.staticChunks[chunkIndex].Pieces[pieceIndex]
+	i := 0
+	for ; i < len(pieces); i++ {
+		hpk := sf.pubKeyTable[pieces[i].HostTableOffset].PublicKey
+		if pieces[i].MerkleRoot == merkleRoot && hpk.Algorithm == pk.Algorithm && bytes.Equal(hpk.Key, pk.Key) {
+			break
+		}
+	}
+	if i == len(pieces) {
+		return errors.New("piece not found")
+	}
+	sf.staticChunks[chunkIndex].Pieces[pieceIndex] = append(pieces[:i], pieces[i+1:]...)
+
+	// Update the ChangeTime.
+	sf.staticMetadata.ChangeTime = time.Now()
+
+	// Update the file atomically.
+	updates, err := sf.saveMetadataUpdate()
+	if err != nil {
+		return err
+	}
+	chunkUpdate, err := sf.saveChunkUpdate(int(chunkIndex))
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(append(updates, chunkUpdate)...)
+}
+
 // Available indicates whether the file is ready to be downloaded.
 func (sf *SiaFile) Available(offline map[string]bool) bool {
 	sf.mu.RLock()
 	defer sf.mu.RUnlock()
+	// Packed files don't have chunks of their own, their availability depends
+	// on their pack.
+	if len(sf.staticChunks) == 0 {
+		return false
+	}
 	// We need to find at least erasureCode.MinPieces different pieces for each
 	// chunk for the file to be available.
 	for _, chunk := range sf.staticChunks {
@@ -321,6 +398,42 @@ func (sf *SiaFile) Expiration(contracts map[string]modules.RenterContract) types
 	return lowest
 }
 
+// GrowNumChunks increases the number of chunks of the file to numChunks. It is
+// used by streaming uploads, which don't know the size of the file in advance.
+// The file's size is not changed, it needs to be updated separately using
+// SetFileSize.
+func (sf *SiaFile) GrowNumChunks(numChunks uint64) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	// If the file was deleted we can't grow it since it would write the file
+	// to disk again.
+	if sf.deleted {
+		return errors.New("can't grow deleted file")
+	}
+	// Nothing to do if the file already has enough chunks.
+	if numChunks <= uint64(len(sf.staticChunks)) {
+		return nil
+	}
+	// Add the new chunks and save them to disk. The new chunks don't have
+	// checksums yet, so the file's checksum is reset as well.
+	sf.staticMetadata.Checksum = crypto.Hash{}
+	updates, err := sf.saveMetadataUpdate()
+	if err != nil {
+		return err
+	}
+	for uint64(len(sf.staticChunks)) < numChunks {
+		sf.staticChunks = append(sf.staticChunks, chunk{
+			Pieces: make([][]piece, sf.staticMetadata.staticErasureCode.NumPieces()),
+		})
+		update, err := sf.saveChunkUpdate(len(sf.staticChunks) - 1)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, update)
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
 // HostPublicKeys returns all the public keys of hosts the file has ever been
 // uploaded to. That means some of those hosts might no longer be in use.
 func (sf *SiaFile) HostPublicKeys() (spks []types.SiaPublicKey) {
@@ -375,7 +488,12 @@ func (sf *SiaFile) Pieces(chunkIndex uint64) ([][]Piece, error) {
 func (sf *SiaFile) Redundancy(offlineMap map[string]bool, goodForRenewMap map[string]bool) float64 {
 	sf.mu.RLock()
 	defer sf.mu.RUnlock()
-	if sf.staticMetadata.StaticFileSize == 0 {
+	// Packed files don't have chunks of their own, their redundancy is the
+	// redundancy of their pack.
+	if len(sf.staticChunks) == 0 {
+		return 0
+	}
+	if sf.staticMetadata.FileSize == 0 {
 		// TODO change this once tiny files are supported.
 		if len(sf.staticChunks) != 1 {
 			// should never happen
@@ -446,6 +564,44 @@ func (sf *SiaFile) Redundancy(offlineMap map[string]bool, goodForRenewMap map[st
 	return minRedundancy
 }
 
+// Health returns the health of the least healthy chunk of the file. A health
+// of 0 means that every chunk is fully redundant and a health of 1 means that
+// the least healthy chunk has just enough pieces to be recovered. Files with a
+// health above 1 can't be recovered from the network. Only pieces stored on
+// online hosts that are goodForRenew count towards the health.
+func (sf *SiaFile) Health(offlineMap map[string]bool, goodForRenewMap map[string]bool) float64 {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	if sf.staticMetadata.FileSize == 0 {
+		return 0
+	}
+	numPieces := sf.staticMetadata.staticErasureCode.NumPieces()
+	minPieces := sf.staticMetadata.staticErasureCode.MinPieces()
+	var worstHealth float64
+	for _, chunk := range sf.staticChunks {
+		goodPieces := 0
+		for _, pieceSet := range chunk.Pieces {
+			for _, piece := range pieceSet {
+				key := string(sf.pubKeyTable[piece.HostTableOffset].PublicKey.Key)
+				if !offlineMap[key] && goodForRenewMap[key] {
+					goodPieces++
+					break
+				}
+			}
+		}
+		var health float64
+		if numPieces > minPieces {
+			health = float64(numPieces-goodPieces) / float64(numPieces-minPieces)
+		} else if goodPieces < numPieces {
+			health = 1 + float64(numPieces-goodPieces)/float64(numPieces)
+		}
+		if health > worstHealth {
+			worstHealth = health
+		}
+	}
+	return worstHealth
+}
+
 // UID returns a unique identifier for this file.
 func (sf *SiaFile) UID() string {
 	return sf.staticUniqueID
@@ -522,6 +678,10 @@ func (sf *SiaFile) UploadProgress() float64 {
 	}
 	uploaded := sf.UploadedBytes()
 	desired := sf.NumChunks() * modules.SectorSize * uint64(sf.ErasureCode().NumPieces())
+	if desired == 0 {
+		// Packed files don't have chunks of their own.
+		return 0
+	}
 	return math.Min(100*(float64(uploaded)/float64(desired)), 100)
 }
 
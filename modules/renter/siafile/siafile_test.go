@@ -1,11 +1,13 @@
 package siafile
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/types"
 	"github.com/HyperspaceApp/fastrand"
 )
 
@@ -216,3 +218,165 @@ func TestDefragChunk(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestHealth probes the Health method of the SiaFile.
+func TestHealth(t *testing.T) {
+	sf := newBlankTestFile()
+	numPieces := sf.ErasureCode().NumPieces()
+	minPieces := sf.ErasureCode().MinPieces()
+	host1 := types.SiaPublicKey{Key: []byte{1}}
+	host2 := types.SiaPublicKey{Key: []byte{2}}
+	offline := map[string]bool{string(host1.Key): false, string(host2.Key): false}
+	goodForRenew := map[string]bool{string(host1.Key): true, string(host2.Key): true}
+
+	// A file without pieces can't be recovered.
+	expected := float64(numPieces) / float64(numPieces-minPieces)
+	if h := sf.Health(offline, goodForRenew); h != expected {
+		t.Fatalf("expected health %v, got %v", expected, h)
+	}
+
+	// Upload the minimum number of pieces of every chunk to the first host.
+	for chunkIndex := range sf.staticChunks {
+		for pieceIndex := 0; pieceIndex < minPieces; pieceIndex++ {
+			if err := sf.AddPiece(host1, uint64(chunkIndex), uint64(pieceIndex), crypto.Hash{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if h := sf.Health(offline, goodForRenew); h != 1 {
+		t.Fatal("expected health 1, got", h)
+	}
+
+	// Upload the remaining pieces to the second host, leaving out one piece of
+	// the last chunk.
+	for chunkIndex := range sf.staticChunks {
+		for pieceIndex := minPieces; pieceIndex < numPieces; pieceIndex++ {
+			if chunkIndex == len(sf.staticChunks)-1 && pieceIndex == numPieces-1 {
+				continue
+			}
+			if err := sf.AddPiece(host2, uint64(chunkIndex), uint64(pieceIndex), crypto.Hash{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	expected = 1 / float64(numPieces-minPieces)
+	if h := sf.Health(offline, goodForRenew); h != expected {
+		t.Fatalf("expected health %v, got %v", expected, h)
+	}
+	if err := sf.AddPiece(host2, uint64(len(sf.staticChunks)-1), uint64(numPieces-1), crypto.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	if h := sf.Health(offline, goodForRenew); h != 0 {
+		t.Fatal("expected health 0, got", h)
+	}
+
+	// Pieces on offline hosts and hosts that are not goodForRenew don't count.
+	offline[string(host2.Key)] = true
+	if h := sf.Health(offline, goodForRenew); h != 1 {
+		t.Fatal("expected health 1 with the second host offline, got", h)
+	}
+	offline[string(host2.Key)] = false
+	goodForRenew[string(host1.Key)] = false
+	expected = float64(minPieces) / float64(numPieces-minPieces)
+	if h := sf.Health(offline, goodForRenew); h != expected {
+		t.Fatalf("expected health %v, got %v", expected, h)
+	}
+}
+
+// TestGrowNumChunks tests growing a file and updating its size the way
+// streaming uploads do.
+func TestGrowNumChunks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	sf := newBlankTestFile()
+	numChunks := sf.NumChunks()
+
+	// Growing the file to fewer chunks than it has is a no-op.
+	if err := sf.GrowNumChunks(numChunks - 1); err != nil {
+		t.Fatal(err)
+	}
+	if sf.NumChunks() != numChunks {
+		t.Fatal("file shouldn't have shrunk", sf.NumChunks(), numChunks)
+	}
+	// The size can't exceed the capacity of the chunks.
+	if err := sf.SetFileSize((numChunks + 1) * sf.ChunkSize()); err == nil {
+		t.Fatal("expected error when setting a size larger than the chunks")
+	}
+
+	// Grow the file by two chunks and set the size to fill them.
+	if err := sf.GrowNumChunks(numChunks + 2); err != nil {
+		t.Fatal(err)
+	}
+	newSize := (numChunks+1)*sf.ChunkSize() + 1
+	if err := sf.SetFileSize(newSize); err != nil {
+		t.Fatal(err)
+	}
+	if sf.NumChunks() != numChunks+2 || sf.Size() != newSize {
+		t.Fatal("unexpected chunks or size", sf.NumChunks(), sf.Size())
+	}
+	if len(sf.staticChunks[numChunks+1].Pieces) != sf.ErasureCode().NumPieces() {
+		t.Fatal("new chunk has the wrong number of piece sets")
+	}
+
+	// The new chunks and size should survive reloading the file.
+	sf2, err := LoadSiaFile(sf.siaFilePath, sf.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf2.NumChunks() != numChunks+2 || sf2.Size() != newSize {
+		t.Fatal("growing the file wasn't persisted", sf2.NumChunks(), sf2.Size())
+	}
+}
+
+// TestRemovePiece tests that pieces can be removed from a chunk and that the
+// removal is persisted.
+func TestRemovePiece(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	sf := newBlankTestFile()
+
+	// Add the same sector for two hosts.
+	pk1 := types.SiaPublicKey{Key: fastrand.Bytes(crypto.EntropySize)}
+	pk2 := types.SiaPublicKey{Key: fastrand.Bytes(crypto.EntropySize)}
+	var root crypto.Hash
+	fastrand.Read(root[:])
+	if err := sf.AddPiece(pk1, 0, 1, root); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.AddPiece(pk2, 0, 1, root); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pieces can only be removed if the host, root and indices match.
+	if err := sf.RemovePiece(pk1, 0, 1, crypto.Hash{}); err == nil {
+		t.Fatal("piece with wrong root shouldn't be removed")
+	}
+	if err := sf.RemovePiece(pk1, 0, 0, root); err == nil {
+		t.Fatal("piece with wrong piece index shouldn't be removed")
+	}
+	if err := sf.RemovePiece(pk1, sf.NumChunks(), 1, root); err == nil {
+		t.Fatal("chunk index should be out of bounds")
+	}
+	if err := sf.RemovePiece(pk1, 0, 1, root); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.RemovePiece(pk1, 0, 1, root); err == nil {
+		t.Fatal("piece shouldn't be removed twice")
+	}
+
+	// Only the piece of the second host should remain after reloading the
+	// file.
+	sf2, err := LoadSiaFile(sf.siaFilePath, sf.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pieces, err := sf2.Pieces(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pieces[1]) != 1 || !bytes.Equal(pieces[1][0].HostPubKey.Key, pk2.Key) {
+		t.Fatal("unexpected pieces after removing a piece", pieces[1])
+	}
+}
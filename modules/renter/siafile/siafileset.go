@@ -96,8 +96,11 @@ func (entry *SiaFileSetEntry) close() error {
 		return ErrUnknownThread
 	}
 	delete(entry.threadMap, entry.threadUID)
-	if len(entry.threadMap) == 0 {
-		delete(entry.siaFileSet.siaFileMap, entry.HyperspacePath())
+	// The path might belong to another file already if the file was
+	// replaced.
+	path := entry.HyperspacePath()
+	if len(entry.threadMap) == 0 && entry.siaFileSet.siaFileMap[path] == entry.siaFileSetEntry {
+		delete(entry.siaFileSet.siaFileMap, path)
 	}
 	return nil
 }
@@ -122,6 +125,19 @@ func (entry *SiaFileSetEntry) ChunkEntrys() []*SiaFileSetEntry {
 	return entrys
 }
 
+// CopyEntry returns a new SiaFileSetEntry for the same file. The copy is
+// tracked as a separate thread and needs to be closed separately.
+func (entry *SiaFileSetEntry) CopyEntry() *SiaFileSetEntry {
+	entry.threadMapMu.Lock()
+	defer entry.threadMapMu.Unlock()
+	threadUID := randomThreadUID()
+	entry.threadMap[threadUID] = newThreadType()
+	return &SiaFileSetEntry{
+		siaFileSetEntry: entry.siaFileSetEntry,
+		threadUID:       threadUID,
+	}
+}
+
 // Close removes the thread from the threadMap. If the length of threadMap count
 // is 0 then it will remove the SiaFileSetEntry from the SiaFileSet map, which
 // will remove it from memory
@@ -315,7 +331,7 @@ func (sfs *SiaFileSet) NewFromFileData(fd FileData) (*SiaFileSetEntry, error) {
 			ChunkOffset:             defaultReservedMDPages * pageSize,
 			ChangeTime:              currentTime,
 			CreateTime:              currentTime,
-			StaticFileSize:          int64(fd.FileSize),
+			FileSize:                int64(fd.FileSize),
 			LocalPath:               fd.RepairPath,
 			StaticMasterKey:         mk.Key(),
 			StaticMasterKeyType:     mk.Type(),
@@ -378,6 +394,26 @@ func (sfs *SiaFileSet) NewFromFileData(fd FileData) (*SiaFileSetEntry, error) {
 // called on the SiaFileSetEntry to avoid the file being stuck in memory due the
 // thread never being removed from the threadMap
 func (sfs *SiaFileSet) NewSiaFile(up modules.FileUploadParams, masterKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode) (*SiaFileSetEntry, error) {
+	return sfs.newSiaFile(up, func(siaFilePath, siaPath string) (*SiaFile, error) {
+		sf, err := New(siaFilePath, siaPath, up.Source, sfs.wal, up.ErasureCode, masterKey, fileSize, fileMode)
+		if err != nil || !up.Dedup {
+			return sf, err
+		}
+		return sf, sf.SetDedup()
+	})
+}
+
+// NewPackedSiaFile is like NewSiaFile but creates a SiaFile for a small file
+// that is packed into the pack at packPath, starting at packOffset.
+func (sfs *SiaFileSet) NewPackedSiaFile(up modules.FileUploadParams, masterKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode, packPath string, packOffset uint64) (*SiaFileSetEntry, error) {
+	return sfs.newSiaFile(up, func(siaFilePath, siaPath string) (*SiaFile, error) {
+		return NewPacked(siaFilePath, siaPath, up.Source, sfs.wal, up.ErasureCode, masterKey, fileSize, fileMode, packPath, packOffset)
+	})
+}
+
+// newSiaFile adds the SiaFile created by newFile at the path of the upload to
+// the SiaFileSet and returns its SiaFileSetEntry.
+func (sfs *SiaFileSet) newSiaFile(up modules.FileUploadParams, newFile func(siaFilePath, siaPath string) (*SiaFile, error)) (*SiaFileSetEntry, error) {
 	sfs.mu.Lock()
 	defer sfs.mu.Unlock()
 	siaPath := strings.TrimPrefix(up.HyperspacePath, "/")
@@ -391,10 +427,15 @@ func (sfs *SiaFileSet) NewSiaFile(up modules.FileUploadParams, masterKey crypto.
 	}
 	// Make sure there are no leading slashes
 	siaFilePath := filepath.Join(sfs.siaFileDir, siaPath+ShareExtension)
-	sf, err := New(siaFilePath, siaPath, up.Source, sfs.wal, up.ErasureCode, masterKey, fileSize, fileMode)
+	sf, err := newFile(siaFilePath, siaPath)
 	if err != nil {
 		return nil, err
 	}
+	if up.ContentType != "" || len(up.Metadata) > 0 {
+		if err := sf.SetUserMetadata(up.ContentType, up.Metadata); err != nil {
+			return nil, err
+		}
+	}
 	entry := sfs.newSiaFileSetEntry(sf)
 	threadUID := randomThreadUID()
 	entry.threadMap[threadUID] = newThreadType()
@@ -450,3 +491,246 @@ func (sfs *SiaFileSet) Rename(siaPath, newHyperspacePath string) error {
 	// Rename SiaFile
 	return entry.Rename(newHyperspacePath, filepath.Join(sfs.siaFileDir, newHyperspacePath+ShareExtension))
 }
+
+// Replace atomically replaces the SiaFile at siaPath with the SiaFile at
+// newSiaPath, which is moved to siaPath. The replaced SiaFile is marked as
+// deleted.
+func (sfs *SiaFileSet) Replace(siaPath, newSiaPath string) error {
+	sfs.mu.Lock()
+	defer sfs.mu.Unlock()
+	return sfs.replace(siaPath, newSiaPath, "")
+}
+
+// Archive atomically replaces the SiaFile at siaPath with the SiaFile at
+// newSiaPath like Replace, but moves the replaced SiaFile to archivePath
+// instead of deleting it. The directory of archivePath must exist.
+func (sfs *SiaFileSet) Archive(siaPath, newSiaPath, archivePath string) error {
+	sfs.mu.Lock()
+	defer sfs.mu.Unlock()
+	archivePath = strings.TrimPrefix(archivePath, "/")
+	if exists, _ := sfs.exists(archivePath); exists {
+		return ErrPathOverload
+	}
+	return sfs.replace(siaPath, newSiaPath, archivePath)
+}
+
+// replace replaces the SiaFile at siaPath with the SiaFile at newSiaPath in a
+// single writeaheadlog transaction. The replaced SiaFile is moved to
+// archivePath, or deleted if archivePath is empty. The caller must hold the
+// lock.
+func (sfs *SiaFileSet) replace(siaPath, newSiaPath, archivePath string) error {
+	// Make sure there are no leading slashes
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	newSiaPath = strings.TrimPrefix(newSiaPath, "/")
+	// Grab the entries
+	oldEntry, err := sfs.open(siaPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		oldEntry.threadMapMu.Lock()
+		oldEntry.close()
+		oldEntry.threadMapMu.Unlock()
+	}()
+	entry, err := sfs.open(newSiaPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		entry.threadMapMu.Lock()
+		entry.close()
+		entry.threadMapMu.Unlock()
+	}()
+
+	// Delete or archive the old file and move the new file to its location
+	// in a single writeaheadlog transaction.
+	oldEntry.mu.Lock()
+	defer oldEntry.mu.Unlock()
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if oldEntry.deleted || entry.deleted {
+		return ErrUnknownPath
+	}
+	updates := []writeaheadlog.Update{oldEntry.createDeleteUpdate()}
+	if archivePath != "" {
+		updates, err = oldEntry.renameUpdates(archivePath, filepath.Join(sfs.siaFileDir, archivePath+ShareExtension))
+		if err != nil {
+			return err
+		}
+	}
+	renameUpdates, err := entry.renameUpdates(siaPath, filepath.Join(sfs.siaFileDir, siaPath+ShareExtension))
+	if err != nil {
+		return err
+	}
+	updates = append(updates, renameUpdates...)
+	txn, err := sfs.wal.NewTransaction(updates)
+	if err != nil {
+		return errors.AddContext(err, "failed to create wal txn")
+	}
+	if err := <-txn.SignalSetupComplete(); err != nil {
+		return errors.AddContext(err, "failed to signal setup completion")
+	}
+	if err := applyUpdates(modules.ProdDependencies, updates...); err != nil {
+		return errors.AddContext(err, "failed to apply updates")
+	}
+	if err := txn.SignalUpdatesApplied(); err != nil {
+		return errors.AddContext(err, "failed to signal that updates are applied")
+	}
+	// Update SiaFileSet map
+	if archivePath != "" {
+		sfs.siaFileMap[archivePath] = oldEntry.siaFileSetEntry
+	} else {
+		oldEntry.deleted = true
+	}
+	sfs.siaFileMap[siaPath] = entry.siaFileSetEntry
+	delete(sfs.siaFileMap, newSiaPath)
+	return nil
+}
+
+// walkDir opens every SiaFile below the directory at siaPath. The caller must
+// hold the lock and close the returned entries.
+func (sfs *SiaFileSet) walkDir(siaPath string) ([]*SiaFileSetEntry, error) {
+	dir := filepath.Join(sfs.siaFileDir, siaPath)
+	if fi, err := os.Stat(dir); os.IsNotExist(err) || (err == nil && !fi.IsDir()) {
+		return nil, ErrUnknownDir
+	} else if err != nil {
+		return nil, err
+	}
+	var entrys []*SiaFileSetEntry
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ShareExtension {
+			return nil
+		}
+		entry, err := sfs.open(strings.TrimSuffix(strings.TrimPrefix(path, sfs.siaFileDir), ShareExtension))
+		if err != nil {
+			return err
+		}
+		entrys = append(entrys, entry)
+		return nil
+	})
+	if err != nil {
+		for _, entry := range entrys {
+			entry.threadMapMu.Lock()
+			entry.close()
+			entry.threadMapMu.Unlock()
+		}
+		return nil, err
+	}
+	return entrys, nil
+}
+
+// DeleteDir deletes the directory at siaPath together with every SiaFile and
+// directory below it.
+func (sfs *SiaFileSet) DeleteDir(siaPath string) error {
+	sfs.mu.Lock()
+	defer sfs.mu.Unlock()
+	siaPath = strings.Trim(siaPath, "/")
+	entrys, err := sfs.walkDir(siaPath)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, entry := range entrys {
+		errs = append(errs, entry.Delete())
+		entry.threadMapMu.Lock()
+		errs = append(errs, entry.close())
+		entry.threadMapMu.Unlock()
+	}
+	if err := errors.Compose(errs...); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(sfs.siaFileDir, siaPath))
+}
+
+// RenameDir moves the directory at siaPath and everything below it to
+// newSiaPath. All SiaFiles are moved in a single writeaheadlog transaction, so
+// after a crash either all of them or none of them have been renamed.
+func (sfs *SiaFileSet) RenameDir(siaPath, newSiaPath string) error {
+	sfs.mu.Lock()
+	defer sfs.mu.Unlock()
+	siaPath = strings.Trim(siaPath, "/")
+	newSiaPath = strings.Trim(newSiaPath, "/")
+	if newSiaPath == siaPath || strings.HasPrefix(newSiaPath, siaPath+"/") {
+		return ErrMoveIntoItself
+	}
+	oldDir := filepath.Join(sfs.siaFileDir, siaPath)
+	newDir := filepath.Join(sfs.siaFileDir, newSiaPath)
+	if _, err := os.Stat(newDir); err == nil {
+		return ErrPathOverload
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	entrys, err := sfs.walkDir(siaPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, entry := range entrys {
+			entry.threadMapMu.Lock()
+			entry.close()
+			entry.threadMapMu.Unlock()
+		}
+	}()
+
+	// Recreate the directory tree at the new location.
+	err = filepath.Walk(oldDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		return os.MkdirAll(filepath.Join(newDir, strings.TrimPrefix(path, oldDir)), 0700)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Lock the files so that no other updates are applied to them while they
+	// are moved, and collect the updates that move them.
+	var updates []writeaheadlog.Update
+	for _, entry := range entrys {
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		if entry.deleted {
+			continue
+		}
+		oldPath := entry.staticMetadata.HyperspacePath
+		newPath := newSiaPath + strings.TrimPrefix(oldPath, siaPath)
+		u, err := entry.renameUpdates(newPath, filepath.Join(sfs.siaFileDir, newPath+ShareExtension))
+		if err != nil {
+			return err
+		}
+		updates = append(updates, u...)
+		delete(sfs.siaFileMap, oldPath)
+	}
+	for _, entry := range entrys {
+		sfs.siaFileMap[entry.staticMetadata.HyperspacePath] = entry.siaFileSetEntry
+	}
+	txn, err := sfs.wal.NewTransaction(updates)
+	if err != nil {
+		return errors.AddContext(err, "failed to create wal txn")
+	}
+	if err := <-txn.SignalSetupComplete(); err != nil {
+		return errors.AddContext(err, "failed to signal setup completion")
+	}
+	if err := applyUpdates(modules.ProdDependencies, updates...); err != nil {
+		return errors.AddContext(err, "failed to apply updates")
+	}
+	if err := txn.SignalUpdatesApplied(); err != nil {
+		return errors.AddContext(err, "failed to signal that updates are applied")
+	}
+
+	// Move the remaining files, such as directory metadata, and remove the
+	// old directory tree.
+	err = filepath.Walk(oldDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return os.Rename(path, filepath.Join(newDir, strings.TrimPrefix(path, oldDir)))
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(oldDir)
+}
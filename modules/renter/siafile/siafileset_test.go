@@ -281,3 +281,248 @@ func TestDeleteFileInMemory(t *testing.T) {
 		t.Fatal("Expected 0 files in memory, got:", len(sfs.siaFileMap))
 	}
 }
+
+// TestSiaFileSetRenameDeleteDir probes renaming and deleting directories of
+// a SiaFileSet.
+func TestSiaFileSetRenameDeleteDir(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	dir := filepath.Join(os.TempDir(), "siafiles", t.Name())
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	wal, _ := newTestWAL()
+	sfs := NewSiaFileSet(dir, wal)
+
+	// Create a file in a directory and one in a subdirectory.
+	siaPaths := []string{"foo/a", "foo/bar/b"}
+	for _, siaPath := range siaPaths {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, siaPath)), 0700); err != nil {
+			t.Fatal(err)
+		}
+		_, _, source, rc, sk, fileSize, _, fileMode := newTestFileParams()
+		up := modules.FileUploadParams{
+			Source:         source,
+			HyperspacePath: siaPath,
+			ErasureCode:    rc,
+		}
+		entry, err := sfs.NewSiaFile(up, sk, fileSize, fileMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Keep the first file open to make sure open files are renamed too.
+		if siaPath != siaPaths[0] {
+			if err := entry.Close(); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			defer entry.Close()
+		}
+	}
+
+	// Renaming a directory into itself or onto an existing directory fails.
+	if err := sfs.RenameDir("foo", "foo/bar/baz"); err != ErrMoveIntoItself {
+		t.Fatal("expected ErrMoveIntoItself, got", err)
+	}
+	if err := sfs.RenameDir("foo/bar", "foo"); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+	if err := sfs.RenameDir("missing", "other"); err != ErrUnknownDir {
+		t.Fatal("expected ErrUnknownDir, got", err)
+	}
+
+	// Rename the directory.
+	if err := sfs.RenameDir("foo", "qux/foo"); err != nil {
+		t.Fatal(err)
+	}
+	for _, siaPath := range siaPaths {
+		if exists, _ := sfs.Exists(siaPath); exists {
+			t.Fatal("file still exists at its old path", siaPath)
+		}
+		entry, err := sfs.Open("qux/" + siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.HyperspacePath() != "qux/"+siaPath {
+			t.Fatal("wrong siapath", entry.HyperspacePath())
+		}
+		if err := entry.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "foo")); !os.IsNotExist(err) {
+		t.Fatal("old directory still exists", err)
+	}
+
+	// Delete the directory.
+	if err := sfs.DeleteDir("qux"); err != nil {
+		t.Fatal(err)
+	}
+	for _, siaPath := range siaPaths {
+		if _, err := sfs.Open("qux/" + siaPath); err == nil {
+			t.Fatal("file can still be opened after deleting its directory", siaPath)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "qux")); !os.IsNotExist(err) {
+		t.Fatal("deleted directory still exists", err)
+	}
+	if err := sfs.DeleteDir("qux"); err != ErrUnknownDir {
+		t.Fatal("expected ErrUnknownDir, got", err)
+	}
+}
+
+// TestSiaFileSetReplace tests that a SiaFile can be replaced by another one
+// while it is open.
+func TestSiaFileSetReplace(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	dir := filepath.Join(os.TempDir(), "siafiles", t.Name())
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	wal, _ := newTestWAL()
+	sfs := NewSiaFileSet(dir, wal)
+
+	// Create the file and its replacement with different erasure codes.
+	newFile := func(siaPath string, ec modules.ErasureCoder) *SiaFileSetEntry {
+		_, _, source, _, sk, fileSize, _, fileMode := newTestFileParams()
+		up := modules.FileUploadParams{
+			Source:         source,
+			HyperspacePath: siaPath,
+			ErasureCode:    ec,
+		}
+		entry, err := sfs.NewSiaFile(up, sk, fileSize, fileMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+	ec1, _ := NewRSCode(1, 2)
+	ec2, _ := NewRSCode(2, 4)
+	old := newFile("foo", ec1)
+	replacement := newFile("foo.new", ec2)
+
+	// Replace the file while both files are open.
+	if err := sfs.Replace("foo", "foo.new"); err != nil {
+		t.Fatal(err)
+	}
+	if !old.Deleted() {
+		t.Fatal("replaced file should be deleted")
+	}
+	if exists, _ := sfs.Exists("foo.new"); exists {
+		t.Fatal("replacement shouldn't exist at its old path")
+	}
+
+	// Closing the replaced file shouldn't remove the replacement from memory.
+	if err := old.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sfs.siaFileMap) != 1 {
+		t.Fatal("replacement was removed from memory")
+	}
+	entry, err := sfs.Open("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ErasureCode().NumPieces() != ec2.NumPieces() || entry.HyperspacePath() != "foo" {
+		t.Fatal("file wasn't replaced")
+	}
+	if err := entry.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := replacement.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replacement should be loaded from disk after it left memory.
+	if len(sfs.siaFileMap) != 0 {
+		t.Fatal("files weren't removed from memory", len(sfs.siaFileMap))
+	}
+	entry, err = sfs.Open("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	if entry.ErasureCode().NumPieces() != ec2.NumPieces() {
+		t.Fatal("replacement wasn't persisted")
+	}
+}
+
+// TestSiaFileSetArchive tests that a SiaFile can be replaced by another one
+// while keeping the replaced SiaFile at a new path.
+func TestSiaFileSetArchive(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	dir := filepath.Join(os.TempDir(), "siafiles", t.Name())
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	wal, _ := newTestWAL()
+	sfs := NewSiaFileSet(dir, wal)
+
+	newFile := func(siaPath string, ec modules.ErasureCoder) *SiaFileSetEntry {
+		_, _, source, _, sk, fileSize, _, fileMode := newTestFileParams()
+		up := modules.FileUploadParams{
+			Source:         source,
+			HyperspacePath: siaPath,
+			ErasureCode:    ec,
+		}
+		entry, err := sfs.NewSiaFile(up, sk, fileSize, fileMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+	ec1, _ := NewRSCode(1, 2)
+	ec2, _ := NewRSCode(2, 4)
+	old := newFile("foo", ec1)
+	replacement := newFile("foo.new", ec2)
+	taken := newFile("taken", ec1)
+
+	// The replaced file can't be moved onto another file.
+	if err := sfs.Archive("foo", "foo.new", "taken"); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+
+	// Archive the file while both files are open.
+	if err := sfs.Archive("foo", "foo.new", "foo.old"); err != nil {
+		t.Fatal(err)
+	}
+	if old.Deleted() || old.HyperspacePath() != "foo.old" {
+		t.Fatal("replaced file wasn't moved", old.Deleted(), old.HyperspacePath())
+	}
+	if exists, _ := sfs.Exists("foo.new"); exists {
+		t.Fatal("replacement shouldn't exist at its old path")
+	}
+	for _, entry := range []*SiaFileSetEntry{old, replacement, taken} {
+		if err := entry.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both files should be loaded from disk at their new paths.
+	if len(sfs.siaFileMap) != 0 {
+		t.Fatal("files weren't removed from memory", len(sfs.siaFileMap))
+	}
+	for siaPath, ec := range map[string]modules.ErasureCoder{"foo": ec2, "foo.old": ec1} {
+		entry, err := sfs.Open(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.ErasureCode().NumPieces() != ec.NumPieces() || entry.HyperspacePath() != siaPath {
+			t.Fatal("unexpected file at", siaPath)
+		}
+		if err := entry.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -12,14 +12,28 @@ type (
 	// can be accessed without locking at the cost of being a frozen readonly
 	// representation of a siafile which only exists in memory.
 	Snapshot struct {
-		staticChunks      []Chunk
-		staticFileSize    int64
-		staticPieceSize   uint64
-		staticErasureCode modules.ErasureCoder
-		staticMasterKey   crypto.CipherKey
-		staticMode        os.FileMode
-		staticPubKeyTable []HostPublicKey
-		staticHyperspacePath     string
+		staticChunks         []Chunk
+		staticFileSize       int64
+		staticPieceSize      uint64
+		staticErasureCode    modules.ErasureCoder
+		staticMasterKey      crypto.CipherKey
+		staticMode           os.FileMode
+		staticPubKeyTable    []HostPublicKey
+		staticHyperspacePath string
+
+		// The snapshot of a packed file contains the chunks of its pack.
+		// staticOffset is the offset of the file's data within those chunks
+		// and staticLocalPath is the local copy of the pack's data.
+		staticOffset    uint64
+		staticLocalPath string
+		staticPackPath  string
+
+		// staticDedupIDs are the dedup ids of the deduplicated chunks.
+		staticDedupIDs map[uint64]crypto.Hash
+
+		// The checksums of the file and its chunks.
+		staticChecksum       crypto.Hash
+		staticChunkChecksums map[uint64]crypto.Hash
 	}
 )
 
@@ -27,6 +41,7 @@ type (
 // offset of a file and also the relative offset within the chunk. If the
 // offset is out of bounds, chunkIndex will be equal to NumChunk().
 func (s *Snapshot) ChunkIndexByOffset(offset uint64) (chunkIndex uint64, off uint64) {
+	offset += s.staticOffset
 	chunkIndex = offset / s.ChunkSize()
 	off = offset % s.ChunkSize()
 	return
@@ -42,6 +57,13 @@ func (s *Snapshot) ErasureCode() modules.ErasureCoder {
 	return s.staticErasureCode
 }
 
+// LocalPath returns the path of a local copy of the data of the snapshot's
+// chunks. It is only set for packed files, whose packs might not be uploaded
+// yet.
+func (s *Snapshot) LocalPath() string {
+	return s.staticLocalPath
+}
+
 // MasterKey returns the masterkey used to encrypt the file.
 func (s *Snapshot) MasterKey() crypto.CipherKey {
 	return s.staticMasterKey
@@ -59,6 +81,12 @@ func (s *Snapshot) NumChunks() uint64 {
 	return uint64(len(s.staticChunks))
 }
 
+// PackPath returns the hyperspace path of the pack whose chunks the snapshot
+// contains, or the empty string if the file isn't packed.
+func (s *Snapshot) PackPath() string {
+	return s.staticPackPath
+}
+
 // Pieces returns all the pieces for a chunk in a slice of slices that contains
 // all the pieces for a certain index.
 func (s *Snapshot) Pieces(chunkIndex uint64) ([][]Piece, error) {
@@ -110,14 +138,45 @@ func (sf *SiaFile) Snapshot() *Snapshot {
 		})
 	}
 
+	// Copy dedup ids.
+	dedupIDs := make(map[uint64]crypto.Hash, len(sf.staticMetadata.DedupIDs))
+	for chunkIndex, id := range sf.staticMetadata.DedupIDs {
+		dedupIDs[chunkIndex] = id
+	}
+
+	// Copy chunk checksums.
+	chunkChecksums := make(map[uint64]crypto.Hash, len(sf.staticMetadata.ChunkChecksums))
+	for chunkIndex, checksum := range sf.staticMetadata.ChunkChecksums {
+		chunkChecksums[chunkIndex] = checksum
+	}
+
 	return &Snapshot{
-		staticChunks:      chunks,
-		staticFileSize:    sf.staticMetadata.StaticFileSize,
-		staticPieceSize:   sf.staticMetadata.StaticPieceSize,
-		staticErasureCode: sf.staticMetadata.staticErasureCode,
-		staticMasterKey:   mk,
-		staticMode:        sf.staticMetadata.Mode,
-		staticPubKeyTable: pkt,
-		staticHyperspacePath:     sf.staticMetadata.HyperspacePath,
+		staticChunks:         chunks,
+		staticChecksum:       sf.staticMetadata.Checksum,
+		staticChunkChecksums: chunkChecksums,
+		staticDedupIDs:       dedupIDs,
+		staticFileSize:       sf.staticMetadata.FileSize,
+		staticPieceSize:      sf.staticMetadata.StaticPieceSize,
+		staticErasureCode:    sf.staticMetadata.staticErasureCode,
+		staticMasterKey:      mk,
+		staticMode:           sf.staticMetadata.Mode,
+		staticPubKeyTable:    pkt,
+		staticHyperspacePath: sf.staticMetadata.HyperspacePath,
 	}
 }
+
+// PackedSnapshot creates a snapshot of a packed file. The snapshot contains
+// the chunks of the file's pack, which needs to be passed in.
+func (sf *SiaFile) PackedSnapshot(pack *SiaFile) *Snapshot {
+	s := pack.Snapshot()
+	s.staticLocalPath = pack.LocalPath()
+	s.staticPackPath = pack.HyperspacePath()
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	s.staticFileSize = sf.staticMetadata.FileSize
+	s.staticMode = sf.staticMetadata.Mode
+	s.staticHyperspacePath = sf.staticMetadata.HyperspacePath
+	s.staticOffset = sf.staticMetadata.PackOffset
+	s.staticChecksum = sf.staticMetadata.Checksum
+	return s
+}
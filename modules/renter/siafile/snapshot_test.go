@@ -20,9 +20,9 @@ func TestSnapshot(t *testing.T) {
 	if len(sf.staticChunks) != len(snap.staticChunks) {
 		t.Errorf("expected %v chunks but got %v", len(sf.staticChunks), len(snap.staticChunks))
 	}
-	if sf.staticMetadata.StaticFileSize != snap.staticFileSize {
+	if sf.staticMetadata.FileSize != snap.staticFileSize {
 		t.Errorf("staticFileSize was %v but should be %v",
-			snap.staticFileSize, sf.staticMetadata.StaticFileSize)
+			snap.staticFileSize, sf.staticMetadata.FileSize)
 	}
 	if sf.staticMetadata.StaticPieceSize != snap.staticPieceSize {
 		t.Errorf("staticPieceSize was %v but should be %v",
@@ -63,3 +63,66 @@ func TestSnapshot(t *testing.T) {
 		}
 	}
 }
+
+// TestPackedSnapshot tests that the snapshot of a packed file contains the
+// chunks of its pack and maps the file's offsets into the pack.
+func TestPackedSnapshot(t *testing.T) {
+	t.Parallel()
+
+	// Create a pack and a small file that is packed into it.
+	pack, wal, _ := newBlankTestFileAndWAL()
+	siaFilePath, siaPath, source, rc, sk, _, _, fileMode := newTestFileParams()
+	packOffset := pack.ChunkSize() + 100
+	sf, err := NewPacked(siaFilePath, siaPath, source, wal, rc, sk, 1000, fileMode, pack.HyperspacePath(), packOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf.NumChunks() != 0 {
+		t.Fatal("packed file shouldn't have chunks of its own")
+	}
+	if sf.PackPath() != pack.HyperspacePath() || sf.PackOffset() != packOffset {
+		t.Fatal("pack wasn't set correctly")
+	}
+
+	// The pack is persisted with the file.
+	loaded, err := LoadSiaFile(siaFilePath, wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.PackPath() != pack.HyperspacePath() || loaded.PackOffset() != packOffset || loaded.NumChunks() != 0 {
+		t.Fatal("pack wasn't loaded correctly")
+	}
+
+	// The snapshot contains the chunks of the pack but the size and path of
+	// the file.
+	snap := sf.PackedSnapshot(pack)
+	if snap.NumChunks() != pack.NumChunks() {
+		t.Fatalf("expected %v chunks but got %v", pack.NumChunks(), snap.NumChunks())
+	}
+	if snap.Size() != 1000 || snap.HyperspacePath() != siaPath {
+		t.Fatal("snapshot has the wrong size or path")
+	}
+	if snap.LocalPath() != pack.LocalPath() || snap.PackPath() != pack.HyperspacePath() {
+		t.Fatal("snapshot has the wrong local path or pack path")
+	}
+	chunkIndex, off := snap.ChunkIndexByOffset(10)
+	if chunkIndex != 1 || off != 110 {
+		t.Fatalf("offset 10 was mapped to chunk %v offset %v", chunkIndex, off)
+	}
+
+	// Move the file to another pack.
+	if err := sf.SetPack("otherpack", 42); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = LoadSiaFile(siaFilePath, wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.PackPath() != "otherpack" || loaded.PackOffset() != 42 {
+		t.Fatal("pack wasn't updated")
+	}
+	// Files that aren't packed can't be moved into a pack.
+	if err := pack.SetPack("otherpack", 0); err == nil {
+		t.Fatal("unpacked file was moved into a pack")
+	}
+}
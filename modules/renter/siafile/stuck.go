@@ -0,0 +1,172 @@
+package siafile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/HyperspaceApp/errors"
+)
+
+// A chunk's stuck state is stored in its ExtensionInfo. The first byte holds
+// the flags, the second byte the reason the chunk is stuck, the following 8
+// bytes the unix timestamp of the last failed repair attempt and the next byte
+// the number of repair attempts that failed in a row.
+const (
+	extensionStuckFlag      = 1 << 0
+	extensionFlagsOffset    = 0
+	extensionReasonOffset   = 1
+	extensionAttemptOffset  = 2
+	extensionFailuresOffset = 10
+)
+
+// StuckReason explains why a chunk could not be repaired to full redundancy.
+type StuckReason uint8
+
+const (
+	// StuckReasonNone is the reason of chunks that are not stuck.
+	StuckReasonNone StuckReason = iota
+
+	// StuckReasonNoHosts means that there were not enough hosts that accepted
+	// the chunk's pieces.
+	StuckReasonNoHosts
+
+	// StuckReasonAllowance means that the contracts ran out of funds while
+	// uploading the chunk's pieces.
+	StuckReasonAllowance
+
+	// StuckReasonUnrecoverable means that the local file is missing and there
+	// are not enough pieces on the network to recover the chunk.
+	StuckReasonUnrecoverable
+
+	// StuckReasonFetchFailed means that the chunk could neither be read from
+	// the local file nor downloaded from the network.
+	StuckReasonFetchFailed
+)
+
+// String implements the fmt.Stringer interface.
+func (sr StuckReason) String() string {
+	switch sr {
+	case StuckReasonNone:
+		return ""
+	case StuckReasonNoHosts:
+		return "not enough hosts accepted the chunk's pieces"
+	case StuckReasonAllowance:
+		return "contracts ran out of funds during the upload"
+	case StuckReasonUnrecoverable:
+		return "local file is missing and not enough pieces are on the network to recover the chunk"
+	case StuckReasonFetchFailed:
+		return "chunk could not be read from disk or downloaded from the network"
+	default:
+		return fmt.Sprintf("unknown reason %d", uint8(sr))
+	}
+}
+
+// isStuck returns whether the chunk is stuck.
+func (c *chunk) isStuck() bool {
+	return c.ExtensionInfo[extensionFlagsOffset]&extensionStuckFlag != 0
+}
+
+// NumStuckChunks returns the number of stuck chunks of the file.
+func (sf *SiaFile) NumStuckChunks() (n uint64) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	for i := range sf.staticChunks {
+		if sf.staticChunks[i].isStuck() {
+			n++
+		}
+	}
+	return n
+}
+
+// StuckChunk returns whether the chunk at chunkIndex is stuck, the reason it
+// is stuck and the time of the last failed attempt to repair it.
+func (sf *SiaFile) StuckChunk(chunkIndex uint64) (stuck bool, reason StuckReason, lastAttempt time.Time) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	if chunkIndex >= uint64(len(sf.staticChunks)) {
+		return false, StuckReasonNone, time.Time{}
+	}
+	ei := sf.staticChunks[chunkIndex].ExtensionInfo
+	if ei[extensionFlagsOffset]&extensionStuckFlag == 0 {
+		return false, StuckReasonNone, time.Time{}
+	}
+	timestamp := int64(binary.LittleEndian.Uint64(ei[extensionAttemptOffset:]))
+	return true, StuckReason(ei[extensionReasonOffset]), time.Unix(timestamp, 0)
+}
+
+// SetStuck marks the chunk at chunkIndex as stuck for the given reason, or
+// as not stuck if stuck is false. Marking a chunk as stuck also records the
+// time of the failed attempt.
+func (sf *SiaFile) SetStuck(chunkIndex uint64, stuck bool, reason StuckReason) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	// If the file was deleted we can't change its chunks since it would write
+	// the file to disk again.
+	if sf.deleted {
+		return errors.New("can't set stuck state of a chunk of a deleted file")
+	}
+	if chunkIndex >= uint64(len(sf.staticChunks)) {
+		return fmt.Errorf("chunkIndex %v out of bounds (%v)", chunkIndex, len(sf.staticChunks))
+	}
+	chunk := &sf.staticChunks[chunkIndex]
+	ei := &chunk.ExtensionInfo
+	if !stuck && !chunk.isStuck() && ei[extensionFailuresOffset] == 0 {
+		return nil
+	}
+	if stuck {
+		ei[extensionFlagsOffset] |= extensionStuckFlag
+		ei[extensionReasonOffset] = byte(reason)
+		binary.LittleEndian.PutUint64(ei[extensionAttemptOffset:], uint64(time.Now().Unix()))
+	} else {
+		ei[extensionFlagsOffset] &^= extensionStuckFlag
+		ei[extensionReasonOffset] = byte(StuckReasonNone)
+		binary.LittleEndian.PutUint64(ei[extensionAttemptOffset:], 0)
+		ei[extensionFailuresOffset] = 0
+	}
+	update, err := sf.saveChunkUpdate(int(chunkIndex))
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(update)
+}
+
+// RepairFailures returns the number of repair attempts of the chunk at
+// chunkIndex that failed in a row.
+func (sf *SiaFile) RepairFailures(chunkIndex uint64) uint8 {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	if chunkIndex >= uint64(len(sf.staticChunks)) {
+		return 0
+	}
+	return sf.staticChunks[chunkIndex].ExtensionInfo[extensionFailuresOffset]
+}
+
+// RepairFailed records a failed attempt to repair the chunk at chunkIndex.
+// The chunk is marked as stuck for the given reason once maxFailures attempts
+// failed in a row. The returned bool indicates whether the chunk is stuck.
+func (sf *SiaFile) RepairFailed(chunkIndex uint64, reason StuckReason, maxFailures uint8) (bool, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if sf.deleted {
+		return false, errors.New("can't record a failed repair of a chunk of a deleted file")
+	}
+	if chunkIndex >= uint64(len(sf.staticChunks)) {
+		return false, fmt.Errorf("chunkIndex %v out of bounds (%v)", chunkIndex, len(sf.staticChunks))
+	}
+	chunk := &sf.staticChunks[chunkIndex]
+	ei := &chunk.ExtensionInfo
+	if ei[extensionFailuresOffset] < 255 {
+		ei[extensionFailuresOffset]++
+	}
+	if ei[extensionFailuresOffset] >= maxFailures {
+		ei[extensionFlagsOffset] |= extensionStuckFlag
+		ei[extensionReasonOffset] = byte(reason)
+		binary.LittleEndian.PutUint64(ei[extensionAttemptOffset:], uint64(time.Now().Unix()))
+	}
+	update, err := sf.saveChunkUpdate(int(chunkIndex))
+	if err != nil {
+		return false, err
+	}
+	return chunk.isStuck(), sf.createAndApplyTransaction(update)
+}
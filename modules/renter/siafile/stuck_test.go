@@ -0,0 +1,103 @@
+package siafile
+
+import (
+	"testing"
+	"time"
+)
+
+// TestStuckChunks tests marking chunks as stuck and persisting the stuck state.
+func TestStuckChunks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	sf := newBlankTestFile()
+	if sf.NumChunks() < 2 {
+		t.Fatal("test requires a file with at least 2 chunks")
+	}
+	if n := sf.NumStuckChunks(); n != 0 {
+		t.Fatal("new file shouldn't have stuck chunks, got", n)
+	}
+
+	// Mark the first chunk as stuck.
+	before := time.Now().Add(-time.Second)
+	if err := sf.SetStuck(0, true, StuckReasonNoHosts); err != nil {
+		t.Fatal(err)
+	}
+	stuck, reason, lastAttempt := sf.StuckChunk(0)
+	if !stuck || reason != StuckReasonNoHosts || lastAttempt.Before(before) {
+		t.Fatal("unexpected stuck state", stuck, reason, lastAttempt)
+	}
+	if stuck, _, _ := sf.StuckChunk(1); stuck {
+		t.Fatal("second chunk shouldn't be stuck")
+	}
+	if n := sf.NumStuckChunks(); n != 1 {
+		t.Fatal("expected 1 stuck chunk, got", n)
+	}
+	if err := sf.SetStuck(sf.NumChunks(), true, StuckReasonNoHosts); err == nil {
+		t.Fatal("expected error for out of bounds chunk")
+	}
+
+	// The stuck state should survive reloading the file.
+	sf2, err := LoadSiaFile(sf.siaFilePath, sf.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stuck2, reason2, lastAttempt2 := sf2.StuckChunk(0)
+	if !stuck2 || reason2 != reason || lastAttempt2.Unix() != lastAttempt.Unix() {
+		t.Fatal("stuck state wasn't persisted", stuck2, reason2, lastAttempt2)
+	}
+
+	// Unstick the chunk again.
+	if err := sf2.SetStuck(0, false, StuckReasonNone); err != nil {
+		t.Fatal(err)
+	}
+	if stuck, reason, lastAttempt := sf2.StuckChunk(0); stuck || reason != StuckReasonNone || !lastAttempt.IsZero() {
+		t.Fatal("chunk should no longer be stuck", stuck, reason, lastAttempt)
+	}
+	if n := sf2.NumStuckChunks(); n != 0 {
+		t.Fatal("expected no stuck chunks, got", n)
+	}
+}
+
+// TestRepairFailed tests that chunks are only marked as stuck after repeated
+// failed repair attempts.
+func TestRepairFailed(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	sf := newBlankTestFile()
+
+	// The first failures only count.
+	for i := uint8(1); i < 3; i++ {
+		stuck, err := sf.RepairFailed(0, StuckReasonNoHosts, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stuck || sf.NumStuckChunks() != 0 || sf.RepairFailures(0) != i {
+			t.Fatal("chunk shouldn't be stuck after", i, "failures")
+		}
+	}
+	stuck, err := sf.RepairFailed(0, StuckReasonAllowance, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, reason, _ := sf.StuckChunk(0); !stuck || reason != StuckReasonAllowance {
+		t.Fatal("chunk should be stuck after 3 failures", stuck, reason)
+	}
+
+	// The failures survive reloading the file, and a successful repair
+	// resets them.
+	sf2, err := LoadSiaFile(sf.siaFilePath, sf.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf2.RepairFailures(0) != 3 {
+		t.Fatal("failures weren't persisted", sf2.RepairFailures(0))
+	}
+	if err := sf2.SetStuck(0, false, StuckReasonNone); err != nil {
+		t.Fatal(err)
+	}
+	if sf2.RepairFailures(0) != 0 || sf2.NumStuckChunks() != 0 {
+		t.Fatal("chunk should be reset")
+	}
+}
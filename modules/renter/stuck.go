@@ -0,0 +1,160 @@
+package renter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+// stuckStatus returns the number of stuck chunks of a file and the reason of
+// the chunk whose repair failed most recently.
+func stuckStatus(entry *siafile.SiaFileSetEntry) (uint64, string) {
+	numStuckChunks := entry.NumStuckChunks()
+	if numStuckChunks == 0 {
+		return 0, ""
+	}
+	var reason siafile.StuckReason
+	var latest time.Time
+	for i := uint64(0); i < entry.NumChunks(); i++ {
+		stuck, r, lastAttempt := entry.StuckChunk(i)
+		if stuck && !lastAttempt.Before(latest) {
+			reason, latest = r, lastAttempt
+		}
+	}
+	return numStuckChunks, reason.String()
+}
+
+// managedDropFailedChunk records a failed repair attempt of a chunk that can't
+// be repaired right now and removes it from the set of active chunks. The
+// chunk is marked as stuck once repeated attempts failed.
+func (r *Renter) managedDropFailedChunk(uc *unfinishedUploadChunk, reason siafile.StuckReason) {
+	if _, err := uc.fileEntry.RepairFailed(uc.index, reason, stuckChunkMaxFailures); err != nil {
+		r.log.Debugln("WARN: could not record the failed repair of a chunk:", err)
+	}
+	if err := uc.fileEntry.Close(); err != nil {
+		r.log.Debugln("WARN: Could not close thread:", err)
+	}
+	r.uploadHeap.mu.Lock()
+	delete(r.uploadHeap.activeChunks, uc.id)
+	r.uploadHeap.mu.Unlock()
+	uc.mu.Lock()
+	uc.stuckReason = reason
+	uc.notifyAvailable()
+	uc.mu.Unlock()
+}
+
+// managedAddStuckChunksToHeap adds the stuck chunks of the files in the
+// directories that need to be repaired to the upload heap. Stuck chunks are
+// downloaded from the network if the local file is not available.
+func (r *Renter) managedAddStuckChunksToHeap(hosts map[string]struct{}) {
+	dirs, err := r.managedDirsToRepair()
+	if err != nil {
+		r.log.Println("WARN: Could not find the directories to repair:", err)
+		return
+	}
+	for _, dir := range dirs {
+		_, files, err := r.managedDirContents(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			r.uploadHeap.mu.Lock()
+			heapLen := r.uploadHeap.heap.Len()
+			r.uploadHeap.mu.Unlock()
+			if heapLen >= maxUploadHeapChunks {
+				return
+			}
+			entry, err := r.staticFileSet.Open(file)
+			if err != nil {
+				continue
+			}
+			if entry.NumStuckChunks() > 0 && !r.uploadHeap.managedIsStreaming(entry.UID()) && !r.managedIsOpenPack(entry.UID()) {
+				id := r.mu.Lock()
+				stuckChunks := r.buildUnfinishedChunks(entry.ChunkEntrys(), hosts, true)
+				r.mu.Unlock(id)
+				for _, uuc := range stuckChunks {
+					r.uploadHeap.managedPush(uuc)
+				}
+			}
+			if err := entry.Close(); err != nil {
+				r.log.Debugln("WARN: Could not close thread:", err)
+			}
+		}
+	}
+}
+
+// threadedStuckLoop is a background thread that periodically retries the
+// repair of the chunks that are stuck.
+func (r *Renter) threadedStuckLoop() {
+	err := r.tg.Add()
+	if err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	for {
+		select {
+		case <-time.After(stuckChunkRetryInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+
+		// Wait until the renter is online to proceed.
+		if !r.managedBlockUntilOnline() {
+			return
+		}
+		hosts := r.managedRefreshHostsAndWorkers()
+		r.managedAddStuckChunksToHeap(hosts)
+		select {
+		case r.uploadHeap.newUploads <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// StuckFiles returns the files that have chunks which the renter could not
+// repair to full redundancy, together with the reason why.
+func (r *Renter) StuckFiles() ([]modules.StuckFileInfo, error) {
+	entrys, err := r.staticFileSet.All()
+	if err != nil {
+		return nil, err
+	}
+	pks := make(map[string]types.SiaPublicKey)
+	for _, entry := range entrys {
+		for _, pk := range entry.HostPublicKeys() {
+			pks[string(pk.Key)] = pk
+		}
+	}
+	offline, goodForRenew, _ := r.managedContractStatus(pks)
+
+	files := []modules.StuckFileInfo{}
+	for _, entry := range entrys {
+		if entry.NumStuckChunks() > 0 && !isHiddenPath(entry.HyperspacePath()) {
+			sfi := modules.StuckFileInfo{
+				HyperspacePath: entry.HyperspacePath(),
+				Redundancy:     entry.Redundancy(offline, goodForRenew),
+			}
+			for i := uint64(0); i < entry.NumChunks(); i++ {
+				stuck, reason, lastAttempt := entry.StuckChunk(i)
+				if stuck {
+					sfi.Chunks = append(sfi.Chunks, modules.StuckChunkInfo{
+						Index:       i,
+						LastAttempt: lastAttempt,
+						Reason:      reason.String(),
+					})
+				}
+			}
+			files = append(files, sfi)
+		}
+		if err := entry.Close(); err != nil {
+			r.log.Debugln("WARN: Could not close thread:", err)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].HyperspacePath < files[j].HyperspacePath
+	})
+	return files, nil
+}
@@ -0,0 +1,104 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+)
+
+// newFailedUploadChunk returns an unfinished chunk of entry whose upload is
+// done without a single piece having been uploaded.
+func newFailedUploadChunk(entry *siafile.SiaFileSetEntry) *unfinishedUploadChunk {
+	return &unfinishedUploadChunk{
+		id: uploadChunkID{
+			fileUID: entry.UID(),
+			index:   0,
+		},
+		fileEntry:     entry.CopyEntry(),
+		index:         0,
+		piecesNeeded:  entry.ErasureCode().NumPieces(),
+		minimumPieces: entry.ErasureCode().MinPieces(),
+		availableChan: make(chan struct{}),
+	}
+}
+
+// TestChunkStuckAfterRepeatedFailures tests that a chunk is only marked as
+// stuck once several repair attempts failed in a row, and that a successful
+// repair resets the failures.
+func TestChunkStuckAfterRepeatedFailures(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	entry, err := rt.renter.newRenterTestFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+
+	// Uploads that complete without reaching full redundancy count as failed
+	// attempts.
+	for i := uint8(1); i <= stuckChunkMaxFailures; i++ {
+		uc := newFailedUploadChunk(entry)
+		rt.renter.managedCleanUpUploadChunk(uc)
+		if !uc.available {
+			t.Fatal("streaming uploads should be notified")
+		}
+		stuck, reason, _ := entry.StuckChunk(0)
+		if i < stuckChunkMaxFailures && stuck {
+			t.Fatal("chunk is stuck after", i, "failed attempts")
+		} else if i == stuckChunkMaxFailures && (!stuck || reason != siafile.StuckReasonNoHosts) {
+			t.Fatal("chunk isn't stuck after", i, "failed attempts", reason)
+		}
+	}
+
+	// A complete upload unsticks the chunk.
+	uc := newFailedUploadChunk(entry)
+	uc.piecesCompleted = uc.piecesNeeded
+	rt.renter.managedCleanUpUploadChunk(uc)
+	if stuck, _, _ := entry.StuckChunk(0); stuck || entry.RepairFailures(0) != 0 {
+		t.Fatal("complete chunk should be reset")
+	}
+}
+
+// TestDropFailedChunk tests that chunks dropped by the upload loop for lack
+// of workers only become stuck after repeated attempts, and that building the
+// chunks of a file without enough workers doesn't mark them as stuck.
+func TestDropFailedChunk(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	entry, err := rt.renter.newRenterTestFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+
+	// The renter has no workers, so the chunks aren't repaired, but no
+	// attempt was made either.
+	id := rt.renter.mu.Lock()
+	chunks := rt.renter.buildUnfinishedChunks(entry.ChunkEntrys(), make(map[string]struct{}), false)
+	rt.renter.mu.Unlock(id)
+	if len(chunks) != 0 {
+		t.Fatal("expected no chunks without workers, got", len(chunks))
+	}
+	if n := entry.NumStuckChunks(); n != 0 {
+		t.Fatal("chunks shouldn't be stuck without an attempt, got", n)
+	}
+
+	for i := uint8(1); i <= stuckChunkMaxFailures; i++ {
+		rt.renter.managedDropFailedChunk(newFailedUploadChunk(entry), siafile.StuckReasonNoHosts)
+		if stuck, _, _ := entry.StuckChunk(0); stuck != (i == stuckChunkMaxFailures) {
+			t.Fatal("unexpected stuck state after", i, "failed attempts:", stuck)
+		}
+	}
+}
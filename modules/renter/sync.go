@@ -0,0 +1,573 @@
+package renter
+
+// sync.go implements sync jobs, which continuously upload the files of a local
+// directory to a renter directory. Every job scans its local directory
+// periodically and whenever the watcher of the job reports changes. The
+// watcher is implemented with inotify on Linux; on other operating systems
+// changes are only detected by the periodic rescans.
+//
+// The state of every synced file is persisted: its size, modification time and
+// content hash when it was last uploaded. A file is only hashed if its size or
+// modification time changed, and only uploaded again if its hash changed as
+// well, so restarting the renter or touching a file doesn't upload it again.
+// Changed files are uploaded using Force, so the previous upload is kept as a
+// version if the renter directory is versioned. Files that were modified less
+// than syncSettleTime ago are skipped until they stop changing.
+//
+// Deleting a file locally only deletes it from the renter if the job mirrors
+// deletions. Deletions are never mirrored after a scan that couldn't read the
+// whole local directory, or that found no files at all while the job knows of
+// synced files, to prevent a temporarily unavailable directory, e.g. an
+// unmounted mount point, from deleting the renter's files. Such files are
+// kept until they are deleted from the renter manually.
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/Hyperspace/persist"
+	"github.com/HyperspaceApp/errors"
+)
+
+const (
+	// syncFile is the name of the file that persists the sync jobs.
+	syncFile = "sync.json"
+)
+
+var (
+	// syncMetadata is the header of the sync file.
+	syncMetadata = persist.Metadata{
+		Header:  "Renter Sync Jobs",
+		Version: persistVersion,
+	}
+
+	// errSyncJobExists is returned when adding a sync job for a renter
+	// directory that another job already uploads to.
+	errSyncJobExists = errors.New("a sync job already uploads to that directory")
+
+	// errSyncRelativePath is returned when the local directory of a sync job
+	// is not an absolute path.
+	errSyncRelativePath = errors.New("local directory must be an absolute path")
+
+	// errSyncDirEmpty is returned by a scan that found no files in a local
+	// directory that contained synced files before. The deletions aren't
+	// mirrored, since the directory might just be unavailable.
+	errSyncDirEmpty = errors.New("local directory is empty, deletions are not mirrored")
+
+	// errSyncStopped is returned by a scan that was interrupted because the
+	// job was removed or the renter shut down.
+	errSyncStopped = errors.New("sync job was stopped")
+
+	// errUnknownSyncJob is returned when removing a sync job that doesn't
+	// exist.
+	errUnknownSyncJob = errors.New("no sync job uploads to that directory")
+)
+
+type (
+	// syncManager tracks the sync jobs of the renter, indexed by the siapath
+	// of the directory they upload to.
+	syncManager struct {
+		jobs map[string]*syncJob
+
+		path string
+		mu   sync.Mutex
+	}
+
+	// syncJob is a running sync job.
+	syncJob struct {
+		staticJob  modules.SyncJob
+		staticStop chan struct{}
+
+		// files maps the slash separated paths of the synced files relative
+		// to the local directory to their state.
+		files map[string]syncFileState
+
+		err         error
+		lastScan    time.Time
+		numDeleted  uint64
+		numUploaded uint64
+		watching    bool
+		mu          sync.Mutex
+	}
+
+	// syncFileState is the state of a local file when it was last uploaded.
+	syncFileState struct {
+		Size    int64       `json:"size"`
+		ModTime time.Time   `json:"modtime"`
+		Hash    crypto.Hash `json:"hash"`
+	}
+
+	// syncJobPersist is the persisted state of a sync job.
+	syncJobPersist struct {
+		Job   modules.SyncJob          `json:"job"`
+		Files map[string]syncFileState `json:"files"`
+	}
+
+	// syncWatcher notifies a sync job of changes to the directories of its
+	// local directory.
+	syncWatcher interface {
+		// Watch starts watching the directory at path. Watching a directory
+		// that is already watched has no effect.
+		Watch(path string) error
+
+		// Events returns a channel that receives a value after changes to
+		// a watched directory.
+		Events() <-chan struct{}
+
+		// Close stops watching every directory.
+		Close() error
+	}
+
+	// pollWatcher is the syncWatcher of jobs whose directories can't be
+	// watched. It never reports changes.
+	pollWatcher struct{}
+)
+
+// Watch implements syncWatcher.
+func (pollWatcher) Watch(string) error { return nil }
+
+// Events implements syncWatcher.
+func (pollWatcher) Events() <-chan struct{} { return nil }
+
+// Close implements syncWatcher.
+func (pollWatcher) Close() error { return nil }
+
+// loadSyncManager loads the sync jobs persisted at path. The jobs are not
+// started.
+func loadSyncManager(path string) (*syncManager, error) {
+	sm := &syncManager{
+		jobs: make(map[string]*syncJob),
+		path: path,
+	}
+	var jobs []syncJobPersist
+	err := persist.LoadJSON(syncMetadata, &jobs, path)
+	if os.IsNotExist(err) {
+		return sm, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		sm.jobs[job.Job.HyperspacePath] = newSyncJob(job.Job, job.Files)
+	}
+	return sm, nil
+}
+
+// newSyncJob creates a sync job with the provided file states.
+func newSyncJob(job modules.SyncJob, files map[string]syncFileState) *syncJob {
+	if files == nil {
+		files = make(map[string]syncFileState)
+	}
+	return &syncJob{
+		staticJob:  job,
+		staticStop: make(chan struct{}),
+		files:      files,
+	}
+}
+
+// save persists the sync jobs. The caller must hold the lock.
+func (sm *syncManager) save() error {
+	jobs := []syncJobPersist{}
+	for _, job := range sm.jobs {
+		job.mu.Lock()
+		files := make(map[string]syncFileState, len(job.files))
+		for path, state := range job.files {
+			files[path] = state
+		}
+		job.mu.Unlock()
+		jobs = append(jobs, syncJobPersist{
+			Job:   job.staticJob,
+			Files: files,
+		})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Job.HyperspacePath < jobs[j].Job.HyperspacePath
+	})
+	return persist.SaveJSON(syncMetadata, jobs, sm.path)
+}
+
+// managedSave persists the sync jobs.
+func (sm *syncManager) managedSave() error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.save()
+}
+
+// managedJobs returns the sync jobs.
+func (sm *syncManager) managedJobs() []*syncJob {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	jobs := make([]*syncJob, 0, len(sm.jobs))
+	for _, job := range sm.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// stopped returns whether the job was removed.
+func (job *syncJob) stopped() bool {
+	select {
+	case <-job.staticStop:
+		return true
+	default:
+		return false
+	}
+}
+
+// siaPath returns the siapath that the local file at the slash separated
+// path rel is uploaded to.
+func (job *syncJob) siaPath(rel string) string {
+	if job.staticJob.HyperspacePath == "" {
+		return rel
+	}
+	return job.staticJob.HyperspacePath + "/" + rel
+}
+
+// syncIgnored returns whether the file or directory at the slash separated
+// path rel matches one of the ignore patterns.
+func syncIgnored(patterns []string, rel string) bool {
+	name := filepath.Base(filepath.FromSlash(rel))
+	for _, pattern := range patterns {
+		if match, _ := filepath.Match(pattern, name); match {
+			return true
+		}
+		if match, _ := filepath.Match(filepath.FromSlash(pattern), filepath.FromSlash(rel)); match {
+			return true
+		}
+	}
+	return false
+}
+
+// syncFileHash returns the hash of the content of the file at path.
+func syncFileHash(path string) (crypto.Hash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	defer f.Close()
+	h := crypto.NewHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return crypto.Hash{}, err
+	}
+	var hash crypto.Hash
+	h.Sum(hash[:0])
+	return hash, nil
+}
+
+// AddSyncJob starts a job that continuously uploads the files of a local
+// directory to a renter directory.
+func (r *Renter) AddSyncJob(job modules.SyncJob) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if !filepath.IsAbs(job.LocalPath) {
+		return errSyncRelativePath
+	}
+	job.LocalPath = filepath.Clean(job.LocalPath)
+	if fi, err := os.Stat(job.LocalPath); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return errors.New("local path is not a directory")
+	}
+	job.HyperspacePath = strings.Trim(job.HyperspacePath, "/")
+	if job.HyperspacePath != "" {
+		if err := validateSiapath(job.HyperspacePath); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range job.Ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return errors.AddContext(err, "invalid ignore pattern "+pattern)
+		}
+	}
+	if job.HyperspacePath != "" {
+		lockID := r.mu.Lock()
+		err := r.createDir(job.HyperspacePath)
+		r.mu.Unlock(lockID)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.staticSyncs.mu.Lock()
+	defer r.staticSyncs.mu.Unlock()
+	if _, exists := r.staticSyncs.jobs[job.HyperspacePath]; exists {
+		return errSyncJobExists
+	}
+	sj := newSyncJob(job, nil)
+	r.staticSyncs.jobs[job.HyperspacePath] = sj
+	if err := r.staticSyncs.save(); err != nil {
+		delete(r.staticSyncs.jobs, job.HyperspacePath)
+		return err
+	}
+	go r.threadedSyncJob(sj)
+	return nil
+}
+
+// RemoveSyncJob stops the sync job that uploads to the directory at siaPath.
+// The files it uploaded are kept.
+func (r *Renter) RemoveSyncJob(siaPath string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	siaPath = strings.Trim(siaPath, "/")
+	r.staticSyncs.mu.Lock()
+	defer r.staticSyncs.mu.Unlock()
+	job, exists := r.staticSyncs.jobs[siaPath]
+	if !exists {
+		return errUnknownSyncJob
+	}
+	close(job.staticStop)
+	delete(r.staticSyncs.jobs, siaPath)
+	return r.staticSyncs.save()
+}
+
+// SyncJobs returns the sync jobs of the renter, sorted by the directory they
+// upload to.
+func (r *Renter) SyncJobs() []modules.SyncJobInfo {
+	infos := []modules.SyncJobInfo{}
+	for _, job := range r.staticSyncs.managedJobs() {
+		job.mu.Lock()
+		info := modules.SyncJobInfo{
+			SyncJob:     job.staticJob,
+			LastScan:    job.lastScan,
+			NumDeleted:  job.numDeleted,
+			NumFiles:    uint64(len(job.files)),
+			NumUploaded: job.numUploaded,
+			Watching:    job.watching,
+		}
+		if job.err != nil {
+			info.Error = job.err.Error()
+		}
+		job.mu.Unlock()
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].HyperspacePath < infos[j].HyperspacePath
+	})
+	return infos
+}
+
+// managedSyncFile uploads the local file at path if it changed since it was
+// last uploaded. It returns whether the file was skipped because it is still
+// being modified.
+func (r *Renter) managedSyncFile(job *syncJob, path, rel string, info os.FileInfo) (bool, error) {
+	siaPath := job.siaPath(rel)
+	job.mu.Lock()
+	state, known := job.files[rel]
+	job.mu.Unlock()
+	exists, _ := r.staticFileSet.Exists(siaPath)
+	if known && exists && state.Size == info.Size() && state.ModTime.Equal(info.ModTime()) {
+		return false, nil
+	}
+	if time.Since(info.ModTime()) < syncSettleTime {
+		return true, nil
+	}
+	hash, err := syncFileHash(path)
+	if err != nil {
+		return false, err
+	}
+	newState := syncFileState{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hash,
+	}
+	if !known || !exists || hash != state.Hash {
+		err := r.Upload(modules.FileUploadParams{
+			Source:         path,
+			HyperspacePath: siaPath,
+			Force:          true,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	job.mu.Lock()
+	if !known || !exists || hash != state.Hash {
+		job.numUploaded++
+	}
+	job.files[rel] = newState
+	job.mu.Unlock()
+	return false, nil
+}
+
+// managedSyncScan uploads the new and changed files of the job's local
+// directory and mirrors deletions, and makes sure that every directory is
+// watched by watcher. It returns whether some files are still being modified.
+func (r *Renter) managedSyncScan(job *syncJob, watcher syncWatcher) (bool, error) {
+	root := job.staticJob.LocalPath
+	if fi, err := os.Stat(root); err != nil {
+		return false, err
+	} else if !fi.IsDir() {
+		return false, errors.New("local path is not a directory")
+	}
+
+	// Directories can only be watched if the watcher isn't a pollWatcher.
+	_, polling := watcher.(pollWatcher)
+	watching := !polling
+	pending := false
+	incomplete := false
+	var errs []error
+	seen := make(map[string]struct{})
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if job.stopped() {
+			return errSyncStopped
+		}
+		select {
+		case <-r.tg.StopChan():
+			return errSyncStopped
+		default:
+		}
+		if err != nil {
+			// Skip the parts of the directory that can't be read.
+			incomplete = true
+			errs = append(errs, err)
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && syncIgnored(job.staticJob.Ignore, rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if err := watcher.Watch(path); err != nil {
+				watching = false
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		seen[rel] = struct{}{}
+		filePending, err := r.managedSyncFile(job, path, rel, info)
+		if err != nil {
+			errs = append(errs, errors.AddContext(err, "unable to sync "+rel))
+		}
+		pending = pending || filePending
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// Forget the files that don't exist anymore, and delete them from the
+	// renter if the job mirrors deletions.
+	job.mu.Lock()
+	if len(seen) == 0 && len(job.files) > 0 {
+		incomplete = true
+		errs = append(errs, errSyncDirEmpty)
+	}
+	var deleted []string
+	for rel := range job.files {
+		if _, exists := seen[rel]; !exists {
+			deleted = append(deleted, rel)
+		}
+	}
+	job.watching = watching
+	job.mu.Unlock()
+	for _, rel := range deleted {
+		if incomplete {
+			break
+		}
+		if job.staticJob.MirrorDeletions && !syncIgnored(job.staticJob.Ignore, rel) {
+			err := r.DeleteFile(job.siaPath(rel))
+			if err != nil && err != siafile.ErrUnknownPath {
+				errs = append(errs, errors.AddContext(err, "unable to delete "+rel))
+				continue
+			}
+			job.mu.Lock()
+			job.numDeleted++
+			job.mu.Unlock()
+		}
+		job.mu.Lock()
+		delete(job.files, rel)
+		job.mu.Unlock()
+	}
+	return pending, errors.Compose(errs...)
+}
+
+// threadedSyncJob runs a sync job until it is removed or the renter shuts
+// down.
+func (r *Renter) threadedSyncJob(job *syncJob) {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	var watcher syncWatcher = pollWatcher{}
+	if w, err := newSyncWatcher(); err == nil {
+		watcher = w
+	} else {
+		r.log.Debugln("Changes to", job.staticJob.LocalPath, "are only detected by rescans:", err)
+	}
+	defer func() {
+		if err := watcher.Close(); err != nil {
+			r.log.Debugln("WARN: Could not close the watcher of", job.staticJob.LocalPath, err)
+		}
+	}()
+
+	for {
+		// Changes reported up to now are picked up by the scan.
+		select {
+		case <-watcher.Events():
+		default:
+		}
+		pending, err := r.managedSyncScan(job, watcher)
+		if err == errSyncStopped {
+			return
+		}
+		if err != nil {
+			r.log.Debugln("WARN: Could not sync", job.staticJob.LocalPath, err)
+		}
+		job.mu.Lock()
+		job.err = err
+		job.lastScan = time.Now()
+		job.mu.Unlock()
+		if err := r.staticSyncs.managedSave(); err != nil {
+			r.log.Println("WARN: Could not save the sync jobs:", err)
+		}
+
+		// Wait for the next rescan. Files that are still being modified are
+		// checked again once they settled, and changes reported by the
+		// watcher trigger a scan once no more changes were reported for
+		// syncSettleTime.
+		interval := syncRescanInterval
+		if pending {
+			interval = syncSettleTime
+		}
+		select {
+		case <-time.After(interval):
+		case <-watcher.Events():
+			for settled := false; !settled; {
+				select {
+				case <-watcher.Events():
+				case <-time.After(syncSettleTime):
+					settled = true
+				case <-job.staticStop:
+					return
+				case <-r.tg.StopChan():
+					return
+				}
+			}
+		case <-job.staticStop:
+			return
+		case <-r.tg.StopChan():
+			return
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package renter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// TestSyncIgnored tests matching local paths against ignore patterns.
+func TestSyncIgnored(t *testing.T) {
+	patterns := []string{"*.tmp", "build/*", ".git"}
+	tests := []struct {
+		rel     string
+		ignored bool
+	}{
+		{"foo.tmp", true},
+		{"docs/foo.tmp", true},
+		{"foo.txt", false},
+		{"build/foo", true},
+		{"docs/build/foo", false},
+		{".git", true},
+		{"docs/.git", true},
+		{"docs/.gitignore", false},
+	}
+	for _, test := range tests {
+		if ignored := syncIgnored(patterns, test.rel); ignored != test.ignored {
+			t.Errorf("expected ignored to be %v for %v, got %v", test.ignored, test.rel, ignored)
+		}
+	}
+}
+
+// syncTester is a sync job whose local directory is filled by the test.
+type syncTester struct {
+	dir string
+	job *syncJob
+	r   *Renter
+	t   *testing.T
+}
+
+// newSyncTester creates a sync job that uploads a temporary directory to the
+// renter directory "sync".
+func newSyncTester(t *testing.T, r *Renter, job modules.SyncJob) *syncTester {
+	dir := build.TempDir("renter", t.Name(), "local")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateDir("sync"); err != nil {
+		t.Fatal(err)
+	}
+	job.HyperspacePath = "sync"
+	job.LocalPath = dir
+	return &syncTester{
+		dir: dir,
+		job: newSyncJob(job, nil),
+		r:   r,
+		t:   t,
+	}
+}
+
+// writeFile writes a local file with the provided modification time.
+func (st *syncTester) writeFile(rel string, data []byte, modTime time.Time) {
+	path := filepath.Join(st.dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		st.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		st.t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		st.t.Fatal(err)
+	}
+}
+
+// scan scans the local directory and returns whether files are pending.
+func (st *syncTester) scan() bool {
+	pending, err := st.r.managedSyncScan(st.job, pollWatcher{})
+	if err != nil {
+		st.t.Fatal(err)
+	}
+	return pending
+}
+
+// uid returns the UID of the uploaded file of the local file at rel, or the
+// empty string if it wasn't uploaded.
+func (st *syncTester) uid(rel string) string {
+	entry, err := st.r.staticFileSet.Open(st.job.siaPath(rel))
+	if err != nil {
+		return ""
+	}
+	defer entry.Close()
+	return entry.UID()
+}
+
+// TestSyncScanChanges tests that scans upload new files and files whose
+// content changed, skip files whose size and modification time didn't
+// change, wait for files that are still modified and apply ignore patterns.
+func TestSyncScanChanges(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	st := newSyncTester(t, rt.renter, modules.SyncJob{Ignore: []string{"*.tmp", "build"}})
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	a, b := fastrand.Bytes(2000), fastrand.Bytes(2000)
+	st.writeFile("a", a, old)
+	st.writeFile("docs/b", b, old)
+	st.writeFile("docs/c.tmp", b, old)
+	st.writeFile("build/d", b, old)
+	if st.scan() {
+		t.Fatal("settled files are pending")
+	}
+	uidA, uidB := st.uid("a"), st.uid("docs/b")
+	if uidA == "" || uidB == "" {
+		t.Fatal("new files weren't uploaded")
+	}
+	if st.uid("docs/c.tmp") != "" || st.uid("build/d") != "" {
+		t.Fatal("ignored files were uploaded")
+	}
+	if st.job.numUploaded != 2 || len(st.job.files) != 2 {
+		t.Fatal("unexpected job state", st.job.numUploaded, st.job.files)
+	}
+
+	// A file whose size and modification time didn't change isn't hashed or
+	// uploaded again, even if its content changed.
+	b[0]++
+	st.writeFile("docs/b", b, old)
+	// A touched file with the same content isn't uploaded again either.
+	st.writeFile("a", a, old.Add(time.Minute))
+	st.scan()
+	if st.uid("a") != uidA || st.uid("docs/b") != uidB || st.job.numUploaded != 2 {
+		t.Fatal("unchanged files were uploaded again")
+	}
+	if !st.job.files["a"].ModTime.Equal(old.Add(time.Minute)) {
+		t.Fatal("modification time of the touched file wasn't updated")
+	}
+
+	// Once the modification time changes, the new content is detected.
+	st.writeFile("docs/b", b, old.Add(time.Minute))
+	st.scan()
+	if uid := st.uid("docs/b"); uid == "" || uid == uidB || st.job.numUploaded != 3 {
+		t.Fatal("changed file wasn't uploaded again")
+	}
+	if st.job.files["docs/b"].Hash != crypto.HashBytes(b) {
+		t.Fatal("hash of the changed file wasn't updated")
+	}
+
+	// Files that were just modified are pending until they settled.
+	st.writeFile("e", a, time.Now())
+	if !st.scan() {
+		t.Fatal("recently modified file isn't pending")
+	}
+	if st.uid("e") != "" {
+		t.Fatal("recently modified file was uploaded")
+	}
+}
+
+// TestSyncScanDeletions tests that local deletions are mirrored only by jobs
+// that mirror deletions, and that the deleted files are forgotten either way.
+func TestSyncScanDeletions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	for _, mirror := range []bool{false, true} {
+		st := newSyncTester(t, rt.renter, modules.SyncJob{MirrorDeletions: mirror})
+		old := time.Now().Add(-time.Hour)
+		st.writeFile("a", fastrand.Bytes(2000), old)
+		st.writeFile("b", fastrand.Bytes(2000), old)
+		st.scan()
+		if err := os.Remove(filepath.Join(st.dir, "a")); err != nil {
+			t.Fatal(err)
+		}
+		st.scan()
+		if _, known := st.job.files["a"]; known {
+			t.Fatal("deleted file wasn't forgotten")
+		}
+		if deleted := st.uid("a") == ""; deleted != mirror || (st.job.numDeleted == 1) != mirror {
+			t.Fatalf("expected the deletion to be mirrored: %v, numDeleted: %v", mirror, st.job.numDeleted)
+		}
+		if st.uid("b") == "" {
+			t.Fatal("remaining file was deleted")
+		}
+		if err := rt.renter.DeleteDir("sync"); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.RemoveAll(st.dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestSyncScanEmptyDir tests that deletions aren't mirrored if the local
+// directory suddenly contains no files, e.g. because it isn't mounted.
+func TestSyncScanEmptyDir(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	st := newSyncTester(t, rt.renter, modules.SyncJob{MirrorDeletions: true})
+
+	old := time.Now().Add(-time.Hour)
+	st.writeFile("a", fastrand.Bytes(2000), old)
+	st.writeFile("docs/b", fastrand.Bytes(2000), old)
+	st.scan()
+
+	// Emptying the directory doesn't delete the files from the renter.
+	for _, rel := range []string{"a", "docs"} {
+		if err := os.RemoveAll(filepath.Join(st.dir, rel)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rt.renter.managedSyncScan(st.job, pollWatcher{}); !errors.Contains(err, errSyncDirEmpty) {
+		t.Fatal("expected errSyncDirEmpty, got", err)
+	}
+	if st.uid("a") == "" || st.uid("docs/b") == "" || st.job.numDeleted != 0 || len(st.job.files) != 2 {
+		t.Fatal("files of the empty directory were deleted")
+	}
+
+	// Once a file shows up again, the missing files are deleted.
+	st.writeFile("c", fastrand.Bytes(2000), old)
+	st.scan()
+	if st.uid("a") != "" || st.uid("docs/b") != "" || st.job.numDeleted != 2 {
+		t.Fatal("deletions weren't mirrored", st.job.numDeleted)
+	}
+	if st.uid("c") == "" {
+		t.Fatal("new file wasn't uploaded")
+	}
+}
@@ -0,0 +1,114 @@
+// +build linux
+
+package renter
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/HyperspaceApp/errors"
+)
+
+const (
+	// inotifyMask is the mask of the inotify events that indicate changes to
+	// the files of a watched directory.
+	inotifyMask = syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE | syscall.IN_CREATE |
+		syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF |
+		syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+	// inotifyPollTimeout is the time in milliseconds that the watcher waits
+	// for events before checking whether it was closed.
+	inotifyPollTimeout = 500
+)
+
+// inotifyWatcher is a syncWatcher that uses inotify.
+type inotifyWatcher struct {
+	fd     int
+	epfd   int
+	events chan struct{}
+
+	closeChan chan struct{}
+	wg        sync.WaitGroup
+}
+
+// newSyncWatcher creates a syncWatcher that uses inotify.
+func newSyncWatcher() (syncWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	event := syscall.EpollEvent{
+		Events: syscall.EPOLLIN,
+		Fd:     int32(fd),
+	}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &event); err != nil {
+		syscall.Close(epfd)
+		syscall.Close(fd)
+		return nil, err
+	}
+	w := &inotifyWatcher{
+		fd:        fd,
+		epfd:      epfd,
+		events:    make(chan struct{}, 1),
+		closeChan: make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.threadedReadEvents()
+	return w, nil
+}
+
+// threadedReadEvents reads the inotify events until the watcher is closed.
+// The events themselves are discarded, since every change triggers a rescan
+// of the whole directory.
+func (w *inotifyWatcher) threadedReadEvents() {
+	defer w.wg.Done()
+	events := make([]syscall.EpollEvent, 1)
+	buf := make([]byte, 64*1024)
+	for {
+		select {
+		case <-w.closeChan:
+			return
+		default:
+		}
+		n, err := syscall.EpollWait(w.epfd, events, inotifyPollTimeout)
+		if err == syscall.EINTR || (err == nil && n == 0) {
+			continue
+		} else if err != nil {
+			return
+		}
+		// Drain the queued events.
+		for {
+			n, err := syscall.Read(w.fd, buf)
+			if err != nil || n <= 0 {
+				break
+			}
+		}
+		select {
+		case w.events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Watch implements syncWatcher.
+func (w *inotifyWatcher) Watch(path string) error {
+	_, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+	return err
+}
+
+// Events implements syncWatcher.
+func (w *inotifyWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+// Close implements syncWatcher.
+func (w *inotifyWatcher) Close() error {
+	close(w.closeChan)
+	w.wg.Wait()
+	return errors.Compose(syscall.Close(w.epfd), syscall.Close(w.fd))
+}
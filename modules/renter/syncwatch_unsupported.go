@@ -0,0 +1,15 @@
+// +build !linux
+
+package renter
+
+import "github.com/HyperspaceApp/errors"
+
+// errSyncWatchUnsupported is returned when watching directories on an
+// operating system that doesn't support inotify.
+var errSyncWatchUnsupported = errors.New("watching directories is not supported on this operating system")
+
+// newSyncWatcher always fails since inotify is not supported on this
+// operating system.
+func newSyncWatcher() (syncWatcher, error) {
+	return nil, errSyncWatchUnsupported
+}
@@ -52,22 +52,22 @@ func validateSource(sourcePath string) error {
 	return nil
 }
 
-// Upload instructs the renter to start tracking a file. The renter will
-// automatically upload and repair tracked files using a background loop.
-func (r *Renter) Upload(up modules.FileUploadParams) error {
+// managedInitUpload enforces the rules that apply to all uploads, removes an
+// existing file if the upload should overwrite it, fills in any missing upload
+// params and creates the directory of the file.
+func (r *Renter) managedInitUpload(up modules.FileUploadParams) (modules.FileUploadParams, error) {
 	// Enforce nickname rules.
 	if err := validateSiapath(up.HyperspacePath); err != nil {
-		return err
+		return up, err
 	}
-	// Enforce source rules.
-	if err := validateSource(up.Source); err != nil {
-		return err
+	if err := validateFileMetadata(up.ContentType, up.Metadata); err != nil {
+		return up, err
 	}
 
 	// Delete existing file if overwrite flag is set. Ignore ErrUnknownPath.
 	if up.Force {
 		if err := r.DeleteFile(up.HyperspacePath); err != nil && err != siafile.ErrUnknownPath {
-			return err
+			return up, err
 		}
 	}
 
@@ -81,18 +81,14 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 			err := r.DeleteFile(up.HyperspacePath)
 			// Return of ErrUnknownPath should not prevent upload
 			if err != nil && err != siafile.ErrUnknownPath {
-				return err
+				return up, err
 			}
 		} else {
-			return siafile.ErrPathOverload
+			return up, siafile.ErrPathOverload
 		}
 	}
 
 	// Fill in any missing upload params with sensible defaults.
-	fileInfo, err := os.Stat(up.Source)
-	if err != nil {
-		return err
-	}
 	if up.ErasureCode == nil {
 		up.ErasureCode, _ = siafile.NewRSCode(defaultDataPieces, defaultParityPieces)
 	}
@@ -104,7 +100,7 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	numContracts := len(r.hostContractor.Contracts())
 	requiredContracts := (up.ErasureCode.NumPieces() + up.ErasureCode.MinPieces()) / 2
 	if numContracts < requiredContracts && build.Release != "testing" {
-		return fmt.Errorf("not enough contracts to upload file: got %v, needed %v", numContracts, (up.ErasureCode.NumPieces()+up.ErasureCode.MinPieces())/2)
+		return up, fmt.Errorf("not enough contracts to upload file: got %v, needed %v", numContracts, (up.ErasureCode.NumPieces()+up.ErasureCode.MinPieces())/2)
 	}
 
 	// Create the directory path on disk. Renter directory is already present so
@@ -113,9 +109,35 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	dirHyperspacePath := strings.TrimSuffix(dir, "/")
 	if dirHyperspacePath != "" {
 		if err := r.createDir(dirHyperspacePath); err != nil {
-			return err
+			return up, err
 		}
 	}
+	return up, nil
+}
+
+// Upload instructs the renter to start tracking a file. The renter will
+// automatically upload and repair tracked files using a background loop.
+func (r *Renter) Upload(up modules.FileUploadParams) error {
+	// Enforce source rules.
+	if err := validateSource(up.Source); err != nil {
+		return err
+	}
+	fileInfo, err := os.Stat(up.Source)
+	if err != nil {
+		return err
+	}
+	// Small files that use the default erasure code are packed into shared
+	// chunks, unless they are deduplicated or restricted to the hosts of a
+	// host policy.
+	packable := up.ErasureCode == nil && !up.Dedup && fileInfo.Size() > 0 && uint64(fileInfo.Size()) <= maxPackedFileSize
+	packable = packable && r.managedHostPolicy(up.HyperspacePath) == ""
+	up, err = r.managedInitUpload(up)
+	if err != nil {
+		return err
+	}
+	if packable {
+		return r.managedPackFile(up, fileInfo)
+	}
 
 	// Create the Siafile and add to renter
 	entry, err := r.staticFileSet.NewSiaFile(up, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), uint64(fileInfo.Size()), fileInfo.Mode())
@@ -124,10 +146,15 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	}
 	defer entry.Close()
 
+	// Mark the directory of the file as unhealthy.
+	if err := r.managedBubbleFileHealth(entry); err != nil {
+		r.log.Println("WARN: Could not update the health of the directory of", up.HyperspacePath, err)
+	}
+
 	// Send the upload to the repair loop.
 	hosts := r.managedRefreshHostsAndWorkers()
 	id := r.mu.Lock()
-	unfinishedChunks := r.buildUnfinishedChunks(entry.ChunkEntrys(), hosts)
+	unfinishedChunks := r.buildUnfinishedChunks(entry.ChunkEntrys(), hosts, false)
 	r.mu.Unlock(id)
 	for i := 0; i < len(unfinishedChunks); i++ {
 		r.uploadHeap.managedPush(unfinishedChunks[i])
@@ -40,6 +40,19 @@ type unfinishedUploadChunk struct {
 	offset         int64  // Offset of the chunk within the file.
 	piecesNeeded   int    // number of pieces to achieve a 100% complete upload
 
+	// stuckRepair is set if the chunk is stuck and retried by the stuck loop.
+	// Stuck repairs download the chunk from the network whenever it can't be
+	// read from disk.
+	stuckRepair bool
+
+	// sourceReader is set for the chunks of streaming uploads. Their logical
+	// data is read from the stream instead of the local file or the network.
+	sourceReader io.Reader
+
+	// availableChan is closed once the chunk reached the minimum redundancy
+	// or once no more pieces of the chunk will be uploaded.
+	availableChan chan struct{}
+
 	// The logical data is the data that is presented to the user when the user
 	// requests the chunk. The physical data is all of the pieces that get
 	// stored across the network.
@@ -74,15 +87,68 @@ type unfinishedUploadChunk struct {
 	//	+ the worker should decrement the number of pieces registered
 	//	+ the worker should release the memory for the completed piece
 	mu               sync.Mutex
+	available        bool                // whether availableChan has been closed.
 	pieceUsage       []bool              // 'true' if a piece is either uploaded, or a worker is attempting to upload that piece.
 	piecesCompleted  int                 // number of pieces that have been fully uploaded.
 	piecesRegistered int                 // number of pieces that are being uploaded, but aren't finished yet (may fail).
+	outOfFunds       bool                // whether a worker failed because its contract ran out of funds.
 	released         bool                // whether this chunk has been released from the active chunks set.
+	stuckReason      siafile.StuckReason // why the chunk is stuck if the repair doesn't reach full redundancy.
 	unusedHosts      map[string]struct{} // hosts that aren't yet storing any pieces or performing any work.
 	workersRemaining int                 // number of inactive workers still able to upload a piece.
 	workersStandby   []*worker           // workers that can be used if other workers fail.
 }
 
+// newUnfinishedUploadChunk creates an unfinished chunk for the chunk at index
+// of the file. Pieces of the chunk may be uploaded to any of the hosts.
+func newUnfinishedUploadChunk(entry *siafile.SiaFileSetEntry, index uint64, hosts map[string]struct{}) *unfinishedUploadChunk {
+	uuc := &unfinishedUploadChunk{
+		fileEntry: entry,
+
+		id: uploadChunkID{
+			fileUID: entry.UID(),
+			index:   index,
+		},
+
+		index:  index,
+		length: entry.ChunkSize(),
+		offset: int64(index * entry.ChunkSize()),
+
+		// memoryNeeded has to also include the logical data, and also
+		// include the overhead for encryption.
+		//
+		// TODO / NOTE: If we adjust the file to have a flexible encryption
+		// scheme, we'll need to adjust the overhead stuff too.
+		//
+		// TODO: Currently we request memory for all of the pieces as well
+		// as the minimum pieces, but we perhaps don't need to request all
+		// of that.
+		memoryNeeded:  entry.PieceSize()*uint64(entry.ErasureCode().NumPieces()+entry.ErasureCode().MinPieces()) + uint64(entry.ErasureCode().NumPieces())*entry.MasterKey().Type().Overhead(),
+		minimumPieces: entry.ErasureCode().MinPieces(),
+		piecesNeeded:  entry.ErasureCode().NumPieces(),
+
+		physicalChunkData: make([][]byte, entry.ErasureCode().NumPieces()),
+
+		availableChan: make(chan struct{}),
+		pieceUsage:    make([]bool, entry.ErasureCode().NumPieces()),
+		unusedHosts:   make(map[string]struct{}),
+	}
+	// Every chunk can have a different set of unused hosts.
+	for host := range hosts {
+		uuc.unusedHosts[host] = struct{}{}
+	}
+	return uuc
+}
+
+// notifyAvailable closes the chunk's availableChan if it wasn't closed yet.
+// The caller must hold the chunk's lock.
+func (uc *unfinishedUploadChunk) notifyAvailable() {
+	if !uc.available {
+		uc.available = true
+		close(uc.availableChan)
+	}
+}
+
 // managedNotifyStandbyWorkers is called when a worker fails to upload a piece, meaning
 // that the standby workers may now be needed to help the piece finish
 // uploading.
@@ -210,10 +276,30 @@ func (r *Renter) managedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 		chunk.workersRemaining = 0
 		r.memoryManager.Return(erasureCodingMemory + pieceCompletedMemory)
 		chunk.memoryReleased += erasureCodingMemory + pieceCompletedMemory
+		chunk.stuckReason = siafile.StuckReasonFetchFailed
+		if _, err := os.Stat(chunk.fileEntry.LocalPath()); os.IsNotExist(err) && chunk.piecesCompleted < chunk.minimumPieces {
+			chunk.stuckReason = siafile.StuckReasonUnrecoverable
+		}
 		r.log.Debugln("Fetching logical data of a chunk failed:", err)
 		return
 	}
 
+	// Remember the checksum of chunks that are uploaded for the first time.
+	r.managedChecksumChunk(chunk)
+
+	// Reuse the pieces of an identical chunk if the file is deduplicated. The
+	// memory of the reused pieces is released like the memory of the
+	// completed pieces. If all the pieces were reused, the chunk doesn't need
+	// to be uploaded at all.
+	pieceCompletedMemory += uint64(r.managedDeduplicateChunk(chunk)) * modules.SectorSize
+	if chunk.piecesCompleted >= chunk.piecesNeeded {
+		chunk.logicalChunkData = nil
+		chunk.workersRemaining = 0
+		r.memoryManager.Return(erasureCodingMemory + pieceCompletedMemory)
+		chunk.memoryReleased += erasureCodingMemory + pieceCompletedMemory
+		return
+	}
+
 	// Create the physical pieces for the data. Immediately release the logical
 	// data.
 	//
@@ -252,7 +338,7 @@ func (r *Renter) managedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 			chunk.physicalChunkData[i] = nil
 		} else {
 			// Encrypt the piece.
-			key := chunk.fileEntry.MasterKey().Derive(chunk.index, uint64(i))
+			key := chunk.fileEntry.PieceKey(chunk.index, uint64(i))
 			chunk.physicalChunkData[i] = key.EncryptBytes(chunk.physicalChunkData[i])
 		}
 	}
@@ -272,10 +358,23 @@ func (r *Renter) managedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 // chunk.data should be passed as 'nil' to the download, to keep memory usage as
 // light as possible.
 func (r *Renter) managedFetchLogicalChunkData(chunk *unfinishedUploadChunk) error {
-	// Only download this file if more than 25% of the redundancy is missing.
+	// Chunks of streaming uploads are read from the stream. The stream can't
+	// be read again, so there is nothing to fall back to.
+	if chunk.sourceReader != nil {
+		buf := NewDownloadDestinationBuffer(chunk.length, chunk.fileEntry.PieceSize())
+		_, err := buf.ReadFrom(chunk.sourceReader)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.AddContext(err, "failed to read chunk from stream")
+		}
+		chunk.logicalChunkData = buf.buf
+		return nil
+	}
+
+	// Only download this file if more than 25% of the redundancy is missing,
+	// or if the chunk is stuck.
 	numParityPieces := float64(chunk.piecesNeeded - chunk.minimumPieces)
 	minMissingPiecesToDownload := int(numParityPieces * RemoteRepairDownloadThreshold)
-	download := chunk.piecesCompleted+minMissingPiecesToDownload < chunk.piecesNeeded
+	download := chunk.stuckRepair || chunk.piecesCompleted+minMissingPiecesToDownload < chunk.piecesNeeded
 
 	// Download the chunk if it's not on disk.
 	if chunk.fileEntry.LocalPath() == "" && download {
@@ -357,6 +456,22 @@ func (r *Renter) managedCleanUpUploadChunk(uc *unfinishedUploadChunk) {
 	if chunkComplete && !released {
 		uc.released = true
 	}
+	stuck := uc.piecesCompleted < uc.piecesNeeded
+	piecesCompleted := uc.piecesCompleted
+	stuckReason := uc.stuckReason
+	if stuck && stuckReason == siafile.StuckReasonNone && uc.outOfFunds {
+		stuckReason = siafile.StuckReasonAllowance
+	} else if stuck && stuckReason == siafile.StuckReasonNone {
+		stuckReason = siafile.StuckReasonNoHosts
+	}
+	// Streaming uploads wait until the chunk can be recovered from the
+	// network or until no more pieces will be uploaded.
+	if uc.piecesCompleted >= uc.minimumPieces || chunkComplete {
+		if stuck {
+			uc.stuckReason = stuckReason
+		}
+		uc.notifyAvailable()
+	}
 	uc.memoryReleased += uint64(memoryReleased)
 	totalMemoryReleased := uc.memoryReleased
 	uc.mu.Unlock()
@@ -373,8 +488,30 @@ func (r *Renter) managedCleanUpUploadChunk(uc *unfinishedUploadChunk) {
 	if memoryReleased > 0 {
 		r.memoryManager.Return(memoryReleased)
 	}
-	// If required, remove the chunk from the set of active chunks.
+	// If required, remove the chunk from the set of active chunks. A chunk
+	// that didn't reach full redundancy records a failed attempt, and is left
+	// to the stuck loop once repeated attempts failed.
 	if chunkComplete && !released {
+		var err error
+		if stuck {
+			_, err = uc.fileEntry.RepairFailed(uc.index, stuckReason, stuckChunkMaxFailures)
+		} else {
+			err = uc.fileEntry.SetStuck(uc.index, false, siafile.StuckReasonNone)
+		}
+		if err != nil {
+			r.log.Debugln("WARN: could not update the stuck state of a chunk:", err)
+		}
+		r.managedNotifyChunkUploaded(uc.fileEntry, uc.index, piecesCompleted)
+		// Other files can reuse the pieces of a deduplicated chunk.
+		if id, deduplicated := uc.fileEntry.DedupID(uc.index); deduplicated && piecesCompleted > 0 {
+			pieces, err := uc.fileEntry.Pieces(uc.index)
+			if err == nil {
+				err = r.staticDedupIndex.managedSetPieces(id, pieces)
+			}
+			if err != nil {
+				r.log.Debugln("WARN: could not update the pieces of a deduplicated chunk:", err)
+			}
+		}
 		err := uc.fileEntry.Close()
 		if err != nil {
 			r.log.Debugf("WARN: file not closed after chunk upload complete: %v %v", uc.fileEntry.HyperspacePath(), err)
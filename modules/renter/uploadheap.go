@@ -1,13 +1,5 @@
 package renter
 
-// TODO / NOTE: Once the filesystem is tree-based, instead of continually
-// looping through the whole filesystem we can add values to the file metadata
-// for each folder + file, where the folder scan time is the least recent time
-// of any file in the folder, and the folder health is the lowest health of any
-// file in the folder. This will allow us to go one folder at a time and focus
-// on problem areas instead of doing everything all at once every iteration.
-// This should boost scalability.
-
 // TODO / NOTE: We need to upgrade the contractor before we can do this, but we
 // need to be checking for every piece within a contract, and checking that the
 // piece is still available in the contract that we have, that the host did not
@@ -38,7 +30,13 @@ type uploadHeap struct {
 	activeChunks map[uploadChunkID]struct{}
 	heap         uploadChunkHeap
 	newUploads   chan struct{}
-	mu           sync.Mutex
+
+	// streamingFiles contains the UIDs of the files that are currently being
+	// uploaded from a stream. Their chunks can only be read from the stream,
+	// so the repair loop leaves them alone until the stream is done.
+	streamingFiles map[string]struct{}
+
+	mu sync.Mutex
 }
 
 // uploadChunkHeap is a bunch of priority-sorted chunks that need to be either
@@ -77,7 +75,7 @@ func (uh *uploadHeap) managedPush(uuc *unfinishedUploadChunk) {
 	}
 
 	// Check whether this chunk is already being repaired. If not, add it to the
-	// upload chunk heap.
+	// upload chunk heap. Otherwise the duplicate's entry is no longer needed.
 	uh.mu.Lock()
 	_, exists := uh.activeChunks[ucid]
 	if !exists {
@@ -85,6 +83,18 @@ func (uh *uploadHeap) managedPush(uuc *unfinishedUploadChunk) {
 		uh.heap.Push(uuc)
 	}
 	uh.mu.Unlock()
+	if exists {
+		uuc.fileEntry.Close()
+	}
+}
+
+// managedIsStreaming returns whether the file with the provided UID is
+// currently being uploaded from a stream.
+func (uh *uploadHeap) managedIsStreaming(fileUID string) bool {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	_, streaming := uh.streamingFiles[fileUID]
+	return streaming
 }
 
 // managedPop will pull a chunk off of the upload heap and return it.
@@ -98,15 +108,24 @@ func (uh *uploadHeap) managedPop() (uc *unfinishedUploadChunk) {
 }
 
 // buildUnfinishedChunks will pull all of the unfinished chunks out of a file.
+// If stuck is true only the stuck chunks are returned, otherwise only the
+// chunks that are not stuck. The entrys of the chunks that are not returned
+// are closed.
 //
 // TODO / NOTE: This code can be substantially simplified once the files store
 // the HostPubKey instead of the FileContractID, and can be simplified even
 // further once the layout is per-chunk instead of per-filecontract.
-func (r *Renter) buildUnfinishedChunks(entrys []*siafile.SiaFileSetEntry, hosts map[string]struct{}) []*unfinishedUploadChunk {
+func (r *Renter) buildUnfinishedChunks(entrys []*siafile.SiaFileSetEntry, hosts map[string]struct{}, stuck bool) []*unfinishedUploadChunk {
 	// Grab a copy of the SiaFileSetEntry, all the entrys in the slice are the
 	// same
 	entry := entrys[0]
-	// If we don't have enough workers for the file, don't repair it right now.
+	closeEntrys := func(entrys []*siafile.SiaFileSetEntry) {
+		for _, e := range entrys {
+			if err := e.Close(); err != nil {
+				r.log.Debugln("WARN: Could not close thread:", err)
+			}
+		}
+	}
 	minWorkers := 0
 	for i := uint64(0); i < entry.NumChunks(); i++ {
 		minPieces := entry.ErasureCode().MinPieces()
@@ -114,9 +133,9 @@ func (r *Renter) buildUnfinishedChunks(entrys []*siafile.SiaFileSetEntry, hosts
 			minWorkers = minPieces
 		}
 	}
-	if len(r.workerPool) < minWorkers {
-		return nil
-	}
+
+	// Only the hosts allowed by the host policy of the file are used.
+	hosts = r.managedPolicyHosts(entry.HyperspacePath(), hosts)
 
 	// Assemble the set of chunks.
 	//
@@ -126,40 +145,7 @@ func (r *Renter) buildUnfinishedChunks(entrys []*siafile.SiaFileSetEntry, hosts
 	chunkCount := entry.NumChunks()
 	newUnfinishedChunks := make([]*unfinishedUploadChunk, chunkCount)
 	for i := uint64(0); i < chunkCount; i++ {
-		newUnfinishedChunks[i] = &unfinishedUploadChunk{
-			fileEntry: entrys[i],
-
-			id: uploadChunkID{
-				fileUID: entry.UID(),
-				index:   i,
-			},
-
-			index:  i,
-			length: entry.ChunkSize(),
-			offset: int64(i * entry.ChunkSize()),
-
-			// memoryNeeded has to also include the logical data, and also
-			// include the overhead for encryption.
-			//
-			// TODO / NOTE: If we adjust the file to have a flexible encryption
-			// scheme, we'll need to adjust the overhead stuff too.
-			//
-			// TODO: Currently we request memory for all of the pieces as well
-			// as the minimum pieces, but we perhaps don't need to request all
-			// of that.
-			memoryNeeded:  entry.PieceSize()*uint64(entry.ErasureCode().NumPieces()+entry.ErasureCode().MinPieces()) + uint64(entry.ErasureCode().NumPieces())*entry.MasterKey().Type().Overhead(),
-			minimumPieces: entry.ErasureCode().MinPieces(),
-			piecesNeeded:  entry.ErasureCode().NumPieces(),
-
-			physicalChunkData: make([][]byte, entry.ErasureCode().NumPieces()),
-
-			pieceUsage:  make([]bool, entry.ErasureCode().NumPieces()),
-			unusedHosts: make(map[string]struct{}),
-		}
-		// Every chunk can have a different set of unused hosts.
-		for host := range hosts {
-			newUnfinishedChunks[i].unusedHosts[host] = struct{}{}
-		}
+		newUnfinishedChunks[i] = newUnfinishedUploadChunk(entrys[i], i, hosts)
 	}
 
 	// Build a map of host public keys.
@@ -175,6 +161,7 @@ func (r *Renter) buildUnfinishedChunks(entrys []*siafile.SiaFileSetEntry, hosts
 		pieces, err := entry.Pieces(chunkIndex)
 		if err != nil {
 			r.log.Println("failed to get pieces for building incomplete chunks")
+			closeEntrys(entrys)
 			return nil
 		}
 		for pieceIndex, pieceSet := range pieces {
@@ -217,56 +204,91 @@ func (r *Renter) buildUnfinishedChunks(entrys []*siafile.SiaFileSetEntry, hosts
 	}
 
 	// Iterate through the set of newUnfinishedChunks and remove any that are
-	// completed.
+	// completed or don't match the requested stuck state. Completed chunks are
+	// no longer stuck, even if they were repaired by hosts coming back online.
 	incompleteChunks := newUnfinishedChunks[:0]
-	for i := 0; i < len(newUnfinishedChunks); i++ {
-		if newUnfinishedChunks[i].piecesCompleted < newUnfinishedChunks[i].piecesNeeded {
-			incompleteChunks = append(incompleteChunks, newUnfinishedChunks[i])
+	for _, uuc := range newUnfinishedChunks {
+		chunkStuck, _, _ := entry.StuckChunk(uuc.index)
+		complete := uuc.piecesCompleted >= uuc.piecesNeeded
+		if complete && (chunkStuck || entry.RepairFailures(uuc.index) > 0) {
+			if err := entry.SetStuck(uuc.index, false, siafile.StuckReasonNone); err != nil {
+				r.log.Debugln("WARN: could not unstick a complete chunk:", err)
+			}
+		}
+		if complete || chunkStuck != stuck {
+			closeEntrys([]*siafile.SiaFileSetEntry{uuc.fileEntry})
+			continue
+		}
+		uuc.stuckRepair = stuck
+		incompleteChunks = append(incompleteChunks, uuc)
+	}
+
+	// If we don't have enough workers for the file, don't repair it right
+	// now. No attempt was made, so the chunks aren't marked as stuck.
+	if len(r.workerPool) < minWorkers {
+		for _, uuc := range incompleteChunks {
+			closeEntrys([]*siafile.SiaFileSetEntry{uuc.fileEntry})
 		}
+		return nil
 	}
 	// TODO: Don't return chunks that can't be downloaded, uploaded or otherwise
 	// helped by the upload process.
 	return incompleteChunks
 }
 
-// managedBuildChunkHeap will iterate through all of the files in the renter and
-// construct a chunk heap.
+// managedBuildChunkHeap will iterate through the files of the directories that
+// need to be repaired, least healthy directory first, and construct a chunk
+// heap. Directories whose files are all fully redundant are skipped.
 func (r *Renter) managedBuildChunkHeap(hosts map[string]struct{}) {
-	// Get all the files holding the readlock.
-	//
-	// TODO - update to just read from disk
-	entrys, err := r.staticFileSet.All()
+	dirs, err := r.managedDirsToRepair()
+	if err != nil {
+		r.log.Println("WARN: Could not find the directories to repair:", err)
+		return
+	}
+	for _, dir := range dirs {
+		r.uploadHeap.mu.Lock()
+		heapLen := r.uploadHeap.heap.Len()
+		r.uploadHeap.mu.Unlock()
+		if heapLen >= maxUploadHeapChunks {
+			return
+		}
+		r.managedAddDirChunksToHeap(dir, hosts)
+	}
+}
+
+// managedAddDirChunksToHeap adds the unfinished chunks of the files directly
+// inside the directory at siaPath to the upload heap.
+func (r *Renter) managedAddDirChunksToHeap(siaPath string, hosts map[string]struct{}) {
+	_, files, err := r.managedDirContents(siaPath)
 	if err != nil {
 		return
 	}
+	var entrys []*siafile.SiaFileSetEntry
+	for _, file := range files {
+		entry, err := r.staticFileSet.Open(file)
+		if err != nil {
+			continue
+		}
+		entrys = append(entrys, entry)
+	}
 
 	// Save host keys in map. We can't do that under the same lock since we
 	// need to call a public method on the file.
 	pks := make(map[string]types.SiaPublicKey)
-	goodForRenew := make(map[string]bool)
-	offline := make(map[string]bool)
 	for _, e := range entrys {
 		for _, pk := range e.HostPublicKeys() {
 			pks[string(pk.Key)] = pk
 		}
 	}
+	offline, goodForRenew, _ := r.managedContractStatus(pks)
 
-	// Build 2 maps that map every pubkey to its offline and goodForRenew
-	// status.
-	for _, pk := range pks {
-		cu, ok := r.hostContractor.ContractUtility(pk)
-		if !ok {
+	// Loop through the files and get a list of chunks to add to the heap.
+	for _, entry := range entrys {
+		if r.uploadHeap.managedIsStreaming(entry.UID()) || r.managedIsOpenPack(entry.UID()) {
 			continue
 		}
-		goodForRenew[string(pk.Key)] = ok && cu.GoodForRenew
-		offline[string(pk.Key)] = r.hostContractor.IsOffline(pk)
-	}
-
-	// Loop through the whole set of files and get a list of chunks to add to
-	// the heap.
-	for _, entry := range entrys {
 		id := r.mu.Lock()
-		unfinishedUploadChunks := r.buildUnfinishedChunks(entry.ChunkEntrys(), hosts)
+		unfinishedUploadChunks := r.buildUnfinishedChunks(entry.ChunkEntrys(), hosts, false)
 		r.mu.Unlock(id)
 		for i := 0; i < len(unfinishedUploadChunks); i++ {
 			r.uploadHeap.managedPush(unfinishedUploadChunks[i])
@@ -274,8 +296,8 @@ func (r *Renter) managedBuildChunkHeap(hosts map[string]struct{}) {
 	}
 	for _, entry := range entrys {
 		// Check if local file is missing and redundancy is less than 1
-		// log warning to renter log
-		if _, err := os.Stat(entry.LocalPath()); os.IsNotExist(err) && entry.Redundancy(offline, goodForRenew) < 1 {
+		// log warning to renter log. Packed files are stored in their pack.
+		if _, err := os.Stat(entry.LocalPath()); os.IsNotExist(err) && entry.PackPath() == "" && entry.Redundancy(offline, goodForRenew) < 1 {
 			r.log.Println("File not found on disk and possibly unrecoverable:", entry.LocalPath())
 		}
 		err := entry.Close()
@@ -316,6 +338,7 @@ func (r *Renter) managedRefreshHostsAndWorkers() map[string]struct{} {
 	for _, contract := range currentContracts {
 		hosts[contract.HostPublicKey.String()] = struct{}{}
 	}
+	r.managedCheckContractUtilities(currentContracts)
 	// Refresh the worker pool as well.
 	r.managedUpdateWorkerPool()
 	return hosts
@@ -341,11 +364,8 @@ func (r *Renter) threadedUploadLoop() {
 		// useful for uploading.
 		hosts := r.managedRefreshHostsAndWorkers()
 
-		// Build a min-heap of chunks organized by upload progress.
-		//
-		// TODO: After replacing the filesystem to resemble a tree, we'll be
-		// able to go through the filesystem piecewise instead of doing
-		// everything all at once.
+		// Build a min-heap of chunks organized by upload progress, starting
+		// with the least healthy directories.
 		r.managedBuildChunkHeap(hosts)
 		r.uploadHeap.mu.Lock()
 		heapLen := r.uploadHeap.heap.Len()
@@ -383,12 +403,13 @@ func (r *Renter) threadedUploadLoop() {
 			}
 
 			// Make sure we have enough workers for this chunk to reach minimum
-			// redundancy. Otherwise we ignore this chunk for now and try again
+			// redundancy. Otherwise we record the failed attempt and try again
 			// the next time we rebuild the heap and refresh the workers.
 			id := r.mu.RLock()
 			availableWorkers := len(r.workerPool)
 			r.mu.RUnlock(id)
 			if availableWorkers < nextChunk.minimumPieces {
+				r.managedDropFailedChunk(nextChunk, siafile.StuckReasonNoHosts)
 				continue
 			}
 
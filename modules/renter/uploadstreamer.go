@@ -0,0 +1,149 @@
+package renter
+
+// uploadstreamer.go uploads files from an io.Reader instead of a file on disk.
+// Since a stream can only be read once, every chunk is erasure coded and
+// encrypted as soon as it is read, and the next chunk is only read once the
+// previous one can be recovered from the network. Streamed files have no local
+// path, so later repairs download the data from the hosts.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/errors"
+)
+
+// streamShard reads the data of a single chunk of a streaming upload. It reads
+// at most the size of a chunk from the stream and remembers how much data was
+// read and whether reading from the stream failed.
+type streamShard struct {
+	r   io.Reader
+	n   uint64
+	err error
+}
+
+// newStreamShard creates a streamShard that reads up to length bytes from r.
+func newStreamShard(r io.Reader, length uint64) *streamShard {
+	return &streamShard{
+		r: io.LimitReader(r, int64(length)),
+	}
+}
+
+// Read implements the io.Reader interface.
+func (ss *streamShard) Read(b []byte) (int, error) {
+	n, err := ss.r.Read(b)
+	ss.n += uint64(n)
+	if err != nil && err != io.EOF {
+		ss.err = err
+	}
+	return n, err
+}
+
+// UploadStreamFromReader uploads the data read from reader to the network.
+// Chunks are read from the stream one at a time and UploadStreamFromReader
+// blocks until every chunk reached the minimum redundancy, since the data
+// can't be read again. If the upload fails the partially uploaded file is
+// removed.
+func (r *Renter) UploadStreamFromReader(up modules.FileUploadParams, reader io.Reader) (err error) {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+
+	// Streamed files can't be repaired from disk.
+	up.Source = ""
+	up, err = r.managedInitUpload(up)
+	if err != nil {
+		return err
+	}
+
+	// Create an empty file which grows as the stream is read.
+	entry, err := r.staticFileSet.NewSiaFile(up, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 0, defaultFilePerm)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	defer func() {
+		if err == nil {
+			return
+		}
+		if deleteErr := r.managedDeleteFile(up.HyperspacePath); deleteErr != nil {
+			r.log.Println("WARN: Could not remove the file of a failed upload stream:", up.HyperspacePath, deleteErr)
+		}
+	}()
+
+	// Keep the repair loop away from the file until the stream is done.
+	r.uploadHeap.mu.Lock()
+	r.uploadHeap.streamingFiles[entry.UID()] = struct{}{}
+	r.uploadHeap.mu.Unlock()
+	defer func() {
+		r.uploadHeap.mu.Lock()
+		delete(r.uploadHeap.streamingFiles, entry.UID())
+		r.uploadHeap.mu.Unlock()
+	}()
+
+	// The buffered reader lets us tell whether a stream ended exactly at the
+	// end of a chunk.
+	br := bufio.NewReader(reader)
+	chunkSize := entry.ChunkSize()
+	var fileSize uint64
+	for chunkIndex := uint64(0); ; chunkIndex++ {
+		// Stop once the stream is exhausted. An empty stream still uploads a
+		// single chunk, just like an empty file.
+		if _, err := br.Peek(1); err == io.EOF && chunkIndex > 0 {
+			break
+		} else if err != nil && err != io.EOF {
+			return errors.AddContext(err, "failed to read from stream")
+		}
+		if err := entry.GrowNumChunks(chunkIndex + 1); err != nil {
+			return err
+		}
+
+		// Hand the chunk to the upload loop, which reads it from the stream
+		// once enough memory is available.
+		hosts := r.managedPolicyHosts(up.HyperspacePath, r.managedRefreshHostsAndWorkers())
+		ss := newStreamShard(br, chunkSize)
+		uuc := newUnfinishedUploadChunk(entry.CopyEntry(), chunkIndex, hosts)
+		uuc.sourceReader = ss
+		r.uploadHeap.managedPush(uuc)
+		select {
+		case r.uploadHeap.newUploads <- struct{}{}:
+		default:
+		}
+
+		// Wait until the chunk can be recovered from the network.
+		select {
+		case <-uuc.availableChan:
+		case <-r.tg.StopChan():
+			return errors.New("upload stream interrupted by stop call")
+		}
+		if ss.err != nil {
+			return errors.AddContext(ss.err, "failed to read from stream")
+		}
+		uuc.mu.Lock()
+		piecesCompleted, stuckReason := uuc.piecesCompleted, uuc.stuckReason
+		uuc.mu.Unlock()
+		if piecesCompleted < uuc.minimumPieces {
+			return fmt.Errorf("chunk %v didn't reach the minimum redundancy: %v", chunkIndex, stuckReason)
+		}
+
+		// Update the size of the file now that the chunk is uploaded.
+		fileSize += ss.n
+		if err := entry.SetFileSize(fileSize); err != nil {
+			return err
+		}
+		if ss.n < chunkSize {
+			break
+		}
+	}
+
+	// Mark the directory of the file as unhealthy so the remaining pieces are
+	// repaired.
+	if err := r.managedBubbleFileHealth(entry); err != nil {
+		r.log.Println("WARN: Could not update the health of the directory of", up.HyperspacePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package renter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// errorReader is an io.Reader that always fails.
+type errorReader struct{}
+
+// Read implements the io.Reader interface.
+func (errorReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+// TestStreamShard tests that a streamShard reads at most a chunk from the
+// stream and records how much data was read.
+func TestStreamShard(t *testing.T) {
+	data := fastrand.Bytes(100)
+	stream := bytes.NewReader(data)
+
+	// Read the first 60 bytes.
+	ss := newStreamShard(stream, 60)
+	read, err := ioutil.ReadAll(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, data[:60]) || ss.n != 60 || ss.err != nil {
+		t.Fatal("unexpected first shard", len(read), ss.n, ss.err)
+	}
+
+	// The second shard only gets the remaining 40 bytes.
+	ss = newStreamShard(stream, 60)
+	read, err = ioutil.ReadAll(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, data[60:]) || ss.n != 40 || ss.err != nil {
+		t.Fatal("unexpected second shard", len(read), ss.n, ss.err)
+	}
+
+	// Errors other than io.EOF are recorded.
+	ss = newStreamShard(errorReader{}, 60)
+	if _, err := ss.Read(make([]byte, 10)); err == nil || err == io.EOF {
+		t.Fatal("expected read error, got", err)
+	}
+	if ss.err == nil {
+		t.Fatal("read error wasn't recorded")
+	}
+}
+
+// streamTester runs UploadStreamFromReader in the background while the test
+// stands in for the upload loop.
+type streamTester struct {
+	done chan error
+	r    *Renter
+	t    *testing.T
+}
+
+// newStreamTester starts uploading the stream to siaPath with a 1-of-2
+// erasure code.
+func newStreamTester(t *testing.T, r *Renter, siaPath string, stream io.Reader) *streamTester {
+	rsc, _ := siafile.NewRSCode(1, 1)
+	st := &streamTester{
+		done: make(chan error, 1),
+		r:    r,
+		t:    t,
+	}
+	go func() {
+		st.done <- r.UploadStreamFromReader(modules.FileUploadParams{HyperspacePath: siaPath, ErasureCode: rsc}, stream)
+	}()
+	return st
+}
+
+// streamChunkSize is the chunk size of the files uploaded by a streamTester.
+func streamChunkSize() uint64 {
+	return modules.SectorSize - crypto.TypeDefaultRenter.Overhead()
+}
+
+// nextChunk waits for the next chunk of the stream and reads its data from the
+// stream like the upload loop does. It checks that the upload doesn't finish
+// before the chunk was uploaded.
+func (st *streamTester) nextChunk() (*unfinishedUploadChunk, []byte) {
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		uuc := st.r.uploadHeap.managedPop()
+		if uuc == nil {
+			continue
+		}
+		data, _ := ioutil.ReadAll(uuc.sourceReader)
+		select {
+		case err := <-st.done:
+			st.t.Fatal("upload finished before the chunk was uploaded:", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if next := st.r.uploadHeap.managedPop(); next != nil {
+			st.t.Fatal("the next chunk was pushed before the chunk was uploaded")
+		}
+		return uuc, data
+	}
+	st.t.Fatal("no chunk was pushed")
+	return nil, nil
+}
+
+// uploadChunk marks the chunk as uploaded to the given number of hosts.
+func uploadChunk(uuc *unfinishedUploadChunk, pieces int) {
+	uuc.mu.Lock()
+	uuc.piecesCompleted = pieces
+	uuc.notifyAvailable()
+	uuc.mu.Unlock()
+}
+
+// wait returns the result of the upload.
+func (st *streamTester) wait() error {
+	select {
+	case err := <-st.done:
+		return err
+	case <-time.After(10 * time.Second):
+		st.t.Fatal("upload didn't finish")
+		return nil
+	}
+}
+
+// TestUploadStreamChunks tests that streams are split into chunks at the
+// chunk size and that the file has the size of the stream.
+func TestUploadStreamChunks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	chunkSize := streamChunkSize()
+	tests := []struct {
+		size   uint64
+		chunks int
+	}{
+		{0, 1},
+		{chunkSize - 1, 1},
+		{chunkSize, 1},
+		{chunkSize + 1, 2},
+		{2 * chunkSize, 2},
+	}
+	for i, test := range tests {
+		siaPath := "stream" + string(rune('a'+i))
+		data := fastrand.Bytes(int(test.size))
+		st := newStreamTester(t, r, siaPath, bytes.NewReader(data))
+		var uploaded []byte
+		for chunk := 0; chunk < test.chunks; chunk++ {
+			uuc, chunkData := st.nextChunk()
+			if uuc.index != uint64(chunk) {
+				t.Fatalf("test %v: expected chunk %v, got %v", i, chunk, uuc.index)
+			}
+			uploaded = append(uploaded, chunkData...)
+			uploadChunk(uuc, uuc.minimumPieces)
+		}
+		if err := st.wait(); err != nil {
+			t.Fatalf("test %v: %v", i, err)
+		}
+		if !bytes.Equal(uploaded, data) {
+			t.Fatalf("test %v: the chunks don't contain the stream", i)
+		}
+		entry, err := r.staticFileSet.Open(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Size() != test.size || entry.NumChunks() != uint64(test.chunks) {
+			t.Errorf("test %v: unexpected file with size %v and %v chunks", i, entry.Size(), entry.NumChunks())
+		}
+		entry.Close()
+	}
+}
+
+// TestUploadStreamFailures tests that the file of a stream is removed if a
+// chunk doesn't reach the minimum redundancy or reading the stream fails.
+func TestUploadStreamFailures(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencyDisableBackgroundLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// The second chunk doesn't reach the minimum redundancy.
+	data := fastrand.Bytes(int(streamChunkSize() + 1))
+	st := newStreamTester(t, r, "redundancy", bytes.NewReader(data))
+	uuc, _ := st.nextChunk()
+	uploadChunk(uuc, uuc.minimumPieces)
+	uuc, _ = st.nextChunk()
+	uploadChunk(uuc, uuc.minimumPieces-1)
+	if err := st.wait(); err == nil {
+		t.Fatal("upload should fail")
+	}
+
+	// The stream fails while the chunk is read.
+	stream := io.MultiReader(bytes.NewReader(data[:10]), errorReader{})
+	st = newStreamTester(t, r, "read", stream)
+	uuc, _ = st.nextChunk()
+	uploadChunk(uuc, uuc.minimumPieces)
+	if err := st.wait(); err == nil {
+		t.Fatal("upload should fail")
+	}
+
+	// The stream fails before the first chunk.
+	st = newStreamTester(t, r, "empty", errorReader{})
+	if err := st.wait(); err == nil {
+		t.Fatal("upload should fail")
+	}
+
+	for _, siaPath := range []string{"redundancy", "read", "empty"} {
+		if exists, _ := r.staticFileSet.Exists(siaPath); exists {
+			t.Error("file of failed upload wasn't removed:", siaPath)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package renter
+
+// versions.go keeps the old versions of the files below directories with a
+// version policy. Overwriting or deleting such a file moves its siafile into
+// the hidden versionDir of the renter's file tree instead of deleting it. The
+// versions of the file at siaPath are stored in the directory
+// versionDir/siaPath, and the name of every version is its id, the time at
+// which it was archived in nanoseconds since the unix epoch. Since versions
+// are regular siafiles, they are repaired and audited like any other file, and
+// their data stays on the hosts. The local path of a version is cleared when
+// it is archived, because the local file usually belongs to the version that
+// replaced it, so versions are always repaired from the network.
+//
+// Versions belong to the path of their file. They don't move when the file or
+// its directory is renamed. threadedVersionLoop periodically expires versions
+// according to the policy of their file. Versions of files that aren't
+// versioned anymore are kept until a policy applies to them again.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/errors"
+)
+
+var (
+	// errUnknownVersion is returned if a version of a file doesn't exist.
+	errUnknownVersion = errors.New("no version with that id exists")
+
+	// errVersionPath is returned if the user tries to access the hidden
+	// directory that contains the file versions.
+	errVersionPath = errors.New("hyperspacepath is reserved for file versions")
+)
+
+// fileVersion is a version of a file in versionDir.
+type fileVersion struct {
+	id          string
+	archiveTime time.Time
+}
+
+// isVersionPath returns whether siaPath is the directory that contains the
+// file versions or a path within that directory.
+func isVersionPath(siaPath string) bool {
+	return siaPath == versionDir || strings.HasPrefix(siaPath, versionDir+"/")
+}
+
+// isUploadPath returns whether siaPath is within one of the upload
+// directories of the S3 gateway and the WebDAV server, or is one of their
+// parents.
+func isUploadPath(siaPath string) bool {
+	for _, dir := range uploadDirs {
+		if siaPath == dir || strings.HasPrefix(siaPath, dir+"/") || strings.HasPrefix(dir, siaPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isHiddenPath returns whether siaPath is within one of the reserved
+// directories that are hidden from the user.
+func isHiddenPath(siaPath string) bool {
+	return isPackPath(siaPath) || isVersionPath(siaPath) || isUploadPath(siaPath)
+}
+
+// versionSiaPath returns the siapath of the version of the file at siaPath
+// with the provided id.
+func versionSiaPath(siaPath, id string) string {
+	return filepath.ToSlash(filepath.Join(versionDir, siaPath, id))
+}
+
+// versionFileSiaPath returns the siapath of the file that the version at
+// siaPath is a version of.
+func versionFileSiaPath(siaPath string) string {
+	return strings.TrimPrefix(dirSiaPath(siaPath), versionDir+"/")
+}
+
+// parseVersionID returns the archive time encoded in the id of a version.
+func parseVersionID(id string) (time.Time, error) {
+	nanos, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || nanos < 0 {
+		return time.Time{}, errUnknownVersion
+	}
+	return time.Unix(0, nanos), nil
+}
+
+// managedVersionPolicy returns the version policy that applies to the file at
+// siaPath. The zero policy is returned if the file isn't versioned.
+func (r *Renter) managedVersionPolicy(siaPath string) modules.VersionPolicy {
+	r.siaDirMu.Lock()
+	defer r.siaDirMu.Unlock()
+	for dir := dirSiaPath(siaPath); ; dir = dirSiaPath(dir) {
+		md, err := loadSiaDirMetadata(filepath.Join(r.filesDir, dir))
+		if err == nil && md.VersionPolicy != (modules.VersionPolicy{}) {
+			return md.VersionPolicy
+		}
+		if dir == "" {
+			return modules.VersionPolicy{}
+		}
+	}
+}
+
+// managedVersions returns the versions of the file at siaPath, newest first.
+func (r *Renter) managedVersions(siaPath string) ([]fileVersion, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(r.filesDir, versionDir, siaPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var versions []fileVersion
+	for _, fi := range fis {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != siafile.ShareExtension {
+			continue
+		}
+		id := strings.TrimSuffix(fi.Name(), siafile.ShareExtension)
+		archiveTime, err := parseVersionID(id)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, fileVersion{
+			id:          id,
+			archiveTime: archiveTime,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].archiveTime.After(versions[j].archiveTime)
+	})
+	return versions, nil
+}
+
+// managedArchiveFile moves the file at siaPath to a new version of the file.
+func (r *Renter) managedArchiveFile(siaPath string) error {
+	if exists, _ := r.staticFileSet.Exists(siaPath); !exists {
+		return siafile.ErrUnknownPath
+	}
+	versionPath := versionSiaPath(siaPath, strconv.FormatInt(time.Now().UnixNano(), 10))
+	lockID := r.mu.Lock()
+	err := r.createDirUnchecked(dirSiaPath(versionPath))
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return err
+	}
+	if err := r.staticFileSet.Rename(siaPath, versionPath); err != nil {
+		return err
+	}
+	r.staticFileIndex.managedRemove(siaPath)
+	entry, err := r.staticFileSet.Open(versionPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	if err := entry.SetLocalPath(""); err != nil {
+		return err
+	}
+	if err := r.managedBubbleFileHealth(entry); err != nil {
+		r.log.Println("WARN: Could not update the health of the directory of", versionPath, err)
+	}
+	if err := r.managedUpdateDirHealth(dirSiaPath(siaPath)); err != nil {
+		r.log.Println("WARN: Could not update the directory of", siaPath, err)
+	}
+	return nil
+}
+
+// managedPruneVersions deletes the versions of the file at siaPath that are
+// expired according to the file's version policy.
+func (r *Renter) managedPruneVersions(siaPath string) error {
+	policy := r.managedVersionPolicy(siaPath)
+	if policy == (modules.VersionPolicy{}) {
+		return nil
+	}
+	versions, err := r.managedVersions(siaPath)
+	if err != nil {
+		return err
+	}
+	maxAge := time.Duration(policy.MaxDays) * 24 * time.Hour
+	var remaining int
+	for i, version := range versions {
+		expired := policy.MaxVersions > 0 && uint64(i) >= policy.MaxVersions
+		expired = expired || (policy.MaxDays > 0 && time.Since(version.archiveTime) > maxAge)
+		if !expired {
+			remaining++
+			continue
+		}
+		if err := r.managedDeleteFile(versionSiaPath(siaPath, version.id)); err != nil && err != siafile.ErrUnknownPath {
+			return err
+		}
+	}
+	if remaining > 0 {
+		return nil
+	}
+
+	// Remove the directory of the versions unless it contains the versions
+	// of other files.
+	r.siaDirMu.Lock()
+	defer r.siaDirMu.Unlock()
+	dir := filepath.Join(r.filesDir, versionDir, siaPath)
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, fi := range fis {
+		if fi.Name() != SiaDirMetadata {
+			return nil
+		}
+	}
+	return os.RemoveAll(dir)
+}
+
+// managedArchiveDir moves the versioned files below the directory at siaPath
+// to new versions.
+func (r *Renter) managedArchiveDir(siaPath string) error {
+	siaPaths, err := r.managedFilesBelow(siaPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range siaPaths {
+		if r.managedVersionPolicy(file) == (modules.VersionPolicy{}) {
+			continue
+		}
+		if err := r.managedArchiveFile(file); err != nil && err != siafile.ErrUnknownPath {
+			return err
+		}
+		if err := r.managedPruneVersions(file); err != nil {
+			r.log.Println("WARN: Could not expire the versions of", file, err)
+		}
+	}
+	return nil
+}
+
+// FileVersions returns the old versions of the file at siaPath, newest first.
+func (r *Renter) FileVersions(siaPath string) ([]modules.FileVersion, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	if err := validateSiapath(siaPath); err != nil {
+		return nil, err
+	}
+	versions, err := r.managedVersions(siaPath)
+	if err != nil {
+		return nil, err
+	}
+	fvs := []modules.FileVersion{}
+	for _, version := range versions {
+		fi, err := r.managedFileInfo(versionSiaPath(siaPath, version.id))
+		if err != nil {
+			// The version might have expired in the meantime.
+			continue
+		}
+		fi.HyperspacePath = siaPath
+		fvs = append(fvs, modules.FileVersion{
+			ID:          version.id,
+			ArchiveTime: version.archiveTime,
+			File:        fi,
+		})
+	}
+	return fvs, nil
+}
+
+// RestoreFileVersion replaces the file at siaPath with the version with the
+// provided id. The replaced file becomes a new version if the file is
+// versioned, and is deleted otherwise.
+func (r *Renter) RestoreFileVersion(siaPath, id string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := validateSiapath(siaPath); err != nil {
+		return err
+	}
+	if _, err := parseVersionID(id); err != nil {
+		return err
+	}
+	versionPath := versionSiaPath(siaPath, id)
+	if exists, _ := r.staticFileSet.Exists(versionPath); !exists {
+		return errUnknownVersion
+	}
+
+	// Replace the current file. The versions are only pruned once the
+	// restored version has been moved out of the way, since it might be the
+	// oldest one.
+	var err error
+	if r.managedVersionPolicy(siaPath) != (modules.VersionPolicy{}) {
+		err = r.managedArchiveFile(siaPath)
+	} else {
+		err = r.managedDeleteFile(siaPath)
+	}
+	if err != nil && err != siafile.ErrUnknownPath {
+		return err
+	}
+	if dir := dirSiaPath(siaPath); dir != "" {
+		lockID := r.mu.Lock()
+		err := r.createDir(dir)
+		r.mu.Unlock(lockID)
+		if err != nil {
+			return err
+		}
+	}
+	if err := r.staticFileSet.Rename(versionPath, siaPath); err != nil {
+		return err
+	}
+	if err := r.managedPruneVersions(siaPath); err != nil {
+		r.log.Println("WARN: Could not expire the versions of", siaPath, err)
+	}
+
+	// Move the health of the version to the directory of the file.
+	entry, err := r.staticFileSet.Open(siaPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	if err := r.managedBubbleFileHealth(entry); err != nil {
+		r.log.Println("WARN: Could not update the health of the directory of", siaPath, err)
+	}
+	if err := r.managedUpdateDirHealth(dirSiaPath(versionPath)); err != nil {
+		r.log.Println("WARN: Could not update the health of", dirSiaPath(versionPath), err)
+	}
+	return nil
+}
+
+// SetDirVersionPolicy attaches a version policy to the directory at siaPath.
+// The zero policy detaches the directory's policy.
+func (r *Renter) SetDirVersionPolicy(siaPath string, policy modules.VersionPolicy) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	siaPath = strings.Trim(siaPath, "/")
+	if siaPath != "" {
+		if err := validateSiapath(siaPath); err != nil {
+			return err
+		}
+	}
+
+	r.siaDirMu.Lock()
+	defer r.siaDirMu.Unlock()
+	path := filepath.Join(r.filesDir, siaPath)
+	if fi, err := os.Stat(path); os.IsNotExist(err) || (err == nil && !fi.IsDir()) {
+		return siafile.ErrUnknownDir
+	} else if err != nil {
+		return err
+	}
+	md, err := loadSiaDirMetadata(path)
+	if err != nil {
+		return err
+	}
+	md.VersionPolicy = policy
+	return saveSiaDirMetadata(path, md)
+}
+
+// threadedVersionLoop periodically expires the versions of the renter's files.
+func (r *Renter) threadedVersionLoop() {
+	err := r.tg.Add()
+	if err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	for {
+		select {
+		case <-time.After(versionPruneInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+
+		// Collect the files that have versions.
+		siaPaths, err := r.managedFilesBelow(versionDir)
+		if err != nil {
+			r.log.Println("WARN: Could not list the file versions:", err)
+			continue
+		}
+		files := make(map[string]struct{})
+		for _, siaPath := range siaPaths {
+			files[strings.TrimPrefix(dirSiaPath(siaPath), versionDir+"/")] = struct{}{}
+		}
+		for file := range files {
+			select {
+			case <-r.tg.StopChan():
+				return
+			default:
+			}
+			if err := r.managedPruneVersions(file); err != nil {
+				r.log.Println("WARN: Could not expire the versions of", file, err)
+			}
+		}
+	}
+}
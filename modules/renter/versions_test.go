@@ -0,0 +1,347 @@
+package renter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+)
+
+// newSizedTestFile creates an empty file of the provided size at siaPath.
+func (r *Renter) newSizedTestFile(siaPath string, size uint64) error {
+	rsc, _ := siafile.NewRSCode(1, 1)
+	up := modules.FileUploadParams{
+		HyperspacePath: siaPath,
+		ErasureCode:    rsc,
+	}
+	entry, err := r.staticFileSet.NewSiaFile(up, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), size, 0777)
+	if err != nil {
+		return err
+	}
+	return entry.Close()
+}
+
+// newVersionTester creates a renter tester with the versioned directory
+// "docs".
+func newVersionTester(name string, policy modules.VersionPolicy) (*renterTester, error) {
+	rt, err := newRenterTester(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := rt.renter.CreateDir("docs"); err != nil {
+		return nil, err
+	}
+	if err := rt.renter.SetDirVersionPolicy("docs", policy); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// TestVersionPaths tests the siapaths of file versions.
+func TestVersionPaths(t *testing.T) {
+	id := "1537675200000000000"
+	versionPath := versionSiaPath("foo/bar", id)
+	if versionPath != versionDir+"/foo/bar/"+id {
+		t.Fatal("unexpected version path", versionPath)
+	}
+	if !isVersionPath(versionPath) || !isHiddenPath(versionPath) || !isVersionPath(versionDir) {
+		t.Error("version path isn't hidden")
+	}
+	if isVersionPath("foo/bar") || isVersionPath(versionDir+"foo") {
+		t.Error("regular path is a version path")
+	}
+	if err := validateSiapath(versionPath); err != errVersionPath {
+		t.Error("expected errVersionPath, got", err)
+	}
+	if siaPath := versionFileSiaPath(versionPath); siaPath != "foo/bar" {
+		t.Error("unexpected file of version", siaPath)
+	}
+
+	archiveTime, err := parseVersionID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !archiveTime.Equal(time.Unix(1537675200, 0)) {
+		t.Error("unexpected archive time", archiveTime)
+	}
+	for _, invalid := range []string{"", "foo", "-1", "../1"} {
+		if _, err := parseVersionID(invalid); err != errUnknownVersion {
+			t.Errorf("expected %q to be invalid, got %v", invalid, err)
+		}
+	}
+}
+
+// TestVersionArchive tests that overwriting and deleting a versioned file
+// keeps the old file as a version, and that unversioned and purged files are
+// deleted.
+func TestVersionArchive(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newVersionTester(t.Name(), modules.VersionPolicy{MaxVersions: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Deleting the file archives it.
+	if err := r.newSizedTestFile("docs/a", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteFile("docs/a"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := r.staticFileSet.Exists("docs/a"); exists {
+		t.Fatal("deleted file still exists")
+	}
+	versions, err := r.FileVersions("docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].File.HyperspacePath != "docs/a" || versions[0].File.Filesize != 1000 {
+		t.Fatal("expected one version of the deleted file", versions)
+	}
+
+	// Overwriting the file archives it as well.
+	if err := r.newSizedTestFile("docs/a", 2000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.managedInitUpload(modules.FileUploadParams{HyperspacePath: "docs/a", Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	versions, err = r.FileVersions("docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].File.Filesize != 2000 || versions[1].File.Filesize != 1000 {
+		t.Fatal("expected the overwritten file to be the newest version", versions)
+	}
+
+	// Purged and unversioned files aren't archived.
+	if err := r.newSizedTestFile("docs/b", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.PurgeFile("docs/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.newSizedTestFile("c", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteFile("c"); err != nil {
+		t.Fatal(err)
+	}
+	for _, siaPath := range []string{"docs/b", "c"} {
+		if versions, err := r.FileVersions(siaPath); err != nil || len(versions) != 0 {
+			t.Fatal("expected no versions of", siaPath, versions, err)
+		}
+	}
+}
+
+// TestReplaceFile tests that replacing a file deletes the replaced file, or
+// keeps it as a version if it is versioned.
+func TestReplaceFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newVersionTester(t.Name(), modules.VersionPolicy{MaxVersions: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Replacing a file that doesn't exist moves the file and creates the
+	// directory.
+	if err := r.newSizedTestFile("tmp/1", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ReplaceFile("tmp/1", "dir/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.DirList("dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unversioned files are replaced without keeping a version.
+	if err := r.newSizedTestFile("tmp/2", 2000); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ReplaceFile("tmp/2", "dir/a"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := r.File("dir/a"); err != nil || fi.Filesize != 2000 {
+		t.Fatal("file wasn't replaced", fi.Filesize, err)
+	}
+	if versions, err := r.FileVersions("dir/a"); err != nil || len(versions) != 0 {
+		t.Fatal("expected no versions", versions, err)
+	}
+
+	// Versioned files are kept as a version.
+	for i, size := range []uint64{1000, 2000} {
+		tmpPath := "tmp/" + strconv.Itoa(3+i)
+		if err := r.newSizedTestFile(tmpPath, size); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.ReplaceFile(tmpPath, "docs/a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fi, err := r.File("docs/a"); err != nil || fi.Filesize != 2000 {
+		t.Fatal("file wasn't replaced", fi.Filesize, err)
+	}
+	versions, err := r.FileVersions("docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].File.Filesize != 1000 {
+		t.Fatal("expected the replaced file to be a version", versions)
+	}
+	for _, siaPath := range []string{"tmp/1", "tmp/2", "tmp/3", "tmp/4"} {
+		if exists, _ := r.staticFileSet.Exists(siaPath); exists {
+			t.Fatal("replacement still exists at", siaPath)
+		}
+	}
+}
+
+// TestUploadFiles tests that the upload directories of the S3 gateway and the
+// WebDAV server are hidden, and that interrupted uploads are removed.
+func TestUploadFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	for _, siaPath := range []string{".s3", modules.S3UploadDir + "/x", modules.WebDAVUploadDir} {
+		if !isHiddenPath(siaPath) {
+			t.Error(siaPath, "isn't hidden")
+		}
+	}
+	for _, siaPath := range []string{".s3foo", ".webdavfoo/x", "foo/.webdav"} {
+		if isHiddenPath(siaPath) {
+			t.Error(siaPath, "is hidden")
+		}
+	}
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+	uploads := []string{modules.S3UploadDir + "/x", modules.WebDAVUploadDir + "/y"}
+	for _, siaPath := range append(uploads, "z") {
+		if err := r.newSizedTestFile(siaPath, 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.managedRemoveUploadFiles()
+	for _, siaPath := range uploads {
+		if exists, _ := r.staticFileSet.Exists(siaPath); exists {
+			t.Fatal("upload wasn't removed", siaPath)
+		}
+	}
+	if exists, _ := r.staticFileSet.Exists("z"); !exists {
+		t.Fatal("regular file was removed")
+	}
+}
+
+// TestVersionPruning tests that versions expire once there are enough newer
+// versions or once they are too old.
+func TestVersionPruning(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newVersionTester(t.Name(), modules.VersionPolicy{MaxVersions: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Only the two newest versions are kept.
+	for size := uint64(1000); size <= 3000; size += 1000 {
+		if err := r.newSizedTestFile("docs/a", size); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.DeleteFile("docs/a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := r.FileVersions("docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].File.Filesize != 3000 || versions[1].File.Filesize != 2000 {
+		t.Fatal("expected the two newest versions", versions)
+	}
+
+	// Backdate the older version and expire versions older than a day.
+	oldID := strconv.FormatInt(time.Now().Add(-48*time.Hour).UnixNano(), 10)
+	if err := r.staticFileSet.Rename(versionSiaPath("docs/a", versions[1].ID), versionSiaPath("docs/a", oldID)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetDirVersionPolicy("docs", modules.VersionPolicy{MaxDays: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.managedPruneVersions("docs/a"); err != nil {
+		t.Fatal(err)
+	}
+	versions, err = r.FileVersions("docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].File.Filesize != 3000 {
+		t.Fatal("expected only the recent version", versions)
+	}
+}
+
+// TestRestoreFileVersion tests that restoring a version replaces the file and
+// archives the replaced file.
+func TestRestoreFileVersion(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newVersionTester(t.Name(), modules.VersionPolicy{MaxVersions: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	if err := r.newSizedTestFile("docs/a", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteFile("docs/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.newSizedTestFile("docs/a", 2000); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := r.FileVersions("docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RestoreFileVersion("docs/a", "1"); err != errUnknownVersion {
+		t.Fatal("expected errUnknownVersion, got", err)
+	}
+	if err := r.RestoreFileVersion("docs/a", versions[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := r.File("docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Filesize != 1000 {
+		t.Fatal("expected the restored version, got size", fi.Filesize)
+	}
+	versions, err = r.FileVersions("docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].File.Filesize != 2000 {
+		t.Fatal("expected the replaced file to be archived", versions)
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/crypto"
 )
 
 // managedDownload will perform some download work.
@@ -37,7 +37,7 @@ func (w *worker) managedDownload(udc *unfinishedDownloadChunk) {
 	}
 	defer d.Close()
 	root := udc.staticChunkMap[string(w.contract.HostPublicKey.Key)].root
-	pieceData, err := d.Download(root, 0, uint32(modules.SectorSize))
+	pieceData, err := d.Download(root, uint32(udc.staticPieceOffset), uint32(udc.staticPieceLength))
 	if err != nil {
 		w.renter.log.Debugln("worker failed to download sector:", err)
 		udc.managedUnregisterWorker(w)
@@ -48,14 +48,14 @@ func (w *worker) managedDownload(udc *unfinishedDownloadChunk) {
 	// in. Perhaps even include the data from creating the downloader and other
 	// data sent to and received from the host (like signatures) that aren't
 	// actually payload data.
-	atomic.AddUint64(&udc.download.atomicTotalDataTransferred, udc.staticPieceSize)
+	atomic.AddUint64(&udc.download.atomicTotalDataTransferred, udc.staticPieceLength)
 
 	// Decrypt the piece. This might introduce some overhead for downloads with
 	// a large overdrive. It shouldn't be a bottleneck though since bandwidth
 	// is usually a lot more scarce than CPU processing power.
 	pieceIndex := udc.staticChunkMap[string(w.contract.HostPublicKey.Key)].index
-	key := udc.masterKey.Derive(udc.staticChunkIndex, pieceIndex)
-	decryptedPiece, err := key.DecryptBytesInPlace(pieceData, 0)
+	key := udc.renterFile.PieceKey(udc.staticChunkIndex, pieceIndex)
+	decryptedPiece, err := key.DecryptBytesInPlace(pieceData, udc.staticPieceOffset/crypto.SegmentSize)
 	if err != nil {
 		w.renter.log.Debugln("worker failed to decrypt piece:", err)
 		udc.managedUnregisterWorker(w)
@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/proto"
+	"github.com/HyperspaceApp/errors"
 )
 
 // managedDropChunk will remove a worker from the responsibility of tracking a chunk.
@@ -111,6 +113,11 @@ func (w *worker) managedUpload(uc *unfinishedUploadChunk, pieceIndex uint64) {
 	root, err := e.Upload(uc.physicalChunkData[pieceIndex])
 	if err != nil {
 		w.renter.log.Debugln("Worker failed to upload via the editor:", err)
+		if errors.Contains(err, proto.ErrInsufficientUploadFunds) {
+			uc.mu.Lock()
+			uc.outOfFunds = true
+			uc.mu.Unlock()
+		}
 		w.managedUploadFailed(uc, pieceIndex)
 		return
 	}
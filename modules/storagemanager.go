@@ -2,6 +2,7 @@ package modules
 
 import (
 	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/errors"
 )
 
 const (
@@ -14,6 +15,12 @@ const (
 	StorageManagerDir = "storagemanager"
 )
 
+var (
+	// ErrSectorNotFound is returned when a lookup for a sector fails. Hosts
+	// send it to renters that request a sector they don't store.
+	ErrSectorNotFound = errors.New("could not find the desired sector")
+)
+
 type (
 	// StorageFolderMetadata contains metadata about a storage folder that is
 	// tracked by the storage folder manager.
@@ -66,9 +66,15 @@ type (
 	// A TransactionPoolDiff indicates the adding or removal of a transaction set to
 	// the transaction pool. The transactions in the pool are not persisted, so at
 	// startup modules should assume an empty transaction pool.
+	//
+	// ConfirmedTransactions lists the transactions of the reverted sets that
+	// left the pool because they were confirmed in a block. Subscribers that
+	// process the block after the transaction pool can use it to tell
+	// confirmed transactions apart from evicted or double-spent ones.
 	TransactionPoolDiff struct {
-		AppliedTransactions  []*UnconfirmedTransactionSet
-		RevertedTransactions []TransactionSetID
+		AppliedTransactions   []*UnconfirmedTransactionSet
+		RevertedTransactions  []TransactionSetID
+		ConfirmedTransactions []types.TransactionID
 	}
 
 	// UnconfirmedTransactionSet defines a new unconfirmed transaction that has
@@ -333,7 +333,7 @@ func (tp *TransactionPool) AcceptTransactionSet(ts []types.Transaction) error {
 		}
 		go tp.gateway.Broadcast("RelayTransactionSet", ts, tp.gateway.Peers())
 		// Notify subscribers of an accepted transaction set
-		tp.updateSubscribersTransactions()
+		tp.updateSubscribersTransactions(nil)
 		tp.log.Debugln("Transaction set broadcast appears to have succeeded")
 		return nil
 	})
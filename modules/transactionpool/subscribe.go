@@ -8,8 +8,9 @@ import (
 )
 
 // updateSubscribersTransactions sends a new transaction pool update to all
-// subscribers.
-func (tp *TransactionPool) updateSubscribersTransactions() {
+// subscribers. confirmed contains the IDs of the transactions that were just
+// confirmed in a block, it is nil if the update isn't caused by a block.
+func (tp *TransactionPool) updateSubscribersTransactions(confirmed map[types.TransactionID]struct{}) {
 	diff := new(modules.TransactionPoolDiff)
 	// Create all of the diffs for reverted sets.
 	for id := range tp.subscriberSets {
@@ -23,6 +24,11 @@ func (tp *TransactionPool) updateSubscribersTransactions() {
 		// Report that this set has been removed. Negative diffs don't have all
 		// fields filled out.
 		diff.RevertedTransactions = append(diff.RevertedTransactions, modules.TransactionSetID(id))
+		for _, txid := range tp.subscriberSets[id].IDs {
+			if _, exists := confirmed[txid]; exists {
+				diff.ConfirmedTransactions = append(diff.ConfirmedTransactions, txid)
+			}
+		}
 	}
 
 	// Clear the subscriber sets map.
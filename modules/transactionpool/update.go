@@ -402,7 +402,7 @@ func (tp *TransactionPool) ProcessConsensusChange(cc modules.ConsensusChange) {
 
 	// Inform subscribers that an update has executed.
 	tp.mu.Demote()
-	tp.updateSubscribersTransactions()
+	tp.updateSubscribersTransactions(txids)
 	tp.mu.DemotedUnlock()
 }
 
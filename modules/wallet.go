@@ -32,6 +32,72 @@ const (
 	// Bitcoin defaults to 20, but we can create a lot of addresses quickly
 	// when we form contracts, so we set to 50.
 	DefaultAddressGapLimit = 50
+
+	// DefaultPaymentRequestConfirmations is the number of confirmations a
+	// payment request is tracked for after it has been paid in full, unless
+	// the creator of the request asks for a different number.
+	DefaultPaymentRequestConfirmations = 6
+
+	// DefaultConsolidationTargetOutputs is the number of spendable outputs
+	// the wallet consolidates down to if the consolidation policy does not
+	// specify a target.
+	DefaultConsolidationTargetOutputs = 50
+
+	// DefaultTransactionHistoryLimit is the number of transactions returned
+	// per page of transaction history if the query does not specify a limit.
+	DefaultTransactionHistoryLimit = 100
+
+	// MaxTransactionHistoryLimit is the maximum number of transactions
+	// returned per page of transaction history.
+	MaxTransactionHistoryLimit = 1000
+)
+
+const (
+	// TxnCategoryMiner matches transactions that pay a block reward to the
+	// wallet.
+	TxnCategoryMiner = "miner"
+
+	// TxnCategoryContract matches transactions that form, revise or prove
+	// file contracts.
+	TxnCategoryContract = "contract"
+
+	// TxnCategorySend matches transactions that spend coins of the wallet.
+	TxnCategorySend = "send"
+
+	// TxnCategoryReceive matches transactions that send coins to the
+	// wallet, not counting block rewards.
+	TxnCategoryReceive = "receive"
+
+	// TxnCategoryWatch matches transactions that involve a watched address.
+	TxnCategoryWatch = "watch"
+)
+
+const (
+	// PaymentRequestUnpaid indicates that no coins have been sent to the
+	// address of a payment request yet.
+	PaymentRequestUnpaid PaymentRequestStatus = "unpaid"
+
+	// PaymentRequestSeen indicates that a payment to the address of a
+	// payment request is sitting in the transaction pool, but nothing has
+	// been confirmed yet.
+	PaymentRequestSeen PaymentRequestStatus = "seen"
+
+	// PaymentRequestPartial indicates that some, but not all, of the
+	// requested amount has been confirmed.
+	PaymentRequestPartial PaymentRequestStatus = "partial"
+
+	// PaymentRequestPaid indicates that the full requested amount has been
+	// confirmed. The Confirmations field of the request reports how deep the
+	// payment is buried.
+	PaymentRequestPaid PaymentRequestStatus = "paid"
+
+	// PaymentRequestExpired indicates that the expiry height of a payment
+	// request was reached before it was paid in full.
+	PaymentRequestExpired PaymentRequestStatus = "expired"
+
+	// PaymentRequestReverted indicates that confirmed payments to the
+	// request were removed from the blockchain by a reorg.
+	PaymentRequestReverted PaymentRequestStatus = "reverted"
 )
 
 var (
@@ -60,6 +126,18 @@ var (
 	// ErrAddressGapLimit is return when a user tries to create a new address
 	// that does not respect the address gap limit as specified in BIP 44
 	ErrAddressGapLimit = errors.New("cannot create new address beyond address gap limit")
+
+	// ErrUnknownPaymentRequest is returned when a payment request is looked
+	// up by an address that the wallet did not create a request for.
+	ErrUnknownPaymentRequest = errors.New("no payment request exists for that address")
+
+	// ErrUnknownWallet is returned when a named wallet is requested that
+	// does not exist or is not loaded.
+	ErrUnknownWallet = errors.New("no wallet with that name is loaded")
+
+	// ErrWalletInUse is returned when a named wallet can't be unloaded
+	// because another module funds itself from it.
+	ErrWalletInUse = errors.New("wallet is in use by another module")
 )
 
 type (
@@ -70,6 +148,77 @@ type (
 	// WalletTransactionID is a unique identifier for a wallet transaction.
 	WalletTransactionID crypto.Hash
 
+	// PaymentRequestStatus describes how far a payment request has
+	// progressed towards being paid.
+	PaymentRequestStatus string
+
+	// A PaymentRequest asks for a certain amount of space cash to be sent to
+	// a fresh wallet address. The address uniquely identifies the request.
+	// The wallet tracks every request through confirmed blocks and the
+	// transaction pool until it has either expired or been paid and buried
+	// under RequiredConfirmations blocks.
+	PaymentRequest struct {
+		Address               types.UnlockHash  `json:"address"`
+		Amount                types.Currency    `json:"amount"`
+		Label                 string            `json:"label"`
+		CallbackURL           string            `json:"callbackurl"`
+		CreationHeight        types.BlockHeight `json:"creationheight"`
+		ExpiryHeight          types.BlockHeight `json:"expiryheight"`
+		RequiredConfirmations uint64            `json:"requiredconfirmations"`
+
+		Status         PaymentRequestStatus  `json:"status"`
+		Received       types.Currency        `json:"received"`
+		Unconfirmed    types.Currency        `json:"unconfirmed"`
+		PaidHeight     types.BlockHeight     `json:"paidheight"`
+		Confirmations  uint64                `json:"confirmations"`
+		TransactionIDs []types.TransactionID `json:"transactionids"`
+	}
+
+	// A PaymentRequestUpdate is sent to subscribers and to the callback URL
+	// of a payment request whenever the tracked state of the request
+	// changes.
+	PaymentRequestUpdate struct {
+		PaymentRequest PaymentRequest       `json:"paymentrequest"`
+		PreviousStatus PaymentRequestStatus `json:"previousstatus"`
+	}
+
+	// A PaymentRequestSubscriber receives updates about payment requests.
+	// ReceivePaymentRequestUpdate is called after the wallet lock is
+	// released, one update at a time and in order, so it may call back into
+	// the wallet but should not block.
+	PaymentRequestSubscriber interface {
+		ReceivePaymentRequestUpdate(PaymentRequestUpdate)
+	}
+
+	// A BatchPayment is a single row of a batch payout.
+	BatchPayment struct {
+		Address types.UnlockHash `json:"address"`
+		Amount  types.Currency   `json:"amount"`
+		Label   string           `json:"label"`
+	}
+
+	// BatchPaymentResult reports what happened to a single row of a batch
+	// payout. Batch is the index of the transaction the row was placed in.
+	// TransactionID is only set once the transaction has been accepted by the
+	// transaction pool, and Error is set if sending the batch failed.
+	BatchPaymentResult struct {
+		BatchPayment
+		Batch         int                 `json:"batch"`
+		TransactionID types.TransactionID `json:"transactionid"`
+		Error         string              `json:"error,omitempty"`
+	}
+
+	// A BatchPaymentReport describes how a batch payout was split into
+	// transactions and what it costs. For a dry run nothing is sent and no
+	// transaction ids are reported.
+	BatchPaymentReport struct {
+		DryRun        bool                 `json:"dryrun"`
+		Transactions  int                  `json:"transactions"`
+		TotalAmount   types.Currency       `json:"totalamount"`
+		EstimatedFees types.Currency       `json:"estimatedfees"`
+		Results       []BatchPaymentResult `json:"results"`
+	}
+
 	// A ProcessedInput represents funding to a transaction. The input is
 	// coming from an address and going to the outputs. The fund type is
 	// 'SiacoinInput'.
@@ -119,6 +268,40 @@ type (
 		Outputs []ProcessedOutput `json:"outputs"`
 	}
 
+	// A TransactionHistoryQuery selects a page of the wallet's confirmed
+	// transactions. All filters are optional and combined with AND. Zero
+	// values of MaxHeight and MaxTime mean that there is no upper bound.
+	//
+	// Addresses restricts the result to transactions involving at least one
+	// of the given addresses, and Label to transactions involving an address
+	// with that label. Category is one of the TxnCategory constants.
+	// MinValue is compared to the larger of the value the transaction spends
+	// from and the value it sends to the wallet's and watched addresses.
+	//
+	// Cursor is the NextCursor of the previous page, or empty for the first
+	// page. Limit defaults to DefaultTransactionHistoryLimit and is capped at
+	// MaxTransactionHistoryLimit.
+	TransactionHistoryQuery struct {
+		Addresses  []types.UnlockHash `json:"addresses"`
+		MinHeight  types.BlockHeight  `json:"minheight"`
+		MaxHeight  types.BlockHeight  `json:"maxheight"`
+		MinTime    types.Timestamp    `json:"mintime"`
+		MaxTime    types.Timestamp    `json:"maxtime"`
+		Category   string             `json:"category"`
+		MinValue   types.Currency     `json:"minvalue"`
+		Label      string             `json:"label"`
+		Descending bool               `json:"descending"`
+		Cursor     string             `json:"cursor"`
+		Limit      int                `json:"limit"`
+	}
+
+	// A TransactionHistoryPage is a page of transaction history. NextCursor
+	// is empty if there are no more matching transactions.
+	TransactionHistoryPage struct {
+		Transactions []ProcessedTransaction `json:"transactions"`
+		NextCursor   string                 `json:"nextcursor"`
+	}
+
 	// A UnspentOutput is a SiacoinOutput or SiafundOutput that the wallet
 	// is tracking.
 	UnspentOutput struct {
@@ -417,6 +600,13 @@ type (
 		// Close permits clean shutdown during testing and serving.
 		Close() error
 
+		// CreatePaymentRequest creates a payment request for amount on a
+		// fresh address from the primary seed. The request expires after
+		// expiry blocks, or never if expiry is zero. Once paid, the request
+		// is tracked for the given number of confirmations. If callbackURL
+		// is not empty, every update to the request is POSTed to it as JSON.
+		CreatePaymentRequest(amount types.Currency, label string, expiry types.BlockHeight, confirmations uint64, callbackURL string) (PaymentRequest, error)
+
 		// ConfirmedBalance returns the confirmed balance of the wallet, minus
 		// any outgoing transactions. ConfirmedBalance will include unconfirmed
 		// refund transactions.
@@ -468,10 +658,31 @@ type (
 		// included.
 		Transactions(startHeight types.BlockHeight, endHeight types.BlockHeight) ([]ProcessedTransaction, error)
 
+		// TransactionHistory returns a page of confirmed transactions
+		// matching the query. Pages are addressed by an opaque cursor that
+		// stays valid as new blocks are processed.
+		TransactionHistory(TransactionHistoryQuery) (TransactionHistoryPage, error)
+
 		// UnconfirmedTransactions returns all unconfirmed transactions
 		// relative to the wallet.
 		UnconfirmedTransactions() ([]ProcessedTransaction, error)
 
+		// PaymentRequest returns the payment request that was created for
+		// addr.
+		PaymentRequest(addr types.UnlockHash) (PaymentRequest, error)
+
+		// PaymentRequests returns all payment requests known to the wallet,
+		// ordered by creation height.
+		PaymentRequests() ([]PaymentRequest, error)
+
+		// PaymentRequestSubscribe adds a subscriber that will be notified
+		// of every update to a payment request.
+		PaymentRequestSubscribe(PaymentRequestSubscriber)
+
+		// PaymentRequestUnsubscribe removes a subscriber that was added
+		// with PaymentRequestSubscribe.
+		PaymentRequestUnsubscribe(PaymentRequestSubscriber)
+
 		// RegisterTransaction takes a transaction and its parents and returns
 		// a TransactionBuilder which can be used to expand the transaction.
 		RegisterTransaction(t types.Transaction, parents []types.Transaction) (TransactionBuilder, error)
@@ -520,6 +731,25 @@ type (
 		// SendSiacoinsMulti sends coins to multiple addresses.
 		SendSiacoinsMulti(outputs []types.SiacoinOutput) ([]types.Transaction, error)
 
+		// Consolidate merges the wallet's smallest outputs into larger ones
+		// according to the consolidation policy in the wallet settings. It
+		// runs even if the policy is disabled or fees are above the policy's
+		// maximum fee rate.
+		Consolidate() (ConsolidationReport, error)
+
+		// SetAddressLabel attaches a label to an address. An empty label
+		// removes the existing label.
+		SetAddressLabel(addr types.UnlockHash, label string) error
+
+		// AddressLabels returns all labeled addresses.
+		AddressLabels() (map[types.UnlockHash]string, error)
+
+		// SendSiacoinsBatch sends a list of payments, splitting it into as
+		// many transactions as needed to stay under the standard transaction
+		// size limit. If dryRun is set, the payments are only validated and
+		// the fees estimated.
+		SendSiacoinsBatch(payments []BatchPayment, dryRun bool) (BatchPaymentReport, error)
+
 		// DustThreshold returns the quantity per byte below which a Currency is
 		// considered to be Dust.
 		DustThreshold() (types.Currency, error)
@@ -536,9 +766,68 @@ type (
 		WatchAddresses() ([]types.UnlockHash, error)
 	}
 
+	// WalletInfo describes a named wallet known to a WalletManager.
+	WalletInfo struct {
+		Name     string `json:"name"`
+		Loaded   bool   `json:"loaded"`
+		Unlocked bool   `json:"unlocked"`
+		InUse    bool   `json:"inuse"`
+	}
+
+	// A WalletManager manages the named wallets of a node. Every named wallet
+	// is a separate Wallet with its own seed, address index, watch list and
+	// database, and can be locked and unlocked independently. The default
+	// wallet of the node is not managed and has the empty name.
+	WalletManager interface {
+		// CreateWallet creates a new, uninitialized named wallet and loads
+		// it.
+		CreateWallet(name string) (Wallet, error)
+
+		// LoadWallet loads an existing named wallet.
+		LoadWallet(name string) (Wallet, error)
+
+		// UnloadWallet closes a named wallet. It stays on disk and can be
+		// loaded again.
+		UnloadWallet(name string) error
+
+		// Wallet returns the loaded wallet with the given name. The empty
+		// name refers to the default wallet.
+		Wallet(name string) (Wallet, error)
+
+		// Wallets lists every named wallet on disk.
+		Wallets() ([]WalletInfo, error)
+
+		// Close closes every loaded named wallet. The default wallet is not
+		// closed.
+		Close() error
+	}
+
 	// WalletSettings control the behavior of the Wallet.
 	WalletSettings struct {
-		NoDefrag bool `json:"noDefrag"`
+		NoDefrag      bool                `json:"noDefrag"`
+		Consolidation ConsolidationPolicy `json:"consolidation"`
+	}
+
+	// A ConsolidationPolicy controls how the wallet merges small outputs into
+	// larger ones. If Enabled is set, the wallet consolidates in the
+	// background whenever it has more than TargetOutputs spendable outputs
+	// and the transaction pool's fee estimate is at most MaxFeeRate hastings
+	// per byte. Outputs sent to addresses with one of the ExcludedLabels are
+	// never consolidated.
+	ConsolidationPolicy struct {
+		Enabled        bool           `json:"enabled"`
+		TargetOutputs  uint64         `json:"targetoutputs"`
+		MaxFeeRate     types.Currency `json:"maxfeerate"`
+		ExcludedLabels []string       `json:"excludedlabels"`
+	}
+
+	// A ConsolidationReport describes the transactions created by a
+	// consolidation run.
+	ConsolidationReport struct {
+		OutputsBefore  int                   `json:"outputsbefore"`
+		OutputsMerged  int                   `json:"outputsmerged"`
+		Fees           types.Currency        `json:"fees"`
+		TransactionIDs []types.TransactionID `json:"transactionids"`
 	}
 )
 
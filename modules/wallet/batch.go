@@ -0,0 +1,200 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/encoding"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+const (
+	// batchInputReserve is the number of bytes of every batch transaction
+	// that are left free for the inputs, signatures, miner fee and refund
+	// output added by the transaction builder. The remainder of
+	// modules.TransactionSizeLimit is filled with payment outputs.
+	batchInputReserve = 8e3
+
+	// batchTransactionOverhead is the estimated size in bytes of a batch
+	// transaction without any payment outputs. It is used for fee
+	// estimation, and matches the estimate used by SendSiacoinsMulti.
+	batchTransactionOverhead = 1000
+)
+
+var (
+	errEmptyBatch      = errors.New("batch contains no payments")
+	errZeroBatchAmount = errors.New("batch payment has a zero amount")
+)
+
+// splitBatchPayments splits payments into groups of consecutive rows whose
+// outputs fit into a single standard transaction. The encoded size of the
+// outputs of every group is returned alongside the groups.
+func splitBatchPayments(payments []modules.BatchPayment) (batches [][]modules.BatchPayment, sizes []uint64) {
+	limit := uint64(modules.TransactionSizeLimit - batchInputReserve)
+	var current []modules.BatchPayment
+	var currentSize uint64
+	for _, p := range payments {
+		size := uint64(len(encoding.Marshal(types.SiacoinOutput{
+			Value:      p.Amount,
+			UnlockHash: p.Address,
+		})))
+		if len(current) > 0 && currentSize+size > limit {
+			batches = append(batches, current)
+			sizes = append(sizes, currentSize)
+			current, currentSize = nil, 0
+		}
+		current = append(current, p)
+		currentSize += size
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+		sizes = append(sizes, currentSize)
+	}
+	return batches, sizes
+}
+
+// batchFee returns the miner fee for a batch transaction whose payment
+// outputs have the given encoded size.
+func batchFee(maxFee types.Currency, outputSize uint64) types.Currency {
+	// We don't want batch transactions to fail, so pay twice the estimate
+	// like SendSiacoinsMulti does.
+	return maxFee.Mul64(2).Mul64(batchTransactionOverhead + outputSize)
+}
+
+// sendBatch funds, signs and broadcasts a single batch transaction. The id of
+// the transaction containing each payment is returned in order.
+func (w *Wallet) sendBatch(payments []modules.BatchPayment, fee types.Currency) (txids []types.TransactionID, err error) {
+	outputs := make([]types.SiacoinOutput, 0, len(payments))
+	for _, p := range payments {
+		outputs = append(outputs, types.SiacoinOutput{
+			Value:      p.Amount,
+			UnlockHash: p.Address,
+		})
+	}
+
+	txnBuilder, err := w.StartTransactionSet()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			txnBuilder.Drop()
+		}
+	}()
+	err = txnBuilder.FundOutputs(outputs, fee)
+	if err != nil {
+		return nil, build.ExtendErr("unable to fund transaction", err)
+	}
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		return nil, build.ExtendErr("unable to sign transaction", err)
+	}
+	err = w.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		return nil, build.ExtendErr("unable to get transaction accepted", err)
+	}
+
+	// The builder may spread the outputs over several chained transactions,
+	// so look up the transaction each output ended up in. Outputs are added
+	// in order, which keeps duplicate rows apart.
+	txids = make([]types.TransactionID, len(outputs))
+	next := 0
+	for _, txn := range txnSet {
+		for _, sco := range txn.SiacoinOutputs {
+			if next < len(outputs) && sco.UnlockHash == outputs[next].UnlockHash && sco.Value.Equals(outputs[next].Value) {
+				txids[next] = txn.ID()
+				next++
+			}
+		}
+	}
+	return txids, nil
+}
+
+// SendSiacoinsBatch sends a list of payments, splitting it into as many
+// transactions as needed to stay under the standard transaction size limit.
+// The transactions are sent one after another, so if one of them fails, the
+// rows of the earlier transactions have still been paid. If dryRun is set,
+// the payments are only validated and the fees estimated.
+func (w *Wallet) SendSiacoinsBatch(payments []modules.BatchPayment, dryRun bool) (report modules.BatchPaymentReport, err error) {
+	if err := w.tg.Add(); err != nil {
+		return modules.BatchPaymentReport{}, modules.ErrWalletShutdown
+	}
+	defer w.tg.Done()
+
+	if len(payments) == 0 {
+		return modules.BatchPaymentReport{}, errEmptyBatch
+	}
+	for i, p := range payments {
+		if p.Amount.IsZero() {
+			return modules.BatchPaymentReport{}, fmt.Errorf("row %v: %v", i+1, errZeroBatchAmount)
+		}
+	}
+
+	w.mu.RLock()
+	unlocked := w.unlocked
+	w.mu.RUnlock()
+	if !unlocked && !dryRun {
+		w.log.Println("Attempt to send a batch payout has failed - wallet is locked")
+		return modules.BatchPaymentReport{}, modules.ErrLockedWallet
+	}
+
+	// Split the payments and estimate the fees.
+	_, maxFee := w.tpool.FeeEstimation()
+	batches, sizes := splitBatchPayments(payments)
+	fees := make([]types.Currency, len(batches))
+	report.DryRun = dryRun
+	report.Transactions = len(batches)
+	for i, batch := range batches {
+		fees[i] = batchFee(maxFee, sizes[i])
+		report.EstimatedFees = report.EstimatedFees.Add(fees[i])
+		for _, p := range batch {
+			report.TotalAmount = report.TotalAmount.Add(p.Amount)
+			report.Results = append(report.Results, modules.BatchPaymentResult{
+				BatchPayment: p,
+				Batch:        i,
+			})
+		}
+	}
+
+	// Refuse to start a payout that can't be completed. A locked wallet can
+	// still do a dry run, but its balance is unknown.
+	if unlocked {
+		balance, err := w.ConfirmedBalance()
+		if err != nil {
+			return modules.BatchPaymentReport{}, err
+		}
+		if required := report.TotalAmount.Add(report.EstimatedFees); balance.Cmp(required) < 0 {
+			return report, fmt.Errorf("%v: payout requires %v but the wallet only has %v", modules.ErrLowBalance, required.HumanString(), balance.HumanString())
+		}
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	// Send the batches one after another. Each batch can spend the refund of
+	// the previous one, because it is tracked as an unconfirmed output.
+	row := 0
+	for i, batch := range batches {
+		txids, err := w.sendBatch(batch, fees[i])
+		if err != nil {
+			w.log.Printf("Batch payout transaction %v of %v has failed: %v\n", i+1, len(batches), err)
+			for j := row; j < len(report.Results); j++ {
+				if report.Results[j].Batch == i {
+					report.Results[j].Error = err.Error()
+				} else {
+					report.Results[j].Error = "not sent: an earlier transaction of the batch failed"
+				}
+			}
+			break
+		}
+		for _, txid := range txids {
+			report.Results[row].TransactionID = txid
+			row++
+		}
+	}
+	w.log.Printf("Batch payout of %v in %v transactions with estimated fees %v has completed (%v of %v rows sent)\n",
+		report.TotalAmount.HumanString(), len(batches), report.EstimatedFees.HumanString(), row, len(report.Results))
+	return report, nil
+}
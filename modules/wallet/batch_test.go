@@ -0,0 +1,127 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/encoding"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// randomBatch returns n payments of amount to random addresses.
+func randomBatch(n int, amount types.Currency) []modules.BatchPayment {
+	payments := make([]modules.BatchPayment, n)
+	for i := range payments {
+		fastrand.Read(payments[i].Address[:])
+		payments[i].Amount = amount
+	}
+	return payments
+}
+
+// TestSplitBatchPayments checks that batch payments are split into groups
+// that fit into standard transactions without reordering them.
+func TestSplitBatchPayments(t *testing.T) {
+	payments := randomBatch(2000, types.SiacoinPrecision)
+	batches, sizes := splitBatchPayments(payments)
+	if len(batches) < 2 || len(batches) != len(sizes) {
+		t.Fatal("expected several batches, got", len(batches))
+	}
+	i := 0
+	for j, batch := range batches {
+		var size uint64
+		for _, p := range batch {
+			if p.Address != payments[i].Address {
+				t.Fatal("payments were reordered")
+			}
+			size += uint64(len(encoding.Marshal(types.SiacoinOutput{Value: p.Amount, UnlockHash: p.Address})))
+			i++
+		}
+		if size != sizes[j] || size > modules.TransactionSizeLimit-batchInputReserve {
+			t.Fatal("batch has the wrong size", size, sizes[j])
+		}
+	}
+	if i != len(payments) {
+		t.Fatal("payments were dropped")
+	}
+
+	// A single payment is a single batch.
+	batches, _ = splitBatchPayments(payments[:1])
+	if len(batches) != 1 || len(batches[0]) != 1 {
+		t.Fatal("expected a single batch")
+	}
+}
+
+// TestSendSiacoinsBatch probes the SendSiacoinsBatch method of the wallet.
+func TestSendSiacoinsBatch(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester(t.Name(), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Invalid batches are rejected.
+	if _, err := wt.wallet.SendSiacoinsBatch(nil, true); err != errEmptyBatch {
+		t.Fatal("expected errEmptyBatch, got", err)
+	}
+	if _, err := wt.wallet.SendSiacoinsBatch(randomBatch(1, types.ZeroCurrency), true); err == nil {
+		t.Fatal("expected an error for a zero amount")
+	}
+	if _, err := wt.wallet.SendSiacoinsBatch(randomBatch(1, types.SiacoinPrecision.Mul64(1e12)), true); err == nil {
+		t.Fatal("expected an error for an unaffordable batch")
+	}
+
+	// A dry run reports the split without sending anything.
+	payments := randomBatch(1000, types.SiacoinPrecision.Div64(100))
+	report, err := wt.wallet.SendSiacoinsBatch(payments, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || report.Transactions < 2 || len(report.Results) != len(payments) || report.EstimatedFees.IsZero() {
+		t.Fatal("unexpected dry run report", report.DryRun, report.Transactions, len(report.Results))
+	}
+	if !report.TotalAmount.Equals(types.SiacoinPrecision.Div64(100).Mul64(uint64(len(payments)))) {
+		t.Fatal("wrong total amount", report.TotalAmount)
+	}
+	if len(wt.tpool.TransactionList()) != 0 {
+		t.Fatal("dry run sent transactions")
+	}
+
+	// Send the batch for real. Every row should have been paid by a
+	// transaction in the pool.
+	report, err = wt.wallet.SendSiacoinsBatch(payments, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := make(map[types.TransactionID]types.Transaction)
+	for _, txn := range wt.tpool.TransactionList() {
+		pool[txn.ID()] = txn
+	}
+	for i, r := range report.Results {
+		if r.Error != "" {
+			t.Fatal("row failed:", r.Error)
+		}
+		txn, ok := pool[r.TransactionID]
+		if !ok {
+			t.Fatalf("transaction of row %v is not in the pool", i+1)
+		}
+		paid := false
+		for _, sco := range txn.SiacoinOutputs {
+			paid = paid || (sco.UnlockHash == r.Address && sco.Value.Equals(r.Amount))
+		}
+		if !paid {
+			t.Fatalf("transaction of row %v does not pay it", i+1)
+		}
+	}
+
+	// The batch should confirm.
+	if err := wt.addBlockNoPayout(); err != nil {
+		t.Fatal(err)
+	}
+	if len(wt.tpool.TransactionList()) != 0 {
+		t.Fatal("batch transactions were not mined")
+	}
+}
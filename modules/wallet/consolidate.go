@@ -0,0 +1,282 @@
+package wallet
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+const (
+	// consolidationMaxInputs is the maximum number of outputs merged by a
+	// single consolidation transaction. It keeps the transaction well below
+	// modules.TransactionSizeLimit.
+	consolidationMaxInputs = 80
+
+	// consolidationInputSize is the estimated size in bytes of a signed
+	// siacoin input, used to estimate the fee of consolidation transactions.
+	consolidationInputSize = 320
+
+	// consolidationTransactionOverhead is the estimated size in bytes of a
+	// consolidation transaction without any inputs.
+	consolidationTransactionOverhead = 200
+)
+
+var (
+	// consolidationCheckInterval is how often the wallet checks whether it
+	// should consolidate its outputs.
+	consolidationCheckInterval = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: 30 * time.Minute,
+		Testing:  3 * time.Second,
+	}).(time.Duration)
+
+	errZeroConsolidationTarget = errors.New("consolidation target must be at least one output")
+)
+
+// consolidationFee returns the miner fee of a consolidation transaction with
+// n inputs.
+func consolidationFee(feeRate types.Currency, n int) types.Currency {
+	return feeRate.Mul64(consolidationTransactionOverhead + consolidationInputSize*uint64(n))
+}
+
+// consolidationCandidates returns the outputs that may be consolidated,
+// sorted by ascending value. Outputs that can't be spent right now, that cost
+// more to spend than they are worth, or that belong to an address with an
+// excluded label are skipped.
+func (w *Wallet) consolidationCandidates(policy modules.ConsolidationPolicy, feeRate, dustThreshold types.Currency) (ids []types.SiacoinOutputID, outputs []types.SiacoinOutput, err error) {
+	consensusHeight, err := dbGetConsensusHeight(w.dbTx)
+	if err != nil {
+		return nil, nil, err
+	}
+	excluded := make(map[string]bool)
+	for _, label := range policy.ExcludedLabels {
+		excluded[label] = true
+	}
+	inputCost := feeRate.Mul64(consolidationInputSize)
+
+	var so sortedOutputs
+	err = dbForEachSiacoinOutput(w.dbTx, func(scoid types.SiacoinOutputID, sco types.SiacoinOutput) {
+		if _, ok := w.keys[sco.UnlockHash]; !ok {
+			return
+		}
+		if label, ok := w.addressLabels[sco.UnlockHash]; ok && excluded[label] {
+			return
+		}
+		if sco.Value.Cmp(inputCost) <= 0 {
+			return
+		}
+		if w.checkOutput(w.dbTx, consensusHeight, scoid, sco, dustThreshold) != nil {
+			return
+		}
+		so.ids = append(so.ids, scoid)
+		so.outputs = append(so.outputs, sco)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Sort(so)
+	return so.ids, so.outputs, nil
+}
+
+// managedConsolidate merges the smallest spendable outputs of the wallet
+// until it holds about policy.TargetOutputs of them, paying feeRate hastings
+// per byte.
+func (w *Wallet) managedConsolidate(policy modules.ConsolidationPolicy, feeRate types.Currency) (report modules.ConsolidationReport, err error) {
+	// dustThreshold has to be obtained separate from the lock
+	dustThreshold, err := w.DustThreshold()
+	if err != nil {
+		return modules.ConsolidationReport{}, err
+	}
+
+	w.mu.Lock()
+	if !w.unlocked {
+		w.mu.Unlock()
+		return modules.ConsolidationReport{}, modules.ErrLockedWallet
+	}
+	ids, outputs, err := w.consolidationCandidates(policy, feeRate, dustThreshold)
+	if err != nil {
+		w.mu.Unlock()
+		return modules.ConsolidationReport{}, err
+	}
+	report.OutputsBefore = len(ids)
+	if uint64(len(ids)) <= policy.TargetOutputs {
+		w.mu.Unlock()
+		return report, nil
+	}
+
+	// Merging n outputs into one removes n-1 outputs, so merge the smallest
+	// len(ids)-target+1 outputs. If they have to be spread over several
+	// transactions, the wallet ends up slightly above the target and the next
+	// run merges the rest.
+	n := len(ids) - int(policy.TargetOutputs) + 1
+	consensusHeight, err := dbGetConsensusHeight(w.dbTx)
+	if err != nil {
+		w.mu.Unlock()
+		return modules.ConsolidationReport{}, err
+	}
+	var builders []*transactionBuilder
+	var fees []types.Currency
+	var addrErr error
+	for start := 0; start < n; start += consolidationMaxInputs {
+		end := start + consolidationMaxInputs
+		if end > n {
+			end = n
+		}
+		if end-start < 2 {
+			break
+		}
+		var txn types.Transaction
+		var fund types.Currency
+		for i := start; i < end; i++ {
+			txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
+				ParentID:         ids[i],
+				UnlockConditions: w.keys[outputs[i].UnlockHash].UnlockConditions,
+			})
+			fund = fund.Add(outputs[i].Value)
+		}
+		fee := consolidationFee(feeRate, end-start)
+		if fund.Cmp(fee) <= 0 {
+			continue
+		}
+		// If the wallet runs out of addresses, the transactions that were
+		// built already are still submitted.
+		var uc types.UnlockConditions
+		uc, addrErr = w.nextPrimarySeedAddress(w.dbTx)
+		if addrErr != nil {
+			addrErr = build.ExtendErr("unable to get an address for a consolidation transaction", addrErr)
+			break
+		}
+		txn.MinerFees = []types.Currency{fee}
+		txn.SiacoinOutputs = []types.SiacoinOutput{{
+			Value:      fund.Sub(fee),
+			UnlockHash: uc.UnlockHash(),
+		}}
+
+		tb := w.registerTransaction(txn, nil)
+		for i := range tb.transaction.SiacoinInputs {
+			tb.siacoinInputs = append(tb.siacoinInputs, i)
+			dbPutSpentOutput(w.dbTx, types.OutputID(tb.transaction.SiacoinInputs[i].ParentID), consensusHeight)
+		}
+		builders = append(builders, tb)
+		fees = append(fees, fee)
+	}
+	w.mu.Unlock()
+
+	// Sign and broadcast the transactions. Signing requires the lock.
+	for i, tb := range builders {
+		if err != nil {
+			tb.Drop()
+			continue
+		}
+		var txnSet []types.Transaction
+		txnSet, err = tb.Sign(true)
+		if err == nil {
+			err = w.tpool.AcceptTransactionSet(txnSet)
+		}
+		if err != nil {
+			err = build.ExtendErr("unable to submit consolidation transaction", err)
+			tb.Drop()
+			continue
+		}
+		report.OutputsMerged += len(tb.transaction.SiacoinInputs)
+		report.Fees = report.Fees.Add(fees[i])
+		report.TransactionIDs = append(report.TransactionIDs, txnSet[len(txnSet)-1].ID())
+	}
+	if len(report.TransactionIDs) > 0 {
+		w.log.Printf("Consolidated %v of %v outputs in %v transactions, paying %v in fees\n",
+			report.OutputsMerged, report.OutputsBefore, len(report.TransactionIDs), report.Fees.HumanString())
+	}
+	return report, build.ComposeErrors(addrErr, err)
+}
+
+// threadedConsolidate periodically consolidates the wallet's outputs if the
+// consolidation policy is enabled and fees are low enough.
+func (w *Wallet) threadedConsolidate() {
+	if err := w.tg.Add(); err != nil {
+		return
+	}
+	defer w.tg.Done()
+
+	for {
+		select {
+		case <-w.tg.StopChan():
+			return
+		case <-time.After(consolidationCheckInterval):
+		}
+
+		w.mu.RLock()
+		policy := w.settings.Consolidation
+		unlocked := w.unlocked
+		w.mu.RUnlock()
+		if !policy.Enabled || !unlocked {
+			continue
+		}
+		_, maxFee := w.tpool.FeeEstimation()
+		if maxFee.Cmp(policy.MaxFeeRate) > 0 {
+			continue
+		}
+		if _, err := w.managedConsolidate(policy, maxFee); err != nil {
+			w.log.Println("Unable to consolidate outputs:", err)
+		}
+	}
+}
+
+// Consolidate merges the wallet's smallest outputs into larger ones
+// according to the consolidation policy in the wallet settings. It runs even
+// if the policy is disabled or fees are above the policy's maximum fee rate.
+func (w *Wallet) Consolidate() (modules.ConsolidationReport, error) {
+	if err := w.tg.Add(); err != nil {
+		return modules.ConsolidationReport{}, modules.ErrWalletShutdown
+	}
+	defer w.tg.Done()
+
+	w.mu.RLock()
+	policy := w.settings.Consolidation
+	w.mu.RUnlock()
+	_, maxFee := w.tpool.FeeEstimation()
+	return w.managedConsolidate(policy, maxFee)
+}
+
+// SetAddressLabel attaches a label to an address. An empty label removes the
+// existing label.
+func (w *Wallet) SetAddressLabel(addr types.UnlockHash, label string) error {
+	if err := w.tg.Add(); err != nil {
+		return modules.ErrWalletShutdown
+	}
+	defer w.tg.Done()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if label == "" {
+		if err := dbDeleteAddressLabel(w.dbTx, addr); err != nil {
+			return err
+		}
+		delete(w.addressLabels, addr)
+	} else {
+		if err := dbPutAddressLabel(w.dbTx, addr, label); err != nil {
+			return err
+		}
+		w.addressLabels[addr] = label
+	}
+	return w.syncDB()
+}
+
+// AddressLabels returns all labeled addresses.
+func (w *Wallet) AddressLabels() (map[types.UnlockHash]string, error) {
+	if err := w.tg.Add(); err != nil {
+		return nil, modules.ErrWalletShutdown
+	}
+	defer w.tg.Done()
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	labels := make(map[types.UnlockHash]string, len(w.addressLabels))
+	for addr, label := range w.addressLabels {
+		labels[addr] = label
+	}
+	return labels, nil
+}
@@ -0,0 +1,185 @@
+package wallet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+// spendableOutputs returns the number of confirmed outputs the wallet can
+// spend, ignoring the dust threshold.
+func (wt *walletTester) spendableOutputs() int {
+	wt.wallet.mu.Lock()
+	defer wt.wallet.mu.Unlock()
+	ids, _, err := wt.wallet.consolidationCandidates(modules.ConsolidationPolicy{}, types.ZeroCurrency, types.ZeroCurrency)
+	if err != nil {
+		panic(err)
+	}
+	return len(ids)
+}
+
+// TestConsolidate probes the Consolidate method of the wallet.
+func TestConsolidate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester(t.Name(), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Split the wallet's coins into many small outputs, one of which goes to
+	// a labeled address.
+	ucs, err := wt.wallet.NextAddresses(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payments := make([]modules.BatchPayment, 60)
+	for i := range payments {
+		payments[i].Address = ucs[0].UnlockHash()
+		if i > 0 {
+			payments[i].Address = ucs[1+i%5].UnlockHash()
+		}
+		payments[i].Amount = types.SiacoinPrecision.Mul64(10)
+	}
+	if err := wt.wallet.SetAddressLabel(payments[0].Address, "cold storage"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.wallet.SendSiacoinsBatch(payments, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.addBlockNoPayout(); err != nil {
+		t.Fatal(err)
+	}
+	before := wt.spendableOutputs()
+	if before <= len(payments) {
+		t.Fatal("expected more outputs than payments, got", before)
+	}
+
+	// Nothing happens if the wallet is at or below the target.
+	settings, err := wt.wallet.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Consolidation.TargetOutputs != modules.DefaultConsolidationTargetOutputs {
+		t.Fatal("wrong default target", settings.Consolidation.TargetOutputs)
+	}
+	settings.Consolidation.TargetOutputs = 0
+	if err := wt.wallet.SetSettings(settings); err != errZeroConsolidationTarget {
+		t.Fatal("expected errZeroConsolidationTarget, got", err)
+	}
+	settings.Consolidation.TargetOutputs = uint64(before)
+	settings.Consolidation.ExcludedLabels = []string{"cold storage"}
+	if err := wt.wallet.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	report, err := wt.wallet.Consolidate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.TransactionIDs) != 0 || report.OutputsBefore >= before {
+		t.Fatal("unexpected report", report.OutputsBefore, len(report.TransactionIDs))
+	}
+
+	// Consolidate down to 10 outputs.
+	settings.Consolidation.TargetOutputs = 10
+	if err := wt.wallet.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	report, err = wt.wallet.Consolidate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OutputsMerged != report.OutputsBefore-10+1 || len(report.TransactionIDs) != 1 || report.Fees.IsZero() {
+		t.Fatal("unexpected report", report.OutputsMerged, len(report.TransactionIDs), report.Fees)
+	}
+	if n := wt.spendableOutputs(); n != before-report.OutputsMerged {
+		t.Fatal("merged outputs are still spendable", n, before, report.OutputsMerged)
+	}
+	if err := wt.addBlockNoPayout(); err != nil {
+		t.Fatal(err)
+	}
+	if len(wt.tpool.TransactionList()) != 0 {
+		t.Fatal("consolidation transaction was not mined")
+	}
+
+	// The labeled output must not have been spent.
+	unspent, err := wt.wallet.UnspentOutputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, uo := range unspent {
+		found = found || uo.UnlockHash == payments[0].Address
+	}
+	if !found {
+		t.Fatal("excluded output was consolidated")
+	}
+}
+
+// TestConsolidateAddressFailure checks that the consolidation transactions
+// that were built before the wallet ran out of addresses are still submitted,
+// and that the outputs of the remaining transactions stay spendable.
+func TestConsolidateAddressFailure(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester(t.Name(), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Split the wallet's coins into enough outputs for two consolidation
+	// transactions.
+	uc, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payments := make([]modules.BatchPayment, 2*consolidationMaxInputs)
+	for i := range payments {
+		payments[i].Address = uc.UnlockHash()
+		payments[i].Amount = types.SiacoinPrecision.Mul64(10)
+	}
+	if _, err := wt.wallet.SendSiacoinsBatch(payments, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.addBlockNoPayout(); err != nil {
+		t.Fatal(err)
+	}
+	before := wt.spendableOutputs()
+
+	// Only allow a single new address, which is used by the first
+	// transaction.
+	wt.wallet.mu.Lock()
+	internalIndex, err := dbGetPrimarySeedMaximumInternalIndex(wt.wallet.dbTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	externalIndex, err := dbGetPrimarySeedMaximumExternalIndex(wt.wallet.dbTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt.wallet.addressGapLimit = internalIndex - externalIndex + 1
+	wt.wallet.mu.Unlock()
+
+	report, err := wt.wallet.managedConsolidate(modules.ConsolidationPolicy{TargetOutputs: 1}, types.NewCurrency64(1))
+	if err == nil || !strings.Contains(err.Error(), modules.ErrAddressGapLimit.Error()) {
+		t.Fatal("expected ErrAddressGapLimit, got", err)
+	}
+	if len(report.TransactionIDs) != 1 || report.OutputsMerged != consolidationMaxInputs {
+		t.Fatal("the first transaction wasn't submitted", len(report.TransactionIDs), report.OutputsMerged)
+	}
+	if n := wt.spendableOutputs(); n != before-consolidationMaxInputs {
+		t.Fatal("unexpected number of spendable outputs", n, before)
+	}
+	if err := wt.addBlockNoPayout(); err != nil {
+		t.Fatal(err)
+	}
+	if len(wt.tpool.TransactionList()) != 0 {
+		t.Fatal("consolidation transaction was not mined")
+	}
+}
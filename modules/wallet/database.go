@@ -27,6 +27,23 @@ var (
 	// bucketAddrTransactions maps an UnlockHash to the
 	// ProcessedTransactions that it appears in.
 	bucketAddrTransactions = []byte("bucketAddrTransactions")
+	// bucketCategoryTransactions indexes ProcessedTransactions by category.
+	// Its keys are a category prefix followed by the transaction's index in
+	// bucketProcessedTransactions; its values are empty.
+	bucketCategoryTransactions = []byte("bucketCategoryTransactions")
+	// bucketAddrTransactionIndex indexes ProcessedTransactions by address.
+	// Its keys are an UnlockHash followed by the transaction's index in
+	// bucketProcessedTransactions; its values are empty. Unlike
+	// bucketAddrTransactions, it can be walked in order without loading every
+	// transaction of the address.
+	bucketAddrTransactionIndex = []byte("bucketAddrTransactionIndex")
+	// bucketTransactionTimeBounds maps the index of a ProcessedTransaction to
+	// the latest confirmation timestamp of the transactions up to it and the
+	// earliest confirmation timestamp of the transactions from it onwards.
+	// Block timestamps are not monotonic, but both bounds are, so the
+	// transactions confirmed within a time range can be found by binary
+	// search.
+	bucketTransactionTimeBounds = []byte("bucketTransactionTimeBounds")
 	// bucketSiacoinOutputs maps a SiacoinOutputID to its SiacoinOutput. Only
 	// outputs that the wallet controls are stored. The wallet uses these
 	// outputs to fund transactions.
@@ -43,15 +60,26 @@ var (
 	// bucketWallet contains various fields needed by the wallet, such as its
 	// UID, EncryptionVerification, and PrimarySeedFile.
 	bucketWallet = []byte("bucketWallet")
+	// bucketPaymentRequests maps the UnlockHash of a payment request to the
+	// PaymentRequest itself.
+	bucketPaymentRequests = []byte("bucketPaymentRequests")
+	// bucketAddressLabels maps an UnlockHash to the label the user attached
+	// to it.
+	bucketAddressLabels = []byte("bucketAddressLabels")
 
 	dbBuckets = [][]byte{
 		bucketProcessedTransactions,
 		bucketProcessedTxnIndex,
 		bucketAddrTransactions,
+		bucketCategoryTransactions,
+		bucketAddrTransactionIndex,
+		bucketTransactionTimeBounds,
 		bucketSiacoinOutputs,
 		bucketSpentOutputs,
 		bucketUnlockConditions,
 		bucketWallet,
+		bucketPaymentRequests,
+		bucketAddressLabels,
 	}
 
 	errNoKey = errors.New("key does not exist")
@@ -66,8 +94,10 @@ var (
 	keySpendableKeyFiles         = []byte("keySpendableKeyFiles")
 	keyUID                       = []byte("keyUID")
 	keyWatchedAddrs              = []byte("keyWatchedAddrs")
+	keyWalletSettings            = []byte("keyWalletSettings")
 	keySeedsMaximumInternalIndex = []byte("keySeedsMaximumInternalIndex")
 	keySeedsMaximumExternalIndex = []byte("keySeedsMaximumExternalIndex")
+	keyPaymentRequestIndices     = []byte("keyPaymentRequestIndices")
 )
 
 // threadedDBUpdate commits the active database transaction and starts a new
@@ -240,6 +270,45 @@ func dbGetUnlockConditions(tx *bolt.Tx, addr types.UnlockHash) (uc types.UnlockC
 	return
 }
 
+func dbPutPaymentRequest(tx *bolt.Tx, pr modules.PaymentRequest) error {
+	return dbPut(tx.Bucket(bucketPaymentRequests), pr.Address, pr)
+}
+func dbGetPaymentRequest(tx *bolt.Tx, addr types.UnlockHash) (pr modules.PaymentRequest, err error) {
+	err = dbGet(tx.Bucket(bucketPaymentRequests), addr, &pr)
+	return
+}
+func dbForEachPaymentRequest(tx *bolt.Tx, fn func(types.UnlockHash, modules.PaymentRequest)) error {
+	return dbForEach(tx.Bucket(bucketPaymentRequests), fn)
+}
+
+// dbGetPaymentRequestIndices returns the index of the next payment request
+// key of the primary seed, and the index after the last one that received a
+// payment. Wallets that never created a payment request key return zeros.
+func dbGetPaymentRequestIndices(tx *bolt.Tx) (next, used uint64, err error) {
+	b := tx.Bucket(bucketWallet).Get(keyPaymentRequestIndices)
+	if b == nil {
+		return 0, 0, nil
+	}
+	err = encoding.UnmarshalAll(b, &next, &used)
+	return
+}
+
+// dbPutPaymentRequestIndices stores the payment request key indices of the
+// primary seed.
+func dbPutPaymentRequestIndices(tx *bolt.Tx, next, used uint64) error {
+	return tx.Bucket(bucketWallet).Put(keyPaymentRequestIndices, encoding.MarshalAll(next, used))
+}
+
+func dbPutAddressLabel(tx *bolt.Tx, addr types.UnlockHash, label string) error {
+	return dbPut(tx.Bucket(bucketAddressLabels), addr, label)
+}
+func dbDeleteAddressLabel(tx *bolt.Tx, addr types.UnlockHash) error {
+	return dbDelete(tx.Bucket(bucketAddressLabels), addr)
+}
+func dbForEachAddressLabel(tx *bolt.Tx, fn func(types.UnlockHash, string)) error {
+	return dbForEach(tx.Bucket(bucketAddressLabels), fn)
+}
+
 // dbAddAddrTransaction appends a single transaction index to the set of
 // transactions associated with addr. If the index is already in the set, it is
 // not added again.
@@ -280,6 +349,201 @@ func dbAddProcessedTransactionAddrs(tx *bolt.Tx, pt modules.ProcessedTransaction
 	return nil
 }
 
+// dbRemoveProcessedTransactionAddrs removes txn from the set of transactions
+// associated with every address in pt.
+func dbRemoveProcessedTransactionAddrs(tx *bolt.Tx, pt modules.ProcessedTransaction, txn uint64) error {
+	addrs := make(map[types.UnlockHash]struct{})
+	for _, input := range pt.Inputs {
+		addrs[input.RelatedAddress] = struct{}{}
+	}
+	for _, output := range pt.Outputs {
+		addrs[output.RelatedAddress] = struct{}{}
+	}
+	for addr := range addrs {
+		txns, err := dbGetAddrTransactions(tx, addr)
+		if err == errNoKey {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for i := range txns {
+			if txns[i] == txn {
+				txns = append(txns[:i], txns[i+1:]...)
+				break
+			}
+		}
+		if len(txns) == 0 {
+			err = dbDelete(tx.Bucket(bucketAddrTransactions), addr)
+		} else {
+			err = dbPutAddrTransactions(tx, addr, txns)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// categoryKey returns the key of txn in the category index.
+func categoryKey(category string, txn uint64) []byte {
+	key := make([]byte, len(category)+1+8)
+	copy(key, category)
+	binary.BigEndian.PutUint64(key[len(category)+1:], txn)
+	return key
+}
+
+// dbAddProcessedTransactionCategories adds txn, which is assumed to be pt's
+// index in bucketProcessedTransactions, to the category index.
+func dbAddProcessedTransactionCategories(tx *bolt.Tx, pt modules.ProcessedTransaction, txn uint64) error {
+	b := tx.Bucket(bucketCategoryTransactions)
+	for _, category := range processedTransactionCategories(pt) {
+		if err := b.Put(categoryKey(category, txn), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbRemoveProcessedTransactionCategories removes txn from the category
+// index.
+func dbRemoveProcessedTransactionCategories(tx *bolt.Tx, pt modules.ProcessedTransaction, txn uint64) error {
+	b := tx.Bucket(bucketCategoryTransactions)
+	for _, category := range processedTransactionCategories(pt) {
+		if err := b.Delete(categoryKey(category, txn)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processedTransactionAddrs returns the set of addresses that appear in pt.
+func processedTransactionAddrs(pt modules.ProcessedTransaction) map[types.UnlockHash]struct{} {
+	addrs := make(map[types.UnlockHash]struct{})
+	for _, input := range pt.Inputs {
+		addrs[input.RelatedAddress] = struct{}{}
+	}
+	for _, output := range pt.Outputs {
+		// miner fees don't have an address, so skip them
+		if output.FundType == types.SpecifierMinerFee {
+			continue
+		}
+		addrs[output.RelatedAddress] = struct{}{}
+	}
+	return addrs
+}
+
+// addrIndexKey returns the key of txn in the address index.
+func addrIndexKey(addr types.UnlockHash, txn uint64) []byte {
+	key := make([]byte, len(addr)+8)
+	copy(key, addr[:])
+	binary.BigEndian.PutUint64(key[len(addr):], txn)
+	return key
+}
+
+// dbAddProcessedTransactionAddrIndex adds txn, which is assumed to be pt's
+// index in bucketProcessedTransactions, to the address index.
+func dbAddProcessedTransactionAddrIndex(tx *bolt.Tx, pt modules.ProcessedTransaction, txn uint64) error {
+	b := tx.Bucket(bucketAddrTransactionIndex)
+	for addr := range processedTransactionAddrs(pt) {
+		if err := b.Put(addrIndexKey(addr, txn), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbRemoveProcessedTransactionAddrIndex removes txn from the address index.
+func dbRemoveProcessedTransactionAddrIndex(tx *bolt.Tx, pt modules.ProcessedTransaction, txn uint64) error {
+	b := tx.Bucket(bucketAddrTransactionIndex)
+	for addr := range processedTransactionAddrs(pt) {
+		if err := b.Delete(addrIndexKey(addr, txn)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transactionTimeBounds are the values of bucketTransactionTimeBounds. Time
+// is the confirmation timestamp of the transaction itself, which is needed
+// to restore the earliest timestamps when the last transaction is deleted.
+type transactionTimeBounds struct {
+	Latest   types.Timestamp
+	Earliest types.Timestamp
+	Time     types.Timestamp
+}
+
+func dbPutTransactionTimeBounds(tx *bolt.Tx, txn uint64, bounds transactionTimeBounds) error {
+	return dbPut(tx.Bucket(bucketTransactionTimeBounds), txn, bounds)
+}
+func dbGetTransactionTimeBounds(tx *bolt.Tx, txn uint64) (bounds transactionTimeBounds, err error) {
+	err = dbGet(tx.Bucket(bucketTransactionTimeBounds), txn, &bounds)
+	return
+}
+
+// dbAddProcessedTransactionTime adds txn, which is assumed to be pt's index
+// in bucketProcessedTransactions and the last processed transaction, to the
+// time bounds. The earliest timestamps of the previous transactions are
+// lowered until one is already at or below pt's timestamp.
+func dbAddProcessedTransactionTime(tx *bolt.Tx, pt modules.ProcessedTransaction, txn uint64) error {
+	ts := pt.ConfirmationTimestamp
+	bounds := transactionTimeBounds{Latest: ts, Earliest: ts, Time: ts}
+	if txn > 1 {
+		prev, err := dbGetTransactionTimeBounds(tx, txn-1)
+		if err != nil {
+			return err
+		}
+		if prev.Latest > ts {
+			bounds.Latest = prev.Latest
+		}
+	}
+	if err := dbPutTransactionTimeBounds(tx, txn, bounds); err != nil {
+		return err
+	}
+	for i := txn - 1; i > 0; i-- {
+		prev, err := dbGetTransactionTimeBounds(tx, i)
+		if err != nil {
+			return err
+		}
+		if prev.Earliest <= ts {
+			break
+		}
+		prev.Earliest = ts
+		if err := dbPutTransactionTimeBounds(tx, i, prev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbRemoveProcessedTransactionTime removes txn, which is assumed to be the
+// last processed transaction, from the time bounds and restores the earliest
+// timestamps of the previous transactions.
+func dbRemoveProcessedTransactionTime(tx *bolt.Tx, txn uint64) error {
+	if err := dbDelete(tx.Bucket(bucketTransactionTimeBounds), txn); err != nil {
+		return err
+	}
+	var next types.Timestamp
+	for i := txn - 1; i > 0; i-- {
+		bounds, err := dbGetTransactionTimeBounds(tx, i)
+		if err != nil {
+			return err
+		}
+		earliest := bounds.Time
+		if i < txn-1 && next < earliest {
+			earliest = next
+		}
+		if earliest == bounds.Earliest {
+			break
+		}
+		bounds.Earliest = earliest
+		if err := dbPutTransactionTimeBounds(tx, i, bounds); err != nil {
+			return err
+		}
+		next = earliest
+	}
+	return nil
+}
+
 // bucketProcessedTransactions works a little differently: the key is
 // meaningless, only used to order the transactions chronologically.
 
@@ -339,6 +603,17 @@ func dbAppendProcessedTransaction(tx *bolt.Tx, pt modules.ProcessedTransaction)
 	if err = dbAddProcessedTransactionAddrs(tx, pt, key); err != nil {
 		return errors.AddContext(err, "failed to add processed transaction to addresses in database")
 	}
+
+	// and to the category, address and time indexes
+	if err = dbAddProcessedTransactionCategories(tx, pt, key); err != nil {
+		return errors.AddContext(err, "failed to add processed transaction to categories in database")
+	}
+	if err = dbAddProcessedTransactionAddrIndex(tx, pt, key); err != nil {
+		return errors.AddContext(err, "failed to add processed transaction to address index in database")
+	}
+	if err = dbAddProcessedTransactionTime(tx, pt, key); err != nil {
+		return errors.AddContext(err, "failed to add processed transaction to time bounds in database")
+	}
 	return nil
 }
 
@@ -361,9 +636,22 @@ func dbDeleteLastProcessedTransaction(tx *bolt.Tx) error {
 	if err := dbDeleteTransactionIndex(tx, pt.TransactionID); err != nil {
 		return errors.AddContext(err, "couldn't delete txn index")
 	}
-	// Delete the last processed txn and decrement the sequence.
+	// Delete it from the address, category and time indexes.
 	b := tx.Bucket(bucketProcessedTransactions)
 	seq := b.Sequence()
+	if err := dbRemoveProcessedTransactionAddrs(tx, pt, seq); err != nil {
+		return errors.AddContext(err, "couldn't delete txn from address index")
+	}
+	if err := dbRemoveProcessedTransactionCategories(tx, pt, seq); err != nil {
+		return errors.AddContext(err, "couldn't delete txn from category index")
+	}
+	if err := dbRemoveProcessedTransactionAddrIndex(tx, pt, seq); err != nil {
+		return errors.AddContext(err, "couldn't delete txn from address index")
+	}
+	if err := dbRemoveProcessedTransactionTime(tx, seq); err != nil {
+		return errors.AddContext(err, "couldn't delete txn from time bounds")
+	}
+	// Delete the last processed txn and decrement the sequence.
 	keyBytes := make([]byte, 8)
 	binary.BigEndian.PutUint64(keyBytes, seq)
 	return errors.Compose(b.SetSequence(seq-1), b.Delete(keyBytes))
@@ -485,6 +773,23 @@ func dbGetSeedsMaximumInternalIndexForSeed(tx *bolt.Tx, seedIndex uint64) (index
 	return
 }
 
+// dbGetWalletSettings returns the wallet settings. Wallets that never stored
+// any settings get the defaults.
+func dbGetWalletSettings(tx *bolt.Tx) (settings modules.WalletSettings, err error) {
+	b := tx.Bucket(bucketWallet).Get(keyWalletSettings)
+	if b == nil {
+		settings.Consolidation.TargetOutputs = modules.DefaultConsolidationTargetOutputs
+		return settings, nil
+	}
+	err = encoding.Unmarshal(b, &settings)
+	return
+}
+
+// dbPutWalletSettings stores the wallet settings.
+func dbPutWalletSettings(tx *bolt.Tx, settings modules.WalletSettings) error {
+	return tx.Bucket(bucketWallet).Put(keyWalletSettings, encoding.Marshal(settings))
+}
+
 // dbPutWatchedAddresses stores the set of watched addresses.
 func dbPutWatchedAddresses(tx *bolt.Tx, addrs []types.UnlockHash) error {
 	return tx.Bucket(bucketWallet).Put(keyWatchedAddrs, encoding.Marshal(addrs))
@@ -120,7 +120,7 @@ func (w *Wallet) managedUnlock(masterKey crypto.CipherKey) error {
 	// Load db objects into memory.
 	var lastChange modules.ConsensusChangeID
 	var primarySeedFile seedFile
-	var externalIndex, internalIndex uint64
+	var externalIndex, internalIndex, paymentRequestIndex uint64
 	var auxiliarySeedFiles []seedFile
 	var unseededKeyFiles []spendableKeyFile
 	var watchedAddrs []types.UnlockHash
@@ -155,6 +155,11 @@ func (w *Wallet) managedUnlock(masterKey crypto.CipherKey) error {
 			return err
 		}
 
+		paymentRequestIndex, _, err = dbGetPaymentRequestIndices(w.dbTx)
+		if err != nil {
+			return err
+		}
+
 		// auxiliarySeedFiles
 		err = encoding.Unmarshal(wb.Get(keyAuxiliarySeedFiles), &auxiliarySeedFiles)
 		if err != nil {
@@ -190,6 +195,7 @@ func (w *Wallet) managedUnlock(masterKey crypto.CipherKey) error {
 			return err
 		}
 		w.integrateSeed(primarySeed, internalIndex)
+		w.integratePaymentRequestKeys(primarySeed, paymentRequestIndex)
 		w.primarySeed = primarySeed
 		// Sometimes the lookahead has already been initialized before we
 		// unlock - this is the case when we just created or loaded a new
@@ -395,6 +401,11 @@ func (w *Wallet) Reset() error {
 	w.lookahead = newLookahead(w.addressGapLimit)
 	w.seeds = []modules.Seed{}
 	w.unconfirmedProcessedTransactions = []modules.ProcessedTransaction{}
+	w.paymentRequests = make(map[types.UnlockHash]modules.PaymentRequest)
+	w.paymentRequestKeys = make(map[types.UnlockHash]uint64)
+	w.confirmingTransactions = nil
+	w.addressLabels = make(map[types.UnlockHash]string)
+	w.settings, _ = dbGetWalletSettings(w.dbTx)
 	w.unlocked = false
 	w.encrypted = false
 	w.subscribed = false
@@ -438,7 +449,11 @@ func (w *Wallet) InitFromSeed(masterKey crypto.CipherKey, seed modules.Seed) err
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	_, err = w.initEncryption(masterKey, seed, s.getMaximumExternalIndex())
-	return err
+	if err != nil {
+		return err
+	}
+	index := s.getPaymentRequestIndex()
+	return dbPutPaymentRequestIndices(w.dbTx, index, index)
 }
 
 // Unlocked indicates whether the wallet is locked or unlocked.
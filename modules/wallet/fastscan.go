@@ -29,11 +29,13 @@ var maxScanKeys = func() uint64 {
 }()
 
 // A scannedOutput is an output found in the blockchain that was generated
-// from a given seed.
+// from a given seed. If paymentRequest is true, seedIndex is the index of a
+// payment request key.
 type scannedOutput struct {
-	id        types.OutputID
-	value     types.Currency
-	seedIndex uint64
+	id             types.OutputID
+	value          types.Currency
+	seedIndex      uint64
+	paymentRequest bool
 }
 
 // A seedScanner scans the blockchain for addresses that belong to a given
@@ -51,12 +53,30 @@ type seedScanner struct {
 	cs                   modules.ConsensusSet
 	walletStopChan       <-chan struct{}
 	log                  *persist.Logger
+
+	// paymentKeys maps the payment request addresses of the seed to their
+	// index. They are scanned with their own gap limit, and
+	// paymentRequestIndex is the index after the last one that was used.
+	paymentKeys         map[types.UnlockHash]uint64
+	paymentRequestIndex uint64
+}
+
+// spendableKey returns the key of seed that can spend the output.
+func (so scannedOutput) spendableKey(seed modules.Seed) spendableKey {
+	if so.paymentRequest {
+		return generatePaymentRequestKey(seed, so.seedIndex)
+	}
+	return generateSpendableKey(seed, so.seedIndex)
 }
 
 func (s seedScanner) getMaximumExternalIndex() uint64 {
 	return s.maximumExternalIndex
 }
 
+func (s seedScanner) getPaymentRequestIndex() uint64 {
+	return s.paymentRequestIndex
+}
+
 // func (s seedScanner) getMaximumInternalIndex() uint64 {
 // 	return s.maximumInternalIndex
 // }
@@ -85,6 +105,21 @@ func (s *seedScanner) generateKeys(n uint64) {
 	s.maximumInternalIndex += n
 }
 
+// generatePaymentRequestKeys generates payment request keys until there are
+// paymentRequestGapLimit keys after the last used one.
+func (s *seedScanner) generatePaymentRequestKeys() {
+	numKeys := uint64(len(s.paymentKeys))
+	target := s.paymentRequestIndex + paymentRequestGapLimit
+	if numKeys >= target {
+		return
+	}
+	for i, k := range generatePaymentRequestKeys(s.seed, numKeys, target-numKeys) {
+		u := k.UnlockConditions.UnlockHash()
+		s.paymentKeys[u] = numKeys + uint64(i)
+		s.keysArray = append(s.keysArray, u[:])
+	}
+}
+
 // ProcessHeaderConsensusChange match consensus change headers with generated seeds
 // It needs to look for two types new outputs:
 //
@@ -123,11 +158,19 @@ func (s *seedScanner) ProcessHeaderConsensusChange(hcc modules.HeaderConsensusCh
 					value:     diff.SiacoinOutput.Value,
 					seedIndex: index,
 				}
+			} else if index, exists := s.paymentKeys[diff.SiacoinOutput.UnlockHash]; exists && diff.SiacoinOutput.Value.Cmp(s.dustThreshold) > 0 {
+				s.siacoinOutputs[diff.ID] = scannedOutput{
+					id:             types.OutputID(diff.ID),
+					value:          diff.SiacoinOutput.Value,
+					seedIndex:      index,
+					paymentRequest: true,
+				}
 			}
 		} else if diff.Direction == modules.DiffRevert {
 			// NOTE: DiffRevert means the output was either spent or was in a
 			// block that was reverted.
-			if _, exists := s.keys[diff.SiacoinOutput.UnlockHash]; exists {
+			_, isPaymentKey := s.paymentKeys[diff.SiacoinOutput.UnlockHash]
+			if _, exists := s.keys[diff.SiacoinOutput.UnlockHash]; exists || isPaymentKey {
 				// log.Printf("fast DiffRevert %d: %s %s\n", index, diff.SiacoinOutput.UnlockHash, diff.SiacoinOutput.Value.HumanString())
 				delete(s.siacoinOutputs, diff.ID)
 			}
@@ -144,6 +187,10 @@ func (s *seedScanner) ProcessHeaderConsensusChange(hcc modules.HeaderConsensusCh
 				s.adjustKeys()
 			}
 		}
+		if index, exists := s.paymentKeys[diff.SiacoinOutput.UnlockHash]; exists && index >= s.paymentRequestIndex {
+			s.paymentRequestIndex = index + 1
+			s.generatePaymentRequestKeys()
+		}
 	}
 }
 
@@ -163,6 +210,7 @@ func (s *seedScanner) scan(cancel <-chan struct{}) error {
 	s.walletStopChan = cancel
 	numKeys := uint64(s.addressGapLimit)
 	s.generateKeys(numKeys)
+	s.generatePaymentRequestKeys()
 	if err := s.cs.HeaderConsensusSetSubscribe(s, modules.ConsensusChangeBeginning, cancel); err != nil {
 		return err
 	}
@@ -190,5 +238,6 @@ func newFastSeedScanner(seed modules.Seed, addressGapLimit uint64,
 		siacoinOutputs:       make(map[types.SiacoinOutputID]scannedOutput),
 		cs:                   cs,
 		log:                  log,
+		paymentKeys:          make(map[types.UnlockHash]uint64),
 	}
 }
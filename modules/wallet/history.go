@@ -0,0 +1,462 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sort"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	errInvalidHistoryCursor = errors.New("invalid transaction history cursor")
+	errUnknownTxnCategory   = errors.New("unknown transaction category")
+)
+
+// processedTransactionCategories returns the categories of pt that are stored
+// in bucketCategoryTransactions. Whether a transaction is watched depends on
+// the addresses that are watched when it is queried, so TxnCategoryWatch is
+// resolved through bucketAddrTransactions instead.
+func processedTransactionCategories(pt modules.ProcessedTransaction) (categories []string) {
+	var miner, contract, send, receive bool
+	for _, input := range pt.Inputs {
+		send = send || input.WalletAddress
+	}
+	for _, output := range pt.Outputs {
+		if !output.WalletAddress {
+			continue
+		}
+		switch output.FundType {
+		case types.SpecifierMinerPayout:
+			miner = true
+		case types.SpecifierSiacoinOutput:
+			receive = true
+		case types.SpecifierStorageProofOutput:
+			contract = true
+		}
+	}
+	txn := pt.Transaction
+	contract = contract || len(txn.FileContracts) > 0 || len(txn.FileContractRevisions) > 0 || len(txn.StorageProofs) > 0
+
+	if miner {
+		categories = append(categories, modules.TxnCategoryMiner)
+	}
+	if contract {
+		categories = append(categories, modules.TxnCategoryContract)
+	}
+	if send {
+		categories = append(categories, modules.TxnCategorySend)
+	}
+	if receive {
+		categories = append(categories, modules.TxnCategoryReceive)
+	}
+	return categories
+}
+
+// encodeHistoryCursor returns the cursor that resumes a transaction history
+// query after pt. The cursor identifies pt by its confirmation height and ID
+// rather than by its index in bucketProcessedTransactions, because the index
+// is reused by the transactions confirmed after a reorg.
+func encodeHistoryCursor(pt modules.ProcessedTransaction) string {
+	b := make([]byte, 8+len(pt.TransactionID))
+	binary.BigEndian.PutUint64(b, uint64(pt.ConfirmationHeight))
+	copy(b[8:], pt.TransactionID[:])
+	return hex.EncodeToString(b)
+}
+
+// decodeHistoryCursor returns the confirmation height and ID of the
+// transaction encoded in a transaction history cursor.
+func decodeHistoryCursor(cursor string) (height types.BlockHeight, txid types.TransactionID, err error) {
+	b, err := hex.DecodeString(cursor)
+	if err != nil || len(b) != 8+len(txid) {
+		return 0, types.TransactionID{}, errInvalidHistoryCursor
+	}
+	copy(txid[:], b[8:])
+	return types.BlockHeight(binary.BigEndian.Uint64(b)), txid, nil
+}
+
+// dbSearchProcessedTransactions returns the smallest index in
+// bucketProcessedTransactions for which f is true, or one past the last index
+// if there is none. f must be false up to some index and true from there on.
+func dbSearchProcessedTransactions(tx *bolt.Tx, f func(index uint64) (bool, error)) (index uint64, err error) {
+	n := int(tx.Bucket(bucketProcessedTransactions).Sequence())
+	i := sort.Search(n, func(i int) bool {
+		if err != nil {
+			return false
+		}
+		var ok bool
+		ok, err = f(uint64(i) + 1)
+		return ok
+	})
+	return uint64(i) + 1, err
+}
+
+// dbFirstAboveHeight returns the index of the first processed transaction
+// confirmed at or above height. The keys of bucketProcessedTransactions are
+// contiguous and the transactions are stored in the order they were
+// confirmed, so it can be found by binary search.
+func dbFirstAboveHeight(tx *bolt.Tx, height types.BlockHeight) (uint64, error) {
+	return dbSearchProcessedTransactions(tx, func(index uint64) (bool, error) {
+		pt, err := dbGetProcessedTransaction(tx, index)
+		return pt.ConfirmationHeight >= height, err
+	})
+}
+
+// dbHistoryRange returns the first and last index of the processed
+// transactions that can match the height and time range of q. The range is
+// empty if first > last. The time range only narrows the indexes down, so the
+// timestamps of the transactions in the range still need to be checked.
+func dbHistoryRange(tx *bolt.Tx, q modules.TransactionHistoryQuery) (first, last uint64, err error) {
+	first, err = dbFirstAboveHeight(tx, q.MinHeight)
+	if err != nil {
+		return 0, 0, err
+	}
+	last = tx.Bucket(bucketProcessedTransactions).Sequence()
+	if q.MaxHeight != 0 {
+		if last, err = dbFirstAboveHeight(tx, q.MaxHeight+1); err != nil {
+			return 0, 0, err
+		}
+		last--
+	}
+	if q.MinTime != 0 {
+		// no transaction before the first one confirmed at or after MinTime
+		// can match
+		i, err := dbSearchProcessedTransactions(tx, func(index uint64) (bool, error) {
+			bounds, err := dbGetTransactionTimeBounds(tx, index)
+			return bounds.Latest >= q.MinTime, err
+		})
+		if err != nil {
+			return 0, 0, err
+		} else if i > first {
+			first = i
+		}
+	}
+	if q.MaxTime != 0 {
+		// no transaction after the last one confirmed at or before MaxTime
+		// can match
+		i, err := dbSearchProcessedTransactions(tx, func(index uint64) (bool, error) {
+			bounds, err := dbGetTransactionTimeBounds(tx, index)
+			return bounds.Earliest > q.MaxTime, err
+		})
+		if err != nil {
+			return 0, 0, err
+		} else if i-1 < last {
+			last = i - 1
+		}
+	}
+	return first, last, nil
+}
+
+// dbResumeHistory narrows [first, last] down to the transactions after the
+// transaction of a cursor. If the transaction was reverted by a reorg, every
+// transaction that is now confirmed at or above its height was confirmed
+// after the previous page was returned, so the query resumes at its height.
+func dbResumeHistory(tx *bolt.Tx, height types.BlockHeight, txid types.TransactionID, first, last uint64, descending bool) (uint64, uint64, error) {
+	var index uint64
+	if key, err := dbGetTransactionIndex(tx, txid); err == nil && len(key) == 8 {
+		pt, err := dbGetProcessedTransaction(tx, binary.BigEndian.Uint64(key))
+		if err != nil {
+			return 0, 0, err
+		}
+		if pt.ConfirmationHeight == height {
+			index = binary.BigEndian.Uint64(key)
+		}
+	} else if err != nil && err != errNoKey {
+		return 0, 0, err
+	}
+
+	switch {
+	case index != 0 && descending:
+		if index-1 < last {
+			last = index - 1
+		}
+	case index != 0:
+		if index+1 > first {
+			first = index + 1
+		}
+	case descending:
+		i, err := dbFirstAboveHeight(tx, height+1)
+		if err != nil {
+			return 0, 0, err
+		}
+		if i-1 < last {
+			last = i - 1
+		}
+	default:
+		i, err := dbFirstAboveHeight(tx, height)
+		if err != nil {
+			return 0, 0, err
+		}
+		if i > first {
+			first = i
+		}
+	}
+	return first, last, nil
+}
+
+// indexCursor returns a function that walks the keys of a bucket that start
+// with prefix and end in a big-endian transaction index, returning the
+// indexes in [first, last] in ascending or descending order.
+func indexCursor(c *bolt.Cursor, prefix []byte, first, last uint64, descending bool) func() (uint64, bool) {
+	key := func(index uint64) []byte {
+		k := make([]byte, len(prefix)+8)
+		copy(k, prefix)
+		binary.BigEndian.PutUint64(k[len(prefix):], index)
+		return k
+	}
+	started := false
+	return func() (uint64, bool) {
+		var k []byte
+		switch {
+		case !started && descending:
+			start := key(last)
+			if k, _ = c.Seek(start); k == nil {
+				k, _ = c.Last()
+			} else if !bytes.Equal(k, start) {
+				k, _ = c.Prev()
+			}
+		case !started:
+			k, _ = c.Seek(key(first))
+		case descending:
+			k, _ = c.Prev()
+		default:
+			k, _ = c.Next()
+		}
+		started = true
+		if len(k) != len(prefix)+8 || !bytes.HasPrefix(k, prefix) {
+			return 0, false
+		}
+		index := binary.BigEndian.Uint64(k[len(prefix):])
+		if index < first || index > last {
+			return 0, false
+		}
+		return index, true
+	}
+}
+
+// dbAddrTransactionsCursor returns a function that walks the indexes in
+// [first, last] of the transactions involving any of addrs, in ascending or
+// descending order. It merges the walks of the address index of every
+// address, so a page only reads the index entries it visits.
+func dbAddrTransactionsCursor(tx *bolt.Tx, addrs map[types.UnlockHash]struct{}, first, last uint64, descending bool) func() (uint64, bool) {
+	type head struct {
+		next  func() (uint64, bool)
+		index uint64
+	}
+	b := tx.Bucket(bucketAddrTransactionIndex)
+	var heads []*head
+	for addr := range addrs {
+		h := &head{next: indexCursor(b.Cursor(), addr[:], first, last, descending)}
+		if index, ok := h.next(); ok {
+			h.index = index
+			heads = append(heads, h)
+		}
+	}
+	return func() (uint64, bool) {
+		if len(heads) == 0 {
+			return 0, false
+		}
+		index := heads[0].index
+		for _, h := range heads[1:] {
+			if (descending && h.index > index) || (!descending && h.index < index) {
+				index = h.index
+			}
+		}
+		// advance every address that involves the transaction, so that it
+		// is returned only once
+		remaining := heads[:0]
+		for _, h := range heads {
+			if h.index == index {
+				var ok bool
+				if h.index, ok = h.next(); !ok {
+					continue
+				}
+			}
+			remaining = append(remaining, h)
+		}
+		heads = remaining
+		return index, true
+	}
+}
+
+// historyAddresses returns the set of addresses a transaction history query
+// is restricted to, and whether it is restricted at all.
+func (w *Wallet) historyAddresses(q modules.TransactionHistoryQuery) (map[types.UnlockHash]struct{}, bool) {
+	var sets []map[types.UnlockHash]struct{}
+	if len(q.Addresses) > 0 {
+		set := make(map[types.UnlockHash]struct{})
+		for _, addr := range q.Addresses {
+			set[addr] = struct{}{}
+		}
+		sets = append(sets, set)
+	}
+	if q.Label != "" {
+		set := make(map[types.UnlockHash]struct{})
+		for addr, label := range w.addressLabels {
+			if label == q.Label {
+				set[addr] = struct{}{}
+			}
+		}
+		sets = append(sets, set)
+	}
+	if q.Category == modules.TxnCategoryWatch {
+		sets = append(sets, w.watchedAddrs)
+	}
+	if len(sets) == 0 {
+		return nil, false
+	}
+
+	addrs := make(map[types.UnlockHash]struct{})
+	for addr := range sets[0] {
+		in := true
+		for _, set := range sets[1:] {
+			_, ok := set[addr]
+			in = in && ok
+		}
+		if in {
+			addrs[addr] = struct{}{}
+		}
+	}
+	return addrs, true
+}
+
+// historyValue returns the larger of the value pt spends from and the value
+// it sends to the wallet's and watched addresses.
+func (w *Wallet) historyValue(pt modules.ProcessedTransaction) types.Currency {
+	var in, out types.Currency
+	for _, input := range pt.Inputs {
+		if _, watched := w.watchedAddrs[input.RelatedAddress]; input.WalletAddress || watched {
+			in = in.Add(input.Value)
+		}
+	}
+	for _, output := range pt.Outputs {
+		if _, watched := w.watchedAddrs[output.RelatedAddress]; output.WalletAddress || watched {
+			out = out.Add(output.Value)
+		}
+	}
+	if in.Cmp(out) > 0 {
+		return in
+	}
+	return out
+}
+
+// historyMatches returns whether pt passes the filters of q that are not
+// already enforced by the index the query walks.
+func (w *Wallet) historyMatches(q modules.TransactionHistoryQuery, pt modules.ProcessedTransaction, addrs map[types.UnlockHash]struct{}) bool {
+	if pt.ConfirmationTimestamp < q.MinTime || (q.MaxTime != 0 && pt.ConfirmationTimestamp > q.MaxTime) {
+		return false
+	}
+	if addrs != nil {
+		involved := false
+		for _, input := range pt.Inputs {
+			_, ok := addrs[input.RelatedAddress]
+			involved = involved || ok
+		}
+		for _, output := range pt.Outputs {
+			_, ok := addrs[output.RelatedAddress]
+			involved = involved || ok
+		}
+		if !involved {
+			return false
+		}
+	}
+	if q.Category != "" && q.Category != modules.TxnCategoryWatch {
+		found := false
+		for _, category := range processedTransactionCategories(pt) {
+			found = found || category == q.Category
+		}
+		if !found {
+			return false
+		}
+	}
+	return q.MinValue.IsZero() || w.historyValue(pt).Cmp(q.MinValue) >= 0
+}
+
+// TransactionHistory returns a page of the confirmed transactions that match
+// the query. The query walks the most selective index available: the address
+// index if it is restricted to a set of addresses, the category index if it
+// filters by category, and the processed transactions otherwise. The height
+// and time ranges and the cursor bound the walk, and the remaining filters
+// are applied to each transaction the walk visits.
+func (w *Wallet) TransactionHistory(q modules.TransactionHistoryQuery) (page modules.TransactionHistoryPage, err error) {
+	if err := w.tg.Add(); err != nil {
+		return modules.TransactionHistoryPage{}, err
+	}
+	defer w.tg.Done()
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = modules.DefaultTransactionHistoryLimit
+	} else if limit > modules.MaxTransactionHistoryLimit {
+		limit = modules.MaxTransactionHistoryLimit
+	}
+	var afterHeight types.BlockHeight
+	var afterID types.TransactionID
+	if q.Cursor != "" {
+		if afterHeight, afterID, err = decodeHistoryCursor(q.Cursor); err != nil {
+			return modules.TransactionHistoryPage{}, err
+		}
+	}
+	switch q.Category {
+	case "", modules.TxnCategoryMiner, modules.TxnCategoryContract, modules.TxnCategorySend,
+		modules.TxnCategoryReceive, modules.TxnCategoryWatch:
+	default:
+		return modules.TransactionHistoryPage{}, errUnknownTxnCategory
+	}
+
+	// ensure durability of reported transactions
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err = w.syncDB(); err != nil {
+		return modules.TransactionHistoryPage{}, err
+	}
+
+	first, last, err := dbHistoryRange(w.dbTx, q)
+	if err != nil {
+		return modules.TransactionHistoryPage{}, err
+	}
+	if q.Cursor != "" {
+		first, last, err = dbResumeHistory(w.dbTx, afterHeight, afterID, first, last, q.Descending)
+		if err != nil {
+			return modules.TransactionHistoryPage{}, err
+		}
+	}
+	if first > last {
+		return page, nil
+	}
+
+	var next func() (uint64, bool)
+	addrs, restricted := w.historyAddresses(q)
+	switch {
+	case restricted:
+		next = dbAddrTransactionsCursor(w.dbTx, addrs, first, last, q.Descending)
+	case q.Category != "":
+		prefix := categoryKey(q.Category, 0)[:len(q.Category)+1]
+		next = indexCursor(w.dbTx.Bucket(bucketCategoryTransactions).Cursor(), prefix, first, last, q.Descending)
+	default:
+		next = indexCursor(w.dbTx.Bucket(bucketProcessedTransactions).Cursor(), nil, first, last, q.Descending)
+	}
+
+	for index, ok := next(); ok; index, ok = next() {
+		pt, err := dbGetProcessedTransaction(w.dbTx, index)
+		if err != nil {
+			return modules.TransactionHistoryPage{}, err
+		}
+		if !w.historyMatches(q, pt, addrs) {
+			continue
+		}
+		if len(page.Transactions) == limit {
+			// There is at least one more matching transaction, so the
+			// caller needs a cursor to fetch the next page.
+			page.NextCursor = encodeHistoryCursor(page.Transactions[len(page.Transactions)-1])
+			break
+		}
+		page.Transactions = append(page.Transactions, pt)
+	}
+	return page, nil
+}
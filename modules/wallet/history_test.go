@@ -0,0 +1,402 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+// allHistory pages through the transaction history matching q and returns
+// the transaction IDs in the order they were returned.
+func (wt *walletTester) allHistory(q modules.TransactionHistoryQuery) ([]types.TransactionID, error) {
+	var ids []types.TransactionID
+	for {
+		page, err := wt.wallet.TransactionHistory(q)
+		if err != nil {
+			return nil, err
+		}
+		for _, pt := range page.Transactions {
+			ids = append(ids, pt.TransactionID)
+		}
+		if page.NextCursor == "" {
+			return ids, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+// TestTransactionHistory probes the TransactionHistory method of the wallet.
+func TestTransactionHistory(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester(t.Name(), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Send coins to a labeled address of the wallet in two blocks.
+	uc, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.wallet.SetAddressLabel(uc.UnlockHash(), "savings"); err != nil {
+		t.Fatal(err)
+	}
+	var sendHeights []types.BlockHeight
+	for i := 0; i < 2; i++ {
+		if _, err := wt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), uc.UnlockHash()); err != nil {
+			t.Fatal(err)
+		}
+		if err := wt.addBlockNoPayout(); err != nil {
+			t.Fatal(err)
+		}
+		sendHeights = append(sendHeights, wt.cs.Height())
+	}
+
+	// Paging through the whole history returns the same transactions as
+	// Transactions, in either order.
+	pts, err := wt.wallet.Transactions(0, wt.cs.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	asc, err := wt.allHistory(modules.TransactionHistoryQuery{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := wt.allHistory(modules.TransactionHistoryQuery{Limit: 4, Descending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(asc) != len(pts) || len(desc) != len(pts) {
+		t.Fatal("wrong number of transactions", len(pts), len(asc), len(desc))
+	}
+	for i, pt := range pts {
+		if asc[i] != pt.TransactionID || desc[len(desc)-1-i] != pt.TransactionID {
+			t.Fatal("transactions returned in the wrong order")
+		}
+	}
+
+	// Filter by category.
+	var miner int
+	for _, pt := range pts {
+		for _, output := range pt.Outputs {
+			if output.FundType == types.SpecifierMinerPayout && output.WalletAddress {
+				miner++
+				break
+			}
+		}
+	}
+	ids, err := wt.allHistory(modules.TransactionHistoryQuery{Category: modules.TxnCategoryMiner, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if miner == 0 || len(ids) != miner {
+		t.Fatal("wrong number of miner transactions", miner, len(ids))
+	}
+	sends, err := wt.allHistory(modules.TransactionHistoryQuery{Category: modules.TxnCategorySend, Descending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sends) != 2 {
+		t.Fatal("expected 2 send transactions, got", len(sends))
+	}
+
+	// Filter by label, height and value.
+	ids, err = wt.allHistory(modules.TransactionHistoryQuery{Label: "savings", Descending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != sends[0] || ids[1] != sends[1] {
+		t.Fatal("wrong transactions for label", ids, sends)
+	}
+	ids, err = wt.allHistory(modules.TransactionHistoryQuery{
+		Category:  modules.TxnCategorySend,
+		MinHeight: sendHeights[1],
+		MaxHeight: sendHeights[1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != sends[0] {
+		t.Fatal("wrong transactions for height range", ids)
+	}
+	ids, err = wt.allHistory(modules.TransactionHistoryQuery{
+		Addresses: []types.UnlockHash{uc.UnlockHash()},
+		MinValue:  types.SiacoinPrecision.Mul64(1e12),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatal("expected no transactions above the minimum value, got", len(ids))
+	}
+
+	// Bad queries are rejected.
+	if _, err := wt.wallet.TransactionHistory(modules.TransactionHistoryQuery{Cursor: "nope"}); err != errInvalidHistoryCursor {
+		t.Fatal("expected errInvalidHistoryCursor, got", err)
+	}
+	if _, err := wt.wallet.TransactionHistory(modules.TransactionHistoryQuery{Category: "gifts"}); err != errUnknownTxnCategory {
+		t.Fatal("expected errUnknownTxnCategory, got", err)
+	}
+
+	// The indexes are rebuilt if they are missing.
+	wt.wallet.mu.Lock()
+	for _, bucket := range [][]byte{bucketCategoryTransactions, bucketAddrTransactionIndex, bucketTransactionTimeBounds} {
+		if err := wt.wallet.dbTx.DeleteBucket(bucket); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wt.wallet.syncDB(); err != nil {
+		t.Fatal(err)
+	}
+	wt.wallet.mu.Unlock()
+	if err := wt.wallet.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w, err := New(wt.cs, wt.tpool, wt.wallet.persistDir, modules.DefaultAddressGapLimit, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt.wallet = w
+	if err := w.Unlock(wt.walletMasterKey); err != nil {
+		t.Fatal(err)
+	}
+	ids, err = wt.allHistory(modules.TransactionHistoryQuery{Category: modules.TxnCategoryMiner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != miner {
+		t.Fatal("category index was not rebuilt", miner, len(ids))
+	}
+	ids, err = wt.allHistory(modules.TransactionHistoryQuery{Label: "savings", Descending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != sends[0] || ids[1] != sends[1] {
+		t.Fatal("address index was not rebuilt", ids, sends)
+	}
+	last := pts[len(pts)-1]
+	ids, err = wt.allHistory(modules.TransactionHistoryQuery{MinTime: last.ConfirmationTimestamp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) == 0 || ids[len(ids)-1] != last.TransactionID {
+		t.Fatal("time bounds were not rebuilt", ids)
+	}
+}
+
+// appendTestTransactions appends processed transactions with the provided
+// timestamps at height to the wallet's database.
+func (wt *walletTester) appendTestTransactions(height types.BlockHeight, timestamps ...types.Timestamp) ([]types.TransactionID, error) {
+	wt.wallet.mu.Lock()
+	defer wt.wallet.mu.Unlock()
+	var ids []types.TransactionID
+	for _, ts := range timestamps {
+		pt := modules.ProcessedTransaction{
+			ConfirmationHeight:    height,
+			ConfirmationTimestamp: ts,
+		}
+		fastrand.Read(pt.TransactionID[:])
+		if err := dbAppendProcessedTransaction(wt.wallet.dbTx, pt); err != nil {
+			return nil, err
+		}
+		ids = append(ids, pt.TransactionID)
+	}
+	return ids, nil
+}
+
+// deleteTestTransactions deletes the last n processed transactions from the
+// wallet's database, as a reorg would.
+func (wt *walletTester) deleteTestTransactions(n int) error {
+	wt.wallet.mu.Lock()
+	defer wt.wallet.mu.Unlock()
+	for i := 0; i < n; i++ {
+		if err := dbDeleteLastProcessedTransaction(wt.wallet.dbTx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestTransactionHistoryCursorReorg tests that a cursor resumes after its
+// transaction even if transactions were reverted, and that a cursor whose
+// transaction was reverted resumes at the height of the transaction.
+func TestTransactionHistoryCursorReorg(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester(t.Name(), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	height := wt.cs.Height() + 1
+	old, err := wt.appendTestTransactions(height, 1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := wt.allHistory(modules.TransactionHistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := wt.wallet.TransactionHistory(modules.TransactionHistoryQuery{Limit: len(all) - 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.NextCursor == "" || page.Transactions[len(page.Transactions)-1].TransactionID != old[0] {
+		t.Fatal("expected the page to end at the first test transaction")
+	}
+
+	// The last transaction is replaced by a reorg. The cursor resumes after
+	// its transaction, which is still confirmed.
+	if err := wt.deleteTestTransactions(1); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := wt.appendTestTransactions(height, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := wt.allHistory(modules.TransactionHistoryQuery{Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != old[1] || ids[1] != replaced[0] {
+		t.Fatal("cursor didn't resume after its transaction", ids)
+	}
+
+	// Once the transaction of the cursor is reverted as well, the cursor
+	// resumes at its height in either order.
+	if err := wt.deleteTestTransactions(3); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err = wt.appendTestTransactions(height, 5, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err = wt.allHistory(modules.TransactionHistoryQuery{Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != replaced[0] || ids[1] != replaced[1] {
+		t.Fatal("cursor of a reverted transaction didn't resume at its height", ids)
+	}
+	ids, err = wt.allHistory(modules.TransactionHistoryQuery{Cursor: page.NextCursor, Descending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(all)-1 || ids[0] != replaced[1] || ids[1] != replaced[0] {
+		t.Fatal("descending cursor of a reverted transaction didn't resume at its height", ids)
+	}
+}
+
+// TestTransactionHistoryTimeBounds tests that the time bounds narrow the
+// history down to the transactions within a time range even though the
+// timestamps are not monotonic, and that they are restored when the last
+// transactions are deleted.
+func TestTransactionHistoryTimeBounds(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester(t.Name(), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Start after the timestamps of the existing transactions.
+	pts, err := wt.wallet.Transactions(0, wt.cs.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var base types.Timestamp
+	for _, pt := range pts {
+		if pt.ConfirmationTimestamp > base {
+			base = pt.ConfirmationTimestamp
+		}
+	}
+	base += 100
+	timestamps := []types.Timestamp{base + 30, base + 10, base + 40, base + 20, base + 50, base + 5}
+	ids, err := wt.appendTestTransactions(wt.cs.Height()+1, timestamps...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// inRange returns the test transactions within [min, max].
+	inRange := func(min, max types.Timestamp, n int) (expected []types.TransactionID) {
+		for i, ts := range timestamps[:n] {
+			if ts >= min && ts <= max {
+				expected = append(expected, ids[i])
+			}
+		}
+		return expected
+	}
+	check := func(n int) {
+		// the stored bounds are the running maximum and the suffix minimum
+		// of the timestamps
+		wt.wallet.mu.Lock()
+		seq := wt.wallet.dbTx.Bucket(bucketProcessedTransactions).Sequence()
+		var latest types.Timestamp
+		earliest := make([]types.Timestamp, seq+2)
+		earliest[seq+1] = ^types.Timestamp(0)
+		for i := seq; i > 0; i-- {
+			pt, err := dbGetProcessedTransaction(wt.wallet.dbTx, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			earliest[i] = earliest[i+1]
+			if pt.ConfirmationTimestamp < earliest[i] {
+				earliest[i] = pt.ConfirmationTimestamp
+			}
+		}
+		for i := uint64(1); i <= seq; i++ {
+			pt, err := dbGetProcessedTransaction(wt.wallet.dbTx, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pt.ConfirmationTimestamp > latest {
+				latest = pt.ConfirmationTimestamp
+			}
+			bounds, err := dbGetTransactionTimeBounds(wt.wallet.dbTx, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bounds.Latest != latest || bounds.Earliest != earliest[i] || bounds.Time != pt.ConfirmationTimestamp {
+				t.Fatal("wrong time bounds of transaction", i, bounds, latest, earliest[i])
+			}
+		}
+		wt.wallet.mu.Unlock()
+
+		for _, r := range [][2]types.Timestamp{{base + 10, base + 30}, {base + 6, base + 19}, {base + 21, base + 60}, {base, base + 5}} {
+			got, err := wt.allHistory(modules.TransactionHistoryQuery{MinTime: r[0], MaxTime: r[1], Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := inRange(r[0], r[1], n)
+			if len(got) != len(expected) {
+				t.Fatalf("wrong transactions in [%v, %v]: expected %v, got %v", r[0], r[1], expected, got)
+			}
+			for i := range got {
+				if got[i] != expected[i] {
+					t.Fatalf("wrong transactions in [%v, %v]: expected %v, got %v", r[0], r[1], expected, got)
+				}
+			}
+		}
+	}
+	check(len(timestamps))
+
+	// Deleting the transactions with the earliest timestamps restores the
+	// bounds of the previous transactions.
+	if err := wt.deleteTestTransactions(1); err != nil {
+		t.Fatal(err)
+	}
+	check(len(timestamps) - 1)
+	if err := wt.deleteTestTransactions(4); err != nil {
+		t.Fatal(err)
+	}
+	check(1)
+}
@@ -0,0 +1,286 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/persist"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+const (
+	// walletsDir is the directory inside the default wallet's persist
+	// directory that holds one directory per named wallet.
+	walletsDir = "wallets"
+
+	// managerFile stores the names of the wallets that are loaded on
+	// startup.
+	managerFile = "wallets.json"
+)
+
+var (
+	managerMetadata = persist.Metadata{
+		Header:  "Wallet Manager",
+		Version: "1.0.0",
+	}
+
+	// validWalletName matches the names that named wallets may have. Names
+	// are used as directory names.
+	validWalletName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+	errInvalidWalletName = errors.New("wallet names must be 1-64 letters, digits, '-' or '_'")
+	errWalletExists      = errors.New("a wallet with that name already exists")
+)
+
+// managerPersist is the persisted state of a Manager.
+type managerPersist struct {
+	Loaded []string `json:"loaded"`
+}
+
+// A Manager manages the named wallets of a node next to its default wallet.
+// Named wallets are stored in their own directories below the default
+// wallet's directory and share its consensus set and transaction pool.
+type Manager struct {
+	defaultWallet *Wallet
+	wallets       map[string]*Wallet
+	inUse         map[string]int
+	persistDir    string
+	mu            sync.Mutex
+}
+
+// NewManager creates a wallet manager next to the default wallet w and loads
+// every named wallet that was loaded when the node last shut down.
+func NewManager(w *Wallet) (*Manager, error) {
+	m := &Manager{
+		defaultWallet: w,
+		wallets:       make(map[string]*Wallet),
+		inUse:         make(map[string]int),
+		persistDir:    filepath.Join(w.persistDir, walletsDir),
+	}
+	if err := os.MkdirAll(m.persistDir, 0700); err != nil {
+		return nil, err
+	}
+
+	var p managerPersist
+	err := persist.LoadJSON(managerMetadata, &p, filepath.Join(m.persistDir, managerFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, name := range p.Loaded {
+		if _, err := m.openWallet(name); err != nil {
+			m.Close()
+			return nil, build.ExtendErr("unable to load wallet "+name, err)
+		}
+	}
+	m.setKeysFuncs()
+	return m, nil
+}
+
+// openWallet opens the named wallet and adds it to the loaded wallets.
+func (m *Manager) openWallet(name string) (*Wallet, error) {
+	w := m.defaultWallet
+	nw, err := NewCustomWallet(w.cs, w.tpool, filepath.Join(m.persistDir, name), int(w.addressGapLimit), w.scanAirdrop, w.deps)
+	if err != nil {
+		return nil, err
+	}
+	m.wallets[name] = nw
+	return nw, nil
+}
+
+// save stores the names of the loaded wallets.
+func (m *Manager) save() error {
+	var p managerPersist
+	for name := range m.wallets {
+		p.Loaded = append(p.Loaded, name)
+	}
+	sort.Strings(p.Loaded)
+	return persist.SaveJSON(managerMetadata, p, filepath.Join(m.persistDir, managerFile))
+}
+
+// setKeysFuncs tells the consensus set and transaction pool about the
+// addresses of every loaded wallet. Each wallet registers only its own
+// addresses when it is created, so this has to be redone whenever a wallet is
+// loaded or unloaded.
+func (m *Manager) setKeysFuncs() {
+	wallets := []*Wallet{m.defaultWallet}
+	for _, w := range m.wallets {
+		wallets = append(wallets, w)
+	}
+	m.defaultWallet.cs.SetGetWalletKeysFunc(func() ([][]byte, error) {
+		var keys [][]byte
+		for _, w := range wallets {
+			wk, err := w.allAddressesInByteArray()
+			if err != nil && err != modules.ErrWalletShutdown {
+				return nil, err
+			}
+			keys = append(keys, wk...)
+		}
+		return keys, nil
+	})
+	m.defaultWallet.tpool.SetGetWalletKeysFunc(func() (map[types.UnlockHash]bool, error) {
+		keys := make(map[types.UnlockHash]bool)
+		for _, w := range wallets {
+			wk, err := w.allAddressesInMap()
+			if err != nil && err != modules.ErrWalletShutdown {
+				return nil, err
+			}
+			for uh := range wk {
+				keys[uh] = true
+			}
+		}
+		return keys, nil
+	})
+}
+
+// CreateWallet creates a new, uninitialized named wallet and loads it.
+func (m *Manager) CreateWallet(name string) (modules.Wallet, error) {
+	if !validWalletName.MatchString(name) {
+		return nil, errInvalidWalletName
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := os.Stat(filepath.Join(m.persistDir, name)); !os.IsNotExist(err) {
+		return nil, errWalletExists
+	}
+	w, err := m.openWallet(name)
+	if err != nil {
+		return nil, err
+	}
+	m.setKeysFuncs()
+	return w, m.save()
+}
+
+// LoadWallet loads an existing named wallet. Loading a wallet that is
+// already loaded is a no-op.
+func (m *Manager) LoadWallet(name string) (modules.Wallet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.managedLoadWallet(name)
+}
+
+// managedLoadWallet loads an existing named wallet. The caller must hold the
+// lock.
+func (m *Manager) managedLoadWallet(name string) (*Wallet, error) {
+	if w, ok := m.wallets[name]; ok {
+		return w, nil
+	}
+	if !validWalletName.MatchString(name) {
+		return nil, errInvalidWalletName
+	}
+	if _, err := os.Stat(filepath.Join(m.persistDir, name)); os.IsNotExist(err) {
+		return nil, modules.ErrUnknownWallet
+	}
+	w, err := m.openWallet(name)
+	if err != nil {
+		return nil, err
+	}
+	m.setKeysFuncs()
+	return w, m.save()
+}
+
+// UnloadWallet closes a named wallet. It stays on disk and can be loaded
+// again.
+func (m *Manager) UnloadWallet(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.wallets[name]
+	if !ok {
+		return modules.ErrUnknownWallet
+	}
+	if m.inUse[name] > 0 {
+		return modules.ErrWalletInUse
+	}
+	delete(m.wallets, name)
+	m.setKeysFuncs()
+	return build.ComposeErrors(w.Close(), m.save())
+}
+
+// Wallet returns the loaded wallet with the given name. The empty name refers
+// to the default wallet.
+func (m *Manager) Wallet(name string) (modules.Wallet, error) {
+	if name == "" {
+		return m.defaultWallet, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.wallets[name]
+	if !ok {
+		return nil, modules.ErrUnknownWallet
+	}
+	return w, nil
+}
+
+// UseWallet returns the named wallet for a module that funds itself from it,
+// such as the renter or host. The wallet is created or loaded if necessary,
+// and can't be unloaded while the node is running.
+func (m *Manager) UseWallet(name string) (modules.Wallet, error) {
+	if name == "" {
+		return m.defaultWallet, nil
+	}
+	if !validWalletName.MatchString(name) {
+		return nil, errInvalidWalletName
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := os.Stat(filepath.Join(m.persistDir, name)); os.IsNotExist(err) {
+		if _, err := m.openWallet(name); err != nil {
+			return nil, err
+		}
+		m.setKeysFuncs()
+		if err := m.save(); err != nil {
+			return nil, err
+		}
+	}
+	w, err := m.managedLoadWallet(name)
+	if err != nil {
+		return nil, err
+	}
+	m.inUse[name]++
+	return w, nil
+}
+
+// Wallets lists every named wallet on disk.
+func (m *Manager) Wallets() ([]modules.WalletInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fis, err := ioutil.ReadDir(m.persistDir)
+	if err != nil {
+		return nil, err
+	}
+	var infos []modules.WalletInfo
+	for _, fi := range fis {
+		if !fi.IsDir() || !validWalletName.MatchString(fi.Name()) {
+			continue
+		}
+		info := modules.WalletInfo{
+			Name:  fi.Name(),
+			InUse: m.inUse[fi.Name()] > 0,
+		}
+		if w, ok := m.wallets[fi.Name()]; ok {
+			info.Loaded = true
+			info.Unlocked = w.managedUnlocked()
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Close closes every loaded named wallet. The default wallet is not closed.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	for name, w := range m.wallets {
+		if err := w.Close(); err != nil {
+			errs = append(errs, build.ExtendErr("unable to close wallet "+name, err))
+		}
+	}
+	return build.JoinErrors(errs, "; ")
+}
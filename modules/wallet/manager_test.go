@@ -0,0 +1,139 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+// TestManager probes the creating, loading and unloading of named wallets.
+func TestManager(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester(t.Name(), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	m, err := NewManager(wt.wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid and duplicate names are rejected.
+	if _, err := m.CreateWallet("../ops"); err != errInvalidWalletName {
+		t.Fatal("expected errInvalidWalletName, got", err)
+	}
+	w, err := m.CreateWallet("ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateWallet("ops"); err != errWalletExists {
+		t.Fatal("expected errWalletExists, got", err)
+	}
+	if dw, _ := m.Wallet(""); dw != modules.Wallet(wt.wallet) {
+		t.Fatal("the empty name should refer to the default wallet")
+	}
+
+	// The named wallet has its own seed and is locked independently.
+	masterKey := crypto.GenerateSiaKey(crypto.TypeDefaultWallet)
+	seed, err := w.Encrypt(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Unlock(masterKey); err != nil {
+		t.Fatal(err)
+	}
+	defaultSeed, _, err := wt.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seed == defaultSeed {
+		t.Fatal("named wallet shares the default wallet's seed")
+	}
+	uc, err := w.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.wallet.UnlockConditions(uc.UnlockHash()); err == nil {
+		t.Fatal("default wallet knows the named wallet's address")
+	}
+
+	// Money sent to the named wallet shows up in its balance.
+	if _, err := wt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), uc.UnlockHash()); err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.addBlockNoPayout(); err != nil {
+		t.Fatal(err)
+	}
+	balance, err := w.ConfirmedBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balance.Equals(types.SiacoinPrecision.Mul64(100)) {
+		t.Fatal("named wallet has the wrong balance", balance)
+	}
+
+	// A wallet used by another module can't be unloaded.
+	if _, err := m.UseWallet("hosting"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UnloadWallet("hosting"); err != modules.ErrWalletInUse {
+		t.Fatal("expected ErrWalletInUse, got", err)
+	}
+	infos, err := m.Wallets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Name != "hosting" || !infos[0].InUse || infos[1].Name != "ops" || !infos[1].Unlocked {
+		t.Fatal("unexpected wallet list", infos)
+	}
+
+	// Unload the wallet. It stays on disk, and can be loaded again.
+	if err := m.UnloadWallet("ops"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Wallet("ops"); err != modules.ErrUnknownWallet {
+		t.Fatal("expected ErrUnknownWallet, got", err)
+	}
+	if infos, _ := m.Wallets(); len(infos) != 2 || infos[1].Loaded {
+		t.Fatal("unloaded wallet should be listed as not loaded", infos)
+	}
+	if _, err := m.LoadWallet("missing"); err != modules.ErrUnknownWallet {
+		t.Fatal("expected ErrUnknownWallet, got", err)
+	}
+	w, err = m.LoadWallet("ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Unlock(masterKey); err != nil {
+		t.Fatal(err)
+	}
+	balance, err = w.ConfirmedBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balance.Equals(types.SiacoinPrecision.Mul64(100)) {
+		t.Fatal("reloaded wallet has the wrong balance", balance)
+	}
+
+	// The loaded wallets are loaded again by a new manager.
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m, err = NewManager(wt.wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, err := m.Wallet("ops"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Wallet("hosting"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,468 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// paymentRequestCallbackAttempts is the number of times the wallet will
+	// try to deliver a payment request update to a callback URL before
+	// giving up.
+	paymentRequestCallbackAttempts = 5
+
+	// paymentRequestCallbackTimeout is the amount of time the wallet waits
+	// for a callback URL to respond.
+	paymentRequestCallbackTimeout = 30 * time.Second
+)
+
+var (
+	// paymentRequestCallbackBackoff is the amount of time the wallet waits
+	// after the first failed attempt to deliver a callback. The wait doubles
+	// after every further failure.
+	paymentRequestCallbackBackoff = build.Select(build.Var{
+		Dev:      5 * time.Second,
+		Standard: 30 * time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
+	// paymentRequestGapLimit is the maximum number of payment request
+	// addresses that can be created after the last one that received a
+	// payment. Seed scans look this far ahead for payments to payment
+	// requests, so the coins sent to them can be recovered from the seed.
+	paymentRequestGapLimit = build.Select(build.Var{
+		Dev:      uint64(1000),
+		Standard: uint64(10000),
+		Testing:  uint64(100),
+	}).(uint64)
+
+	// paymentRequestKeySpecifier is mixed into the derivation of the
+	// payment request keys of a seed.
+	paymentRequestKeySpecifier = types.Specifier{'p', 'a', 'y', 'm', 'e', 'n', 't', ' ', 'r', 'e', 'q', 'u', 'e', 's', 't'}
+
+	errBadCallbackURL          = errors.New("callback url must be an absolute http or https url")
+	errZeroPaymentRequest      = errors.New("cannot request a payment of zero hastings")
+	errDuplicatePaymentRequest = errors.New("a payment request already exists for that address")
+	errPaymentRequestGapLimit  = errors.New("too many payment requests are waiting for their first payment")
+)
+
+// paymentRequestFinal returns true if the wallet no longer needs to track
+// the payment request.
+func paymentRequestFinal(pr modules.PaymentRequest) bool {
+	switch pr.Status {
+	case modules.PaymentRequestExpired:
+		return true
+	case modules.PaymentRequestPaid:
+		return pr.Confirmations >= pr.RequiredConfirmations
+	}
+	return false
+}
+
+// paymentRequestPayments sums the outputs that pay to the address of the
+// payment request in pts. It also returns the index of the transaction that
+// pushed the sum over the requested amount, or -1 if the sum never reached
+// it.
+func paymentRequestPayments(pr modules.PaymentRequest, pts []modules.ProcessedTransaction) (total types.Currency, paidIndex int, txids []types.TransactionID) {
+	paidIndex = -1
+	for i, pt := range pts {
+		relevant := false
+		for _, sco := range pt.Transaction.SiacoinOutputs {
+			if sco.UnlockHash == pr.Address {
+				total = total.Add(sco.Value)
+				relevant = true
+			}
+		}
+		if !relevant {
+			continue
+		}
+		txids = append(txids, pt.TransactionID)
+		if paidIndex == -1 && total.Cmp(pr.Amount) >= 0 {
+			paidIndex = i
+		}
+	}
+	return total, paidIndex, txids
+}
+
+// computePaymentRequest derives the new state of a payment request from the
+// confirmed and unconfirmed transactions paying to its address.
+func computePaymentRequest(pr modules.PaymentRequest, confirmed, unconfirmed []modules.ProcessedTransaction, height types.BlockHeight) modules.PaymentRequest {
+	received, paidIndex, txids := paymentRequestPayments(pr, confirmed)
+	pending, _, unconfirmedIDs := paymentRequestPayments(pr, unconfirmed)
+
+	updated := pr
+	updated.Received = received
+	updated.Unconfirmed = pending
+	updated.TransactionIDs = append(txids, unconfirmedIDs...)
+	updated.PaidHeight = 0
+	updated.Confirmations = 0
+
+	switch {
+	case paidIndex != -1:
+		updated.Status = modules.PaymentRequestPaid
+		updated.PaidHeight = confirmed[paidIndex].ConfirmationHeight
+		updated.Confirmations = uint64(height-updated.PaidHeight) + 1
+		if updated.Confirmations > updated.RequiredConfirmations {
+			updated.Confirmations = updated.RequiredConfirmations
+		}
+	case received.Cmp(pr.Received) < 0:
+		updated.Status = modules.PaymentRequestReverted
+	case pr.ExpiryHeight != 0 && height >= pr.ExpiryHeight:
+		updated.Status = modules.PaymentRequestExpired
+	case pr.Status == modules.PaymentRequestReverted && received.Equals(pr.Received) && pending.Cmp(pr.Unconfirmed) <= 0:
+		// Nothing new has happened since the reorg, so the request stays
+		// reverted until it expires.
+		updated.Status = modules.PaymentRequestReverted
+	case !received.IsZero():
+		updated.Status = modules.PaymentRequestPartial
+	case !pending.IsZero():
+		updated.Status = modules.PaymentRequestSeen
+	default:
+		updated.Status = modules.PaymentRequestUnpaid
+	}
+	return updated
+}
+
+// advancePaymentRequest derives the new state of a payment request whose
+// payments didn't change from the new height. It matches the result of
+// computePaymentRequest for the same payments.
+func advancePaymentRequest(pr modules.PaymentRequest, height types.BlockHeight) modules.PaymentRequest {
+	updated := pr
+	switch {
+	case pr.Status == modules.PaymentRequestPaid:
+		updated.Confirmations = uint64(height-pr.PaidHeight) + 1
+		if updated.Confirmations > updated.RequiredConfirmations {
+			updated.Confirmations = updated.RequiredConfirmations
+		}
+	case pr.ExpiryHeight != 0 && height >= pr.ExpiryHeight:
+		updated.Status = modules.PaymentRequestExpired
+	case pr.Status == modules.PaymentRequestReverted:
+		// Nothing new has happened since the reorg.
+	}
+	return updated
+}
+
+// paymentRequestChanged returns true if an update needs to be sent for the
+// transition from pr to updated.
+func paymentRequestChanged(pr, updated modules.PaymentRequest) bool {
+	return pr.Status != updated.Status ||
+		pr.Confirmations != updated.Confirmations ||
+		!pr.Received.Equals(updated.Received) ||
+		!pr.Unconfirmed.Equals(updated.Unconfirmed)
+}
+
+// updatePaymentRequests recomputes the state of the tracked payment requests
+// whose addresses are in affected, persisting and queueing the updates of the
+// ones that changed. If newBlock is true, the confirmations and the expiry of
+// the other requests are updated as well. The queued updates are sent by
+// managedSendPaymentRequestUpdates once the wallet lock is released.
+func (w *Wallet) updatePaymentRequests(tx *bolt.Tx, affected map[types.UnlockHash]struct{}, newBlock bool) error {
+	if len(w.paymentRequests) == 0 {
+		return nil
+	}
+	height, err := dbGetConsensusHeight(tx)
+	if err != nil {
+		return err
+	}
+
+	// Index the unconfirmed transactions paying to the affected requests by
+	// address. Transactions that were confirmed in a block the wallet hasn't
+	// processed yet still count as unconfirmed.
+	unconfirmed := make(map[types.UnlockHash][]modules.ProcessedTransaction)
+	index := func(pts []modules.ProcessedTransaction) {
+		for _, pt := range pts {
+			for _, output := range pt.Outputs {
+				addr := output.RelatedAddress
+				if _, tracked := w.paymentRequests[addr]; !tracked {
+					continue
+				} else if _, ok := affected[addr]; !ok {
+					continue
+				}
+				if n := len(unconfirmed[addr]); n == 0 || unconfirmed[addr][n-1].TransactionID != pt.TransactionID {
+					unconfirmed[addr] = append(unconfirmed[addr], pt)
+				}
+			}
+		}
+	}
+	index(w.confirmingTransactions)
+	index(w.unconfirmedProcessedTransactions)
+
+	for addr, pr := range w.paymentRequests {
+		var updated modules.PaymentRequest
+		if _, ok := affected[addr]; ok {
+			var confirmed []modules.ProcessedTransaction
+			txnIndices, _ := dbGetAddrTransactions(tx, addr)
+			for _, i := range txnIndices {
+				pt, err := dbGetProcessedTransaction(tx, i)
+				if err != nil {
+					continue
+				}
+				confirmed = append(confirmed, pt)
+			}
+			updated = computePaymentRequest(pr, confirmed, unconfirmed[addr], height)
+		} else if newBlock {
+			updated = advancePaymentRequest(pr, height)
+		} else {
+			continue
+		}
+		if !paymentRequestChanged(pr, updated) {
+			continue
+		}
+		if err := dbPutPaymentRequest(tx, updated); err != nil {
+			return err
+		}
+		if paymentRequestFinal(updated) {
+			delete(w.paymentRequests, addr)
+		} else {
+			w.paymentRequests[addr] = updated
+		}
+		w.log.Printf("Payment request %v changed from %v to %v (received %v, unconfirmed %v, confirmations %v)\n",
+			addr, pr.Status, updated.Status, updated.Received.HumanString(), updated.Unconfirmed.HumanString(), updated.Confirmations)
+		w.paymentRequestUpdates = append(w.paymentRequestUpdates, modules.PaymentRequestUpdate{
+			PaymentRequest: updated,
+			PreviousStatus: pr.Status,
+		})
+	}
+	return nil
+}
+
+// updatePaymentRequestIndices records that the payment request keys that
+// received an output in sods were used, which allows creating further
+// payment requests without exceeding paymentRequestGapLimit.
+func (w *Wallet) updatePaymentRequestIndices(tx *bolt.Tx, sods []modules.SiacoinOutputDiff) error {
+	next, used, err := dbGetPaymentRequestIndices(tx)
+	if err != nil {
+		return err
+	}
+	newUsed := used
+	for _, diff := range sods {
+		index, exists := w.paymentRequestKeys[diff.SiacoinOutput.UnlockHash]
+		if exists && diff.Direction == modules.DiffApply && index >= newUsed {
+			newUsed = index + 1
+		}
+	}
+	if newUsed == used {
+		return nil
+	}
+	return dbPutPaymentRequestIndices(tx, next, newUsed)
+}
+
+// managedSendPaymentRequestUpdates sends the queued payment request updates
+// to all subscribers and, for the requests that have one, to their callback
+// URL. It must be called without holding the wallet lock. Updates are sent by
+// one thread at a time, in the order they were queued.
+func (w *Wallet) managedSendPaymentRequestUpdates() {
+	w.paymentRequestSendMu.Lock()
+	defer w.paymentRequestSendMu.Unlock()
+	w.mu.Lock()
+	updates := w.paymentRequestUpdates
+	w.paymentRequestUpdates = nil
+	subscribers := append([]modules.PaymentRequestSubscriber(nil), w.paymentRequestSubscribers...)
+	w.mu.Unlock()
+
+	for _, update := range updates {
+		for _, subscriber := range subscribers {
+			subscriber.ReceivePaymentRequestUpdate(update)
+		}
+		if update.PaymentRequest.CallbackURL != "" {
+			go w.threadedSendPaymentRequestCallback(update)
+		}
+	}
+}
+
+// threadedSendPaymentRequestCallback POSTs a payment request update to the
+// callback URL of the request, retrying with an exponential backoff if the
+// receiving end does not respond with a 2xx status code.
+func (w *Wallet) threadedSendPaymentRequestCallback(update modules.PaymentRequestUpdate) {
+	if err := w.tg.Add(); err != nil {
+		return
+	}
+	defer w.tg.Done()
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		build.Critical("unable to marshal payment request update:", err)
+		return
+	}
+	client := &http.Client{Timeout: paymentRequestCallbackTimeout}
+	backoff := paymentRequestCallbackBackoff
+	for attempt := 0; attempt < paymentRequestCallbackAttempts; attempt++ {
+		resp, err := client.Post(update.PaymentRequest.CallbackURL, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return
+			}
+		}
+		w.log.Debugln("Payment request callback failed:", update.PaymentRequest.CallbackURL, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-w.tg.StopChan():
+			return
+		}
+		backoff *= 2
+	}
+	w.log.Println("Giving up on delivering payment request callback to", update.PaymentRequest.CallbackURL)
+}
+
+// loadPaymentRequests loads every payment request that still needs to be
+// tracked from the database.
+func (w *Wallet) loadPaymentRequests(tx *bolt.Tx) error {
+	return dbForEachPaymentRequest(tx, func(addr types.UnlockHash, pr modules.PaymentRequest) {
+		if !paymentRequestFinal(pr) {
+			w.paymentRequests[addr] = pr
+		}
+	})
+}
+
+// nextPaymentRequestAddress returns the address of the next payment request
+// key of the primary seed.
+func (w *Wallet) nextPaymentRequestAddress(tx *bolt.Tx) (types.UnlockConditions, error) {
+	if !w.unlocked {
+		return types.UnlockConditions{}, modules.ErrLockedWallet
+	}
+	next, used, err := dbGetPaymentRequestIndices(tx)
+	if err != nil {
+		return types.UnlockConditions{}, err
+	}
+	if next-used >= paymentRequestGapLimit {
+		return types.UnlockConditions{}, errPaymentRequestGapLimit
+	}
+	if err := dbPutPaymentRequestIndices(tx, next+1, used); err != nil {
+		return types.UnlockConditions{}, err
+	}
+	sk := generatePaymentRequestKey(w.primarySeed, next)
+	w.keys[sk.UnlockConditions.UnlockHash()] = sk
+	w.paymentRequestKeys[sk.UnlockConditions.UnlockHash()] = next
+	return sk.UnlockConditions, nil
+}
+
+// CreatePaymentRequest creates a payment request for amount on a fresh
+// payment request address from the primary seed.
+func (w *Wallet) CreatePaymentRequest(amount types.Currency, label string, expiry types.BlockHeight, confirmations uint64, callbackURL string) (modules.PaymentRequest, error) {
+	if err := w.tg.Add(); err != nil {
+		return modules.PaymentRequest{}, modules.ErrWalletShutdown
+	}
+	defer w.tg.Done()
+
+	if amount.IsZero() {
+		return modules.PaymentRequest{}, errZeroPaymentRequest
+	}
+	if callbackURL != "" {
+		u, err := url.Parse(callbackURL)
+		if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+			return modules.PaymentRequest{}, errBadCallbackURL
+		}
+	}
+	if confirmations == 0 {
+		confirmations = modules.DefaultPaymentRequestConfirmations
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	height, err := dbGetConsensusHeight(w.dbTx)
+	if err != nil {
+		return modules.PaymentRequest{}, err
+	}
+	uc, err := w.nextPaymentRequestAddress(w.dbTx)
+	if err != nil {
+		return modules.PaymentRequest{}, err
+	}
+	addr := uc.UnlockHash()
+	if _, err := dbGetPaymentRequest(w.dbTx, addr); err == nil {
+		return modules.PaymentRequest{}, errDuplicatePaymentRequest
+	}
+
+	pr := modules.PaymentRequest{
+		Address:               addr,
+		Amount:                amount,
+		Label:                 label,
+		CallbackURL:           callbackURL,
+		CreationHeight:        height,
+		RequiredConfirmations: confirmations,
+		Status:                modules.PaymentRequestUnpaid,
+	}
+	if expiry != 0 {
+		pr.ExpiryHeight = height + expiry
+	}
+	if err := dbPutPaymentRequest(w.dbTx, pr); err != nil {
+		return modules.PaymentRequest{}, err
+	}
+	if err := w.syncDB(); err != nil {
+		return modules.PaymentRequest{}, err
+	}
+	w.paymentRequests[addr] = pr
+	w.log.Printf("Created payment request %v for %v\n", addr, amount.HumanString())
+	return pr, nil
+}
+
+// PaymentRequest returns the payment request that was created for addr.
+func (w *Wallet) PaymentRequest(addr types.UnlockHash) (modules.PaymentRequest, error) {
+	if err := w.tg.Add(); err != nil {
+		return modules.PaymentRequest{}, modules.ErrWalletShutdown
+	}
+	defer w.tg.Done()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pr, err := dbGetPaymentRequest(w.dbTx, addr)
+	if err == errNoKey {
+		return modules.PaymentRequest{}, modules.ErrUnknownPaymentRequest
+	}
+	return pr, err
+}
+
+// PaymentRequests returns all payment requests known to the wallet, ordered
+// by creation height.
+func (w *Wallet) PaymentRequests() ([]modules.PaymentRequest, error) {
+	if err := w.tg.Add(); err != nil {
+		return nil, modules.ErrWalletShutdown
+	}
+	defer w.tg.Done()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var prs []modules.PaymentRequest
+	err := dbForEachPaymentRequest(w.dbTx, func(_ types.UnlockHash, pr modules.PaymentRequest) {
+		prs = append(prs, pr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(prs, func(i, j int) bool {
+		return prs[i].CreationHeight < prs[j].CreationHeight
+	})
+	return prs, nil
+}
+
+// PaymentRequestSubscribe adds a subscriber that will be notified of every
+// update to a payment request.
+func (w *Wallet) PaymentRequestSubscribe(subscriber modules.PaymentRequestSubscriber) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paymentRequestSubscribers = append(w.paymentRequestSubscribers, subscriber)
+}
+
+// PaymentRequestUnsubscribe removes a subscriber that was added with
+// PaymentRequestSubscribe.
+func (w *Wallet) PaymentRequestUnsubscribe(subscriber modules.PaymentRequestSubscriber) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.paymentRequestSubscribers {
+		if w.paymentRequestSubscribers[i] == subscriber {
+			w.paymentRequestSubscribers = append(w.paymentRequestSubscribers[:i], w.paymentRequestSubscribers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package wallet
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/build"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/types"
+)
+
+// paymentRequestRecorder is a PaymentRequestSubscriber that records every
+// update it receives.
+type paymentRequestRecorder struct {
+	updates []modules.PaymentRequestUpdate
+	mu      sync.Mutex
+}
+
+// ReceivePaymentRequestUpdate implements modules.PaymentRequestSubscriber.
+func (prr *paymentRequestRecorder) ReceivePaymentRequestUpdate(update modules.PaymentRequestUpdate) {
+	prr.mu.Lock()
+	prr.updates = append(prr.updates, update)
+	prr.mu.Unlock()
+}
+
+// statuses returns the statuses of all recorded updates in order.
+func (prr *paymentRequestRecorder) statuses() []modules.PaymentRequestStatus {
+	prr.mu.Lock()
+	defer prr.mu.Unlock()
+	var statuses []modules.PaymentRequestStatus
+	for _, update := range prr.updates {
+		statuses = append(statuses, update.PaymentRequest.Status)
+	}
+	return statuses
+}
+
+// TestComputePaymentRequest checks the state transitions of a payment
+// request.
+func TestComputePaymentRequest(t *testing.T) {
+	var addr types.UnlockHash
+	addr[0] = 1
+	pr := modules.PaymentRequest{
+		Address:               addr,
+		Amount:                types.NewCurrency64(100),
+		ExpiryHeight:          20,
+		RequiredConfirmations: 3,
+		Status:                modules.PaymentRequestUnpaid,
+	}
+	payment := func(value uint64, height types.BlockHeight) modules.ProcessedTransaction {
+		return modules.ProcessedTransaction{
+			Transaction: types.Transaction{
+				SiacoinOutputs: []types.SiacoinOutput{{Value: types.NewCurrency64(value), UnlockHash: addr}},
+			},
+			ConfirmationHeight: height,
+		}
+	}
+
+	// Nothing has happened yet.
+	pr = computePaymentRequest(pr, nil, nil, 10)
+	if pr.Status != modules.PaymentRequestUnpaid {
+		t.Fatal("expected unpaid, got", pr.Status)
+	}
+	// A payment shows up in the transaction pool.
+	pr = computePaymentRequest(pr, nil, []modules.ProcessedTransaction{payment(60, 0)}, 10)
+	if pr.Status != modules.PaymentRequestSeen || !pr.Unconfirmed.Equals64(60) {
+		t.Fatal("expected seen, got", pr.Status, pr.Unconfirmed)
+	}
+	// The payment is confirmed, but it is not enough.
+	confirmed := []modules.ProcessedTransaction{payment(60, 11)}
+	pr = computePaymentRequest(pr, confirmed, nil, 11)
+	if pr.Status != modules.PaymentRequestPartial || !pr.Received.Equals64(60) {
+		t.Fatal("expected partial, got", pr.Status, pr.Received)
+	}
+	// A second payment completes the request.
+	confirmed = append(confirmed, payment(40, 12))
+	pr = computePaymentRequest(pr, confirmed, nil, 12)
+	if pr.Status != modules.PaymentRequestPaid || pr.PaidHeight != 12 || pr.Confirmations != 1 {
+		t.Fatal("expected paid with 1 confirmation, got", pr.Status, pr.Confirmations)
+	}
+	// Confirmations are capped at the required number.
+	pr = computePaymentRequest(pr, confirmed, nil, 30)
+	if pr.Confirmations != pr.RequiredConfirmations || !paymentRequestFinal(pr) {
+		t.Fatal("expected final request, got", pr.Confirmations)
+	}
+	// Without new payments, advancing the request gives the same result.
+	if advanced := advancePaymentRequest(pr, 13); paymentRequestChanged(advanced, computePaymentRequest(pr, confirmed, nil, 13)) {
+		t.Fatal("advancing a paid request doesn't match recomputing it", advanced)
+	}
+	// A reorg removes the second payment.
+	pr = computePaymentRequest(pr, confirmed[:1], nil, 12)
+	if pr.Status != modules.PaymentRequestReverted {
+		t.Fatal("expected reverted, got", pr.Status)
+	}
+	// The request stays reverted until something new happens.
+	pr = computePaymentRequest(pr, confirmed[:1], nil, 13)
+	if pr.Status != modules.PaymentRequestReverted {
+		t.Fatal("expected reverted, got", pr.Status)
+	}
+	if advanced := advancePaymentRequest(pr, 14); advanced.Status != modules.PaymentRequestReverted {
+		t.Fatal("expected reverted, got", advanced.Status)
+	}
+	// A reverted request still expires, whether it is advanced or
+	// recomputed.
+	if advanced := advancePaymentRequest(pr, 20); advanced.Status != modules.PaymentRequestExpired || !paymentRequestFinal(advanced) {
+		t.Fatal("expected expired, got", advanced.Status)
+	}
+	if recomputed := computePaymentRequest(pr, confirmed[:1], nil, 20); recomputed.Status != modules.PaymentRequestExpired {
+		t.Fatal("expected expired, got", recomputed.Status)
+	}
+	// The request expires without being paid.
+	pr = computePaymentRequest(pr, confirmed[:1], []modules.ProcessedTransaction{payment(40, 0)}, 20)
+	if pr.Status != modules.PaymentRequestExpired || !paymentRequestFinal(pr) {
+		t.Fatal("expected expired, got", pr.Status)
+	}
+}
+
+// TestIntegrationPaymentRequest checks that a payment request is tracked
+// through the transaction pool and the blockchain, and that updates reach
+// both subscribers and the callback URL.
+func TestIntegrationPaymentRequest(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester(t.Name(), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Set up a callback server that counts the updates it receives.
+	var callbacksMu sync.Mutex
+	callbacks := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callbacksMu.Lock()
+		callbacks++
+		callbacksMu.Unlock()
+	}))
+	defer server.Close()
+
+	recorder := new(paymentRequestRecorder)
+	wt.wallet.PaymentRequestSubscribe(recorder)
+
+	// Invalid requests are rejected.
+	if _, err := wt.wallet.CreatePaymentRequest(types.ZeroCurrency, "", 0, 0, ""); err != errZeroPaymentRequest {
+		t.Fatal("expected errZeroPaymentRequest, got", err)
+	}
+	if _, err := wt.wallet.CreatePaymentRequest(types.NewCurrency64(1), "", 0, 0, "ftp://foo"); err != errBadCallbackURL {
+		t.Fatal("expected errBadCallbackURL, got", err)
+	}
+
+	amount := types.SiacoinPrecision.Mul64(10)
+	pr, err := wt.wallet.CreatePaymentRequest(amount, "invoice 1", 10, 2, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != modules.PaymentRequestUnpaid || pr.RequiredConfirmations != 2 {
+		t.Fatal("unexpected payment request", pr)
+	}
+
+	// Pay the request.
+	if _, err := wt.wallet.SendSiacoins(amount, pr.Address); err != nil {
+		t.Fatal(err)
+	}
+	pr, err = wt.wallet.PaymentRequest(pr.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != modules.PaymentRequestSeen {
+		t.Fatal("expected seen, got", pr.Status)
+	}
+
+	// Mine two blocks to confirm the payment.
+	for i := 0; i < 2; i++ {
+		if err := wt.addBlockNoPayout(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pr, err = wt.wallet.PaymentRequest(pr.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != modules.PaymentRequestPaid || pr.Confirmations != 2 || !pr.Received.Equals(amount) {
+		t.Fatal("expected paid with 2 confirmations, got", pr.Status, pr.Confirmations)
+	}
+
+	// The subscriber should have seen the payment in the transaction pool
+	// first, and then every confirmation. Depending on the order in which
+	// the consensus set and the transaction pool report the block there may
+	// be an extra update in between.
+	statuses := recorder.statuses()
+	if len(statuses) < 3 || statuses[0] != modules.PaymentRequestSeen {
+		t.Fatal("unexpected updates", statuses)
+	}
+	for _, status := range statuses[1:] {
+		if status != modules.PaymentRequestPaid {
+			t.Fatal("unexpected updates", statuses)
+		}
+	}
+
+	// The callback server should receive the same updates.
+	err = build.Retry(50, 100*time.Millisecond, func() error {
+		callbacksMu.Lock()
+		defer callbacksMu.Unlock()
+		if callbacks != len(statuses) {
+			return errors.New("callbacks have not arrived yet")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The request is final and no longer tracked, but it can still be
+	// listed.
+	wt.wallet.PaymentRequestUnsubscribe(recorder)
+	if err := wt.addBlockNoPayout(); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.statuses()) != len(statuses) {
+		t.Fatal("unsubscribed recorder received an update")
+	}
+	prs, err := wt.wallet.PaymentRequests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prs) != 1 || prs[0].Address != pr.Address || prs[0].Label != "invoice 1" {
+		t.Fatal("unexpected payment requests", prs)
+	}
+}
+
+// TestPaymentRequestGapLimit checks that payment requests don't use the
+// addresses of the primary seed, and that at most paymentRequestGapLimit
+// requests can wait for their first payment.
+func TestPaymentRequestGapLimit(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester(t.Name(), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Create more requests than the address gap limit of the primary seed
+	// allows addresses.
+	var prs []modules.PaymentRequest
+	for i := uint64(0); i < paymentRequestGapLimit; i++ {
+		pr, err := wt.wallet.CreatePaymentRequest(types.SiacoinPrecision, "", 0, 1, "")
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		prs = append(prs, pr)
+	}
+	if _, err := wt.wallet.CreatePaymentRequest(types.SiacoinPrecision, "", 0, 1, ""); err != errPaymentRequestGapLimit {
+		t.Fatal("expected errPaymentRequestGapLimit, got", err)
+	}
+	// The primary seed addresses are unaffected.
+	if _, err := wt.wallet.NextAddress(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paying the last request allows creating further requests.
+	if _, err := wt.wallet.SendSiacoins(types.SiacoinPrecision, prs[len(prs)-1].Address); err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.addBlockNoPayout(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.wallet.CreatePaymentRequest(types.SiacoinPrecision, "", 0, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPaymentRequestPoolEviction checks that a payment dropped from the
+// transaction pool is reported, unless it was dropped because it was
+// confirmed.
+func TestPaymentRequestPoolEviction(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester(t.Name(), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	recorder := new(paymentRequestRecorder)
+	wt.wallet.PaymentRequestSubscribe(recorder)
+	pr, err := wt.wallet.CreatePaymentRequest(types.SiacoinPrecision, "", 0, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txns, err := wt.wallet.SendSiacoins(types.SiacoinPrecision, pr.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Find the transaction set of the payment.
+	var setID modules.TransactionSetID
+	wt.wallet.mu.Lock()
+	for id, txids := range wt.wallet.unconfirmedSets {
+		for _, txid := range txids {
+			if txid == txns[len(txns)-1].ID() {
+				setID = id
+			}
+		}
+	}
+	wt.wallet.mu.Unlock()
+
+	// Dropping the set because its transactions were confirmed keeps the
+	// payment until the block is processed.
+	wt.wallet.ReceiveUpdatedUnconfirmedTransactions(&modules.TransactionPoolDiff{
+		RevertedTransactions:  []modules.TransactionSetID{setID},
+		ConfirmedTransactions: []types.TransactionID{txns[len(txns)-1].ID()},
+	})
+	if pr, err = wt.wallet.PaymentRequest(pr.Address); err != nil {
+		t.Fatal(err)
+	} else if pr.Status != modules.PaymentRequestSeen {
+		t.Fatal("expected seen, got", pr.Status)
+	}
+
+	// Otherwise the eviction is reported.
+	wt.wallet.mu.Lock()
+	wt.wallet.unconfirmedSets[setID] = []types.TransactionID{txns[len(txns)-1].ID()}
+	wt.wallet.unconfirmedProcessedTransactions = wt.wallet.confirmingTransactions
+	wt.wallet.confirmingTransactions = nil
+	wt.wallet.mu.Unlock()
+	wt.wallet.ReceiveUpdatedUnconfirmedTransactions(&modules.TransactionPoolDiff{
+		RevertedTransactions: []modules.TransactionSetID{setID},
+	})
+	if pr, err = wt.wallet.PaymentRequest(pr.Address); err != nil {
+		t.Fatal(err)
+	} else if pr.Status != modules.PaymentRequestUnpaid || !pr.Unconfirmed.IsZero() {
+		t.Fatal("expected unpaid, got", pr.Status, pr.Unconfirmed)
+	}
+	statuses := recorder.statuses()
+	if len(statuses) != 2 || statuses[0] != modules.PaymentRequestSeen || statuses[1] != modules.PaymentRequestUnpaid {
+		t.Fatal("unexpected updates", statuses)
+	}
+}
@@ -47,6 +47,11 @@ func (w *Wallet) openDB(filename string) (err error) {
 	err = w.db.Update(func(tx *bolt.Tx) error {
 		// check whether we need to init bucketAddrTransactions
 		buildAddrTxns := tx.Bucket(bucketAddrTransactions) == nil
+		// check whether we need to init bucketCategoryTransactions
+		buildCategoryTxns := tx.Bucket(bucketCategoryTransactions) == nil
+		// check whether we need to init the address index and time bounds
+		buildAddrIndex := tx.Bucket(bucketAddrTransactionIndex) == nil
+		buildTimeBounds := tx.Bucket(bucketTransactionTimeBounds) == nil
 		// ensure that all buckets exist
 		for _, b := range dbBuckets {
 			_, err := tx.CreateBucketIfNotExists(b)
@@ -104,6 +109,57 @@ func (w *Wallet) openDB(filename string) (err error) {
 			}
 		}
 
+		// build the bucketCategoryTransactions bucket if necessary
+		if buildCategoryTxns {
+			it := dbProcessedTransactionsIterator(tx)
+			for it.next() {
+				index, pt := it.key(), it.value()
+				if err := dbAddProcessedTransactionCategories(tx, pt, index); err != nil {
+					return err
+				}
+			}
+		}
+
+		// build the bucketAddrTransactionIndex bucket if necessary
+		if buildAddrIndex {
+			it := dbProcessedTransactionsIterator(tx)
+			for it.next() {
+				index, pt := it.key(), it.value()
+				if err := dbAddProcessedTransactionAddrIndex(tx, pt, index); err != nil {
+					return err
+				}
+			}
+		}
+
+		// build the bucketTransactionTimeBounds bucket if necessary
+		if buildTimeBounds {
+			it := dbProcessedTransactionsIterator(tx)
+			for it.next() {
+				index, pt := it.key(), it.value()
+				if err := dbAddProcessedTransactionTime(tx, pt, index); err != nil {
+					return err
+				}
+			}
+		}
+
+		// load the payment requests that still need to be tracked
+		if err := w.loadPaymentRequests(tx); err != nil {
+			return err
+		}
+
+		// load the wallet settings and address labels
+		settings, err := dbGetWalletSettings(tx)
+		if err != nil {
+			return err
+		}
+		w.settings = settings
+		err = dbForEachAddressLabel(tx, func(addr types.UnlockHash, label string) {
+			w.addressLabels[addr] = label
+		})
+		if err != nil {
+			return err
+		}
+
 		// check whether wallet is encrypted
 		w.encrypted = tx.Bucket(bucketWallet).Get(keyEncryptionVerification) != nil
 		return nil
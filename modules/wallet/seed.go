@@ -46,8 +46,39 @@ func generateSpendableKey(seed modules.Seed, index uint64) spendableKey {
 	}
 }
 
+// generatePaymentRequestKey creates the keys and unlock conditions of the
+// payment request address of seed at a given index. Payment request keys are
+// derived separately from the other keys of the seed, so unpaid requests don't
+// count towards the address gap limit.
+func generatePaymentRequestKey(seed modules.Seed, index uint64) spendableKey {
+	sk, pk := crypto.GenerateKeyPairDeterministic(crypto.HashAll(seed, paymentRequestKeySpecifier, index))
+	return spendableKey{
+		UnlockConditions: types.UnlockConditions{
+			PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(pk)},
+			SignaturesRequired: 1,
+		},
+		SecretKeys: []crypto.SecretKey{sk},
+	}
+}
+
 // generateKeys generates n keys from seed, starting from index start.
 func generateKeys(seed modules.Seed, start, n uint64) []spendableKey {
+	return generateKeysFunc(func(index uint64) spendableKey {
+		return generateSpendableKey(seed, index)
+	}, start, n)
+}
+
+// generatePaymentRequestKeys generates n payment request keys from seed,
+// starting from index start.
+func generatePaymentRequestKeys(seed modules.Seed, start, n uint64) []spendableKey {
+	return generateKeysFunc(func(index uint64) spendableKey {
+		return generatePaymentRequestKey(seed, index)
+	}, start, n)
+}
+
+// generateKeysFunc generates the n keys returned by generate for the indices
+// starting from start.
+func generateKeysFunc(generate func(uint64) spendableKey, start, n uint64) []spendableKey {
 	// generate in parallel, one goroutine per core.
 	keys := make([]spendableKey, n)
 	var wg sync.WaitGroup
@@ -59,7 +90,7 @@ func generateKeys(seed modules.Seed, start, n uint64) []spendableKey {
 				// NOTE: don't bother trying to optimize generateSpendableKey;
 				// profiling shows that ed25519 key generation consumes far
 				// more CPU time than encoding or hashing.
-				keys[i] = generateSpendableKey(seed, start+i)
+				keys[i] = generate(start + i)
 			}
 		}(uint64(cpu))
 	}
@@ -103,6 +134,15 @@ func (w *Wallet) integrateSeed(seed modules.Seed, n uint64) {
 	}
 }
 
+// integratePaymentRequestKeys generates the first n payment request keys
+// from the seed and loads them into the wallet.
+func (w *Wallet) integratePaymentRequestKeys(seed modules.Seed, n uint64) {
+	for i, sk := range generatePaymentRequestKeys(seed, 0, n) {
+		w.keys[sk.UnlockConditions.UnlockHash()] = sk
+		w.paymentRequestKeys[sk.UnlockConditions.UnlockHash()] = uint64(i)
+	}
+}
+
 // GetAddress returns the first unspent key following the one that we've seen
 // on the blockchain.
 func (w *Wallet) GetAddress() (types.UnlockConditions, error) {
@@ -424,7 +464,7 @@ func (w *Wallet) SweepSeed(seed modules.Seed) (coins, funds types.Currency, err
 		var sweptCoins types.Currency // total values of swept outputs
 		for _, output := range txnSiacoinOutputs {
 			// construct a siacoin input that spends the output
-			sk := generateSpendableKey(seed, output.seedIndex)
+			sk := output.spendableKey(seed)
 			tb.AddSiacoinInput(types.SiacoinInput{
 				ParentID:         types.SiacoinOutputID(output.id),
 				UnlockConditions: sk.UnlockConditions,
@@ -463,7 +503,7 @@ func (w *Wallet) SweepSeed(seed modules.Seed) (coins, funds types.Currency, err
 		// access to the signing keys)
 		txn, parents := tb.View()
 		for _, output := range txnSiacoinOutputs {
-			sk := generateSpendableKey(seed, output.seedIndex)
+			sk := output.spendableKey(seed)
 			addSignatures(&txn, types.FullCoveredFields, sk.UnlockConditions, crypto.Hash(output.id), sk)
 		}
 		// Usually, all the inputs will come from swept outputs. However, there is
@@ -54,6 +54,12 @@ func (s slowSeedScanner) getMaximumExternalIndex() uint64 {
 	return s.maximumExternalIndex
 }
 
+// getPaymentRequestIndex returns the payment request index found by the gap
+// scanner. Payment requests didn't exist during the airdrop.
+func (s slowSeedScanner) getPaymentRequestIndex() uint64 {
+	return s.gapScanner.getPaymentRequestIndex()
+}
+
 // func (s slowSeedScanner) getMaximumInternalIndex() uint64 {
 // 	return s.gapScanner.maximumInternalIndex
 // }
@@ -196,6 +202,7 @@ func (s *slowSeedScanner) scan(cancel <-chan struct{}) error {
 	s.gapScanner.siacoinOutputs = s.siacoinOutputs
 	numKeys := s.maximumExternalIndex + s.addressGapLimit
 	s.gapScanner.generateKeys(numKeys) // this will update s.gapScanner.maximumInternalIndex
+	s.gapScanner.generatePaymentRequestKeys()
 	if err := s.gapScanner.cs.HeaderConsensusSetSubscribe(s.gapScanner, s.lastConsensusChange, cancel); err != nil {
 		return err
 	}
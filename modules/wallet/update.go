@@ -401,6 +401,7 @@ func (w *Wallet) ProcessConsensusChange(cc modules.ConsensusChange) {
 	}
 	defer w.tg.Done()
 
+	defer w.managedSendPaymentRequestUpdates()
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
@@ -424,6 +425,34 @@ func (w *Wallet) ProcessConsensusChange(cc modules.ConsensusChange) {
 		w.log.Severe("ERROR: failed to update consensus change ID:", err)
 		w.dbRollback = true
 	}
+	if err := w.updatePaymentRequestIndices(w.dbTx, cc.SiacoinOutputDiffs); err != nil {
+		w.log.Severe("ERROR: failed to update payment request indices:", err)
+		w.dbRollback = true
+	}
+
+	// The payments of the transactions confirmed by this change are now in
+	// the database.
+	affected := make(map[types.UnlockHash]struct{})
+	for _, diff := range cc.SiacoinOutputDiffs {
+		affected[diff.SiacoinOutput.UnlockHash] = struct{}{}
+	}
+	for _, pt := range w.confirmingTransactions {
+		addOutputAddresses(affected, pt)
+	}
+	w.confirmingTransactions = nil
+	if err := w.updatePaymentRequests(w.dbTx, affected, true); err != nil {
+		w.log.Severe("ERROR: failed to update payment requests:", err)
+		w.dbRollback = true
+	}
+}
+
+// addOutputAddresses adds the addresses of the outputs of pt to addrs.
+func addOutputAddresses(addrs map[types.UnlockHash]struct{}, pt modules.ProcessedTransaction) {
+	for _, output := range pt.Outputs {
+		if output.FundType == types.SpecifierSiacoinOutput {
+			addrs[output.RelatedAddress] = struct{}{}
+		}
+	}
 }
 
 // ReceiveUpdatedUnconfirmedTransactions updates the wallet's unconfirmed
@@ -434,12 +463,18 @@ func (w *Wallet) ReceiveUpdatedUnconfirmedTransactions(diff *modules.Transaction
 	}
 	defer w.tg.Done()
 
+	defer w.managedSendPaymentRequestUpdates()
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
 	// Do the pruning first. If there are any pruned transactions, we will need
 	// to re-allocate the whole processed transactions array.
 	droppedTransactions := make(map[types.TransactionID]struct{})
+	confirmedTransactions := make(map[types.TransactionID]struct{})
+	for _, txid := range diff.ConfirmedTransactions {
+		confirmedTransactions[txid] = struct{}{}
+	}
+	affected := make(map[types.UnlockHash]struct{})
 	for i := range diff.RevertedTransactions {
 		txids := w.unconfirmedSets[diff.RevertedTransactions[i]]
 		for i := range txids {
@@ -463,6 +498,15 @@ func (w *Wallet) ReceiveUpdatedUnconfirmedTransactions(diff *modules.Transaction
 				// Transaction was not dropped, add it to the new unconfirmed
 				// transactions.
 				newUPT = append(newUPT, txn)
+				continue
+			}
+			addOutputAddresses(affected, txn)
+
+			// Keep the transactions that were confirmed in a block the
+			// wallet hasn't processed yet.
+			_, confirmed := confirmedTransactions[txn.TransactionID]
+			if _, err := dbGetTransactionIndex(w.dbTx, txn.TransactionID); confirmed && err != nil {
+				w.confirmingTransactions = append(w.confirmingTransactions, txn)
 			}
 		}
 
@@ -536,6 +580,12 @@ func (w *Wallet) ReceiveUpdatedUnconfirmedTransactions(diff *modules.Transaction
 				})
 			}
 			w.unconfirmedProcessedTransactions = append(w.unconfirmedProcessedTransactions, pt)
+			addOutputAddresses(affected, pt)
 		}
 	}
+
+	if err := w.updatePaymentRequests(w.dbTx, affected, false); err != nil {
+		w.log.Severe("ERROR: failed to update payment requests:", err)
+		w.dbRollback = true
+	}
 }
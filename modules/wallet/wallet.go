@@ -99,6 +99,32 @@ type Wallet struct {
 	unconfirmedSets                  map[modules.TransactionSetID][]types.TransactionID
 	unconfirmedProcessedTransactions []modules.ProcessedTransaction
 
+	// paymentRequests holds the payment requests that are still being
+	// tracked, i.e. that have neither expired nor been paid with enough
+	// confirmations. Every request is also stored in the database.
+	paymentRequests           map[types.UnlockHash]modules.PaymentRequest
+	paymentRequestSubscribers []modules.PaymentRequestSubscriber
+
+	// paymentRequestKeys maps the payment request addresses of the primary
+	// seed to their index. paymentRequestUpdates queues the updates that
+	// haven't been sent to the subscribers yet, and paymentRequestSendMu
+	// ensures they are sent in order.
+	paymentRequestKeys    map[types.UnlockHash]uint64
+	paymentRequestUpdates []modules.PaymentRequestUpdate
+	paymentRequestSendMu  deadlock.Mutex
+
+	// confirmingTransactions holds the transactions that the transaction
+	// pool dropped because they were confirmed in a block, until the wallet
+	// processes that block. Payments made by them still count as
+	// unconfirmed in the meantime.
+	confirmingTransactions []modules.ProcessedTransaction
+
+	// addressLabels holds the labels the user attached to addresses, and
+	// settings holds the wallet settings. Both are also stored in the
+	// database.
+	addressLabels map[types.UnlockHash]string
+	settings      modules.WalletSettings
+
 	// The wallet's database tracks its seeds, keys, outputs, and
 	// transactions. A global db transaction is maintained in memory to avoid
 	// excessive disk writes. Any operations involving dbTx must hold an
@@ -187,6 +213,10 @@ func NewCustomWallet(cs modules.ConsensusSet, tpool modules.TransactionPool, per
 
 		unconfirmedSets: make(map[modules.TransactionSetID][]types.TransactionID),
 
+		paymentRequests:    make(map[types.UnlockHash]modules.PaymentRequest),
+		paymentRequestKeys: make(map[types.UnlockHash]uint64),
+		addressLabels:      make(map[types.UnlockHash]string),
+
 		persistDir: persistDir,
 
 		addressGapLimit: uint64(addressGapLimit),
@@ -198,6 +228,7 @@ func NewCustomWallet(cs modules.ConsensusSet, tpool modules.TransactionPool, per
 	if err != nil {
 		return nil, err
 	}
+	go w.threadedConsolidate()
 
 	cs.SetGetWalletKeysFunc(func() ([][]byte, error) {
 		return w.allAddressesInByteArray()
@@ -334,7 +365,12 @@ func (w *Wallet) Settings() (modules.WalletSettings, error) {
 		return modules.WalletSettings{}, modules.ErrWalletShutdown
 	}
 	defer w.tg.Done()
-	return modules.WalletSettings{}, nil
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	s := w.settings
+	s.Consolidation.ExcludedLabels = append([]string(nil), s.Consolidation.ExcludedLabels...)
+	return s, nil
 }
 
 // SetSettings will update the settings for the wallet.
@@ -344,7 +380,16 @@ func (w *Wallet) SetSettings(s modules.WalletSettings) error {
 	}
 	defer w.tg.Done()
 
+	if s.Consolidation.TargetOutputs == 0 {
+		return errZeroConsolidationTarget
+	}
+	s.Consolidation.ExcludedLabels = append([]string(nil), s.Consolidation.ExcludedLabels...)
+
 	w.mu.Lock()
-	w.mu.Unlock()
-	return nil
+	defer w.mu.Unlock()
+	if err := dbPutWalletSettings(w.dbTx, s); err != nil {
+		return err
+	}
+	w.settings = s
+	return w.syncDB()
 }
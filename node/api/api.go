@@ -111,6 +111,7 @@ type API struct {
 	renter          modules.Renter
 	tpool           modules.TransactionPool
 	wallet          modules.Wallet
+	wallets         modules.WalletManager
 	pool            modules.Pool
 	stratumminer    modules.StratumMiner
 	index           modules.Index
@@ -128,7 +129,7 @@ func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // New creates a new Sia API from the provided modules.  The API will require
 // authentication using HTTP basic auth for certain endpoints of the supplied
 // password is not the empty string.  Usernames are ignored for authentication.
-func New(requiredUserAgent string, requiredPassword string, cs modules.ConsensusSet, e modules.Explorer, g modules.Gateway, h modules.Host, m modules.Miner, r modules.Renter, tp modules.TransactionPool, w modules.Wallet, p modules.Pool, sm modules.StratumMiner, index modules.Index) (*API, error) {
+func New(requiredUserAgent string, requiredPassword string, cs modules.ConsensusSet, e modules.Explorer, g modules.Gateway, h modules.Host, m modules.Miner, r modules.Renter, tp modules.TransactionPool, w modules.Wallet, wm modules.WalletManager, p modules.Pool, sm modules.StratumMiner, index modules.Index) (*API, error) {
 	api := &API{
 		cs:           cs,
 		explorer:     e,
@@ -138,6 +139,7 @@ func New(requiredUserAgent string, requiredPassword string, cs modules.Consensus
 		renter:       r,
 		tpool:        tp,
 		wallet:       w,
+		wallets:      wm,
 		pool:         p,
 		stratumminer: sm,
 		index:        index,
@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
 	"strings"
 
 	"github.com/HyperspaceApp/Hyperspace/node/api"
@@ -24,6 +25,10 @@ type Client struct {
 	// UserAgent must match the User-Agent required by the hsd server. If not
 	// set, it defaults to "Hyperspace-Agent".
 	UserAgent string
+
+	// Wallet is the name of the wallet that /wallet requests operate on. If
+	// not set, they operate on the default wallet.
+	Wallet string
 }
 
 // New creates a new Client using the provided address.
@@ -36,7 +41,7 @@ func New(address string) *Client {
 // NewRequest constructs a request to the hsd HTTP API, setting the correct
 // User-Agent and Basic Auth. The resource path must begin with /.
 func (c *Client) NewRequest(method, resource string, body io.Reader) (*http.Request, error) {
-	url := "http://" + c.Address + resource
+	url := "http://" + c.Address + c.walletResource(resource)
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, err
@@ -52,6 +57,25 @@ func (c *Client) NewRequest(method, resource string, body io.Reader) (*http.Requ
 	return req, nil
 }
 
+// walletResource adds the client's wallet parameter to /wallet resources.
+func (c *Client) walletResource(resource string) string {
+	if c.Wallet == "" {
+		return resource
+	}
+	path := resource
+	if i := strings.IndexByte(resource, '?'); i >= 0 {
+		path = resource[:i]
+	}
+	if path != "/wallet" && !strings.HasPrefix(path, "/wallet/") {
+		return resource
+	}
+	sep := "?"
+	if path != resource {
+		sep = "&"
+	}
+	return resource + sep + "wallet=" + neturl.QueryEscape(c.Wallet)
+}
+
 // drainAndClose reads rc until EOF and then closes it. drainAndClose should
 // always be called on HTTP response bodies, because if the body is not fully
 // read, the underlying connection can't be reused.
@@ -156,12 +180,18 @@ func (c *Client) get(resource string, obj interface{}) error {
 // postRawResponse requests the specified resource. The response, if provided,
 // will be returned in a byte slice
 func (c *Client) postRawResponse(resource string, data string) ([]byte, error) {
-	req, err := c.NewRequest("POST", resource, strings.NewReader(data))
+	return c.postRawResponseReader(resource, strings.NewReader(data), "application/x-www-form-urlencoded")
+}
+
+// postRawResponseReader requests the specified resource, sending the data
+// read from body as the request body. The response, if provided, will be
+// returned in a byte slice
+func (c *Client) postRawResponseReader(resource string, body io.Reader, contentType string) ([]byte, error) {
+	req, err := c.NewRequest("POST", resource, body)
 	if err != nil {
 		return nil, err
 	}
-	// TODO: is this necessary?
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Content-Type", contentType)
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, errors.AddContext(err, "request failed")
@@ -1,7 +1,9 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"strconv"
 	"strings"
@@ -237,6 +239,104 @@ func (c *Client) RenterFilesGet() (rf api.RenterFiles, err error) {
 	return
 }
 
+// RenterBackupPost uses the /renter/backup endpoint to upload a backup of the
+// renter's metadata to its hosts.
+func (c *Client) RenterBackupPost() (err error) {
+	err = c.post("/renter/backup", "", nil)
+	return
+}
+
+// RenterBackupsGet requests the /renter/backups resource.
+func (c *Client) RenterBackupsGet() (rb api.RenterBackupsGET, err error) {
+	err = c.get("/renter/backups", &rb)
+	return
+}
+
+// RenterRestorePost uses the /renter/restore endpoint to restore the renter's
+// metadata from the most recent backup made with seed. If seed is empty, the
+// wallet's primary seed is used.
+func (c *Client) RenterRestorePost(seed string) (err error) {
+	values := url.Values{}
+	if seed != "" {
+		values.Set("seed", seed)
+	}
+	err = c.post("/renter/restore", values.Encode(), nil)
+	return
+}
+
+// RenterFuseGet requests the /renter/fuse resource.
+func (c *Client) RenterFuseGet() (rf api.RenterFuseGET, err error) {
+	err = c.get("/renter/fuse", &rf)
+	return
+}
+
+// RenterFuseMountPost uses the /renter/fuse/mount endpoint to mount the
+// directory at siaPath as a read-only FUSE filesystem at mountPoint.
+func (c *Client) RenterFuseMountPost(mountPoint, siaPath string) (err error) {
+	values := url.Values{}
+	values.Set("mountpoint", mountPoint)
+	values.Set("hyperspacepath", strings.TrimPrefix(siaPath, "/"))
+	err = c.post("/renter/fuse/mount", values.Encode(), nil)
+	return
+}
+
+// RenterFuseUnmountPost uses the /renter/fuse/unmount endpoint to unmount the
+// FUSE filesystem at mountPoint.
+func (c *Client) RenterFuseUnmountPost(mountPoint string) (err error) {
+	values := url.Values{}
+	values.Set("mountpoint", mountPoint)
+	err = c.post("/renter/fuse/unmount", values.Encode(), nil)
+	return
+}
+
+// RenterSyncGet requests the /renter/sync resource.
+func (c *Client) RenterSyncGet() (rs api.RenterSyncGET, err error) {
+	err = c.get("/renter/sync", &rs)
+	return
+}
+
+// RenterSyncAddPost uses the /renter/sync/add endpoint to start a job that
+// uploads a local directory to a directory of the renter.
+func (c *Client) RenterSyncAddPost(job modules.SyncJob) (err error) {
+	values := url.Values{}
+	values.Set("localpath", job.LocalPath)
+	values.Set("hyperspacepath", strings.TrimPrefix(job.HyperspacePath, "/"))
+	values.Set("mirrordeletions", fmt.Sprint(job.MirrorDeletions))
+	values.Set("ignore", strings.Join(job.Ignore, ","))
+	err = c.post("/renter/sync/add", values.Encode(), nil)
+	return
+}
+
+// RenterSyncRemovePost uses the /renter/sync/remove endpoint to stop the sync
+// job that uploads to the directory at siaPath.
+func (c *Client) RenterSyncRemovePost(siaPath string) (err error) {
+	values := url.Values{}
+	values.Set("hyperspacepath", strings.TrimPrefix(siaPath, "/"))
+	err = c.post("/renter/sync/remove", values.Encode(), nil)
+	return
+}
+
+// RenterStuckGet requests the /renter/stuck resource.
+func (c *Client) RenterStuckGet() (rs api.RenterStuckGET, err error) {
+	err = c.get("/renter/stuck", &rs)
+	return
+}
+
+// RenterMigrationsGet requests the /renter/migrations resource.
+func (c *Client) RenterMigrationsGet() (rm api.RenterMigrationsGET, err error) {
+	err = c.get("/renter/migrations", &rm)
+	return
+}
+
+// RenterPostMigrationSpeed uses the /renter endpoint to change the speed limit
+// of the migrations away from dropped hosts.
+func (c *Client) RenterPostMigrationSpeed(bps int64) (err error) {
+	values := url.Values{}
+	values.Set("maxmigrationspeed", strconv.FormatInt(bps, 10))
+	err = c.post("/renter", values.Encode(), nil)
+	return
+}
+
 // RenterFilesFilteredGet requests the /renter/files resource with a regex filter string.
 func (c *Client) RenterFilesFilteredGet(filter string) (rf api.RenterFiles, err error) {
 	query := fmt.Sprintf("?filter=%s", url.PathEscape(filter))
@@ -297,6 +397,43 @@ func (c *Client) RenterRenamePost(siaPathOld, siaPathNew string) (err error) {
 	return
 }
 
+// RenterShareGet uses the /renter/share endpoint to save the files and
+// directories at siaPaths to a .sia file at destination.
+func (c *Client) RenterShareGet(siaPaths []string, destination string) (err error) {
+	values := url.Values{}
+	values.Set("hyperspacepaths", strings.Join(siaPaths, ","))
+	values.Set("destination", destination)
+	err = c.get("/renter/share?"+values.Encode(), nil)
+	return
+}
+
+// RenterShareASCIIGet uses the /renter/shareascii endpoint to get the files
+// and directories at siaPaths as an ASCII-encoded .sia file.
+func (c *Client) RenterShareASCIIGet(siaPaths []string) (rs api.RenterShareASCII, err error) {
+	values := url.Values{}
+	values.Set("hyperspacepaths", strings.Join(siaPaths, ","))
+	err = c.get("/renter/shareascii?"+values.Encode(), &rs)
+	return
+}
+
+// RenterLoadPost uses the /renter/load endpoint to load the .sia file at
+// source into the renter.
+func (c *Client) RenterLoadPost(source string) (rl api.RenterLoad, err error) {
+	values := url.Values{}
+	values.Set("source", source)
+	err = c.post("/renter/load", values.Encode(), &rl)
+	return
+}
+
+// RenterLoadASCIIPost uses the /renter/loadascii endpoint to load an
+// ASCII-encoded .sia file into the renter.
+func (c *Client) RenterLoadASCIIPost(asciiSia string) (rl api.RenterLoad, err error) {
+	values := url.Values{}
+	values.Set("asciisia", asciiSia)
+	err = c.post("/renter/loadascii", values.Encode(), &rl)
+	return
+}
+
 // RenterSetStreamCacheSizePost uses the /renter endpoint to change the renter's
 // streamCacheSize for streaming
 func (c *Client) RenterSetStreamCacheSizePost(cacheSize uint64) (err error) {
@@ -340,6 +477,70 @@ func (c *Client) RenterSetRepairPathPost(siaPath, newPath string) (err error) {
 	return
 }
 
+// RenterSetRedundancyPost uses the /renter/file endpoint to change the
+// redundancy of a file. The file is re-encoded in the background.
+func (c *Client) RenterSetRedundancyPost(siaPath string, dataPieces, parityPieces uint64) (err error) {
+	values := url.Values{}
+	values.Set("datapieces", strconv.FormatUint(dataPieces, 10))
+	values.Set("paritypieces", strconv.FormatUint(parityPieces, 10))
+	err = c.post("/renter/file/"+siaPath, values.Encode(), nil)
+	return
+}
+
+// RenterSetFileMetadataPost uses the /renter/file endpoint to replace the
+// content type and the key/value tags of a file.
+func (c *Client) RenterSetFileMetadataPost(siaPath, contentType string, metadata map[string]string) (err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	md, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	values := url.Values{}
+	values.Set("contenttype", contentType)
+	values.Set("metadata", string(md))
+	err = c.post("/renter/file/"+siaPath, values.Encode(), nil)
+	return
+}
+
+// RenterQueryGet requests the /renter/query resource to find the files that
+// match the query.
+func (c *Client) RenterQueryGet(q modules.FileQuery) (rf api.RenterFiles, err error) {
+	values := url.Values{}
+	values.Set("prefix", strings.TrimPrefix(q.Prefix, "/"))
+	values.Set("contenttype", q.ContentType)
+	if len(q.Tags) > 0 {
+		tags, err := json.Marshal(q.Tags)
+		if err != nil {
+			return rf, err
+		}
+		values.Set("tags", string(tags))
+	}
+	if q.MinSize > 0 {
+		values.Set("minsize", strconv.FormatUint(q.MinSize, 10))
+	}
+	if q.MaxSize > 0 {
+		values.Set("maxsize", strconv.FormatUint(q.MaxSize, 10))
+	}
+	if q.MinHealth != nil {
+		values.Set("minhealth", strconv.FormatFloat(*q.MinHealth, 'f', -1, 64))
+	}
+	if q.MaxHealth != nil {
+		values.Set("maxhealth", strconv.FormatFloat(*q.MaxHealth, 'f', -1, 64))
+	}
+	for name, t := range map[string]time.Time{
+		"createdafter":   q.CreatedAfter,
+		"createdbefore":  q.CreatedBefore,
+		"modifiedafter":  q.ModifiedAfter,
+		"modifiedbefore": q.ModifiedBefore,
+	} {
+		if !t.IsZero() {
+			values.Set(name, strconv.FormatInt(t.UnixNano(), 10))
+		}
+	}
+	err = c.get("/renter/query?"+values.Encode(), &rf)
+	return
+}
+
 // RenterUploadPost uses the /renter/upload endpoint to upload a file
 func (c *Client) RenterUploadPost(path, siaPath string, dataPieces, parityPieces uint64) (err error) {
 	return c.RenterUploadForcePost(path, siaPath, dataPieces, parityPieces, false)
@@ -368,6 +569,85 @@ func (c *Client) RenterUploadDefaultPost(path, siaPath string) (err error) {
 	return
 }
 
+// RenterUploadDedupPost uses the /renter/upload endpoint with default
+// redundancy settings to upload a file whose chunks are deduplicated.
+func (c *Client) RenterUploadDedupPost(path, siaPath string) (err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	values := url.Values{}
+	values.Set("source", path)
+	values.Set("dedup", "true")
+	err = c.post(fmt.Sprintf("/renter/upload/%s", siaPath), values.Encode(), nil)
+	return
+}
+
+// RenterUploadMetadataPost uses the /renter/upload endpoint with default
+// redundancy settings to upload a file with a content type and key/value tags.
+func (c *Client) RenterUploadMetadataPost(path, siaPath, contentType string, metadata map[string]string, dedup bool) (err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	md, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	values := url.Values{}
+	values.Set("source", path)
+	values.Set("contenttype", contentType)
+	values.Set("metadata", string(md))
+	values.Set("dedup", strconv.FormatBool(dedup))
+	err = c.post(fmt.Sprintf("/renter/upload/%s", siaPath), values.Encode(), nil)
+	return
+}
+
+// RenterUploadStreamDedupPost uses the /renter/uploadstream endpoint with
+// default redundancy settings to upload the data read from r. The chunks of
+// the file are deduplicated.
+func (c *Client) RenterUploadStreamDedupPost(r io.Reader, siaPath string) (err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	values := url.Values{}
+	values.Set("dedup", "true")
+	_, err = c.postRawResponseReader(fmt.Sprintf("/renter/uploadstream/%s?%s", siaPath, values.Encode()), r, "application/octet-stream")
+	return
+}
+
+// RenterUploadStreamMetadataPost uses the /renter/uploadstream endpoint with
+// default redundancy settings to upload the data read from r as a file with a
+// content type and key/value tags.
+func (c *Client) RenterUploadStreamMetadataPost(r io.Reader, siaPath, contentType string, metadata map[string]string, dedup bool) (err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	md, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	values := url.Values{}
+	values.Set("contenttype", contentType)
+	values.Set("metadata", string(md))
+	values.Set("dedup", strconv.FormatBool(dedup))
+	_, err = c.postRawResponseReader(fmt.Sprintf("/renter/uploadstream/%s?%s", siaPath, values.Encode()), r, "application/octet-stream")
+	return
+}
+
+// RenterUploadStreamPost uses the /renter/uploadstream endpoint to upload the
+// data read from r. If dataPieces and parityPieces are both 0, the renter's
+// default redundancy is used.
+func (c *Client) RenterUploadStreamPost(r io.Reader, siaPath string, dataPieces, parityPieces uint64, force bool) (err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	values := url.Values{}
+	if dataPieces != 0 || parityPieces != 0 {
+		values.Set("datapieces", strconv.FormatUint(dataPieces, 10))
+		values.Set("paritypieces", strconv.FormatUint(parityPieces, 10))
+	}
+	values.Set("force", strconv.FormatBool(force))
+	_, err = c.postRawResponseReader(fmt.Sprintf("/renter/uploadstream/%s?%s", siaPath, values.Encode()), r, "application/octet-stream")
+	return
+}
+
+// RenterVerifyPost uses the /renter/verify endpoint to verify the content of a
+// file against its checksum.
+func (c *Client) RenterVerifyPost(siaPath string) (err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	err = c.post(fmt.Sprintf("/renter/verify/%s", siaPath), "", nil)
+	return
+}
+
 // RenterDirCreatePost uses the /renter/dir/ endpoint to create a directory for the
 // renter
 func (c *Client) RenterDirCreatePost(siaPath string) (err error) {
@@ -388,7 +668,98 @@ func (c *Client) RenterDirDeletePost(siaPath string) (err error) {
 // renter
 func (c *Client) RenterDirRenamePost(siaPath, newHyperspacePath string) (err error) {
 	siaPath = strings.TrimPrefix(siaPath, "/")
-	newHyperspacePath = strings.TrimPrefix(newHyperspacePath, "/")
-	err = c.post(fmt.Sprintf("/renter/dir/%s?newhyperspacepath=%s", siaPath, newHyperspacePath), "action=rename", nil)
+	values := url.Values{}
+	values.Set("action", "rename")
+	values.Set("newhyperspacepath", strings.TrimPrefix(newHyperspacePath, "/"))
+	err = c.post(fmt.Sprintf("/renter/dir/%s", siaPath), values.Encode(), nil)
+	return
+}
+
+// RenterDirSetHostPolicyPost uses the /renter/dir/ endpoint to attach a host
+// policy to a directory. An empty policy detaches the directory's policy.
+func (c *Client) RenterDirSetHostPolicyPost(siaPath, policy string) (err error) {
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	values := url.Values{}
+	values.Set("action", "sethostpolicy")
+	values.Set("hostpolicy", policy)
+	err = c.post(fmt.Sprintf("/renter/dir/%s", siaPath), values.Encode(), nil)
+	return
+}
+
+// RenterDirSetVersionPolicyPost uses the /renter/dir/ endpoint to attach a
+// version policy to a directory. A zero policy detaches the directory's
+// policy.
+func (c *Client) RenterDirSetVersionPolicyPost(siaPath string, policy modules.VersionPolicy) (err error) {
+	siaPath = strings.TrimPrefix(siaPath, "/")
+	values := url.Values{}
+	values.Set("action", "setversionpolicy")
+	values.Set("maxversions", fmt.Sprint(policy.MaxVersions))
+	values.Set("maxdays", fmt.Sprint(policy.MaxDays))
+	err = c.post(fmt.Sprintf("/renter/dir/%s", siaPath), values.Encode(), nil)
+	return
+}
+
+// RenterVersionsGet requests the /renter/versions/:hyperspacepath resource.
+func (c *Client) RenterVersionsGet(siaPath string) (rfv api.RenterFileVersions, err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	err = c.get("/renter/versions/"+siaPath, &rfv)
+	return
+}
+
+// RenterVersionDownloadGet uses the /renter/download endpoint to download an
+// old version of a file.
+func (c *Client) RenterVersionDownloadGet(siaPath, version, destination string) (err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	values := url.Values{}
+	values.Set("destination", url.QueryEscape(destination))
+	values.Set("version", version)
+	err = c.get(fmt.Sprintf("/renter/download/%s?%s", siaPath, values.Encode()), nil)
+	return
+}
+
+// RenterRestoreVersionPost uses the /renter/restoreversion endpoint to replace
+// a file with one of its old versions.
+func (c *Client) RenterRestoreVersionPost(siaPath, version string) (err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	values := url.Values{}
+	values.Set("version", version)
+	err = c.post(fmt.Sprintf("/renter/restoreversion/%s", siaPath), values.Encode(), nil)
+	return
+}
+
+// RenterHostPoliciesGet requests the /renter/hostpolicies resource.
+func (c *Client) RenterHostPoliciesGet() (rhpg api.RenterHostPoliciesGET, err error) {
+	err = c.get("/renter/hostpolicies", &rhpg)
+	return
+}
+
+// RenterHostPolicyGet requests the /renter/hostpolicy/:name resource.
+func (c *Client) RenterHostPolicyGet(name string) (rhpg api.RenterHostPolicyGET, err error) {
+	err = c.get("/renter/hostpolicy/"+url.PathEscape(name), &rhpg)
+	return
+}
+
+// RenterHostPolicyPost uses the /renter/hostpolicy/:name endpoint to add or
+// replace a host policy.
+func (c *Client) RenterHostPolicyPost(policy modules.HostPolicy) (err error) {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	err = c.post("/renter/hostpolicy/"+url.PathEscape(policy.Name), string(data), nil)
+	return
+}
+
+// RenterHostPolicyDeletePost uses the /renter/hostpolicy/:name/delete endpoint
+// to delete a host policy.
+func (c *Client) RenterHostPolicyDeletePost(name string) (err error) {
+	err = c.post("/renter/hostpolicy/"+url.PathEscape(name)+"/delete", "", nil)
+	return
+}
+
+// RenterGetDir uses the /renter/dir/ endpoint to query a directory
+func (c *Client) RenterGetDir(siaPath string) (rd api.RenterDirectory, err error) {
+	siaPath = escapeHyperspacePath(trimHyperspacePath(siaPath))
+	err = c.get(fmt.Sprintf("/renter/dir/%s", siaPath), &rd)
 	return
 }
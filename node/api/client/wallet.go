@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
 	"github.com/HyperspaceApp/Hyperspace/node/api"
 	"github.com/HyperspaceApp/Hyperspace/types"
 )
@@ -31,6 +33,18 @@ func (c *Client) WalletAddressesGet() (wag api.WalletAddressesGET, err error) {
 	return
 }
 
+// WalletBatchSendPost uses the /wallet/batchsend endpoint to send a batch
+// payout. payments is a CSV or JSON list of payments as described in the API
+// documentation. If dryRun is set, the payout is only validated and its fees
+// estimated.
+func (c *Client) WalletBatchSendPost(payments string, dryRun bool) (wbsp api.WalletBatchSendPOST, err error) {
+	values := url.Values{}
+	values.Set("payments", payments)
+	values.Set("dryrun", strconv.FormatBool(dryRun))
+	err = c.post("/wallet/batchsend", values.Encode(), &wbsp)
+	return
+}
+
 // WalletChangePasswordPost uses the /wallet/changepassword endpoint to change
 // the wallet's password.
 func (c *Client) WalletChangePasswordPost(currentPassword, newPassword string) (err error) {
@@ -41,6 +55,32 @@ func (c *Client) WalletChangePasswordPost(currentPassword, newPassword string) (
 	return
 }
 
+// WalletConsolidatePost uses the /wallet/consolidate endpoint to merge the
+// wallet's smallest outputs.
+func (c *Client) WalletConsolidatePost() (wcp api.WalletConsolidatePOST, err error) {
+	err = c.post("/wallet/consolidate", "", &wcp)
+	return
+}
+
+// WalletConsolidationGet requests the /wallet/consolidation endpoint to get
+// the wallet's consolidation policy.
+func (c *Client) WalletConsolidationGet() (wcg api.WalletConsolidationGET, err error) {
+	err = c.get("/wallet/consolidation", &wcg)
+	return
+}
+
+// WalletConsolidationPost uses the /wallet/consolidation endpoint to change
+// the wallet's consolidation policy.
+func (c *Client) WalletConsolidationPost(policy modules.ConsolidationPolicy) (err error) {
+	values := url.Values{}
+	values.Set("enabled", strconv.FormatBool(policy.Enabled))
+	values.Set("targetoutputs", strconv.FormatUint(policy.TargetOutputs, 10))
+	values.Set("maxfeerate", policy.MaxFeeRate.String())
+	values.Set("excludedlabels", strings.Join(policy.ExcludedLabels, ","))
+	err = c.post("/wallet/consolidation", values.Encode(), nil)
+	return
+}
+
 // WalletInitPost uses the /wallet/init endpoint to initialize and encrypt a
 // wallet
 func (c *Client) WalletInitPost(password string, force bool) (wip api.WalletInitPOST, err error) {
@@ -68,12 +108,99 @@ func (c *Client) WalletGet() (wg api.WalletGET, err error) {
 	return
 }
 
+// WalletHistoryGet requests the /wallet/history endpoint to get a page of the
+// wallet's transaction history.
+func (c *Client) WalletHistoryGet(q modules.TransactionHistoryQuery) (whg api.WalletHistoryGET, err error) {
+	values := url.Values{}
+	if len(q.Addresses) > 0 {
+		addrs := make([]string, len(q.Addresses))
+		for i, addr := range q.Addresses {
+			addrs[i] = addr.String()
+		}
+		values.Set("addresses", strings.Join(addrs, ","))
+	}
+	if q.MinHeight != 0 {
+		values.Set("minheight", fmt.Sprint(q.MinHeight))
+	}
+	if q.MaxHeight != 0 {
+		values.Set("maxheight", fmt.Sprint(q.MaxHeight))
+	}
+	if q.MinTime != 0 {
+		values.Set("mintime", fmt.Sprint(q.MinTime))
+	}
+	if q.MaxTime != 0 {
+		values.Set("maxtime", fmt.Sprint(q.MaxTime))
+	}
+	if q.Category != "" {
+		values.Set("category", q.Category)
+	}
+	if !q.MinValue.IsZero() {
+		values.Set("minvalue", q.MinValue.String())
+	}
+	if q.Label != "" {
+		values.Set("label", q.Label)
+	}
+	if q.Cursor != "" {
+		values.Set("cursor", q.Cursor)
+	}
+	if q.Limit != 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	values.Set("descending", strconv.FormatBool(q.Descending))
+	err = c.get("/wallet/history?"+values.Encode(), &whg)
+	return
+}
+
+// WalletLabelsGet requests the /wallet/labels endpoint to get the labeled
+// addresses of the wallet.
+func (c *Client) WalletLabelsGet() (wlg api.WalletLabelsGET, err error) {
+	err = c.get("/wallet/labels", &wlg)
+	return
+}
+
+// WalletLabelsPost uses the /wallet/labels endpoint to label an address. An
+// empty label removes the existing label.
+func (c *Client) WalletLabelsPost(addr types.UnlockHash, label string) (err error) {
+	values := url.Values{}
+	values.Set("address", addr.String())
+	values.Set("label", label)
+	err = c.post("/wallet/labels", values.Encode(), nil)
+	return
+}
+
 // WalletLockPost uses the /wallet/lock endpoint to lock the wallet.
 func (c *Client) WalletLockPost() (err error) {
 	err = c.post("/wallet/lock", "", nil)
 	return
 }
 
+// WalletPaymentRequestGet requests the /wallet/paymentrequest/:addr endpoint
+// and returns the payment request that was created for addr.
+func (c *Client) WalletPaymentRequestGet(addr types.UnlockHash) (wprg api.WalletPaymentRequestGET, err error) {
+	err = c.get("/wallet/paymentrequest/"+addr.String(), &wprg)
+	return
+}
+
+// WalletPaymentRequestsGet requests the /wallet/paymentrequests endpoint and
+// returns all payment requests known to the wallet.
+func (c *Client) WalletPaymentRequestsGet() (wprg api.WalletPaymentRequestsGET, err error) {
+	err = c.get("/wallet/paymentrequests", &wprg)
+	return
+}
+
+// WalletPaymentRequestsPost uses the /wallet/paymentrequests endpoint to
+// create a new payment request.
+func (c *Client) WalletPaymentRequestsPost(amount types.Currency, label string, expiry types.BlockHeight, confirmations uint64, callback string) (wprg api.WalletPaymentRequestGET, err error) {
+	values := url.Values{}
+	values.Set("amount", amount.String())
+	values.Set("label", label)
+	values.Set("expiry", fmt.Sprint(expiry))
+	values.Set("confirmations", fmt.Sprint(confirmations))
+	values.Set("callback", callback)
+	err = c.post("/wallet/paymentrequests", values.Encode(), &wprg)
+	return
+}
+
 // WalletSeedPost uses the /wallet/seed endpoint to add a seed to the wallet's list
 // of seeds.
 func (c *Client) WalletSeedPost(seed, password string) (err error) {
@@ -228,3 +355,35 @@ func (c *Client) WalletWatchRemovePost(addrs []types.UnlockHash, unused bool) er
 	}
 	return c.post("/wallet/watch", string(json), nil)
 }
+
+// WalletsGet requests the /wallets endpoint to list the named wallets.
+func (c *Client) WalletsGet() (wg api.WalletsGET, err error) {
+	err = c.get("/wallets", &wg)
+	return
+}
+
+// WalletsCreatePost uses the /wallets/create endpoint to create a named
+// wallet.
+func (c *Client) WalletsCreatePost(name string) (err error) {
+	values := url.Values{}
+	values.Set("name", name)
+	err = c.post("/wallets/create", values.Encode(), nil)
+	return
+}
+
+// WalletsLoadPost uses the /wallets/load endpoint to load a named wallet.
+func (c *Client) WalletsLoadPost(name string) (err error) {
+	values := url.Values{}
+	values.Set("name", name)
+	err = c.post("/wallets/load", values.Encode(), nil)
+	return
+}
+
+// WalletsUnloadPost uses the /wallets/unload endpoint to unload a named
+// wallet.
+func (c *Client) WalletsUnloadPost(name string) (err error) {
+	values := url.Values{}
+	values.Set("name", name)
+	err = c.post("/wallets/unload", values.Encode(), nil)
+	return
+}
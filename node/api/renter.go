@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -9,6 +10,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/HyperspaceApp/Hyperspace/build"
@@ -64,6 +66,7 @@ type (
 		Settings         modules.RenterSettings     `json:"settings"`
 		FinancialMetrics modules.ContractorSpending `json:"financialmetrics"`
 		CurrentPeriod    types.BlockHeight          `json:"currentperiod"`
+		SharingKey       types.SiaPublicKey         `json:"sharingkey"`
 	}
 
 	// RenterContract represents a contract formed by the renter.
@@ -108,6 +111,12 @@ type (
 		GoodForRenew bool `json:"goodforrenew"`
 	}
 
+	// RenterBackupsGET lists the metadata backups stored on the renter's
+	// hosts, oldest first.
+	RenterBackupsGET struct {
+		Backups []modules.BackupInfo `json:"backups"`
+	}
+
 	// RenterContracts contains the renter's contracts.
 	RenterContracts struct {
 		Contracts         []RenterContract `json:"contracts"`
@@ -121,6 +130,13 @@ type (
 		Downloads []DownloadInfo `json:"downloads"`
 	}
 
+	// RenterDirectory lists the directories and files of the directory
+	// queried. The first directory is the queried directory itself.
+	RenterDirectory struct {
+		Directories []modules.DirectoryInfo `json:"directories"`
+		Files       []modules.FileInfo      `json:"files"`
+	}
+
 	// RenterFile lists the file queried.
 	RenterFile struct {
 		File modules.FileInfo `json:"file"`
@@ -131,9 +147,27 @@ type (
 		Files []modules.FileInfo `json:"files"`
 	}
 
+	// RenterHostPoliciesGET lists the host policies of the renter.
+	RenterHostPoliciesGET struct {
+		Policies []modules.HostPolicy `json:"policies"`
+	}
+
+	// RenterHostPolicyGET contains a host policy and the contracts in its
+	// contract set.
+	RenterHostPolicyGET struct {
+		Policy    modules.HostPolicy `json:"policy"`
+		Contracts []RenterContract   `json:"contracts"`
+	}
+
+	// RenterFileVersions lists the old versions of a file.
+	RenterFileVersions struct {
+		Versions []modules.FileVersion `json:"versions"`
+	}
+
 	// RenterLoad lists files that were loaded into the renter.
 	RenterLoad struct {
-		FilesAdded []string `json:"filesadded"`
+		FilesAdded []string           `json:"filesadded"`
+		Signer     types.SiaPublicKey `json:"signer"`
 	}
 
 	// RenterPricesGET lists the data that is returned when a GET call is made
@@ -143,6 +177,27 @@ type (
 		modules.Allowance
 	}
 
+	// RenterFuseGET lists the FUSE filesystems mounted by the renter.
+	RenterFuseGET struct {
+		MountPoints []modules.MountInfo `json:"mountpoints"`
+	}
+
+	// RenterSyncGET lists the sync jobs of the renter.
+	RenterSyncGET struct {
+		Jobs []modules.SyncJobInfo `json:"jobs"`
+	}
+
+	// RenterMigrationsGET lists the migrations of pieces away from hosts
+	// that are being dropped.
+	RenterMigrationsGET struct {
+		Migrations []modules.HostMigration `json:"migrations"`
+	}
+
+	// RenterStuckGET lists the files that have stuck chunks.
+	RenterStuckGET struct {
+		Files []modules.StuckFileInfo `json:"files"`
+	}
+
 	// RenterShareASCII contains an ASCII-encoded .sia file.
 	RenterShareASCII struct {
 		ASCIIsia string `json:"asciisia"`
@@ -175,6 +230,7 @@ func (api *API) renterHandlerGET(w http.ResponseWriter, req *http.Request, _ htt
 		Settings:         settings,
 		FinancialMetrics: api.renter.PeriodSpending(),
 		CurrentPeriod:    periodStart,
+		SharingKey:       api.renter.SharingKey(),
 	})
 }
 
@@ -302,6 +358,15 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 		}
 		settings.MaxUploadSpeed = uploadSpeed
 	}
+	// Scan the migration speed limit. (optional parameter)
+	if m := req.FormValue("maxmigrationspeed"); m != "" {
+		var migrationSpeed int64
+		if _, err := fmt.Sscan(m, &migrationSpeed); err != nil {
+			WriteError(w, Error{"unable to parse migrationspeed: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.MaxMigrationSpeed = migrationSpeed
+	}
 	// Scan the stream cache size. (optional parameter)
 	if dcs := req.FormValue("streamcachesize"); dcs != "" {
 		var streamCacheSize uint64
@@ -534,25 +599,25 @@ func (api *API) renterLoadHandler(w http.ResponseWriter, req *http.Request, _ ht
 		return
 	}
 
-	files, err := api.renter.LoadSharedFiles(source)
+	files, signer, err := api.renter.LoadSharedFiles(source)
 	if err != nil {
 		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
 		return
 	}
 
-	WriteJSON(w, RenterLoad{FilesAdded: files})
+	WriteJSON(w, RenterLoad{FilesAdded: files, Signer: signer})
 }
 
 // renterLoadAsciiHandler handles the API call to load a '.sia' file
 // in ASCII form.
 func (api *API) renterLoadASCIIHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	files, err := api.renter.LoadSharedFilesASCII(req.FormValue("asciisia"))
+	files, signer, err := api.renter.LoadSharedFilesASCII(req.FormValue("asciisia"))
 	if err != nil {
 		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
 		return
 	}
 
-	WriteJSON(w, RenterLoad{FilesAdded: files})
+	WriteJSON(w, RenterLoad{FilesAdded: files, Signer: signer})
 }
 
 // renterRenameHandler handles the API call to rename a file entry in the
@@ -599,9 +664,135 @@ func (api *API) renterFileHandlerPOST(w http.ResponseWriter, req *http.Request,
 			return
 		}
 	}
+
+	// Handle changing the user metadata of a file. The content type and the
+	// tags can be changed independently.
+	_, setContentType := req.Form["contenttype"]
+	_, setMetadata := req.Form["metadata"]
+	if setContentType || setMetadata {
+		hyperspacepath := strings.TrimPrefix(ps.ByName("hyperspacepath"), "/")
+		file, err := api.renter.File(hyperspacepath)
+		if err != nil {
+			WriteError(w, Error{fmt.Sprintf("unable to set metadata: %v", err)}, http.StatusBadRequest)
+			return
+		}
+		contentType, metadata := file.ContentType, file.Metadata
+		if setContentType {
+			contentType = req.FormValue("contenttype")
+		}
+		if setMetadata {
+			metadata, err = parseFileMetadata(req.FormValue("metadata"))
+			if err != nil {
+				WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+				return
+			}
+		}
+		if err := api.renter.SetFileMetadata(hyperspacepath, contentType, metadata); err != nil {
+			WriteError(w, Error{fmt.Sprintf("unable to set metadata: %v", err)}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Handle changing the redundancy of a file.
+	ec, err := parseErasureCodingParameters(req.FormValue("datapieces"), req.FormValue("paritypieces"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if ec != nil {
+		hyperspacepath := strings.TrimPrefix(ps.ByName("hyperspacepath"), "/")
+		if err := api.renter.SetFileRedundancy(hyperspacepath, ec); err != nil {
+			WriteError(w, Error{fmt.Sprintf("unable to set redundancy: %v", err)}, http.StatusBadRequest)
+			return
+		}
+	}
 	WriteSuccess(w)
 }
 
+// parseFileMetadata parses the JSON object of key/value tags of a file.
+func parseFileMetadata(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var metadata map[string]string
+	if err := json.Unmarshal([]byte(s), &metadata); err != nil {
+		return nil, errors.New("unable to parse 'metadata' parameter: " + err.Error())
+	}
+	return metadata, nil
+}
+
+// renterQueryHandlerGET handles the API call to find the files that match a
+// query.
+func (api *API) renterQueryHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	query := modules.FileQuery{
+		ContentType: req.FormValue("contenttype"),
+		Prefix:      strings.TrimPrefix(req.FormValue("prefix"), "/"),
+	}
+	tags, err := parseFileMetadata(req.FormValue("tags"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	query.Tags = tags
+	for _, p := range []struct {
+		name  string
+		value *uint64
+	}{
+		{"minsize", &query.MinSize},
+		{"maxsize", &query.MaxSize},
+	} {
+		if s := req.FormValue(p.name); s != "" {
+			if *p.value, err = strconv.ParseUint(s, 10, 64); err != nil {
+				WriteError(w, Error{"unable to parse '" + p.name + "' parameter: " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		value **float64
+	}{
+		{"minhealth", &query.MinHealth},
+		{"maxhealth", &query.MaxHealth},
+	} {
+		if s := req.FormValue(p.name); s != "" {
+			health, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				WriteError(w, Error{"unable to parse '" + p.name + "' parameter: " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+			*p.value = &health
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		value *time.Time
+	}{
+		{"createdafter", &query.CreatedAfter},
+		{"createdbefore", &query.CreatedBefore},
+		{"modifiedafter", &query.ModifiedAfter},
+		{"modifiedbefore", &query.ModifiedBefore},
+	} {
+		if s := req.FormValue(p.name); s != "" {
+			nanos, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				WriteError(w, Error{"unable to parse '" + p.name + "' parameter: " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+			*p.value = time.Unix(0, nanos)
+		}
+	}
+
+	files, err := api.renter.QueryFiles(query)
+	if err != nil {
+		WriteError(w, Error{"failed to query files: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterFiles{
+		Files: files,
+	})
+}
+
 // renterFilesHandler handles the API call to list all of the files.
 func (api *API) renterFilesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	filter := req.FormValue("filter")
@@ -621,6 +812,255 @@ func (api *API) renterFilesHandler(w http.ResponseWriter, req *http.Request, _ h
 	}
 }
 
+// renterMigrationsHandlerGET handles the API call to list the migrations of
+// pieces away from hosts that are being dropped.
+func (api *API) renterMigrationsHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterMigrationsGET{
+		Migrations: api.renter.Migrations(),
+	})
+}
+
+// renterStuckHandler handles the API call to list the files that have chunks
+// the renter could not repair.
+func (api *API) renterStuckHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	files, err := api.renter.StuckFiles()
+	if err != nil {
+		WriteError(w, Error{"failed to get stuck files: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, RenterStuckGET{
+		Files: files,
+	})
+}
+
+// renterFuseHandlerGET handles the API call to list the FUSE filesystems
+// mounted by the renter.
+func (api *API) renterFuseHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterFuseGET{
+		MountPoints: api.renter.MountInfo(),
+	})
+}
+
+// renterFuseMountHandlerPOST handles the API call to mount a directory of the
+// renter as a read-only FUSE filesystem.
+func (api *API) renterFuseMountHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	mountPoint := req.FormValue("mountpoint")
+	if mountPoint == "" {
+		WriteError(w, Error{"you must set the mountpoint to mount the filesystem at"}, http.StatusBadRequest)
+		return
+	}
+	err := api.renter.Mount(mountPoint, strings.TrimPrefix(req.FormValue("hyperspacepath"), "/"))
+	if err != nil {
+		WriteError(w, Error{"failed to mount filesystem: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterFuseUnmountHandlerPOST handles the API call to unmount a FUSE
+// filesystem mounted by the renter.
+func (api *API) renterFuseUnmountHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	mountPoint := req.FormValue("mountpoint")
+	if mountPoint == "" {
+		WriteError(w, Error{"you must set the mountpoint of the filesystem to unmount"}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.Unmount(mountPoint); err != nil {
+		WriteError(w, Error{"failed to unmount filesystem: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterSyncHandlerGET handles the API call to list the sync jobs of the
+// renter.
+func (api *API) renterSyncHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterSyncGET{
+		Jobs: api.renter.SyncJobs(),
+	})
+}
+
+// renterSyncAddHandlerPOST handles the API call to start a job that uploads a
+// local directory to a directory of the renter.
+func (api *API) renterSyncAddHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	job := modules.SyncJob{
+		HyperspacePath: strings.TrimPrefix(req.FormValue("hyperspacepath"), "/"),
+		LocalPath:      req.FormValue("localpath"),
+	}
+	if job.LocalPath == "" {
+		WriteError(w, Error{"you must set the localpath of the directory to sync"}, http.StatusBadRequest)
+		return
+	}
+	if m := req.FormValue("mirrordeletions"); m != "" {
+		mirror, err := strconv.ParseBool(m)
+		if err != nil {
+			WriteError(w, Error{"unable to parse mirrordeletions: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		job.MirrorDeletions = mirror
+	}
+	for _, pattern := range strings.Split(req.FormValue("ignore"), ",") {
+		if pattern != "" {
+			job.Ignore = append(job.Ignore, pattern)
+		}
+	}
+	if err := api.renter.AddSyncJob(job); err != nil {
+		WriteError(w, Error{"failed to add sync job: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterSyncRemoveHandlerPOST handles the API call to stop a sync job.
+func (api *API) renterSyncRemoveHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	err := api.renter.RemoveSyncJob(strings.TrimPrefix(req.FormValue("hyperspacepath"), "/"))
+	if err != nil {
+		WriteError(w, Error{"failed to remove sync job: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterEventStream forwards the events of the renter to a websocket
+// subscriber. Only events of the given types are forwarded, and file events
+// only if the hyperspace path of the file starts with prefix.
+type renterEventStream struct {
+	prefix     string
+	eventTypes map[modules.RenterEventType]bool
+
+	closed bool
+	send   chan []byte
+	mu     sync.Mutex
+}
+
+// ReceiveRenterEvent implements modules.RenterEventSubscriber. Subscribers
+// that can't keep up are disconnected.
+func (res *renterEventStream) ReceiveRenterEvent(event modules.RenterEvent) {
+	if len(res.eventTypes) > 0 && !res.eventTypes[event.Type] {
+		return
+	}
+	if event.HyperspacePath != "" && !strings.HasPrefix(event.HyperspacePath, res.prefix) {
+		return
+	}
+	msg, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	if res.closed {
+		return
+	}
+	select {
+	case res.send <- msg:
+	default:
+		res.closed = true
+		close(res.send)
+	}
+}
+
+// close closes the send channel of the stream if it has not been closed
+// already.
+func (res *renterEventStream) close() {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	if !res.closed {
+		res.closed = true
+		close(res.send)
+	}
+}
+
+// renterEventsSubscribe handles the upgrade of calls to /renter/events/ws to a
+// websocket, over which the events of the renter are streamed as JSON.
+func (api *API) renterEventsSubscribe(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	stream := &renterEventStream{
+		prefix:     strings.TrimPrefix(req.FormValue("prefix"), "/"),
+		eventTypes: make(map[modules.RenterEventType]bool),
+		send:       make(chan []byte, 256),
+	}
+	for _, t := range strings.Split(req.FormValue("types"), ",") {
+		if t != "" {
+			stream.eventTypes[modules.RenterEventType(t)] = true
+		}
+	}
+	conn, err := Upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	api.renter.EventSubscribe(stream)
+	subscriber := &Subscriber{conn: conn, send: stream.send}
+	go subscriber.SocketWriter()
+
+	// Unsubscribe once the remote end goes away. Incoming messages are
+	// ignored.
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				break
+			}
+		}
+		api.renter.EventUnsubscribe(stream)
+		stream.close()
+	}()
+}
+
+// renterBackupsHandlerGET handles the API call to list the metadata backups
+// stored on the renter's hosts.
+func (api *API) renterBackupsHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	backups, err := api.renter.Backups()
+	if err != nil {
+		WriteError(w, Error{"failed to list backups: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterBackupsGET{
+		Backups: backups,
+	})
+}
+
+// renterBackupHandlerPOST handles the API call to upload a backup of the
+// renter's metadata to its hosts.
+func (api *API) renterBackupHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if err := api.renter.CreateBackup(); err != nil {
+		WriteError(w, Error{"failed to create backup: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterRestoreHandlerPOST handles the API call to restore the renter's
+// metadata from the most recent backup made with a seed. If no seed is
+// supplied, the wallet's primary seed is used.
+func (api *API) renterRestoreHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var seed modules.Seed
+	if seedStr := req.FormValue("seed"); seedStr != "" {
+		dictID := mnemonics.DictionaryID(req.FormValue("dictionary"))
+		if dictID == "" {
+			dictID = mnemonics.English
+		}
+		var err error
+		seed, err = modules.StringToSeed(seedStr, dictID)
+		if err != nil {
+			WriteError(w, Error{"failed to parse seed: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	} else if api.wallet != nil {
+		var err error
+		seed, _, err = api.wallet.PrimarySeed()
+		if err != nil {
+			WriteError(w, Error{"no seed was supplied and the wallet seed is unavailable: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	} else {
+		WriteError(w, Error{"you must supply the seed to restore from"}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.RestoreBackup(seed); err != nil {
+		WriteError(w, Error{"failed to restore backup: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
 // renterPricesHandler reports the expected costs of various actions given the
 // renter settings and the set of available hosts.
 func (api *API) renterPricesHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
@@ -801,6 +1241,7 @@ func parseDownloadParameters(w http.ResponseWriter, req *http.Request, ps httpro
 		Length:         length,
 		Offset:         offset,
 		HyperspacePath: hyperspacepath,
+		Version:        req.FormValue("version"),
 	}
 	if httpresp {
 		dp.Httpwriter = w
@@ -809,9 +1250,8 @@ func parseDownloadParameters(w http.ResponseWriter, req *http.Request, ps httpro
 	return dp, nil
 }
 
-/*
 // renterShareHandler handles the API call to create a '.sia' file that
-// shares a set of file.
+// shares a set of files and directories.
 func (api *API) renterShareHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	destination, err := url.QueryUnescape(req.FormValue("destination"))
 	if err != nil {
@@ -845,7 +1285,6 @@ func (api *API) renterShareASCIIHandler(w http.ResponseWriter, req *http.Request
 		ASCIIsia: ascii,
 	})
 }
-*/
 
 // renterStreamHandler handles downloads from the /renter/stream endpoint
 func (api *API) renterStreamHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
@@ -882,55 +1321,97 @@ func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps
 		}
 	}
 
-	// Check whether the erasure coding parameters have been supplied.
-	var ec modules.ErasureCoder
-	if req.FormValue("datapieces") != "" || req.FormValue("paritypieces") != "" {
-		// Check that both values have been supplied.
-		if req.FormValue("datapieces") == "" || req.FormValue("paritypieces") == "" {
-			WriteError(w, Error{"must provide both the datapieces parameter and the paritypieces parameter if specifying erasure coding parameters"}, http.StatusBadRequest)
+	// Check whether the chunks of the file should be deduplicated.
+	dedup := false
+	if d := req.FormValue("dedup"); d != "" {
+		dedup, err = strconv.ParseBool(d)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'dedup' parameter: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
+	}
+
+	// Parse the erasure coding parameters.
+	ec, err := parseErasureCodingParameters(req.FormValue("datapieces"), req.FormValue("paritypieces"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// Parse the user metadata of the file.
+	metadata, err := parseFileMetadata(req.FormValue("metadata"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
 
-		// Parse the erasure coding parameters.
-		var dataPieces, parityPieces int
-		_, err := fmt.Sscan(req.FormValue("datapieces"), &dataPieces)
+	// Call the renter to upload the file.
+	err = api.renter.Upload(modules.FileUploadParams{
+		Source:         source,
+		HyperspacePath: strings.TrimPrefix(ps.ByName("hyperspacepath"), "/"),
+		ErasureCode:    ec,
+		Force:          force,
+		Dedup:          dedup,
+		ContentType:    req.FormValue("contenttype"),
+		Metadata:       metadata,
+	})
+	if err != nil {
+		WriteError(w, Error{"upload failed: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterUploadStreamHandler handles the API call to upload a file from the
+// body of the request. The parameters are passed in the query string.
+func (api *API) renterUploadStreamHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	query := req.URL.Query()
+
+	// Check whether existing file should be overwritten
+	force := false
+	if f := query.Get("force"); f != "" {
+		var err error
+		force, err = strconv.ParseBool(f)
 		if err != nil {
-			WriteError(w, Error{"unable to read parameter 'datapieces': " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{"unable to parse 'force' parameter: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
-		_, err = fmt.Sscan(req.FormValue("paritypieces"), &parityPieces)
+	}
+
+	// Check whether the chunks of the file should be deduplicated.
+	dedup := false
+	if d := query.Get("dedup"); d != "" {
+		var err error
+		dedup, err = strconv.ParseBool(d)
 		if err != nil {
-			WriteError(w, Error{"unable to read parameter 'paritypieces': " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{"unable to parse 'dedup' parameter: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
+	}
 
-		// Verify that sane values for parityPieces and redundancy are being
-		// supplied.
-		if parityPieces < requiredParityPieces {
-			WriteError(w, Error{fmt.Sprintf("a minimum of %v parity pieces is required, but %v parity pieces requested", parityPieces, requiredParityPieces)}, http.StatusBadRequest)
-			return
-		}
-		redundancy := float64(dataPieces+parityPieces) / float64(dataPieces)
-		if float64(dataPieces+parityPieces)/float64(dataPieces) < requiredRedundancy {
-			WriteError(w, Error{fmt.Sprintf("a redundancy of %.2f is required, but redundancy of %.2f supplied", redundancy, requiredRedundancy)}, http.StatusBadRequest)
-			return
-		}
+	// Parse the erasure coding parameters.
+	ec, err := parseErasureCodingParameters(query.Get("datapieces"), query.Get("paritypieces"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
 
-		// Create the erasure coder.
-		ec, err = siafile.NewRSCode(dataPieces, parityPieces)
-		if err != nil {
-			WriteError(w, Error{"unable to encode file using the provided parameters: " + err.Error()}, http.StatusBadRequest)
-			return
-		}
+	// Parse the user metadata of the file.
+	metadata, err := parseFileMetadata(query.Get("metadata"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
 	}
 
-	// Call the renter to upload the file.
-	err = api.renter.Upload(modules.FileUploadParams{
-		Source:         source,
+	// Call the renter to upload the file from the body.
+	err = api.renter.UploadStreamFromReader(modules.FileUploadParams{
 		HyperspacePath: strings.TrimPrefix(ps.ByName("hyperspacepath"), "/"),
 		ErasureCode:    ec,
 		Force:          force,
-	})
+		Dedup:          dedup,
+		ContentType:    query.Get("contenttype"),
+		Metadata:       metadata,
+	}, req.Body)
 	if err != nil {
 		WriteError(w, Error{"upload failed: " + err.Error()}, http.StatusInternalServerError)
 		return
@@ -938,7 +1419,153 @@ func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps
 	WriteSuccess(w)
 }
 
-// renterDirHandlerPOST handles the API call to create a directory
+// parseErasureCodingParameters parses the datapieces and paritypieces
+// parameters of an upload. If neither is supplied, a nil ErasureCoder is
+// returned and the renter uses its default redundancy.
+func parseErasureCodingParameters(strDataPieces, strParityPieces string) (modules.ErasureCoder, error) {
+	// Check whether the erasure coding parameters have been supplied.
+	if strDataPieces == "" && strParityPieces == "" {
+		return nil, nil
+	}
+	// Check that both values have been supplied.
+	if strDataPieces == "" || strParityPieces == "" {
+		return nil, errors.New("must provide both the datapieces parameter and the paritypieces parameter if specifying erasure coding parameters")
+	}
+
+	// Parse the erasure coding parameters.
+	var dataPieces, parityPieces int
+	_, err := fmt.Sscan(strDataPieces, &dataPieces)
+	if err != nil {
+		return nil, errors.New("unable to read parameter 'datapieces': " + err.Error())
+	}
+	_, err = fmt.Sscan(strParityPieces, &parityPieces)
+	if err != nil {
+		return nil, errors.New("unable to read parameter 'paritypieces': " + err.Error())
+	}
+
+	// Verify that sane values for parityPieces and redundancy are being
+	// supplied.
+	if parityPieces < requiredParityPieces {
+		return nil, fmt.Errorf("a minimum of %v parity pieces is required, but %v parity pieces requested", parityPieces, requiredParityPieces)
+	}
+	redundancy := float64(dataPieces+parityPieces) / float64(dataPieces)
+	if float64(dataPieces+parityPieces)/float64(dataPieces) < requiredRedundancy {
+		return nil, fmt.Errorf("a redundancy of %.2f is required, but redundancy of %.2f supplied", redundancy, requiredRedundancy)
+	}
+
+	// Create the erasure coder.
+	ec, err := siafile.NewRSCode(dataPieces, parityPieces)
+	if err != nil {
+		return nil, errors.New("unable to encode file using the provided parameters: " + err.Error())
+	}
+	return ec, nil
+}
+
+// renterVerifyHandler handles the API call to verify the content of a file
+// against its checksum.
+func (api *API) renterVerifyHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	err := api.renter.VerifyFile(strings.TrimPrefix(ps.ByName("hyperspacepath"), "/"))
+	if err != nil {
+		WriteError(w, Error{"verification failed: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterHostPoliciesHandlerGET handles the API call to list the host policies
+// of the renter.
+func (api *API) renterHostPoliciesHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterHostPoliciesGET{
+		Policies: api.renter.HostPolicies(),
+	})
+}
+
+// renterHostPolicyHandlerGET handles the API call to get a host policy and the
+// contracts in its contract set.
+func (api *API) renterHostPolicyHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+	var policy modules.HostPolicy
+	found := false
+	for _, p := range api.renter.HostPolicies() {
+		if p.Name == name {
+			policy, found = p, true
+			break
+		}
+	}
+	if !found {
+		WriteError(w, Error{"unknown host policy " + name}, http.StatusBadRequest)
+		return
+	}
+	renterContracts, err := api.renter.PolicyContracts(name)
+	if err != nil {
+		WriteError(w, Error{"failed to get the contracts of the host policy: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	contracts := []RenterContract{}
+	for _, c := range renterContracts {
+		var netAddress modules.NetAddress
+		if hdbe, exists := api.renter.Host(c.HostPublicKey); exists {
+			netAddress = hdbe.NetAddress
+		}
+		contracts = append(contracts, RenterContract{
+			EndHeight:     c.EndHeight,
+			GoodForUpload: c.Utility.GoodForUpload,
+			GoodForRenew:  c.Utility.GoodForRenew,
+			HostPublicKey: c.HostPublicKey,
+			ID:            c.ID,
+			NetAddress:    netAddress,
+			RenterFunds:   c.RenterFunds,
+			StartHeight:   c.StartHeight,
+			TotalCost:     c.TotalCost,
+		})
+	}
+	WriteJSON(w, RenterHostPolicyGET{
+		Policy:    policy,
+		Contracts: contracts,
+	})
+}
+
+// renterHostPolicyHandlerPOST handles the API call to add or replace a host
+// policy. The policy is read from the request body.
+func (api *API) renterHostPolicyHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var policy modules.HostPolicy
+	if err := json.NewDecoder(req.Body).Decode(&policy); err != nil {
+		WriteError(w, Error{"invalid parameters: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	policy.Name = ps.ByName("name")
+	if err := api.renter.SetHostPolicy(policy); err != nil {
+		WriteError(w, Error{"failed to set the host policy: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterHostPolicyDeleteHandlerPOST handles the API call to delete a host
+// policy.
+func (api *API) renterHostPolicyDeleteHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if err := api.renter.DeleteHostPolicy(ps.ByName("name")); err != nil {
+		WriteError(w, Error{"failed to delete the host policy: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterDirHandlerGET handles the API call to list a directory
+func (api *API) renterDirHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	dirs, files, err := api.renter.DirList(strings.TrimPrefix(ps.ByName("hyperspacepath"), "/"))
+	if err != nil {
+		WriteError(w, Error{"failed to get directory contents: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterDirectory{
+		Directories: dirs,
+		Files:       files,
+	})
+}
+
+// renterDirHandlerPOST handles the API call to create, delete or rename a
+// directory
 func (api *API) renterDirHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	// Parse action
 	action := req.FormValue("action")
@@ -957,16 +1584,59 @@ func (api *API) renterDirHandlerPOST(w http.ResponseWriter, req *http.Request, p
 		return
 	}
 	if action == "delete" {
-		fmt.Println("delete")
-		// TODO - implement
-		WriteError(w, Error{"not implemented"}, http.StatusNotImplemented)
+		err := api.renter.DeleteDir(strings.TrimPrefix(ps.ByName("hyperspacepath"), "/"))
+		if err != nil {
+			WriteError(w, Error{"failed to delete directory: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		WriteSuccess(w)
 		return
 	}
 	if action == "rename" {
-		fmt.Println("rename")
-		// newhyperspacepath := ps.ByName("newhyperspacepath")
-		// TODO - implement
-		WriteError(w, Error{"not implemented"}, http.StatusNotImplemented)
+		newHyperspacePath := strings.TrimPrefix(req.FormValue("newhyperspacepath"), "/")
+		if newHyperspacePath == "" {
+			WriteError(w, Error{"you must set the newhyperspacepath to rename the directory to"}, http.StatusBadRequest)
+			return
+		}
+		err := api.renter.RenameDir(strings.TrimPrefix(ps.ByName("hyperspacepath"), "/"), newHyperspacePath)
+		if err != nil {
+			WriteError(w, Error{"failed to rename directory: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		WriteSuccess(w)
+		return
+	}
+
+	if action == "sethostpolicy" {
+		err := api.renter.SetDirHostPolicy(strings.TrimPrefix(ps.ByName("hyperspacepath"), "/"), req.FormValue("hostpolicy"))
+		if err != nil {
+			WriteError(w, Error{"failed to set the host policy of the directory: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		WriteSuccess(w)
+		return
+	}
+
+	if action == "setversionpolicy" {
+		var policy modules.VersionPolicy
+		if maxVersions := req.FormValue("maxversions"); maxVersions != "" {
+			if _, err := fmt.Sscan(maxVersions, &policy.MaxVersions); err != nil {
+				WriteError(w, Error{"unable to parse maxversions: " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+		}
+		if maxDays := req.FormValue("maxdays"); maxDays != "" {
+			if _, err := fmt.Sscan(maxDays, &policy.MaxDays); err != nil {
+				WriteError(w, Error{"unable to parse maxdays: " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+		}
+		err := api.renter.SetDirVersionPolicy(strings.TrimPrefix(ps.ByName("hyperspacepath"), "/"), policy)
+		if err != nil {
+			WriteError(w, Error{"failed to set the version policy of the directory: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		WriteSuccess(w)
 		return
 	}
 
@@ -974,3 +1644,32 @@ func (api *API) renterDirHandlerPOST(w http.ResponseWriter, req *http.Request, p
 	WriteError(w, Error{"no calls were made, please check your submission and try again"}, http.StatusInternalServerError)
 	return
 }
+
+// renterVersionsHandlerGET handles the API call to list the old versions of a
+// file.
+func (api *API) renterVersionsHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	versions, err := api.renter.FileVersions(strings.TrimPrefix(ps.ByName("hyperspacepath"), "/"))
+	if err != nil {
+		WriteError(w, Error{"failed to get the versions of the file: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterFileVersions{
+		Versions: versions,
+	})
+}
+
+// renterRestoreVersionHandlerPOST handles the API call to replace a file with
+// one of its old versions.
+func (api *API) renterRestoreVersionHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	version := req.FormValue("version")
+	if version == "" {
+		WriteError(w, Error{"you must set the version to restore"}, http.StatusBadRequest)
+		return
+	}
+	err := api.renter.RestoreFileVersion(strings.TrimPrefix(ps.ByName("hyperspacepath"), "/"), version)
+	if err != nil {
+		WriteError(w, Error{"failed to restore the version: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
@@ -111,20 +111,35 @@ func (api *API) buildHTTPRoutes(requiredUserAgent string, requiredPassword strin
 	if api.renter != nil {
 		router.GET("/renter", api.renterHandlerGET)
 		router.POST("/renter", RequirePassword(api.renterHandlerPOST, requiredPassword))
+		router.POST("/renter/backup", RequirePassword(api.renterBackupHandlerPOST, requiredPassword))
+		router.GET("/renter/backups", RequirePassword(api.renterBackupsHandlerGET, requiredPassword))
+		router.POST("/renter/restore", RequirePassword(api.renterRestoreHandlerPOST, requiredPassword))
 		router.POST("/renter/contract/cancel", RequirePassword(api.renterContractCancelHandler, requiredPassword))
 		router.GET("/renter/contracts", api.renterContractsHandler)
 		router.GET("/renter/downloads", api.renterDownloadsHandler)
 		router.POST("/renter/downloads/clear", RequirePassword(api.renterClearDownloadsHandler, requiredPassword))
 		router.GET("/renter/files", api.renterFilesHandler)
+		router.GET("/renter/fuse", api.renterFuseHandlerGET)
+		router.GET("/renter/hostpolicies", api.renterHostPoliciesHandlerGET)
+		router.GET("/renter/hostpolicy/:name", api.renterHostPolicyHandlerGET)
+		router.POST("/renter/hostpolicy/:name", RequirePassword(api.renterHostPolicyHandlerPOST, requiredPassword))
+		router.POST("/renter/hostpolicy/:name/delete", RequirePassword(api.renterHostPolicyDeleteHandlerPOST, requiredPassword))
+		router.POST("/renter/fuse/mount", RequirePassword(api.renterFuseMountHandlerPOST, requiredPassword))
+		router.POST("/renter/fuse/unmount", RequirePassword(api.renterFuseUnmountHandlerPOST, requiredPassword))
 		router.GET("/renter/file/*hyperspacepath", api.renterFileHandlerGET)
+		router.GET("/renter/query", api.renterQueryHandlerGET)
+		router.GET("/renter/migrations", api.renterMigrationsHandlerGET)
 		router.GET("/renter/prices", api.renterPricesHandler)
+		router.GET("/renter/stuck", api.renterStuckHandler)
+		router.GET("/renter/sync", RequirePassword(api.renterSyncHandlerGET, requiredPassword))
+		router.POST("/renter/sync/add", RequirePassword(api.renterSyncAddHandlerPOST, requiredPassword))
+		router.POST("/renter/sync/remove", RequirePassword(api.renterSyncRemoveHandlerPOST, requiredPassword))
+		router.GET("/renter/events/ws", RequirePassword(api.renterEventsSubscribe, requiredPassword))
 
-		// TODO: re-enable these routes once the new .sia format has been
-		// standardized and implemented.
-		// router.POST("/renter/load", RequirePassword(api.renterLoadHandler, requiredPassword))
-		// router.POST("/renter/loadascii", RequirePassword(api.renterLoadAsciiHandler, requiredPassword))
-		// router.GET("/renter/share", RequirePassword(api.renterShareHandler, requiredPassword))
-		// router.GET("/renter/shareascii", RequirePassword(api.renterShareAsciiHandler, requiredPassword))
+		router.POST("/renter/load", RequirePassword(api.renterLoadHandler, requiredPassword))
+		router.POST("/renter/loadascii", RequirePassword(api.renterLoadASCIIHandler, requiredPassword))
+		router.GET("/renter/share", RequirePassword(api.renterShareHandler, requiredPassword))
+		router.GET("/renter/shareascii", RequirePassword(api.renterShareASCIIHandler, requiredPassword))
 
 		router.POST("/renter/delete/*hyperspacepath", RequirePassword(api.renterDeleteHandler, requiredPassword))
 		router.GET("/renter/download/*hyperspacepath", RequirePassword(api.renterDownloadHandler, requiredPassword))
@@ -132,9 +147,14 @@ func (api *API) buildHTTPRoutes(requiredUserAgent string, requiredPassword strin
 		router.POST("/renter/rename/*hyperspacepath", RequirePassword(api.renterRenameHandler, requiredPassword))
 		router.GET("/renter/stream/*hyperspacepath", api.renterStreamHandler)
 		router.POST("/renter/upload/*hyperspacepath", RequirePassword(api.renterUploadHandler, requiredPassword))
+		router.POST("/renter/uploadstream/*hyperspacepath", RequirePassword(api.renterUploadStreamHandler, requiredPassword))
+		router.POST("/renter/verify/*hyperspacepath", RequirePassword(api.renterVerifyHandler, requiredPassword))
+		router.GET("/renter/versions/*hyperspacepath", api.renterVersionsHandlerGET)
+		router.POST("/renter/restoreversion/*hyperspacepath", RequirePassword(api.renterRestoreVersionHandlerPOST, requiredPassword))
 		router.POST("/renter/file/*hyperspacepath", RequirePassword(api.renterFileHandlerPOST, requiredPassword))
 
 		// Directory endpoints
+		router.GET("/renter/dir/*hyperspacepath", api.renterDirHandlerGET)
 		router.POST("/renter/dir/*hyperspacepath", RequirePassword(api.renterDirHandlerPOST, requiredPassword))
 
 		// HostDB endpoints.
@@ -164,32 +184,49 @@ func (api *API) buildHTTPRoutes(requiredUserAgent string, requiredPassword strin
 
 	// Wallet API Calls
 	if api.wallet != nil {
-		router.GET("/wallet", api.walletHandler)
-		router.GET("/wallet/address", RequirePassword(api.walletGetAddressHandler, requiredPassword))
-		router.POST("/wallet/address", RequirePassword(api.walletCreateAddressHandler, requiredPassword))
-		router.GET("/wallet/addresses", api.walletAddressesHandler)
-		router.GET("/wallet/backup", RequirePassword(api.walletBackupHandler, requiredPassword))
-		router.GET("/wallet/build/transaction", api.walletBuildTransactionHandler)
-		router.POST("/wallet/init", RequirePassword(api.walletInitHandler, requiredPassword))
-		router.POST("/wallet/init/seed", RequirePassword(api.walletInitSeedHandler, requiredPassword))
-		router.POST("/wallet/lock", RequirePassword(api.walletLockHandler, requiredPassword))
-		router.POST("/wallet/seed", RequirePassword(api.walletSeedHandler, requiredPassword))
-		router.GET("/wallet/seeds", RequirePassword(api.walletSeedsHandler, requiredPassword))
-		router.POST("/wallet/spacecash", RequirePassword(api.walletSiacoinsHandler, requiredPassword))
-		router.POST("/wallet/siagkey", RequirePassword(api.walletSiagkeyHandler, requiredPassword))
-		router.POST("/wallet/sweep/seed", RequirePassword(api.walletSweepSeedHandler, requiredPassword))
-		router.GET("/wallet/transaction/:id", api.walletTransactionHandler)
-		router.GET("/wallet/transactions", api.walletTransactionsHandler)
-		router.GET("/wallet/transactions/:addr", api.walletTransactionsAddrHandler)
+		router.GET("/wallet", api.withWallet(api.walletHandler))
+		router.GET("/wallet/address", RequirePassword(api.withWallet(api.walletGetAddressHandler), requiredPassword))
+		router.POST("/wallet/address", RequirePassword(api.withWallet(api.walletCreateAddressHandler), requiredPassword))
+		router.GET("/wallet/addresses", api.withWallet(api.walletAddressesHandler))
+		router.GET("/wallet/backup", RequirePassword(api.withWallet(api.walletBackupHandler), requiredPassword))
+		router.POST("/wallet/batchsend", RequirePassword(api.withWallet(api.walletBatchSendHandler), requiredPassword))
+		router.GET("/wallet/build/transaction", api.withWallet(api.walletBuildTransactionHandler))
+		router.POST("/wallet/consolidate", RequirePassword(api.withWallet(api.walletConsolidateHandler), requiredPassword))
+		router.GET("/wallet/consolidation", RequirePassword(api.withWallet(api.walletConsolidationHandlerGET), requiredPassword))
+		router.POST("/wallet/consolidation", RequirePassword(api.withWallet(api.walletConsolidationHandlerPOST), requiredPassword))
+		router.POST("/wallet/init", RequirePassword(api.withWallet(api.walletInitHandler), requiredPassword))
+		router.POST("/wallet/init/seed", RequirePassword(api.withWallet(api.walletInitSeedHandler), requiredPassword))
+		router.GET("/wallet/history", api.withWallet(api.walletHistoryHandler))
+		router.GET("/wallet/labels", RequirePassword(api.withWallet(api.walletLabelsHandlerGET), requiredPassword))
+		router.POST("/wallet/labels", RequirePassword(api.withWallet(api.walletLabelsHandlerPOST), requiredPassword))
+		router.POST("/wallet/lock", RequirePassword(api.withWallet(api.walletLockHandler), requiredPassword))
+		router.GET("/wallet/paymentrequest/:addr", RequirePassword(api.withWallet(api.walletPaymentRequestHandler), requiredPassword))
+		router.GET("/wallet/paymentrequests", RequirePassword(api.withWallet(api.walletPaymentRequestsHandlerGET), requiredPassword))
+		router.POST("/wallet/paymentrequests", RequirePassword(api.withWallet(api.walletPaymentRequestsHandlerPOST), requiredPassword))
+		router.GET("/wallet/paymentrequests/ws", RequirePassword(api.withWallet(api.walletPaymentRequestsSubscribe), requiredPassword))
+		router.POST("/wallet/seed", RequirePassword(api.withWallet(api.walletSeedHandler), requiredPassword))
+		router.GET("/wallet/seeds", RequirePassword(api.withWallet(api.walletSeedsHandler), requiredPassword))
+		router.POST("/wallet/spacecash", RequirePassword(api.withWallet(api.walletSiacoinsHandler), requiredPassword))
+		router.POST("/wallet/siagkey", RequirePassword(api.withWallet(api.walletSiagkeyHandler), requiredPassword))
+		router.POST("/wallet/sweep/seed", RequirePassword(api.withWallet(api.walletSweepSeedHandler), requiredPassword))
+		router.GET("/wallet/transaction/:id", api.withWallet(api.walletTransactionHandler))
+		router.GET("/wallet/transactions", api.withWallet(api.walletTransactionsHandler))
+		router.GET("/wallet/transactions/:addr", api.withWallet(api.walletTransactionsAddrHandler))
 		router.GET("/wallet/verify/address/:addr", api.walletVerifyAddressHandler)
-		router.POST("/wallet/unlock", RequirePassword(api.walletUnlockHandler, requiredPassword))
-		router.POST("/wallet/changepassword", RequirePassword(api.walletChangePasswordHandler, requiredPassword))
-		router.GET("/wallet/unlockconditions/:addr", RequirePassword(api.walletUnlockConditionsHandlerGET, requiredPassword))
-		router.POST("/wallet/unlockconditions", RequirePassword(api.walletUnlockConditionsHandlerPOST, requiredPassword))
-		router.GET("/wallet/unspent", RequirePassword(api.walletUnspentHandler, requiredPassword))
-		router.POST("/wallet/sign", RequirePassword(api.walletSignHandler, requiredPassword))
-		router.GET("/wallet/watch", RequirePassword(api.walletWatchHandlerGET, requiredPassword))
-		router.POST("/wallet/watch", RequirePassword(api.walletWatchHandlerPOST, requiredPassword))
+		router.POST("/wallet/unlock", RequirePassword(api.withWallet(api.walletUnlockHandler), requiredPassword))
+		router.POST("/wallet/changepassword", RequirePassword(api.withWallet(api.walletChangePasswordHandler), requiredPassword))
+		router.GET("/wallet/unlockconditions/:addr", RequirePassword(api.withWallet(api.walletUnlockConditionsHandlerGET), requiredPassword))
+		router.POST("/wallet/unlockconditions", RequirePassword(api.withWallet(api.walletUnlockConditionsHandlerPOST), requiredPassword))
+		router.GET("/wallet/unspent", RequirePassword(api.withWallet(api.walletUnspentHandler), requiredPassword))
+		router.POST("/wallet/sign", RequirePassword(api.withWallet(api.walletSignHandler), requiredPassword))
+		router.GET("/wallet/watch", RequirePassword(api.withWallet(api.walletWatchHandlerGET), requiredPassword))
+		router.POST("/wallet/watch", RequirePassword(api.withWallet(api.walletWatchHandlerPOST), requiredPassword))
+	}
+	if api.wallets != nil {
+		router.GET("/wallets", RequirePassword(api.walletsHandler, requiredPassword))
+		router.POST("/wallets/create", RequirePassword(api.walletsCreateHandler, requiredPassword))
+		router.POST("/wallets/load", RequirePassword(api.walletsLoadHandler, requiredPassword))
+		router.POST("/wallets/unload", RequirePassword(api.walletsUnloadHandler, requiredPassword))
 	}
 
 	// Apply UserAgent middleware and return the Router
@@ -1,10 +1,16 @@
 package api
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
 	"math/big"
+	"strings"
 
 	"errors"
 	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
 	"github.com/HyperspaceApp/Hyperspace/types"
 )
 
@@ -47,3 +53,86 @@ func scanBool(param string) (bool, error) {
 	}
 	return false, errors.New("could not decode boolean: value was not true or false")
 }
+
+// scanBatchAmount scans the amount of a batch payment, which is in hastings
+// unless it ends in a unit.
+func scanBatchAmount(amount string) (types.Currency, error) {
+	// Negative amounts are rejected before scanning, because they can't be
+	// represented as a types.Currency.
+	if strings.HasPrefix(amount, "-") {
+		return types.Currency{}, types.ErrNegativeCurrency
+	}
+	if c, ok := scanAmount(amount); ok {
+		return c, nil
+	}
+	return types.ParseCurrency(amount)
+}
+
+// scanBatchPayments scans a list of batch payments from a string. The list is
+// either a JSON array of objects with address, amount and label fields, or CSV
+// with one address,amount[,label] row per line and an optional header row.
+// Amounts are in hastings unless they end in a unit, e.g. 1.23KS. Every
+// address checksum is verified, and errors name the offending row.
+func scanBatchPayments(s string) ([]modules.BatchPayment, error) {
+	type row struct {
+		Address string          `json:"address"`
+		Amount  json.RawMessage `json:"amount"`
+		Label   string          `json:"label"`
+	}
+	var rows []row
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") {
+		if err := json.Unmarshal([]byte(s), &rows); err != nil {
+			return nil, fmt.Errorf("could not decode payments: %v", err)
+		}
+	} else {
+		r := csv.NewReader(strings.NewReader(s))
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		for line := 1; ; line++ {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("could not decode payments: %v", err)
+			}
+			if line == 1 && strings.EqualFold(record[0], "address") {
+				continue
+			}
+			if len(record) != 2 && len(record) != 3 {
+				return nil, fmt.Errorf("row %v: expected address,amount[,label] but got %v fields", len(rows)+1, len(record))
+			}
+			rw := row{Address: record[0], Amount: json.RawMessage(record[1])}
+			if len(record) == 3 {
+				rw.Label = record[2]
+			}
+			rows = append(rows, rw)
+		}
+	}
+
+	payments := make([]modules.BatchPayment, 0, len(rows))
+	for i, rw := range rows {
+		addr, err := scanAddress(strings.TrimSpace(rw.Address))
+		if err != nil {
+			return nil, fmt.Errorf("row %v: invalid address %q: %v", i+1, rw.Address, err)
+		}
+		// JSON amounts can be numbers or strings, the latter being needed
+		// for amounts with units.
+		amountStr := strings.TrimSpace(string(rw.Amount))
+		if strings.HasPrefix(amountStr, `"`) {
+			if err := json.Unmarshal(rw.Amount, &amountStr); err != nil {
+				return nil, fmt.Errorf("row %v: invalid amount %s", i+1, rw.Amount)
+			}
+		}
+		amount, err := scanBatchAmount(strings.TrimSpace(amountStr))
+		if err != nil {
+			return nil, fmt.Errorf("row %v: invalid amount %q: %v", i+1, rw.Amount, err)
+		}
+		payments = append(payments, modules.BatchPayment{
+			Address: addr,
+			Amount:  amount,
+			Label:   rw.Label,
+		})
+	}
+	return payments, nil
+}
@@ -114,7 +114,7 @@ func NewServer(APIaddr string, requiredUserAgent string, requiredPassword string
 		return nil, err
 	}
 
-	api, err := New(requiredUserAgent, requiredPassword, cs, e, g, h, m, r, tp, w, mp, sm, i)
+	api, err := New(requiredUserAgent, requiredPassword, cs, e, g, h, m, r, tp, w, nil, mp, sm, i)
 	if err != nil {
 		return nil, err
 	}
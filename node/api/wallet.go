@@ -6,8 +6,10 @@ import (
 	"math"
 	"net/http"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/HyperspaceApp/Hyperspace/crypto"
 	"github.com/HyperspaceApp/Hyperspace/modules"
@@ -64,6 +66,55 @@ type (
 		TransactionIDs []types.TransactionID `json:"transactionids"`
 	}
 
+	// WalletBatchSendPOST contains the report returned by a call to
+	// /wallet/batchsend.
+	WalletBatchSendPOST struct {
+		modules.BatchPaymentReport
+	}
+
+	// WalletConsolidationGET contains the consolidation policy returned by a
+	// GET call to /wallet/consolidation.
+	WalletConsolidationGET struct {
+		modules.ConsolidationPolicy
+	}
+
+	// WalletConsolidatePOST contains the report returned by a call to
+	// /wallet/consolidate.
+	WalletConsolidatePOST struct {
+		modules.ConsolidationReport
+	}
+
+	// WalletHistoryGET contains a page of the transaction history returned
+	// by a call to /wallet/history.
+	WalletHistoryGET struct {
+		modules.TransactionHistoryPage
+	}
+
+	// WalletLabel is a labeled address.
+	WalletLabel struct {
+		Address types.UnlockHash `json:"address"`
+		Label   string           `json:"label"`
+	}
+
+	// WalletLabelsGET contains the labeled addresses returned by a GET call
+	// to /wallet/labels.
+	WalletLabelsGET struct {
+		Labels []WalletLabel `json:"labels"`
+	}
+
+	// WalletPaymentRequestGET contains the payment request returned by a
+	// call to /wallet/paymentrequest/:addr or a POST call to
+	// /wallet/paymentrequests.
+	WalletPaymentRequestGET struct {
+		PaymentRequest modules.PaymentRequest `json:"paymentrequest"`
+	}
+
+	// WalletPaymentRequestsGET contains the payment requests returned by a
+	// GET call to /wallet/paymentrequests.
+	WalletPaymentRequestsGET struct {
+		PaymentRequests []modules.PaymentRequest `json:"paymentrequests"`
+	}
+
 	// WalletSignPOSTParams contains the unsigned transaction and a set of
 	// inputs to sign.
 	WalletSignPOSTParams struct {
@@ -153,8 +204,39 @@ type (
 	WalletWatchGET struct {
 		Addresses []types.UnlockHash `json:"addresses"`
 	}
+
+	// WalletsGET contains the named wallets returned by a call to /wallets.
+	WalletsGET struct {
+		Wallets []modules.WalletInfo `json:"wallets"`
+	}
+
+	// walletHandle handles a call to the /wallet API, operating on the
+	// wallet selected by the call.
+	walletHandle func(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, ps httprouter.Params)
 )
 
+// withWallet wraps a walletHandle, passing it the wallet named by the
+// 'wallet' query string parameter. Calls without the parameter operate on the
+// default wallet.
+func (api *API) withWallet(h walletHandle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		wallet := api.wallet
+		if name := req.URL.Query().Get("wallet"); name != "" {
+			if api.wallets == nil {
+				WriteError(w, Error{"this node does not support named wallets"}, http.StatusBadRequest)
+				return
+			}
+			var err error
+			wallet, err = api.wallets.Wallet(name)
+			if err != nil {
+				WriteError(w, Error{"unable to find wallet " + name + ": " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+		}
+		h(wallet, w, req, ps)
+	}
+}
+
 // encryptionKeys enumerates the possible encryption keys that can be derived
 // from an input string.
 func encryptionKeys(seedStr string) (validKeys []crypto.CipherKey) {
@@ -171,38 +253,38 @@ func encryptionKeys(seedStr string) (validKeys []crypto.CipherKey) {
 }
 
 // walletHander handles API calls to /wallet.
-func (api *API) walletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	siacoinBal, err := api.wallet.ConfirmedBalance()
+func (api *API) walletHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	siacoinBal, err := wallet.ConfirmedBalance()
 	if err != nil {
 		WriteError(w, Error{fmt.Sprintf("Error when calling /wallet: %v", err)}, http.StatusBadRequest)
 		return
 	}
-	siacoinsOut, siacoinsIn, err := api.wallet.UnconfirmedBalance()
+	siacoinsOut, siacoinsIn, err := wallet.UnconfirmedBalance()
 	if err != nil {
 		WriteError(w, Error{fmt.Sprintf("Error when calling /wallet: %v", err)}, http.StatusBadRequest)
 		return
 	}
-	dustThreshold, err := api.wallet.DustThreshold()
+	dustThreshold, err := wallet.DustThreshold()
 	if err != nil {
 		WriteError(w, Error{fmt.Sprintf("Error when calling /wallet: %v", err)}, http.StatusBadRequest)
 		return
 	}
-	encrypted, err := api.wallet.Encrypted()
+	encrypted, err := wallet.Encrypted()
 	if err != nil {
 		WriteError(w, Error{fmt.Sprintf("Error when calling /wallet: %v", err)}, http.StatusBadRequest)
 		return
 	}
-	unlocked, err := api.wallet.Unlocked()
+	unlocked, err := wallet.Unlocked()
 	if err != nil {
 		WriteError(w, Error{fmt.Sprintf("Error when calling /wallet: %v", err)}, http.StatusBadRequest)
 		return
 	}
-	rescanning, err := api.wallet.Rescanning()
+	rescanning, err := wallet.Rescanning()
 	if err != nil {
 		WriteError(w, Error{fmt.Sprintf("Error when calling /wallet: %v", err)}, http.StatusBadRequest)
 		return
 	}
-	height, err := api.wallet.Height()
+	height, err := wallet.Height()
 	if err != nil {
 		WriteError(w, Error{fmt.Sprintf("Error when calling /wallet: %v", err)}, http.StatusBadRequest)
 		return
@@ -222,8 +304,8 @@ func (api *API) walletHandler(w http.ResponseWriter, req *http.Request, _ httpro
 }
 
 // walletGetAddressHandler handles GET API calls to /wallet/address.
-func (api *API) walletGetAddressHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	unlockConditions, err := api.wallet.GetAddress()
+func (api *API) walletGetAddressHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	unlockConditions, err := wallet.GetAddress()
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/addresses: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -234,8 +316,8 @@ func (api *API) walletGetAddressHandler(w http.ResponseWriter, req *http.Request
 }
 
 // walletCreateAddressHandler handles POST API calls to /wallet/address.
-func (api *API) walletCreateAddressHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	unlockConditions, err := api.wallet.NextAddress()
+func (api *API) walletCreateAddressHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	unlockConditions, err := wallet.NextAddress()
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/addresses: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -246,8 +328,8 @@ func (api *API) walletCreateAddressHandler(w http.ResponseWriter, req *http.Requ
 }
 
 // walletAddressHandler handles API calls to /wallet/addresses.
-func (api *API) walletAddressesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	addresses, err := api.wallet.AllAddresses()
+func (api *API) walletAddressesHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	addresses, err := wallet.AllAddresses()
 	if err != nil {
 		WriteError(w, Error{fmt.Sprintf("Error when calling /wallet/addresses: %v", err)}, http.StatusBadRequest)
 		return
@@ -258,14 +340,14 @@ func (api *API) walletAddressesHandler(w http.ResponseWriter, req *http.Request,
 }
 
 // walletBackupHandler handles API calls to /wallet/backup.
-func (api *API) walletBackupHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletBackupHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	destination := req.FormValue("destination")
 	// Check that the destination is absolute.
 	if !filepath.IsAbs(destination) {
 		WriteError(w, Error{"error when calling /wallet/backup: destination must be an absolute path"}, http.StatusBadRequest)
 		return
 	}
-	err := api.wallet.CreateBackup(destination)
+	err := wallet.CreateBackup(destination)
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/backup: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -274,20 +356,20 @@ func (api *API) walletBackupHandler(w http.ResponseWriter, req *http.Request, _
 }
 
 // walletInitHandler handles API calls to /wallet/init.
-func (api *API) walletInitHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletInitHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	var encryptionKey crypto.CipherKey
 	if req.FormValue("encryptionpassword") != "" {
 		encryptionKey = crypto.NewWalletKey(crypto.HashObject(req.FormValue("encryptionpassword")))
 	}
 
 	if req.FormValue("force") == "true" {
-		err := api.wallet.Reset()
+		err := wallet.Reset()
 		if err != nil {
 			WriteError(w, Error{"error when calling /wallet/init: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 	}
-	seed, err := api.wallet.Encrypt(encryptionKey)
+	seed, err := wallet.Encrypt(encryptionKey)
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/init: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -308,7 +390,7 @@ func (api *API) walletInitHandler(w http.ResponseWriter, req *http.Request, _ ht
 }
 
 // walletInitSeedHandler handles API calls to /wallet/init/seed.
-func (api *API) walletInitSeedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletInitSeedHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	var encryptionKey crypto.CipherKey
 	if req.FormValue("encryptionpassword") != "" {
 		encryptionKey = crypto.NewWalletKey(crypto.HashObject(req.FormValue("encryptionpassword")))
@@ -324,14 +406,14 @@ func (api *API) walletInitSeedHandler(w http.ResponseWriter, req *http.Request,
 	}
 
 	if req.FormValue("force") == "true" {
-		err = api.wallet.Reset()
+		err = wallet.Reset()
 		if err != nil {
 			WriteError(w, Error{"error when calling /wallet/init/seed: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 	}
 
-	err = api.wallet.InitFromSeed(encryptionKey, seed)
+	err = wallet.InitFromSeed(encryptionKey, seed)
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/init/seed: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -339,8 +421,151 @@ func (api *API) walletInitSeedHandler(w http.ResponseWriter, req *http.Request,
 	WriteSuccess(w)
 }
 
+// paymentRequestStream forwards payment request updates from the wallet to a
+// websocket subscriber.
+type paymentRequestStream struct {
+	closed bool
+	send   chan []byte
+	mu     sync.Mutex
+}
+
+// ReceivePaymentRequestUpdate implements modules.PaymentRequestSubscriber.
+// Subscribers that can't keep up are disconnected.
+func (prs *paymentRequestStream) ReceivePaymentRequestUpdate(update modules.PaymentRequestUpdate) {
+	msg, err := json.Marshal(update)
+	if err != nil {
+		return
+	}
+	prs.mu.Lock()
+	defer prs.mu.Unlock()
+	if prs.closed {
+		return
+	}
+	select {
+	case prs.send <- msg:
+	default:
+		prs.closed = true
+		close(prs.send)
+	}
+}
+
+// close closes the send channel of the stream if it has not been closed
+// already.
+func (prs *paymentRequestStream) close() {
+	prs.mu.Lock()
+	defer prs.mu.Unlock()
+	if !prs.closed {
+		prs.closed = true
+		close(prs.send)
+	}
+}
+
+// walletPaymentRequestHandler handles API calls to
+// /wallet/paymentrequest/:addr.
+func (api *API) walletPaymentRequestHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	addr, err := scanAddress(ps.ByName("addr"))
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/paymentrequest: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	pr, err := wallet.PaymentRequest(addr)
+	if err == modules.ErrUnknownPaymentRequest {
+		WriteError(w, Error{"error when calling /wallet/paymentrequest: " + err.Error()}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		WriteError(w, Error{"error when calling /wallet/paymentrequest: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, WalletPaymentRequestGET{
+		PaymentRequest: pr,
+	})
+}
+
+// walletPaymentRequestsHandlerGET handles GET calls to
+// /wallet/paymentrequests.
+func (api *API) walletPaymentRequestsHandlerGET(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	prs, err := wallet.PaymentRequests()
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/paymentrequests: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	// Only return the requests with the given status, if one was provided.
+	if status := modules.PaymentRequestStatus(req.FormValue("status")); status != "" {
+		filtered := prs[:0]
+		for _, pr := range prs {
+			if pr.Status == status {
+				filtered = append(filtered, pr)
+			}
+		}
+		prs = filtered
+	}
+	WriteJSON(w, WalletPaymentRequestsGET{
+		PaymentRequests: prs,
+	})
+}
+
+// walletPaymentRequestsHandlerPOST handles POST calls to
+// /wallet/paymentrequests.
+func (api *API) walletPaymentRequestsHandlerPOST(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	amount, ok := scanAmount(req.FormValue("amount"))
+	if !ok {
+		WriteError(w, Error{"could not read amount from POST call to /wallet/paymentrequests"}, http.StatusBadRequest)
+		return
+	}
+	var expiry, confirmations uint64
+	var err error
+	if expiryStr := req.FormValue("expiry"); expiryStr != "" {
+		expiry, err = strconv.ParseUint(expiryStr, 10, 64)
+		if err != nil {
+			WriteError(w, Error{"parsing integer value for parameter `expiry` failed: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if confirmationsStr := req.FormValue("confirmations"); confirmationsStr != "" {
+		confirmations, err = strconv.ParseUint(confirmationsStr, 10, 64)
+		if err != nil {
+			WriteError(w, Error{"parsing integer value for parameter `confirmations` failed: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	pr, err := wallet.CreatePaymentRequest(amount, req.FormValue("label"), types.BlockHeight(expiry), confirmations, req.FormValue("callback"))
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/paymentrequests: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, WalletPaymentRequestGET{
+		PaymentRequest: pr,
+	})
+}
+
+// walletPaymentRequestsSubscribe handles the upgrade of calls to
+// /wallet/paymentrequests/ws to a websocket, over which every update to a
+// payment request is streamed as JSON.
+func (api *API) walletPaymentRequestsSubscribe(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	conn, err := Upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	stream := &paymentRequestStream{send: make(chan []byte, 256)}
+	wallet.PaymentRequestSubscribe(stream)
+	subscriber := &Subscriber{conn: conn, send: stream.send}
+	go subscriber.SocketWriter()
+
+	// Unsubscribe once the remote end goes away. Incoming messages are
+	// ignored.
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				break
+			}
+		}
+		wallet.PaymentRequestUnsubscribe(stream)
+		stream.close()
+	}()
+}
+
 // walletSeedHandler handles API calls to /wallet/seed.
-func (api *API) walletSeedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletSeedHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	// Get the seed using the ditionary + phrase
 	dictID := mnemonics.DictionaryID(req.FormValue("dictionary"))
 	if dictID == "" {
@@ -354,7 +579,7 @@ func (api *API) walletSeedHandler(w http.ResponseWriter, req *http.Request, _ ht
 
 	potentialKeys := encryptionKeys(req.FormValue("encryptionpassword"))
 	for _, key := range potentialKeys {
-		err := api.wallet.LoadSeed(key, seed)
+		err := wallet.LoadSeed(key, seed)
 		if err == nil {
 			WriteSuccess(w)
 			return
@@ -368,7 +593,7 @@ func (api *API) walletSeedHandler(w http.ResponseWriter, req *http.Request, _ ht
 }
 
 // walletSiagkeyHandler handles API calls to /wallet/siagkey.
-func (api *API) walletSiagkeyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletSiagkeyHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	// Fetch the list of keyfiles from the post body.
 	keyfiles := strings.Split(req.FormValue("keyfiles"), ",")
 	potentialKeys := encryptionKeys(req.FormValue("encryptionpassword"))
@@ -382,7 +607,7 @@ func (api *API) walletSiagkeyHandler(w http.ResponseWriter, req *http.Request, _
 	}
 
 	for _, key := range potentialKeys {
-		err := api.wallet.LoadSiagKeys(key, keyfiles)
+		err := wallet.LoadSiagKeys(key, keyfiles)
 		if err == nil {
 			WriteSuccess(w)
 			return
@@ -396,8 +621,8 @@ func (api *API) walletSiagkeyHandler(w http.ResponseWriter, req *http.Request, _
 }
 
 // walletLockHanlder handles API calls to /wallet/lock.
-func (api *API) walletLockHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	err := api.wallet.Lock()
+func (api *API) walletLockHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	err := wallet.Lock()
 	if err != nil {
 		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
 		return
@@ -406,14 +631,14 @@ func (api *API) walletLockHandler(w http.ResponseWriter, req *http.Request, _ ht
 }
 
 // walletSeedsHandler handles API calls to /wallet/seeds.
-func (api *API) walletSeedsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletSeedsHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	dictionary := mnemonics.DictionaryID(req.FormValue("dictionary"))
 	if dictionary == "" {
 		dictionary = mnemonics.English
 	}
 
 	// Get the primary seed information.
-	primarySeed, addrsRemaining, err := api.wallet.PrimarySeed()
+	primarySeed, addrsRemaining, err := wallet.PrimarySeed()
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/seeds: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -425,7 +650,7 @@ func (api *API) walletSeedsHandler(w http.ResponseWriter, req *http.Request, _ h
 	}
 
 	// Get the list of seeds known to the wallet.
-	allSeeds, err := api.wallet.AllSeeds()
+	allSeeds, err := wallet.AllSeeds()
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/seeds: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -447,7 +672,7 @@ func (api *API) walletSeedsHandler(w http.ResponseWriter, req *http.Request, _ h
 }
 
 // walletSiacoinsHandler handles API calls to /wallet/spacecash.
-func (api *API) walletSiacoinsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletSiacoinsHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	var txns []types.Transaction
 	if req.FormValue("outputs") != "" {
 		// multiple amounts + destinations
@@ -462,7 +687,7 @@ func (api *API) walletSiacoinsHandler(w http.ResponseWriter, req *http.Request,
 			WriteError(w, Error{"could not decode outputs: " + err.Error()}, http.StatusInternalServerError)
 			return
 		}
-		txns, err = api.wallet.SendSiacoinsMulti(outputs)
+		txns, err = wallet.SendSiacoinsMulti(outputs)
 		if err != nil {
 			WriteError(w, Error{"error when calling /wallet/spacecash: " + err.Error()}, http.StatusInternalServerError)
 			return
@@ -480,7 +705,7 @@ func (api *API) walletSiacoinsHandler(w http.ResponseWriter, req *http.Request,
 			return
 		}
 
-		txns, err = api.wallet.SendSiacoins(amount, dest)
+		txns, err = wallet.SendSiacoins(amount, dest)
 		if err != nil {
 			WriteError(w, Error{"error when calling /wallet/spacecash: " + err.Error()}, http.StatusInternalServerError)
 			return
@@ -497,8 +722,124 @@ func (api *API) walletSiacoinsHandler(w http.ResponseWriter, req *http.Request,
 	})
 }
 
+// walletBatchSendHandler handles API calls to /wallet/batchsend.
+func (api *API) walletBatchSendHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	payments, err := scanBatchPayments(req.FormValue("payments"))
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/batchsend: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	dryRun, err := scanBool(req.FormValue("dryrun"))
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/batchsend: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	report, err := wallet.SendSiacoinsBatch(payments, dryRun)
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/batchsend: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, WalletBatchSendPOST{report})
+}
+
+// walletConsolidationHandlerGET handles GET calls to /wallet/consolidation.
+func (api *API) walletConsolidationHandlerGET(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	settings, err := wallet.Settings()
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/consolidation: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, WalletConsolidationGET{settings.Consolidation})
+}
+
+// walletConsolidationHandlerPOST handles POST calls to /wallet/consolidation.
+// Parameters that are not provided keep their current value.
+func (api *API) walletConsolidationHandlerPOST(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	settings, err := wallet.Settings()
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/consolidation: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	policy := &settings.Consolidation
+	if e := req.FormValue("enabled"); e != "" {
+		policy.Enabled, err = scanBool(e)
+		if err != nil {
+			WriteError(w, Error{"unable to parse enabled: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if t := req.FormValue("targetoutputs"); t != "" {
+		if _, err := fmt.Sscan(t, &policy.TargetOutputs); err != nil {
+			WriteError(w, Error{"unable to parse targetoutputs: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if f := req.FormValue("maxfeerate"); f != "" {
+		feeRate, ok := scanAmount(f)
+		if !ok {
+			WriteError(w, Error{"unable to parse maxfeerate"}, http.StatusBadRequest)
+			return
+		}
+		policy.MaxFeeRate = feeRate
+	}
+	if _, ok := req.Form["excludedlabels"]; ok {
+		policy.ExcludedLabels = nil
+		for _, label := range strings.Split(req.FormValue("excludedlabels"), ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				policy.ExcludedLabels = append(policy.ExcludedLabels, label)
+			}
+		}
+	}
+	if err := wallet.SetSettings(settings); err != nil {
+		WriteError(w, Error{"error when calling /wallet/consolidation: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// walletConsolidateHandler handles API calls to /wallet/consolidate.
+func (api *API) walletConsolidateHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	report, err := wallet.Consolidate()
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/consolidate: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, WalletConsolidatePOST{report})
+}
+
+// walletLabelsHandlerGET handles GET calls to /wallet/labels.
+func (api *API) walletLabelsHandlerGET(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	labels, err := wallet.AddressLabels()
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/labels: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	wlg := WalletLabelsGET{Labels: make([]WalletLabel, 0, len(labels))}
+	for addr, label := range labels {
+		wlg.Labels = append(wlg.Labels, WalletLabel{Address: addr, Label: label})
+	}
+	sort.Slice(wlg.Labels, func(i, j int) bool {
+		return wlg.Labels[i].Address.String() < wlg.Labels[j].Address.String()
+	})
+	WriteJSON(w, wlg)
+}
+
+// walletLabelsHandlerPOST handles POST calls to /wallet/labels.
+func (api *API) walletLabelsHandlerPOST(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	addr, err := scanAddress(req.FormValue("address"))
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/labels: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := wallet.SetAddressLabel(addr, req.FormValue("label")); err != nil {
+		WriteError(w, Error{"error when calling /wallet/labels: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
 // walletSweepSeedHandler handles API calls to /wallet/sweep/seed.
-func (api *API) walletSweepSeedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletSweepSeedHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	// Get the seed using the ditionary + phrase
 	dictID := mnemonics.DictionaryID(req.FormValue("dictionary"))
 	if dictID == "" {
@@ -510,7 +851,7 @@ func (api *API) walletSweepSeedHandler(w http.ResponseWriter, req *http.Request,
 		return
 	}
 
-	coins, funds, err := api.wallet.SweepSeed(seed)
+	coins, funds, err := wallet.SweepSeed(seed)
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/sweep/seed: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -522,7 +863,7 @@ func (api *API) walletSweepSeedHandler(w http.ResponseWriter, req *http.Request,
 }
 
 // walletTransactionHandler handles API calls to /wallet/transaction/:id.
-func (api *API) walletTransactionHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+func (api *API) walletTransactionHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	// Parse the id from the url.
 	var id types.TransactionID
 	jsonID := "\"" + ps.ByName("id") + "\""
@@ -532,7 +873,7 @@ func (api *API) walletTransactionHandler(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	txn, ok, err := api.wallet.Transaction(id)
+	txn, ok, err := wallet.Transaction(id)
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/transaction/id:" + err.Error()}, http.StatusBadRequest)
 		return
@@ -547,7 +888,7 @@ func (api *API) walletTransactionHandler(w http.ResponseWriter, req *http.Reques
 }
 
 // walletTransactionsHandler handles API calls to /wallet/transactions.
-func (api *API) walletTransactionsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletTransactionsHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	startheightStr, endheightStr, depthStr := req.FormValue("startheight"), req.FormValue("endheight"), req.FormValue("depth")
 	countStr, watchOnlyStr, categoryStr := req.FormValue("count"), req.FormValue("watchonly"), req.FormValue("category")
 	var start, end, depth uint64
@@ -594,7 +935,7 @@ func (api *API) walletTransactionsHandler(w http.ResponseWriter, req *http.Reque
 				WriteError(w, Error{"parsing integer value for parameter `depth` failed: " + err.Error()}, http.StatusBadRequest)
 				return
 			}
-			height, err := api.wallet.Height()
+			height, err := wallet.Height()
 			if err != nil {
 				WriteError(w, Error{fmt.Sprintf("Error when calling /wallet: %v", err)}, http.StatusBadRequest)
 				return
@@ -605,12 +946,12 @@ func (api *API) walletTransactionsHandler(w http.ResponseWriter, req *http.Reque
 				start = 0
 			}
 		}
-		confirmedTxns, err = api.wallet.Transactions(types.BlockHeight(start), types.BlockHeight(end))
+		confirmedTxns, err = wallet.Transactions(types.BlockHeight(start), types.BlockHeight(end))
 		if err != nil {
 			WriteError(w, Error{"error when calling /wallet/transactions: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
-		unconfirmedTxns, err = api.wallet.UnconfirmedTransactions()
+		unconfirmedTxns, err = wallet.UnconfirmedTransactions()
 		if err != nil {
 			WriteError(w, Error{"error when calling /wallet/transactions: " + err.Error()}, http.StatusBadRequest)
 			return
@@ -644,8 +985,8 @@ func (api *API) walletTransactionsHandler(w http.ResponseWriter, req *http.Reque
 				category = categoryStr
 			}
 		}
-		confirmedTxns, err = api.wallet.FilteredTransactions(count, watchOnly, category)
-		unconfirmedTxns, err = api.wallet.FilteredUnconfirmedTransactions(watchOnly, category)
+		confirmedTxns, err = wallet.FilteredTransactions(count, watchOnly, category)
+		unconfirmedTxns, err = wallet.FilteredUnconfirmedTransactions(watchOnly, category)
 	}
 
 	WriteJSON(w, WalletTransactionsGET{
@@ -654,9 +995,76 @@ func (api *API) walletTransactionsHandler(w http.ResponseWriter, req *http.Reque
 	})
 }
 
+// walletHistoryHandler handles API calls to /wallet/history.
+func (api *API) walletHistoryHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	q := modules.TransactionHistoryQuery{
+		Category: req.FormValue("category"),
+		Label:    req.FormValue("label"),
+		Cursor:   req.FormValue("cursor"),
+	}
+	if addrs := req.FormValue("addresses"); addrs != "" {
+		for _, addrStr := range strings.Split(addrs, ",") {
+			addr, err := scanAddress(strings.TrimSpace(addrStr))
+			if err != nil {
+				WriteError(w, Error{"could not read address " + addrStr + ": " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+			q.Addresses = append(q.Addresses, addr)
+		}
+	}
+	uints := []struct {
+		name string
+		val  *uint64
+	}{
+		{"minheight", (*uint64)(&q.MinHeight)},
+		{"maxheight", (*uint64)(&q.MaxHeight)},
+		{"mintime", (*uint64)(&q.MinTime)},
+		{"maxtime", (*uint64)(&q.MaxTime)},
+	}
+	for _, u := range uints {
+		if str := req.FormValue(u.name); str != "" {
+			v, err := strconv.ParseUint(str, 10, 64)
+			if err != nil {
+				WriteError(w, Error{"parsing integer value for parameter `" + u.name + "` failed: " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+			*u.val = v
+		}
+	}
+	if limitStr := req.FormValue("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil {
+			WriteError(w, Error{"parsing integer value for parameter `limit` failed: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		q.Limit = limit
+	}
+	if minValueStr := req.FormValue("minvalue"); minValueStr != "" {
+		minValue, ok := scanAmount(minValueStr)
+		if !ok {
+			WriteError(w, Error{"could not read amount from `minvalue`"}, http.StatusBadRequest)
+			return
+		}
+		q.MinValue = minValue
+	}
+	descending, err := scanBool(req.FormValue("descending"))
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/history: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	q.Descending = descending
+
+	page, err := wallet.TransactionHistory(q)
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallet/history: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, WalletHistoryGET{page})
+}
+
 // walletTransactionsAddrHandler handles API calls to
 // /wallet/transactions/:addr.
-func (api *API) walletTransactionsAddrHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+func (api *API) walletTransactionsAddrHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	// Parse the address being input.
 	jsonAddr := "\"" + ps.ByName("addr") + "\""
 	var addr types.UnlockHash
@@ -666,12 +1074,12 @@ func (api *API) walletTransactionsAddrHandler(w http.ResponseWriter, req *http.R
 		return
 	}
 
-	confirmedATs, err := api.wallet.AddressTransactions(addr)
+	confirmedATs, err := wallet.AddressTransactions(addr)
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/transactions: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
-	unconfirmedATs, err := api.wallet.AddressUnconfirmedTransactions(addr)
+	unconfirmedATs, err := wallet.AddressUnconfirmedTransactions(addr)
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/transactions: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -684,7 +1092,7 @@ func (api *API) walletTransactionsAddrHandler(w http.ResponseWriter, req *http.R
 
 // walletBuildTransactionHandler handles API calls to
 // /wallet/transactions/build.
-func (api *API) walletBuildTransactionHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+func (api *API) walletBuildTransactionHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	// single amount + destination
 	amount, ok := scanAmount(req.FormValue("amount"))
 	if !ok {
@@ -698,7 +1106,7 @@ func (api *API) walletBuildTransactionHandler(w http.ResponseWriter, req *http.R
 	}
 	var fee types.Currency
 
-	txnSet, err := api.wallet.NewTransactionSetForAddress(dest, amount, fee)
+	txnSet, err := wallet.NewTransactionSetForAddress(dest, amount, fee)
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/build/transaction:" + err.Error()}, http.StatusBadRequest)
 		return
@@ -715,10 +1123,10 @@ func (api *API) walletBuildTransactionHandler(w http.ResponseWriter, req *http.R
 }
 
 // walletUnlockHandler handles API calls to /wallet/unlock.
-func (api *API) walletUnlockHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletUnlockHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	potentialKeys := encryptionKeys(req.FormValue("encryptionpassword"))
 	for _, key := range potentialKeys {
-		err := api.wallet.Unlock(key)
+		err := wallet.Unlock(key)
 		if err == nil {
 			WriteSuccess(w)
 			return
@@ -732,7 +1140,7 @@ func (api *API) walletUnlockHandler(w http.ResponseWriter, req *http.Request, _
 }
 
 // walletChangePasswordHandler handles API calls to /wallet/changepassword
-func (api *API) walletChangePasswordHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletChangePasswordHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	var newKey crypto.CipherKey
 	newPassword := req.FormValue("newpassword")
 	if newPassword == "" {
@@ -743,7 +1151,7 @@ func (api *API) walletChangePasswordHandler(w http.ResponseWriter, req *http.Req
 
 	originalKeys := encryptionKeys(req.FormValue("encryptionpassword"))
 	for _, key := range originalKeys {
-		err := api.wallet.ChangeKey(key, newKey)
+		err := wallet.ChangeKey(key, newKey)
 		if err == nil {
 			WriteSuccess(w)
 			return
@@ -765,14 +1173,14 @@ func (api *API) walletVerifyAddressHandler(w http.ResponseWriter, req *http.Requ
 }
 
 // walletUnlockConditionsHandlerGET handles GET calls to /wallet/unlockconditions.
-func (api *API) walletUnlockConditionsHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+func (api *API) walletUnlockConditionsHandlerGET(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	var addr types.UnlockHash
 	err := addr.LoadString(ps.ByName("addr"))
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/unlockconditions: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
-	uc, err := api.wallet.UnlockConditions(addr)
+	uc, err := wallet.UnlockConditions(addr)
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/unlockconditions: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -783,14 +1191,14 @@ func (api *API) walletUnlockConditionsHandlerGET(w http.ResponseWriter, req *htt
 }
 
 // walletUnlockConditionsHandlerPOST handles POST calls to /wallet/unlockconditions.
-func (api *API) walletUnlockConditionsHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+func (api *API) walletUnlockConditionsHandlerPOST(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	var params WalletUnlockConditionsPOSTParams
 	err := json.NewDecoder(req.Body).Decode(&params)
 	if err != nil {
 		WriteError(w, Error{"invalid parameters: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
-	err = api.wallet.AddUnlockConditions(params.UnlockConditions)
+	err = wallet.AddUnlockConditions(params.UnlockConditions)
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/unlockconditions: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -799,8 +1207,8 @@ func (api *API) walletUnlockConditionsHandlerPOST(w http.ResponseWriter, req *ht
 }
 
 // walletUnspentHandler handles API calls to /wallet/unspent.
-func (api *API) walletUnspentHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	outputs, err := api.wallet.UnspentOutputs()
+func (api *API) walletUnspentHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	outputs, err := wallet.UnspentOutputs()
 	if err != nil {
 		WriteError(w, Error{"error when calling /wallet/unspent: " + err.Error()}, http.StatusInternalServerError)
 		return
@@ -811,14 +1219,14 @@ func (api *API) walletUnspentHandler(w http.ResponseWriter, req *http.Request, _
 }
 
 // walletSignHandler handles API calls to /wallet/sign.
-func (api *API) walletSignHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletSignHandler(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	var params WalletSignPOSTParams
 	err := json.NewDecoder(req.Body).Decode(&params)
 	if err != nil {
 		WriteError(w, Error{"invalid parameters: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
-	err = api.wallet.SignTransaction(&params.Transaction, params.ToSign)
+	err = wallet.SignTransaction(&params.Transaction, params.ToSign)
 	if err != nil {
 		WriteError(w, Error{"failed to sign transaction: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -829,8 +1237,8 @@ func (api *API) walletSignHandler(w http.ResponseWriter, req *http.Request, _ ht
 }
 
 // walletWatchHandlerGET handles GET calls to /wallet/watch.
-func (api *API) walletWatchHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	addrs, err := api.wallet.WatchAddresses()
+func (api *API) walletWatchHandlerGET(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	addrs, err := wallet.WatchAddresses()
 	if err != nil {
 		WriteError(w, Error{"failed to get watch addresses: " + err.Error()}, http.StatusBadRequest)
 		return
@@ -841,7 +1249,7 @@ func (api *API) walletWatchHandlerGET(w http.ResponseWriter, req *http.Request,
 }
 
 // walletWatchHandlerPOST handles POST calls to /wallet/watch.
-func (api *API) walletWatchHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) walletWatchHandlerPOST(wallet modules.Wallet, w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	var wwpp WalletWatchPOST
 	err := json.NewDecoder(req.Body).Decode(&wwpp)
 	if err != nil {
@@ -849,9 +1257,9 @@ func (api *API) walletWatchHandlerPOST(w http.ResponseWriter, req *http.Request,
 		return
 	}
 	if wwpp.Remove {
-		err = api.wallet.RemoveWatchAddresses(wwpp.Addresses, wwpp.Unused)
+		err = wallet.RemoveWatchAddresses(wwpp.Addresses, wwpp.Unused)
 	} else {
-		err = api.wallet.AddWatchAddresses(wwpp.Addresses, wwpp.Unused)
+		err = wallet.AddWatchAddresses(wwpp.Addresses, wwpp.Unused)
 	}
 	if err != nil {
 		WriteError(w, Error{"failed to update watch set: " + err.Error()}, http.StatusBadRequest)
@@ -859,3 +1267,40 @@ func (api *API) walletWatchHandlerPOST(w http.ResponseWriter, req *http.Request,
 	}
 	WriteSuccess(w)
 }
+
+// walletsHandler handles API calls to /wallets.
+func (api *API) walletsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	wallets, err := api.wallets.Wallets()
+	if err != nil {
+		WriteError(w, Error{"error when calling /wallets: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, WalletsGET{Wallets: wallets})
+}
+
+// walletsCreateHandler handles API calls to /wallets/create.
+func (api *API) walletsCreateHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if _, err := api.wallets.CreateWallet(req.FormValue("name")); err != nil {
+		WriteError(w, Error{"error when calling /wallets/create: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// walletsLoadHandler handles API calls to /wallets/load.
+func (api *API) walletsLoadHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if _, err := api.wallets.LoadWallet(req.FormValue("name")); err != nil {
+		WriteError(w, Error{"error when calling /wallets/load: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// walletsUnloadHandler handles API calls to /wallets/unload.
+func (api *API) walletsUnloadHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if err := api.wallets.UnloadWallet(req.FormValue("name")); err != nil {
+		WriteError(w, Error{"error when calling /wallets/unload: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
@@ -114,6 +114,7 @@ type Node struct {
 	Renter          modules.Renter
 	TransactionPool modules.TransactionPool
 	Wallet          modules.Wallet
+	WalletManager   modules.WalletManager
 
 	// The high level directory where all the persistence gets stored for the
 	// modules.
@@ -141,6 +142,9 @@ func (n *Node) Close() (err error) {
 	if n.Renter != nil {
 		err = errors.Compose(n.Renter.Close())
 	}
+	if n.WalletManager != nil {
+		err = errors.Compose(n.WalletManager.Close())
+	}
 	if n.Wallet != nil {
 		err = errors.Compose(n.Wallet.Close())
 	}
@@ -228,6 +232,7 @@ func New(params NodeParams) (*Node, error) {
 	}
 
 	// Wallet.
+	var wm modules.WalletManager
 	w, err := func() (modules.Wallet, error) {
 		if params.CreateWallet && params.Wallet != nil {
 			return nil, errors.New("cannot create wallet and use custom wallet")
@@ -242,7 +247,16 @@ func New(params NodeParams) (*Node, error) {
 		if walletDeps == nil {
 			walletDeps = modules.ProdDependencies
 		}
-		return wallet.NewCustomWallet(cs, tp, filepath.Join(dir, modules.WalletDir), modules.DefaultAddressGapLimit, false, walletDeps)
+		w, err := wallet.NewCustomWallet(cs, tp, filepath.Join(dir, modules.WalletDir), modules.DefaultAddressGapLimit, false, walletDeps)
+		if err != nil {
+			return nil, err
+		}
+		m, err := wallet.NewManager(w)
+		if err != nil {
+			return nil, err
+		}
+		wm = m
+		return w, nil
 	}()
 	if err != nil {
 		return nil, errors.Extend(err, errors.New("unable to create wallet"))
@@ -313,7 +327,7 @@ func New(params NodeParams) (*Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		return renter.NewCustomRenter(g, cs, tp, hdb, hc, persistDir, renterDeps)
+		return renter.NewCustomRenter(g, cs, tp, w, hdb, hc, persistDir, renterDeps)
 	}()
 	if err != nil {
 		return nil, errors.Extend(err, errors.New("unable to create renter"))
@@ -405,6 +419,7 @@ func New(params NodeParams) (*Node, error) {
 		Renter:          r,
 		TransactionPool: tp,
 		Wallet:          w,
+		WalletManager:   wm,
 
 		Dir: dir,
 	}, nil
@@ -0,0 +1,299 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// signatureAlgorithm is the only signature algorithm supported by the
+	// gateway, AWS Signature Version 4.
+	signatureAlgorithm = "AWS4-HMAC-SHA256"
+
+	// amzDateFormat is the format of the X-Amz-Date header.
+	amzDateFormat = "20060102T150405Z"
+
+	// maxClockSkew is the maximum difference between the time a request was
+	// signed and the time it is received.
+	maxClockSkew = 15 * time.Minute
+
+	// serviceName is the name of the service in the credential scope.
+	serviceName = "s3"
+
+	// unsignedPayload is the value of the X-Amz-Content-Sha256 header of
+	// requests whose body is not covered by the signature.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// signature contains the fields of a SigV4 Authorization header.
+type signature struct {
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+}
+
+// parseAuthorization parses an Authorization header of the form
+//
+//	AWS4-HMAC-SHA256 Credential=<key>/<date>/<region>/<service>/aws4_request,
+//	SignedHeaders=<headers>, Signature=<signature>
+func parseAuthorization(header string) (sig signature, err error) {
+	if !strings.HasPrefix(header, signatureAlgorithm+" ") {
+		return signature{}, errAuthorizationHeaderMalformed
+	}
+	var credential string
+	for _, field := range strings.Split(strings.TrimPrefix(header, signatureAlgorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return signature{}, errAuthorizationHeaderMalformed
+		}
+		switch kv[0] {
+		case "Credential":
+			credential = kv[1]
+		case "SignedHeaders":
+			sig.signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			sig.signature = kv[1]
+		default:
+			return signature{}, errAuthorizationHeaderMalformed
+		}
+	}
+	scope := strings.Split(credential, "/")
+	if len(scope) != 5 || scope[4] != "aws4_request" {
+		return signature{}, errAuthorizationHeaderMalformed
+	}
+	if len(sig.signedHeaders) == 0 || sig.signature == "" {
+		return signature{}, errAuthorizationHeaderMalformed
+	}
+	sig.accessKey, sig.date, sig.region, sig.service = scope[0], scope[1], scope[2], scope[3]
+	return sig, nil
+}
+
+// authenticate verifies the signature of a request and returns the value of
+// its X-Amz-Content-Sha256 header, which the body is checked against.
+func (g *Gateway) authenticate(req *http.Request) (string, error) {
+	header := req.Header.Get("Authorization")
+	if header == "" {
+		return "", errAccessDenied
+	}
+	sig, err := parseAuthorization(header)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := g.accessKeys[sig.accessKey]
+	if !ok {
+		return "", errInvalidAccessKeyID
+	}
+	if sig.region != g.region || sig.service != serviceName {
+		return "", errAuthorizationHeaderMalformed
+	}
+	if !signsHeader(sig, "host") {
+		// Without a signed host, a signature could be replayed against any
+		// gateway sharing the access key.
+		return "", errAccessDenied
+	}
+	amzDate := req.Header.Get("X-Amz-Date")
+	if amzDate == "" {
+		return "", errMissingSecurityHeader
+	}
+	t, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil || !strings.HasPrefix(amzDate, sig.date) {
+		return "", errAuthorizationHeaderMalformed
+	}
+	if skew := time.Since(t); skew > maxClockSkew || skew < -maxClockSkew {
+		return "", errRequestTimeTooSkewed
+	}
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return "", errMissingSecurityHeader
+	}
+	if strings.HasPrefix(payloadHash, "STREAMING-") {
+		// Chunked signing of the body is not supported.
+		return "", errNotImplemented
+	}
+	expected := signRequest(req, sig, secret, amzDate, payloadHash)
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		return "", errSignatureDoesNotMatch
+	}
+	return payloadHash, nil
+}
+
+// signsHeader returns whether the signature covers the header with the given
+// lowercase name.
+func signsHeader(sig signature, name string) bool {
+	for _, h := range sig.signedHeaders {
+		if h == name {
+			return true
+		}
+	}
+	return false
+}
+
+// signRequest computes the hex encoded SigV4 signature of a request.
+func signRequest(req *http.Request, sig signature, secret, amzDate, payloadHash string) string {
+	canonical := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req),
+		canonicalHeaders(req, sig.signedHeaders),
+		strings.Join(sig.signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	scope := strings.Join([]string{sig.date, sig.region, sig.service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		signatureAlgorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secret), sig.date)
+	key = hmacSHA256(key, sig.region)
+	key = hmacSHA256(key, sig.service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery returns the query string of a request sorted by key and
+// value and encoded the way SigV4 expects.
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// canonicalHeaders returns the signed headers of a request, one per line.
+func canonicalHeaders(req *http.Request, signedHeaders []string) string {
+	var b strings.Builder
+	for _, name := range signedHeaders {
+		var values []string
+		switch {
+		case name == "host":
+			values = []string{req.Host}
+		case name == "content-length" && req.Header.Get("Content-Length") == "":
+			// The server removes the Content-Length header from requests.
+			values = []string{strconv.FormatInt(req.ContentLength, 10)}
+		default:
+			values = req.Header[http.CanonicalHeaderKey(name)]
+		}
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		b.WriteString(name + ":" + strings.Join(trimmed, ",") + "\n")
+	}
+	return b.String()
+}
+
+// uriEncode percent-encodes every byte of s except the unreserved characters.
+// Slashes are only encoded if encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+// verifyingReader checks the body of a request against the hashes given in
+// its headers. A mismatch is reported when the end of the body is reached.
+type verifyingReader struct {
+	r io.Reader
+
+	md5        hash.Hash
+	wantMD5    []byte
+	sha256     hash.Hash
+	wantSHA256 []byte
+}
+
+// newVerifyingReader wraps the body of a request. payloadHash is the value of
+// the X-Amz-Content-Sha256 header and contentMD5 the value of the Content-MD5
+// header, which may be empty.
+func newVerifyingReader(r io.Reader, payloadHash, contentMD5 string) (*verifyingReader, error) {
+	vr := &verifyingReader{
+		r:   r,
+		md5: md5.New(),
+	}
+	if payloadHash != unsignedPayload {
+		sum, err := hex.DecodeString(payloadHash)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, errContentSHA256Mismatch
+		}
+		vr.sha256, vr.wantSHA256 = sha256.New(), sum
+	}
+	if contentMD5 != "" {
+		sum, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(sum) != md5.Size {
+			return nil, errInvalidDigest
+		}
+		vr.wantMD5 = sum
+	}
+	return vr, nil
+}
+
+// Read implements the io.Reader interface.
+func (vr *verifyingReader) Read(b []byte) (int, error) {
+	n, err := vr.r.Read(b)
+	vr.md5.Write(b[:n])
+	if vr.sha256 != nil {
+		vr.sha256.Write(b[:n])
+	}
+	if err != io.EOF {
+		return n, err
+	}
+	if vr.wantMD5 != nil && !bytes.Equal(vr.md5.Sum(nil), vr.wantMD5) {
+		return n, errBadDigest
+	}
+	if vr.sha256 != nil && !bytes.Equal(vr.sha256.Sum(nil), vr.wantSHA256) {
+		return n, errContentSHA256Mismatch
+	}
+	return n, io.EOF
+}
+
+// ETag returns the entity tag of the data read so far, the quoted hex encoded
+// MD5 of the data.
+func (vr *verifyingReader) ETag() string {
+	return `"` + hex.EncodeToString(vr.md5.Sum(nil)) + `"`
+}
@@ -0,0 +1,134 @@
+package s3
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/errors"
+)
+
+type (
+	// listAllMyBucketsResult is the response of a ListBuckets request.
+	listAllMyBucketsResult struct {
+		XMLName xml.Name     `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+		Owner   owner        `xml:"Owner"`
+		Buckets []bucketInfo `xml:"Buckets>Bucket"`
+	}
+
+	// bucketInfo describes a single bucket.
+	bucketInfo struct {
+		Name         string    `xml:"Name"`
+		CreationDate time.Time `xml:"CreationDate"`
+	}
+
+	// owner is the owner of buckets and objects. Since the gateway has a
+	// single owner it is the same for every bucket and object.
+	owner struct {
+		ID          string `xml:"ID"`
+		DisplayName string `xml:"DisplayName"`
+	}
+)
+
+// gatewayOwner is the owner reported for all buckets and objects.
+var gatewayOwner = owner{ID: "hyperspace", DisplayName: "hyperspace"}
+
+// dirExists returns whether a directory of the renter exists. Buckets and
+// folders are both stored as directories.
+func (g *Gateway) dirExists(dir string) (bool, error) {
+	_, _, err := g.renter.DirList(dir)
+	if errors.Contains(err, siafile.ErrUnknownDir) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// listBucketsHandler handles ListBuckets requests by listing the top-level
+// directories of the renter.
+func (g *Gateway) listBucketsHandler(w http.ResponseWriter, req *http.Request) {
+	dirs, _, err := g.renter.DirList("")
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	result := listAllMyBucketsResult{
+		Owner:   gatewayOwner,
+		Buckets: []bucketInfo{},
+	}
+	// The first directory is the root directory itself.
+	for _, dir := range dirs[1:] {
+		name := path.Base(dir.HyperspacePath)
+		if !bucketNameRegexp.MatchString(name) {
+			continue
+		}
+		result.Buckets = append(result.Buckets, bucketInfo{
+			Name:         name,
+			CreationDate: dir.LastModified.UTC(),
+		})
+	}
+	writeXML(w, result)
+}
+
+// headBucketHandler handles HeadBucket requests.
+func (g *Gateway) headBucketHandler(w http.ResponseWriter, req *http.Request, bucket string) {
+	exists, err := g.dirExists(bucket)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	if !exists {
+		writeError(w, req, errNoSuchBucket)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// createBucketHandler handles CreateBucket requests by creating the top-level
+// directory of the bucket. The location constraint in the body is ignored.
+func (g *Gateway) createBucketHandler(w http.ResponseWriter, req *http.Request, body io.Reader, bucket string) {
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		writeError(w, req, err)
+		return
+	}
+	exists, err := g.dirExists(bucket)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	if exists {
+		writeError(w, req, errBucketAlreadyOwnedByYou)
+		return
+	}
+	if err := g.renter.CreateDir(bucket); err != nil {
+		writeError(w, req, err)
+		return
+	}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteBucketHandler handles DeleteBucket requests. Like S3, only empty
+// buckets can be deleted.
+func (g *Gateway) deleteBucketHandler(w http.ResponseWriter, req *http.Request, bucket string) {
+	dirs, files, err := g.renter.DirList(bucket)
+	if errors.Contains(err, siafile.ErrUnknownDir) {
+		writeError(w, req, errNoSuchBucket)
+		return
+	} else if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	if len(dirs) > 1 || len(files) > 0 {
+		writeError(w, req, errBucketNotEmpty)
+		return
+	}
+	if err := g.renter.DeleteDir(bucket); err != nil {
+		writeError(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
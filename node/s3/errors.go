@@ -0,0 +1,94 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/HyperspaceApp/errors"
+)
+
+// s3Error is an error as it is reported by the S3 API. The codes match the
+// ones used by Amazon so that existing clients can interpret them.
+type s3Error struct {
+	Code    string
+	Message string
+	status  int
+}
+
+// Error implements the error interface.
+func (e s3Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied                 = s3Error{"AccessDenied", "Access Denied", http.StatusForbidden}
+	errAuthorizationHeaderMalformed = s3Error{"AuthorizationHeaderMalformed", "The authorization header is malformed.", http.StatusBadRequest}
+	errBadDigest                    = s3Error{"BadDigest", "The Content-MD5 you specified did not match what we received.", http.StatusBadRequest}
+	errBucketAlreadyOwnedByYou      = s3Error{"BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.", http.StatusConflict}
+	errBucketNotEmpty               = s3Error{"BucketNotEmpty", "The bucket you tried to delete is not empty.", http.StatusConflict}
+	errContentSHA256Mismatch        = s3Error{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest}
+	errEntityTooSmall               = s3Error{"EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", http.StatusBadRequest}
+	errInternalError                = s3Error{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+	errInvalidAccessKeyID           = s3Error{"InvalidAccessKeyId", "The access key ID you provided does not exist in our records.", http.StatusForbidden}
+	errInvalidArgument              = s3Error{"InvalidArgument", "Invalid argument.", http.StatusBadRequest}
+	errInvalidBucketName            = s3Error{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+	errInvalidDigest                = s3Error{"InvalidDigest", "The Content-MD5 you specified is not valid.", http.StatusBadRequest}
+	errInvalidObjectName            = s3Error{"InvalidArgument", "The specified object key is not valid.", http.StatusBadRequest}
+	errInvalidPart                  = s3Error{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	errInvalidPartOrder             = s3Error{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	errMalformedXML                 = s3Error{"MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.", http.StatusBadRequest}
+	errMethodNotAllowed             = s3Error{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	errMissingSecurityHeader        = s3Error{"MissingSecurityHeader", "Your request is missing a required header.", http.StatusBadRequest}
+	errNoSuchBucket                 = s3Error{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	errNoSuchKey                    = s3Error{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	errNoSuchUpload                 = s3Error{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	errNotImplemented               = s3Error{"NotImplemented", "A header or query you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	errRequestTimeTooSkewed         = s3Error{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.", http.StatusForbidden}
+	errSignatureDoesNotMatch        = s3Error{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.", http.StatusForbidden}
+)
+
+// errorResponse is the XML body of an error response.
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+// bodyErrors are the errors returned when reading the request body. The renter
+// wraps them when they occur during an upload.
+var bodyErrors = []s3Error{errBadDigest, errContentSHA256Mismatch}
+
+// writeError writes an S3 error response. Errors that are not an s3Error are
+// reported as an InternalError.
+func writeError(w http.ResponseWriter, req *http.Request, err error) {
+	e, ok := err.(s3Error)
+	if !ok {
+		e = errInternalError
+		e.Message = err.Error()
+		for _, bodyErr := range bodyErrors {
+			if errors.Contains(err, bodyErr) {
+				e = bodyErr
+				break
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(e.status)
+	if req.Method == http.MethodHead {
+		return
+	}
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(errorResponse{
+		Code:     e.Code,
+		Message:  e.Message,
+		Resource: req.URL.Path,
+	})
+}
+
+// writeXML writes a successful response with an XML body.
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(v)
+}
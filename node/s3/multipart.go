@@ -0,0 +1,354 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/persist"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+const (
+	// maxPartNumber is the highest part number of a multipart upload.
+	maxPartNumber = 10000
+
+	// minPartSize is the minimum size of every part of a multipart upload
+	// except the last one.
+	minPartSize = 5 << 20
+
+	// uploadIDLen is the length of the hex encoded ID of a multipart upload.
+	uploadIDLen = 32
+
+	// uploadFile is the name of the file that describes a multipart upload
+	// within its staging directory.
+	uploadFile = "upload.json"
+)
+
+// uploadMetadata is the persist metadata of an uploadFile.
+var uploadMetadata = persist.Metadata{
+	Header:  "S3 Multipart Upload",
+	Version: "1.0",
+}
+
+type (
+	// multipartUpload describes a multipart upload that was created but not
+	// yet completed or aborted.
+	multipartUpload struct {
+		Bucket    string    `json:"bucket"`
+		Key       string    `json:"key"`
+		Initiated time.Time `json:"initiated"`
+	}
+
+	// partInfo describes an uploaded part of a multipart upload.
+	partInfo struct {
+		PartNumber   int       `xml:"PartNumber"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	}
+
+	// initiateMultipartUploadResult is the response of a
+	// CreateMultipartUpload request.
+	initiateMultipartUploadResult struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}
+
+	// completeMultipartUpload is the body of a CompleteMultipartUpload
+	// request.
+	completeMultipartUpload struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+
+	// completeMultipartUploadResult is the response of a
+	// CompleteMultipartUpload request.
+	completeMultipartUploadResult struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+		Location string   `xml:"Location"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		ETag     string   `xml:"ETag"`
+	}
+
+	// listPartsResult is the response of a ListParts request.
+	listPartsResult struct {
+		XMLName     xml.Name   `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListPartsResult"`
+		Bucket      string     `xml:"Bucket"`
+		Key         string     `xml:"Key"`
+		UploadID    string     `xml:"UploadId"`
+		Initiator   owner      `xml:"Initiator"`
+		Owner       owner      `xml:"Owner"`
+		MaxParts    int        `xml:"MaxParts"`
+		IsTruncated bool       `xml:"IsTruncated"`
+		Parts       []partInfo `xml:"Part"`
+	}
+)
+
+// uploadDir returns the staging directory of a multipart upload.
+func (g *Gateway) uploadDir(uploadID string) string {
+	return filepath.Join(g.stagingDir, multipartDir, uploadID)
+}
+
+// partPath returns the path of the data of a part in the staging directory.
+// The ETag of the part is stored next to it.
+func (g *Gateway) partPath(uploadID string, partNumber int) string {
+	return filepath.Join(g.uploadDir(uploadID), fmt.Sprintf("part-%05d", partNumber))
+}
+
+// loadUpload loads a multipart upload and checks that it belongs to the
+// object.
+func (g *Gateway) loadUpload(bucket, key, uploadID string) (multipartUpload, error) {
+	if len(uploadID) != uploadIDLen {
+		return multipartUpload{}, errNoSuchUpload
+	}
+	if _, err := hex.DecodeString(uploadID); err != nil {
+		return multipartUpload{}, errNoSuchUpload
+	}
+	var upload multipartUpload
+	g.mu.Lock()
+	err := persist.LoadJSON(uploadMetadata, &upload, filepath.Join(g.uploadDir(uploadID), uploadFile))
+	g.mu.Unlock()
+	if os.IsNotExist(err) {
+		return multipartUpload{}, errNoSuchUpload
+	} else if err != nil {
+		return multipartUpload{}, err
+	}
+	if upload.Bucket != bucket || upload.Key != key {
+		return multipartUpload{}, errNoSuchUpload
+	}
+	return upload, nil
+}
+
+// loadPart returns the information on a part of a multipart upload.
+func (g *Gateway) loadPart(uploadID string, partNumber int) (partInfo, error) {
+	partPath := g.partPath(uploadID, partNumber)
+	fi, err := os.Stat(partPath)
+	if os.IsNotExist(err) {
+		return partInfo{}, errInvalidPart
+	} else if err != nil {
+		return partInfo{}, err
+	}
+	etag, err := ioutil.ReadFile(partPath + ".etag")
+	if err != nil {
+		return partInfo{}, err
+	}
+	return partInfo{
+		PartNumber:   partNumber,
+		LastModified: fi.ModTime().UTC(),
+		ETag:         string(etag),
+		Size:         fi.Size(),
+	}, nil
+}
+
+// createMultipartUploadHandler handles CreateMultipartUpload requests.
+func (g *Gateway) createMultipartUploadHandler(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	if strings.HasSuffix(key, "/") {
+		writeError(w, req, errInvalidObjectName)
+		return
+	}
+	uploadID := hex.EncodeToString(fastrand.Bytes(uploadIDLen / 2))
+	if err := os.MkdirAll(g.uploadDir(uploadID), 0700); err != nil {
+		writeError(w, req, err)
+		return
+	}
+	upload := multipartUpload{
+		Bucket:    bucket,
+		Key:       key,
+		Initiated: time.Now(),
+	}
+	g.mu.Lock()
+	err := persist.SaveJSON(uploadMetadata, upload, filepath.Join(g.uploadDir(uploadID), uploadFile))
+	g.mu.Unlock()
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	writeXML(w, initiateMultipartUploadResult{
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: uploadID,
+	})
+}
+
+// uploadPartHandler handles UploadPart requests by storing the part in the
+// staging directory until the upload is completed.
+func (g *Gateway) uploadPartHandler(w http.ResponseWriter, req *http.Request, body *verifyingReader, bucket, key, uploadID string) {
+	partNumber, err := strconv.Atoi(req.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		writeError(w, req, errInvalidArgument)
+		return
+	}
+	if _, err := g.loadUpload(bucket, key, uploadID); err != nil {
+		writeError(w, req, err)
+		return
+	}
+
+	// Write the part to a temporary file first, so that a failed upload
+	// doesn't replace an existing part.
+	partPath := g.partPath(uploadID, partNumber)
+	tmpPath := partPath + "_temp" + persist.RandomSuffix()
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	_, err = io.Copy(f, body)
+	err = errors.Compose(err, f.Sync(), f.Close())
+	if err == nil {
+		err = ioutil.WriteFile(partPath+".etag", []byte(body.ETag()), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, partPath)
+	}
+	if err != nil {
+		writeError(w, req, errors.Compose(err, os.Remove(tmpPath)))
+		return
+	}
+	w.Header().Set("ETag", body.ETag())
+	w.WriteHeader(http.StatusOK)
+}
+
+// completeMultipartUploadHandler handles CompleteMultipartUpload requests by
+// uploading the listed parts to the renter as a single object.
+func (g *Gateway) completeMultipartUploadHandler(w http.ResponseWriter, req *http.Request, body *verifyingReader, bucket, key, uploadID string) {
+	var cmu completeMultipartUpload
+	if err := xml.NewDecoder(body).Decode(&cmu); err != nil {
+		writeError(w, req, errMalformedXML)
+		return
+	}
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		writeError(w, req, err)
+		return
+	}
+	if len(cmu.Parts) == 0 {
+		writeError(w, req, errMalformedXML)
+		return
+	}
+	if _, err := g.loadUpload(bucket, key, uploadID); err != nil {
+		writeError(w, req, err)
+		return
+	}
+
+	// Check the parts and open them in order.
+	var readers []io.Reader
+	var etags bytes.Buffer
+	for i, p := range cmu.Parts {
+		if i > 0 && p.PartNumber <= cmu.Parts[i-1].PartNumber {
+			writeError(w, req, errInvalidPartOrder)
+			return
+		}
+		part, err := g.loadPart(uploadID, p.PartNumber)
+		if err != nil {
+			writeError(w, req, err)
+			return
+		}
+		if strings.Trim(p.ETag, `"`) != strings.Trim(part.ETag, `"`) {
+			writeError(w, req, errInvalidPart)
+			return
+		}
+		if i < len(cmu.Parts)-1 && part.Size < minPartSize {
+			writeError(w, req, errEntityTooSmall)
+			return
+		}
+		sum, err := hex.DecodeString(strings.Trim(part.ETag, `"`))
+		if err != nil {
+			writeError(w, req, err)
+			return
+		}
+		etags.Write(sum)
+
+		f, err := os.Open(g.partPath(uploadID, p.PartNumber))
+		if err != nil {
+			writeError(w, req, err)
+			return
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	if err := g.uploadObject(bucket, key, io.MultiReader(readers...)); err != nil {
+		writeError(w, req, err)
+		return
+	}
+	if err := os.RemoveAll(g.uploadDir(uploadID)); err != nil {
+		writeError(w, req, err)
+		return
+	}
+
+	// The ETag of a multipart object is the MD5 of the MD5s of its parts,
+	// followed by the number of parts.
+	sum := md5.Sum(etags.Bytes())
+	writeXML(w, completeMultipartUploadResult{
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(cmu.Parts)),
+	})
+}
+
+// abortMultipartUploadHandler handles AbortMultipartUpload requests by
+// removing the staged parts.
+func (g *Gateway) abortMultipartUploadHandler(w http.ResponseWriter, req *http.Request, bucket, key, uploadID string) {
+	if _, err := g.loadUpload(bucket, key, uploadID); err != nil {
+		writeError(w, req, err)
+		return
+	}
+	if err := os.RemoveAll(g.uploadDir(uploadID)); err != nil {
+		writeError(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listPartsHandler handles ListParts requests. All parts are returned in a
+// single response.
+func (g *Gateway) listPartsHandler(w http.ResponseWriter, req *http.Request, bucket, key, uploadID string) {
+	if _, err := g.loadUpload(bucket, key, uploadID); err != nil {
+		writeError(w, req, err)
+		return
+	}
+	fis, err := ioutil.ReadDir(g.uploadDir(uploadID))
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	result := listPartsResult{
+		Bucket:    bucket,
+		Key:       key,
+		UploadID:  uploadID,
+		Initiator: gatewayOwner,
+		Owner:     gatewayOwner,
+		MaxParts:  maxPartNumber,
+	}
+	// ReadDir sorts the files by name, which sorts the parts by number.
+	for _, fi := range fis {
+		var partNumber int
+		if _, err := fmt.Sscanf(fi.Name(), "part-%05d", &partNumber); err != nil || fi.Name() != filepath.Base(g.partPath(uploadID, partNumber)) {
+			continue
+		}
+		part, err := g.loadPart(uploadID, partNumber)
+		if err != nil {
+			writeError(w, req, err)
+			return
+		}
+		result.Parts = append(result.Parts, part)
+	}
+	writeXML(w, result)
+}
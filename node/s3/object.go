@@ -0,0 +1,327 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+)
+
+const (
+	// maxListKeys is the maximum number of keys returned by a single
+	// ListObjects request.
+	maxListKeys = 1000
+
+	// tmpDir is the directory of the renter that objects are uploaded to
+	// before they replace the existing object. The renter hides it and
+	// removes the uploads that were interrupted by a shutdown.
+	tmpDir = modules.S3UploadDir
+)
+
+type (
+	// listParams are the parameters of a ListObjects request.
+	listParams struct {
+		prefix    string
+		delimiter string
+		marker    string
+		maxKeys   int
+	}
+
+	// listResult is the result of listing the objects of a bucket.
+	listResult struct {
+		objects        []objectInfo
+		commonPrefixes []string
+		isTruncated    bool
+		nextMarker     string
+	}
+
+	// objectInfo describes a single object in a ListObjects response.
+	objectInfo struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         uint64    `xml:"Size"`
+		StorageClass string    `xml:"StorageClass"`
+	}
+
+	// commonPrefix is a prefix that groups keys in a ListObjects response.
+	commonPrefix struct {
+		Prefix string `xml:"Prefix"`
+	}
+
+	// listBucketResult is the response of both versions of the ListObjects
+	// request. The fields that only exist in one version are omitted when
+	// empty.
+	listBucketResult struct {
+		XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Name                  string         `xml:"Name"`
+		Prefix                string         `xml:"Prefix"`
+		Delimiter             string         `xml:"Delimiter,omitempty"`
+		Marker                string         `xml:"Marker,omitempty"`
+		NextMarker            string         `xml:"NextMarker,omitempty"`
+		ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+		NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+		StartAfter            string         `xml:"StartAfter,omitempty"`
+		KeyCount              int            `xml:"KeyCount,omitempty"`
+		MaxKeys               int            `xml:"MaxKeys"`
+		IsTruncated           bool           `xml:"IsTruncated"`
+		Contents              []objectInfo   `xml:"Contents"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	}
+)
+
+// listObjects lists the objects of a bucket among files, which may contain
+// files of other buckets. Keys that contain the delimiter after the prefix are
+// grouped into common prefixes. Only entries that sort after the marker are
+// returned.
+func listObjects(files []modules.FileInfo, bucket string, params listParams) listResult {
+	bucketPrefix := bucket + "/"
+	objects := make(map[string]modules.FileInfo)
+	var keys []string
+	for _, f := range files {
+		if !strings.HasPrefix(f.HyperspacePath, bucketPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(f.HyperspacePath, bucketPrefix)
+		if !strings.HasPrefix(key, params.prefix) || key <= params.marker {
+			continue
+		}
+		objects[key] = f
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result listResult
+	var count int
+	for _, key := range keys {
+		prefix := ""
+		if params.delimiter != "" {
+			if i := strings.Index(key[len(params.prefix):], params.delimiter); i >= 0 {
+				prefix = key[:len(params.prefix)+i+len(params.delimiter)]
+			}
+		}
+		// Skip common prefixes that were already returned, either by this
+		// request or by the previous one.
+		if prefix != "" && (strings.HasPrefix(params.marker, prefix) ||
+			(len(result.commonPrefixes) > 0 && result.commonPrefixes[len(result.commonPrefixes)-1] == prefix)) {
+			continue
+		}
+		if count == params.maxKeys {
+			result.isTruncated = true
+			break
+		}
+		count++
+		if prefix != "" {
+			result.commonPrefixes = append(result.commonPrefixes, prefix)
+			result.nextMarker = prefix
+			continue
+		}
+		f := objects[key]
+		result.objects = append(result.objects, objectInfo{
+			Key:          key,
+			LastModified: f.ModTime.UTC(),
+			Size:         f.Filesize,
+			StorageClass: "STANDARD",
+		})
+		result.nextMarker = key
+	}
+	if !result.isTruncated {
+		result.nextMarker = ""
+	}
+	return result
+}
+
+// listObjectsHandler handles both versions of the ListObjects request.
+func (g *Gateway) listObjectsHandler(w http.ResponseWriter, req *http.Request, bucket string) {
+	query := req.URL.Query()
+	params := listParams{
+		prefix:    query.Get("prefix"),
+		delimiter: query.Get("delimiter"),
+		maxKeys:   maxListKeys,
+	}
+	if s := query.Get("max-keys"); s != "" {
+		maxKeys, err := strconv.Atoi(s)
+		if err != nil || maxKeys < 0 {
+			writeError(w, req, errInvalidArgument)
+			return
+		}
+		if maxKeys < params.maxKeys {
+			params.maxKeys = maxKeys
+		}
+	}
+	v2 := query.Get("list-type") == "2"
+	if v2 {
+		params.marker = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			marker, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				writeError(w, req, errInvalidArgument)
+				return
+			}
+			params.marker = string(marker)
+		}
+	} else {
+		params.marker = query.Get("marker")
+	}
+
+	exists, err := g.dirExists(bucket)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	if !exists {
+		writeError(w, req, errNoSuchBucket)
+		return
+	}
+	files := g.renter.FileList(regexp.MustCompile("^" + regexp.QuoteMeta(bucket+"/"+params.prefix)))
+	result := listObjects(files, bucket, params)
+
+	resp := listBucketResult{
+		Name:        bucket,
+		Prefix:      params.prefix,
+		Delimiter:   params.delimiter,
+		MaxKeys:     params.maxKeys,
+		IsTruncated: result.isTruncated,
+		Contents:    result.objects,
+	}
+	for _, prefix := range result.commonPrefixes {
+		resp.CommonPrefixes = append(resp.CommonPrefixes, commonPrefix{Prefix: prefix})
+	}
+	if v2 {
+		resp.KeyCount = len(result.objects) + len(result.commonPrefixes)
+		resp.ContinuationToken = query.Get("continuation-token")
+		resp.StartAfter = query.Get("start-after")
+		if result.isTruncated {
+			resp.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(result.nextMarker))
+		}
+	} else {
+		resp.Marker = params.marker
+		resp.NextMarker = result.nextMarker
+	}
+	writeXML(w, resp)
+}
+
+// putObjectHandler handles PutObject requests. Keys that end in a slash are
+// folders, which are created as directories of the renter.
+func (g *Gateway) putObjectHandler(w http.ResponseWriter, req *http.Request, body *verifyingReader, bucket, key string) {
+	if strings.HasSuffix(key, "/") {
+		n, err := io.Copy(ioutil.Discard, body)
+		if err != nil {
+			writeError(w, req, err)
+			return
+		}
+		if n > 0 {
+			writeError(w, req, errInvalidArgument)
+			return
+		}
+		if err := g.renter.CreateDir(siaPath(bucket, key)); err != nil {
+			writeError(w, req, err)
+			return
+		}
+		w.Header().Set("ETag", body.ETag())
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err := g.uploadObject(bucket, key, body); err != nil {
+		writeError(w, req, err)
+		return
+	}
+	w.Header().Set("ETag", body.ETag())
+	w.WriteHeader(http.StatusOK)
+}
+
+// uploadObject streams the data of an object to the renter. The object is
+// uploaded to a temporary file first so that an existing object is only
+// replaced once the upload succeeded.
+func (g *Gateway) uploadObject(bucket, key string, r io.Reader) error {
+	tmpPath := tmpDir + "/" + hex.EncodeToString(fastrand.Bytes(16))
+	err := g.renter.UploadStreamFromReader(modules.FileUploadParams{HyperspacePath: tmpPath}, r)
+	if err != nil {
+		return err
+	}
+	if err := g.renter.ReplaceFile(tmpPath, siaPath(bucket, key)); err != nil {
+		return errors.Compose(err, g.renter.PurgeFile(tmpPath))
+	}
+	return nil
+}
+
+// getObjectHandler handles GetObject and HeadObject requests. Range requests
+// are served by seeking the renter's streamer, so only the requested chunks
+// are downloaded.
+func (g *Gateway) getObjectHandler(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	if strings.HasSuffix(key, "/") {
+		exists, err := g.dirExists(siaPath(bucket, key))
+		if err != nil {
+			writeError(w, req, err)
+			return
+		}
+		if !exists {
+			writeError(w, req, errNoSuchKey)
+			return
+		}
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	sp := siaPath(bucket, key)
+	fi, err := g.renter.File(sp)
+	if errors.Contains(err, siafile.ErrUnknownPath) {
+		writeError(w, req, errNoSuchKey)
+		return
+	} else if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	_, streamer, err := g.renter.Streamer(sp)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	defer streamer.Close()
+
+	// Set the content type to prevent http.ServeContent from downloading the
+	// beginning of the file to detect it.
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, req, key, fi.ModTime, streamer)
+}
+
+// deleteObjectHandler handles DeleteObject requests. Like S3, deleting an
+// object that doesn't exist succeeds.
+func (g *Gateway) deleteObjectHandler(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	var err error
+	if strings.HasSuffix(key, "/") {
+		dirs, files, listErr := g.renter.DirList(siaPath(bucket, key))
+		if listErr == nil && len(dirs) == 1 && len(files) == 0 {
+			err = g.renter.DeleteDir(siaPath(bucket, key))
+		} else if !errors.Contains(listErr, siafile.ErrUnknownDir) {
+			err = listErr
+		}
+	} else {
+		err = g.renter.DeleteFile(siaPath(bucket, key))
+		if errors.Contains(err, siafile.ErrUnknownPath) {
+			err = nil
+		}
+	}
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,91 @@
+package s3
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+)
+
+// TestListObjects tests listing the objects of a bucket with prefixes,
+// delimiters and markers.
+func TestListObjects(t *testing.T) {
+	var files []modules.FileInfo
+	for _, path := range []string{
+		"other/a",
+		"photos/2018/a.jpg",
+		"photos/2018/b.jpg",
+		"photos/2019/c.jpg",
+		"photos/index.html",
+		"photos/readme",
+	} {
+		files = append(files, modules.FileInfo{HyperspacePath: path})
+	}
+	keys := func(result listResult) []string {
+		var keys []string
+		for _, o := range result.objects {
+			keys = append(keys, o.Key)
+		}
+		return keys
+	}
+
+	tests := []struct {
+		params         listParams
+		keys           []string
+		commonPrefixes []string
+		nextMarker     string
+	}{
+		// Everything.
+		{
+			params: listParams{maxKeys: maxListKeys},
+			keys:   []string{"2018/a.jpg", "2018/b.jpg", "2019/c.jpg", "index.html", "readme"},
+		},
+		// Prefix.
+		{
+			params: listParams{prefix: "2018/", maxKeys: maxListKeys},
+			keys:   []string{"2018/a.jpg", "2018/b.jpg"},
+		},
+		// Delimiter.
+		{
+			params:         listParams{delimiter: "/", maxKeys: maxListKeys},
+			keys:           []string{"index.html", "readme"},
+			commonPrefixes: []string{"2018/", "2019/"},
+		},
+		// Truncated listing.
+		{
+			params:     listParams{maxKeys: 2},
+			keys:       []string{"2018/a.jpg", "2018/b.jpg"},
+			nextMarker: "2018/b.jpg",
+		},
+		// Continuing a listing.
+		{
+			params: listParams{marker: "2018/b.jpg", maxKeys: maxListKeys},
+			keys:   []string{"2019/c.jpg", "index.html", "readme"},
+		},
+		// Truncated listing ending with a common prefix.
+		{
+			params:         listParams{delimiter: "/", maxKeys: 1},
+			commonPrefixes: []string{"2018/"},
+			nextMarker:     "2018/",
+		},
+		// Continuing after a common prefix.
+		{
+			params:         listParams{delimiter: "/", marker: "2018/", maxKeys: 2},
+			keys:           []string{"index.html"},
+			commonPrefixes: []string{"2019/"},
+			nextMarker:     "index.html",
+		},
+	}
+	for i, test := range tests {
+		result := listObjects(files, "photos", test.params)
+		if !reflect.DeepEqual(keys(result), test.keys) {
+			t.Errorf("%v: expected keys %v, got %v", i, test.keys, keys(result))
+		}
+		if !reflect.DeepEqual(result.commonPrefixes, test.commonPrefixes) {
+			t.Errorf("%v: expected common prefixes %v, got %v", i, test.commonPrefixes, result.commonPrefixes)
+		}
+		if result.nextMarker != test.nextMarker || result.isTruncated != (test.nextMarker != "") {
+			t.Errorf("%v: expected next marker %q, got %q", i, test.nextMarker, result.nextMarker)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package s3 serves a subset of the Amazon S3 API on top of the renter, so
+// that applications which already speak S3 can store their data on
+// Hyperspace. Buckets are the top-level directories of the renter and objects
+// are the files below them. Requests are authenticated with AWS Signature
+// Version 4 using access keys that are configured locally. Only path-style
+// requests are supported.
+package s3
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/HyperspaceApp/Hyperspace/config"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+)
+
+const (
+	// Dir is the name of the directory within the hyperspace directory that
+	// holds the parts of multipart uploads.
+	Dir = "s3"
+
+	// defaultRegion is the region used when none is configured.
+	defaultRegion = "us-east-1"
+
+	// multipartDir is the directory within the staging directory that holds
+	// the parts of multipart uploads until they are completed.
+	multipartDir = "multipart"
+)
+
+var (
+	// bucketNameRegexp matches the bucket names accepted by the gateway,
+	// which follow the DNS-compatible naming rules of S3.
+	bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+	errNilRenter    = errors.New("the S3 gateway requires the renter")
+	errNoAccessKeys = errors.New("no access keys are configured for the S3 gateway")
+)
+
+// Gateway is an http.Handler that translates S3 requests into calls to the
+// renter.
+type Gateway struct {
+	accessKeys map[string]string
+	region     string
+	renter     modules.Renter
+	stagingDir string
+
+	// mu serializes access to the persisted multipart uploads, which the
+	// persist package doesn't allow to be loaded concurrently.
+	mu sync.Mutex
+}
+
+// New creates a Gateway for the renter. Parts of multipart uploads are kept in
+// stagingDir until the upload is completed.
+func New(r modules.Renter, cfg config.S3Config, stagingDir string) (*Gateway, error) {
+	if r == nil {
+		return nil, errNilRenter
+	}
+	if len(cfg.AccessKeys) == 0 {
+		return nil, errNoAccessKeys
+	}
+	region := cfg.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	if err := os.MkdirAll(filepath.Join(stagingDir, multipartDir), 0700); err != nil {
+		return nil, err
+	}
+	return &Gateway{
+		accessKeys: cfg.AccessKeys,
+		region:     region,
+		renter:     r,
+		stagingDir: stagingDir,
+	}, nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	payloadHash, err := g.authenticate(req)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	var body *verifyingReader
+	if req.Method == http.MethodPut || req.Method == http.MethodPost {
+		body, err = newVerifyingReader(req.Body, payloadHash, req.Header.Get("Content-MD5"))
+		if err != nil {
+			writeError(w, req, err)
+			return
+		}
+	}
+
+	bucket, key := splitPath(req.URL.Path)
+	if bucket == "" {
+		if req.Method != http.MethodGet {
+			writeError(w, req, errMethodNotAllowed)
+			return
+		}
+		g.listBucketsHandler(w, req)
+		return
+	}
+	if !bucketNameRegexp.MatchString(bucket) {
+		writeError(w, req, errInvalidBucketName)
+		return
+	}
+	if key == "" {
+		g.serveBucket(w, req, body, bucket)
+		return
+	}
+	if !validKey(key) {
+		writeError(w, req, errInvalidObjectName)
+		return
+	}
+	g.serveObject(w, req, body, bucket, key)
+}
+
+// serveBucket dispatches requests for a bucket. body is the verified request
+// body of PUT and POST requests.
+func (g *Gateway) serveBucket(w http.ResponseWriter, req *http.Request, body *verifyingReader, bucket string) {
+	query := req.URL.Query()
+	switch req.Method {
+	case http.MethodGet:
+		if _, ok := query["uploads"]; ok {
+			writeError(w, req, errNotImplemented)
+			return
+		}
+		g.listObjectsHandler(w, req, bucket)
+	case http.MethodHead:
+		g.headBucketHandler(w, req, bucket)
+	case http.MethodPut:
+		g.createBucketHandler(w, req, body, bucket)
+	case http.MethodDelete:
+		g.deleteBucketHandler(w, req, bucket)
+	default:
+		writeError(w, req, errMethodNotAllowed)
+	}
+}
+
+// serveObject dispatches requests for an object, including the requests that
+// make up a multipart upload. body is the verified request body of PUT and
+// POST requests.
+func (g *Gateway) serveObject(w http.ResponseWriter, req *http.Request, body *verifyingReader, bucket, key string) {
+	query := req.URL.Query()
+	_, uploads := query["uploads"]
+	uploadID := query.Get("uploadId")
+	switch {
+	case req.Method == http.MethodPost && uploads:
+		g.createMultipartUploadHandler(w, req, bucket, key)
+	case req.Method == http.MethodPut && uploadID != "":
+		g.uploadPartHandler(w, req, body, bucket, key, uploadID)
+	case req.Method == http.MethodPost && uploadID != "":
+		g.completeMultipartUploadHandler(w, req, body, bucket, key, uploadID)
+	case req.Method == http.MethodDelete && uploadID != "":
+		g.abortMultipartUploadHandler(w, req, bucket, key, uploadID)
+	case req.Method == http.MethodGet && uploadID != "":
+		g.listPartsHandler(w, req, bucket, key, uploadID)
+	case req.Method == http.MethodPut:
+		if req.Header.Get("X-Amz-Copy-Source") != "" {
+			writeError(w, req, errNotImplemented)
+			return
+		}
+		g.putObjectHandler(w, req, body, bucket, key)
+	case req.Method == http.MethodGet || req.Method == http.MethodHead:
+		g.getObjectHandler(w, req, bucket, key)
+	case req.Method == http.MethodDelete:
+		g.deleteObjectHandler(w, req, bucket, key)
+	default:
+		writeError(w, req, errMethodNotAllowed)
+	}
+}
+
+// splitPath splits the path of a request into the bucket and the object key.
+func splitPath(path string) (bucket, key string) {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// validKey returns whether key can be stored as a file of the renter. A single
+// trailing slash is allowed since it denotes a folder.
+func validKey(key string) bool {
+	for _, elem := range strings.Split(strings.TrimSuffix(key, "/"), "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// siaPath returns the path of the renter that an object is stored at.
+func siaPath(bucket, key string) string {
+	return bucket + "/" + strings.TrimSuffix(key, "/")
+}
@@ -0,0 +1,374 @@
+package webdav
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/modules/renter/siafile"
+	"github.com/HyperspaceApp/errors"
+	"github.com/HyperspaceApp/fastrand"
+
+	xwebdav "golang.org/x/net/webdav"
+)
+
+const (
+	// tmpDir is the directory of the renter that files are uploaded to before
+	// they replace the existing file. The renter hides it and removes the
+	// uploads that were interrupted by a shutdown.
+	tmpDir = modules.WebDAVUploadDir
+
+	// defaultFileMode is the mode reported for files.
+	defaultFileMode = 0644
+
+	// defaultDirMode is the mode reported for directories.
+	defaultDirMode = os.ModeDir | 0755
+)
+
+var (
+	errIsDirectory    = errors.New("is a directory")
+	errNotDirectory   = errors.New("not a directory")
+	errReadOnlyFile   = errors.New("file is opened for reading")
+	errWriteOnlyFile  = errors.New("file is opened for writing")
+	errRenameIntoTemp = errors.New("cannot rename into the upload directory")
+)
+
+// requestBodyKey is the context key of the body of a PUT request.
+type requestBodyKey struct{}
+
+// withRequestBody returns a context that carries the body of a PUT request.
+func withRequestBody(ctx context.Context, body *requestBody) context.Context {
+	return context.WithValue(ctx, requestBodyKey{}, body)
+}
+
+// siaPath converts the name of a WebDAV resource into a path of the renter.
+func siaPath(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+// isNotExist returns whether err reports that a file or directory of the
+// renter doesn't exist.
+func isNotExist(err error) bool {
+	return errors.Contains(err, siafile.ErrUnknownPath) || errors.Contains(err, siafile.ErrUnknownDir)
+}
+
+// fileSystem implements xwebdav.FileSystem on top of the renter.
+type fileSystem struct {
+	renter modules.Renter
+}
+
+// Mkdir implements xwebdav.FileSystem.
+func (fsys *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	sp := siaPath(name)
+	if _, err := fsys.Stat(ctx, name); err == nil {
+		return os.ErrExist
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if parent := path.Dir(sp); parent != "." {
+		if _, _, err := fsys.renter.DirList(parent); isNotExist(err) {
+			return os.ErrNotExist
+		} else if err != nil {
+			return err
+		}
+	}
+	return fsys.renter.CreateDir(sp)
+}
+
+// OpenFile implements xwebdav.FileSystem. Files opened for writing are
+// uploaded as a stream while they are written.
+func (fsys *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (xwebdav.File, error) {
+	sp := siaPath(name)
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		if sp == "" {
+			return nil, errIsDirectory
+		}
+		body, _ := ctx.Value(requestBodyKey{}).(*requestBody)
+		return newUploadFile(fsys.renter, sp, body), nil
+	}
+	fi, err := fsys.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &dirFile{
+			renter: fsys.renter,
+			info:   fi,
+			path:   sp,
+		}, nil
+	}
+	_, streamer, err := fsys.renter.Streamer(sp)
+	if err != nil {
+		return nil, err
+	}
+	return &readFile{
+		Streamer: streamer,
+		info:     fi,
+	}, nil
+}
+
+// RemoveAll implements xwebdav.FileSystem.
+func (fsys *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	fi, err := fsys.Stat(ctx, name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fsys.renter.DeleteDir(siaPath(name))
+	}
+	return fsys.renter.DeleteFile(siaPath(name))
+}
+
+// Rename implements xwebdav.FileSystem.
+func (fsys *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	newPath := siaPath(newName)
+	if newPath == tmpDir || strings.HasPrefix(newPath, tmpDir+"/") {
+		return errRenameIntoTemp
+	}
+	fi, err := fsys.Stat(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		err = fsys.renter.RenameDir(siaPath(oldName), newPath)
+	} else {
+		err = fsys.renter.RenameFile(siaPath(oldName), newPath)
+	}
+	if errors.Contains(err, siafile.ErrPathOverload) {
+		return os.ErrExist
+	}
+	return err
+}
+
+// Stat implements xwebdav.FileSystem.
+func (fsys *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	sp := siaPath(name)
+	if sp != "" {
+		fi, err := fsys.renter.File(sp)
+		if err == nil {
+			return newFileInfo(fi), nil
+		} else if !isNotExist(err) {
+			return nil, err
+		}
+	}
+	dirs, _, err := fsys.renter.DirList(sp)
+	if isNotExist(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	return newDirInfo(dirs[0]), nil
+}
+
+// fileInfo implements os.FileInfo for the files and directories of the
+// renter.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// newFileInfo returns the os.FileInfo of a file.
+func newFileInfo(fi modules.FileInfo) *fileInfo {
+	return &fileInfo{
+		name:    path.Base(fi.HyperspacePath),
+		size:    int64(fi.Filesize),
+		mode:    defaultFileMode,
+		modTime: fi.ModTime,
+	}
+}
+
+// newDirInfo returns the os.FileInfo of a directory.
+func newDirInfo(di modules.DirectoryInfo) *fileInfo {
+	return &fileInfo{
+		name:    path.Base("/" + di.HyperspacePath),
+		mode:    defaultDirMode,
+		modTime: di.LastModified,
+	}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+// ContentType implements xwebdav.ContentTyper. Without it PROPFIND would
+// download the beginning of every file to detect its content type.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	return contentType(fi.name), nil
+}
+
+// dirFile is an open directory of the renter.
+type dirFile struct {
+	renter modules.Renter
+	info   os.FileInfo
+	path   string
+
+	// entries are the remaining entries of the directory when it is read in
+	// batches.
+	entries []os.FileInfo
+	read    bool
+}
+
+// Close implements xwebdav.File.
+func (d *dirFile) Close() error { return nil }
+
+// Read implements xwebdav.File.
+func (d *dirFile) Read([]byte) (int, error) { return 0, errIsDirectory }
+
+// Seek implements xwebdav.File.
+func (d *dirFile) Seek(int64, int) (int64, error) { return 0, errIsDirectory }
+
+// Stat implements xwebdav.File.
+func (d *dirFile) Stat() (os.FileInfo, error) { return d.info, nil }
+
+// Write implements xwebdav.File.
+func (d *dirFile) Write([]byte) (int, error) { return 0, errIsDirectory }
+
+// Readdir implements xwebdav.File. It lists the subdirectories and files of
+// the directory.
+func (d *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.read {
+		dirs, files, err := d.renter.DirList(d.path)
+		if err != nil {
+			return nil, err
+		}
+		// The first directory is the directory itself.
+		for _, di := range dirs[1:] {
+			d.entries = append(d.entries, newDirInfo(di))
+		}
+		for _, fi := range files {
+			d.entries = append(d.entries, newFileInfo(fi))
+		}
+		d.read = true
+	}
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
+
+// readFile is a file of the renter that is opened for reading. Reads are
+// served by the renter's streamer, so range requests only download the
+// requested data.
+type readFile struct {
+	modules.Streamer
+	info os.FileInfo
+}
+
+// Readdir implements xwebdav.File.
+func (f *readFile) Readdir(int) ([]os.FileInfo, error) { return nil, errNotDirectory }
+
+// Stat implements xwebdav.File.
+func (f *readFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+// Write implements xwebdav.File.
+func (f *readFile) Write([]byte) (int, error) { return 0, errReadOnlyFile }
+
+// uploadFile is a file of the renter that is opened for writing. The data is
+// piped into a streaming upload to a temporary file, which replaces the file
+// once it is closed.
+type uploadFile struct {
+	body   *requestBody
+	dst    string
+	n      int64
+	pw     *io.PipeWriter
+	renter modules.Renter
+	tmp    string
+
+	done chan struct{}
+	err  error
+}
+
+// newUploadFile starts a streaming upload that replaces the file at dst when
+// the returned file is closed. body is the body of the request if the file is
+// written by a PUT request.
+func newUploadFile(r modules.Renter, dst string, body *requestBody) *uploadFile {
+	pr, pw := io.Pipe()
+	f := &uploadFile{
+		body:   body,
+		dst:    dst,
+		pw:     pw,
+		renter: r,
+		tmp:    tmpDir + "/" + hex.EncodeToString(fastrand.Bytes(16)),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(f.done)
+		f.err = r.UploadStreamFromReader(modules.FileUploadParams{HyperspacePath: f.tmp}, pr)
+		// Unblock writers if the upload failed.
+		pr.CloseWithError(f.err)
+	}()
+	return f
+}
+
+// Close implements xwebdav.File. It blocks until the upload finished and the
+// file was replaced.
+func (f *uploadFile) Close() error {
+	if f.body != nil {
+		if err := f.body.complete(); err != nil {
+			f.pw.CloseWithError(err)
+			<-f.done
+			return err
+		}
+	}
+	f.pw.Close()
+	<-f.done
+	if f.err != nil {
+		return f.err
+	}
+	if err := f.renter.ReplaceFile(f.tmp, f.dst); err != nil {
+		return errors.Compose(err, f.renter.PurgeFile(f.tmp))
+	}
+	return nil
+}
+
+// Read implements xwebdav.File.
+func (f *uploadFile) Read([]byte) (int, error) { return 0, errWriteOnlyFile }
+
+// Readdir implements xwebdav.File.
+func (f *uploadFile) Readdir(int) ([]os.FileInfo, error) { return nil, errNotDirectory }
+
+// Seek implements xwebdav.File. Only the current offset can be queried since
+// the data is uploaded as it is written.
+func (f *uploadFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.n, nil
+	}
+	return 0, errWriteOnlyFile
+}
+
+// Stat implements xwebdav.File.
+func (f *uploadFile) Stat() (os.FileInfo, error) {
+	return &fileInfo{
+		name:    path.Base(f.dst),
+		size:    f.n,
+		mode:    defaultFileMode,
+		modTime: time.Now(),
+	}, nil
+}
+
+// Write implements xwebdav.File.
+func (f *uploadFile) Write(b []byte) (int, error) {
+	n, err := f.pw.Write(b)
+	f.n += int64(n)
+	return n, err
+}
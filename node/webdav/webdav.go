@@ -0,0 +1,127 @@
+// Package webdav serves the renter's files over WebDAV, so that desktop file
+// managers can mount them without custom software. Directories of the renter
+// are WebDAV collections and files are downloaded through the streamer and
+// uploaded as streams. Every request requires HTTP basic authentication with
+// the locally configured credentials.
+package webdav
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/HyperspaceApp/Hyperspace/config"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+
+	xwebdav "golang.org/x/net/webdav"
+)
+
+// realm is the realm of the basic authentication challenge.
+const realm = "Hyperspace"
+
+var (
+	errNilRenter     = errors.New("the WebDAV server requires the renter")
+	errNoCredentials = errors.New("no username and password are configured for the WebDAV server")
+	errUploadAborted = errors.New("upload aborted before the request body was read completely")
+)
+
+// Server is an http.Handler that serves the renter over WebDAV.
+type Server struct {
+	handler  http.Handler
+	username string
+	password string
+}
+
+// New creates a WebDAV server for the renter.
+func New(r modules.Renter, cfg config.WebDAVConfig) (*Server, error) {
+	if r == nil {
+		return nil, errNilRenter
+	}
+	if cfg.Username == "" || cfg.Password == "" {
+		return nil, errNoCredentials
+	}
+	return &Server{
+		handler: &xwebdav.Handler{
+			FileSystem: &fileSystem{renter: r},
+			LockSystem: xwebdav.NewMemLS(),
+		},
+		username: cfg.Username,
+		password: cfg.Password,
+	}, nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	username, password, ok := req.BasicAuth()
+	userMatch := subtle.ConstantTimeCompare([]byte(username), []byte(s.username)) == 1
+	passMatch := subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+	if !ok || !userMatch || !passMatch {
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		// Set the content type to prevent http.ServeContent from downloading
+		// the beginning of the file to detect it.
+		w.Header().Set("Content-Type", contentType(req.URL.Path))
+	case http.MethodPut:
+		// The WebDAV handler closes the file it writes to even if reading the
+		// body failed. Track the body so that incomplete uploads are
+		// discarded instead of replacing the file.
+		body := &requestBody{
+			r:             req.Body,
+			contentLength: req.ContentLength,
+		}
+		req.Body = body
+		req = req.WithContext(withRequestBody(req.Context(), body))
+	}
+	s.handler.ServeHTTP(w, req)
+}
+
+// contentType returns the content type of a file based on its extension.
+func contentType(name string) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// requestBody wraps the body of a PUT request and remembers whether it was
+// read completely.
+type requestBody struct {
+	r             io.ReadCloser
+	n             int64
+	contentLength int64
+	err           error
+}
+
+// Read implements the io.Reader interface.
+func (rb *requestBody) Read(b []byte) (int, error) {
+	n, err := rb.r.Read(b)
+	rb.n += int64(n)
+	if err != nil && err != io.EOF {
+		rb.err = err
+	}
+	return n, err
+}
+
+// Close implements the io.Closer interface.
+func (rb *requestBody) Close() error {
+	return rb.r.Close()
+}
+
+// complete returns an error if the body was not read completely.
+func (rb *requestBody) complete() error {
+	if rb.err != nil {
+		return rb.err
+	}
+	if rb.contentLength >= 0 && rb.n != rb.contentLength {
+		return errUploadAborted
+	}
+	return nil
+}
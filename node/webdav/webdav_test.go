@@ -0,0 +1,106 @@
+package webdav
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBasicAuth tests that requests are only passed on with the configured
+// credentials.
+func TestBasicAuth(t *testing.T) {
+	var served bool
+	s := &Server{
+		handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			served = true
+		}),
+		username: "user",
+		password: "pass",
+	}
+	tests := []struct {
+		username string
+		password string
+		setAuth  bool
+		ok       bool
+	}{
+		{"", "", false, false},
+		{"user", "wrong", true, false},
+		{"wrong", "pass", true, false},
+		{"", "", true, false},
+		{"user", "pass", true, true},
+	}
+	for i, test := range tests {
+		served = false
+		req := httptest.NewRequest("PROPFIND", "/", nil)
+		if test.setAuth {
+			req.SetBasicAuth(test.username, test.password)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if served != test.ok {
+			t.Errorf("%v: expected request to be served: %v", i, test.ok)
+		}
+		if !test.ok && (rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "") {
+			t.Errorf("%v: expected an authentication challenge, got %v", i, rec.Code)
+		}
+	}
+}
+
+// TestRequestBody tests that requestBody detects bodies that were not read
+// completely.
+func TestRequestBody(t *testing.T) {
+	data := []byte("hello world")
+
+	// Complete body.
+	rb := &requestBody{r: ioutil.NopCloser(bytes.NewReader(data)), contentLength: int64(len(data))}
+	if _, err := ioutil.ReadAll(rb); err != nil {
+		t.Fatal(err)
+	}
+	if err := rb.complete(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Body without a content length.
+	rb = &requestBody{r: ioutil.NopCloser(bytes.NewReader(data)), contentLength: -1}
+	if _, err := ioutil.ReadAll(rb); err != nil {
+		t.Fatal(err)
+	}
+	if err := rb.complete(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Body that is shorter than announced.
+	rb = &requestBody{r: ioutil.NopCloser(bytes.NewReader(data)), contentLength: int64(len(data)) + 1}
+	if _, err := ioutil.ReadAll(rb); err != nil {
+		t.Fatal(err)
+	}
+	if err := rb.complete(); err != errUploadAborted {
+		t.Fatalf("expected %v, got %v", errUploadAborted, err)
+	}
+}
+
+// TestSiaPath tests converting WebDAV names into paths of the renter.
+func TestSiaPath(t *testing.T) {
+	tests := map[string]string{
+		"/":            "",
+		"":             "",
+		"/foo/bar.txt": "foo/bar.txt",
+		"/foo/":        "foo",
+		"/foo/../bar":  "bar",
+		"/../foo":      "foo",
+	}
+	for name, expected := range tests {
+		if sp := siaPath(name); sp != expected {
+			t.Errorf("expected %q to map to %q, got %q", name, expected, sp)
+		}
+	}
+	if !strings.HasPrefix(contentType("/foo/bar.txt"), "text/plain") {
+		t.Error("wrong content type for .txt file", contentType("/foo/bar.txt"))
+	}
+	if contentType("/foo/bar") != "application/octet-stream" {
+		t.Error("wrong content type for file without extension", contentType("/foo/bar"))
+	}
+}
@@ -0,0 +1,143 @@
+// +build linux
+
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HyperspaceApp/Hyperspace/crypto"
+	"github.com/HyperspaceApp/Hyperspace/modules"
+	"github.com/HyperspaceApp/Hyperspace/siatest"
+)
+
+// TestRenterFuse tests mounting the renter as a read-only FUSE filesystem.
+func TestRenterFuse(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("FUSE is not available:", err)
+	}
+	t.Parallel()
+
+	// Create a group for the subtests
+	groupParams := siatest.GroupParams{
+		Hosts:   2,
+		Renters: 1,
+		Miners:  1,
+	}
+
+	// Specify subtests to run
+	subTests := []test{
+		{"TestFuseMount", testFuseMount},
+	}
+
+	// Run tests
+	if err := runRenterTests(t, groupParams, subTests); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testFuseMount tests that files of the renter can be listed and read through
+// a mounted filesystem and that the filesystem can't be written to.
+func testFuseMount(t *testing.T, tg *siatest.TestGroup) {
+	r := tg.Renters()[0]
+
+	// Upload a file that spans multiple chunks.
+	dataPieces := uint64(1)
+	parityPieces := uint64(len(tg.Hosts())) - dataPieces
+	fileSize := int(3*modules.SectorSize + 100)
+	_, rf, err := r.UploadNewFileBlocking(fileSize, dataPieces, parityPieces, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mount the renter.
+	mountPoint := filepath.Join(siatest.TestDir(t.Name()), "mnt")
+	if err := os.MkdirAll(mountPoint, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RenterFuseMountPost(mountPoint, ""); err != nil {
+		t.Fatal(err)
+	}
+	mounted := true
+	defer func() {
+		if mounted {
+			if err := r.RenterFuseUnmountPost(mountPoint); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	rfg, err := r.RenterFuseGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rfg.MountPoints) != 1 || rfg.MountPoints[0].MountPoint != mountPoint {
+		t.Fatal("mount point wasn't listed", rfg.MountPoints)
+	}
+	// Mounting twice should fail.
+	if err := r.RenterFuseMountPost(mountPoint, ""); err == nil {
+		t.Fatal("mounting the same mount point twice should fail")
+	}
+
+	// The file should have the right size and content.
+	path := filepath.Join(mountPoint, rf.HyperspacePath())
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(fileSize) {
+		t.Fatalf("expected size %v, got %v", fileSize, fi.Size())
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.HashBytes(data) != rf.Checksum() {
+		t.Fatal("data read through the filesystem doesn't match the uploaded data")
+	}
+
+	// Reading from an offset should return the same data.
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := make([]byte, 200)
+	offset := int64(modules.SectorSize) - 100
+	_, err = f.ReadAt(partial, offset)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(partial, data[offset:offset+int64(len(partial))]) {
+		t.Fatal("partial read returned the wrong data")
+	}
+
+	// The filesystem is read-only.
+	if err := ioutil.WriteFile(path, []byte("foo"), 0600); err == nil {
+		t.Fatal("writing to the filesystem should fail")
+	}
+	if err := os.Mkdir(filepath.Join(mountPoint, "foo"), 0700); err == nil {
+		t.Fatal("creating a directory should fail")
+	}
+
+	// Unmount the filesystem.
+	if err := r.RenterFuseUnmountPost(mountPoint); err != nil {
+		t.Fatal(err)
+	}
+	mounted = false
+	rfg, err = r.RenterFuseGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rfg.MountPoints) != 0 {
+		t.Fatal("mount point is still listed", rfg.MountPoints)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("file is still visible after unmounting", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"errors"
 	"math"
 	"math/big"
+	"strings"
 
 	"github.com/HyperspaceApp/Hyperspace/build"
 )
@@ -35,6 +36,10 @@ var (
 	// unit64 would cause an overflow.
 	ErrUint64Overflow = errors.New("cannot return the uint64 of this currency - result is an overflow")
 
+	// ErrMissingCurrencyUnits is the error that is returned by ParseCurrency
+	// if the amount doesn't end in a unit.
+	ErrMissingCurrencyUnits = errors.New("amount is missing units")
+
 	// ZeroCurrency defines a currency of value zero.
 	ZeroCurrency = NewCurrency64(0)
 )
@@ -50,6 +55,46 @@ func NewCurrency(b *big.Int) (c Currency) {
 	return
 }
 
+// ParseCurrency parses an amount of space cash that ends in one of the units
+// pS, nS, uS, mS, S, KS, MS, GS or TS, or in H for hastings, e.g. "1.23KS".
+// The amount must be a whole number of hastings.
+func ParseCurrency(amount string) (Currency, error) {
+	// "S" is a suffix of the other units, so the longest matching unit is
+	// used.
+	units := []string{"pS", "nS", "uS", "mS", "S", "KS", "MS", "GS", "TS"}
+	index := -1
+	for i, unit := range units {
+		if strings.HasSuffix(amount, unit) && (index == -1 || len(unit) > len(units[index])) {
+			index = i
+		}
+	}
+	if index != -1 {
+		r, ok := new(big.Rat).SetString(strings.TrimSuffix(amount, units[index]))
+		if !ok {
+			return Currency{}, errors.New("malformed amount")
+		}
+		exp := 24 + 3*(int64(index)-4)
+		mag := new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil)
+		r.Mul(r, new(big.Rat).SetInt(mag))
+		if !r.IsInt() {
+			return Currency{}, errors.New("non-integer number of hastings")
+		} else if r.Sign() < 0 {
+			return Currency{}, ErrNegativeCurrency
+		}
+		return NewCurrency(r.Num()), nil
+	}
+	if strings.HasSuffix(amount, "H") {
+		i, ok := new(big.Int).SetString(strings.TrimSuffix(amount, "H"), 10)
+		if !ok {
+			return Currency{}, errors.New("malformed amount")
+		} else if i.Sign() < 0 {
+			return Currency{}, ErrNegativeCurrency
+		}
+		return NewCurrency(i), nil
+	}
+	return Currency{}, ErrMissingCurrencyUnits
+}
+
 // NewCurrency64 creates a Currency value from a uint64.
 func NewCurrency64(x uint64) (c Currency) {
 	c.i.SetUint64(x)
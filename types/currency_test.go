@@ -391,3 +391,38 @@ func TestCurrencyUint64(t *testing.T) {
 		t.Error("result is not being zeroed in the event of an error")
 	}
 }
+
+// TestParseCurrency tests parsing amounts with units.
+func TestParseCurrency(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   Currency
+	}{
+		{"1S", SiacoinPrecision},
+		{"1.5KS", SiacoinPrecision.Mul64(1500)},
+		{"2TS", SiacoinPrecision.Mul64(2e12)},
+		{"3mS", SiacoinPrecision.Div64(1e3).Mul64(3)},
+		{"1pS", SiacoinPrecision.Div64(1e12)},
+		{"123H", NewCurrency64(123)},
+	}
+	for _, test := range tests {
+		c, err := ParseCurrency(test.amount)
+		if err != nil {
+			t.Error(test.amount, err)
+		} else if !c.Equals(test.want) {
+			t.Errorf("%v: expected %v, got %v", test.amount, test.want, c)
+		}
+	}
+
+	if _, err := ParseCurrency("123"); err != ErrMissingCurrencyUnits {
+		t.Error("expected ErrMissingCurrencyUnits, got", err)
+	}
+	if _, err := ParseCurrency("-1S"); err != ErrNegativeCurrency {
+		t.Error("expected ErrNegativeCurrency, got", err)
+	}
+	for _, invalid := range []string{"1.5H", "xS", "1e-30S"} {
+		if _, err := ParseCurrency(invalid); err == nil {
+			t.Error("expected an error for", invalid)
+		}
+	}
+}